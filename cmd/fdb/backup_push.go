@@ -20,6 +20,7 @@ var backupPushCmd = &cobra.Command{
 	Use:   "backup-push",
 	Short: BackupPushShortDescription,
 	Run: func(cmd *cobra.Command, args []string) {
+		internal.AssertCrypterConfigured(internal.BackupContentType)
 		ctx, cancel := context.WithCancel(context.Background())
 		signalHandler := utility.NewSignalHandler(ctx, cancel, []os.Signal{syscall.SIGINT, syscall.SIGTERM})
 		defer func() { _ = signalHandler.Close() }()
@@ -0,0 +1,31 @@
+package gp
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/greenplum"
+)
+
+const BackupPushShortDescription = "Makes backups of all segments and links them by a cluster backup"
+
+// backupPushCmd is run on the coordinator
+var backupPushCmd = &cobra.Command{
+	Use:   "backup-push",
+	Short: BackupPushShortDescription,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		uploader, err := internal.ConfigureUploader()
+		tracelog.ErrorLogger.FatalOnError(err)
+		lock, err := internal.ConfigureBackupPushLock(uploader.UploadingFolder)
+		tracelog.ErrorLogger.FatalOnError(err)
+		greenplum.HandleBackupPush(uploader)
+		if lock != nil {
+			tracelog.ErrorLogger.FatalOnError(lock.Release())
+		}
+	},
+}
+
+func init() {
+	Cmd.AddCommand(backupPushCmd)
+}
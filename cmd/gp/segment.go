@@ -0,0 +1,68 @@
+package gp
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/greenplum"
+)
+
+const (
+	SegmentBackupPushShortDescription = "Makes backup of a segment, run by backup-push"
+	SegmentWalPushShortDescription    = "Uploads a WAL file of a segment to storage"
+	SegmentWalFetchShortDescription   = "Fetches a WAL file of a segment from storage"
+	ContentIDFlag                     = "content-id"
+	ClusterBackupFlag                 = "cluster-backup"
+)
+
+var (
+	segmentBackupPushCmd = &cobra.Command{
+		Use:   "segment-backup-push db_directory",
+		Short: SegmentBackupPushShortDescription,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			internal.AssertCrypterConfigured(internal.BackupContentType)
+			uploader, err := internal.ConfigureWalUploader()
+			tracelog.ErrorLogger.FatalOnError(err)
+			greenplum.HandleSegmentBackupPush(uploader, args[0], segmentContentID, clusterBackup)
+		},
+	}
+
+	segmentWalPushCmd = &cobra.Command{
+		Use:   "segment-wal-push wal_filepath",
+		Short: SegmentWalPushShortDescription,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			internal.AssertCrypterConfigured(internal.LogContentType)
+			uploader, err := internal.ConfigureWalUploader()
+			tracelog.ErrorLogger.FatalOnError(err)
+			uploader.UploadingFolder = greenplum.GetSegmentFolder(uploader.UploadingFolder, segmentContentID)
+			uploader.ArchiveStatusManager = internal.NewNopASM()
+			internal.HandleWALPush(uploader, args[0])
+		},
+	}
+
+	segmentWalFetchCmd = &cobra.Command{
+		Use:   "segment-wal-fetch wal_name destination_filename",
+		Short: SegmentWalFetchShortDescription,
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			folder, err := internal.ConfigureFolder()
+			tracelog.ErrorLogger.FatalOnError(err)
+			internal.HandleWALFetch(greenplum.GetSegmentFolder(folder, segmentContentID), args[0], args[1], true)
+		},
+	}
+
+	segmentContentID int
+	clusterBackup    string
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{segmentBackupPushCmd, segmentWalPushCmd, segmentWalFetchCmd} {
+		Cmd.AddCommand(cmd)
+		cmd.Flags().IntVar(&segmentContentID, ContentIDFlag, 0, "Content id of the segment, -1 for the coordinator")
+		_ = cmd.MarkFlagRequired(ContentIDFlag)
+	}
+	segmentBackupPushCmd.Flags().StringVar(&clusterBackup, ClusterBackupFlag, "",
+		"Name of the cluster backup this segment backup belongs to")
+}
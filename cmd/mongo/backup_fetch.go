@@ -6,6 +6,7 @@ import (
 	"syscall"
 
 	"github.com/wal-g/wal-g/internal/databases/mongo"
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
 
 	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/utility"
@@ -14,7 +15,18 @@ import (
 	"github.com/wal-g/tracelog"
 )
 
-const BackupFetchShortDescription = "Fetches desired backup from storage"
+const (
+	BackupFetchShortDescription  = "Fetches desired backup from storage"
+	IncludeNamespacesFlag        = "include-namespaces"
+	IncludeNamespacesDescription = "Restore only given databases or <database>.<collection> namespaces"
+	ExcludeNamespacesFlag        = "exclude-namespaces"
+	ExcludeNamespacesDescription = "Do not restore given databases or <database>.<collection> namespaces"
+)
+
+var (
+	includeNamespaces []string
+	excludeNamespaces []string
+)
 
 // backupFetchCmd represents the streamFetch command
 var backupFetchCmd = &cobra.Command{
@@ -26,17 +38,37 @@ var backupFetchCmd = &cobra.Command{
 		signalHandler := utility.NewSignalHandler(ctx, cancel, []os.Signal{syscall.SIGINT, syscall.SIGTERM})
 		defer func() { _ = signalHandler.Close() }()
 
-		folder, err := internal.ConfigureFolder()
+		downloader, err := archive.NewStorageDownloader(archive.NewDefaultStorageSettings())
 		tracelog.ErrorLogger.FatalOnError(err)
+		chain, err := mongo.BackupChain(downloader, args[0])
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		// physical backup files are extracted to dbPath of stopped mongod
+		if chain[0].IsPhysical() {
+			if len(includeNamespaces) > 0 || len(excludeNamespaces) > 0 {
+				tracelog.ErrorLogger.Fatalf("Namespaces can not be filtered on restore of physical backup '%s'", args[0])
+			}
+			dbPath, err := internal.GetRequiredSetting(internal.MongoDBPathSetting)
+			tracelog.ErrorLogger.FatalOnError(err)
+			err = mongo.HandlePhysicalBackupFetch(downloader, chain, dbPath)
+			tracelog.ErrorLogger.FatalOnError(err)
+			return
+		}
 
 		restoreCmd, err := internal.GetCommandSettingContext(ctx, internal.NameStreamRestoreCmd)
 		tracelog.ErrorLogger.FatalOnError(err)
 		restoreCmd.Stderr = os.Stderr
-
-		mongo.HandleBackupFetch(ctx, folder, args[0], restoreCmd)
+		filterArgs, err := mongo.NamespaceFilterArgs(includeNamespaces, excludeNamespaces)
+		tracelog.ErrorLogger.FatalOnError(err)
+		err = mongo.SetNamespaceFilterEnv(restoreCmd, filterArgs)
+		tracelog.ErrorLogger.FatalOnError(err)
+		err = mongo.HandleBackupFetch(ctx, downloader, args[0], restoreCmd, backupFetchOptions()...)
+		tracelog.ErrorLogger.FatalOnError(err)
 	},
 }
 
 func init() {
 	Cmd.AddCommand(backupFetchCmd)
+	backupFetchCmd.Flags().StringSliceVar(&includeNamespaces, IncludeNamespacesFlag, nil, IncludeNamespacesDescription)
+	backupFetchCmd.Flags().StringSliceVar(&excludeNamespaces, ExcludeNamespacesFlag, nil, ExcludeNamespacesDescription)
 }
@@ -12,7 +12,10 @@ import (
 
 const BackupListShortDescription = "Prints available backups"
 
-var verbose bool
+var (
+	verbose bool
+	detail  bool
+)
 
 // backupListCmd represents the backupList command
 var backupListCmd = &cobra.Command{
@@ -23,7 +26,7 @@ var backupListCmd = &cobra.Command{
 		downloader, err := archive.NewStorageDownloader(archive.NewDefaultStorageSettings())
 		tracelog.ErrorLogger.FatalOnError(err)
 		listing := archive.NewDefaultTabbedBackupListing()
-		err = mongo.HandleBackupsList(downloader, listing, os.Stdout, verbose)
+		err = mongo.HandleBackupsList(downloader, listing, os.Stdout, verbose, detail)
 		tracelog.ErrorLogger.FatalOnError(err)
 	},
 }
@@ -31,4 +34,6 @@ var backupListCmd = &cobra.Command{
 func init() {
 	Cmd.AddCommand(backupListCmd)
 	backupListCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Verbose mode")
+	backupListCmd.PersistentFlags().BoolVar(&detail, "detail", false,
+		"Show backup sizes, mongod version, replica set name and oplog coverage since backup")
 }
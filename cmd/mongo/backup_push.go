@@ -3,6 +3,7 @@ package mongo
 import (
 	"context"
 	"os"
+	"os/exec"
 	"syscall"
 
 	"github.com/wal-g/wal-g/internal"
@@ -12,10 +13,26 @@ import (
 	"github.com/wal-g/wal-g/utility"
 
 	"github.com/spf13/cobra"
+	"github.com/wal-g/storages/storage"
 	"github.com/wal-g/tracelog"
 )
 
-const BackupPushShortDescription = "Pushes backup to storage"
+const (
+	BackupPushShortDescription = "Pushes backup to storage"
+	DeltaFlag                  = "delta"
+	DeltaFlagDescription       = "Copy only database files changed since the latest physical backup"
+	DiscardFlag                = "discard"
+	DiscardFlagDescription     = "Compress and encrypt backup stream, but discard it instead of uploading (for benchmarking)"
+	PhysicalFlag               = "physical"
+	PhysicalFlagDescription    = "Copy database files of the node instead of running backup command"
+	MongoDBBackupHostEnv       = "MONGODB_BACKUP_HOST"
+)
+
+var (
+	deltaBackup    bool
+	discardBackup  bool
+	physicalBackup bool
+)
 
 // backupPushCmd represents the backupPush command
 var backupPushCmd = &cobra.Command{
@@ -23,6 +40,7 @@ var backupPushCmd = &cobra.Command{
 	Short: BackupPushShortDescription,
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
+		internal.AssertCrypterConfigured(internal.BackupContentType)
 		ctx, cancel := context.WithCancel(context.Background())
 		signalHandler := utility.NewSignalHandler(ctx, cancel, []os.Signal{syscall.SIGINT, syscall.SIGTERM})
 		defer func() { _ = signalHandler.Close() }()
@@ -31,23 +49,65 @@ var backupPushCmd = &cobra.Command{
 		tracelog.ErrorLogger.FatalOnError(err)
 
 		// set up mongodb client and oplog fetcher
-		mongoClient, err := client.NewMongoClient(ctx, mongodbUrl)
+		mongoClient, err := client.NewMongoClient(ctx, mongodbUrl, mongoClientOptions()...)
 		tracelog.ErrorLogger.FatalOnError(err)
 		metaProvider := archive.NewBackupMetaMongoProvider(ctx, mongoClient)
 
 		uploader, err := internal.ConfigureUploader()
 		tracelog.ErrorLogger.FatalOnError(err)
 		uploader.UploadingFolder = uploader.UploadingFolder.GetSubFolder(utility.BaseBackupPath)
+		var backupUploader archive.Uploader = archive.NewStorageUploader(uploader)
+		if discardBackup {
+			backupUploader = archive.NewDiscardUploader(uploader.Compressor, nil)
+		} else {
+			backupUploader = withUploadMirrors(backupUploader, func(folder storage.Folder) archive.Uploader {
+				mirrorProvider := internal.NewUploader(uploader.Compressor, folder.GetSubFolder(utility.BaseBackupPath))
+				return archive.NewStorageUploader(mirrorProvider)
+			})
+		}
+
+		if deltaBackup {
+			downloader, err := archive.NewStorageDownloader(archive.NewDefaultStorageSettings())
+			tracelog.ErrorLogger.FatalOnError(err)
+			dbPath, _ := internal.GetSetting(internal.MongoDBPathSetting)
+			err = mongo.HandleDeltaBackupPush(ctx, downloader, backupUploader, metaProvider, mongoClient, dbPath)
+			tracelog.ErrorLogger.FatalfOnError("Delta backup creation failed: %v", err)
+			return
+		}
+
+		if physicalBackup {
+			dbPath, _ := internal.GetSetting(internal.MongoDBPathSetting)
+			err = mongo.HandlePhysicalBackupPush(ctx, backupUploader, metaProvider, mongoClient, dbPath)
+			tracelog.ErrorLogger.FatalfOnError("Physical backup creation failed: %v", err)
+			return
+		}
+
+		if !mongoClient.ReadsFromPrimary() {
+			// backup tool should dump data from the member selected by read preference
+			err = mongo.HandleMemberBackupPush(ctx, backupUploader, metaProvider, mongoClient, func(host string) (*exec.Cmd, error) {
+				backupCmd, err := internal.GetCommandSettingContext(ctx, internal.NameStreamCreateCmd)
+				if err != nil {
+					return nil, err
+				}
+				backupCmd.Stderr = os.Stderr
+				backupCmd.Env = append(os.Environ(), MongoDBBackupHostEnv+"="+host)
+				return backupCmd, nil
+			})
+			tracelog.ErrorLogger.FatalfOnError("Backup creation failed: %v", err)
+			return
+		}
 
 		backupCmd, err := internal.GetCommandSettingContext(ctx, internal.NameStreamCreateCmd)
 		tracelog.ErrorLogger.FatalOnError(err)
 		backupCmd.Stderr = os.Stderr
 
-		err = mongo.HandleBackupPush(&archive.StorageUploader{UploaderProvider: uploader}, metaProvider, backupCmd)
+		err = mongo.HandleBackupPush(backupUploader, metaProvider, backupCmd)
 		tracelog.ErrorLogger.FatalfOnError("Backup creation failed: %v", err)
 	},
 	PreRun: func(cmd *cobra.Command, args []string) {
-		internal.RequiredSettings[internal.NameStreamCreateCmd] = true
+		if !deltaBackup && !physicalBackup {
+			internal.RequiredSettings[internal.NameStreamCreateCmd] = true
+		}
 		err := internal.AssertRequiredSettingsSet()
 		tracelog.ErrorLogger.FatalOnError(err)
 	},
@@ -55,4 +115,7 @@ var backupPushCmd = &cobra.Command{
 
 func init() {
 	Cmd.AddCommand(backupPushCmd)
+	backupPushCmd.Flags().BoolVar(&deltaBackup, DeltaFlag, false, DeltaFlagDescription)
+	backupPushCmd.Flags().BoolVar(&discardBackup, DiscardFlag, false, DiscardFlagDescription)
+	backupPushCmd.Flags().BoolVar(&physicalBackup, PhysicalFlag, false, PhysicalFlagDescription)
 }
@@ -1,6 +1,7 @@
 package mongo
 
 import (
+	"os"
 	"time"
 
 	"github.com/wal-g/wal-g/internal"
@@ -12,16 +13,20 @@ import (
 )
 
 const (
-	RetainAfterFlag = "retain-after"
-	RetainCountFlag = "retain-count"
-	PurgeOplogFlag  = "purge-oplog"
+	RetainAfterFlag     = "retain-after"
+	RetainCountFlag     = "retain-count"
+	PurgeOplogFlag      = "purge-oplog"
+	RetainWithOplogFlag = "retain-with-oplog"
+	PurgePlanJSONFlag   = "json"
 )
 
 var (
-	confirmed   bool
-	purgeOplog  bool
-	retainAfter string
-	retainCount uint
+	confirmed       bool
+	purgeOplog      bool
+	retainWithOplog bool
+	purgePlanJSON   bool
+	retainAfter     string
+	retainCount     uint
 )
 
 // deleteCmd represents the delete command
@@ -32,7 +37,11 @@ var deleteCmd = &cobra.Command{
 }
 
 func runPurge(cmd *cobra.Command, args []string) {
-	opts := []mongo.PurgeOption{mongo.PurgeDryRun(!confirmed), mongo.PurgeOplog(purgeOplog)}
+	opts := []mongo.PurgeOption{mongo.PurgeDryRun(!confirmed), mongo.PurgeOplog(purgeOplog),
+		mongo.PurgeRetainWithOplog(retainWithOplog)}
+	if purgePlanJSON {
+		opts = append(opts, mongo.PurgePlanOutput(os.Stdout))
+	}
 	if cmd.Flags().Changed(RetainAfterFlag) {
 		retainAfterTime, err := time.Parse(time.RFC3339, retainAfter)
 		tracelog.ErrorLogger.FatalfOnError("Can not parse retain time: %v", err)
@@ -63,6 +72,10 @@ func init() { // TODO: validate-fix
 	Cmd.AddCommand(deleteCmd)
 	deleteCmd.Flags().BoolVar(&confirmed, internal.ConfirmFlag, false, "Confirms backup deletion")
 	deleteCmd.Flags().BoolVar(&purgeOplog, PurgeOplogFlag, false, "Purge oplog archives")
+	deleteCmd.Flags().BoolVar(&retainWithOplog, RetainWithOplogFlag, false,
+		"Purge oplog archives, but keep ones needed for point-in-time recovery from retained backups")
+	deleteCmd.Flags().BoolVar(&purgePlanJSON, PurgePlanJSONFlag, false,
+		"Print JSON list of backup files and oplog archives to delete with reasons")
 	deleteCmd.Flags().StringVar(&retainAfter, RetainAfterFlag, "", "Keep backups newer")
 	deleteCmd.Flags().UintVar(&retainCount, RetainCountFlag, 0, "Keep minimum count")
 }
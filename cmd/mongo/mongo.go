@@ -6,7 +6,12 @@ import (
 	"strings"
 
 	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/mongo"
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+	"github.com/wal-g/wal-g/internal/databases/mongo/client"
+
 	"github.com/spf13/cobra"
+	"github.com/wal-g/storages/storage"
 	"github.com/wal-g/tracelog"
 )
 
@@ -29,6 +34,36 @@ var Cmd = &cobra.Command{
 	},
 }
 
+// mongoClientOptions builds mongodb client options from read preference settings
+func mongoClientOptions() []client.MongoClientOption {
+	mode, _ := internal.GetSetting(internal.MongoDBReadPreference)
+	tags, _ := internal.GetSetting(internal.MongoDBReadPreferenceTags)
+	readPref, err := client.ParseReadPreference(mode, tags)
+	tracelog.ErrorLogger.FatalfOnError("Invalid read preference: %v", err)
+	return []client.MongoClientOption{client.ReadFrom(readPref)}
+}
+
+// withUploadMirrors wraps uploader to upload copies to mirror storages if they are configured
+func withUploadMirrors(primary archive.Uploader, newMirror func(folder storage.Folder) archive.Uploader) archive.Uploader {
+	folders, err := internal.ConfigureUploadMirrorFolders()
+	tracelog.ErrorLogger.FatalOnError(err)
+	if len(folders) == 0 {
+		return primary
+	}
+	mirrors := make([]archive.UploadDestination, 0, len(folders))
+	for name, folder := range folders {
+		mirrors = append(mirrors, archive.UploadDestination{Name: name, Uploader: newMirror(folder)})
+	}
+	return archive.NewMultiUploader(archive.UploadDestination{Name: "primary", Uploader: primary}, mirrors...)
+}
+
+// backupFetchOptions builds options of passing backup stream to restore command from settings
+func backupFetchOptions() []mongo.BackupFetchOption {
+	rateLimit, err := internal.GetMongoDBRestoreRateLimit()
+	tracelog.ErrorLogger.FatalOnError(err)
+	return []mongo.BackupFetchOption{mongo.RestoreRateLimit(rateLimit)}
+}
+
 func Execute() {
 	if err := Cmd.Execute(); err != nil {
 		fmt.Println(err)
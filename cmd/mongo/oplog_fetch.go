@@ -46,7 +46,7 @@ var oplogFetchCmd = &cobra.Command{
 		tracelog.ErrorLogger.FatalOnError(err)
 
 		// discover archive sequence to replay
-		archives, err := downloader.ListOplogArchives()
+		archives, err := downloader.ListOplogArchivesBetween(since, until)
 		tracelog.ErrorLogger.FatalOnError(err)
 		path, err := archive.SequenceBetweenTS(archives, since, until)
 		tracelog.ErrorLogger.FatalOnError(err)
@@ -17,6 +17,7 @@ import (
 	"github.com/wal-g/wal-g/utility"
 
 	"github.com/spf13/cobra"
+	"github.com/wal-g/storages/storage"
 	"github.com/wal-g/tracelog"
 )
 
@@ -26,6 +27,7 @@ var oplogPushCmd = &cobra.Command{
 	Short: "Fetches oplog from mongodb and uploads to storage",
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
+		internal.AssertCrypterConfigured(internal.LogContentType)
 		ctx, cancel := context.WithCancel(context.Background())
 		signalHandler := utility.NewSignalHandler(ctx, cancel, []os.Signal{syscall.SIGINT, syscall.SIGTERM})
 		defer func() { _ = signalHandler.Close() }()
@@ -35,6 +37,12 @@ var oplogPushCmd = &cobra.Command{
 		tracelog.ErrorLogger.FatalOnError(err)
 		archiveTimeout, err := internal.GetOplogArchiveTimeout()
 		tracelog.ErrorLogger.FatalOnError(err)
+		archiveCompressedSize, err := internal.GetOplogArchiveCompressedSize()
+		tracelog.ErrorLogger.FatalOnError(err)
+		batchSize, err := internal.GetOplogBatchSize()
+		tracelog.ErrorLogger.FatalOnError(err)
+		batchTimeout, err := internal.GetOplogBatchTimeout()
+		tracelog.ErrorLogger.FatalOnError(err)
 
 		mongodbUrl, err := internal.GetRequiredSetting(internal.MongoDBUriSetting)
 		tracelog.ErrorLogger.FatalOnError(err)
@@ -43,24 +51,32 @@ var oplogPushCmd = &cobra.Command{
 		uplProvider, err := internal.ConfigureUploader()
 		tracelog.ErrorLogger.FatalOnError(err)
 		uplProvider.UploadingFolder = uplProvider.UploadingFolder.GetSubFolder(models.OplogArchBasePath)
-		uploader := archive.NewStorageUploader(uplProvider)
+		uploader := withUploadMirrors(
+			archive.NewStorageUploader(uplProvider, archive.BatchOplogArchives(batchSize, batchTimeout),
+				archive.MaintainOplogIndex(uplProvider.UploadingFolder)),
+			func(folder storage.Folder) archive.Uploader {
+				mirrorProvider := internal.NewUploader(uplProvider.Compressor, folder.GetSubFolder(models.OplogArchBasePath))
+				return archive.NewStorageUploader(mirrorProvider, archive.BatchOplogArchives(batchSize, batchTimeout),
+					archive.MaintainOplogIndex(mirrorProvider.UploadingFolder))
+			})
 
 		// set up mongodb client and oplog fetcher
-		mongoClient, err := client.NewMongoClient(ctx, mongodbUrl)
+		mongoClient, err := client.NewMongoClient(ctx, mongodbUrl, mongoClientOptions()...)
 		tracelog.ErrorLogger.FatalOnError(err)
-		err = mongoClient.EnsureIsMaster(ctx)
+		lwUpdate, err := internal.GetLastWriteUpdateInterval()
 		tracelog.ErrorLogger.FatalOnError(err)
+		if mongoClient.ReadsFromPrimary() {
+			tracelog.InfoLogger.Println("Waiting for the node to become a primary")
+			err = mongo.WaitForPrimary(ctx, mongoClient, lwUpdate)
+			tracelog.ErrorLogger.FatalOnError(err)
+		}
 
 		// Lookup for last timestamp archived to storage (set up storage downloader client)
 		downloader, err := archive.NewStorageDownloader(archive.NewDefaultStorageSettings())
 		tracelog.ErrorLogger.FatalOnError(err)
 		since, err := discovery.ResolveStartingTS(ctx, downloader, mongoClient)
-		tracelog.InfoLogger.Printf("Archiving storage last known timestamp is %s", since)
-
-		// fetch cursor started from since TS or from newest TS (if since is not exists)
-		oplogCursor, since, err := discovery.BuildCursorFromTS(ctx, since, uploader, mongoClient)
 		tracelog.ErrorLogger.FatalOnError(err)
-		tracelog.InfoLogger.Printf("Archiving is starting from timestamp %s", since)
+		tracelog.InfoLogger.Printf("Archiving storage last known timestamp is %s", since)
 
 		/* File buffer is useful for debugging:
 		fileBatchBuffer, err := stages.NewFileBuffer("/run/wal-g-oplog-push")
@@ -70,23 +86,56 @@ var oplogPushCmd = &cobra.Command{
 
 		memoryBatchBuffer := stages.NewMemoryBuffer()
 		defer tracelog.ErrorLogger.FatalOnError(memoryBatchBuffer.Close())
-		// set up storage archiver
-		uploadStatsUpdater := HandleOplogPushStatistics(ctx, since, mongoClient)
-		oplogApplier := stages.NewStorageApplier(uploader, memoryBatchBuffer, archiveAfterSize, archiveTimeout, uploadStatsUpdater)
-
-		lwUpdate, err := internal.GetLastWriteUpdateInterval()
-		tracelog.ErrorLogger.FatalOnError(err)
-
-		oplogFetcher := stages.NewCursorMajFetcher(mongoClient, oplogCursor, lwUpdate)
-
-		// run working cycle
-		err = mongo.HandleOplogPush(ctx, oplogFetcher, oplogApplier)
-		tracelog.ErrorLogger.FatalOnError(err)
+		uploadStatsUpdater := HandleOplogPushStatistics(ctx, since, mongoClient, uploader)
+		var applierOpts []stages.StorageApplierOption
+		if archiveCompressedSize > 0 {
+			applierOpts = append(applierOpts, stages.ArchiveAfterCompressedSize(archiveCompressedSize, uplProvider.Compression()))
+		}
+
+		var fetcherOpts []stages.CursorMajFetcherOption
+		if !mongoClient.ReadsFromPrimary() {
+			fetcherOpts = append(fetcherOpts, stages.ReadFromSecondary())
+		} else {
+			fetcherOpts = append(fetcherOpts, stages.StopOnStepdown())
+		}
+
+		for {
+			// fetch cursor started from since TS or from newest TS (if since is not exists)
+			var oplogCursor client.OplogCursor
+			oplogCursor, since, err = discovery.BuildCursorFromTS(ctx, since, uploader, mongoClient)
+			tracelog.ErrorLogger.FatalOnError(err)
+			tracelog.InfoLogger.Printf("Archiving is starting from timestamp %s", since)
+
+			// set up storage archiver
+			oplogApplier := stages.NewStorageApplier(uploader, memoryBatchBuffer, archiveAfterSize, archiveTimeout, uploadStatsUpdater, applierOpts...)
+			oplogFetcher := stages.NewCursorMajFetcher(mongoClient, oplogCursor, lwUpdate, fetcherOpts...)
+
+			// run working cycle
+			err = mongo.HandleOplogPush(ctx, oplogFetcher, oplogApplier)
+			// archives accumulated in batch container are uploaded on stop, stepdown or failure
+			flushErr := archive.FlushUploader(uploader)
+			tracelog.ErrorLogger.FatalOnError(err)
+			tracelog.ErrorLogger.FatalfOnError("Can not upload batch container: %v", flushErr)
+			if !oplogFetcher.SteppedDown() {
+				return
+			}
+
+			// records fetched before stepdown are archived, another node may continue archiving meanwhile
+			_ = oplogCursor.Close(ctx)
+			tracelog.InfoLogger.Println("Archiving is paused until the node becomes a primary again")
+			if err := mongo.WaitForPrimary(ctx, mongoClient, lwUpdate); err != nil {
+				return // interrupted
+			}
+			since, err = discovery.ResolveStartingTS(ctx, downloader, mongoClient)
+			tracelog.ErrorLogger.FatalOnError(err)
+			tracelog.InfoLogger.Printf("Archiving is resumed, storage last known timestamp is %s", since)
+		}
 	},
 }
 
 // HandleOplogPushStatistics starts statistics updates and exposes if configured
-func HandleOplogPushStatistics(ctx context.Context, sinceTS models.Timestamp, mongoClient client.MongoDriver) stats.OplogUploadStatsUpdater {
+func HandleOplogPushStatistics(ctx context.Context, sinceTS models.Timestamp, mongoClient client.MongoDriver,
+	uploader archive.Uploader) stats.OplogUploadStatsUpdater {
 	oplogPushStatsEnabled, err := internal.GetBoolSetting(internal.OplogPushStatsEnabled, false)
 	tracelog.ErrorLogger.FatalOnError(err)
 	if !oplogPushStatsEnabled {
@@ -97,6 +146,9 @@ func HandleOplogPushStatistics(ctx context.Context, sinceTS models.Timestamp, mo
 	tracelog.ErrorLogger.FatalOnError(err)
 
 	var opts []stats.OplogPushStatsOption
+	if mirrors, ok := uploader.(stats.MirrorFailuresReporter); ok {
+		opts = append(opts, stats.EnableMirrorFailuresReport(mirrors))
+	}
 
 	statsLogInterval, err := internal.GetDurationSetting(internal.OplogPushStatsLoggingInterval)
 	tracelog.ErrorLogger.FatalOnError(err)
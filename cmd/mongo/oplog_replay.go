@@ -18,6 +18,21 @@ import (
 	"github.com/wal-g/wal-g/internal/databases/mongo/oplog"
 )
 
+const (
+	IncludeNsFlag             = "include-ns"
+	IncludeNsDescription      = "Apply only ops of given databases or <database>.<collection> namespaces"
+	ExcludeNsFlag             = "exclude-ns"
+	ExcludeNsDescription      = "Do not apply ops of given databases or <database>.<collection> namespaces"
+	CheckpointFileFlag        = "checkpoint-file"
+	CheckpointFileDescription = "File to save timestamp of the last applied op, replay restarted with the same file skips applied ops"
+)
+
+var (
+	includeNs      []string
+	excludeNs      []string
+	checkpointFile string
+)
+
 // oplogReplayCmd represents oplog replay procedure
 var oplogReplayCmd = &cobra.Command{
 	Use:   "oplog-replay <since ts.inc> <until ts.inc>",
@@ -29,6 +44,8 @@ var oplogReplayCmd = &cobra.Command{
 		defer func() { _ = signalHandler.Close() }()
 
 		// resolve archiving settings
+		prefetch, err := internal.GetOplogReplayPrefetch()
+		tracelog.ErrorLogger.FatalOnError(err)
 		since, err := models.TimestampFromStr(args[0])
 		tracelog.ErrorLogger.FatalOnError(err)
 		until, err := models.TimestampFromStr(args[1])
@@ -42,7 +59,22 @@ var oplogReplayCmd = &cobra.Command{
 		tracelog.ErrorLogger.FatalOnError(err)
 		err = mongoClient.EnsureIsMaster(ctx)
 		tracelog.ErrorLogger.FatalOnError(err)
-		dbApplier := oplog.NewDBApplier(mongoClient, false)
+		var applierOpts []oplog.DBApplierOption
+		if len(includeNs) > 0 || len(excludeNs) > 0 {
+			nsFilter, err := oplog.NewNamespaceFilter(includeNs, excludeNs)
+			tracelog.ErrorLogger.FatalOnError(err)
+			applierOpts = append(applierOpts, oplog.WithNamespaceFilter(nsFilter))
+		}
+		if checkpointFile != "" {
+			checkpoint := oplog.NewFileCheckpointStore(checkpointFile)
+			appliedTS, exists, err := checkpoint.Load()
+			tracelog.ErrorLogger.FatalOnError(err)
+			if exists {
+				tracelog.InfoLogger.Printf("Ops up to %v are already applied, they are skipped", appliedTS)
+			}
+			applierOpts = append(applierOpts, oplog.WithCheckpoint(checkpoint, appliedTS))
+		}
+		dbApplier := oplog.NewDBApplier(mongoClient, false, applierOpts...)
 		oplogApplier := stages.NewGenericApplier(dbApplier)
 
 		// set up storage downloader client
@@ -50,13 +82,13 @@ var oplogReplayCmd = &cobra.Command{
 		tracelog.ErrorLogger.FatalOnError(err)
 
 		// discover archive sequence to replay
-		archives, err := downloader.ListOplogArchives()
+		archives, err := downloader.ListOplogArchivesBetween(since, until)
 		tracelog.ErrorLogger.FatalOnError(err)
 		path, err := archive.SequenceBetweenTS(archives, since, until)
 		tracelog.ErrorLogger.FatalOnError(err)
 
 		// setup storage fetcher
-		oplogFetcher := stages.NewStorageFetcher(downloader, path)
+		oplogFetcher := stages.NewStorageFetcher(downloader, path, stages.PrefetchArchives(prefetch))
 
 		// run worker cycle
 		err = mongo.HandleOplogReplay(ctx, since, until, oplogFetcher, oplogApplier)
@@ -65,5 +97,8 @@ var oplogReplayCmd = &cobra.Command{
 }
 
 func init() {
+	oplogReplayCmd.Flags().StringSliceVar(&includeNs, IncludeNsFlag, nil, IncludeNsDescription)
+	oplogReplayCmd.Flags().StringSliceVar(&excludeNs, ExcludeNsFlag, nil, ExcludeNsDescription)
+	oplogReplayCmd.Flags().StringVar(&checkpointFile, CheckpointFileFlag, "", CheckpointFileDescription)
 	Cmd.AddCommand(oplogReplayCmd)
 }
@@ -0,0 +1,30 @@
+package mongo
+
+import (
+	"os"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo"
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+)
+
+const OplogReportShortDescription = "Prints gaps of archived oplog"
+
+// oplogReportCmd represents oplog gaps report
+var oplogReportCmd = &cobra.Command{
+	Use:   "oplog-report",
+	Short: OplogReportShortDescription,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		downloader, err := archive.NewStorageDownloader(archive.NewDefaultStorageSettings())
+		tracelog.ErrorLogger.FatalOnError(err)
+		err = mongo.HandleOplogReport(downloader, os.Stdout)
+		tracelog.ErrorLogger.FatalOnError(err)
+	},
+}
+
+func init() {
+	Cmd.AddCommand(oplogReportCmd)
+}
@@ -0,0 +1,77 @@
+package mongo
+
+import (
+	"context"
+	"os"
+	"syscall"
+
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/mongo"
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+	"github.com/wal-g/wal-g/internal/databases/mongo/client"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+	"github.com/wal-g/wal-g/internal/databases/mongo/oplog"
+	"github.com/wal-g/wal-g/internal/databases/mongo/stages"
+	"github.com/wal-g/wal-g/utility"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+)
+
+const TargetTSFlag = "target-ts"
+
+var targetTS string
+
+// pitrRestoreCmd represents point-in-time restore procedure
+var pitrRestoreCmd = &cobra.Command{
+	Use:   "pitr-restore --target-ts <ts.inc>",
+	Short: "Restores the latest backup before target timestamp and replays oplog archives up to it",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		signalHandler := utility.NewSignalHandler(ctx, cancel, []os.Signal{syscall.SIGINT, syscall.SIGTERM})
+		defer func() { _ = signalHandler.Close() }()
+
+		target, err := models.TimestampFromStr(targetTS)
+		tracelog.ErrorLogger.FatalOnError(err)
+		prefetch, err := internal.GetOplogReplayPrefetch()
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		mongodbUrl, err := internal.GetRequiredSetting(internal.MongoDBUriSetting)
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		restoreCmd, err := internal.GetCommandSettingContext(ctx, internal.NameStreamRestoreCmd)
+		tracelog.ErrorLogger.FatalOnError(err)
+		restoreCmd.Stderr = os.Stderr
+
+		// set up storage downloader client
+		downloader, err := archive.NewStorageDownloader(archive.NewDefaultStorageSettings())
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		// set up mongodb client and oplog applier
+		mongoClient, err := client.NewMongoClient(ctx, mongodbUrl)
+		tracelog.ErrorLogger.FatalOnError(err)
+		err = mongoClient.EnsureIsMaster(ctx)
+		tracelog.ErrorLogger.FatalOnError(err)
+		dbApplier := oplog.NewDBApplier(mongoClient, false)
+		oplogApplier := stages.NewGenericApplier(dbApplier)
+
+		fetchBackup := func(backupName string) error {
+			return mongo.HandleLogicalBackupFetch(ctx, downloader, backupName, restoreCmd, backupFetchOptions()...)
+		}
+
+		err = mongo.HandlePITRRestore(ctx, target, downloader, fetchBackup, oplogApplier, stages.PrefetchArchives(prefetch))
+		tracelog.ErrorLogger.FatalOnError(err)
+	},
+	PreRun: func(cmd *cobra.Command, args []string) {
+		internal.RequiredSettings[internal.NameStreamRestoreCmd] = true
+		err := internal.AssertRequiredSettingsSet()
+		tracelog.ErrorLogger.FatalOnError(err)
+	},
+}
+
+func init() {
+	Cmd.AddCommand(pitrRestoreCmd)
+	pitrRestoreCmd.Flags().StringVar(&targetTS, TargetTSFlag, "", "Timestamp to restore to, in <ts.inc> format")
+	pitrRestoreCmd.MarkFlagRequired(TargetTSFlag)
+}
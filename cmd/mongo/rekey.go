@@ -0,0 +1,67 @@
+package mongo
+
+import (
+	"github.com/wal-g/wal-g/internal"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+)
+
+const (
+	RekeyShortDescription = "Rewraps data keys of envelope encrypted backups and oplog archives with the current master key"
+	OldCryptoConfigFlag   = "old-crypto-config"
+	PurgeUnusedKeysFlag   = "purge-unused-keys"
+)
+
+var (
+	oldCryptoConfig string
+	purgeUnusedKeys bool
+)
+
+// rekeyCmd represents the rekey command
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: RekeyShortDescription,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		oldMaster := internal.ConfigureCrypterFromConfigFile(oldCryptoConfig)
+		if oldMaster == nil {
+			tracelog.ErrorLogger.Fatalf("Old master key is not configured in '%s'", oldCryptoConfig)
+		}
+
+		contentTypes := []internal.ContentType{internal.BackupContentType, internal.LogContentType}
+		for _, contentType := range contentTypes {
+			newMaster := internal.ConfigureMasterCrypterForContentType(contentType)
+			if newMaster == nil {
+				tracelog.ErrorLogger.Fatalf("Master key for %s objects is not configured", contentType)
+			}
+			keys, err := internal.ConfigureEnvelopeKeyStore(contentType)
+			tracelog.ErrorLogger.FatalOnError(err)
+			err = internal.HandleRekey(contentType, keys, oldMaster, newMaster)
+			tracelog.ErrorLogger.FatalOnError(err)
+		}
+
+		if !purgeUnusedKeys {
+			return
+		}
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+		used, err := internal.CollectUsedKeyIDs(folder)
+		tracelog.ErrorLogger.FatalOnError(err)
+		for _, contentType := range contentTypes {
+			keys, err := internal.ConfigureEnvelopeKeyStore(contentType)
+			tracelog.ErrorLogger.FatalOnError(err)
+			err = internal.HandlePurgeKeys(contentType, keys, used)
+			tracelog.ErrorLogger.FatalOnError(err)
+		}
+	},
+}
+
+func init() {
+	Cmd.AddCommand(rekeyCmd)
+	rekeyCmd.Flags().StringVar(&oldCryptoConfig, OldCryptoConfigFlag, "",
+		"Config file with crypto settings of the old master key")
+	rekeyCmd.Flags().BoolVar(&purgeUnusedKeys, PurgeUnusedKeysFlag, false,
+		"Delete data keys which are not used by any object in the storage")
+	rekeyCmd.MarkFlagRequired(OldCryptoConfigFlag)
+}
@@ -0,0 +1,86 @@
+package mongo
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/mongo"
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+	"github.com/wal-g/wal-g/internal/databases/mongo/client"
+	"github.com/wal-g/wal-g/internal/databases/mongo/oplog"
+	"github.com/wal-g/wal-g/internal/databases/mongo/stages"
+	"github.com/wal-g/wal-g/utility"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+)
+
+const (
+	SeedHostFlag      = "host"
+	SeedDelayFlag     = "delay"
+	SeedOplogSizeFlag = "oplog-size"
+)
+
+var (
+	seedHost      string
+	seedDelay     time.Duration
+	seedOplogSize int64
+)
+
+// seedReplicaCmd represents seeding of a delayed replica set member from backups
+var seedReplicaCmd = &cobra.Command{
+	Use:   "seed-replica --host <host:port> --delay <duration>",
+	Short: "Restores standalone node delayed from the newest archived oplog to be added as a delayed member",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		signalHandler := utility.NewSignalHandler(ctx, cancel, []os.Signal{syscall.SIGINT, syscall.SIGTERM})
+		defer func() { _ = signalHandler.Close() }()
+
+		prefetch, err := internal.GetOplogReplayPrefetch()
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		mongodbUrl, err := internal.GetRequiredSetting(internal.MongoDBUriSetting)
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		restoreCmd, err := internal.GetCommandSettingContext(ctx, internal.NameStreamRestoreCmd)
+		tracelog.ErrorLogger.FatalOnError(err)
+		restoreCmd.Stderr = os.Stderr
+
+		// set up storage downloader client
+		downloader, err := archive.NewStorageDownloader(archive.NewDefaultStorageSettings())
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		// set up mongodb client of the standalone node and oplog applier
+		mongoClient, err := client.NewMongoClient(ctx, mongodbUrl)
+		tracelog.ErrorLogger.FatalOnError(err)
+		err = mongoClient.EnsureIsMaster(ctx)
+		tracelog.ErrorLogger.FatalOnError(err)
+		dbApplier := oplog.NewDBApplier(mongoClient, false)
+
+		fetchBackup := func(backupName string) error {
+			return mongo.HandleLogicalBackupFetch(ctx, downloader, backupName, restoreCmd, backupFetchOptions()...)
+		}
+
+		settings := mongo.SeedReplicaSettings{Host: seedHost, Delay: seedDelay, OplogSize: seedOplogSize << 20}
+		err = mongo.HandleSeedReplica(ctx, downloader, mongoClient, dbApplier, fetchBackup, settings, os.Stdout,
+			stages.PrefetchArchives(prefetch))
+		tracelog.ErrorLogger.FatalOnError(err)
+	},
+	PreRun: func(cmd *cobra.Command, args []string) {
+		internal.RequiredSettings[internal.NameStreamRestoreCmd] = true
+		err := internal.AssertRequiredSettingsSet()
+		tracelog.ErrorLogger.FatalOnError(err)
+	},
+}
+
+func init() {
+	Cmd.AddCommand(seedReplicaCmd)
+	seedReplicaCmd.Flags().StringVar(&seedHost, SeedHostFlag, "", "Address of the node in the replica set, <host:port>")
+	seedReplicaCmd.Flags().DurationVar(&seedDelay, SeedDelayFlag, time.Hour, "Delay of the member, e.g. 1h")
+	seedReplicaCmd.Flags().Int64Var(&seedOplogSize, SeedOplogSizeFlag, 1024, "Size of the seeded oplog in megabytes")
+	seedReplicaCmd.MarkFlagRequired(SeedHostFlag)
+}
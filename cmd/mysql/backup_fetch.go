@@ -22,13 +22,18 @@ var backupFetchCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		folder, err := internal.ConfigureFolder()
 		tracelog.ErrorLogger.FatalOnError(err)
-		restoreCmd, err := internal.GetCommandSetting(internal.NameStreamRestoreCmd)
-		tracelog.ErrorLogger.FatalOnError(err)
-		prepareCmd, _ := internal.GetCommandSetting(internal.MysqlBackupPrepareCmd)
-		mysql.HandleBackupFetch(folder, args[0], restoreCmd, prepareCmd)
+		mysql.HandleBackupFetch(folder, args[0], fetchOptions)
 	},
 }
 
+var fetchOptions mysql.BackupFetchOptions
+
 func init() {
 	Cmd.AddCommand(backupFetchCmd)
+	backupFetchCmd.Flags().BoolVar(&fetchOptions.Prepare, "prepare", false,
+		"Prepare fetched backup with xtrabackup, if WALG_MYSQL_BACKUP_PREPARE_COMMAND is not set")
+	backupFetchCmd.Flags().StringSliceVar(&fetchOptions.Schemas, "schema", nil,
+		"Restore only the schema or schema.table, can be repeated")
+	backupFetchCmd.Flags().StringVar(&fetchOptions.ReplicationSQLPath, "replication-sql", "",
+		"Write CHANGE MASTER TO statement to the file, if the backup is made on a replica")
 }
@@ -1,25 +1,50 @@
 package mysql
 
 import (
+	"os"
+
 	"github.com/spf13/cobra"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/mysql"
 )
 
-const backupListShortDescription = "Prints available backups"
+const (
+	backupListShortDescription = "Prints available backups"
+	prettyFlag                 = "pretty"
+	jsonFlag                   = "json"
+	detailFlag                 = "detail"
+)
 
-// backupListCmd represents the backupList command
-var backupListCmd = &cobra.Command{
-	Use:   "backup-list",
-	Short: backupListShortDescription,
-	Args:  cobra.NoArgs,
-	Run: func(cmd *cobra.Command, args []string) {
-		folder, err := internal.ConfigureFolder()
-		tracelog.ErrorLogger.FatalOnError(err)
-		internal.DefaultHandleBackupList(folder)
-	},
-}
+var (
+	// backupListCmd represents the backupList command
+	backupListCmd = &cobra.Command{
+		Use:   "backup-list",
+		Short: backupListShortDescription,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			folder, err := internal.ConfigureFolder()
+			tracelog.ErrorLogger.FatalOnError(err)
+			if detail {
+				err = mysql.HandleDetailedBackupList(folder, os.Stdout, pretty, json)
+				tracelog.ErrorLogger.FatalOnError(err)
+			} else if pretty || json {
+				internal.HandleBackupListWithFlags(folder, pretty, json, false)
+			} else {
+				internal.DefaultHandleBackupList(folder)
+			}
+		},
+	}
+	pretty = false
+	json   = false
+	detail = false
+)
 
 func init() {
 	Cmd.AddCommand(backupListCmd)
+
+	backupListCmd.Flags().BoolVar(&pretty, prettyFlag, false, "Prints more readable output")
+	backupListCmd.Flags().BoolVar(&json, jsonFlag, false, "Prints output in json format")
+	backupListCmd.Flags().BoolVar(&detail, detailFlag, false,
+		"Prints server version, binlog position, GTID executed set, backup tool and compressed size of backups")
 }
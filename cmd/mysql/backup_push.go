@@ -1,33 +1,55 @@
 package mysql
 
 import (
+	"os/exec"
+
 	"github.com/spf13/cobra"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/internal/databases/mysql"
 )
 
-const backupPushShortDescription = "Creates new backup and pushes it to storage"
+const (
+	backupPushShortDescription = "Creates new backup and pushes it to storage"
+	fullBackupFlag             = "full"
+	fullBackupShorthand        = "f"
+)
 
 // backupPushCmd represents the streamPush command
 var backupPushCmd = &cobra.Command{
 	Use:   "backup-push",
 	Short: backupPushShortDescription,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		internal.RequiredSettings[internal.NameStreamCreateCmd] = true
+		if !isCloneBackup() {
+			internal.RequiredSettings[internal.NameStreamCreateCmd] = true
+		}
 		internal.RequiredSettings[internal.MysqlDatasourceNameSetting] = true
 		err := internal.AssertRequiredSettingsSet()
 		tracelog.ErrorLogger.FatalOnError(err)
 	},
 	Run: func(cmd *cobra.Command, args []string) {
+		internal.AssertCrypterConfigured(internal.BackupContentType)
 		uploader, err := internal.ConfigureUploader()
 		tracelog.ErrorLogger.FatalOnError(err)
-		backupCmd, err := internal.GetCommandSetting(internal.NameStreamCreateCmd)
-		tracelog.ErrorLogger.FatalOnError(err)
-		mysql.HandleBackupPush(uploader, backupCmd)
+		var backupCmd *exec.Cmd
+		if !isCloneBackup() {
+			backupCmd, err = internal.GetCommandSetting(internal.NameStreamCreateCmd)
+			tracelog.ErrorLogger.FatalOnError(err)
+		}
+		mysql.HandleBackupPush(uploader, backupCmd, fullBackup)
 	},
 }
 
+var fullBackup = false
+
+// isCloneBackup checks if the backup is made by the CLONE plugin of the server, which needs no backup command
+func isCloneBackup() bool {
+	tool, _ := internal.GetSetting(internal.MysqlBackupToolSetting)
+	return tool == mysql.BackupToolClone
+}
+
 func init() {
 	Cmd.AddCommand(backupPushCmd)
+	backupPushCmd.Flags().BoolVarP(&fullBackup, fullBackupFlag, fullBackupShorthand, false,
+		"Make full backup-push even if WALG_DELTA_MAX_STEPS allows an increment")
 }
@@ -10,10 +10,13 @@ import (
 )
 
 const fetchSinceFlagShortDescr = "backup name starting from which you want to fetch binlogs"
+const fetchSinceTimeFlagShortDescr = "time in RFC3339 starting from which you want to fetch binlogs, instead of the backup"
+const fetchSinceGtidFlagShortDescr = "GTID set or the last GTID after which you want to fetch binlogs, instead of the backup"
 const fetchUntilFlagShortDescr = "time in RFC3339 for PITR"
+const fetchUntilGtidFlagShortDescr = "Full GTID set, e.g. gtid_executed at the point up to which you want to fetch binlogs"
+const fetchDstFlagShortDescr = "directory to save binlogs to, WALG_MYSQL_BINLOG_DST is used by default"
 
-var fetchBackupName string
-var fetchUntilDt string
+var fetchOptionsBinlog mysql.BinlogFetchOptions
 
 // binlogPushCmd represents the cron command
 var binlogFetchCmd = &cobra.Command{
@@ -23,18 +26,23 @@ var binlogFetchCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		folder, err := internal.ConfigureFolder()
 		tracelog.ErrorLogger.FatalOnError(err)
-		mysql.HandleBinlogFetch(folder, fetchBackupName, fetchUntilDt)
+		mysql.HandleBinlogFetch(folder, fetchOptionsBinlog)
 	},
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		internal.RequiredSettings[internal.MysqlBinlogReplayCmd] = true
-		internal.RequiredSettings[internal.MysqlBinlogDstSetting] = true
+		if fetchOptionsBinlog.DstDir == "" {
+			internal.RequiredSettings[internal.MysqlBinlogDstSetting] = true
+		}
 		err := internal.AssertRequiredSettingsSet()
 		tracelog.ErrorLogger.FatalOnError(err)
 	},
 }
 
 func init() {
-	binlogFetchCmd.PersistentFlags().StringVar(&fetchBackupName, "since", "LATEST", fetchSinceFlagShortDescr)
-	binlogFetchCmd.PersistentFlags().StringVar(&fetchUntilDt, "until", time.Now().Format(time.RFC3339), fetchUntilFlagShortDescr)
+	binlogFetchCmd.PersistentFlags().StringVar(&fetchOptionsBinlog.BackupName, "since", "LATEST", fetchSinceFlagShortDescr)
+	binlogFetchCmd.PersistentFlags().StringVar(&fetchOptionsBinlog.SinceTime, "since-time", "", fetchSinceTimeFlagShortDescr)
+	binlogFetchCmd.PersistentFlags().StringVar(&fetchOptionsBinlog.SinceGtid, "since-gtid", "", fetchSinceGtidFlagShortDescr)
+	binlogFetchCmd.PersistentFlags().StringVar(&fetchOptionsBinlog.UntilTime, "until", time.Now().Format(time.RFC3339), fetchUntilFlagShortDescr)
+	binlogFetchCmd.PersistentFlags().StringVar(&fetchOptionsBinlog.UntilGtid, "until-gtid", "", fetchUntilGtidFlagShortDescr)
+	binlogFetchCmd.PersistentFlags().StringVar(&fetchOptionsBinlog.DstDir, "dst", "", fetchDstFlagShortDescr)
 	Cmd.AddCommand(binlogFetchCmd)
 }
@@ -0,0 +1,26 @@
+package mysql
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/mysql"
+)
+
+const binlogListShortDescription = "Prints archived binlogs and gaps between them"
+
+// binlogListCmd represents the binlogList command
+var binlogListCmd = &cobra.Command{
+	Use:   "binlog-list",
+	Short: binlogListShortDescription,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+		mysql.HandleBinlogList(folder)
+	},
+}
+
+func init() {
+	Cmd.AddCommand(binlogListCmd)
+}
@@ -16,6 +16,7 @@ var binlogPushCmd = &cobra.Command{
 	Short: binlogPushShortDescription,
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
+		internal.AssertCrypterConfigured(internal.LogContentType)
 		uploader, err := internal.ConfigureUploader()
 		tracelog.ErrorLogger.FatalOnError(err)
 		mysql.HandleBinlogPush(uploader)
@@ -11,9 +11,11 @@ import (
 
 const replaySinceFlagShortDescr = "backup name starting from which you want to fetch binlogs"
 const replayUntilFlagShortDescr = "time in RFC3339 for PITR"
+const replayUntilGtidFlagShortDescr = "Full GTID set to replay for PITR, e.g. gtid_executed at the target point"
 
 var replayBackupName string
 var replayUntilDt string
+var replayUntilGtid string
 
 var binlogReplayCmd = &cobra.Command{
 	Use:   "binlog-replay",
@@ -22,12 +24,13 @@ var binlogReplayCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		folder, err := internal.ConfigureFolder()
 		tracelog.ErrorLogger.FatalOnError(err)
-		mysql.HandleBinlogReplay(folder, replayBackupName, replayUntilDt)
+		mysql.HandleBinlogReplay(folder, replayBackupName, replayUntilDt, replayUntilGtid)
 	},
 }
 
 func init() {
 	binlogReplayCmd.PersistentFlags().StringVar(&replayBackupName, "since", "LATEST", replaySinceFlagShortDescr)
 	binlogReplayCmd.PersistentFlags().StringVar(&replayUntilDt, "until", time.Now().Format(time.RFC3339), replayUntilFlagShortDescr)
+	binlogReplayCmd.PersistentFlags().StringVar(&replayUntilGtid, "until-gtid", "", replayUntilGtidFlagShortDescr)
 	Cmd.AddCommand(binlogReplayCmd)
 }
@@ -0,0 +1,26 @@
+package mysql
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/mysql"
+)
+
+const binlogServerShortDescription = "Serves archived binlogs to MySQL replicas over the replication protocol"
+
+// binlogServerCmd represents the binlogServer command
+var binlogServerCmd = &cobra.Command{
+	Use:   "binlog-server",
+	Short: binlogServerShortDescription,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+		mysql.HandleBinlogServer(folder)
+	},
+}
+
+func init() {
+	Cmd.AddCommand(binlogServerCmd)
+}
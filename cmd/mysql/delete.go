@@ -13,6 +13,7 @@ import (
 )
 
 var confirmed = false
+var withBinlogs = false
 
 // deleteCmd represents the delete command
 var deleteCmd = &cobra.Command{
@@ -46,7 +47,7 @@ var deleteEverythingCmd = &cobra.Command{
 func runDeleteEverything(cmd *cobra.Command, args []string) {
 	folder, err := internal.ConfigureFolder()
 	tracelog.ErrorLogger.FatalOnError(err)
-	internal.DeleteEverything(folder, confirmed, args)
+	internal.DeleteEverything(folder, confirmed, args, nil)
 }
 
 func runDeleteBefore(cmd *cobra.Command, args []string) {
@@ -55,7 +56,7 @@ func runDeleteBefore(cmd *cobra.Command, args []string) {
 	isFullBackup := func(object storage.Object) bool {
 		return IsFullBackup(folder, object)
 	}
-	internal.HandleDeleteBefore(folder, args, confirmed, isFullBackup, GetLessFunc(folder))
+	internal.HandleDeleteBefore(folder, args, confirmed, isFullBackup, GetLessFunc(folder), nil)
 }
 
 func runDeleteRetain(cmd *cobra.Command, args []string) {
@@ -64,59 +65,91 @@ func runDeleteRetain(cmd *cobra.Command, args []string) {
 	isFullBackup := func(object storage.Object) bool {
 		return IsFullBackup(folder, object)
 	}
-	internal.HandleDeleteRetain(folder, args, confirmed, isFullBackup, GetLessFunc(folder))
+	less := GetLessFunc(folder)
+	if withBinlogs {
+		less = getLessFuncWithBinlogs(folder)
+	}
+	internal.HandleDeleteRetain(folder, args, confirmed, isFullBackup, less, nil)
 }
 
 func init() {
 	Cmd.AddCommand(deleteCmd)
 	deleteCmd.AddCommand(deleteBeforeCmd, deleteRetainCmd, deleteEverythingCmd)
 	deleteCmd.PersistentFlags().BoolVar(&confirmed, internal.ConfirmFlag, false, "Confirms backup deletion")
+	deleteRetainCmd.Flags().BoolVar(&withBinlogs, "with-binlogs", false,
+		"Keeps binlogs needed for point-in-time recovery from the oldest retained backup and prunes the rest")
 }
 
 func IsFullBackup(folder storage.Folder, object storage.Object) bool {
-	return true
+	name := object.GetName()
+	if strings.HasPrefix(name, mysql.BinlogPath) {
+		return true
+	}
+	name = strings.Replace(name, utility.SentinelSuffix, "", 1)
+	backup := internal.NewBackup(folder.GetSubFolder(utility.BaseBackupPath), name)
+	var sentinel mysql.StreamSentinelDto
+	err := internal.FetchStreamSentinel(backup, &sentinel)
+	if err != nil {
+		return true
+	}
+	return !sentinel.IsIncremental()
 }
 
+// GetLessFunc compares backups by time, and binlogs with the backup by its binlog retention.
+// Binlogs are kept if binlogs needed by the backup can't be determined.
 func GetLessFunc(folder storage.Folder) func(object1, object2 storage.Object) bool {
+	return getLessFunc(folder, false)
+}
+
+// getLessFuncWithBinlogs is the same as GetLessFunc, but delete fails if binlogs needed by the target
+// can't be determined, instead of keeping all binlogs.
+func getLessFuncWithBinlogs(folder storage.Folder) func(object1, object2 storage.Object) bool {
+	return getLessFunc(folder, true)
+}
+
+func getLessFunc(folder storage.Folder, failOnUnknownRetention bool) func(object1, object2 storage.Object) bool {
+	// retention is found once per backup, since the backup is compared with every binlog
+	retentions := map[string]*mysql.BinlogRetention{}
 	return func(object1, object2 storage.Object) bool {
+		isBinlog1 := strings.HasPrefix(object1.GetName(), mysql.BinlogPath)
+		isBinlog2 := strings.HasPrefix(object2.GetName(), mysql.BinlogPath)
+		switch {
+		case isBinlog1 && isBinlog2:
+			return path.Base(object1.GetName()) < path.Base(object2.GetName())
+		case isBinlog1 || isBinlog2:
+			binlog, backup := object1, object2
+			if isBinlog2 {
+				binlog, backup = object2, object1
+			}
+			backupName := strings.Replace(backup.GetName(), utility.SentinelSuffix, "", 1)
+			retention, ok := retentions[backupName]
+			if !ok {
+				var err error
+				retention, err = mysql.NewBinlogRetention(folder, backupName)
+				if failOnUnknownRetention {
+					tracelog.ErrorLogger.FatalOnError(err)
+				}
+				if err != nil {
+					tracelog.ErrorLogger.Printf("Binlogs are kept: %v\n", err)
+				}
+				retentions[backupName] = retention
+			}
+			if retention == nil {
+				return false
+			}
+			if isBinlog1 {
+				return retention.IsPruned(binlog)
+			}
+			return !retention.IsPruned(binlog)
+		}
 		time1, ok := utility.TryFetchTimeRFC3999(object1.GetName())
 		if !ok {
-			return binlogLess(folder, object1, object2)
+			return false
 		}
 		time2, ok := utility.TryFetchTimeRFC3999(object2.GetName())
 		if !ok {
-			return binlogLess(folder, object1, object2)
+			return false
 		}
 		return time1 < time2
 	}
 }
-
-func binlogLess(folder storage.Folder, object1, object2 storage.Object) bool {
-	binlogName1, ok := tryFetchBinlogName(folder, object1)
-	if !ok {
-		return false
-	}
-	binlogName2, ok := tryFetchBinlogName(folder, object2)
-	if !ok {
-		return false
-	}
-	return binlogName1 < binlogName2
-}
-
-func tryFetchBinlogName(folder storage.Folder, object storage.Object) (string, bool) {
-	name := object.GetName()
-	if strings.HasPrefix(name, mysql.BinlogPath) {
-		_, name = path.Split(name)
-		return name, true
-	}
-	name = strings.Replace(name, utility.SentinelSuffix, "", 1)
-	baseBackupFolder := folder.GetSubFolder(utility.BaseBackupPath)
-	backup := internal.NewBackup(baseBackupFolder, name)
-	var sentinel mysql.StreamSentinelDto
-	err := internal.FetchStreamSentinel(backup, &sentinel)
-	if err != nil {
-		tracelog.InfoLogger.Println("Fail to fetch stream sentinel " + name)
-		return "", false
-	}
-	return sentinel.BinLogStart, true
-}
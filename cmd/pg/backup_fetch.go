@@ -13,13 +13,32 @@ const (
 	MaskFlagDescription         = `Fetches only files which path relative to destination_directory
 matches given shell file pattern.
 For information about pattern syntax view: https://golang.org/pkg/path/filepath/#Match`
-	RestoreSpecDescription        = "Path to file containing tablespace restore specification"
-	ReverseDeltaUnpackDescription = "Unpack delta backups in reverse order (beta feature)"
+	RestoreSpecDescription          = "Path to file containing tablespace restore specification"
+	ReverseDeltaUnpackDescription   = "Unpack delta backups in reverse order (beta feature)"
+	TablespaceMapDescription        = "Relocate tablespace from old to new location, given as old=new. Can be repeated"
+	RestoreOnlyDescription          = "Restore only given databases and tablespaces, relation files of others are left empty"
+	RestoreCommandDescription       = "restore_command written to recovery configuration of fetched backup"
+	RecoveryTargetTimeDescription   = "recovery_target_time written to recovery configuration of fetched backup"
+	RecoveryTargetLsnDescription    = "recovery_target_lsn written to recovery configuration of fetched backup"
+	RecoveryTargetNameDescription   = "recovery_target_name written to recovery configuration of fetched backup"
+	RecoveryTargetActionDescription = "recovery_target_action written to recovery configuration of fetched backup: pause, promote or shutdown"
+	RecoveryTargetTLDescription     = "recovery_target_timeline written to recovery configuration of fetched backup: current, latest or timeline id"
+	InPlaceDescription              = "Restore over existing data directory, rewriting only changed files and pages"
+	RestoreConfigDescription        = "Restore configuration files stored outside of the data directory to their original locations"
+	IgnoreVersionDescription        = "Restore even if Postgres major version of the backup differs from the data directory or binaries"
+	RecoveryConfigDescription       = "Write recovery configuration fetching WAL with wal-g even if no recovery settings are given"
 )
 
 var fileMask string
 var restoreSpec string
 var reverseDeltaUnpack bool
+var recoveryConfig internal.RecoveryConfig
+var tablespaceMapping []string
+var restoreOnly []string
+var inPlace bool
+var restoreConfig bool
+var ignoreVersionMismatch bool
+var writeRecoveryConfig bool
 
 var backupFetchCmd = &cobra.Command{
 	Use:   "backup-fetch destination_directory backup_name",
@@ -28,16 +47,32 @@ var backupFetchCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		folder, err := internal.ConfigureFolder()
 		tracelog.ErrorLogger.FatalOnError(err)
+		tracelog.ErrorLogger.FatalOnError(recoveryConfig.Validate())
+		tablespaceMap, err := internal.ParseTablespaceMap(tablespaceMapping)
+		tracelog.ErrorLogger.FatalOnError(err)
 
 		var pgFetcher func(folder storage.Folder, backup internal.Backup)
 		useReverseUnpackEnv := viper.GetBool(internal.UseReverseUnpackSetting)
 		if reverseDeltaUnpack || useReverseUnpackEnv {
-			pgFetcher = internal.GetPgFetcherNew(args[0], fileMask, restoreSpec)
+			if inPlace {
+				tracelog.ErrorLogger.Fatal("In-place restore is not supported with reverse delta unpack\n")
+			}
+			pgFetcher = internal.GetPgFetcherNew(args[0], fileMask, restoreSpec, tablespaceMap, restoreOnly)
 		} else {
-			pgFetcher = internal.GetPgFetcherOld(args[0], fileMask, restoreSpec)
+			pgFetcher = internal.GetPgFetcherOld(args[0], fileMask, restoreSpec, tablespaceMap, restoreOnly, inPlace)
+		}
+		if !ignoreVersionMismatch {
+			pgFetcher = internal.WithRestoreVersionCheck(args[0], pgFetcher)
 		}
 
 		internal.HandleBackupFetch(folder, args[1], pgFetcher)
+		if restoreConfig {
+			internal.HandleConfigFilesFetch(folder, args[1])
+		}
+
+		if writeRecoveryConfig || !recoveryConfig.IsEmpty() {
+			tracelog.ErrorLogger.FatalOnError(internal.WriteRecoveryConfig(args[0], recoveryConfig))
+		}
 	},
 }
 
@@ -46,5 +81,17 @@ func init() {
 	backupFetchCmd.Flags().StringVar(&restoreSpec, "restore-spec", "", RestoreSpecDescription)
 	backupFetchCmd.Flags().BoolVar(&reverseDeltaUnpack, "reverse-unpack",
 		false, ReverseDeltaUnpackDescription)
+	backupFetchCmd.Flags().StringArrayVar(&tablespaceMapping, "tablespace-map", nil, TablespaceMapDescription)
+	backupFetchCmd.Flags().StringSliceVar(&restoreOnly, "restore-only", nil, RestoreOnlyDescription)
+	backupFetchCmd.Flags().StringVar(&recoveryConfig.RestoreCommand, "restore-command", "", RestoreCommandDescription)
+	backupFetchCmd.Flags().StringVar(&recoveryConfig.TargetTime, "recovery-target-time", "", RecoveryTargetTimeDescription)
+	backupFetchCmd.Flags().StringVar(&recoveryConfig.TargetLsn, "recovery-target-lsn", "", RecoveryTargetLsnDescription)
+	backupFetchCmd.Flags().StringVar(&recoveryConfig.TargetName, "recovery-target-name", "", RecoveryTargetNameDescription)
+	backupFetchCmd.Flags().StringVar(&recoveryConfig.TargetAction, "recovery-target-action", "", RecoveryTargetActionDescription)
+	backupFetchCmd.Flags().StringVar(&recoveryConfig.TargetTimeline, "recovery-target-timeline", "", RecoveryTargetTLDescription)
+	backupFetchCmd.Flags().BoolVar(&writeRecoveryConfig, "recovery-config", false, RecoveryConfigDescription)
+	backupFetchCmd.Flags().BoolVar(&inPlace, "in-place", false, InPlaceDescription)
+	backupFetchCmd.Flags().BoolVar(&restoreConfig, "restore-config", false, RestoreConfigDescription)
+	backupFetchCmd.Flags().BoolVar(&ignoreVersionMismatch, "ignore-version-mismatch", false, IgnoreVersionDescription)
 	Cmd.AddCommand(backupFetchCmd)
 }
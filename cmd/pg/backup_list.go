@@ -1,6 +1,8 @@
 package pg
 
 import (
+	"time"
+
 	"github.com/spf13/cobra"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
@@ -11,6 +13,7 @@ const (
 	PrettyFlag                 = "pretty"
 	JsonFlag                   = "json"
 	DetailFlag                 = "detail"
+	AsOfFlag                   = "as-of"
 )
 
 var (
@@ -22,7 +25,11 @@ var (
 		Run: func(cmd *cobra.Command, args []string) {
 			folder, err := internal.ConfigureFolder()
 			tracelog.ErrorLogger.FatalOnError(err)
-			if pretty || json || detail {
+			if asOf != "" {
+				asOfTime, err := time.Parse(time.RFC3339, asOf)
+				tracelog.ErrorLogger.FatalOnError(err)
+				internal.HandleBackupListAsOf(folder, asOfTime, pretty, json)
+			} else if pretty || json || detail {
 				internal.HandleBackupListWithFlags(folder, pretty, json, detail)
 			} else {
 				internal.DefaultHandleBackupList(folder)
@@ -32,6 +39,7 @@ var (
 	pretty = false
 	json   = false
 	detail = false
+	asOf   = ""
 )
 
 func init() {
@@ -40,4 +48,5 @@ func init() {
 	backupListCmd.Flags().BoolVar(&pretty, PrettyFlag, false, "Prints more readable output")
 	backupListCmd.Flags().BoolVar(&json, JsonFlag, false, "Prints output in json format")
 	backupListCmd.Flags().BoolVar(&detail, DetailFlag, false, "Prints extra backup details")
+	backupListCmd.Flags().StringVar(&asOf, AsOfFlag, "", "Prints backups which existed at the given time (RFC3339), including ones deleted since then")
 }
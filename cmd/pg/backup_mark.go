@@ -9,7 +9,8 @@ import (
 const (
 	BackupMarkShortDescription = "Marks a backup permanent or impermanent"
 	BackupMarkLongDescription  = `Marks a backup permanent by default, or impermanent when flag is provided.
-	Permanent backups are prevented from being removed when running delete.`
+	Permanent backups and WAL needed to restore them are prevented from being removed when running delete.`
+	PermanentDescription   = "Marks a backup permanent, this is the default"
 	ImpermanentDescription = "Marks a backup impermanent"
 	ImpermanentFlag        = "impermanent"
 )
@@ -22,16 +23,21 @@ var (
 		Long:  BackupMarkLongDescription,
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
+			if toPermanent && toImpermanent {
+				tracelog.ErrorLogger.Fatalf("--%s and --%s can't be used together\n", PermanentFlag, ImpermanentFlag)
+			}
 			uploader, err := internal.ConfigureWalUploader()
 			tracelog.ErrorLogger.FatalOnError(err)
 
 			internal.HandleBackupMark(uploader.Uploader, args[0], !toImpermanent)
 		},
 	}
+	toPermanent   = false
 	toImpermanent = false
 )
 
 func init() {
+	backupMarkCmd.Flags().BoolVarP(&toPermanent, PermanentFlag, PermanentShorthand, false, PermanentDescription)
 	backupMarkCmd.Flags().BoolVarP(&toImpermanent, ImpermanentFlag, "i", false, ImpermanentDescription)
 	Cmd.AddCommand(backupMarkCmd)
 }
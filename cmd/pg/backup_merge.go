@@ -0,0 +1,34 @@
+package pg
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const (
+	backupMergeShortDescription = "Merges delta backup with its delta chain into a full backup in storage"
+	workDirectoryDescription    = "Directory where the delta chain is restored, temporary directory by default"
+)
+
+var (
+	// backupMergeCmd represents the backup-merge command
+	backupMergeCmd = &cobra.Command{
+		Use:   "backup-merge backup_name",
+		Short: backupMergeShortDescription,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			internal.AssertCrypterConfigured(internal.BackupContentType)
+			uploader, err := internal.ConfigureUploader()
+			tracelog.ErrorLogger.FatalOnError(err)
+			internal.HandleBackupMerge(uploader, args[0], mergeWorkDirectory)
+		},
+	}
+	mergeWorkDirectory string
+)
+
+func init() {
+	Cmd.AddCommand(backupMergeCmd)
+
+	backupMergeCmd.Flags().StringVar(&mergeWorkDirectory, "work-dir", "", workDirectoryDescription)
+}
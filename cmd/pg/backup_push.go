@@ -11,6 +11,9 @@ const (
 	BackupPushShortDescription = "Makes backup and uploads it to storage"
 	PermanentFlag              = "permanent"
 	FullBackupFlag             = "full"
+	RemoteBackupFlag           = "remote"
+	VerifyPageChecksumsFlag    = "verify"
+	IncludeConfigFlag          = "include-config"
 	PermanentShorthand         = "p"
 	FullBackupShorthand        = "f"
 )
@@ -20,15 +23,46 @@ var (
 	backupPushCmd = &cobra.Command{
 		Use:   "backup-push db_directory",
 		Short: BackupPushShortDescription, // TODO : improve description
-		Args:  cobra.ExactArgs(1),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if remoteBackup {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
+			internal.AssertCrypterConfigured(internal.BackupContentType)
+			tracelog.ErrorLogger.FatalOnError(internal.ConfigureLoadGovernor())
 			uploader, err := internal.ConfigureWalUploader()
 			tracelog.ErrorLogger.FatalOnError(err)
-			internal.HandleBackupPush(uploader, args[0], permanent, fullBackup)
+			lock, err := internal.ConfigureBackupPushLock(uploader.UploadingFolder)
+			tracelog.ErrorLogger.FatalOnError(err)
+			mirroredFolder, err := internal.ConfigureMirroredFolder(uploader.UploadingFolder)
+			tracelog.ErrorLogger.FatalOnError(err)
+			if mirroredFolder != nil {
+				uploader.UploadingFolder = mirroredFolder
+			}
+			if remoteBackup {
+				internal.HandleRemoteBackupPush(uploader, permanent)
+			} else {
+				internal.HandleBackupPush(uploader, args[0], permanent, fullBackup, verifyPageChecksums, includeConfig)
+			}
+			var mirrorsErr error
+			if mirroredFolder != nil {
+				mirrorsErr = mirroredFolder.ReportStatuses()
+			}
+			// the backup is complete in the primary storage, so the lock is released even if mirrors failed;
+			// the lock of a backup-push exited on a fatal error expires after TTL
+			if lock != nil {
+				tracelog.ErrorLogger.FatalOnError(lock.Release())
+			}
+			tracelog.ErrorLogger.FatalOnError(mirrorsErr)
 		},
 	}
-	permanent  = false
-	fullBackup = false
+	permanent           = false
+	fullBackup          = false
+	remoteBackup        = false
+	verifyPageChecksums = false
+	includeConfig       = false
 )
 
 func init() {
@@ -36,4 +70,10 @@ func init() {
 
 	backupPushCmd.Flags().BoolVarP(&permanent, PermanentFlag, PermanentShorthand, false, "Pushes permanent backup")
 	backupPushCmd.Flags().BoolVarP(&fullBackup, FullBackupFlag, FullBackupShorthand, false, "Make full backup-push")
+	backupPushCmd.Flags().BoolVar(&remoteBackup, RemoteBackupFlag, false,
+		"Take full backup over the replication protocol, without access to the data directory")
+	backupPushCmd.Flags().BoolVar(&verifyPageChecksums, VerifyPageChecksumsFlag, false,
+		"Verify page checksums of files and report corrupt blocks in the backup sentinel")
+	backupPushCmd.Flags().BoolVar(&includeConfig, IncludeConfigFlag, false,
+		"Include configuration files located outside of the data directory")
 }
@@ -9,8 +9,13 @@ import (
 const (
 	CatchupFetchShortDescription = "Fetches an incremental backup from storage"
 	UseNewUnwrapDescription      = "Use the new implementation of catchup unwrap (beta)"
+	RemoveExtraFilesDescription  = "Remove relation files which do not exist on the source cluster"
+)
+
+var (
+	useNewUnwrap     bool
+	removeExtraFiles bool
 )
-var useNewUnwrap bool
 
 // catchupFetchCmd represents the catchup-fetch command
 var catchupFetchCmd = &cobra.Command{
@@ -20,12 +25,14 @@ var catchupFetchCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		folder, err := internal.ConfigureFolder()
 		tracelog.ErrorLogger.FatalOnError(err)
-		internal.HandleCatchupFetch(folder, args[0], args[1], useNewUnwrap)
+		internal.HandleCatchupFetch(folder, args[0], args[1], useNewUnwrap, removeExtraFiles)
 	},
 }
 
 func init() {
 	catchupFetchCmd.Flags().BoolVar(&useNewUnwrap, "use-new-unwrap",
 		false, UseNewUnwrapDescription)
+	catchupFetchCmd.Flags().BoolVar(&removeExtraFiles, "remove-extra-files",
+		false, RemoveExtraFilesDescription)
 	Cmd.AddCommand(catchupFetchCmd)
 }
@@ -14,20 +14,23 @@ const (
 var (
 	// catchupPushCmd represents the catchup-push command
 	catchupPushCmd = &cobra.Command{
-		Use:   "catchup-push PGDATA --from-lsn LSN",
+		Use:   "catchup-push PGDATA --from-lsn LSN [--replica-state NAME]",
 		Short: catchupPushShortDescription,
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			uploader, err := internal.ConfigureWalUploader()
 			tracelog.ErrorLogger.FatalOnError(err)
-			internal.HandleCatchupPush(uploader, args[0], fromLSN)
+			internal.HandleCatchupPush(uploader, args[0], fromLSN, replicaStateName)
 		},
 	}
-	fromLSN uint64
+	fromLSN          uint64
+	replicaStateName string
 )
 
 func init() {
 	Cmd.AddCommand(catchupPushCmd)
 
 	catchupPushCmd.Flags().Uint64Var(&fromLSN, "from-lsn", 0, "LSN to start incremental backup")
+	catchupPushCmd.Flags().StringVar(&replicaStateName, "replica-state", "",
+		"Name of the replica state uploaded by catchup-state, blocks changed on the replica are sent too")
 }
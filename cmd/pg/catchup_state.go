@@ -0,0 +1,32 @@
+package pg
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const (
+	catchupStateShortDescription = "Uploads blocks of a stale replica changed since lsn"
+)
+
+var (
+	// catchupStateCmd represents the catchup-state command
+	catchupStateCmd = &cobra.Command{
+		Use:   "catchup-state PGDATA NAME --from-lsn LSN",
+		Short: catchupStateShortDescription,
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			folder, err := internal.ConfigureFolder()
+			tracelog.ErrorLogger.FatalOnError(err)
+			internal.HandleCatchupState(folder, args[0], args[1], catchupStateFromLSN)
+		},
+	}
+	catchupStateFromLSN uint64
+)
+
+func init() {
+	Cmd.AddCommand(catchupStateCmd)
+
+	catchupStateCmd.Flags().Uint64Var(&catchupStateFromLSN, "from-lsn", 0, "LSN where the replica diverged from the source cluster")
+}
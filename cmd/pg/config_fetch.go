@@ -0,0 +1,31 @@
+package pg
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const (
+	ConfigFetchShortDescription = "Restores configuration files uploaded by config-push"
+	TargetDirDescription        = "Restore files under this directory instead of their original locations"
+)
+
+var configTargetDir string
+
+// configFetchCmd represents the config-fetch command
+var configFetchCmd = &cobra.Command{
+	Use:   "config-fetch snapshot_name",
+	Short: ConfigFetchShortDescription,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+		internal.HandleConfigFetch(folder, args[0], configTargetDir)
+	},
+}
+
+func init() {
+	configFetchCmd.Flags().StringVar(&configTargetDir, "target-dir", "", TargetDirDescription)
+	Cmd.AddCommand(configFetchCmd)
+}
@@ -0,0 +1,26 @@
+package pg
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const ConfigPushShortDescription = "Uploads configuration files of the cluster to storage without backing up data"
+
+// configPushCmd represents the config-push command
+var configPushCmd = &cobra.Command{
+	Use:   "config-push db_directory",
+	Short: ConfigPushShortDescription,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		internal.AssertCrypterConfigured(internal.BackupContentType)
+		uploader, err := internal.ConfigureUploader()
+		tracelog.ErrorLogger.FatalOnError(err)
+		internal.HandleConfigPush(uploader, args[0])
+	},
+}
+
+func init() {
+	Cmd.AddCommand(configPushCmd)
+}
@@ -8,11 +8,12 @@ import (
 const (
 	backupCopyUsage            = "copy"
 	backupCopyShortDescription = "copy specific or all backups"
-	backupCopyLongDescription  = "Copy backup(s) from one storage to another according to configs (with history by default)"
+	backupCopyLongDescription  = "Copy backup(s) from one storage to another according to configs (with history by default)." +
+		" Only WAL needed by the chosen backups is copied"
 
 	backupNameFlag        = "backup-name"
 	backupNameShorthand   = "b"
-	backupNameDescription = "Copy specific backup"
+	backupNameDescription = "Copy specific backup, can be repeated to copy several backups"
 
 	fromFlag        = "from"
 	fromShorthand   = "f"
@@ -24,14 +25,18 @@ const (
 
 	withoutHistoryFlag        = "without-history"
 	withoutHistoryShorthand   = "w"
-	withoutHistoryDescription = "Copy backup without history"
+	withoutHistoryDescription = "Copy backup without history, only WAL from the backup start to its finish is copied"
+
+	walUntilFlag        = "wal-until"
+	walUntilDescription = "Copy history up to the given WAL segment (inclusive)"
 )
 
 var (
-	backupName     string
+	backupNames    []string
 	fromConfigFile string
 	toConfigFile   string
 	withoutHistory = false
+	walUntil       string
 
 	backupCopyCmd = &cobra.Command{
 		Use:   backupCopyUsage,
@@ -43,19 +48,20 @@ var (
 )
 
 func runBackupCopy(cmd *cobra.Command, args []string) {
-	internal.HandleCopy(fromConfigFile, toConfigFile, backupName, withoutHistory)
+	internal.HandleCopy(fromConfigFile, toConfigFile, backupNames, withoutHistory, walUntil)
 }
 
 func init() {
 	Cmd.AddCommand(backupCopyCmd)
 
-	backupCopyCmd.Flags().StringVarP(&backupName, backupNameFlag, backupNameShorthand, "", backupNameDescription)
+	backupCopyCmd.Flags().StringArrayVarP(&backupNames, backupNameFlag, backupNameShorthand, nil, backupNameDescription)
 	backupCopyCmd.Flags().StringVarP(&toConfigFile, toFlag, toShorthand, "", toDescription)
 	backupCopyCmd.Flags().StringVarP(&fromConfigFile, fromFlag, fromShorthand, "", fromDescription)
 	backupCopyCmd.Flags().BoolVarP(&withoutHistory, withoutHistoryFlag, withoutHistoryShorthand, false, withoutHistoryDescription)
+	backupCopyCmd.Flags().StringVar(&walUntil, walUntilFlag, "", walUntilDescription)
 
-	backupCopyCmd.MarkFlagFilename(toConfigFile)
-	backupCopyCmd.MarkFlagFilename(fromConfigFile)
-	backupCopyCmd.MarkFlagRequired(toConfigFile)
-	backupCopyCmd.MarkFlagRequired(fromConfigFile)
+	backupCopyCmd.MarkFlagFilename(toFlag)
+	backupCopyCmd.MarkFlagFilename(fromFlag)
+	backupCopyCmd.MarkFlagRequired(toFlag)
+	backupCopyCmd.MarkFlagRequired(fromFlag)
 }
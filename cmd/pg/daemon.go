@@ -0,0 +1,59 @@
+package pg
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const (
+	DaemonShortDescription       = "Runs WAL-G as a daemon serving wal-push and wal-fetch on a unix socket"
+	DaemonClientShortDescription = "Sends wal-push or wal-fetch request to WAL-G daemon"
+)
+
+// daemonCmd represents the daemon command
+var daemonCmd = &cobra.Command{
+	Use:   "daemon socket_path",
+	Short: DaemonShortDescription,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		internal.AssertCrypterConfigured(internal.LogContentType)
+		uploader, err := internal.ConfigureWalUploader()
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		archiveStatusManager, err := internal.ConfigureArchiveStatusManager()
+		if err == nil {
+			uploader.ArchiveStatusManager = internal.NewDataFolderASM(archiveStatusManager)
+		} else {
+			tracelog.ErrorLogger.PrintError(err)
+			uploader.ArchiveStatusManager = internal.NewNopASM()
+		}
+		mirroredFolder, err := internal.ConfigureMirroredFolder(uploader.UploadingFolder)
+		tracelog.ErrorLogger.FatalOnError(err)
+		if mirroredFolder != nil {
+			uploader.UploadingFolder = mirroredFolder
+		}
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+		internal.HandleDaemon(uploader, folder, args[0])
+		if mirroredFolder != nil {
+			mirroredFolder.WarnOnFailedMirrors()
+		}
+	},
+}
+
+// daemonClientCmd represents the daemon-client command
+var daemonClientCmd = &cobra.Command{
+	Use:   "daemon-client socket_path wal-push|wal-fetch args...",
+	Short: DaemonClientShortDescription,
+	Args:  cobra.MinimumNArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := internal.SendDaemonRequest(args[0], args[1], args[2:])
+		tracelog.ErrorLogger.FatalOnError(err)
+	},
+}
+
+func init() {
+	Cmd.AddCommand(daemonCmd)
+	Cmd.AddCommand(daemonClientCmd)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 
+	"github.com/jackc/pgx"
 	"github.com/spf13/cobra"
 	"github.com/wal-g/storages/storage"
 	"github.com/wal-g/tracelog"
@@ -17,6 +18,8 @@ var patternBackupName = fmt.Sprintf("base_%[1]s(_D_%[1]s)?", patternLSN)
 var regexpLSN = regexp.MustCompile(patternLSN)
 var regexpBackupName = regexp.MustCompile(patternBackupName)
 var maxCountOfLSN = 2
+var protectedLsns []string
+var protectSlots = false
 
 // deleteCmd represents the delete command
 var deleteCmd = &cobra.Command{
@@ -46,35 +49,69 @@ var deleteEverythingCmd = &cobra.Command{
 	Run:       runDeleteEverything,
 }
 
+var deleteGarbageCmd = &cobra.Command{
+	Use:   internal.DeleteGarbageUsageExample,
+	Short: "Clears WAL archives which are not needed by remaining backups",
+	Args:  cobra.NoArgs,
+	Run:   runDeleteGarbage,
+}
+
 func runDeleteBefore(cmd *cobra.Command, args []string) {
 	folder, err := internal.ConfigureFolder()
 	tracelog.ErrorLogger.FatalOnError(err)
+	walProtection := protectWal()
 	isFullBackup := func(object storage.Object) bool {
 		return postgresIsFullBackup(folder, object)
 	}
-	internal.HandleDeleteBefore(folder, args, confirmed, isFullBackup, postgresLess)
+	internal.HandleDeleteBefore(folder, args, confirmed, isFullBackup, postgresLess, walProtection)
 }
 
 func runDeleteRetain(cmd *cobra.Command, args []string) {
 	folder, err := internal.ConfigureFolder()
 	tracelog.ErrorLogger.FatalOnError(err)
+	walProtection := protectWal()
 	isFullBackup := func(object storage.Object) bool {
 		return postgresIsFullBackup(folder, object)
 	}
-	internal.HandleDeleteRetain(folder, args, confirmed, isFullBackup, postgresLess)
+	internal.HandleDeleteRetain(folder, args, confirmed, isFullBackup, postgresLess, walProtection)
 }
 
 func runDeleteEverything(cmd *cobra.Command, args []string) {
 	folder, err := internal.ConfigureFolder()
 	tracelog.ErrorLogger.FatalOnError(err)
-	internal.DeleteEverything(folder, confirmed, args)
+	internal.DeleteEverything(folder, confirmed, args, protectWal())
+}
+
+func runDeleteGarbage(cmd *cobra.Command, args []string) {
+	folder, err := internal.ConfigureFolder()
+	tracelog.ErrorLogger.FatalOnError(err)
+	internal.HandleDeleteGarbage(folder, confirmed, protectWal())
 }
 
 func init() {
 	Cmd.AddCommand(deleteCmd)
 
-	deleteCmd.AddCommand(deleteRetainCmd, deleteBeforeCmd, deleteEverythingCmd)
+	deleteCmd.AddCommand(deleteRetainCmd, deleteBeforeCmd, deleteEverythingCmd, deleteGarbageCmd)
 	deleteCmd.PersistentFlags().BoolVar(&confirmed, internal.ConfirmFlag, false, "Confirms backup deletion")
+	deleteCmd.PersistentFlags().StringArrayVar(&protectedLsns, "protect-lsn", nil,
+		"Keep WAL starting from the given LSN, e.g. 0/3000000. Can be repeated")
+	deleteCmd.PersistentFlags().BoolVar(&protectSlots, "protect-slots", false,
+		"Keep WAL still needed by replication slots of the database")
+}
+
+// protectWal keeps WAL which is still needed by lagging replicas or subscribers
+func protectWal() *internal.WalProtection {
+	walProtection := internal.NewWalProtection()
+	for _, lsnStr := range protectedLsns {
+		lsn, err := pgx.ParseLSN(lsnStr)
+		tracelog.ErrorLogger.FatalfOnError("Invalid protected LSN: %v\n", err)
+		walProtection.ProtectFromLsn(lsn)
+	}
+	if protectSlots {
+		err := walProtection.ProtectReplicationSlots()
+		tracelog.ErrorLogger.FatalfOnError("Failed to get positions of replication slots: %v\n", err)
+	}
+	return walProtection
 }
 
 // TODO: create postgres part and move it there, if it will be needed
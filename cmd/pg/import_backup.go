@@ -0,0 +1,31 @@
+package pg
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const importBackupShortDescription = "Uploads the output of pg_basebackup as a backup"
+
+var (
+	// importBackupCmd represents the import-backup command
+	importBackupCmd = &cobra.Command{
+		Use:   "import-backup backup_directory",
+		Short: importBackupShortDescription,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			internal.AssertCrypterConfigured(internal.BackupContentType, internal.LogContentType)
+			uploader, err := internal.ConfigureWalUploader()
+			tracelog.ErrorLogger.FatalOnError(err)
+			internal.HandleImportBackup(uploader, args[0], importPermanent)
+		},
+	}
+	importPermanent = false
+)
+
+func init() {
+	Cmd.AddCommand(importBackupCmd)
+
+	importBackupCmd.Flags().BoolVarP(&importPermanent, PermanentFlag, PermanentShorthand, false, "Imports permanent backup")
+}
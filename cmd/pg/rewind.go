@@ -0,0 +1,50 @@
+package pg
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const (
+	RewindShortDescription = "Rewinds the old primary with pg_rewind, fetching WAL it needs from storage"
+	RewindLongDescription  = `Fetches WAL segments of the target which pg_rewind needs and which are already removed
+from its pg_wal, then runs pg_rewind. Arguments after -- are passed to pg_rewind as is.
+The rewound cluster is configured as a standby of the source restoring WAL from storage.`
+	SourceServerDescription     = "Connection string of the source server, passed to pg_rewind"
+	RewindDryRunDescription     = "Fetch WAL and run pg_rewind with --dry-run, the target is not modified"
+	NoStandbyConfigDescription  = "Do not configure the rewound cluster as a standby of the source"
+	RewindRestoreCmdDescription = "restore_command written to standby configuration of the rewound cluster"
+)
+
+var (
+	rewindOptions   internal.RewindOptions
+	noStandbyConfig bool
+)
+
+// rewindCmd represents the rewind command
+var rewindCmd = &cobra.Command{
+	Use:   "rewind target_data_directory --source-server=connection_string [-- pg_rewind arguments]",
+	Short: RewindShortDescription,
+	Long:  RewindLongDescription,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if cmd.ArgsLenAtDash() > 1 || (cmd.ArgsLenAtDash() == -1 && len(args) > 1) {
+			tracelog.ErrorLogger.Fatal("Only the target data directory is expected before --\n")
+		}
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+		rewindOptions.PgRewindArgs = args[1:]
+		rewindOptions.WriteStandbyConfig = !noStandbyConfig
+		internal.HandleRewind(folder, args[0], rewindOptions)
+	},
+}
+
+func init() {
+	rewindCmd.Flags().StringVar(&rewindOptions.SourceServer, "source-server", "", SourceServerDescription)
+	_ = rewindCmd.MarkFlagRequired("source-server")
+	rewindCmd.Flags().BoolVar(&rewindOptions.DryRun, "dry-run", false, RewindDryRunDescription)
+	rewindCmd.Flags().BoolVar(&noStandbyConfig, "no-standby-config", false, NoStandbyConfigDescription)
+	rewindCmd.Flags().StringVar(&rewindOptions.RestoreCommand, "restore-command", "", RewindRestoreCmdDescription)
+	Cmd.AddCommand(rewindCmd)
+}
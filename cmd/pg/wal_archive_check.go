@@ -0,0 +1,27 @@
+package pg
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const WalArchiveCheckShortDescription = "Compares WAL files archived according to pg_wal/archive_status with WAL in storage"
+
+// walArchiveCheckCmd represents the walArchiveCheck command
+var walArchiveCheckCmd = &cobra.Command{
+	Use:   "wal-archive-check db_directory",
+	Short: WalArchiveCheckShortDescription,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+		internal.HandleWalArchiveCheck(folder, args[0], os.Stdout)
+	},
+}
+
+func init() {
+	Cmd.AddCommand(walArchiveCheckCmd)
+}
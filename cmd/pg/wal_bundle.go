@@ -0,0 +1,31 @@
+package pg
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const (
+	WalBundleShortDescription = "Merges WAL segments older than the newest full backup into bundles"
+	SegmentsFlagDescription   = "Maximum number of WAL segments in one bundle"
+)
+
+var segmentsPerBundle int
+
+// walBundleCmd represents the walBundle command
+var walBundleCmd = &cobra.Command{
+	Use:   "wal-bundle",
+	Short: WalBundleShortDescription,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+		internal.HandleWalBundle(folder, segmentsPerBundle)
+	},
+}
+
+func init() {
+	walBundleCmd.Flags().IntVar(&segmentsPerBundle, "segments", internal.DefaultWalBundleSegments, SegmentsFlagDescription)
+	Cmd.AddCommand(walBundleCmd)
+}
@@ -6,16 +6,34 @@ import (
 	"github.com/wal-g/wal-g/internal"
 )
 
-const WalPrefetchShortDescription = `Used for prefetching process forking
-and should not be called by user.`
+const (
+	WalPrefetchShortDescription = `Prefetches a range of WAL segments before recovery.
+Without --range it is used for prefetching process forking and should not be called by user.`
+	WalPrefetchRangeDescription       = "Segments to prefetch as start:end, bounds are segment names or LSNs"
+	WalPrefetchTimelineDescription    = "Timeline of range bounds given as LSNs"
+	WalPrefetchDirectDescription      = "Put segments to the directory itself instead of the prefetch spool of wal-fetch"
+	WalPrefetchConcurrencyDescription = "Number of parallel downloads, WALG_DOWNLOAD_CONCURRENCY by default"
+)
+
+var walPrefetchRangeOptions = internal.WalPrefetchRangeOptions{}
 
 // walPrefetchCmd represents the walPrefetch command
 var walPrefetchCmd = &cobra.Command{
-	Use:    "wal-prefetch wal_name prefetch_location",
-	Short:  WalPrefetchShortDescription,
-	Args:   cobra.ExactArgs(2),
-	Hidden: true,
+	Use:   "wal-prefetch (--range start:end wal_directory | wal_name prefetch_location)",
+	Short: WalPrefetchShortDescription,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if walPrefetchRangeOptions.Range != "" {
+			return cobra.ExactArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(2)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
+		if walPrefetchRangeOptions.Range != "" {
+			folder, err := internal.ConfigureFolder()
+			tracelog.ErrorLogger.FatalOnError(err)
+			internal.HandleWALPrefetchRange(folder, args[0], walPrefetchRangeOptions)
+			return
+		}
 		uploader, err := internal.ConfigureWalUploaderWithoutCompressMethod()
 		tracelog.ErrorLogger.FatalOnError(err)
 		internal.HandleWALPrefetch(uploader, args[0], args[1])
@@ -23,5 +41,10 @@ var walPrefetchCmd = &cobra.Command{
 }
 
 func init() {
+	walPrefetchCmd.Flags().StringVar(&walPrefetchRangeOptions.Range, "range", "", WalPrefetchRangeDescription)
+	walPrefetchCmd.Flags().Uint32Var(&walPrefetchRangeOptions.Timeline, "timeline", 1, WalPrefetchTimelineDescription)
+	walPrefetchCmd.Flags().BoolVar(&walPrefetchRangeOptions.Direct, "direct", false, WalPrefetchDirectDescription)
+	walPrefetchCmd.Flags().IntVar(&walPrefetchRangeOptions.Concurrency, "concurrency", 0,
+		WalPrefetchConcurrencyDescription)
 	Cmd.AddCommand(walPrefetchCmd)
 }
@@ -14,6 +14,7 @@ var walPushCmd = &cobra.Command{
 	Short: WalPushShortDescription, // TODO : improve description
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		internal.AssertCrypterConfigured(internal.LogContentType)
 		uploader, err := internal.ConfigureWalUploader()
 		tracelog.ErrorLogger.FatalOnError(err)
 
@@ -24,7 +25,15 @@ var walPushCmd = &cobra.Command{
 			tracelog.ErrorLogger.PrintError(err)
 			uploader.ArchiveStatusManager = internal.NewNopASM()
 		}
+		mirroredFolder, err := internal.ConfigureMirroredFolder(uploader.UploadingFolder)
+		tracelog.ErrorLogger.FatalOnError(err)
+		if mirroredFolder != nil {
+			uploader.UploadingFolder = mirroredFolder
+		}
 		internal.HandleWALPush(uploader, args[0])
+		if mirroredFolder != nil {
+			mirroredFolder.WarnOnFailedMirrors()
+		}
 	},
 }
 
@@ -0,0 +1,45 @@
+package pg
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const (
+	walReceiveShortDescription = "Streams WAL over the replication protocol and uploads it to storage"
+	walReceiveSlotFlag         = "slot"
+	walReceivePartialFlag      = "partial"
+)
+
+var (
+	// walReceiveCmd represents the wal-receive command
+	walReceiveCmd = &cobra.Command{
+		Use:   "wal-receive",
+		Short: walReceiveShortDescription,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			internal.AssertCrypterConfigured(internal.LogContentType)
+			uploader, err := internal.ConfigureWalUploader()
+			tracelog.ErrorLogger.FatalOnError(err)
+			mirroredFolder, err := internal.ConfigureMirroredFolder(uploader.UploadingFolder)
+			tracelog.ErrorLogger.FatalOnError(err)
+			if mirroredFolder != nil {
+				uploader.UploadingFolder = mirroredFolder
+			}
+			internal.HandleWALReceive(uploader, walReceiveSlot, walReceivePartial)
+			if mirroredFolder != nil {
+				mirroredFolder.WarnOnFailedMirrors()
+			}
+		},
+	}
+	walReceiveSlot    string
+	walReceivePartial bool
+)
+
+func init() {
+	Cmd.AddCommand(walReceiveCmd)
+
+	walReceiveCmd.Flags().StringVar(&walReceiveSlot, walReceiveSlotFlag, "", "Physical replication slot to stream from")
+	walReceiveCmd.Flags().BoolVar(&walReceivePartial, walReceivePartialFlag, false, "Upload the incomplete current segment periodically")
+}
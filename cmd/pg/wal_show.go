@@ -0,0 +1,32 @@
+package pg
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const WalShowShortDescription = "Shows timelines of archived WAL, their gaps and windows reachable by point-in-time recovery"
+
+var (
+	// walShowCmd represents the walShow command
+	walShowCmd = &cobra.Command{
+		Use:   "wal-show",
+		Short: WalShowShortDescription,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			folder, err := internal.ConfigureFolder()
+			tracelog.ErrorLogger.FatalOnError(err)
+			internal.HandleWalShow(folder, walShowJson, os.Stdout)
+		},
+	}
+	walShowJson = false
+)
+
+func init() {
+	Cmd.AddCommand(walShowCmd)
+
+	walShowCmd.Flags().BoolVar(&walShowJson, JsonFlag, false, "Prints output in json format")
+}
@@ -0,0 +1,27 @@
+package pg
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const WalVerifyShortDescription = "Verifies that there are no missing WAL segments between retained backups and the present"
+
+// walVerifyCmd represents the walVerify command
+var walVerifyCmd = &cobra.Command{
+	Use:   "wal-verify",
+	Short: WalVerifyShortDescription,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+		internal.HandleWalVerify(folder, os.Stdout)
+	},
+}
+
+func init() {
+	Cmd.AddCommand(walVerifyCmd)
+}
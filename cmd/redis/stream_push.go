@@ -16,6 +16,7 @@ var streamPushCmd = &cobra.Command{
 	Short: streamPushShortDescription,
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
+		internal.AssertCrypterConfigured(internal.BackupContentType)
 		uploader, err := internal.ConfigureUploader()
 		tracelog.ErrorLogger.FatalOnError(err)
 		backupCmd, err := internal.GetCommandSetting(internal.NameStreamCreateCmd)
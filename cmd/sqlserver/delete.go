@@ -42,7 +42,7 @@ var deleteEverythingCmd = &cobra.Command{
 func runDeleteEverything(cmd *cobra.Command, args []string) {
 	folder, err := internal.ConfigureFolder()
 	tracelog.ErrorLogger.FatalOnError(err)
-	internal.DeleteEverything(folder, confirmed, args)
+	internal.DeleteEverything(folder, confirmed, args, nil)
 }
 
 func runDeleteBefore(cmd *cobra.Command, args []string) {
@@ -51,7 +51,7 @@ func runDeleteBefore(cmd *cobra.Command, args []string) {
 	isFullBackup := func(object storage.Object) bool {
 		return IsFullBackup(folder, object)
 	}
-	internal.HandleDeleteBefore(folder, args, confirmed, isFullBackup, GetLessFunc(folder))
+	internal.HandleDeleteBefore(folder, args, confirmed, isFullBackup, GetLessFunc(folder), nil)
 }
 
 func runDeleteRetain(cmd *cobra.Command, args []string) {
@@ -60,7 +60,7 @@ func runDeleteRetain(cmd *cobra.Command, args []string) {
 	isFullBackup := func(object storage.Object) bool {
 		return IsFullBackup(folder, object)
 	}
-	internal.HandleDeleteRetain(folder, args, confirmed, isFullBackup, GetLessFunc(folder))
+	internal.HandleDeleteRetain(folder, args, confirmed, isFullBackup, GetLessFunc(folder), nil)
 }
 
 func init() {
@@ -7,9 +7,12 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/spf13/viper"
 	"github.com/wal-g/storages/fs"
 	"github.com/wal-g/storages/storage"
 	"github.com/wal-g/tracelog"
@@ -41,6 +44,30 @@ func (err NoBackupsFoundError) Error() string {
 	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
 }
 
+// MissingBackupDataError is used to signal that backup was extracted only partially
+// and lists the files which are missing in restored data.
+type MissingBackupDataError struct {
+	error
+}
+
+func newMissingBackupDataError(backupName string, tarNames []string, tarFileSets map[string][]string) MissingBackupDataError {
+	var message strings.Builder
+	message.WriteString(fmt.Sprintf("failed to extract %d tar part(s) of backup '%s'", len(tarNames), backupName))
+	for _, tarName := range tarNames {
+		message.WriteString(fmt.Sprintf("\n%s", tarName))
+		files := append([]string(nil), tarFileSets[tarName]...)
+		sort.Strings(files)
+		for _, file := range files {
+			message.WriteString(fmt.Sprintf("\n\t%s", file))
+		}
+	}
+	return MissingBackupDataError{errors.New(message.String())}
+}
+
+func (err MissingBackupDataError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
 // Backup contains information about a valid backup
 // generated and uploaded by WAL-G.
 type Backup struct {
@@ -132,16 +159,10 @@ func (backup *Backup) fetchMeta() (ExtendedMetadataDto, error) {
 	return extendedMetadataDto, errors.Wrap(err, "failed to unmarshal metadata")
 }
 
+// checkDbDirectoryForUnwrap prepares tablespaces of the directory, callers check that it is empty
+// or holds only files of the backup before the whole delta chain is unwrapped
 func checkDbDirectoryForUnwrap(dbDataDirectory string, sentinelDto BackupSentinelDto) error {
-	if !sentinelDto.IsIncremental() {
-		isEmpty, err := isDirectoryEmpty(dbDataDirectory)
-		if err != nil {
-			return err
-		}
-		if !isEmpty {
-			return newNonEmptyDbDataDirectoryError(dbDataDirectory)
-		}
-	} else {
+	if sentinelDto.IsIncremental() {
 		tracelog.DebugLogger.Println("DB data directory before increment:")
 		_ = filepath.Walk(dbDataDirectory,
 			func(path string, info os.FileInfo, err error) error {
@@ -182,7 +203,17 @@ func setTablespacePaths(spec TablespaceSpec) error {
 		if err != nil {
 			return fmt.Errorf("Error creating folder for tablespace %v\n", err)
 		}
-		err = os.Symlink(location.Location, filepath.Join(basePrefix, location.Symlink))
+		symlinkPath := filepath.Join(basePrefix, location.Symlink)
+		if existingLocation, err := os.Readlink(symlinkPath); err == nil {
+			// symlink is already there when unwrapping increments or restoring in place
+			if existingLocation == location.Location {
+				continue
+			}
+			if err = os.Remove(symlinkPath); err != nil {
+				return fmt.Errorf("Error removing tablespace symlink %v\n", err)
+			}
+		}
+		err = os.Symlink(location.Location, symlinkPath)
 		if err != nil {
 			return fmt.Errorf("Error creating tablespace symkink %v\n", err)
 		}
@@ -190,8 +221,8 @@ func setTablespacePaths(spec TablespaceSpec) error {
 	return nil
 }
 
-// check that directory is empty before unwrap
-func (backup *Backup) unwrapToEmptyDirectory(
+// unwrapToDirectory unpacks Backup object into the directory, overwriting files left by a failed restore
+func (backup *Backup) unwrapToDirectory(
 	dbDataDirectory string, sentinelDto BackupSentinelDto, filesToUnwrap map[string]bool, createIncrementalFiles bool,
 ) error {
 	err := checkDbDirectoryForUnwrap(dbDataDirectory, sentinelDto)
@@ -208,6 +239,29 @@ func (backup *Backup) unwrapOld(
 	dbDataDirectory string, sentinelDto BackupSentinelDto, filesToUnwrap map[string]bool, createIncrementalFiles bool,
 ) error {
 	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, sentinelDto, filesToUnwrap, createIncrementalFiles)
+	return backup.unwrapWithInterpreter(tarInterpreter, sentinelDto, filesToUnwrap)
+}
+
+// unwrapInPlace unpacks Backup object over existing files of dbDataDirectory, rewriting only changed pages
+func (backup *Backup) unwrapInPlace(dbDataDirectory string, sentinelDto BackupSentinelDto, filesToUnwrap map[string]bool) error {
+	if sentinelDto.TablespaceSpec != nil && !sentinelDto.TablespaceSpec.empty() {
+		err := setTablespacePaths(*sentinelDto.TablespaceSpec)
+		if err != nil {
+			return err
+		}
+	}
+	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, sentinelDto, filesToUnwrap, false)
+	tarInterpreter.inPlace = true
+	return backup.unwrapWithInterpreter(tarInterpreter, sentinelDto, filesToUnwrap)
+}
+
+func (backup *Backup) unwrapWithInterpreter(tarInterpreter *FileTarInterpreter, sentinelDto BackupSentinelDto,
+	filesToUnwrap map[string]bool) error {
+	extractConcurrencies, err := getExtractConcurrencies()
+	if err != nil {
+		return err
+	}
+	tarInterpreter.SetExtractConcurrencies(extractConcurrencies)
 	tarsToExtract, pgControlKey, err := backup.getTarsToExtract(sentinelDto, filesToUnwrap)
 	if err != nil {
 		return err
@@ -220,22 +274,61 @@ func (backup *Backup) unwrapOld(
 		return newPgControlNotFoundError()
 	}
 
-	err = ExtractAll(tarInterpreter, tarsToExtract)
+	pgControlTars := []ReaderMaker{newStorageReaderMaker(backup.getTarPartitionFolder(), pgControlKey)}
+	progress := newRestoreProgress(backup.Name, sentinelDto)
+	if progress != nil {
+		tarInterpreter.progress = progress
+		tarsToExtract = progress.wrapReaderMakers(tarsToExtract)
+		pgControlTars = progress.wrapReaderMakers(pgControlTars)
+		progress.start()
+		defer progress.stopReporting()
+	}
+
+	err = backup.extractTars(tarInterpreter, tarsToExtract, sentinelDto)
 	if err != nil {
 		return err
 	}
 
 	if needPgControl {
-		err = ExtractAll(tarInterpreter, []ReaderMaker{newStorageReaderMaker(backup.getTarPartitionFolder(), pgControlKey)})
+		err = ExtractAll(tarInterpreter, pgControlTars)
 		if err != nil {
 			return errors.Wrap(err, "failed to extract pg_control")
 		}
 	}
 
+	if progress != nil {
+		progress.finish()
+	}
 	tracelog.InfoLogger.Print("\nBackup extraction complete.\n")
 	return nil
 }
 
+// extractTars extracts backup tar parts. If DeferFailedTarsSetting is enabled,
+// failed parts are retried after the rest of backup is extracted (also from the failover
+// storage, if configured), and only then fetch fails with the list of missing files.
+func (backup *Backup) extractTars(tarInterpreter TarInterpreter, tarsToExtract []ReaderMaker,
+	sentinelDto BackupSentinelDto) error {
+	if !viper.GetBool(DeferFailedTarsSetting) {
+		return ExtractAll(tarInterpreter, tarsToExtract)
+	}
+
+	var failoverTarFolder storage.Folder
+	failoverFolder, err := ConfigureFetchFailoverFolder()
+	if err != nil {
+		return err
+	}
+	if failoverFolder != nil {
+		failoverTarFolder = failoverFolder.GetSubFolder(utility.BaseBackupPath).
+			GetSubFolder(backup.Name + TarPartitionFolderName)
+	}
+
+	err = ExtractAllDeferringFailures(tarInterpreter, tarsToExtract, failoverTarFolder)
+	if failedTarsErr, ok := err.(FailedTarPartsError); ok {
+		return newMissingBackupDataError(backup.Name, failedTarsErr.TarNames, sentinelDto.TarFileSets)
+	}
+	return err
+}
+
 func IsPgControlRequired(backup *Backup, sentinelDto BackupSentinelDto) bool {
 	re := regexp.MustCompile(`^([^_]+._{1}[^_]+._{1})`)
 	walgBasebackupName := re.FindString(backup.Name) == ""
@@ -280,6 +373,10 @@ func (backup *Backup) getTarsToExtract(sentinelDto BackupSentinelDto, filesToUnw
 			pgControlKey = tarName
 			continue
 		}
+		// configuration files are restored to their original locations only on demand
+		if configFilesTarRe.MatchString(tarName) {
+			continue
+		}
 
 		if !shouldUnwrapTar(tarName, sentinelDto, filesToUnwrap) {
 			continue
@@ -309,12 +406,17 @@ func (backup *Backup) GetFilesToUnwrap(fileMask string) (map[string]bool, error)
 	return utility.SelectMatchingFiles(fileMask, filesToUnwrap)
 }
 
+// shouldUnwrapTar checks if the tar contains any of files to unwrap.
+// Tars without known contents, e.g. the ones holding only directories, are always unwrapped.
 func shouldUnwrapTar(tarName string, sentinelDto BackupSentinelDto, filesToUnwrap map[string]bool) bool {
-	if len(sentinelDto.TarFileSets) == 0 {
+	if len(sentinelDto.TarFileSets) == 0 || filesToUnwrap == nil {
 		return true
 	}
 
-	tarFiles := sentinelDto.TarFileSets[tarName]
+	tarFiles, ok := sentinelDto.TarFileSets[tarName]
+	if !ok {
+		return true
+	}
 
 	for _, file := range tarFiles {
 		if filesToUnwrap[file] {
@@ -4,4 +4,34 @@ package internal
 type BackupDetail struct {
 	BackupTime
 	ExtendedMetadataDto
+	// WalFileNameFinish is the last WAL segment needed to restore the backup to consistent state,
+	// so WAL from WalFileName to WalFileNameFinish is required
+	WalFileNameFinish string `json:"wal_file_name_finish,omitempty"`
+}
+
+func newBackupDetail(backupTime BackupTime, meta ExtendedMetadataDto) BackupDetail {
+	detail := BackupDetail{BackupTime: backupTime, ExtendedMetadataDto: meta}
+	timeline, _, err := ParseWALFilename(backupTime.WalFileName)
+	if err == nil && meta.FinishLsn > 0 {
+		detail.WalFileNameFinish = newWalSegmentNo(meta.FinishLsn - 1).getFilename(timeline)
+	}
+	return detail
+}
+
+// metadataFromSentinel fills metadata of backups made by older versions of WAL-G, which have no metadata file
+func metadataFromSentinel(sentinelDto BackupSentinelDto) ExtendedMetadataDto {
+	meta := ExtendedMetadataDto{
+		PgVersion:        sentinelDto.PgVersion,
+		SystemIdentifier: sentinelDto.SystemIdentifier,
+		UncompressedSize: sentinelDto.UncompressedSize,
+		CompressedSize:   sentinelDto.CompressedSize,
+		UserData:         sentinelDto.UserData,
+	}
+	if sentinelDto.BackupStartLSN != nil {
+		meta.StartLsn = *sentinelDto.BackupStartLSN
+	}
+	if sentinelDto.BackupFinishLSN != nil {
+		meta.FinishLsn = *sentinelDto.BackupFinishLSN
+	}
+	return meta
 }
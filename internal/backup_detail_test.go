@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBackupDetailWalRange(t *testing.T) {
+	backupTime := BackupTime{BackupName: "base_000000020000000000000003", WalFileName: "000000020000000000000003"}
+
+	detail := newBackupDetail(backupTime, ExtendedMetadataDto{StartLsn: 0x3000028, FinishLsn: 0x5000100})
+	assert.Equal(t, "000000020000000000000005", detail.WalFileNameFinish)
+
+	// backup which ends exactly at segment boundary does not need the next segment
+	detail = newBackupDetail(backupTime, ExtendedMetadataDto{StartLsn: 0x3000028, FinishLsn: 0x5000000})
+	assert.Equal(t, "000000020000000000000004", detail.WalFileNameFinish)
+
+	detail = newBackupDetail(BackupTime{BackupName: "stream_20200101T000000Z"}, ExtendedMetadataDto{FinishLsn: 1})
+	assert.Empty(t, detail.WalFileNameFinish)
+}
+
+func TestMetadataFromSentinel(t *testing.T) {
+	startLsn, finishLsn := uint64(10), uint64(20)
+	meta := metadataFromSentinel(BackupSentinelDto{BackupStartLSN: &startLsn, BackupFinishLSN: &finishLsn,
+		PgVersion: 120003, CompressedSize: 5, UncompressedSize: 7})
+	assert.Equal(t, ExtendedMetadataDto{StartLsn: 10, FinishLsn: 20, PgVersion: 120003,
+		CompressedSize: 5, UncompressedSize: 7}, meta)
+}
@@ -65,10 +65,18 @@ func readRestoreSpec(path string, spec *TablespaceSpec) (err error) {
 	return nil
 }
 
-func GetPgFetcherOld(dbDataDirectory, fileMask, restoreSpecPath string) func(folder storage.Folder, backup Backup) {
+// GetPgFetcherOld returns fetcher unpacking base backup first and then applying increments.
+// If inPlace is set, the backup is restored over the existing data directory, rewriting only changed files and pages.
+func GetPgFetcherOld(dbDataDirectory, fileMask, restoreSpecPath string,
+	tablespaceMap map[string]string, restoreOnly []string, inPlace bool) func(folder storage.Folder, backup Backup) {
 	return func(folder storage.Folder, backup Backup) {
 		filesToUnwrap, err := backup.GetFilesToUnwrap(fileMask)
 		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		filesToUnwrap, stubs, err := selectRestoreOnlyFiles(&backup, restoreOnly, filesToUnwrap)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		excludedStubs, err := getExcludedRelationStubs(&backup)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		stubs = append(stubs, excludedStubs...)
 
 		var spec *TablespaceSpec
 		if restoreSpecPath != "" {
@@ -77,14 +85,31 @@ func GetPgFetcherOld(dbDataDirectory, fileMask, restoreSpecPath string) func(fol
 			errMessege := fmt.Sprintf("Invalid restore specification path %s\n", restoreSpecPath)
 			tracelog.ErrorLogger.FatalfOnError(errMessege, err)
 		}
-		err = deltaFetchRecursionOld(backup.Name, folder, utility.ResolveSymlink(dbDataDirectory), spec, filesToUnwrap)
+		dbDataDirectory = utility.ResolveSymlink(dbDataDirectory)
+		spec, err = remapTablespaceSpec(&backup, spec, dbDataDirectory, tablespaceMap)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		sentinelDto, err := backup.GetSentinel()
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		if inPlace {
+			err = prepareInPlaceRestore(dbDataDirectory, sentinelDto)
+		} else {
+			err = checkDirectoryForRestore(dbDataDirectory, sentinelDto)
+		}
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		err = deltaFetchRecursionOld(backup.Name, folder, dbDataDirectory, spec, filesToUnwrap, inPlace)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		err = createEmptyStubs(dbDataDirectory, stubs)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		err = restoreWalDirectory(dbDataDirectory)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		err = remapTablespaceMapFile(dbDataDirectory, tablespaceMap)
 		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
 	}
 }
 
 func GetStreamFetcher(writeCloser io.WriteCloser) func(folder storage.Folder, backup Backup) {
 	return func(folder storage.Folder, backup Backup) {
-		err := downloadAndDecompressStream(&backup, writeCloser)
+		err := DownloadAndDecompressStream(&backup, writeCloser)
 		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
 	}
 }
@@ -97,7 +122,7 @@ func GetCommandStreamFetcher(cmd *exec.Cmd) func(folder storage.Folder, backup B
 		cmd.Stderr = stderr
 		err = cmd.Start()
 		tracelog.ErrorLogger.FatalfOnError("Failed to start restore command: %v\n", err)
-		err = downloadAndDecompressStream(&backup, stdin)
+		err = DownloadAndDecompressStream(&backup, stdin)
 		cmdErr := cmd.Wait()
 		if cmdErr != nil {
 			tracelog.ErrorLogger.Printf("Restore command output:\n%s", stderr.String())
@@ -145,21 +170,39 @@ func GetBackupByName(backupName, subfolder string, folder storage.Folder) (*Back
 }
 
 // If specified - choose specified, else choose from latest sentinelDto
-func chooseTablespaceSpecification(sentinelDto BackupSentinelDto, spec *TablespaceSpec) {
+func chooseTablespaceSpecification(sentinelDto *BackupSentinelDto, spec *TablespaceSpec) {
 	if spec != nil {
 		sentinelDto.TablespaceSpec = spec
-	} else {
-		if sentinelDto.TablespaceSpec == nil {
-			sentinelDto.TablespaceSpec = &TablespaceSpec{}
+	} else if sentinelDto.TablespaceSpec == nil {
+		sentinelDto.TablespaceSpec = &TablespaceSpec{}
+	}
+}
+
+// remapTablespaceSpec relocates tablespaces found in tablespaceMap, their symlinks are placed in dbDataDirectory.
+// Tablespaces are taken from the restore spec if it is given, otherwise from the fetched backup.
+// The result is used for all backups of the delta chain, so tablespaces are remapped once for the final layout.
+func remapTablespaceSpec(backup *Backup, spec *TablespaceSpec, dbDataDirectory string,
+	tablespaceMap map[string]string) (*TablespaceSpec, error) {
+	if len(tablespaceMap) == 0 {
+		return spec, nil
+	}
+	if spec == nil {
+		sentinelDto, err := backup.GetSentinel()
+		if err != nil {
+			return nil, err
 		}
 		spec = sentinelDto.TablespaceSpec
+		if spec == nil {
+			spec = &TablespaceSpec{}
+		}
 	}
+	return spec.remapped(dbDataDirectory, tablespaceMap)
 }
 
 // TODO : unit tests
 // deltaFetchRecursion function composes Backup object and recursively searches for necessary base backup
 func deltaFetchRecursionOld(backupName string, folder storage.Folder, dbDataDirectory string,
-	tablespaceSpec *TablespaceSpec, filesToUnwrap map[string]bool) error {
+	tablespaceSpec *TablespaceSpec, filesToUnwrap map[string]bool, inPlace bool) error {
 	backup, err := GetBackupByName(backupName, utility.BaseBackupPath, folder)
 	if err != nil {
 		return err
@@ -168,7 +211,15 @@ func deltaFetchRecursionOld(backupName string, folder storage.Folder, dbDataDire
 	if err != nil {
 		return err
 	}
-	chooseTablespaceSpecification(sentinelDto, tablespaceSpec)
+	if len(sentinelDto.ExcludePatterns) > 0 {
+		tracelog.InfoLogger.Printf("Paths matching %v were excluded from backup %s intentionally\n",
+			sentinelDto.ExcludePatterns, backupName)
+	}
+	chooseTablespaceSpecification(&sentinelDto, tablespaceSpec)
+	filesToUnwrap, err = skipIdenticalFiles(dbDataDirectory, sentinelDto.Files, filesToUnwrap)
+	if err != nil {
+		return err
+	}
 
 	if sentinelDto.IsIncremental() {
 		tracelog.InfoLogger.Printf("Delta from %v at LSN %x \n", *(sentinelDto.IncrementFrom), *(sentinelDto.IncrementFromLSN))
@@ -176,14 +227,17 @@ func deltaFetchRecursionOld(backupName string, folder storage.Folder, dbDataDire
 		if err != nil {
 			return err
 		}
-		err = deltaFetchRecursionOld(*sentinelDto.IncrementFrom, folder, dbDataDirectory, tablespaceSpec, baseFilesToUnwrap)
+		err = deltaFetchRecursionOld(*sentinelDto.IncrementFrom, folder, dbDataDirectory, tablespaceSpec, baseFilesToUnwrap, inPlace)
 		if err != nil {
 			return err
 		}
 		tracelog.InfoLogger.Printf("%v fetched. Upgrading from LSN %x to LSN %x \n", *(sentinelDto.IncrementFrom), *(sentinelDto.IncrementFromLSN), *(sentinelDto.BackupStartLSN))
 	}
 
-	return backup.unwrapToEmptyDirectory(dbDataDirectory, sentinelDto, filesToUnwrap, false)
+	if inPlace {
+		return backup.unwrapInPlace(dbDataDirectory, sentinelDto, filesToUnwrap)
+	}
+	return backup.unwrapToDirectory(dbDataDirectory, sentinelDto, filesToUnwrap, false)
 }
 
 func GetBaseFilesToUnwrap(backupFileStates BackupFileList, currentFilesToUnwrap map[string]bool) (map[string]bool, error) {
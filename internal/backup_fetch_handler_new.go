@@ -7,10 +7,16 @@ import (
 	"github.com/wal-g/wal-g/utility"
 )
 
-func GetPgFetcherNew(dbDataDirectory, fileMask, restoreSpecPath string) func(folder storage.Folder, backup Backup) {
+func GetPgFetcherNew(dbDataDirectory, fileMask, restoreSpecPath string,
+	tablespaceMap map[string]string, restoreOnly []string) func(folder storage.Folder, backup Backup) {
 	return func(folder storage.Folder, backup Backup) {
 		filesToUnwrap, err := backup.GetFilesToUnwrap(fileMask)
 		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		filesToUnwrap, stubs, err := selectRestoreOnlyFiles(&backup, restoreOnly, filesToUnwrap)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		excludedStubs, err := getExcludedRelationStubs(&backup)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		stubs = append(stubs, excludedStubs...)
 
 		var spec *TablespaceSpec
 		if restoreSpecPath != "" {
@@ -29,7 +35,16 @@ func GetPgFetcherNew(dbDataDirectory, fileMask, restoreSpecPath string) func(fol
 				newNonEmptyDbDataDirectoryError(dbDataDirectory))
 		}
 
-		err = deltaFetchRecursionNew(backup.Name, folder, utility.ResolveSymlink(dbDataDirectory), spec, filesToUnwrap)
+		dbDataDirectory = utility.ResolveSymlink(dbDataDirectory)
+		spec, err = remapTablespaceSpec(&backup, spec, dbDataDirectory, tablespaceMap)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		err = deltaFetchRecursionNew(backup.Name, folder, dbDataDirectory, spec, filesToUnwrap)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		err = createEmptyStubs(dbDataDirectory, stubs)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		err = restoreWalDirectory(dbDataDirectory)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		err = remapTablespaceMapFile(dbDataDirectory, tablespaceMap)
 		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
 	}
 }
@@ -46,7 +61,11 @@ func deltaFetchRecursionNew(backupName string, folder storage.Folder, dbDataDire
 	if err != nil {
 		return err
 	}
-	chooseTablespaceSpecification(sentinelDto, tablespaceSpec)
+	if len(sentinelDto.ExcludePatterns) > 0 {
+		tracelog.InfoLogger.Printf("Paths matching %v were excluded from backup %s intentionally\n",
+			sentinelDto.ExcludePatterns, backupName)
+	}
+	chooseTablespaceSpecification(&sentinelDto, tablespaceSpec)
 
 	if sentinelDto.IsIncremental() {
 		tracelog.InfoLogger.Printf("Delta %v at LSN %x \n", backupName, *(sentinelDto.BackupStartLSN))
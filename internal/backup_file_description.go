@@ -6,10 +6,14 @@ type BackupFileDescription struct {
 	IsIncremented bool // should never be both incremented and Skipped
 	IsSkipped     bool
 	MTime         time.Time
+	// CorruptBlocks are pages with wrong checksums found while pushing the backup
+	CorruptBlocks *CorruptBlocksInfo `json:",omitempty"`
+	// SHA256 is the checksum of the file content sent in full, it is stored if WALG_BACKUP_FILE_CHECKSUMS is enabled
+	SHA256 string `json:",omitempty"`
 }
 
 func NewBackupFileDescription(isIncremented, isSkipped bool, modTime time.Time) *BackupFileDescription {
-	return &BackupFileDescription{isIncremented, isSkipped, modTime}
+	return &BackupFileDescription{IsIncremented: isIncremented, IsSkipped: isSkipped, MTime: modTime}
 }
 
 type BackupFileList map[string]BackupFileDescription
@@ -29,7 +29,7 @@ type Logging struct {
 
 func DefaultHandleBackupList(folder storage.Folder) {
 	getBackupsFunc := func() ([]BackupTime, error) {
-		return getBackups(folder)
+		return GetBackups(folder)
 	}
 	writeBackupListFunc := func(backups []BackupTime) {
 		WriteBackupList(backups, os.Stdout)
@@ -59,7 +59,7 @@ func HandleBackupList(
 
 // TODO : unit tests
 func HandleBackupListWithFlags(folder storage.Folder, pretty bool, json bool, detail bool) {
-	backups, err := getBackups(folder)
+	backups, err := GetBackups(folder)
 	if len(backups) == 0 {
 		tracelog.InfoLogger.Println("No backups found")
 		return
@@ -89,19 +89,58 @@ func HandleBackupListWithFlags(folder storage.Folder, pretty bool, json bool, de
 	}
 }
 
+// HandleBackupListAsOf prints backups which existed in the storage at the given moment.
+// Deleted backups are reconstructed from tombstones left by delete.
+func HandleBackupListAsOf(folder storage.Folder, asOf time.Time, pretty bool, json bool) {
+	wals, err := GetObjectsAsOf(folder, asOf, utility.WalPath)
+	tracelog.ErrorLogger.FatalOnError(err)
+	walCount, oldestWal, newestWal := countWals(wals)
+	if walCount > 0 {
+		tracelog.InfoLogger.Printf("%d WAL archives existed as of %s: from %s to %s\n",
+			walCount, asOf.Format(time.RFC3339), oldestWal, newestWal)
+	} else {
+		tracelog.InfoLogger.Printf("No WAL archives existed as of %s\n", asOf.Format(time.RFC3339))
+	}
+
+	getBackupsFunc := func() ([]BackupTime, error) {
+		return GetBackupsAsOf(folder, asOf)
+	}
+	writeBackupListFunc := func(backups []BackupTime) {
+		if json {
+			err := WriteAsJson(backups, os.Stdout, pretty)
+			tracelog.ErrorLogger.FatalOnError(err)
+		} else if pretty {
+			WritePrettyBackupList(backups, os.Stdout)
+		} else {
+			WriteBackupList(backups, os.Stdout)
+		}
+	}
+	logging := Logging{
+		InfoLogger:  tracelog.InfoLogger,
+		ErrorLogger: tracelog.ErrorLogger,
+	}
+
+	HandleBackupList(getBackupsFunc, writeBackupListFunc, logging)
+}
+
 func getBackupDetails(folder storage.Folder, backups []BackupTime) ([]BackupDetail, error) {
 	backupDetails := make([]BackupDetail, len(backups))
 	for i := len(backups) - 1; i >= 0; i-- {
 		backup, err := GetBackupByName(backups[i].BackupName, utility.BaseBackupPath, folder)
 		if err != nil {
 			return nil, err
-		} else {
-			metaData, err := backup.fetchMeta()
-			if err != nil {
+		}
+		metaData, err := backup.fetchMeta()
+		if err != nil {
+			sentinelDto, sentinelErr := backup.GetSentinel()
+			if sentinelErr != nil {
 				return nil, err
 			}
-			backupDetails[i] = BackupDetail{backups[i], metaData}
+			tracelog.DebugLogger.Printf("Backup %s has no metadata, details are taken from sentinel: %v\n",
+				backup.Name, err)
+			metaData = metadataFromSentinel(sentinelDto)
 		}
+		backupDetails[i] = newBackupDetail(backups[i], metaData)
 	}
 	return backupDetails, nil
 }
@@ -121,10 +160,10 @@ func WriteBackupList(backups []BackupTime, output io.Writer) {
 func writeBackupListDetails(backupDetails []BackupDetail, output io.Writer) {
 	writer := tabwriter.NewWriter(output, 0, 0, 1, ' ', 0)
 	defer writer.Flush()
-	fmt.Fprintln(writer, "name\tlast_modified\twal_segment_backup_start\tstart_time\tfinish_time\thostname\tdata_dir\tpg_version\tstart_lsn\tfinish_lsn\tis_permanent")
+	fmt.Fprintln(writer, "name\tlast_modified\twal_segment_backup_start\tstart_time\tfinish_time\thostname\tdata_dir\tpg_version\tstart_lsn\tfinish_lsn\tis_permanent\twal_segment_backup_finish\tuncompressed_size\tcompressed_size")
 	for i := len(backupDetails) - 1; i >= 0; i-- {
 		b := backupDetails[i]
-		fmt.Fprintln(writer, fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v", b.BackupName, b.Time.Format(time.RFC3339), b.WalFileName, b.StartTime.Format(time.RFC850), b.FinishTime.Format(time.RFC850), b.Hostname, b.DataDir, b.PgVersion, b.StartLsn, b.FinishLsn, b.IsPermanent))
+		fmt.Fprintln(writer, fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v", b.BackupName, b.Time.Format(time.RFC3339), b.WalFileName, b.StartTime.Format(time.RFC850), b.FinishTime.Format(time.RFC850), b.Hostname, b.DataDir, b.PgVersion, b.StartLsn, b.FinishLsn, b.IsPermanent, b.WalFileNameFinish, b.UncompressedSize, b.CompressedSize))
 	}
 }
 
@@ -143,9 +182,9 @@ func writePrettyBackupListDetails(backupDetails []BackupDetail, output io.Writer
 	writer := table.NewWriter()
 	writer.SetOutputMirror(output)
 	defer writer.Render()
-	writer.AppendHeader(table.Row{"#", "Name", "Last modified", "WAL segment backup start", "Start time", "Finish time", "Hostname", "Datadir", "PG Version", "Start LSN", "Finish LSN", "Permanent"})
+	writer.AppendHeader(table.Row{"#", "Name", "Last modified", "WAL segment backup start", "Start time", "Finish time", "Hostname", "Datadir", "PG Version", "Start LSN", "Finish LSN", "Permanent", "WAL segment backup finish", "Uncompressed size", "Compressed size"})
 	for i, b := range backupDetails {
-		writer.AppendRow(table.Row{i, b.BackupName, b.Time.Format(time.RFC850), b.WalFileName, b.StartTime.Format(time.RFC850), b.FinishTime.Format(time.RFC850), b.Hostname, b.DataDir, b.PgVersion, b.StartLsn, b.FinishLsn, b.IsPermanent})
+		writer.AppendRow(table.Row{i, b.BackupName, b.Time.Format(time.RFC850), b.WalFileName, b.StartTime.Format(time.RFC850), b.FinishTime.Format(time.RFC850), b.Hostname, b.DataDir, b.PgVersion, b.StartLsn, b.FinishLsn, b.IsPermanent, b.WalFileNameFinish, b.UncompressedSize, b.CompressedSize})
 	}
 }
 
@@ -110,7 +110,10 @@ func getMarkedImpermanentBackupMetadata(folder storage.Folder, backupName string
 		return nil, err
 	}
 
-	permanentBackups, _ := getPermanentObjects(folder)
+	permanentBackups, _, err := getPermanentObjects(folder)
+	if err != nil {
+		return nil, err
+	}
 	//  del current backup from
 	delete(permanentBackups, getBackupNumber(backupName))
 
@@ -159,7 +162,7 @@ func backupHasPermanentInFuture(reverseLinks *map[string][]string, backupName st
 func getGraphFromBaseToIncrement(folder storage.Folder) (map[string][]string, error) {
 	baseBackupFolder := folder.GetSubFolder(utility.BaseBackupPath)
 
-	backups, err := getBackups(folder)
+	backups, err := GetBackups(folder)
 	if err != nil {
 		return nil, err
 	}
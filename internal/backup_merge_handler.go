@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	mergeDataDirectory        = "data"
+	mergeTablespacesDirectory = "tablespaces"
+)
+
+type BackupIsNotIncrementalError struct {
+	error
+}
+
+func newBackupIsNotIncrementalError(backupName string) BackupIsNotIncrementalError {
+	return BackupIsNotIncrementalError{errors.Errorf("Backup '%s' is not incremental, nothing to merge", backupName)}
+}
+
+func (err BackupIsNotIncrementalError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// TODO : unit tests
+// HandleBackupMerge is invoked to perform wal-g backup-merge.
+// The delta backup is restored with all its increments to workDirectory and uploaded as a full backup,
+// so older members of its delta chain can be deleted.
+func HandleBackupMerge(uploader *Uploader, backupName, workDirectory string) {
+	folder := uploader.UploadingFolder
+	backup, err := GetBackupByName(backupName, utility.BaseBackupPath, folder)
+	tracelog.ErrorLogger.FatalfOnError("Failed to find backup: %v\n", err)
+	sentinelDto, err := backup.GetSentinel()
+	tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup sentinel: %v\n", err)
+	if !sentinelDto.IsIncremental() {
+		tracelog.ErrorLogger.FatalError(newBackupIsNotIncrementalError(backup.Name))
+	}
+	meta, err := backup.fetchMeta()
+	tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup metadata: %v\n", err)
+
+	mergedName := mergedBackupName(backup.Name)
+	exists, err := NewBackup(backup.BaseBackupFolder, mergedName).CheckExistence()
+	tracelog.ErrorLogger.FatalOnError(err)
+	if exists {
+		tracelog.ErrorLogger.FatalError(NewBackupAlreadyExistsError(mergedName))
+	}
+
+	if workDirectory == "" {
+		workDirectory, err = ioutil.TempDir("", "wal-g-merge")
+		tracelog.ErrorLogger.FatalOnError(err)
+		defer os.RemoveAll(workDirectory)
+	}
+
+	dataDirectory, err := restoreBackupForMerge(folder, backup.Name, sentinelDto, workDirectory)
+	tracelog.ErrorLogger.FatalfOnError("Failed to restore backup for merge: %v\n", err)
+
+	uploader.UploadingFolder = folder.GetSubFolder(utility.BaseBackupPath)
+	mergedSentinelDto, err := uploadMergedBackup(uploader, dataDirectory, mergedName, sentinelDto)
+	tracelog.ErrorLogger.FatalfOnError("Failed to upload merged backup: %v\n", err)
+	for _, restored := range []string{mergeDataDirectory, mergeTablespacesDirectory} {
+		if err = os.RemoveAll(filepath.Join(workDirectory, restored)); err != nil {
+			tracelog.WarningLogger.Printf("Failed to clean up merge work directory: %v\n", err)
+		}
+	}
+
+	// the merged backup describes the same cluster state as the delta backup, so its metadata is kept
+	metaBody, err := json.Marshal(meta)
+	tracelog.ErrorLogger.FatalOnError(err)
+	err = uploader.Upload(storage.JoinPath(mergedName, utility.MetadataFileName), bytes.NewReader(metaBody))
+	tracelog.ErrorLogger.FatalfOnError("Failed to upload metadata file for backup: %v\n", err)
+	err = UploadSentinel(uploader, mergedSentinelDto, mergedName)
+	tracelog.ErrorLogger.FatalfOnError("Failed to upload sentinel file for backup: %v\n", err)
+	tracelog.InfoLogger.Printf("Merged delta chain of %s into full backup %s\n", backup.Name, mergedName)
+}
+
+// mergedBackupName strips the name of the delta base from the name of delta backup
+func mergedBackupName(backupName string) string {
+	return strings.SplitN(backupName, "_D_", 2)[0]
+}
+
+// restoreBackupForMerge restores the backup to data directory inside workDirectory.
+// Tablespaces are relocated into workDirectory too, so restore doesn't touch their original locations.
+func restoreBackupForMerge(folder storage.Folder, backupName string, sentinelDto BackupSentinelDto,
+	workDirectory string) (dataDirectory string, err error) {
+	dataDirectory = filepath.Join(workDirectory, mergeDataDirectory)
+	if err = os.MkdirAll(dataDirectory, 0700); err != nil {
+		return "", err
+	}
+	isEmpty, err := isDirectoryEmpty(dataDirectory)
+	if err != nil {
+		return "", err
+	}
+	if !isEmpty {
+		return "", newNonEmptyDbDataDirectoryError(dataDirectory)
+	}
+
+	tablespaceMap := make(map[string]string)
+	if sentinelDto.TablespaceSpec != nil {
+		for _, symlinkName := range sentinelDto.TablespaceSpec.TablespaceNames() {
+			location, _ := sentinelDto.TablespaceSpec.location(symlinkName)
+			tablespaceMap[location.Location] = filepath.Join(workDirectory, mergeTablespacesDirectory, symlinkName)
+		}
+	}
+	backup := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), backupName)
+	filesToUnwrap, err := backup.GetFilesToUnwrap("")
+	if err != nil {
+		return "", err
+	}
+	spec, err := remapTablespaceSpec(backup, sentinelDto.TablespaceSpec, dataDirectory, tablespaceMap)
+	if err != nil {
+		return "", err
+	}
+	err = deltaFetchRecursionOld(backupName, folder, dataDirectory, spec, filesToUnwrap, false)
+	return dataDirectory, err
+}
+
+// uploadMergedBackup uploads restored data directory as a full backup and returns its sentinel
+func uploadMergedBackup(uploader *Uploader, dataDirectory, backupName string,
+	deltaSentinelDto BackupSentinelDto) (*BackupSentinelDto, error) {
+	files, uncompressedSize, err := uploadDirectoryAsBackup(uploader, dataDirectory, backupName)
+	if err != nil {
+		return nil, err
+	}
+
+	// tablespaces are described by their original locations, not by locations used for merge
+	sentinelDto := deltaSentinelDto
+	sentinelDto.IncrementFromLSN = nil
+	sentinelDto.IncrementFrom = nil
+	sentinelDto.IncrementFullName = nil
+	sentinelDto.IncrementCount = nil
+	sentinelDto.DeltaChainSize = 0
+	sentinelDto.TarFileSets = nil
+	// configuration files are not restored for merge, so they are not in the merged backup
+	sentinelDto.ConfigFiles = nil
+	// sizes of tablespaces of the delta don't describe the merged backup
+	sentinelDto.TablespaceSizes = nil
+	sentinelDto.setFiles(files)
+	sentinelDto.UncompressedSize = uncompressedSize
+	sentinelDto.CompressedSize = atomic.LoadInt64(uploader.tarSize)
+	return &sentinelDto, nil
+}
+
+// uploadDirectoryAsBackup uploads files of the data directory as a full backup without contacting the database,
+// pg_control is uploaded last. Returns descriptions of uploaded files and their uncompressed size.
+func uploadDirectoryAsBackup(uploader *Uploader, dataDirectory, backupName string) (*sync.Map, int64, error) {
+	crypter := ConfigureCrypterForContentType(BackupContentType)
+	bundle := newBundle(dataDirectory, crypter, nil, nil, false)
+	bundle.TarBallMaker = NewStorageTarBallMaker(backupName, uploader)
+
+	err := bundle.StartQueue()
+	if err != nil {
+		return nil, 0, err
+	}
+	tracelog.InfoLogger.Println("Walking ...")
+	err = filepath.Walk(dataDirectory, bundle.HandleWalkedFSObject)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = bundle.FinishQueue()
+	if err != nil {
+		return nil, 0, err
+	}
+	uncompressedSize := bundle.TarBall.Size()
+	err = bundle.UploadPgControl(uploader.Compressor.FileExtension())
+	if err != nil {
+		return nil, 0, err
+	}
+	uploader.finish()
+	if uploader.Failed.Load().(bool) {
+		return nil, 0, errors.Errorf("uploading failed during '%s' backup", backupName)
+	}
+	return bundle.getFiles(), uncompressedSize, nil
+}
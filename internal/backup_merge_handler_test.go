@@ -0,0 +1,13 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergedBackupName(t *testing.T) {
+	assert.Equal(t, "base_000000010000000000000009",
+		mergedBackupName("base_000000010000000000000009_D_000000010000000000000005"))
+	assert.Equal(t, "base_000000010000000000000009", mergedBackupName("base_000000010000000000000009"))
+}
@@ -51,6 +51,11 @@ func (backup *Backup) unwrapNew(
 	}
 
 	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, sentinelDto, filesToUnwrap, createIncrementalFiles)
+	extractConcurrencies, err := getExtractConcurrencies()
+	if err != nil {
+		return err
+	}
+	tarInterpreter.SetExtractConcurrencies(extractConcurrencies)
 	tarsToExtract, pgControlKey, err := backup.getTarsToExtract(sentinelDto, filesToUnwrap)
 	if err != nil {
 		return err
@@ -63,18 +68,31 @@ func (backup *Backup) unwrapNew(
 		return newPgControlNotFoundError()
 	}
 
-	err = ExtractAll(tarInterpreter, tarsToExtract)
+	pgControlTars := []ReaderMaker{newStorageReaderMaker(backup.getTarPartitionFolder(), pgControlKey)}
+	progress := newRestoreProgress(backup.Name, sentinelDto)
+	if progress != nil {
+		tarInterpreter.progress = progress
+		tarsToExtract = progress.wrapReaderMakers(tarsToExtract)
+		pgControlTars = progress.wrapReaderMakers(pgControlTars)
+		progress.start()
+		defer progress.stopReporting()
+	}
+
+	err = backup.extractTars(tarInterpreter, tarsToExtract, sentinelDto)
 	if err != nil {
 		return err
 	}
 
 	if needPgControl {
-		err = ExtractAll(tarInterpreter, []ReaderMaker{newStorageReaderMaker(backup.getTarPartitionFolder(), pgControlKey)})
+		err = ExtractAll(tarInterpreter, pgControlTars)
 		if err != nil {
 			return errors.Wrap(err, "failed to extract pg_control")
 		}
 	}
 
+	if progress != nil {
+		progress.finish()
+	}
 	tracelog.InfoLogger.Print("\nBackup extraction complete.\n")
 	return nil
 }
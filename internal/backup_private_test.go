@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"archive/tar"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -88,3 +89,41 @@ func TestIsDirectoryEmpty_ReturnsTrue_WhenDirectoryDoesntExist(t *testing.T) {
 
 	assert.True(t, actual)
 }
+
+func TestSentinelChainSize(t *testing.T) {
+	full := BackupSentinelDto{CompressedSize: 100}
+	assert.Equal(t, int64(100), full.chainSize())
+
+	delta := BackupSentinelDto{CompressedSize: 10, DeltaChainSize: 110}
+	assert.Equal(t, int64(110), delta.chainSize())
+}
+
+func TestBundleRecordsTarFileSets(t *testing.T) {
+	dir, err := createTempDir("tar_file_sets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("data"), 0600))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+
+	bundle := newBundle(dir, nil, nil, nil, false)
+	tarBall := newNopTarBallMaker().Make(false)
+	header, err := tar.FileInfoHeader(info, "")
+	assert.NoError(t, err)
+	header.Name = bundle.getFileRelPath(path)
+	assert.NoError(t, bundle.packFileIntoTar(path, info, header, false, tarBall))
+
+	assert.Equal(t, map[string][]string{"part_001.tar": {"/file"}}, bundle.getTarFileSets())
+}
+
+func TestShouldUnwrapTar(t *testing.T) {
+	sentinel := BackupSentinelDto{TarFileSets: map[string][]string{"part_001.tar.lz4": {"/base/1/1259"}}}
+
+	assert.True(t, shouldUnwrapTar("part_001.tar.lz4", sentinel, map[string]bool{"/base/1/1259": true}))
+	assert.False(t, shouldUnwrapTar("part_001.tar.lz4", sentinel, map[string]bool{"/base/1/2608": true}))
+	// tars holding only directories are not listed
+	assert.True(t, shouldUnwrapTar("part_002.tar.lz4", sentinel, map[string]bool{"/base/1/2608": true}))
+	assert.True(t, shouldUnwrapTar("part_001.tar.lz4", sentinel, UnwrapAll))
+	assert.True(t, shouldUnwrapTar("part_001.tar.lz4", BackupSentinelDto{}, map[string]bool{}))
+}
@@ -54,9 +54,39 @@ func (err BackupFromOtherBD) Error() string {
 	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
 }
 
+type BackupAlreadyExistsError struct {
+	error
+}
+
+func NewBackupAlreadyExistsError(backupName string) BackupAlreadyExistsError {
+	return BackupAlreadyExistsError{errors.Errorf("Backup '%s' already exists: it was pushed from the same source position before", backupName)}
+}
+
+func (err BackupAlreadyExistsError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// CheckBackupIsNew returns BackupAlreadyExistsError if the backup is already in storage
+// and deterministic backup naming is enabled
+func CheckBackupIsNew(folder storage.Folder, backupName string) error {
+	deterministic, err := GetBoolSetting(DeterministicNamingSetting, false)
+	if err != nil || !deterministic {
+		return err
+	}
+	exists, err := NewBackup(folder, backupName).CheckExistence()
+	if err != nil {
+		return err
+	}
+	if exists {
+		return NewBackupAlreadyExistsError(backupName)
+	}
+	return nil
+}
+
 // TODO : unit tests
-func getDeltaConfig() (maxDeltas int, fromFull bool) {
+func getDeltaConfig() (maxDeltas int, fromFull bool, maxChainSize int64) {
 	maxDeltas = viper.GetInt(DeltaMaxStepsSetting)
+	maxChainSize = viper.GetInt64(DeltaMaxChainSizeSetting)
 	if origin, hasOrigin := GetSetting(DeltaOriginSetting); hasOrigin {
 		switch origin {
 		case LatestString:
@@ -69,18 +99,25 @@ func getDeltaConfig() (maxDeltas int, fromFull bool) {
 	return
 }
 
+// createAndPushBackup uploads the backup of archiveDirectory and returns its name
 func createAndPushBackup(
 	uploader *WalUploader,
 	archiveDirectory, backupsFolder, previousBackupName string,
 	previousBackupSentinelDto BackupSentinelDto,
 	isPermanent, forceIncremental bool,
 	incrementCount int,
-) {
+	replicaDivergedBlocks PagedFileDeltaMap,
+	verifyPageChecksums, includeConfigFiles bool,
+) string {
 	folder := uploader.UploadingFolder
 	uploader.UploadingFolder = folder.GetSubFolder(backupsFolder) // TODO: AB: this subfolder switch look ugly. I think typed storage folders could be better (i.e. interface BasebackupStorageFolder, WalStorageFolder etc)
 
-	crypter := ConfigureCrypter()
+	crypter := ConfigureCrypterForContentType(BackupContentType)
 	bundle := newBundle(archiveDirectory, crypter, previousBackupSentinelDto.BackupStartLSN, previousBackupSentinelDto.Files, forceIncremental)
+	bundle.ReplicaDivergedBlocks = replicaDivergedBlocks
+	excludePatterns, err := GetBackupExcludePatterns()
+	tracelog.ErrorLogger.FatalOnError(err)
+	bundle.ExcludePatterns = excludePatterns
 
 	var meta ExtendedMetadataDto
 	meta.StartTime = utility.TimeNowCrossPlatformUTC()
@@ -90,6 +127,12 @@ func createAndPushBackup(
 	// Connect to postgres and start/finish a nonexclusive backup.
 	conn, err := Connect()
 	tracelog.ErrorLogger.FatalOnError(err)
+	var excludedRelations map[string][]string
+	if relations := GetBackupExcludeRelations(); len(relations) > 0 {
+		excludedRelations, err = resolveExcludedRelations(conn, relations)
+		tracelog.ErrorLogger.FatalOnError(err)
+		bundle.ExcludedRelationFiles = newExcludedRelationFiles(excludedRelations)
+	}
 	backupName, backupStartLSN, pgVersion, dataDir, systemIdentifier, err := bundle.StartBackup(conn,
 		utility.CeilTimeUpToMicroseconds(time.Now()).String())
 	meta.DataDir = dataDir
@@ -98,6 +141,19 @@ func createAndPushBackup(
 		tracelog.WarningLogger.Println(warning)
 	}
 	tracelog.ErrorLogger.FatalOnError(err)
+	if len(previousBackupName) > 0 && previousBackupSentinelDto.BackupStartLSN != nil {
+		backupName = backupName + "_D_" + utility.StripWalFileName(previousBackupName)
+	}
+	// backup name is known once the backup is started, it is checked before any data is read
+	tracelog.ErrorLogger.FatalOnError(CheckBackupIsNew(uploader.UploadingFolder, backupName))
+
+	if verifyPageChecksums || viper.GetBool(VerifyPageChecksumsSetting) {
+		if bundle.DataChecksums {
+			bundle.VerifyPageChecksums = true
+		} else {
+			tracelog.WarningLogger.Println("Data checksums are disabled in the cluster, page checksums will not be verified")
+		}
+	}
 
 	if len(previousBackupName) > 0 && previousBackupSentinelDto.BackupStartLSN != nil {
 		if *previousBackupSentinelDto.BackupFinishLSN > backupStartLSN {
@@ -107,37 +163,73 @@ func createAndPushBackup(
 
 			tracelog.ErrorLogger.FatalOnError(newBackupFromOtherBD())
 		}
-		if uploader.getUseWalDelta() {
+		if viper.GetBool(UsePtrackSetting) {
+			err = bundle.LoadPtrackDeltaMap(conn)
+			if err == nil {
+				tracelog.InfoLogger.Println("Successfully loaded ptrack delta map, delta backup will be made with provided delta map")
+			} else {
+				tracelog.WarningLogger.Printf("Error during loading ptrack delta map: '%v'. Fallback to full scan delta backup\n", err)
+			}
+		} else if uploader.getUseWalDelta() {
 			err = bundle.DownloadDeltaMap(folder.GetSubFolder(utility.WalPath), backupStartLSN)
 			if err == nil {
 				tracelog.InfoLogger.Println("Successfully loaded delta map, delta backup will be made with provided delta map")
 			} else {
 				tracelog.WarningLogger.Printf("Error during loading delta map: '%v'. Fallback to full scan delta backup\n", err)
 			}
+		} else if viper.GetBool(UseWalScanDeltaSetting) {
+			err = bundle.LoadWalScanDeltaMap(folder.GetSubFolder(utility.WalPath), backupStartLSN)
+			if err == nil {
+				tracelog.InfoLogger.Println("Successfully built delta map from WAL, delta backup will be made with provided delta map")
+			} else {
+				tracelog.WarningLogger.Printf("Error during scanning WAL for delta map: '%v'. Fallback to full scan delta backup\n", err)
+			}
 		}
-		backupName = backupName + "_D_" + utility.StripWalFileName(previousBackupName)
 	}
 
 	bundle.TarBallMaker = NewStorageTarBallMaker(backupName, uploader.Uploader)
 
+	snapshot, err := takeBackupSnapshot(archiveDirectory, backupName)
+	tracelog.ErrorLogger.FatalfOnError("Failed to take snapshot: %v\n", err)
+	if snapshot != nil {
+		bundle.useSnapshot(snapshot.snapshotDirectory)
+	}
+
 	// Start a new tar bundle, walk the archiveDirectory and upload everything there.
 	err = bundle.StartQueue()
 	tracelog.ErrorLogger.FatalOnError(err)
 	tracelog.InfoLogger.Println("Walking ...")
-	err = filepath.Walk(archiveDirectory, bundle.HandleWalkedFSObject)
+	err = filepath.Walk(bundle.ArchiveDirectory, bundle.HandleWalkedFSObject)
 	tracelog.ErrorLogger.FatalOnError(err)
 	err = bundle.FinishQueue()
 	tracelog.ErrorLogger.FatalOnError(err)
 	uncompressedSize := bundle.TarBall.Size()
+	var configFiles []string
+	if includeConfigFiles || viper.GetBool(BackupIncludeConfigSetting) {
+		configFiles, err = bundle.UploadConfigFiles(conn, uploader.Compressor.FileExtension())
+		tracelog.ErrorLogger.FatalfOnError("Failed to upload configuration files: %v\n", err)
+	}
 	compressedSize := atomic.LoadInt64(uploader.tarSize)
 	err = bundle.UploadPgControl(uploader.Compressor.FileExtension())
 	tracelog.ErrorLogger.FatalOnError(err)
+	if snapshot != nil {
+		// all files including pg_control are read, so the snapshot is not needed before the backup is stopped
+		err = snapshot.release()
+		tracelog.ErrorLogger.FatalOnError(err)
+	}
 	// Stops backup and write/upload postgres `backup_label` and `tablespace_map` Files
 	finishLsn, err := bundle.uploadLabelFiles(conn)
 	tracelog.ErrorLogger.FatalOnError(err)
 
 	timelineChanged := bundle.checkTimelineChanged(conn)
 
+	var standbyReplayLsn *uint64
+	if bundle.Replica {
+		replayLsn, err := bundle.readReplayLsn(conn)
+		tracelog.ErrorLogger.FatalOnError(err)
+		standbyReplayLsn = &replayLsn
+	}
+
 	// Wait for all uploads to finish.
 	uploader.finish()
 	if uploader.Failed.Load().(bool) {
@@ -168,11 +260,30 @@ func createAndPushBackup(
 	}
 
 	currentBackupSentinelDto.setFiles(bundle.getFiles())
+	currentBackupSentinelDto.TarFileSets = bundle.getTarFileSets()
 	currentBackupSentinelDto.BackupFinishLSN = &finishLsn
 	currentBackupSentinelDto.UserData = GetSentinelUserData()
 	currentBackupSentinelDto.SystemIdentifier = systemIdentifier
+	currentBackupSentinelDto.StandbyReplayLSN = standbyReplayLsn
+	currentBackupSentinelDto.DataChecksums = bundle.DataChecksums
+	currentBackupSentinelDto.PageChecksumsVerified = bundle.VerifyPageChecksums
+	if bundle.VerifyPageChecksums {
+		logCorruptBlocks(currentBackupSentinelDto.Files)
+	}
+	currentBackupSentinelDto.DatabaseOids = bundle.DatabaseOids
+	currentBackupSentinelDto.TablespaceOids = bundle.TablespaceOids
 	currentBackupSentinelDto.UncompressedSize = uncompressedSize
 	currentBackupSentinelDto.CompressedSize = compressedSize
+	currentBackupSentinelDto.TablespaceSizes = bundle.getTablespaceSizes()
+	currentBackupSentinelDto.FromSnapshot = snapshot != nil
+	if len(bundle.ExcludePatterns) > 0 {
+		currentBackupSentinelDto.ExcludePatterns = bundle.ExcludePatterns
+	}
+	currentBackupSentinelDto.ExcludedRelations = excludedRelations
+	currentBackupSentinelDto.ConfigFiles = configFiles
+	if currentBackupSentinelDto.IsIncremental() {
+		currentBackupSentinelDto.DeltaChainSize = previousBackupSentinelDto.chainSize() + compressedSize
+	}
 	// If pushing permanent delta backup, mark all previous backups permanent
 	// Do this before uploading current meta to ensure that backups are marked in increasing order
 	if isPermanent && currentBackupSentinelDto.IsIncremental() {
@@ -191,16 +302,18 @@ func createAndPushBackup(
 	}
 	// logging backup set name
 	tracelog.InfoLogger.Println("Wrote backup with name " + backupName)
-
+	return backupName
 }
 
 // TODO : unit tests
-// HandleBackupPush is invoked to perform a wal-g backup-push
-func HandleBackupPush(uploader *WalUploader, archiveDirectory string, isPermanent bool, isFullBackup bool) {
+// HandleBackupPush is invoked to perform a wal-g backup-push, it returns the name of the pushed backup
+func HandleBackupPush(uploader *WalUploader, archiveDirectory string,
+	isPermanent, isFullBackup, verifyPageChecksums, includeConfigFiles bool) string {
 	archiveDirectory = utility.ResolveSymlink(archiveDirectory)
-	maxDeltas, fromFull := getDeltaConfig()
+	maxDeltas, fromFull, maxChainSize := getDeltaConfig()
 	checkPgVersionAndPgControl(archiveDirectory)
-	var err error
+	err := runPushHook(BackupPushPreHookSetting, hookDataDirectoryEnv+"="+archiveDirectory)
+	tracelog.ErrorLogger.FatalOnError(err)
 	var previousBackupSentinelDto BackupSentinelDto
 	var previousBackupName string
 	incrementCount := 1
@@ -226,6 +339,10 @@ func HandleBackupPush(uploader *WalUploader, archiveDirectory string, isPermanen
 			if incrementCount > maxDeltas {
 				tracelog.InfoLogger.Println("Reached max delta steps. Doing full backup.")
 				previousBackupSentinelDto = BackupSentinelDto{}
+			} else if maxChainSize > 0 && previousBackupSentinelDto.chainSize() >= maxChainSize {
+				tracelog.InfoLogger.Printf("Delta chain size %d reached %s. Doing full backup.\n",
+					previousBackupSentinelDto.chainSize(), DeltaMaxChainSizeSetting)
+				previousBackupSentinelDto = BackupSentinelDto{}
 			} else if previousBackupSentinelDto.BackupStartLSN == nil {
 				tracelog.InfoLogger.Println("LATEST backup was made without support for delta feature. Fallback to full backup with LSN marker for future deltas.")
 			} else {
@@ -247,7 +364,30 @@ func HandleBackupPush(uploader *WalUploader, archiveDirectory string, isPermanen
 		tracelog.InfoLogger.Println("Doing full backup.")
 	}
 
-	createAndPushBackup(uploader, archiveDirectory, utility.BaseBackupPath, previousBackupName, previousBackupSentinelDto, isPermanent, false, incrementCount)
+	backupName := createAndPushBackup(uploader, archiveDirectory, utility.BaseBackupPath, previousBackupName, previousBackupSentinelDto, isPermanent, false, incrementCount, nil,
+		verifyPageChecksums, includeConfigFiles)
+	err = runPushHook(BackupPushPostHookSetting,
+		hookDataDirectoryEnv+"="+archiveDirectory, hookBackupNameEnv+"="+backupName)
+	tracelog.ErrorLogger.FatalOnError(err)
+	return backupName
+}
+
+// logCorruptBlocks warns about files with corrupt pages, so they are noticed before the backup is needed
+func logCorruptBlocks(files BackupFileList) {
+	corruptFileCount := 0
+	for fileName, description := range files {
+		if description.CorruptBlocks == nil {
+			continue
+		}
+		corruptFileCount++
+		tracelog.WarningLogger.Printf("File '%s' has %d blocks with wrong checksums, some of them: %v\n",
+			fileName, description.CorruptBlocks.CorruptBlocksCount, description.CorruptBlocks.SomeCorruptBlocks)
+	}
+	if corruptFileCount > 0 {
+		tracelog.WarningLogger.Printf("Page checksum verification found corruption in %d files\n", corruptFileCount)
+	} else {
+		tracelog.InfoLogger.Println("Page checksum verification found no corruption")
+	}
 }
 
 // TODO : unit tests
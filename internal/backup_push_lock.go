@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const BackupPushLockName = "backup_push.lock"
+
+type BackupPushLockedError struct {
+	error
+}
+
+func newBackupPushLockedError(info BackupPushLockInfo) BackupPushLockedError {
+	return BackupPushLockedError{errors.Errorf(
+		"Another backup-push is running: lock is held by pid %d on %s since %s until %s",
+		info.Pid, info.Hostname, info.AcquiredAt.Format(time.RFC3339), info.ExpiresAt.Format(time.RFC3339))}
+}
+
+func (err BackupPushLockedError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+type BackupPushLockLostError struct {
+	error
+}
+
+func newBackupPushLockLostError(reason string) BackupPushLockLostError {
+	return BackupPushLockLostError{errors.Errorf("Backup-push lock is lost: %s, the backup is cancelled", reason)}
+}
+
+func (err BackupPushLockLostError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// BackupPushLockInfo is stored in the lock object, so it is clear who holds the lock
+type BackupPushLockInfo struct {
+	Owner      string    `json:"owner"`
+	Hostname   string    `json:"hostname"`
+	Pid        int       `json:"pid"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// BackupPushLock prevents concurrent backup-push into the same storage prefix.
+// Storages have no atomic conditional writes, so the lock is best effort: the lock object is written
+// and read back to detect a concurrent writer. The lock is renewed while the backup is running,
+// if it is taken by another process or can't be renewed before it expires, the backup is cancelled.
+// The lock is released by the caller when the backup is done, the lock of a backup-push
+// which exited on a fatal error or crashed expires after TTL.
+type BackupPushLock struct {
+	folder  storage.Folder
+	info    BackupPushLockInfo
+	ttl     time.Duration
+	stop    chan struct{}
+	stopped sync.WaitGroup
+	// onLost cancels the backup when the lock is lost
+	onLost func(err error)
+}
+
+// ConfigureBackupPushLock acquires the lock if WALG_BACKUP_PUSH_LOCK is set, otherwise nil is returned
+func ConfigureBackupPushLock(folder storage.Folder) (*BackupPushLock, error) {
+	if !viper.GetBool(BackupPushLockSetting) {
+		return nil, nil
+	}
+	ttl, err := GetDurationSetting(BackupPushLockTTLSetting)
+	if err != nil {
+		return nil, err
+	}
+	return AcquireBackupPushLock(folder, ttl)
+}
+
+// AcquireBackupPushLock takes the lock in the root of the storage prefix and starts its renewal.
+// If the lock is lost, the process exits with a fatal error.
+func AcquireBackupPushLock(folder storage.Folder, ttl time.Duration) (*BackupPushLock, error) {
+	return acquireBackupPushLock(folder, ttl, func(err error) {
+		tracelog.ErrorLogger.FatalError(err)
+	})
+}
+
+func acquireBackupPushLock(folder storage.Folder, ttl time.Duration, onLost func(err error)) (*BackupPushLock, error) {
+	if ttl <= 0 {
+		return nil, errors.Errorf("positive number of seconds expected for %s setting but given %v",
+			BackupPushLockTTLSetting, ttl)
+	}
+	hostname, _ := os.Hostname()
+	now := utility.TimeNowCrossPlatformUTC()
+	lock := &BackupPushLock{
+		folder: folder,
+		info: BackupPushLockInfo{
+			Owner:      fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), now.UnixNano()),
+			Hostname:   hostname,
+			Pid:        os.Getpid(),
+			AcquiredAt: now,
+		},
+		ttl:    ttl,
+		stop:   make(chan struct{}),
+		onLost: onLost,
+	}
+
+	current, exists, err := lock.read()
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		if now.Before(current.ExpiresAt) {
+			return nil, newBackupPushLockedError(current)
+		}
+		tracelog.WarningLogger.Printf("Taking over expired backup-push lock of pid %d on %s\n",
+			current.Pid, current.Hostname)
+	}
+	if err = lock.write(); err != nil {
+		return nil, err
+	}
+	current, exists, err = lock.read()
+	if err != nil {
+		return nil, err
+	}
+	if !exists || current.Owner != lock.info.Owner {
+		return nil, newBackupPushLockedError(current)
+	}
+
+	tracelog.InfoLogger.Printf("Acquired backup-push lock until %s\n", lock.info.ExpiresAt.Format(time.RFC3339))
+	lock.stopped.Add(1)
+	go lock.renew()
+	return lock, nil
+}
+
+// Release stops renewal and deletes the lock object if it is still owned by this process
+func (lock *BackupPushLock) Release() error {
+	close(lock.stop)
+	lock.stopped.Wait()
+	return lock.deleteIfOwned()
+}
+
+func (lock *BackupPushLock) deleteIfOwned() error {
+	current, exists, err := lock.read()
+	if err != nil {
+		return err
+	}
+	if !exists || current.Owner != lock.info.Owner {
+		tracelog.WarningLogger.Println("Backup-push lock was taken by another process, it is not released")
+		return nil
+	}
+	return lock.folder.DeleteObjects([]string{BackupPushLockName})
+}
+
+// renew extends the lock while the backup is running. The backup is cancelled if another process took the lock,
+// or if the lock expired since it failed to be renewed, so two backups never run without a lock.
+func (lock *BackupPushLock) renew() {
+	defer lock.stopped.Done()
+	ticker := time.NewTicker(lock.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lock.stop:
+			return
+		case <-ticker.C:
+			current, exists, err := lock.read()
+			if err == nil && exists && current.Owner != lock.info.Owner {
+				lock.onLost(newBackupPushLockLostError(
+					fmt.Sprintf("it was taken by pid %d on %s", current.Pid, current.Hostname)))
+				return
+			}
+			if err == nil {
+				err = lock.write()
+			}
+			if err == nil {
+				continue
+			}
+			tracelog.WarningLogger.Printf("Failed to renew backup-push lock: %v\n", err)
+			if !utility.TimeNowCrossPlatformUTC().Before(lock.info.ExpiresAt) {
+				lock.onLost(newBackupPushLockLostError(fmt.Sprintf("it expired at %s and failed to be renewed: %v",
+					lock.info.ExpiresAt.Format(time.RFC3339), err)))
+				return
+			}
+		}
+	}
+}
+
+// write puts the lock extended by TTL, expiration time is updated only if the lock is written
+func (lock *BackupPushLock) write() error {
+	info := lock.info
+	info.ExpiresAt = utility.TimeNowCrossPlatformUTC().Add(lock.ttl)
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	err = lock.folder.PutObject(BackupPushLockName, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to write backup-push lock")
+	}
+	lock.info.ExpiresAt = info.ExpiresAt
+	return nil
+}
+
+func (lock *BackupPushLock) read() (BackupPushLockInfo, bool, error) {
+	var info BackupPushLockInfo
+	reader, exists, err := TryDownloadFile(lock.folder, BackupPushLockName)
+	if err != nil || !exists {
+		return info, false, errors.Wrap(err, "failed to read backup-push lock")
+	}
+	defer utility.LoggedClose(reader, "")
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return info, false, errors.Wrap(err, "failed to read backup-push lock")
+	}
+	err = json.Unmarshal(data, &info)
+	return info, true, errors.Wrap(err, "failed to parse backup-push lock")
+}
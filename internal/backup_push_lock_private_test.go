@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/storages/memory"
+)
+
+func TestBackupPushLock_CancelsBackupWhenLockIsTaken(t *testing.T) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	lost := make(chan error, 1)
+	lock, err := acquireBackupPushLock(folder, 30*time.Millisecond, func(err error) {
+		lost <- err
+	})
+	require.NoError(t, err)
+	defer lock.Release()
+
+	other, err := json.Marshal(BackupPushLockInfo{Owner: "other", Hostname: "other-host", Pid: 42,
+		ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	require.NoError(t, folder.PutObject(BackupPushLockName, bytes.NewReader(other)))
+
+	select {
+	case err = <-lost:
+		assert.IsType(t, BackupPushLockLostError{}, err)
+	case <-time.After(time.Second):
+		t.Fatal("backup was not cancelled when the lock was taken")
+	}
+}
@@ -0,0 +1,57 @@
+package internal_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func TestBackupPushLock_PreventsConcurrentPush(t *testing.T) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+
+	lock, err := internal.AcquireBackupPushLock(folder, time.Hour)
+	require.NoError(t, err)
+	_, err = internal.AcquireBackupPushLock(folder, time.Hour)
+	assert.IsType(t, internal.BackupPushLockedError{}, err)
+
+	require.NoError(t, lock.Release())
+	exists, err := folder.Exists(internal.BackupPushLockName)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	lock, err = internal.AcquireBackupPushLock(folder, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, lock.Release())
+}
+
+func TestBackupPushLock_TakesOverExpiredLock(t *testing.T) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	expired, err := json.Marshal(internal.BackupPushLockInfo{
+		Owner:     "crashed",
+		Hostname:  "other-host",
+		Pid:       42,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+	require.NoError(t, folder.PutObject(internal.BackupPushLockName, bytes.NewReader(expired)))
+
+	lock, err := internal.AcquireBackupPushLock(folder, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, lock.Release())
+}
+
+func TestBackupPushLock_RejectsNonPositiveTTL(t *testing.T) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+
+	_, err := internal.AcquireBackupPushLock(folder, 0)
+	assert.Error(t, err)
+	exists, err := folder.Exists(internal.BackupPushLockName)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
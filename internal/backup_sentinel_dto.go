@@ -19,10 +19,29 @@ type BackupSentinelDto struct {
 	PgVersion        int     `json:"PgVersion"`
 	BackupFinishLSN  *uint64 `json:"FinishLSN"`
 	SystemIdentifier *uint64 `json:"SystemIdentifier,omitempty"`
+	StandbyReplayLSN *uint64 `json:"StandbyReplayLSN,omitempty"`
+	DataChecksums    bool    `json:"DataChecksums,omitempty"`
+	// PageChecksumsVerified means that pages of files sent in full were verified, see CorruptBlocks of Files
+	PageChecksumsVerified bool `json:"PageChecksumsVerified,omitempty"`
+
+	DatabaseOids   map[string]uint32 `json:"DatabaseOids,omitempty"`
+	TablespaceOids map[string]uint32 `json:"TablespaceOids,omitempty"`
 
 	UncompressedSize int64           `json:"UncompressedSize"`
 	CompressedSize   int64           `json:"CompressedSize"`
+	DeltaChainSize   int64           `json:"DeltaChainSize,omitempty"`
 	TablespaceSpec   *TablespaceSpec `json:"Spec"`
+	// TablespaceSizes are uncompressed sizes of files of tablespaces by their oids, pg_default for the data directory
+	TablespaceSizes map[string]int64 `json:"TablespaceSizes,omitempty"`
+
+	// ExcludePatterns are patterns of paths intentionally omitted from the backup
+	ExcludePatterns []string `json:"ExcludePatterns,omitempty"`
+	// ExcludedRelations are paths of files of relations intentionally omitted from the backup, by relation name
+	ExcludedRelations map[string][]string `json:"ExcludedRelations,omitempty"`
+	// FromSnapshot means that files were read from a snapshot of the data directory taken during the backup
+	FromSnapshot bool `json:"FromSnapshot,omitempty"`
+	// ConfigFiles are absolute paths of configuration files outside of the data directory, stored separately
+	ConfigFiles []string `json:"ConfigFiles,omitempty"`
 
 	UserData interface{} `json:"UserData,omitempty"`
 }
@@ -56,6 +75,15 @@ func (dto *BackupSentinelDto) setFiles(p *sync.Map) {
 	})
 }
 
+// chainSize returns cumulative compressed size of backups needed to restore this one
+func (dto *BackupSentinelDto) chainSize() int64 {
+	if dto.DeltaChainSize != 0 {
+		return dto.DeltaChainSize
+	}
+	// full backups and deltas made before chain size tracking
+	return dto.CompressedSize
+}
+
 // TODO : unit tests
 // TODO : get rid of panic here
 // IsIncremental checks that sentinel represents delta backup
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// Environment variables passed to snapshot commands
+const (
+	snapshotDataDirectoryEnv = "WALG_SNAPSHOT_DATA_DIRECTORY"
+	snapshotBackupNameEnv    = "WALG_SNAPSHOT_BACKUP_NAME"
+	snapshotDirectoryEnv     = "WALG_SNAPSHOT_DIRECTORY"
+)
+
+// backupSnapshot is a filesystem or volume snapshot of the data directory taken after the start of the backup.
+// Files are read from the snapshot, so long reads don't compete with the live volume.
+type backupSnapshot struct {
+	dataDirectory     string
+	backupName        string
+	snapshotDirectory string
+}
+
+// takeBackupSnapshot runs WALG_SNAPSHOT_COMMAND, which must snapshot the data directory, mount the snapshot
+// and print the path of the data directory in the mounted snapshot as the last line of its output.
+// Nil is returned if the command is not configured.
+func takeBackupSnapshot(dataDirectory, backupName string) (*backupSnapshot, error) {
+	if _, ok := GetSetting(SnapshotCommandSetting); !ok {
+		return nil, nil
+	}
+	snapshot := &backupSnapshot{dataDirectory: dataDirectory, backupName: backupName}
+	cmd, err := GetCommandSetting(SnapshotCommandSetting)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Env = snapshot.environment()
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	tracelog.InfoLogger.Printf("Taking snapshot of %s\n", dataDirectory)
+	if err = cmd.Run(); err != nil {
+		return nil, errors.Wrap(err, "snapshot command failed")
+	}
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	snapshot.snapshotDirectory = strings.TrimSpace(lines[len(lines)-1])
+	if snapshot.snapshotDirectory == "" {
+		return nil, errors.New("snapshot command did not print the path of the data directory in the snapshot")
+	}
+	if info, err := os.Stat(snapshot.snapshotDirectory); err != nil || !info.IsDir() {
+		return nil, errors.Errorf("snapshot directory '%s' is not available", snapshot.snapshotDirectory)
+	}
+	tracelog.InfoLogger.Printf("Backup is read from snapshot %s\n", snapshot.snapshotDirectory)
+	return snapshot, nil
+}
+
+// release runs WALG_SNAPSHOT_RELEASE_COMMAND, which should unmount and delete the snapshot
+func (snapshot *backupSnapshot) release() error {
+	if _, ok := GetSetting(SnapshotReleaseCmdSetting); !ok {
+		return nil
+	}
+	cmd, err := GetCommandSetting(SnapshotReleaseCmdSetting)
+	if err != nil {
+		return err
+	}
+	cmd.Env = snapshot.environment()
+	cmd.Stdout = os.Stdout
+	return errors.Wrap(cmd.Run(), "snapshot release command failed")
+}
+
+func (snapshot *backupSnapshot) environment() []string {
+	env := append(os.Environ(),
+		snapshotDataDirectoryEnv+"="+snapshot.dataDirectory,
+		snapshotBackupNameEnv+"="+snapshot.backupName)
+	if snapshot.snapshotDirectory != "" {
+		env = append(env, snapshotDirectoryEnv+"="+snapshot.snapshotDirectory)
+	}
+	return env
+}
+
+// useSnapshot makes the bundle read files from the data directory in the snapshot.
+// Tablespaces are still read from their locations, unless symlinks in the snapshot point to another snapshot.
+func (bundle *Bundle) useSnapshot(snapshotDirectory string) {
+	bundle.ArchiveDirectory = utility.ResolveSymlink(snapshotDirectory)
+	bundle.TablespaceSpec = NewTablespaceSpec(bundle.ArchiveDirectory)
+}
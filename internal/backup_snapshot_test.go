@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTakeBackupSnapshot_NotConfigured(t *testing.T) {
+	snapshot, err := takeBackupSnapshot("/var/lib/postgresql/data", "base_000000010000000000000002")
+	assert.NoError(t, err)
+	assert.Nil(t, snapshot)
+}
+
+func TestTakeBackupSnapshot_UsesLastLineOfOutput(t *testing.T) {
+	snapshotRoot, err := ioutil.TempDir("", "snapshot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(snapshotRoot)
+	snapshotDirectory := filepath.Join(snapshotRoot, "main")
+	assert.NoError(t, os.Mkdir(snapshotDirectory, 0700))
+
+	viper.Set(SnapshotCommandSetting, "echo snapshot of $WALG_SNAPSHOT_BACKUP_NAME created; echo "+snapshotDirectory)
+	defer viper.Set(SnapshotCommandSetting, nil)
+	snapshot, err := takeBackupSnapshot("/var/lib/postgresql/data", "base_000000010000000000000002")
+	assert.NoError(t, err)
+	assert.Equal(t, snapshotDirectory, snapshot.snapshotDirectory)
+
+	released := filepath.Join(snapshotRoot, "released")
+	viper.Set(SnapshotReleaseCmdSetting, "echo $WALG_SNAPSHOT_DIRECTORY > "+released)
+	defer viper.Set(SnapshotReleaseCmdSetting, nil)
+	assert.NoError(t, snapshot.release())
+	content, err := ioutil.ReadFile(released)
+	assert.NoError(t, err)
+	assert.Equal(t, snapshotDirectory+"\n", string(content))
+}
+
+func TestTakeBackupSnapshot_MissingDirectory(t *testing.T) {
+	viper.Set(SnapshotCommandSetting, "echo /nonexistent/snapshot/main")
+	defer viper.Set(SnapshotCommandSetting, nil)
+	_, err := takeBackupSnapshot("/var/lib/postgresql/data", "base_000000010000000000000002")
+	assert.Error(t, err)
+}
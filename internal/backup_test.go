@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/testtools"
@@ -82,6 +83,21 @@ func TestCheckExistenceWhenBackupNotExists(t *testing.T) {
 	assert.False(t, exists)
 }
 
+func TestCheckBackupIsNew_DeterministicNaming(t *testing.T) {
+	folder := testtools.CreateMockStorageFolder().GetSubFolder(utility.BaseBackupPath)
+	viper.Set(internal.DeterministicNamingSetting, true)
+	defer viper.Set(internal.DeterministicNamingSetting, false)
+
+	err := internal.CheckBackupIsNew(folder, "base_000")
+	assert.IsType(t, internal.BackupAlreadyExistsError{}, err)
+	assert.NoError(t, internal.CheckBackupIsNew(folder, "base_321"))
+}
+
+func TestCheckBackupIsNew_IgnoresExistingWithoutDeterministicNaming(t *testing.T) {
+	folder := testtools.CreateMockStorageFolder().GetSubFolder(utility.BaseBackupPath)
+	assert.NoError(t, internal.CheckBackupIsNew(folder, "base_000"))
+}
+
 func TestGetTarNames(t *testing.T) {
 	folder := testtools.CreateMockStorageFolder()
 	backup := internal.NewBackup(folder.GetSubFolder(utility.BaseBackupPath), "base_456")
@@ -18,8 +18,11 @@ func NewNetworkLimitReader(r io.Reader) io.Reader {
 	return limited.NewReader(r, NetworkLimiter)
 }
 
-// NewDiskLimitReader returns a reader that is rate limited by disk limiter
+// NewDiskLimitReader returns a reader that is rate limited by disk limiter and paused by load governor
 func NewDiskLimitReader(r io.Reader) io.Reader {
+	if LoadGovernor != nil {
+		r = &governedReader{r, LoadGovernor}
+	}
 	if DiskLimiter == nil {
 		return r
 	}
@@ -3,7 +3,6 @@ package internal
 import (
 	"context"
 	"io/ioutil"
-	"os"
 	"path/filepath"
 	"strings"
 	"sync/atomic"
@@ -60,6 +59,9 @@ type BgUploader struct {
 	// started tracks filenames of ongoing and complete uploads to avoid
 	// repeating work
 	started map[string]struct{}
+
+	// draining is set to stop scanning once there are no new files to upload
+	draining int32
 }
 
 // NewBgUploader creates a new BgUploader which looks for WAL files adjacent to
@@ -94,6 +96,16 @@ func (b *BgUploader) Start() {
 	go b.scanAndProcessFiles()
 }
 
+// StopWhenDrained waits until all WAL files ready for upload are uploaded or maxNumUploaded is reached,
+// then stops pipeline. It allows to upload all ready WAL files in one wal-push batch.
+func (b *BgUploader) StopWhenDrained() {
+	if b.maxParallelWorkers >= 1 && b.maxNumUploaded >= 1 {
+		atomic.StoreInt32(&b.draining, 1)
+		<-b.ctx.Done()
+	}
+	b.Stop()
+}
+
 // Stop pipeline. Stop can be safely called concurrently and repeatedly.
 func (b *BgUploader) Stop() {
 	// Send signal to stop scanning for and uploading new files
@@ -104,27 +116,33 @@ func (b *BgUploader) Stop() {
 
 // scanAndProcessFiles scans directory for WAL segments and attempts to upload them. It
 // makes best effort attempts to avoid duplicating work (re-uploading files).
+// When draining, it stops after a scan which found no new files to upload.
 func (b *BgUploader) scanAndProcessFiles() {
-	fileChan := make(chan os.FileInfo)
-	defer close(fileChan)
-	go b.processFiles(fileChan)
-
 	for {
 		files, err := ioutil.ReadDir(filepath.Join(b.dir, archiveStatusDir))
 		if err != nil {
 			tracelog.ErrorLogger.Print("Error of parallel upload: ", err)
+			b.cancelFunc()
 			return
 		}
 
+		numStarted := 0
 		for _, f := range files {
-			select {
-			case <-b.ctx.Done():
+			if b.ctx.Err() != nil {
 				return
-			case fileChan <- f:
+			}
+			if b.processFile(f.Name()) {
+				numStarted++
 			}
 		}
 
-		// Sleep 5 seconds before scanning filesystem again. Exit if
+		if numStarted == 0 && atomic.LoadInt32(&b.draining) == 1 {
+			tracelog.DebugLogger.Print("No more WAL files ready for upload")
+			b.cancelFunc()
+			return
+		}
+
+		// Sleep before scanning filesystem again. Exit if
 		// BgUploader.Stop() has been invoked.
 		select {
 		case <-b.ctx.Done():
@@ -132,46 +150,36 @@ func (b *BgUploader) scanAndProcessFiles() {
 		case <-time.After(pollPauseDuration):
 		}
 	}
-
 }
 
-// processFiles reads from input channel and uploads relevant WAL files. Exits
-// when the input channel is closed. processFiles also tracks number of
+// processFile uploads relevant WAL file in background. It tracks number of
 // successfully uploaded WAL files and signals to BgUploader when total count
 // has exceeded maxNumUploaded. Concurrency is controlled by semaphore in
-// BgUploader.
+// BgUploader. Returns true if the upload was started.
 //
-// This function should only be invoked once (in scanFiles)
-func (b *BgUploader) processFiles(fileChan <-chan os.FileInfo) {
-	var numUploaded int32 = 0
-	for {
-		f, ok := <-fileChan
-		if !ok {
-			break
-		}
-
-		name := f.Name()
-
-		if b.shouldSkipFile(name) {
-			continue
-		}
-		if _, ok := b.started[name]; ok {
-			continue
-		}
+// This function should only be invoked by scanAndProcessFiles
+func (b *BgUploader) processFile(name string) bool {
+	if b.shouldSkipFile(name) {
+		return false
+	}
+	if _, ok := b.started[name]; ok {
+		return false
+	}
 
-		b.started[name] = struct{}{}
-		if err := b.workerCountSem.Acquire(b.ctx, 1); err == nil {
-			go func() {
-				uploadedFile := b.upload(name)
-				b.workerCountSem.Release(1)
-				if uploadedFile {
-					if atomic.AddInt32(&numUploaded, 1) >= b.maxNumUploaded {
-						b.cancelFunc()
-					}
-				}
-			}()
-		}
+	b.started[name] = struct{}{}
+	if err := b.workerCountSem.Acquire(b.ctx, 1); err != nil {
+		return false
 	}
+	go func() {
+		uploadedFile := b.upload(name)
+		b.workerCountSem.Release(1)
+		if uploadedFile {
+			if atomic.AddInt32(&b.numUploaded, 1) >= b.maxNumUploaded {
+				b.cancelFunc()
+			}
+		}
+	}()
+	return true
 }
 
 // shouldSkipFile returns true when the file in question has either already been
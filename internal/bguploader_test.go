@@ -113,6 +113,29 @@ func TestBackgroundWALUpload(t *testing.T) {
 	}
 }
 
+func TestBackgroundWALUploadDrain(t *testing.T) {
+	defer cleanup(t, internal.GetDataFolderPath())
+
+	dir, a := setupArchiveStatus(t, "")
+	for i := 0; i < 20; i++ {
+		addTestDataFile(t, dir, i)
+	}
+	defer cleanup(t, dir)
+
+	tu := testtools.NewMockWalUploader(false, false)
+	fakeASM := internal.NewFakeASM()
+	tu.ArchiveStatusManager = fakeASM
+	bu := internal.NewBgUploader(a, 3, 32, tu, false)
+
+	bu.Start()
+	bu.StopWhenDrained()
+
+	for i := 0; i < 20; i++ {
+		bname := testFilename(i)
+		assert.True(t, fakeASM.IsWalAlreadyUploaded(bname), bname+" was not marked as uploaded")
+	}
+}
+
 func setupArchiveStatus(t *testing.T, dir string) (string, string) {
 	cwd, err := filepath.Abs("./")
 	if err != nil {
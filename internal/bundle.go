@@ -2,7 +2,10 @@ package internal
 
 import (
 	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
@@ -72,11 +75,27 @@ type Bundle struct {
 	Crypter            crypto.Crypter
 	Timeline           uint32
 	Replica            bool
+	DataChecksums      bool
+	DatabaseOids       map[string]uint32
+	TablespaceOids     map[string]uint32
 	IncrementFromLsn   *uint64
 	IncrementFromFiles BackupFileList
 	DeltaMap           PagedFileDeltaMap
-	TablespaceSpec     TablespaceSpec
-
+	// ReplicaDivergedBlocks are blocks changed on a stale replica, they are sent by catchup-push regardless of LSN
+	ReplicaDivergedBlocks PagedFileDeltaMap
+	TablespaceSpec        TablespaceSpec
+	// ExcludePatterns are glob patterns of paths skipped in addition to ExcludedFilenames
+	ExcludePatterns []string
+	// ExcludedRelationFiles are paths of files of excluded relations, their segments and forks are skipped too
+	ExcludedRelationFiles map[string]bool
+	// VerifyPageChecksums enables verification of pages of files sent in full, corrupt blocks are recorded in Files
+	VerifyPageChecksums bool
+	// SplitLargeFiles enables splitting of files bigger than TarSizeThreshold between tarballs
+	SplitLargeFiles bool
+	// StoreFileChecksums enables recording of checksums of files sent in full, so fetch may skip identical local files
+	StoreFileChecksums bool
+
+	backupStartLsn   uint64
 	tarballQueue     chan TarBall
 	uploadQueue      chan TarBall
 	parallelTarballs int
@@ -85,6 +104,12 @@ type Bundle struct {
 	started          bool
 	forceIncremental bool
 
+	tablespaceSizes      map[string]int64
+	tablespaceSizesMutex sync.Mutex
+
+	tarFileSets      map[string][]string
+	tarFileSetsMutex sync.Mutex
+
 	Files *sync.Map
 }
 
@@ -103,6 +128,8 @@ func newBundle(
 		Files:              &sync.Map{},
 		TablespaceSpec:     NewTablespaceSpec(archiveDirectory),
 		forceIncremental:   forceIncremental,
+		SplitLargeFiles:    viper.GetBool(TarSplitLargeFilesSetting),
+		StoreFileChecksums: viper.GetBool(BackupFileChecksumsSetting),
 	}
 }
 
@@ -112,6 +139,68 @@ func (bundle *Bundle) getFileRelPath(fileAbsPath string) string {
 
 func (bundle *Bundle) getFiles() *sync.Map { return bundle.Files }
 
+// addTablespaceSize accounts packed bytes of the file, so backup-fetch can report progress of each tablespace
+func (bundle *Bundle) addTablespaceSize(fileRelPath string, size int64) {
+	bundle.tablespaceSizesMutex.Lock()
+	defer bundle.tablespaceSizesMutex.Unlock()
+	if bundle.tablespaceSizes == nil {
+		bundle.tablespaceSizes = make(map[string]int64)
+	}
+	bundle.tablespaceSizes[getFileTablespace(fileRelPath)] += size
+}
+
+// addTarFile records the file packed into the tarball, so backup-fetch knows contents of tarballs without reading them
+func (bundle *Bundle) addTarFile(tarBall TarBall, fileRelPath string) {
+	bundle.tarFileSetsMutex.Lock()
+	defer bundle.tarFileSetsMutex.Unlock()
+	if bundle.tarFileSets == nil {
+		bundle.tarFileSets = make(map[string][]string)
+	}
+	bundle.tarFileSets[tarBall.Name()] = append(bundle.tarFileSets[tarBall.Name()], fileRelPath)
+}
+
+func (bundle *Bundle) getTarFileSets() map[string][]string {
+	bundle.tarFileSetsMutex.Lock()
+	defer bundle.tarFileSetsMutex.Unlock()
+	tarFileSets := make(map[string][]string, len(bundle.tarFileSets))
+	for tarName, files := range bundle.tarFileSets {
+		tarFileSets[tarName] = append([]string(nil), files...)
+	}
+	return tarFileSets
+}
+
+func (bundle *Bundle) getTablespaceSizes() map[string]int64 {
+	bundle.tablespaceSizesMutex.Lock()
+	defer bundle.tablespaceSizesMutex.Unlock()
+	sizes := make(map[string]int64, len(bundle.tablespaceSizes))
+	for tablespace, size := range bundle.tablespaceSizes {
+		sizes[tablespace] = size
+	}
+	return sizes
+}
+
+// isExcludedByPattern checks the path relative to archive directory against ExcludePatterns.
+func (bundle *Bundle) isExcludedByPattern(fileRelPath string) bool {
+	return matchesExcludePatterns(bundle.ExcludePatterns, fileRelPath)
+}
+
+// matchesExcludePatterns checks the path relative to data directory against exclude patterns.
+// Patterns containing a separator are matched against the whole relative path, others against the file name.
+func matchesExcludePatterns(patterns []string, fileRelPath string) bool {
+	fileRelPath = strings.TrimPrefix(fileRelPath, utility.PathSeparator)
+	for _, pattern := range patterns {
+		name := filepath.Base(fileRelPath)
+		if strings.Contains(pattern, utility.PathSeparator) {
+			name = fileRelPath
+			pattern = strings.Trim(pattern, utility.PathSeparator)
+		}
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
 func (bundle *Bundle) StartQueue() error {
 	if bundle.started {
 		panic("Trying to start already started Queue")
@@ -237,6 +326,15 @@ func (bundle *Bundle) checkTimelineChanged(conn *pgx.Conn) bool {
 	return false
 }
 
+// readReplayLsn returns the last WAL location replayed by standby
+func (bundle *Bundle) readReplayLsn(conn *pgx.Conn) (uint64, error) {
+	queryRunner, err := newPgQueryRunner(conn)
+	if err != nil {
+		return 0, errors.Wrap(err, "ReadReplayLsn: Failed to build query runner.")
+	}
+	return queryRunner.getReplayLsn()
+}
+
 // TODO : unit tests
 // StartBackup starts a non-exclusive base backup immediately. When finishing the backup,
 // `backup_label` and `tablespace_map` contents are not immediately written to
@@ -248,12 +346,33 @@ func (bundle *Bundle) StartBackup(conn *pgx.Conn, backup string) (backupName str
 	if err != nil {
 		return "", 0, 0, "", nil, errors.Wrap(err, "StartBackup: Failed to build query runner.")
 	}
+	maxReplayLag, err := GetDurationSetting(StandbyMaxReplayLagSetting)
+	if err != nil {
+		return "", 0, queryRunner.Version, "", queryRunner.SystemIdentifier, err
+	}
+	err = queryRunner.checkStandby(maxReplayLag)
+	if err != nil {
+		return "", 0, queryRunner.Version, "", queryRunner.SystemIdentifier, err
+	}
+	bundle.DataChecksums, err = queryRunner.getDataChecksums()
+	if err != nil {
+		tracelog.WarningLogger.Printf("Couldn't check if data checksums are enabled because of error: '%v'\n", err)
+	}
+	bundle.DatabaseOids, err = queryRunner.getDatabaseOids()
+	if err != nil {
+		tracelog.WarningLogger.Printf("Couldn't get database oids because of error: '%v'\n", err)
+	}
+	bundle.TablespaceOids, err = queryRunner.getTablespaceOids()
+	if err != nil {
+		tracelog.WarningLogger.Printf("Couldn't get tablespace oids because of error: '%v'\n", err)
+	}
 	name, lsnStr, bundle.Replica, dataDir, err = queryRunner.startBackup(backup)
 
 	if err != nil {
 		return "", 0, queryRunner.Version, "", queryRunner.SystemIdentifier, err
 	}
 	lsn, err = pgx.ParseLSN(lsnStr)
+	bundle.backupStartLsn = lsn
 
 	if bundle.Replica {
 		name, bundle.Timeline, err = getWalFilename(lsn, conn)
@@ -339,15 +458,29 @@ func (bundle *Bundle) HandleWalkedFSObject(path string, info os.FileInfo, err er
 // Does not follow symlinks (it seems like it does). If file is in ExcludedFilenames, will not be included
 // in the final tarball. EXCLUDED directories are created
 // but their contents are not written to local disk.
+// Paths matching ExcludePatterns are skipped completely.
 func (bundle *Bundle) handleTar(path string, info os.FileInfo) error {
 	fileName := info.Name()
 	_, excluded := ExcludedFilenames[fileName]
 	isDir := info.IsDir()
 
+	if bundle.isExcludedByPattern(bundle.getFileRelPath(path)) {
+		tracelog.DebugLogger.Printf("Skipped %s due to exclude patterns\n", path)
+		if isDir {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+
 	if excluded && !isDir {
 		return nil
 	}
 
+	if !isDir && isExcludedRelationFile(bundle.ExcludedRelationFiles, bundle.getFileRelPath(path)) {
+		tracelog.DebugLogger.Printf("Skipped %s of excluded relation\n", path)
+		return nil
+	}
+
 	fileInfoHeader, err := tar.FileInfoHeader(info, fileName)
 	if err != nil {
 		return errors.Wrap(err, "handleTar: could not grab header info")
@@ -373,6 +506,11 @@ func (bundle *Bundle) handleTar(path string, info os.FileInfo) error {
 			return nil
 		}
 
+		if bundle.shouldSplitFile(info, path, wasInBase) {
+			bundle.packLargeFile(path, info, fileInfoHeader)
+			return nil
+		}
+
 		tarBall := bundle.Deque()
 		tarBall.SetUp(bundle.Crypter)
 		go func() {
@@ -490,6 +628,7 @@ func (bundle *Bundle) uploadLabelFiles(conn *pgx.Conn) (uint64, error) {
 	if err != nil {
 		return 0, errors.Wrapf(err, "UploadLabelFiles: failed to put %s to tar", labelHeader.Name)
 	}
+	bundle.addTarFile(tarBall, labelHeader.Name)
 	tracelog.InfoLogger.Println(labelHeader.Name)
 
 	offsetMapHeader := &tar.Header{
@@ -503,6 +642,7 @@ func (bundle *Bundle) uploadLabelFiles(conn *pgx.Conn) (uint64, error) {
 	if err != nil {
 		return 0, errors.Wrapf(err, "UploadLabelFiles: failed to put %s to tar", offsetMapHeader.Name)
 	}
+	bundle.addTarFile(tarBall, offsetMapHeader.Name)
 	tracelog.InfoLogger.Println(offsetMapHeader.Name)
 
 	err = tarBall.CloseTar()
@@ -520,6 +660,17 @@ func (bundle *Bundle) getDeltaBitmapFor(filePath string) (*roaring.Bitmap, error
 	return bundle.DeltaMap.GetDeltaBitmapFor(filePath)
 }
 
+func (bundle *Bundle) getReplicaDivergedBlocksFor(filePath string) (*roaring.Bitmap, error) {
+	if bundle.ReplicaDivergedBlocks == nil {
+		return nil, nil
+	}
+	bitmap, err := bundle.ReplicaDivergedBlocks.GetDeltaBitmapFor(filePath)
+	if _, ok := err.(NoBitmapFoundError); ok {
+		return nil, nil
+	}
+	return bitmap, err
+}
+
 func (bundle *Bundle) DownloadDeltaMap(folder storage.Folder, backupStartLSN uint64) error {
 	deltaMap, err := getDeltaMap(folder, bundle.Timeline, *bundle.IncrementFromLsn, backupStartLSN)
 	if err != nil {
@@ -529,11 +680,33 @@ func (bundle *Bundle) DownloadDeltaMap(folder storage.Folder, backupStartLSN uin
 	return nil
 }
 
+// LoadPtrackDeltaMap asks ptrack extension for blocks changed since the previous backup
+func (bundle *Bundle) LoadPtrackDeltaMap(conn *pgx.Conn) error {
+	queryRunner, err := newPgQueryRunner(conn)
+	if err != nil {
+		return errors.Wrap(err, "LoadPtrackDeltaMap: Failed to build query runner.")
+	}
+	pagemaps, err := queryRunner.getPtrackPagemapset(*bundle.IncrementFromLsn)
+	if err != nil {
+		return err
+	}
+	deltaMap := NewPagedFileDeltaMap()
+	for filePath, pagemap := range pagemaps {
+		err = deltaMap.AddPtrackPagemap(filePath, pagemap)
+		if err != nil {
+			return err
+		}
+	}
+	bundle.DeltaMap = deltaMap
+	return nil
+}
+
 // TODO : unit tests
 func (bundle *Bundle) packFileIntoTar(path string, info os.FileInfo, fileInfoHeader *tar.Header, wasInBase bool, tarBall TarBall) error {
 	incrementBaseLsn := bundle.getIncrementBaseLsn()
 	isIncremented := incrementBaseLsn != nil && (wasInBase || bundle.forceIncremental) && isPagedFile(info, path)
 	var fileReader io.ReadCloser
+	var checksumReader *pageChecksumVerifyingReader
 	if isIncremented {
 		bitmap, err := bundle.getDeltaBitmapFor(path)
 		if _, ok := err.(NoBitmapFoundError); ok { // this file has changed after the start of backup, so just skip it
@@ -542,7 +715,11 @@ func (bundle *Bundle) packFileIntoTar(path string, info os.FileInfo, fileInfoHea
 		} else if err != nil {
 			return errors.Wrapf(err, "packFileIntoTar: failed to find corresponding bitmap '%s'\n", path)
 		}
-		fileReader, fileInfoHeader.Size, err = ReadIncrementalFile(path, info.Size(), *incrementBaseLsn, bitmap)
+		divergedBlocks, err := bundle.getReplicaDivergedBlocksFor(path)
+		if err != nil {
+			return errors.Wrapf(err, "packFileIntoTar: failed to find diverged blocks of replica '%s'\n", path)
+		}
+		fileReader, fileInfoHeader.Size, err = ReadIncrementalFile(path, info.Size(), *incrementBaseLsn, bitmap, divergedBlocks)
 		if os.IsNotExist(err) { // File was deleted before opening
 			// We should ignore file here as if it did not exist.
 			return nil
@@ -563,6 +740,7 @@ func (bundle *Bundle) packFileIntoTar(path string, info os.FileInfo, fileInfoHea
 			if err != nil {
 				return err
 			}
+			fileReader, checksumReader = bundle.verifyingPageChecksums(fileReader, info, path)
 		default:
 			return errors.Wrapf(err, "packFileIntoTar: failed reading incremental file '%s'\n", path)
 		}
@@ -572,15 +750,30 @@ func (bundle *Bundle) packFileIntoTar(path string, info os.FileInfo, fileInfoHea
 		if err != nil {
 			return err
 		}
+		fileReader, checksumReader = bundle.verifyingPageChecksums(fileReader, info, path)
 	}
 	defer utility.LoggedClose(fileReader, "")
-
-	bundle.getFiles().Store(fileInfoHeader.Name, BackupFileDescription{IsSkipped: false, IsIncremented: isIncremented, MTime: info.ModTime()})
+	var fileHash hash.Hash
+	if bundle.StoreFileChecksums && !isIncremented {
+		fileHash = sha256.New()
+		fileReader = &ioextensions.ReadCascadeCloser{Reader: io.TeeReader(fileReader, fileHash), Closer: fileReader}
+	}
 
 	packedFileSize, err := PackFileTo(tarBall, fileInfoHeader, fileReader)
 	if err != nil {
 		return errors.Wrap(err, "packFileIntoTar: operation failed")
 	}
+	bundle.addTablespaceSize(fileInfoHeader.Name, fileInfoHeader.Size)
+	bundle.addTarFile(tarBall, fileInfoHeader.Name)
+
+	fileDescription := BackupFileDescription{IsSkipped: false, IsIncremented: isIncremented, MTime: info.ModTime()}
+	if checksumReader != nil {
+		fileDescription.CorruptBlocks = checksumReader.CorruptBlocks()
+	}
+	if fileHash != nil {
+		fileDescription.SHA256 = hex.EncodeToString(fileHash.Sum(nil))
+	}
+	bundle.getFiles().Store(fileInfoHeader.Name, fileDescription)
 
 	if packedFileSize != fileInfoHeader.Size {
 		return newTarSizeError(packedFileSize, fileInfoHeader.Size)
@@ -589,6 +782,24 @@ func (bundle *Bundle) packFileIntoTar(path string, info os.FileInfo, fileInfoHea
 	return nil
 }
 
+// verifyingPageChecksums wraps reader of a paged file to collect pages with wrong checksums.
+// Verification is done only if it is enabled and the cluster has data checksums.
+func (bundle *Bundle) verifyingPageChecksums(fileReader io.ReadCloser, info os.FileInfo,
+	path string) (io.ReadCloser, *pageChecksumVerifyingReader) {
+	if !bundle.VerifyPageChecksums || !bundle.DataChecksums || !isPagedFile(info, path) {
+		return fileReader, nil
+	}
+	checksumReader, err := newCorruptBlocksCollectingReader(fileReader, path, bundle.backupStartLsn)
+	if err != nil {
+		tracelog.WarningLogger.Printf("Page checksums of '%s' are not verified: %v\n", path, err)
+		return fileReader, nil
+	}
+	checksumReader.rereadPage = func(blockNo uint32, page []byte) error {
+		return readFilePage(path, blockNo, page)
+	}
+	return &ioextensions.ReadCascadeCloser{Reader: checksumReader, Closer: fileReader}, checksumReader
+}
+
 func (bundle *Bundle) skipFile(fileInfoHeader *tar.Header, info os.FileInfo) {
 	bundle.getFiles().Store(fileInfoHeader.Name, BackupFileDescription{IsSkipped: true, IsIncremented: false, MTime: info.ModTime()})
 }
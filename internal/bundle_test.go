@@ -2,6 +2,10 @@ package internal_test
 
 import (
 	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -94,6 +98,39 @@ func queueTest(t *testing.T) {
 	}
 }
 
+func TestBundleSkipsExcludePatterns(t *testing.T) {
+	internal.InitConfig()
+	internal.Configure()
+
+	dir, err := ioutil.TempDir("", "wal-g-exclude")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for _, file := range []string{"1", "core.123", "junk/1", "base/1/core.5"} {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0700))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, file), []byte("data"), 0600))
+	}
+
+	bundle := &internal.Bundle{
+		ArchiveDirectory: dir,
+		TarSizeThreshold: 100,
+		Files:            &sync.Map{},
+		TablespaceSpec:   internal.NewTablespaceSpec(dir),
+		ExcludePatterns:  []string{"core.*", "/junk", "base/*/core.5"},
+	}
+	uploader := testtools.NewStoringMockUploader(memory.NewStorage(), nil)
+	bundle.TarBallMaker = internal.NewStorageTarBallMaker("mockBackup", uploader)
+	assert.NoError(t, bundle.StartQueue())
+	assert.NoError(t, filepath.Walk(dir, bundle.HandleWalkedFSObject))
+	assert.NoError(t, bundle.FinishQueue())
+
+	files := make([]string, 0)
+	bundle.Files.Range(func(key, value interface{}) bool {
+		files = append(files, key.(string))
+		return true
+	})
+	assert.Equal(t, []string{"/1"}, files)
+}
+
 func makeDeltaFile(locations []walparser.BlockLocation) ([]byte, error) {
 	locations = append(locations, internal.TerminalLocation)
 	var data bytes.Buffer
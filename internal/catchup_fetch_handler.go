@@ -6,8 +6,9 @@ import (
 	"github.com/wal-g/wal-g/utility"
 )
 
-// HandleCatchupFetch is invoked to perform wal-g catchup-fetch
-func HandleCatchupFetch(folder storage.Folder, dbDirectory, backupName string, useNewUnwrap bool) {
+// HandleCatchupFetch is invoked to perform wal-g catchup-fetch.
+// If removeExtraFiles is set, relation files which do not exist on the source cluster are removed.
+func HandleCatchupFetch(folder storage.Folder, dbDirectory, backupName string, useNewUnwrap, removeExtraFiles bool) {
 	dbDirectory = utility.ResolveSymlink(dbDirectory)
 
 	backup, err := GetBackupByName(backupName, utility.CatchupPath, folder)
@@ -27,4 +28,13 @@ func HandleCatchupFetch(folder storage.Folder, dbDirectory, backupName string, u
 	}
 
 	tracelog.ErrorLogger.FatalfOnError("Failed unwrap backup: %v", err)
+
+	if removeExtraFiles {
+		if sentinelDto.Files == nil {
+			tracelog.WarningLogger.Println("Catchup backup has no list of files, extra files are not removed")
+			return
+		}
+		err = removeExtraRelationFiles(dbDirectory, sentinelDto.Files)
+		tracelog.ErrorLogger.FatalfOnError("Failed to remove extra relation files: %v", err)
+	}
 }
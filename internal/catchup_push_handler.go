@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/utility"
 )
 
@@ -10,8 +11,9 @@ func extendExcludedFiles() {
 	}
 }
 
-// HandleCatchupPush is invoked to perform a wal-g catchup-push
-func HandleCatchupPush(uploader *WalUploader, archiveDirectory string, fromLSN uint64) {
+// HandleCatchupPush is invoked to perform a wal-g catchup-push.
+// If replicaStateName is given, blocks changed on the stale replica after fromLSN are sent too.
+func HandleCatchupPush(uploader *WalUploader, archiveDirectory string, fromLSN uint64, replicaStateName string) {
 	archiveDirectory = utility.ResolveSymlink(archiveDirectory)
 	checkPgVersionAndPgControl(archiveDirectory)
 
@@ -19,6 +21,18 @@ func HandleCatchupPush(uploader *WalUploader, archiveDirectory string, fromLSN u
 		BackupStartLSN: &fromLSN,
 	}
 
+	var replicaDivergedBlocks PagedFileDeltaMap
+	if replicaStateName != "" {
+		state, err := DownloadCatchupReplicaState(uploader.UploadingFolder, replicaStateName)
+		tracelog.ErrorLogger.FatalfOnError("Failed to download replica state: %v", err)
+		if state.FromLSN != fromLSN {
+			tracelog.WarningLogger.Printf("Replica state was made from LSN %d, but catchup is made from LSN %d\n",
+				state.FromLSN, fromLSN)
+		}
+		replicaDivergedBlocks, err = state.toDeltaMap()
+		tracelog.ErrorLogger.FatalfOnError("Failed to parse replica state: %v", err)
+	}
+
 	extendExcludedFiles()
 
 	createAndPushBackup(
@@ -26,5 +40,7 @@ func HandleCatchupPush(uploader *WalUploader, archiveDirectory string, fromLSN u
 		archiveDirectory, utility.CatchupPath,
 		"", fakePreviousBackupSentinelDto,
 		false, true, 0,
+		replicaDivergedBlocks,
+		false, false,
 	)
 }
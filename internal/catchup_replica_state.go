@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	// CatchupReplicaStatePath is the folder inside catchup folder where states of stale replicas are stored
+	CatchupReplicaStatePath = "replica_states/"
+
+	catchupReplicaStateSuffix = ".json"
+)
+
+// CatchupReplicaState describes blocks of a stale replica changed after it diverged from the source cluster.
+// Blocks are listed per relation segment file, paths are relative to the data directory.
+type CatchupReplicaState struct {
+	FromLSN        uint64              `json:"FromLSN"`
+	DivergedBlocks map[string][]uint32 `json:"DivergedBlocks"`
+}
+
+// HandleCatchupState is invoked to perform wal-g catchup-state
+func HandleCatchupState(folder storage.Folder, dbDirectory, stateName string, fromLSN uint64) {
+	dbDirectory = utility.ResolveSymlink(dbDirectory)
+
+	state, err := ScanCatchupReplicaState(dbDirectory, fromLSN)
+	tracelog.ErrorLogger.FatalfOnError("Failed to scan replica data directory: %v", err)
+
+	err = uploadCatchupReplicaState(folder, stateName, state)
+	tracelog.ErrorLogger.FatalfOnError("Failed to upload replica state: %v", err)
+	tracelog.InfoLogger.Printf("Uploaded state of replica %s: %d relation files diverged\n",
+		stateName, len(state.DivergedBlocks))
+}
+
+// ScanCatchupReplicaState finds pages of relation files which were changed since fromLSN.
+// Invalid and new pages are reported too, since they can't be trusted either.
+func ScanCatchupReplicaState(dbDirectory string, fromLSN uint64) (*CatchupReplicaState, error) {
+	state := &CatchupReplicaState{FromLSN: fromLSN, DivergedBlocks: make(map[string][]uint32)}
+	err := walkDataDirectory(dbDirectory, func(filePath, relativePath string, info os.FileInfo) error {
+		if !isPagedFile(info, relativePath) {
+			return nil
+		}
+		blocks, err := state.scanPagedFile(filePath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to scan '%s'", filePath)
+		}
+		if len(blocks) > 0 {
+			state.DivergedBlocks[relativePath] = blocks
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// walkDataDirectory walks the data directory and locations of its tablespaces.
+// Paths relative to the data directory are built as in backups, e.g. /pg_tblspc/16384/PG_12/16385/16386.
+func walkDataDirectory(dbDirectory string, handle func(filePath, relativePath string, info os.FileInfo) error) error {
+	err := walkDirectory(dbDirectory, utility.PathSeparator, handle)
+	if err != nil {
+		return err
+	}
+
+	tablespaceFolder := filepath.Join(dbDirectory, TablespaceFolder)
+	tablespaceInfos, err := ioutil.ReadDir(tablespaceFolder)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, tablespaceInfo := range tablespaceInfos {
+		if tablespaceInfo.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		location, err := os.Readlink(filepath.Join(tablespaceFolder, tablespaceInfo.Name()))
+		if err != nil {
+			return errors.Wrapf(err, "failed to read symlink of tablespace %s", tablespaceInfo.Name())
+		}
+		relativePrefix := utility.PathSeparator + filepath.Join(TablespaceFolder, tablespaceInfo.Name()) + utility.PathSeparator
+		err = walkDirectory(location, relativePrefix, handle)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkDirectory walks regular files of the directory, their relative paths are prefixed with relativePrefix
+func walkDirectory(directory, relativePrefix string, handle func(filePath, relativePath string, info os.FileInfo) error) error {
+	return filepath.Walk(directory, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return handle(filePath, relativePrefix+utility.GetSubdirectoryRelativePath(filePath, directory), info)
+	})
+}
+
+// removeExtraRelationFiles removes relation files of the replica which do not exist on the source cluster,
+// e.g. files of relations dropped or rewritten after the replica diverged
+func removeExtraRelationFiles(dbDirectory string, sourceFiles BackupFileList) error {
+	return walkDataDirectory(dbDirectory, func(filePath, relativePath string, info os.FileInfo) error {
+		if _, _, isRelation := parseRelationPath(relativePath); !isRelation {
+			return nil
+		}
+		if _, ok := sourceFiles[relativePath]; ok {
+			return nil
+		}
+		tracelog.DebugLogger.Printf("Removing %s, it does not exist on the source cluster\n", filePath)
+		err := os.Remove(filePath)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+func (state *CatchupReplicaState) scanPagedFile(filePath string) ([]uint32, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer utility.LoggedClose(file, "")
+
+	reader := NewDiskLimitReader(file)
+	pageBytes := make([]byte, DatabasePageSize)
+	blocks := make([]uint32, 0)
+	for blockNo := uint32(0); ; blockNo++ {
+		_, err := io.ReadFull(reader, pageBytes)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return blocks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		pageHeader, err := parsePostgresPageHeader(bytes.NewReader(pageBytes))
+		if err != nil || !pageHeader.isValid() || pageHeader.isNew() || pageHeader.lsn() >= state.FromLSN {
+			blocks = append(blocks, blockNo)
+		}
+	}
+}
+
+// toDeltaMap converts diverged blocks of the replica to the map used by the bundle
+func (state *CatchupReplicaState) toDeltaMap() (PagedFileDeltaMap, error) {
+	deltaMap := NewPagedFileDeltaMap()
+	for filePath, blocks := range state.DivergedBlocks {
+		relFileNode, err := GetRelFileNodeFrom(filePath)
+		if err != nil {
+			return nil, err
+		}
+		relFileId, err := GetRelFileIdFrom(filePath)
+		if err != nil {
+			return nil, err
+		}
+		bitmap, ok := deltaMap[*relFileNode]
+		if !ok {
+			bitmap = roaring.New()
+			deltaMap[*relFileNode] = bitmap
+		}
+		for _, blockNo := range blocks {
+			bitmap.Add(uint32(relFileId*BlocksInRelFile) + blockNo)
+		}
+	}
+	return deltaMap, nil
+}
+
+func uploadCatchupReplicaState(folder storage.Folder, stateName string, state *CatchupReplicaState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	stateFolder := folder.GetSubFolder(utility.CatchupPath).GetSubFolder(CatchupReplicaStatePath)
+	return stateFolder.PutObject(stateName+catchupReplicaStateSuffix, bytes.NewReader(data))
+}
+
+// DownloadCatchupReplicaState reads the state of the replica uploaded by catchup-state
+func DownloadCatchupReplicaState(folder storage.Folder, stateName string) (*CatchupReplicaState, error) {
+	stateFolder := folder.GetSubFolder(utility.CatchupPath).GetSubFolder(CatchupReplicaStatePath)
+	reader, err := stateFolder.ReadObject(stateName + catchupReplicaStateSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer utility.LoggedClose(reader, "")
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	var state CatchupReplicaState
+	err = json.Unmarshal(data, &state)
+	return &state, errors.Wrapf(err, "failed to parse state of replica '%s'", stateName)
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/walparser"
+)
+
+func makeTestPage(lsn uint64) []byte {
+	page := make([]byte, DatabasePageSize)
+	binary.LittleEndian.PutUint32(page[0:4], uint32(lsn>>32))
+	binary.LittleEndian.PutUint32(page[4:8], uint32(lsn))
+	binary.LittleEndian.PutUint16(page[12:14], headerSize)
+	binary.LittleEndian.PutUint16(page[14:16], uint16(DatabasePageSize))
+	binary.LittleEndian.PutUint16(page[16:18], uint16(DatabasePageSize))
+	binary.LittleEndian.PutUint16(page[18:20], uint16(DatabasePageSize+layoutVersion))
+	return page
+}
+
+func writeTestRelationFile(t *testing.T, filePath string, pages ...[]byte) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0700))
+	data := make([]byte, 0, len(pages)*int(DatabasePageSize))
+	for _, page := range pages {
+		data = append(data, page...)
+	}
+	assert.NoError(t, ioutil.WriteFile(filePath, data, 0600))
+}
+
+func TestScanCatchupReplicaState(t *testing.T) {
+	dir, err := createTempDir("catchup_state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	tablespaceDir, err := createTempDir("catchup_state_ts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tablespaceDir)
+
+	fromLSN := uint64(0x100000)
+	// old page, page changed after divergence and new page
+	writeTestRelationFile(t, filepath.Join(dir, "base", "16384", "16385"),
+		makeTestPage(fromLSN-1), makeTestPage(fromLSN+1), make([]byte, DatabasePageSize))
+	writeTestRelationFile(t, filepath.Join(dir, "base", "16384", "16386"), makeTestPage(fromLSN-1))
+	writeTestRelationFile(t, filepath.Join(tablespaceDir, "PG_12", "16384", "16387.1"),
+		makeTestPage(fromLSN-1), makeTestPage(fromLSN))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, TablespaceFolder), 0700))
+	assert.NoError(t, os.Symlink(tablespaceDir, filepath.Join(dir, TablespaceFolder, "16400")))
+
+	state, err := ScanCatchupReplicaState(dir, fromLSN)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]uint32{
+		"/base/16384/16385":                    {1, 2},
+		"/pg_tblspc/16400/PG_12/16384/16387.1": {1},
+	}, state.DivergedBlocks)
+
+	deltaMap, err := state.toDeltaMap()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{uint32(BlocksInRelFile + 1)},
+		deltaMap[walparser.RelFileNode{SpcNode: 16400, DBNode: 16384, RelNode: 16387}].ToArray())
+
+	err = removeExtraRelationFiles(dir, BackupFileList{"/base/16384/16385": BackupFileDescription{}})
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "base", "16384", "16385"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "base", "16384", "16386"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(tablespaceDir, "PG_12", "16384", "16387.1"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestIncrementalPageReaderAddExtraBlocks(t *testing.T) {
+	pageReader := &IncrementalPageReader{FileSize: 4 * DatabasePageSize, Blocks: []uint32{0, 2}}
+	pageReader.AddExtraBlocks(roaring.BitmapOf(1, 2, 5))
+	assert.Equal(t, []uint32{0, 1, 2}, pageReader.Blocks)
+}
@@ -1,7 +1,10 @@
 package internal
 
 import (
+	"io/ioutil"
+	"os"
 	"path"
+	"sort"
 
 	"github.com/wal-g/tracelog"
 )
@@ -41,3 +44,32 @@ func cleanupPrefetchDirectory(directory string, timelineId uint32, logSegNo uint
 		}
 	}
 }
+
+// trimPrefetchSpool removes least recently used prefetched files, so no more than limit files are kept.
+// Zero limit means no limit.
+func trimPrefetchSpool(directory string, limit int) {
+	if limit <= 0 {
+		return
+	}
+	fileInfos, err := ioutil.ReadDir(directory)
+	if err != nil {
+		tracelog.WarningLogger.Println("WAL-prefetch spool trimming failed: ", err, " cannot enumerate files in dir: ", directory)
+		return
+	}
+	files := make([]os.FileInfo, 0, len(fileInfos))
+	for _, info := range fileInfos {
+		if !info.IsDir() {
+			files = append(files, info)
+		}
+	}
+	if len(files) <= limit {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, info := range files[:len(files)-limit] {
+		tracelog.DebugLogger.Println("WAL-prefetch spool is full, evicting: ", info.Name())
+		FileSystemCleaner{}.Remove(path.Join(directory, info.Name()))
+	}
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrimPrefetchSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prefetch")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "running"), 0755))
+
+	now := time.Now()
+	names := []string{"000000010000000100000056", "000000010000000100000057", "000000010000000100000058"}
+	// 57 is the least recently used one
+	usedAt := []time.Duration{-time.Minute, -time.Hour, 0}
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, nil, 0600))
+		require.NoError(t, os.Chtimes(path, now.Add(usedAt[i]), now.Add(usedAt[i])))
+	}
+
+	trimPrefetchSpool(dir, 2)
+
+	files, err := FileSystemCleaner{}.GetFiles(dir)
+	assert.NoError(t, err)
+	sort.Strings(files)
+	assert.Equal(t, []string{"000000010000000100000056", "000000010000000100000058"}, files)
+
+	trimPrefetchSpool(dir, 0)
+	files, err = FileSystemCleaner{}.GetFiles(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+}
+
+func TestGetPrefetchDepth(t *testing.T) {
+	defer viper.Set(DownloadConcurrencySetting, nil)
+	defer viper.Set(PrefetchDepthSetting, nil)
+
+	viper.Set(DownloadConcurrencySetting, "4")
+	depth, err := getPrefetchDepth()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, depth)
+
+	viper.Set(DownloadConcurrencySetting, "1")
+	depth, err = getPrefetchDepth()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, depth)
+
+	viper.Set(PrefetchDepthSetting, "16")
+	depth, err = getPrefetchDepth()
+	assert.NoError(t, err)
+	assert.Equal(t, 16, depth)
+}
@@ -18,20 +18,70 @@ import (
 
 const (
 	DownloadConcurrencySetting   = "WALG_DOWNLOAD_CONCURRENCY"
+	PrefetchDepthSetting         = "WALG_PREFETCH_DEPTH"
+	PrefetchConcurrencySetting   = "WALG_PREFETCH_CONCURRENCY"
+	PrefetchSpoolLimitSetting    = "WALG_PREFETCH_SPOOL_LIMIT"
+	ExtractConcurrencySetting    = "WALG_TABLESPACE_EXTRACT_CONCURRENCY"
 	UploadConcurrencySetting     = "WALG_UPLOAD_CONCURRENCY"
 	UploadDiskConcurrencySetting = "WALG_UPLOAD_DISK_CONCURRENCY"
 	UploadQueueSetting           = "WALG_UPLOAD_QUEUE"
+	UploadMemoryLimitSetting     = "WALG_UPLOAD_MEMORY_LIMIT"
 	SentinelUserDataSetting      = "WALG_SENTINEL_USER_DATA"
 	PreventWalOverwriteSetting   = "WALG_PREVENT_WAL_OVERWRITE"
+	WalPushBatchSetting          = "WALG_WAL_PUSH_BATCH"
 	DeltaMaxStepsSetting         = "WALG_DELTA_MAX_STEPS"
 	DeltaOriginSetting           = "WALG_DELTA_ORIGIN"
+	DeltaMaxChainSizeSetting     = "WALG_DELTA_MAX_CHAIN_SIZE"
 	CompressionMethodSetting     = "WALG_COMPRESSION_METHOD"
 	DiskRateLimitSetting         = "WALG_DISK_RATE_LIMIT"
 	NetworkRateLimitSetting      = "WALG_NETWORK_RATE_LIMIT"
 	UseWalDeltaSetting           = "WALG_USE_WAL_DELTA"
+	UsePtrackSetting             = "WALG_USE_PTRACK"
+	UseWalScanDeltaSetting       = "WALG_USE_WAL_SCAN_DELTA"
 	UseReverseUnpackSetting      = "WALG_USE_REVERSE_UNPACK"
+	DeferFailedTarsSetting       = "WALG_FETCH_DEFER_FAILED_TARS"
+	RestoreProgressSetting       = "WALG_RESTORE_PROGRESS_INTERVAL"
+	RestoreProgressJSONSetting   = "WALG_RESTORE_PROGRESS_JSON"
+	FetchFailoverConfigSetting   = "WALG_FETCH_FAILOVER_CONFIG"
+	UploadMirrorConfigsSetting   = "WALG_UPLOAD_MIRROR_CONFIGS"
+	MirrorQueueSizeSetting       = "WALG_UPLOAD_MIRROR_QUEUE_SIZE"
+	MirrorSpoolSizeSetting       = "WALG_UPLOAD_MIRROR_SPOOL_SIZE"
+	StreamPartSizeSetting        = "WALG_STREAM_PART_SIZE"
+	StreamPartStateDirSetting    = "WALG_STREAM_PART_STATE_DIR"
+	DeterministicNamingSetting   = "WALG_DETERMINISTIC_BACKUP_NAME"
+	StandbyMaxReplayLagSetting   = "WALG_STANDBY_MAX_REPLAY_LAG"
+	BackupExcludePatternsSetting = "WALG_BACKUP_EXCLUDE_PATTERNS"
+	BackupExcludeRelsSetting     = "WALG_BACKUP_EXCLUDE_RELATIONS"
+	VerifyPageChecksumsSetting   = "WALG_VERIFY_PAGE_CHECKSUMS"
+	BackupIncludeConfigSetting   = "WALG_BACKUP_INCLUDE_CONFIG"
+	BackupConfigPathsSetting     = "WALG_BACKUP_CONFIG_PATHS"
+	ProtectedLsnQuerySetting     = "WALG_PROTECTED_LSN_QUERY"
 	LogLevelSetting              = "WALG_LOG_LEVEL"
 	TarSizeThresholdSetting      = "WALG_TAR_SIZE_THRESHOLD"
+	TarSplitLargeFilesSetting    = "WALG_TAR_SPLIT_LARGE_FILES"
+	BackupFileChecksumsSetting   = "WALG_BACKUP_FILE_CHECKSUMS"
+	PgBinDirSetting              = "WALG_PG_BIN_DIR"
+	SnapshotCommandSetting       = "WALG_SNAPSHOT_COMMAND"
+	SnapshotReleaseCmdSetting    = "WALG_SNAPSHOT_RELEASE_COMMAND"
+	BackupPushPreHookSetting     = "WALG_BACKUP_PUSH_PRE_HOOK"
+	BackupPushPostHookSetting    = "WALG_BACKUP_PUSH_POST_HOOK"
+	WalPushPreHookSetting        = "WALG_WAL_PUSH_PRE_HOOK"
+	WalPushPostHookSetting       = "WALG_WAL_PUSH_POST_HOOK"
+	HookTimeoutSetting           = "WALG_HOOK_TIMEOUT"
+	HookFailurePolicySetting     = "WALG_HOOK_FAILURE_POLICY"
+	WalFetchRetriesSetting       = "WALG_WAL_FETCH_RETRIES"
+	WalFetchRetryWaitSetting     = "WALG_WAL_FETCH_RETRY_WAIT"
+	WalFetchMaxRetryWaitSetting  = "WALG_WAL_FETCH_MAX_RETRY_WAIT"
+	WalFetchBreakerSetting       = "WALG_WAL_FETCH_BREAKER_THRESHOLD"
+	WalFetchCooldownSetting      = "WALG_WAL_FETCH_BREAKER_COOLDOWN"
+	BackupPushLockSetting        = "WALG_BACKUP_PUSH_LOCK"
+	BackupPushLockTTLSetting     = "WALG_BACKUP_PUSH_LOCK_TTL"
+	GpSegmentBackupCmdSetting    = "WALG_GP_SEGMENT_BACKUP_COMMAND"
+	LoadThrottleMaxLoadSetting   = "WALG_LOAD_THROTTLE_MAX_LOAD"
+	LoadThrottleMaxIOSetting     = "WALG_LOAD_THROTTLE_MAX_IO_PRESSURE"
+	LoadThrottleCommandSetting   = "WALG_LOAD_THROTTLE_COMMAND"
+	LoadThrottleIntervalSetting  = "WALG_LOAD_THROTTLE_INTERVAL"
+	LoadThrottleMaxPauseSetting  = "WALG_LOAD_THROTTLE_MAX_PAUSE"
 	CseKmsIDSetting              = "WALG_CSE_KMS_ID"
 	CseKmsRegionSetting          = "WALG_CSE_KMS_REGION"
 	LibsodiumKeySetting          = "WALG_LIBSODIUM_KEY"
@@ -40,6 +90,9 @@ const (
 	PgpKeySetting                = "WALG_PGP_KEY"
 	PgpKeyPathSetting            = "WALG_PGP_KEY_PATH"
 	PgpKeyPassphraseSetting      = "WALG_PGP_KEY_PASSPHRASE"
+	BackupCryptoConfigSetting    = "WALG_BACKUP_CRYPTO_CONFIG"
+	LogCryptoConfigSetting       = "WALG_LOG_CRYPTO_CONFIG"
+	EnvelopeEncryptionSetting    = "WALG_ENVELOPE_ENCRYPTION"
 	PgDataSetting                = "PGDATA"
 	UserSetting                  = "USER" // TODO : do something with it
 	PgPortSetting                = "PGPORT"
@@ -53,19 +106,37 @@ const (
 	NameStreamRestoreCmd         = "WALG_STREAM_RESTORE_COMMAND"
 
 	MongoDBUriSetting             = "MONGODB_URI"
+	MongoDBPathSetting            = "MONGODB_DBPATH"
 	MongoDBLastWriteUpdateSeconds = "MONGODB_LAST_WRITE_UPDATE_SECONDS"
+	MongoDBReadPreference         = "MONGODB_READ_PREFERENCE"
+	MongoDBReadPreferenceTags     = "MONGODB_READ_PREFERENCE_TAGS"
+	MongoDBRestoreRateLimit       = "MONGODB_RESTORE_RATE_LIMIT"
 	OplogArchiveAfterSize         = "OPLOG_ARCHIVE_AFTER_SIZE"
 	OplogArchiveTimeoutSetting    = "OPLOG_ARCHIVE_TIMEOUT"
+	OplogArchiveCompressedSize    = "OPLOG_ARCHIVE_COMPRESSED_SIZE"
 	OplogPushStatsEnabled         = "OPLOG_PUSH_STATS_ENABLED"
 	OplogPushStatsLoggingInterval = "OPLOG_PUSH_STATS_LOGGING_INTERVAL"
 	OplogPushStatsUpdateInterval  = "OPLOG_PUSH_STATS_UPDATE_INTERVAL"
 	OplogPushStatsExposeHttp      = "OPLOG_PUSH_STATS_EXPOSE_HTTP"
+	OplogBatchSize                = "OPLOG_BATCH_SIZE"
+	OplogBatchTimeout             = "OPLOG_BATCH_TIMEOUT"
+	OplogReplayPrefetch           = "OPLOG_REPLAY_PREFETCH"
 
 	MysqlDatasourceNameSetting = "WALG_MYSQL_DATASOURCE_NAME"
 	MysqlSslCaSetting          = "WALG_MYSQL_SSL_CA"
 	MysqlBinlogReplayCmd       = "WALG_MYSQL_BINLOG_REPLAY_COMMAND"
 	MysqlBinlogDstSetting      = "WALG_MYSQL_BINLOG_DST"
 	MysqlBackupPrepareCmd      = "WALG_MYSQL_BACKUP_PREPARE_COMMAND"
+	MysqlDataDirSetting        = "WALG_MYSQL_DATA_DIR"
+	MysqlPrepareMemorySetting  = "WALG_MYSQL_PREPARE_USE_MEMORY"
+	MysqlBackupToolSetting     = "WALG_MYSQL_BACKUP_TOOL"
+	MysqlBinlogServerHost      = "WALG_MYSQL_BINLOG_SERVER_HOST"
+	MysqlBinlogServerPort      = "WALG_MYSQL_BINLOG_SERVER_PORT"
+	MysqlBinlogServerUser      = "WALG_MYSQL_BINLOG_SERVER_USER"
+	MysqlBinlogServerPassword  = "WALG_MYSQL_BINLOG_SERVER_PASSWORD"
+	MysqlBinlogServerID        = "WALG_MYSQL_BINLOG_SERVER_ID"
+	MysqlGaleraDesyncSetting   = "WALG_MYSQL_GALERA_DESYNC"
+	MysqlCloneDirSetting       = "WALG_MYSQL_CLONE_DIR"
 
 	GoMaxProcs = "GOMAXPROCS"
 
@@ -87,46 +158,141 @@ var (
 		UploadConcurrencySetting:     "16",
 		UploadDiskConcurrencySetting: "1",
 		UploadQueueSetting:           "2",
+		UploadMemoryLimitSetting:     "0",
 		PreventWalOverwriteSetting:   "false",
+		WalPushBatchSetting:          "false",
 		DeltaMaxStepsSetting:         "0",
+		DeltaMaxChainSizeSetting:     "0",
 		CompressionMethodSetting:     "lz4",
 		UseWalDeltaSetting:           "false",
+		UsePtrackSetting:             "false",
+		UseWalScanDeltaSetting:       "false",
 		TarSizeThresholdSetting:      "1073741823", // (1 << 30) - 1
+		TarSplitLargeFilesSetting:    "false",
+		BackupFileChecksumsSetting:   "false",
+		WalFetchRetriesSetting:       "0",
+		WalFetchRetryWaitSetting:     "1",
+		WalFetchMaxRetryWaitSetting:  "30",
+		WalFetchBreakerSetting:       "0",
+		WalFetchCooldownSetting:      "60",
+		HookTimeoutSetting:           "60",
+		HookFailurePolicySetting:     HookFailurePolicyFail,
+		BackupPushLockSetting:        "false",
+		BackupPushLockTTLSetting:     "600",
+		LoadThrottleIntervalSetting:  "5",
+		LoadThrottleMaxPauseSetting:  "3600",
 		TotalBgUploadedLimit:         "32",
 		UseReverseUnpackSetting:      "false",
+		DeferFailedTarsSetting:       "false",
+		RestoreProgressSetting:       "30",
+		RestoreProgressJSONSetting:   "false",
+		DeterministicNamingSetting:   "false",
+		EnvelopeEncryptionSetting:    "false",
+		StreamPartSizeSetting:        "0",
+		MirrorQueueSizeSetting:       "64",
+		MirrorSpoolSizeSetting:       "1073741824",
+		PrefetchSpoolLimitSetting:    "0",
+		StandbyMaxReplayLagSetting:   "0",
+		VerifyPageChecksumsSetting:   "false",
+		BackupIncludeConfigSetting:   "false",
 
 		OplogArchiveTimeoutSetting:    "60",
 		OplogArchiveAfterSize:         "16777216", // 32 << (10 * 2)
+		OplogArchiveCompressedSize:    "0",
 		MongoDBLastWriteUpdateSeconds: "3",
+		MongoDBReadPreference:         "primary",
+		MongoDBRestoreRateLimit:       "0",
 		OplogPushStatsLoggingInterval: "30",
 		OplogPushStatsUpdateInterval:  "30",
+		OplogBatchSize:                "0",
+		OplogBatchTimeout:             "600",
+		OplogReplayPrefetch:           "0",
+
+		MysqlDataDirSetting:      "/var/lib/mysql",
+		MysqlBinlogServerHost:    "localhost",
+		MysqlBinlogServerPort:    "9306",
+		MysqlBinlogServerID:      "99999",
+		MysqlGaleraDesyncSetting: "false",
 	}
 
 	AllowedSettings = map[string]bool{
 		// WAL-G core
 		DownloadConcurrencySetting:   true,
+		PrefetchDepthSetting:         true,
+		PrefetchConcurrencySetting:   true,
+		PrefetchSpoolLimitSetting:    true,
+		ExtractConcurrencySetting:    true,
 		UploadConcurrencySetting:     true,
 		UploadDiskConcurrencySetting: true,
 		UploadQueueSetting:           true,
+		UploadMemoryLimitSetting:     true,
 		SentinelUserDataSetting:      true,
 		PreventWalOverwriteSetting:   true,
+		WalPushBatchSetting:          true,
 		DeltaMaxStepsSetting:         true,
 		DeltaOriginSetting:           true,
+		DeltaMaxChainSizeSetting:     true,
 		CompressionMethodSetting:     true,
 		DiskRateLimitSetting:         true,
 		NetworkRateLimitSetting:      true,
 		UseWalDeltaSetting:           true,
+		UsePtrackSetting:             true,
+		UseWalScanDeltaSetting:       true,
 		LogLevelSetting:              true,
 		TarSizeThresholdSetting:      true,
+		TarSplitLargeFilesSetting:    true,
+		BackupFileChecksumsSetting:   true,
+		PgBinDirSetting:              true,
+		SnapshotCommandSetting:       true,
+		SnapshotReleaseCmdSetting:    true,
+		BackupPushPreHookSetting:     true,
+		BackupPushPostHookSetting:    true,
+		WalPushPreHookSetting:        true,
+		WalPushPostHookSetting:       true,
+		HookTimeoutSetting:           true,
+		HookFailurePolicySetting:     true,
+		WalFetchRetriesSetting:       true,
+		WalFetchRetryWaitSetting:     true,
+		WalFetchMaxRetryWaitSetting:  true,
+		WalFetchBreakerSetting:       true,
+		WalFetchCooldownSetting:      true,
+		BackupPushLockSetting:        true,
+		BackupPushLockTTLSetting:     true,
+		GpSegmentBackupCmdSetting:    true,
+		LoadThrottleMaxLoadSetting:   true,
+		LoadThrottleMaxIOSetting:     true,
+		LoadThrottleCommandSetting:   true,
+		LoadThrottleIntervalSetting:  true,
+		LoadThrottleMaxPauseSetting:  true,
 		"WALG_" + GpgKeyIDSetting:    true,
 		"WALE_" + GpgKeyIDSetting:    true,
 		PgpKeySetting:                true,
 		PgpKeyPathSetting:            true,
 		PgpKeyPassphraseSetting:      true,
+		BackupCryptoConfigSetting:    true,
+		LogCryptoConfigSetting:       true,
+		EnvelopeEncryptionSetting:    true,
 		TotalBgUploadedLimit:         true,
 		NameStreamCreateCmd:          true,
 		NameStreamRestoreCmd:         true,
 		UseReverseUnpackSetting:      true,
+		DeferFailedTarsSetting:       true,
+		RestoreProgressSetting:       true,
+		RestoreProgressJSONSetting:   true,
+		FetchFailoverConfigSetting:   true,
+		UploadMirrorConfigsSetting:   true,
+		MirrorQueueSizeSetting:       true,
+		MirrorSpoolSizeSetting:       true,
+		StreamPartSizeSetting:        true,
+		StreamPartStateDirSetting:    true,
+		DeterministicNamingSetting:   true,
+		StandbyMaxReplayLagSetting:   true,
+		BackupExcludePatternsSetting: true,
+		BackupExcludeRelsSetting:     true,
+		VerifyPageChecksumsSetting:   true,
+		BackupIncludeConfigSetting:   true,
+		BackupConfigPathsSetting:     true,
+		ProtectedLsnQuerySetting:     true,
 
 		// Postgres
 		PgPortSetting:     true,
@@ -186,13 +352,21 @@ var (
 
 		// MongoDB
 		MongoDBUriSetting:             true,
+		MongoDBPathSetting:            true,
 		MongoDBLastWriteUpdateSeconds: true,
+		MongoDBReadPreference:         true,
+		MongoDBReadPreferenceTags:     true,
+		MongoDBRestoreRateLimit:       true,
 		OplogArchiveTimeoutSetting:    true,
 		OplogArchiveAfterSize:         true,
+		OplogArchiveCompressedSize:    true,
 		OplogPushStatsEnabled:         true,
 		OplogPushStatsLoggingInterval: true,
 		OplogPushStatsUpdateInterval:  true,
 		OplogPushStatsExposeHttp:      true,
+		OplogBatchSize:                true,
+		OplogBatchTimeout:             true,
+		OplogReplayPrefetch:           true,
 
 		// MySQL
 		MysqlDatasourceNameSetting: true,
@@ -200,6 +374,16 @@ var (
 		MysqlBinlogReplayCmd:       true,
 		MysqlBinlogDstSetting:      true,
 		MysqlBackupPrepareCmd:      true,
+		MysqlDataDirSetting:        true,
+		MysqlPrepareMemorySetting:  true,
+		MysqlBackupToolSetting:     true,
+		MysqlBinlogServerHost:      true,
+		MysqlBinlogServerPort:      true,
+		MysqlBinlogServerUser:      true,
+		MysqlBinlogServerPassword:  true,
+		MysqlBinlogServerID:        true,
+		MysqlGaleraDesyncSetting:   true,
+		MysqlCloneDirSetting:       true,
 
 		// GOLANG
 		GoMaxProcs: true,
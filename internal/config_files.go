@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	configFilesTarName = "config_files.tar"
+	// configIncludeDirectory is a common include_dir next to the main configuration file
+	configIncludeDirectory = "conf.d"
+)
+
+var configFilesTarRe = regexp.MustCompile(`^.*?config_files\.tar(\..+$|$)`)
+
+// UploadConfigFiles packs configuration files located outside of the data directory into a separate tarball:
+// the main configuration file, pg_hba.conf, pg_ident.conf, conf.d next to the main configuration file
+// and paths from BackupConfigPathsSetting. Files are stored by their absolute paths, which are returned.
+func (bundle *Bundle) UploadConfigFiles(conn *pgx.Conn, compressorFileExtension string) ([]string, error) {
+	queryRunner, err := newPgQueryRunner(conn)
+	if err != nil {
+		return nil, errors.Wrap(err, "UploadConfigFiles: Failed to build query runner.")
+	}
+	paths, err := queryRunner.getConfigFilePaths()
+	if err != nil {
+		return nil, err
+	}
+	paths = append(paths, filepath.Join(filepath.Dir(paths[0]), configIncludeDirectory))
+	paths = append(paths, GetBackupConfigPaths()...)
+	configFiles, err := collectConfigFiles(paths, bundle.ArchiveDirectory)
+	if err != nil {
+		return nil, err
+	}
+	if len(configFiles) == 0 {
+		tracelog.InfoLogger.Println("All configuration files are located in the data directory")
+		return nil, nil
+	}
+
+	bundle.NewTarBall(false)
+	tarBall := bundle.TarBall
+	tarBall.SetUp(bundle.Crypter, configFilesTarName+"."+compressorFileExtension)
+	for _, configFile := range configFiles {
+		if err = packConfigFile(tarBall, configFile); err != nil {
+			return nil, err
+		}
+		tracelog.InfoLogger.Println(configFile)
+	}
+	err = tarBall.CloseTar()
+	return configFiles, errors.Wrap(err, "UploadConfigFiles: failed to close tarball")
+}
+
+// collectConfigFiles returns regular files of the given paths, directories are walked.
+// Missing paths and files inside of the data directory are skipped, unless dataDirectory is empty.
+func collectConfigFiles(paths []string, dataDirectory string) ([]string, error) {
+	configFiles := make(map[string]bool)
+	for _, path := range paths {
+		resolvedPath, err := filepath.EvalSymlinks(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = filepath.Walk(resolvedPath, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() && !isInsideDirectory(filePath, dataDirectory) {
+				configFiles[filePath] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read configuration files in %s", path)
+		}
+	}
+	result := make([]string, 0, len(configFiles))
+	for configFile := range configFiles {
+		result = append(result, configFile)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func isInsideDirectory(path, directory string) bool {
+	relativePath, err := filepath.Rel(directory, path)
+	return err == nil && relativePath != ".." && !strings.HasPrefix(relativePath, ".."+utility.PathSeparator)
+}
+
+func packConfigFile(tarBall TarBall, configFile string) error {
+	file, err := os.Open(configFile)
+	if err != nil {
+		return errors.Wrapf(err, "UploadConfigFiles: failed to open file %s\n", configFile)
+	}
+	defer utility.LoggedClose(file, "")
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	fileInfoHeader, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return errors.Wrap(err, "UploadConfigFiles: failed to grab header info")
+	}
+	fileInfoHeader.Name = configFile
+	if err = tarBall.TarWriter().WriteHeader(fileInfoHeader); err != nil {
+		return errors.Wrap(err, "UploadConfigFiles: failed to write header")
+	}
+	_, err = io.Copy(tarBall.TarWriter(), &io.LimitedReader{R: file, N: fileInfoHeader.Size})
+	if err != nil {
+		return errors.Wrap(err, "UploadConfigFiles: copy failed")
+	}
+	tarBall.AddSize(fileInfoHeader.Size)
+	return nil
+}
+
+// HandleConfigFilesFetch restores configuration files captured by backup-push to their original locations
+func HandleConfigFilesFetch(folder storage.Folder, backupName string) {
+	backup, err := GetBackupByName(backupName, utility.BaseBackupPath, folder)
+	tracelog.ErrorLogger.FatalfOnError("Failed to fetch configuration files: %v\n", err)
+	sentinelDto, err := backup.GetSentinel()
+	tracelog.ErrorLogger.FatalfOnError("Failed to fetch configuration files: %v\n", err)
+	if len(sentinelDto.ConfigFiles) == 0 {
+		tracelog.WarningLogger.Printf("Backup %s has no configuration files outside of the data directory\n", backup.Name)
+		return
+	}
+	tarNames, err := backup.GetTarNames()
+	tracelog.ErrorLogger.FatalfOnError("Failed to fetch configuration files: %v\n", err)
+	for _, tarName := range tarNames {
+		if !configFilesTarRe.MatchString(tarName) {
+			continue
+		}
+		tarInterpreter := NewFileTarInterpreter(utility.PathSeparator, BackupSentinelDto{}, nil, false)
+		err = ExtractAll(tarInterpreter, []ReaderMaker{newStorageReaderMaker(backup.getTarPartitionFolder(), tarName)})
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch configuration files: %v\n", err)
+		tracelog.InfoLogger.Printf("Restored configuration files %v\n", sentinelDto.ConfigFiles)
+		return
+	}
+	tracelog.ErrorLogger.Fatalf("Configuration files of backup %s are not found in storage\n", backup.Name)
+}
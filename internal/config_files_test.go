@@ -0,0 +1,39 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectConfigFiles(t *testing.T) {
+	dir, err := createTempDir("config_files")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dataDirectory := filepath.Join(dir, "data")
+	configDirectory := filepath.Join(dir, "etc")
+	for _, file := range []string{
+		filepath.Join(dataDirectory, "postgresql.auto.conf"),
+		filepath.Join(configDirectory, "postgresql.conf"),
+		filepath.Join(configDirectory, "conf.d", "tuning.conf"),
+	} {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0700))
+		assert.NoError(t, ioutil.WriteFile(file, []byte("#"), 0600))
+	}
+
+	configFiles, err := collectConfigFiles([]string{
+		filepath.Join(configDirectory, "postgresql.conf"),
+		filepath.Join(configDirectory, "pg_hba.conf"),
+		filepath.Join(configDirectory, "conf.d"),
+		filepath.Join(dataDirectory, "postgresql.auto.conf"),
+	}, dataDirectory)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(configDirectory, "conf.d", "tuning.conf"),
+		filepath.Join(configDirectory, "postgresql.conf"),
+	}, configFiles)
+}
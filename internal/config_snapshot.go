@@ -0,0 +1,239 @@
+package internal
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const ConfigSnapshotPrefix = "config_"
+
+// configSnapshotDataFiles are configuration and identity files of the data directory stored by config-push
+var configSnapshotDataFiles = []string{
+	"postgresql.conf",
+	"postgresql.auto.conf",
+	"pg_hba.conf",
+	"pg_ident.conf",
+	configIncludeDirectory,
+	pgVersionFileName,
+}
+
+// ConfigSnapshotSentinelDto describes a snapshot of configuration files made by config-push
+type ConfigSnapshotSentinelDto struct {
+	Files            []string    `json:"Files"`
+	DataDir          string      `json:"DataDir"`
+	Hostname         string      `json:"Hostname"`
+	PgVersion        int         `json:"PgVersion"`
+	SystemIdentifier *uint64     `json:"SystemIdentifier,omitempty"`
+	Time             time.Time   `json:"Time"`
+	UserData         interface{} `json:"UserData,omitempty"`
+}
+
+// HandleConfigPush is invoked to perform wal-g config-push. It stores configuration files of the cluster,
+// including ones outside of the data directory and SSL certificates, without backing up the data.
+// The SSL private key is stored only if encryption is configured.
+// If Postgres is not running, only files of the data directory and WALG_BACKUP_CONFIG_PATHS are stored.
+func HandleConfigPush(uploader *Uploader, dataDirectory string) {
+	dataDirectory = utility.ResolveSymlink(dataDirectory)
+	paths := getConfigSnapshotPaths(dataDirectory)
+	files, err := collectConfigFiles(paths, "")
+	tracelog.ErrorLogger.FatalfOnError("Failed to collect configuration files: %v\n", err)
+	if len(files) == 0 {
+		tracelog.ErrorLogger.Fatalf("No configuration files found in %s\n", dataDirectory)
+	}
+
+	sentinel := ConfigSnapshotSentinelDto{
+		Files:    files,
+		DataDir:  dataDirectory,
+		Time:     utility.TimeNowCrossPlatformUTC(),
+		UserData: GetSentinelUserData(),
+	}
+	sentinel.Hostname, _ = os.Hostname()
+	if content, err := ioutil.ReadFile(filepath.Join(dataDirectory, pgVersionFileName)); err == nil {
+		sentinel.PgVersion, _ = parsePgVersion(string(content))
+	}
+	if pgControl, err := ioutil.ReadFile(filepath.Join(dataDirectory, PgControlPath)); err == nil {
+		sentinel.SystemIdentifier = parseSystemIdentifier(pgControl)
+	}
+
+	snapshotName := ConfigSnapshotPrefix + sentinel.Time.Format(utility.BackupTimeFormat)
+	uploader.UploadingFolder = uploader.UploadingFolder.GetSubFolder(utility.ConfigPath)
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(writeConfigSnapshotTar(files, writer))
+	}()
+	err = uploader.PushStreamAs(reader, snapshotName)
+	tracelog.ErrorLogger.FatalfOnError("Failed to upload configuration files: %v\n", err)
+	err = UploadSentinel(uploader, &sentinel, snapshotName)
+	tracelog.ErrorLogger.FatalfOnError("Failed to upload configuration snapshot sentinel: %v\n", err)
+	tracelog.InfoLogger.Printf("Configuration snapshot %s of %d files is uploaded\n", snapshotName, len(files))
+}
+
+// isConfigSnapshotBefore checks if the object belongs to a configuration snapshot made before the given time,
+// so delete retention removes snapshots older than the oldest kept backup
+func isConfigSnapshotBefore(objectName string, before time.Time) bool {
+	snapshotPrefix := utility.ConfigPath + ConfigSnapshotPrefix
+	if !strings.HasPrefix(objectName, snapshotPrefix) || len(objectName) < len(snapshotPrefix)+len(utility.BackupTimeFormat) {
+		return false
+	}
+	timeStr := objectName[len(snapshotPrefix) : len(snapshotPrefix)+len(utility.BackupTimeFormat)]
+	snapshotTime, err := time.Parse(utility.BackupTimeFormat, timeStr)
+	return err == nil && snapshotTime.Before(before)
+}
+
+// getConfigSnapshotPaths returns paths of configuration files in the data directory, files reported by Postgres
+// and WALG_BACKUP_CONFIG_PATHS
+func getConfigSnapshotPaths(dataDirectory string) []string {
+	paths := make([]string, 0)
+	for _, fileName := range configSnapshotDataFiles {
+		paths = append(paths, filepath.Join(dataDirectory, fileName))
+	}
+	paths = append(paths, GetBackupConfigPaths()...)
+
+	conn, err := Connect()
+	if err != nil {
+		tracelog.WarningLogger.Printf("Postgres is not available, only files of the data directory are stored: %v\n", err)
+		return paths
+	}
+	defer utility.LoggedClose(conn, "")
+	queryRunner, err := newPgQueryRunner(conn)
+	if err == nil {
+		var configPaths, sslPaths []string
+		var sslKeyPath string
+		configPaths, err = queryRunner.getConfigFilePaths()
+		if err == nil {
+			paths = append(paths, configPaths...)
+			paths = append(paths, filepath.Join(filepath.Dir(configPaths[0]), configIncludeDirectory))
+			sslPaths, sslKeyPath, err = queryRunner.getSslFilePaths()
+		}
+		if sslKeyPath != "" {
+			sslPaths = appendSslKeyPath(sslPaths, sslKeyPath)
+		}
+		for _, sslPath := range sslPaths {
+			if !filepath.IsAbs(sslPath) {
+				sslPath = filepath.Join(dataDirectory, sslPath)
+			}
+			paths = append(paths, sslPath)
+		}
+	}
+	if err != nil {
+		tracelog.WarningLogger.Printf("Failed to get configuration files from Postgres: %v\n", err)
+	}
+	return paths
+}
+
+// appendSslKeyPath adds the SSL private key to stored files only if snapshots are encrypted
+func appendSslKeyPath(sslPaths []string, keyPath string) []string {
+	if ConfigureCrypterForContentType(BackupContentType) == nil {
+		tracelog.WarningLogger.Printf("SSL key %s is not stored, since encryption is not configured\n", keyPath)
+		return sslPaths
+	}
+	return append(sslPaths, keyPath)
+}
+
+func writeConfigSnapshotTar(files []string, writer io.Writer) error {
+	tarWriter := tar.NewWriter(writer)
+	for _, filePath := range files {
+		if err := writeConfigSnapshotFile(tarWriter, filePath); err != nil {
+			return err
+		}
+		tracelog.InfoLogger.Println(filePath)
+	}
+	return tarWriter.Close()
+}
+
+func writeConfigSnapshotFile(tarWriter *tar.Writer, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s", filePath)
+	}
+	defer utility.LoggedClose(file, "")
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return errors.Wrapf(err, "failed to grab header info of %s", filePath)
+	}
+	header.Name = filePath
+	if err = tarWriter.WriteHeader(header); err != nil {
+		return errors.Wrapf(err, "failed to write header of %s", filePath)
+	}
+	_, err = io.Copy(tarWriter, &io.LimitedReader{R: file, N: header.Size})
+	return errors.Wrapf(err, "failed to pack %s", filePath)
+}
+
+// HandleConfigFetch is invoked to perform wal-g config-fetch. Files of the snapshot are restored
+// to their original locations, or under targetDirectory if it is set, e.g. to compare them with the current ones.
+func HandleConfigFetch(folder storage.Folder, snapshotName, targetDirectory string) {
+	snapshot, err := GetBackupByName(snapshotName, utility.ConfigPath, folder)
+	tracelog.ErrorLogger.FatalfOnError("Failed to fetch configuration snapshot: %v\n", err)
+	var sentinel ConfigSnapshotSentinelDto
+	err = FetchStreamSentinel(snapshot, &sentinel)
+	tracelog.ErrorLogger.FatalfOnError("Failed to fetch configuration snapshot: %v\n", err)
+	if targetDirectory == "" {
+		warnOnSystemIdentifierMismatch(sentinel)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(DownloadAndDecompressStream(snapshot, writer))
+	}()
+	err = extractConfigSnapshot(reader, targetDirectory)
+	_ = reader.CloseWithError(err)
+	tracelog.ErrorLogger.FatalfOnError("Failed to fetch configuration snapshot: %v\n", err)
+	tracelog.InfoLogger.Printf("Restored %d configuration files of snapshot %s\n", len(sentinel.Files), snapshot.Name)
+}
+
+// warnOnSystemIdentifierMismatch warns if configuration of another cluster is restored
+func warnOnSystemIdentifierMismatch(sentinel ConfigSnapshotSentinelDto) {
+	if sentinel.SystemIdentifier == nil {
+		return
+	}
+	pgControl, err := ioutil.ReadFile(filepath.Join(sentinel.DataDir, PgControlPath))
+	if err != nil {
+		return
+	}
+	systemIdentifier := parseSystemIdentifier(pgControl)
+	if systemIdentifier != nil && *systemIdentifier != *sentinel.SystemIdentifier {
+		tracelog.WarningLogger.Printf("Snapshot was made on cluster %d, but %s belongs to cluster %d\n",
+			*sentinel.SystemIdentifier, sentinel.DataDir, *systemIdentifier)
+	}
+}
+
+func extractConfigSnapshot(reader io.Reader, targetDirectory string) error {
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read configuration snapshot")
+		}
+		filePath := filepath.Join(targetDirectory, header.Name)
+		if err = os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(header.Mode))
+		if err != nil {
+			return errors.Wrapf(err, "failed to create %s", filePath)
+		}
+		_, err = io.Copy(file, tarReader)
+		utility.LoggedClose(file, "")
+		if err != nil {
+			return errors.Wrapf(err, "failed to write %s", filePath)
+		}
+		tracelog.InfoLogger.Println(filePath)
+	}
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigSnapshotRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config_snapshot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dataDirectory := filepath.Join(dir, "data")
+	require.NoError(t, os.MkdirAll(filepath.Join(dataDirectory, configIncludeDirectory), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dataDirectory, "postgresql.conf"), []byte("port = 5432"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dataDirectory, configIncludeDirectory, "extra.conf"),
+		[]byte("work_mem = 4MB"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dataDirectory, pgVersionFileName), []byte("12\n"), 0600))
+
+	paths := make([]string, 0)
+	for _, fileName := range configSnapshotDataFiles {
+		paths = append(paths, filepath.Join(dataDirectory, fileName))
+	}
+	files, err := collectConfigFiles(paths, "")
+	require.NoError(t, err)
+	assert.Len(t, files, 3)
+
+	var snapshot bytes.Buffer
+	require.NoError(t, writeConfigSnapshotTar(files, &snapshot))
+	targetDirectory := filepath.Join(dir, "target")
+	require.NoError(t, extractConfigSnapshot(&snapshot, targetDirectory))
+
+	content, err := ioutil.ReadFile(filepath.Join(targetDirectory, dataDirectory, configIncludeDirectory, "extra.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "work_mem = 4MB", string(content))
+	content, err = ioutil.ReadFile(filepath.Join(targetDirectory, dataDirectory, "postgresql.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "port = 5432", string(content))
+}
+
+func TestAppendSslKeyPath_OnlyWithEncryption(t *testing.T) {
+	sslPaths := []string{"/etc/ssl/server.crt"}
+	assert.Equal(t, sslPaths, appendSslKeyPath(sslPaths, "/etc/ssl/server.key"))
+
+	viper.Set(PgpKeyPathSetting, "../test/testdata/waleGpgKey")
+	defer viper.Set(PgpKeyPathSetting, nil)
+	assert.Equal(t, []string{"/etc/ssl/server.crt", "/etc/ssl/server.key"},
+		appendSslKeyPath(sslPaths, "/etc/ssl/server.key"))
+}
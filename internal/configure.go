@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -17,6 +20,7 @@ import (
 	"github.com/wal-g/wal-g/internal/compression"
 	"github.com/wal-g/wal-g/internal/crypto"
 	"github.com/wal-g/wal-g/internal/crypto/awskms"
+	"github.com/wal-g/wal-g/internal/crypto/envelope"
 	"github.com/wal-g/wal-g/internal/crypto/openpgp"
 	"golang.org/x/time/rate"
 )
@@ -29,6 +33,10 @@ const (
 
 const MinAllowedConcurrency = 1
 
+// CrypterConfigurationErrorExitCode is the exit code of archiving commands in case of crypter
+// misconfiguration (EX_CONFIG from sysexits.h). It allows to tell it apart from storage or database failures.
+const CrypterConfigurationErrorExitCode = 78
+
 var DeprecatedExternalGpgMessage = fmt.Sprintf(
 	`You are using deprecated functionality that uses an external gpg library.
 It will be removed in next major version.
@@ -83,6 +91,18 @@ func (err InvalidConcurrencyValueError) Error() string {
 	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
 }
 
+type CrypterConfigurationError struct {
+	error
+}
+
+func newCrypterConfigurationError(contentType ContentType, err error) CrypterConfigurationError {
+	return CrypterConfigurationError{errors.Wrapf(err, "crypter for %s objects is misconfigured", contentType)}
+}
+
+func (err CrypterConfigurationError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
 type UnmarshallingError struct {
 	error
 }
@@ -113,6 +133,46 @@ func ConfigureFolder() (storage.Folder, error) {
 	return ConfigureFolderForSpecificConfig(viper.GetViper())
 }
 
+// ConfigureFetchFailoverFolder configures the storage used to retry tar parts
+// which failed to be fetched from the primary one.
+// Returns `<nil>` folder if no failover storage is configured.
+func ConfigureFetchFailoverFolder() (storage.Folder, error) {
+	configFile, ok := GetSetting(FetchFailoverConfigSetting)
+	if !ok || configFile == "" {
+		return nil, nil
+	}
+	folder, err := configureFolderFromConfigFile(configFile)
+	return folder, errors.Wrapf(err, "failed to configure failover storage from %s", configFile)
+}
+
+// ConfigureUploadMirrorFolders configures storages which should receive copies of uploaded objects.
+// Folders are returned by the config file path, empty map is returned if no mirrors are configured.
+func ConfigureUploadMirrorFolders() (map[string]storage.Folder, error) {
+	folders := make(map[string]storage.Folder)
+	configFiles, ok := GetSetting(UploadMirrorConfigsSetting)
+	if !ok || configFiles == "" {
+		return folders, nil
+	}
+	for _, configFile := range strings.Split(configFiles, ",") {
+		configFile = strings.TrimSpace(configFile)
+		folder, err := configureFolderFromConfigFile(configFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to configure mirror storage from %s", configFile)
+		}
+		folders[configFile] = folder
+	}
+	return folders, nil
+}
+
+func configureFolderFromConfigFile(configFile string) (storage.Folder, error) {
+	var config = viper.New()
+	SetDefaultValues(config)
+	ReadConfigFromFile(config, configFile)
+	CheckAllowedSettings(config)
+
+	return ConfigureFolderForSpecificConfig(config)
+}
+
 func ConfigureFolderForSpecificConfig(config *viper.Viper) (storage.Folder, error) {
 	skippedPrefixes := make([]string, 0)
 	for _, adapter := range StorageAdapters {
@@ -215,6 +275,7 @@ func ConfigureUploader() (uploader *Uploader, err error) {
 	}
 
 	uploader = NewUploader(compressor, folder)
+	err = configureUploadMemoryBudget(uploader)
 	return uploader, err
 }
 
@@ -236,9 +297,26 @@ func ConfigureWalUploader() (uploader *WalUploader, err error) {
 	}
 
 	uploader = NewWalUploader(compressor, folder, deltaFileManager)
+	err = configureUploadMemoryBudget(uploader.Uploader)
 	return uploader, err
 }
 
+// configureUploadMemoryBudget enables background compression of tarballs if UploadMemoryLimitSetting is set
+func configureUploadMemoryBudget(uploader *Uploader) error {
+	limitStr, ok := GetSetting(UploadMemoryLimitSetting)
+	if !ok || limitStr == "" {
+		return nil
+	}
+	limit, err := strconv.ParseInt(limitStr, 10, 64)
+	if err != nil {
+		return fmt.Errorf("integer expected for %s setting but given '%s': %w", UploadMemoryLimitSetting, limitStr, err)
+	}
+	if limit > 0 {
+		uploader.memoryBudget = newUploadMemoryBudget(limit)
+	}
+	return nil
+}
+
 func ConfigureUploaderWithoutCompressMethod() (uploader *Uploader, err error) {
 	folder, err := ConfigureFolder()
 	if err != nil {
@@ -269,33 +347,236 @@ func ConfigureWalUploaderWithoutCompressMethod() (uploader *WalUploader, err err
 	return uploader, err
 }
 
+// ContentType defines the kind of stored objects. Each kind may be encrypted with its own crypter.
+type ContentType int
+
+const (
+	// BackupContentType is used for base backups and backup streams
+	BackupContentType ContentType = iota
+	// LogContentType is used for WAL, oplog and binlog archives
+	LogContentType
+)
+
+func (contentType ContentType) String() string {
+	switch contentType {
+	case BackupContentType:
+		return "backup"
+	case LogContentType:
+		return "log"
+	default:
+		return "unknown"
+	}
+}
+
+var contentTypeCryptoConfigSettings = map[ContentType]string{
+	BackupContentType: BackupCryptoConfigSetting,
+	LogContentType:    LogCryptoConfigSetting,
+}
+
 // ConfigureCrypter uses environment variables to create and configure a crypter.
 // In case no configuration in environment variables found, return `<nil>` value.
 func ConfigureCrypter() crypto.Crypter {
+	return configureCrypterFrom(viper.GetViper())
+}
+
+// ConfigureCrypterForContentType creates a crypter for objects of the given type.
+// If the crypto config file is set for this type, crypter is configured from it,
+// otherwise the common crypto settings are used.
+// With envelope encryption the crypter is used as master key for per-object data keys.
+// Crypters are resolved once per crypto configuration and reused by subsequent calls.
+func ConfigureCrypterForContentType(contentType ContentType) crypto.Crypter {
+	key := crypterCacheKey(contentType)
+	crypterCache.Lock()
+	defer crypterCache.Unlock()
+	if crypter, ok := crypterCache.crypters[key]; ok {
+		return crypter
+	}
+	crypter := configureCrypterForContentType(contentType)
+	crypterCache.crypters[key] = crypter
+	return crypter
+}
+
+// crypterCache holds crypters by their crypto configuration,
+// so config files and keys are not read again for every archived file.
+var crypterCache = struct {
+	sync.Mutex
+	crypters map[string]crypto.Crypter
+}{crypters: make(map[string]crypto.Crypter)}
+
+// crypterSettings are the settings which determine the crypter of a content type
+var crypterSettings = []string{
+	PgpKeySetting,
+	PgpKeyPathSetting,
+	PgpKeyPassphraseSetting,
+	"WALG_" + GpgKeyIDSetting,
+	"WALE_" + GpgKeyIDSetting,
+	CseKmsIDSetting,
+	CseKmsRegionSetting,
+	LibsodiumKeySetting,
+	LibsodiumKeyPathSetting,
+	EnvelopeEncryptionSetting,
+}
+
+func crypterCacheKey(contentType ContentType) string {
+	values := []string{contentType.String(), viper.GetString(contentTypeCryptoConfigSettings[contentType])}
+	for _, setting := range crypterSettings {
+		values = append(values, viper.GetString(setting))
+	}
+	return strings.Join(values, "\x00")
+}
+
+func configureCrypterForContentType(contentType ContentType) crypto.Crypter {
+	config := cryptoConfigForContentType(contentType)
+	crypter := configureCrypterFrom(config)
+	if crypter == nil {
+		return nil
+	}
+	enabled, err := getBoolSettingFrom(config, EnvelopeEncryptionSetting, false)
+	tracelog.ErrorLogger.FatalfOnError("Can not parse envelope encryption setting: %v", err)
+	if !enabled {
+		return crypter
+	}
+	keys, err := ConfigureEnvelopeKeyStore(contentType)
+	tracelog.ErrorLogger.FatalfOnError("Can not configure envelope encryption key store: %v", err)
+	return envelope.NewCrypter(crypter, keys)
+}
+
+// ConfigureMasterCrypterForContentType creates a crypter for objects of the given type without envelope encryption.
+func ConfigureMasterCrypterForContentType(contentType ContentType) crypto.Crypter {
+	return configureCrypterFrom(cryptoConfigForContentType(contentType))
+}
+
+// ConfigureCrypterFromConfigFile creates a crypter from crypto settings of the config file.
+func ConfigureCrypterFromConfigFile(configFile string) crypto.Crypter {
+	return configureCrypterFrom(readCryptoConfigFile(configFile))
+}
+
+// cryptoConfigForContentType returns crypto settings of the given type:
+// the crypto config file if it is set for this type, otherwise the common settings.
+// Envelope encryption is enabled by the same settings as the master key.
+func cryptoConfigForContentType(contentType ContentType) *viper.Viper {
+	configFile, ok := GetSetting(contentTypeCryptoConfigSettings[contentType])
+	if !ok || configFile == "" {
+		return viper.GetViper()
+	}
+	return readCryptoConfigFile(configFile)
+}
+
+func readCryptoConfigFile(configFile string) *viper.Viper {
+	var config = viper.New()
+	ReadConfigFromFile(config, configFile)
+	CheckAllowedSettings(config)
+	return config
+}
+
+func getBoolSettingFrom(config *viper.Viper, setting string, def bool) (bool, error) {
+	if !config.IsSet(setting) {
+		return def, nil
+	}
+	return strconv.ParseBool(config.GetString(setting))
+}
+
+// ConfigureEnvelopeKeyStore creates a store of wrapped data keys for objects of the given type.
+func ConfigureEnvelopeKeyStore(contentType ContentType) (*envelope.FolderKeyStore, error) {
+	folder, err := ConfigureFolder()
+	if err != nil {
+		return nil, err
+	}
+	return envelope.NewFolderKeyStore(folder.GetSubFolder(envelope.KeysPath).GetSubFolder(contentType.String())), nil
+}
+
+// CheckCrypterForContentType verifies that the crypter configured for given content type
+// is able to encrypt data and decrypt it back. Returns `<nil>` if encryption is not configured.
+// With envelope encryption the master crypter is verified, so no data key is stored by the check.
+func CheckCrypterForContentType(contentType ContentType) error {
+	crypter := ConfigureMasterCrypterForContentType(contentType)
+	if crypter == nil {
+		return nil
+	}
+	if err := crypto.VerifyCrypter(crypter); err != nil {
+		return newCrypterConfigurationError(contentType, err)
+	}
+	return nil
+}
+
+// CheckCrypterConfigured is called by archiving commands before they start to consume the source stream.
+// It returns CrypterConfigurationError if crypter for any of given content types is misconfigured.
+func CheckCrypterConfigured(contentTypes ...ContentType) error {
+	for _, contentType := range contentTypes {
+		if err := CheckCrypterForContentType(contentType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CrypterConfigurationStatusEvent is written to stderr as a single JSON line when archiving is not started
+// because of crypter misconfiguration, so monitoring can tell it apart without parsing the log.
+type CrypterConfigurationStatusEvent struct {
+	Event    string `json:"event"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error"`
+}
+
+const crypterMisconfiguredEvent = "crypter_misconfigured"
+
+// AssertCrypterConfigured is called by archiving commands before they start to consume the source stream.
+// If crypter for any of given content types is misconfigured, it emits CrypterConfigurationStatusEvent
+// and exits with CrypterConfigurationErrorExitCode.
+func AssertCrypterConfigured(contentTypes ...ContentType) {
+	err := CheckCrypterConfigured(contentTypes...)
+	if err == nil {
+		return
+	}
+	tracelog.ErrorLogger.PrintError(err)
+	tracelog.ErrorLogger.Println("Archiving is not started: fix encryption settings")
+	if err := writeCrypterConfigurationStatusEvent(os.Stderr, err); err != nil {
+		tracelog.WarningLogger.Printf("Failed to write status event: %v\n", err)
+	}
+	os.Exit(CrypterConfigurationErrorExitCode)
+}
+
+func writeCrypterConfigurationStatusEvent(writer io.Writer, crypterErr error) error {
+	event, err := json.Marshal(CrypterConfigurationStatusEvent{
+		Event:    crypterMisconfiguredEvent,
+		ExitCode: CrypterConfigurationErrorExitCode,
+		Error:    crypterErr.Error(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(writer, string(event))
+	return err
+}
+
+func configureCrypterFrom(config *viper.Viper) crypto.Crypter {
 	loadPassphrase := func() (string, bool) {
-		return GetSetting(PgpKeyPassphraseSetting)
+		if config.IsSet(PgpKeyPassphraseSetting) {
+			return config.GetString(PgpKeyPassphraseSetting), true
+		}
+		return "", false
 	}
 
 	// key can be either private (for download) or public (for upload)
-	if viper.IsSet(PgpKeySetting) {
-		return openpgp.CrypterFromKey(viper.GetString(PgpKeySetting), loadPassphrase)
+	if config.IsSet(PgpKeySetting) {
+		return openpgp.CrypterFromKey(config.GetString(PgpKeySetting), loadPassphrase)
 	}
 
 	// key can be either private (for download) or public (for upload)
-	if viper.IsSet(PgpKeyPathSetting) {
-		return openpgp.CrypterFromKeyPath(viper.GetString(PgpKeyPathSetting), loadPassphrase)
+	if config.IsSet(PgpKeyPathSetting) {
+		return openpgp.CrypterFromKeyPath(config.GetString(PgpKeyPathSetting), loadPassphrase)
 	}
 
-	if keyRingID, ok := getWaleCompatibleSetting(GpgKeyIDSetting); ok {
+	if keyRingID, ok := getWaleCompatibleSettingFrom(GpgKeyIDSetting, config); ok {
 		tracelog.WarningLogger.Printf(DeprecatedExternalGpgMessage)
 		return openpgp.CrypterFromKeyRingID(keyRingID, loadPassphrase)
 	}
 
-	if viper.IsSet(CseKmsIDSetting) {
-		return awskms.CrypterFromKeyID(viper.GetString(CseKmsIDSetting), viper.GetString(CseKmsRegionSetting))
+	if config.IsSet(CseKmsIDSetting) {
+		return awskms.CrypterFromKeyID(config.GetString(CseKmsIDSetting), config.GetString(CseKmsRegionSetting))
 	}
 
-	if crypter := configureLibsodiumCrypter(); crypter != nil {
+	if crypter := configureLibsodiumCrypter(config); crypter != nil {
 		return crypter
 	}
 
@@ -306,6 +587,78 @@ func getMaxDownloadConcurrency() (int, error) {
 	return GetMaxConcurrency(DownloadConcurrencySetting)
 }
 
+// getExtractConcurrencies returns directories with their own pools of extraction workers
+func getExtractConcurrencies() (map[string]int, error) {
+	value, _ := GetSetting(ExtractConcurrencySetting)
+	return ParseExtractConcurrencies(value)
+}
+
+// getMaxExtractConcurrency returns how many tars are extracted in parallel during backup-fetch.
+// It is enough to keep busy all directories with their own pools of extraction workers.
+func getMaxExtractConcurrency() (int, error) {
+	concurrency, err := getMaxDownloadConcurrency()
+	if err != nil {
+		return concurrency, err
+	}
+	concurrencies, err := getExtractConcurrencies()
+	if err != nil {
+		return concurrency, err
+	}
+	total := 0
+	for _, directoryConcurrency := range concurrencies {
+		total += directoryConcurrency
+	}
+	if total > concurrency {
+		return total, nil
+	}
+	return concurrency, nil
+}
+
+// getPrefetchDepth returns how many WAL segments ahead wal-fetch prefetches.
+// By default it equals download concurrency, prefetch is disabled if download concurrency is 1.
+func getPrefetchDepth() (int, error) {
+	if !viper.IsSet(PrefetchDepthSetting) {
+		concurrency, err := getMaxDownloadConcurrency()
+		if concurrency == 1 {
+			return 0, err
+		}
+		return concurrency, err
+	}
+	depth := viper.GetInt(PrefetchDepthSetting)
+	if depth < 0 {
+		return 0, newInvalidConcurrencyValueError(PrefetchDepthSetting, depth)
+	}
+	return depth, nil
+}
+
+// getMaxPrefetchConcurrency returns how many WAL segments are prefetched in parallel, download concurrency by default
+func getMaxPrefetchConcurrency() (int, error) {
+	if !viper.IsSet(PrefetchConcurrencySetting) {
+		return getMaxDownloadConcurrency()
+	}
+	return GetMaxConcurrency(PrefetchConcurrencySetting)
+}
+
+// getMirrorSpoolLimits returns the maximum number and total size of objects spooled for mirror storages
+func getMirrorSpoolLimits() (int, int64, error) {
+	queueSize := viper.GetInt(MirrorQueueSizeSetting)
+	if queueSize <= 0 {
+		return 0, 0, errors.Errorf("positive integer expected for %s setting but given '%d'",
+			MirrorQueueSizeSetting, queueSize)
+	}
+	spoolSize := viper.GetInt64(MirrorSpoolSizeSetting)
+	if spoolSize <= 0 {
+		return 0, 0, errors.Errorf("positive integer(bytes) expected for %s setting but given '%d'",
+			MirrorSpoolSizeSetting, spoolSize)
+	}
+	return queueSize, spoolSize, nil
+}
+
+// getPrefetchSpoolLimit returns how many prefetched WAL segments are kept, 0 means no limit
+func getPrefetchSpoolLimit() int {
+	return viper.GetInt(PrefetchSpoolLimitSetting)
+}
+
 func getMaxUploadConcurrency() (int, error) {
 	return GetMaxConcurrency(UploadConcurrencySetting)
 }
@@ -343,6 +696,72 @@ func GetSentinelUserData() interface{} {
 	return out
 }
 
+// excludeProtectedPaths are samples of paths without which the cluster can't start,
+// so exclude patterns must not match them. pg_clog is pg_xact before Postgres 10.
+var excludeProtectedPaths = []string{
+	"global", "global/pg_control", "global/1262", "global/pg_filenode.map",
+	"pg_xact", "pg_xact/0000", "pg_clog", "pg_clog/0000",
+}
+
+// GetBackupExcludePatterns returns comma-separated glob patterns of paths which backup-push should skip
+func GetBackupExcludePatterns() ([]string, error) {
+	patterns := make([]string, 0)
+	patternsStr, ok := GetSetting(BackupExcludePatternsSetting)
+	if !ok || patternsStr == "" {
+		return patterns, nil
+	}
+	for _, pattern := range strings.Split(patternsStr, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if strings.Trim(pattern, "/") == "" {
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern '%s' in %s", pattern, BackupExcludePatternsSetting)
+		}
+		for _, protectedPath := range excludeProtectedPaths {
+			if matchesExcludePatterns([]string{pattern}, protectedPath) {
+				return nil, errors.Errorf("pattern '%s' in %s excludes '%s', which is required to start the cluster",
+					pattern, BackupExcludePatternsSetting, protectedPath)
+			}
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// GetBackupExcludeRelations returns comma-separated relations given as database.schema.relation,
+// which backup-push should skip
+func GetBackupExcludeRelations() []string {
+	relations := make([]string, 0)
+	relationsStr, ok := GetSetting(BackupExcludeRelsSetting)
+	if !ok {
+		return relations
+	}
+	for _, relation := range strings.Split(relationsStr, ",") {
+		relation = strings.TrimSpace(relation)
+		if relation != "" {
+			relations = append(relations, relation)
+		}
+	}
+	return relations
+}
+
+// GetBackupConfigPaths returns comma-separated paths of configuration files and directories
+// which backup-push should capture in addition to the ones reported by the server
+func GetBackupConfigPaths() []string {
+	paths := make([]string, 0)
+	pathsStr, ok := GetSetting(BackupConfigPathsSetting)
+	if !ok {
+		return paths
+	}
+	for _, path := range strings.Split(pathsStr, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
 func GetCommandSettingContext(ctx context.Context, variableName string) (*exec.Cmd, error) {
 	dataStr, ok := GetSetting(variableName)
 	if !ok {
@@ -385,6 +804,54 @@ func GetOplogArchiveAfterSize() (int, error) {
 	return oplogArchiveAfterSize, nil
 }
 
+func GetOplogArchiveCompressedSize() (int, error) {
+	compressedSizeStr, _ := GetSetting(OplogArchiveCompressedSize)
+	compressedSize, err := strconv.Atoi(compressedSizeStr)
+	if err != nil {
+		return 0, fmt.Errorf("integer expected for %s setting but given '%s': %w", OplogArchiveCompressedSize, compressedSizeStr, err)
+	}
+	return compressedSize, nil
+}
+
+func GetStreamPartSize() (int64, error) {
+	partSizeStr, _ := GetSetting(StreamPartSizeSetting)
+	partSize, err := strconv.ParseInt(partSizeStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("integer expected for %s setting but given '%s': %w", StreamPartSizeSetting, partSizeStr, err)
+	}
+	return partSize, nil
+}
+
+func GetOplogBatchSize() (int, error) {
+	oplogBatchSizeStr, _ := GetSetting(OplogBatchSize)
+	oplogBatchSize, err := strconv.Atoi(oplogBatchSizeStr)
+	if err != nil {
+		return 0, fmt.Errorf("integer expected for %s setting but given '%s': %w", OplogBatchSize, oplogBatchSizeStr, err)
+	}
+	return oplogBatchSize, nil
+}
+
+func GetOplogReplayPrefetch() (int, error) {
+	oplogReplayPrefetchStr, _ := GetSetting(OplogReplayPrefetch)
+	oplogReplayPrefetch, err := strconv.Atoi(oplogReplayPrefetchStr)
+	if err != nil {
+		return 0, fmt.Errorf("integer expected for %s setting but given '%s': %w", OplogReplayPrefetch, oplogReplayPrefetchStr, err)
+	}
+	if oplogReplayPrefetch < 0 {
+		return 0, fmt.Errorf("non-negative integer expected for %s setting but given '%d'", OplogReplayPrefetch, oplogReplayPrefetch)
+	}
+	return oplogReplayPrefetch, nil
+}
+
+func GetOplogBatchTimeout() (time.Duration, error) {
+	oplogBatchTimeoutStr, _ := GetSetting(OplogBatchTimeout)
+	oplogBatchTimeout, err := strconv.Atoi(oplogBatchTimeoutStr)
+	if err != nil {
+		return 0, fmt.Errorf("integer(seconds) expected for %s setting but given '%s': %w", OplogBatchTimeout, oplogBatchTimeoutStr, err)
+	}
+	return time.Duration(oplogBatchTimeout) * time.Second, nil
+}
+
 func GetLastWriteUpdateInterval() (time.Duration, error) {
 	intervalStr, _ := GetSetting(MongoDBLastWriteUpdateSeconds)
 	interval, err := strconv.Atoi(intervalStr)
@@ -394,6 +861,18 @@ func GetLastWriteUpdateInterval() (time.Duration, error) {
 	return time.Duration(interval) * time.Second, nil
 }
 
+func GetMongoDBRestoreRateLimit() (int64, error) {
+	rateLimitStr, _ := GetSetting(MongoDBRestoreRateLimit)
+	rateLimit, err := strconv.ParseInt(rateLimitStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("integer(bytes per second) expected for %s setting but given '%s': %w", MongoDBRestoreRateLimit, rateLimitStr, err)
+	}
+	if rateLimit < 0 {
+		return 0, fmt.Errorf("non-negative integer expected for %s setting but given '%d'", MongoDBRestoreRateLimit, rateLimit)
+	}
+	return rateLimit, nil
+}
+
 func GetDurationSetting(setting string) (time.Duration, error) {
 	intervalStr, _ := GetSetting(setting)
 	interval, err := strconv.Atoi(intervalStr)
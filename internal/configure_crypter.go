@@ -14,9 +14,10 @@ package internal
 // If there is a tag, we can configure the correct implementation of crypter.
 
 import (
+	"github.com/spf13/viper"
 	"github.com/wal-g/wal-g/internal/crypto"
 )
 
-func configureLibsodiumCrypter() crypto.Crypter {
+func configureLibsodiumCrypter(config *viper.Viper) crypto.Crypter {
 	return nil
 }
@@ -0,0 +1,24 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteCrypterConfigurationStatusEvent(t *testing.T) {
+	var buffer bytes.Buffer
+	err := writeCrypterConfigurationStatusEvent(&buffer, errors.New("wrong passphrase"))
+	assert.NoError(t, err)
+
+	var event CrypterConfigurationStatusEvent
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &event))
+	assert.Equal(t, CrypterConfigurationStatusEvent{
+		Event:    "crypter_misconfigured",
+		ExitCode: CrypterConfigurationErrorExitCode,
+		Error:    "wrong passphrase",
+	}, event)
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/crypto/envelope"
+	"github.com/wal-g/wal-g/internal/crypto/openpgp"
 )
 
 func TestGetMaxConcurrency_InvalidKey(t *testing.T) {
@@ -62,6 +64,31 @@ func TestGetSentinelUserData(t *testing.T) {
 	assert.NotNilf(t, data, "Unable to parse WALG_SENTINEL_USER_DATA")
 }
 
+func TestGetBackupExcludePatterns(t *testing.T) {
+	viper.Set(internal.BackupExcludePatternsSetting, " log/*, *.core ,,")
+	defer viper.Set(internal.BackupExcludePatternsSetting, nil)
+
+	patterns, err := internal.GetBackupExcludePatterns()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"log/*", "*.core"}, patterns)
+
+	viper.Set(internal.BackupExcludePatternsSetting, "log/[")
+	_, err = internal.GetBackupExcludePatterns()
+	assert.Error(t, err)
+}
+
+func TestGetBackupExcludePatterns_RejectsRequiredPaths(t *testing.T) {
+	defer viper.Set(internal.BackupExcludePatternsSetting, nil)
+	for _, patterns := range []string{"pg_control", "/global", "global/*", "pg_xact", "pg_xact/*", "pg_clog", "[0-9]*", "*"} {
+		viper.Set(internal.BackupExcludePatternsSetting, "log/*,"+patterns)
+		_, err := internal.GetBackupExcludePatterns()
+		assert.Error(t, err, patterns)
+	}
+	viper.Set(internal.BackupExcludePatternsSetting, "global/*.tmp,pg_xact_backup,base/*/core.*")
+	_, err := internal.GetBackupExcludePatterns()
+	assert.NoError(t, err)
+}
+
 func TestGetDataFolderPath_Default(t *testing.T) {
 	viper.Set(internal.PgDataSetting, nil)
 
@@ -145,3 +172,53 @@ func prepareDataFolder(t *testing.T, name string) string {
 	fmt.Println(dir)
 	return dir
 }
+
+func TestConfigureCrypterForContentType_UsesContentTypeConfig(t *testing.T) {
+	configFile, err := ioutil.TempFile("", "walg_log_crypto*.json")
+	assert.NoError(t, err)
+	defer os.Remove(configFile.Name())
+	_, err = configFile.WriteString(`{"WALG_PGP_KEY_PATH": "../test/testdata/waleGpgKey"}`)
+	assert.NoError(t, err)
+	assert.NoError(t, configFile.Close())
+
+	viper.Set(internal.LogCryptoConfigSetting, configFile.Name())
+	defer viper.Set(internal.LogCryptoConfigSetting, nil)
+
+	logCrypter := internal.ConfigureCrypterForContentType(internal.LogContentType)
+	assert.IsType(t, &openpgp.Crypter{}, logCrypter)
+	assert.Equal(t, "../test/testdata/waleGpgKey", logCrypter.(*openpgp.Crypter).ArmoredKeyPath)
+
+	assert.Nil(t, internal.ConfigureCrypterForContentType(internal.BackupContentType))
+}
+
+func TestCheckCrypterForContentType(t *testing.T) {
+	viper.Set(internal.PgpKeyPathSetting, "../test/testdata/waleGpgKey")
+	assert.NoError(t, internal.CheckCrypterForContentType(internal.BackupContentType))
+
+	viper.Set(internal.PgpKeyPathSetting, "../test/testdata/nonexistentKey")
+	defer viper.Set(internal.PgpKeyPathSetting, nil)
+	err := internal.CheckCrypterForContentType(internal.BackupContentType)
+	assert.IsType(t, internal.CrypterConfigurationError{}, err)
+}
+
+func TestConfigureCrypterForContentType_EnvelopeEncryptionFromContentTypeConfig(t *testing.T) {
+	storageDir, err := ioutil.TempDir("", "walg_storage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(storageDir)
+	viper.Set("WALG_FILE_PREFIX", storageDir)
+	defer viper.Set("WALG_FILE_PREFIX", nil)
+
+	configFile, err := ioutil.TempFile("", "walg_log_crypto*.json")
+	assert.NoError(t, err)
+	defer os.Remove(configFile.Name())
+	_, err = configFile.WriteString(`{"WALG_PGP_KEY_PATH": "../test/testdata/waleGpgKey", "WALG_ENVELOPE_ENCRYPTION": "true"}`)
+	assert.NoError(t, err)
+	assert.NoError(t, configFile.Close())
+	viper.Set(internal.LogCryptoConfigSetting, configFile.Name())
+	defer viper.Set(internal.LogCryptoConfigSetting, nil)
+	viper.Set(internal.PgpKeyPathSetting, "../test/testdata/waleGpgKey")
+	defer viper.Set(internal.PgpKeyPathSetting, nil)
+
+	assert.IsType(t, &envelope.Crypter{}, internal.ConfigureCrypterForContentType(internal.LogContentType))
+	assert.IsType(t, &openpgp.Crypter{}, internal.ConfigureCrypterForContentType(internal.BackupContentType))
+}
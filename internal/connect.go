@@ -1,6 +1,12 @@
 package internal
 
 import (
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+
 	"github.com/jackc/pgx"
 	"github.com/pkg/errors"
 	"github.com/wal-g/tracelog"
@@ -60,3 +66,72 @@ func Connect() (*pgx.Conn, error) {
 
 	return conn, nil
 }
+
+// ConnectReplication establishes a connection to postgres in replication mode,
+// which is used to take base backup with BASE_BACKUP command.
+// Connection parameters are taken from the same environment variables as in Connect.
+func ConnectReplication() (*pgx.ReplicationConn, error) {
+	config, err := pgx.ParseEnvLibpq()
+	if err != nil {
+		return nil, errors.Wrap(err, "ConnectReplication: unable to read environment variables")
+	}
+	conn, err := pgx.ReplicationConnect(config)
+	return conn, errors.Wrap(err, "ConnectReplication: postgres replication connection failed")
+}
+
+// connectReplicationWithNetConn establishes a replication connection like ConnectReplication does
+// and also returns the network connection under it. pgx reads only the first result set of a command
+// and ignores the end of START_REPLICATION streaming, so BASE_BACKUP and START_REPLICATION are run
+// over the network connection. TLS is negotiated here instead of pgx, so that the returned connection is the encrypted one.
+func connectReplicationWithNetConn() (*pgx.ReplicationConn, net.Conn, error) {
+	config, err := pgx.ParseEnvLibpq()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "ConnectReplication: unable to read environment variables")
+	}
+	tlsConfigs := []*tls.Config{config.TLSConfig}
+	if config.UseFallbackTLS {
+		tlsConfigs = append(tlsConfigs, config.FallbackTLSConfig)
+	}
+	config.TLSConfig, config.UseFallbackTLS, config.FallbackTLSConfig = nil, false, nil
+	dial := config.Dial
+	if dial == nil {
+		dial = (&net.Dialer{KeepAlive: 5 * time.Minute}).Dial
+	}
+
+	var conn *pgx.ReplicationConn
+	for _, tlsConfig := range tlsConfigs {
+		var netConn net.Conn
+		config.Dial = func(network, address string) (net.Conn, error) {
+			dialedConn, err := dial(network, address)
+			if err == nil && tlsConfig != nil {
+				dialedConn, err = startTLS(dialedConn, tlsConfig)
+			}
+			netConn = dialedConn
+			return dialedConn, err
+		}
+		conn, err = pgx.ReplicationConnect(config)
+		if err == nil {
+			return conn, netConn, nil
+		}
+	}
+	return nil, nil, errors.Wrap(err, "ConnectReplication: postgres replication connection failed")
+}
+
+// startTLS sends SSLRequest and wraps the connection with TLS, the same way as pgx does
+func startTLS(conn net.Conn, tlsConfig *tls.Config) (net.Conn, error) {
+	err := binary.Write(conn, binary.BigEndian, []int32{8, 80877103})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	response := make([]byte, 1)
+	if _, err = io.ReadFull(conn, response); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if response[0] != 'S' {
+		_ = conn.Close()
+		return nil, pgx.ErrTLSRefused
+	}
+	return tls.Client(conn, tlsConfig), nil
+}
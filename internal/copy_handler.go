@@ -5,6 +5,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/pkg/errors"
 	"github.com/wal-g/storages/storage"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/utility"
@@ -17,13 +18,13 @@ type CopyingInfo struct {
 }
 
 // HandleCopy copy specific or all backups from one storage to another
-func HandleCopy(fromConfigFile string, toConfigFile string, backupName string, withoutHistory bool) {
+func HandleCopy(fromConfigFile string, toConfigFile string, backupNames []string, withoutHistory bool, walUntil string) {
 	var from, fromError = ConfigureFolderFromConfig(fromConfigFile)
 	var to, toError = ConfigureFolderFromConfig(toConfigFile)
 	if fromError != nil || toError != nil {
 		return
 	}
-	infos, err := getCopyingInfoToCopy(backupName, from, to, withoutHistory)
+	infos, err := getCopyingInfoToCopy(backupNames, from, to, withoutHistory, walUntil)
 	tracelog.ErrorLogger.FatalOnError(err)
 	isSuccess, err := StartCopy(infos)
 	tracelog.ErrorLogger.FatalOnError(err)
@@ -67,8 +68,8 @@ func copyObject(info CopyingInfo, wg *sync.WaitGroup, errors chan error) {
 		errors <- err
 		return
 	}
-	var filename = path.Join(from.GetPath(), objectName)
-	err = to.PutObject(filename, readCloser)
+	defer utility.LoggedClose(readCloser, "")
+	err = to.PutObject(objectName, readCloser)
 	if err != nil {
 		errors <- err
 		return
@@ -76,58 +77,124 @@ func copyObject(info CopyingInfo, wg *sync.WaitGroup, errors chan error) {
 	tracelog.InfoLogger.Printf("Copied '%s' from '%s' to '%s'.", objectName, from.GetPath(), to.GetPath())
 }
 
-func getCopyingInfoToCopy(backupName string, from storage.Folder, to storage.Folder, withoutHistory bool) ([]CopyingInfo, error) {
-	if backupName == "" {
+func getCopyingInfoToCopy(backupNames []string, from storage.Folder, to storage.Folder,
+	withoutHistory bool, walUntil string) ([]CopyingInfo, error) {
+	if len(backupNames) == 0 {
 		tracelog.InfoLogger.Printf("Copy all backups and history.")
 		return GetAllCopyingInfo(from, to)
 	}
-	tracelog.InfoLogger.Printf("Handle backupname '%s'.", backupName)
-	backup, err := GetBackupByName(backupName, utility.BaseBackupPath, from)
-	if err != nil {
-		return nil, err
+	var lastSegmentNo *WalSegmentNo
+	if walUntil != "" {
+		segmentNo, err := newWalSegmentNoFromFilename(walUntil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid WAL segment name '%s'", walUntil)
+		}
+		lastSegmentNo = &segmentNo
 	}
-
-	infos, err := GetBackupCopyingInfo(backup, from, to)
+	objects, err := storage.ListFolderRecursively(from)
 	if err != nil {
 		return nil, err
 	}
-	if !withoutHistory {
-		var history, err = GetHistoryCopyingInfo(backup, from, to)
+	var infos []CopyingInfo
+	for _, backupName := range backupNames {
+		tracelog.InfoLogger.Printf("Handle backupname '%s'.", backupName)
+		backup, err := GetBackupByName(backupName, utility.BaseBackupPath, from)
 		if err != nil {
 			return nil, err
 		}
-		infos = append(infos, history...)
+		chain, err := getDeltaChain(backup, from)
+		if err != nil {
+			return nil, err
+		}
+		for _, chainBackup := range chain {
+			infos = append(infos, getBackupCopyingInfo(chainBackup, from, to, objects)...)
+		}
+		walInfos, err := getWalCopyingInfo(backup, from, to, objects, !withoutHistory, lastSegmentNo)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, walInfos...)
+	}
+	return uniqueCopyingInfos(infos), nil
+}
+
+// getDeltaChain returns the backup and all backups it is based on, since a delta backup can't be restored without them
+func getDeltaChain(backup *Backup, folder storage.Folder) ([]*Backup, error) {
+	chain := []*Backup{backup}
+	for {
+		sentinelDto, err := backup.GetSentinel()
+		if err != nil {
+			return nil, err
+		}
+		if sentinelDto.IncrementFrom == nil {
+			return chain, nil
+		}
+		tracelog.InfoLogger.Printf("Backup %s is based on %s, it is copied too.", backup.Name, *sentinelDto.IncrementFrom)
+		backup, err = GetBackupByName(*sentinelDto.IncrementFrom, utility.BaseBackupPath, folder)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, backup)
 	}
-	return infos, nil
 }
 
 func GetBackupCopyingInfo(backup *Backup, from storage.Folder, to storage.Folder) ([]CopyingInfo, error) {
-	tracelog.InfoLogger.Print("Collecting backup files...")
-	var backupPrefix = path.Join(utility.BaseBackupPath, backup.Name)
 	var objects, err = storage.ListFolderRecursively(from)
 	if err != nil {
 		return nil, err
 	}
-	var hasBackupPrefix = func(object storage.Object) bool { return strings.HasPrefix(object.GetName(), backupPrefix) }
-	return BuildCopyingInfos(from, to, objects, hasBackupPrefix), nil
+	return getBackupCopyingInfo(backup, from, to, objects), nil
+}
+
+// getBackupCopyingInfo selects files of the backup among objects listed recursively from the storage root
+func getBackupCopyingInfo(backup *Backup, from storage.Folder, to storage.Folder, objects []storage.Object) []CopyingInfo {
+	tracelog.InfoLogger.Print("Collecting backup files...")
+	var backupPrefix = path.Join(utility.BaseBackupPath, backup.Name)
+	var hasBackupPrefix = func(object storage.Object) bool {
+		return strings.HasPrefix(object.GetName(), backupPrefix+"/") || object.GetName() == backupPrefix+utility.SentinelSuffix
+	}
+	return BuildCopyingInfos(from, to, objects, hasBackupPrefix)
 }
 
+// GetHistoryCopyingInfo collects WAL needed by the backup and all the following WAL
 func GetHistoryCopyingInfo(backup *Backup, from storage.Folder, to storage.Folder) ([]CopyingInfo, error) {
-	tracelog.InfoLogger.Print("Collecting history files... ")
-	var fromWalFolder = from.GetSubFolder(utility.WalPath)
-	tracelog.InfoLogger.Print("getSubFolder succeess!")
-	var lastWalFilename, err = getLastWalFilename(backup)
-	if err != nil {
-		return make([]CopyingInfo, 0), nil
+	return GetWalCopyingInfo(backup, from, to, true, "")
+}
+
+// GetWalCopyingInfo collects WAL archives, bundles and timeline history files needed to restore the backup:
+// segments from the backup start to its finish. With history all the following WAL is collected too,
+// on the backup timeline and later timelines switched from it, up to the segment walUntil if it is set.
+func GetWalCopyingInfo(backup *Backup, from storage.Folder, to storage.Folder,
+	withHistory bool, walUntil string) ([]CopyingInfo, error) {
+	var lastSegmentNo *WalSegmentNo
+	if walUntil != "" {
+		segmentNo, err := newWalSegmentNoFromFilename(walUntil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid WAL segment name '%s'", walUntil)
+		}
+		lastSegmentNo = &segmentNo
 	}
-	tracelog.InfoLogger.Print("getLastWalFilename not failed!")
-	tracelog.InfoLogger.Printf("after %s\n", lastWalFilename)
-	objects, err := storage.ListFolderRecursively(fromWalFolder)
+	objects, err := storage.ListFolderRecursively(from)
 	if err != nil {
 		return nil, err
 	}
-	var older = func(object storage.Object) bool { return lastWalFilename <= object.GetName() }
-	return BuildCopyingInfos(fromWalFolder, to, objects, older), nil
+	return getWalCopyingInfo(backup, from, to, objects, withHistory, lastSegmentNo)
+}
+
+// getWalCopyingInfo selects WAL needed to restore the backup among objects listed recursively from the storage root
+func getWalCopyingInfo(backup *Backup, from storage.Folder, to storage.Folder, objects []storage.Object,
+	withHistory bool, lastSegmentNo *WalSegmentNo) ([]CopyingInfo, error) {
+	tracelog.InfoLogger.Print("Collecting WAL files...")
+	walRange, err := newWalCopyingRange(backup, from, objects, withHistory, lastSegmentNo)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find WAL range of backup %s", backup.Name)
+	}
+	infos := BuildCopyingInfos(from, to, objects, func(object storage.Object) bool {
+		return strings.HasPrefix(object.GetName(), utility.WalPath) &&
+			walRange.contains(strings.TrimPrefix(object.GetName(), utility.WalPath))
+	})
+	tracelog.InfoLogger.Printf("Found %d WAL files to copy for backup %s\n", len(infos), backup.Name)
+	return infos, nil
 }
 
 func GetAllCopyingInfo(from storage.Folder, to storage.Folder) ([]CopyingInfo, error) {
@@ -147,3 +214,15 @@ func BuildCopyingInfos(from storage.Folder, to storage.Folder, objects []storage
 	}
 	return
 }
+
+func uniqueCopyingInfos(infos []CopyingInfo) []CopyingInfo {
+	seen := make(map[string]bool, len(infos))
+	unique := make([]CopyingInfo, 0, len(infos))
+	for _, info := range infos {
+		if !seen[info.Object.GetName()] {
+			seen[info.Object.GetName()] = true
+			unique = append(unique, info)
+		}
+	}
+	return unique
+}
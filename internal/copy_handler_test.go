@@ -1,7 +1,8 @@
 package internal_test
 
 import (
-	"path"
+	"bytes"
+	"sort"
 	"strings"
 	"testing"
 
@@ -9,7 +10,10 @@ import (
 	"github.com/wal-g/storages/storage"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
 	"github.com/wal-g/wal-g/testtools"
+	"github.com/wal-g/wal-g/utility"
 )
 
 func TestStartCopy_WhenThereAreNoObjectsToCopy(t *testing.T) {
@@ -29,7 +33,7 @@ func TestStartCopy_WhenThereAreObjectsToCopy(t *testing.T) {
 	assert.True(t, isSuccess)
 
 	for _, info := range infos {
-		var filename = path.Join(from.GetPath(), info.Object.GetName())
+		var filename = info.Object.GetName()
 		var result, err = to.Exists(filename)
 		assert.NoError(t, err)
 		if !result {
@@ -62,18 +66,84 @@ func TestGetHistoryCopyingInfo_WhenFolderIsEmpty(t *testing.T) {
 	var from = testtools.MakeDefaultInMemoryStorageFolder()
 	var to = testtools.MakeDefaultInMemoryStorageFolder()
 	var backup = internal.NewBackup(from, "base_000000010000000000000002")
-	var infos, err = internal.GetHistoryCopyingInfo(backup, from, to)
-	assert.NoError(t, err)
-	assert.Empty(t, infos)
+	var _, err = internal.GetHistoryCopyingInfo(backup, from, to)
+	assert.Error(t, err)
 }
 
-func TestGetHistoryCopyingInfo_WhenThereIsNoHistoryObjects(t *testing.T) {
+func TestGetHistoryCopyingInfo_WhenBackupHasNoMetadata(t *testing.T) {
 	var from = testtools.CreateMockStorageFolder()
 	var to = testtools.MakeDefaultInMemoryStorageFolder()
 	var backup = internal.NewBackup(from, "base_000000010000000000000002")
-	var infos, err = internal.GetHistoryCopyingInfo(backup, from, to)
+	var _, err = internal.GetHistoryCopyingInfo(backup, from, to)
+	assert.Error(t, err)
+}
+
+func TestGetWalCopyingInfo_WithoutHistory(t *testing.T) {
+	var from = testtools.CreateMockStorageFolderWithPermanentBackups(t)
+	var to = testtools.MakeDefaultInMemoryStorageFolder()
+	var backup, err = internal.GetBackupByName("base_000000010000000000000002", utility.BaseBackupPath, from)
 	assert.NoError(t, err)
-	assert.Empty(t, infos)
+	infos, err := internal.GetWalCopyingInfo(backup, from, to, false, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"wal_005/000000010000000000000001.lz4"}, copyingInfoNames(infos))
+}
+
+func TestGetWalCopyingInfo_WithHistoryUntilSegment(t *testing.T) {
+	var from = testtools.CreateMockStorageFolderWithPermanentBackups(t)
+	var to = testtools.MakeDefaultInMemoryStorageFolder()
+	var backup, err = internal.GetBackupByName("base_000000010000000000000002", utility.BaseBackupPath, from)
+	assert.NoError(t, err)
+	infos, err := internal.GetWalCopyingInfo(backup, from, to, true, "000000010000000000000002")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"wal_005/000000010000000000000001.lz4", "wal_005/000000010000000000000002.lz4"},
+		copyingInfoNames(infos))
+
+	_, err = internal.GetWalCopyingInfo(backup, from, to, true, "not a segment")
+	assert.Error(t, err)
+}
+
+func TestGetWalCopyingInfo_WithHistoryOfLaterTimelines(t *testing.T) {
+	var from = testtools.CreateMockStorageFolderWithPermanentBackups(t)
+	var to = testtools.MakeDefaultInMemoryStorageFolder()
+	walFolder := from.GetSubFolder(utility.WalPath)
+	// timeline 2 is switched from the backup timeline at segment 3, timeline 3 is switched before the backup start
+	putCompressedWalFile(t, walFolder, "00000002.history", "1\t0/3000100\tno recovery target specified\n")
+	putCompressedWalFile(t, walFolder, "00000003.history", "1\t0/800000\tno recovery target specified\n")
+	for _, name := range []string{"000000020000000000000002", "000000020000000000000003", "000000020000000000000004",
+		"000000030000000000000003"} {
+		putCompressedWalFile(t, walFolder, name, "")
+	}
+	var backup, err = internal.GetBackupByName("base_000000010000000000000002", utility.BaseBackupPath, from)
+	assert.NoError(t, err)
+
+	infos, err := internal.GetWalCopyingInfo(backup, from, to, true, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"wal_005/000000010000000000000001.lz4",
+		"wal_005/000000010000000000000002.lz4",
+		"wal_005/000000010000000000000003.lz4",
+		"wal_005/00000002.history.lz4",
+		"wal_005/000000020000000000000003.lz4",
+		"wal_005/000000020000000000000004.lz4",
+	}, copyingInfoNames(infos))
+}
+
+func putCompressedWalFile(t *testing.T, walFolder storage.Folder, name, content string) {
+	var data bytes.Buffer
+	writer := compression.Compressors[lz4.AlgorithmName].NewWriter(&data)
+	_, err := writer.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	assert.NoError(t, walFolder.PutObject(name+"."+lz4.FileExtension, &data))
+}
+
+func copyingInfoNames(infos []internal.CopyingInfo) []string {
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		names = append(names, info.Object.GetName())
+	}
+	sort.Strings(names)
+	return names
 }
 
 func TestGetAllCopyingInfo_WhenFromFolderIsEmpty(t *testing.T) {
@@ -43,6 +43,11 @@ func (crypter *Crypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
 	return ioextensions.NewOnCloseFlusher(encryptedWriter, bufferedWriter), nil
 }
 
+// IsEncryptOnly is always true: archiving hosts may be allowed to use the KMS key only for encryption
+func (crypter *Crypter) IsEncryptOnly() (bool, error) {
+	return true, nil
+}
+
 // Decrypt creates decrypted reader from ordinary reader
 func (crypter *Crypter) Decrypt(reader io.Reader) (io.Reader, error) {
 	encryptedSymmetricKey := make([]byte, crypter.SymmetricKey.GetEncryptedKeyLen())
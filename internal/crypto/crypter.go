@@ -1,9 +1,70 @@
 package crypto
 
-import "io"
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
 
 // Crypter is responsible for making cryptographical pipeline parts when needed
 type Crypter interface {
 	Encrypt(writer io.Writer) (io.WriteCloser, error)
 	Decrypt(reader io.Reader) (io.Reader, error)
 }
+
+// EncryptOnlyCrypter is implemented by crypters which may be set up only for encryption,
+// e.g. with a public key, so they are not able to decrypt their own output.
+type EncryptOnlyCrypter interface {
+	IsEncryptOnly() (bool, error)
+}
+
+// verificationMessage is encrypted and decrypted back by VerifyCrypter
+var verificationMessage = []byte("wal-g crypter verification")
+
+// VerifyEncryption checks that crypter is able to encrypt data
+// (e.g. the key is set and can be parsed) by encrypting an empty message.
+func VerifyEncryption(crypter Crypter) error {
+	writeCloser, err := crypter.Encrypt(ioutil.Discard)
+	if err != nil {
+		return err
+	}
+	return writeCloser.Close()
+}
+
+// VerifyCrypter checks that crypter is able to encrypt data and, unless it is set up only
+// for encryption, to decrypt it back. It detects unusable keys as well as a wrong passphrase.
+func VerifyCrypter(crypter Crypter) error {
+	var encrypted bytes.Buffer
+	writeCloser, err := crypter.Encrypt(&encrypted)
+	if err != nil {
+		return err
+	}
+	if _, err = writeCloser.Write(verificationMessage); err != nil {
+		return err
+	}
+	if err = writeCloser.Close(); err != nil {
+		return err
+	}
+
+	if encryptOnlyCrypter, ok := crypter.(EncryptOnlyCrypter); ok {
+		encryptOnly, err := encryptOnlyCrypter.IsEncryptOnly()
+		if err != nil || encryptOnly {
+			return err
+		}
+	}
+
+	reader, err := crypter.Decrypt(&encrypted)
+	if err != nil {
+		return err
+	}
+	decrypted, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(decrypted, verificationMessage) {
+		return errors.New("decrypted verification message does not match the encrypted one")
+	}
+	return nil
+}
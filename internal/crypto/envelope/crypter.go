@@ -0,0 +1,337 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/minio/sio"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/crypto"
+)
+
+const (
+	magic      = "WALGENV1"
+	keyIDLen   = 16
+	dataKeyLen = 32
+	// metadataMagic starts headers with metadata, which follow key id as length, JSON and its HMAC by data key
+	metadataMagic     = "WALGENV2"
+	metadataMaxLen    = 64 * 1024
+	metadataLengthLen = 4
+	// wrappedKeyMagic precedes data key before wrapping, so it is known which master key wrapped it
+	wrappedKeyMagic = "WALGKEY1"
+)
+
+// Crypter encrypts each object with a fresh data key.
+// Data key is wrapped by master crypter and kept in key store, object header refers to it by id,
+// so master key can be rotated by rewrapping data keys without rewriting objects.
+type Crypter struct {
+	master crypto.Crypter
+	keys   KeyStore
+	// metadata is recorded in headers of encrypted objects and verified on decryption
+	metadata map[string]string
+}
+
+// NewCrypter builds envelope Crypter with given master crypter and key store
+func NewCrypter(master crypto.Crypter, keys KeyStore) *Crypter {
+	return &Crypter{master: master, keys: keys}
+}
+
+// WithMetadata makes the crypter, which records metadata in headers of encrypted objects
+// and checks that decrypted objects have the same metadata, e.g. the name the object is stored with.
+// The header is authenticated by the data key, so objects can't be swapped or have their metadata changed.
+// Objects encrypted without metadata are rejected,
+// otherwise an object could be replaced by another one encrypted without metadata.
+func (crypter *Crypter) WithMetadata(metadata map[string]string) *Crypter {
+	return &Crypter{master: crypter.master, keys: crypter.keys, metadata: metadata}
+}
+
+// Encrypt creates encryption writer, data key is generated and stored on the first write
+func (crypter *Crypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
+	return &encryptWriter{crypter: crypter, dst: writer}, nil
+}
+
+// Decrypt reads data key id from object header and creates decrypted reader
+func (crypter *Crypter) Decrypt(reader io.Reader) (io.Reader, error) {
+	header := make([]byte, len(magic)+keyIDLen)
+	n, err := io.ReadFull(reader, header)
+	if err == io.EOF && n == 0 {
+		return bytes.NewReader(nil), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can not read envelope header: %w", err)
+	}
+	headerMagic := string(header[:len(magic)])
+	if headerMagic != magic && headerMagic != metadataMagic {
+		return nil, fmt.Errorf("object is not envelope encrypted")
+	}
+	if headerMagic == magic && crypter.metadata != nil {
+		return nil, fmt.Errorf("object is encrypted without envelope metadata, expected %v", crypter.metadata)
+	}
+	id := hex.EncodeToString(header[len(magic):])
+	wrappedKey, err := crypter.keys.GetKey(id)
+	if err != nil {
+		return nil, err
+	}
+	key, err := UnwrapKey(crypter.master, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("can not unwrap data key '%s': %w", id, err)
+	}
+	if headerMagic == metadataMagic {
+		if err = crypter.readMetadata(reader, header, key); err != nil {
+			return nil, err
+		}
+	}
+	return sio.DecryptReader(reader, sio.Config{Key: key})
+}
+
+// readMetadata reads metadata after the key id, checks its HMAC and compares it with the expected metadata
+func (crypter *Crypter) readMetadata(reader io.Reader, header []byte, key []byte) error {
+	length := make([]byte, metadataLengthLen)
+	if _, err := io.ReadFull(reader, length); err != nil {
+		return fmt.Errorf("can not read envelope metadata: %w", err)
+	}
+	metadataLen := binary.LittleEndian.Uint32(length)
+	if metadataLen > metadataMaxLen {
+		return fmt.Errorf("invalid envelope metadata length %d", metadataLen)
+	}
+	metadataJSON := make([]byte, metadataLen)
+	mac := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(reader, metadataJSON); err != nil {
+		return fmt.Errorf("can not read envelope metadata: %w", err)
+	}
+	if _, err := io.ReadFull(reader, mac); err != nil {
+		return fmt.Errorf("can not read envelope metadata: %w", err)
+	}
+	expectedMac := metadataMac(key, append(append(append([]byte{}, header...), length...), metadataJSON...))
+	if !hmac.Equal(mac, expectedMac) {
+		return fmt.Errorf("envelope metadata is corrupted: HMAC mismatch")
+	}
+	var metadata map[string]string
+	if err := json.Unmarshal(metadataJSON, &metadata); err != nil {
+		return fmt.Errorf("can not parse envelope metadata: %w", err)
+	}
+	for name, expected := range crypter.metadata {
+		if metadata[name] != expected {
+			return fmt.Errorf("envelope metadata '%s' is '%s', expected '%s'", name, metadata[name], expected)
+		}
+	}
+	return nil
+}
+
+// writeHeader writes magic and key id, and metadata with its HMAC if the crypter has it
+func (crypter *Crypter) writeHeader(writer io.Writer, id []byte, key []byte) error {
+	if crypter.metadata == nil {
+		_, err := writer.Write(append([]byte(magic), id...))
+		return err
+	}
+	metadataJSON, err := json.Marshal(crypter.metadata)
+	if err != nil {
+		return err
+	}
+	header := append([]byte(metadataMagic), id...)
+	length := make([]byte, metadataLengthLen)
+	binary.LittleEndian.PutUint32(length, uint32(len(metadataJSON)))
+	header = append(append(header, length...), metadataJSON...)
+	_, err = writer.Write(append(header, metadataMac(key, header)...))
+	return err
+}
+
+// metadataMac authenticates the header with the key derived from data key, so data key is used only by sio
+func metadataMac(key []byte, header []byte) []byte {
+	derivation := hmac.New(sha256.New, key)
+	_, _ = derivation.Write([]byte(metadataMagic))
+	mac := hmac.New(sha256.New, derivation.Sum(nil))
+	_, _ = mac.Write(header)
+	return mac.Sum(nil)
+}
+
+// WrapKey encrypts data key with master crypter
+func WrapKey(master crypto.Crypter, key []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := master.Encrypt(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(append([]byte(wrappedKeyMagic), key...)); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnwrapKey decrypts data key with master crypter
+func UnwrapKey(master crypto.Crypter, wrappedKey []byte) ([]byte, error) {
+	key, err := decryptKey(master, wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != len(wrappedKeyMagic)+dataKeyLen || !bytes.HasPrefix(key, []byte(wrappedKeyMagic)) {
+		return nil, fmt.Errorf("unwrapped data is not a data key")
+	}
+	return key[len(wrappedKeyMagic):], nil
+}
+
+// isWrappedBy checks if data key is wrapped by master crypter, crypters without authentication
+// decrypt any data, so the key is recognized by its magic
+func isWrappedBy(master crypto.Crypter, wrappedKey []byte) bool {
+	_, err := UnwrapKey(master, wrappedKey)
+	return err == nil
+}
+
+func decryptKey(master crypto.Crypter, wrappedKey []byte) ([]byte, error) {
+	reader, err := master.Decrypt(bytes.NewReader(wrappedKey))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(reader)
+}
+
+// RewrapKeys rewraps data keys from oldMaster to newMaster, returns the number of rewrapped keys.
+// Keys already wrapped by newMaster are skipped, so interrupted rekey is resumed by running it again.
+// Keys which can not be rewrapped are reported after all other keys are processed.
+func RewrapKeys(keys KeyStore, oldMaster, newMaster crypto.Crypter) (int, error) {
+	infos, err := keys.ListKeys()
+	if err != nil {
+		return 0, err
+	}
+	rewrapped := 0
+	var failed []string
+	var firstErr error
+	for _, info := range infos {
+		skipped, err := rewrapKey(keys, info.ID, oldMaster, newMaster)
+		if err != nil {
+			tracelog.WarningLogger.Printf("Data key '%s' is not rewrapped: %v", info.ID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed = append(failed, info.ID)
+			continue
+		}
+		if !skipped {
+			rewrapped++
+		}
+	}
+	if len(failed) > 0 {
+		return rewrapped, fmt.Errorf("%d of %d data keys can not be rewrapped, e.g. '%s': %w",
+			len(failed), len(infos), failed[0], firstErr)
+	}
+	return rewrapped, nil
+}
+
+// rewrapKey rewraps single data key, skipped is set if the key is already wrapped by newMaster
+func rewrapKey(keys KeyStore, id string, oldMaster, newMaster crypto.Crypter) (skipped bool, err error) {
+	wrappedKey, err := keys.GetKey(id)
+	if err != nil {
+		return false, err
+	}
+	if isWrappedBy(newMaster, wrappedKey) {
+		return true, nil
+	}
+	key, err := UnwrapKey(oldMaster, wrappedKey)
+	if err != nil {
+		return false, fmt.Errorf("can not unwrap data key '%s' with old master key: %w", id, err)
+	}
+	if wrappedKey, err = WrapKey(newMaster, key); err != nil {
+		return false, fmt.Errorf("can not wrap data key '%s' with new master key: %w", id, err)
+	}
+	return false, keys.PutKey(id, wrappedKey)
+}
+
+// ReadKeyID reads id of the data key from envelope header, ok is false if object is not envelope encrypted
+func ReadKeyID(reader io.Reader) (id string, ok bool, err error) {
+	header := make([]byte, len(magic)+keyIDLen)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	headerMagic := string(header[:len(magic)])
+	if headerMagic != magic && headerMagic != metadataMagic {
+		return "", false, nil
+	}
+	return hex.EncodeToString(header[len(magic):]), true, nil
+}
+
+// PurgeKeys deletes keys which are not used and were stored before the given time,
+// so keys of objects being uploaded right now are kept. Returns the number of deleted keys.
+func PurgeKeys(keys KeyStore, used map[string]bool, before time.Time) (int, error) {
+	infos, err := keys.ListKeys()
+	if err != nil {
+		return 0, err
+	}
+	var unused []string
+	for _, info := range infos {
+		if !used[info.ID] && info.LastModified.Before(before) {
+			unused = append(unused, info.ID)
+		}
+	}
+	if len(unused) == 0 {
+		return 0, nil
+	}
+	if err := keys.DeleteKeys(unused); err != nil {
+		return 0, err
+	}
+	return len(unused), nil
+}
+
+// encryptWriter writes envelope header and encrypted data
+type encryptWriter struct {
+	crypter *Crypter
+	dst     io.Writer
+	writer  io.WriteCloser
+}
+
+func (w *encryptWriter) init() error {
+	key := make([]byte, dataKeyLen)
+	id := make([]byte, keyIDLen)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	wrappedKey, err := WrapKey(w.crypter.master, key)
+	if err != nil {
+		return fmt.Errorf("can not wrap data key: %w", err)
+	}
+	if err := w.crypter.keys.PutKey(hex.EncodeToString(id), wrappedKey); err != nil {
+		return fmt.Errorf("can not store data key: %w", err)
+	}
+	if err := w.crypter.writeHeader(w.dst, id, key); err != nil {
+		return err
+	}
+	w.writer, err = sio.EncryptWriter(w.dst, sio.Config{Key: key})
+	return err
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if w.writer == nil {
+		if err := w.init(); err != nil {
+			return 0, err
+		}
+	}
+	return w.writer.Write(p)
+}
+
+// Close finishes encryption, for empty message it only checks that master crypter is able to encrypt
+func (w *encryptWriter) Close() error {
+	if w.writer == nil {
+		return crypto.VerifyEncryption(w.crypter.master)
+	}
+	return w.writer.Close()
+}
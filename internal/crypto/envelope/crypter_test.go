@@ -0,0 +1,219 @@
+package envelope
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/storages/memory"
+)
+
+// xorCrypter is a test master crypter
+type xorCrypter struct {
+	mask byte
+}
+
+type xorWriter struct {
+	io.Writer
+	mask byte
+}
+
+func (w *xorWriter) Write(p []byte) (int, error) {
+	return w.Writer.Write(xor(p, w.mask))
+}
+
+func (w *xorWriter) Close() error {
+	return nil
+}
+
+func xor(p []byte, mask byte) []byte {
+	res := make([]byte, len(p))
+	for i := range p {
+		res[i] = p[i] ^ mask
+	}
+	return res
+}
+
+func (c *xorCrypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
+	return &xorWriter{Writer: writer, mask: c.mask}, nil
+}
+
+func (c *xorCrypter) Decrypt(reader io.Reader) (io.Reader, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(xor(data, c.mask)), nil
+}
+
+func encrypt(t *testing.T, crypter *Crypter, data []byte) []byte {
+	var buf bytes.Buffer
+	writer, err := crypter.Encrypt(&buf)
+	assert.NoError(t, err)
+	_, err = writer.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func decrypt(crypter *Crypter, data []byte) ([]byte, error) {
+	reader, err := crypter.Decrypt(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(reader)
+}
+
+func TestEncryptionCycle(t *testing.T) {
+	keys := NewFolderKeyStore(memory.NewFolder("", memory.NewStorage()))
+	crypter := NewCrypter(&xorCrypter{mask: 0x5a}, keys)
+
+	first := encrypt(t, crypter, []byte("first archive"))
+	second := encrypt(t, crypter, []byte("second archive"))
+	ids, err := keys.ListKeys()
+	assert.NoError(t, err)
+	assert.Len(t, ids, 2)
+
+	data, err := decrypt(crypter, first)
+	assert.NoError(t, err)
+	assert.Equal(t, "first archive", string(data))
+	data, err = decrypt(crypter, second)
+	assert.NoError(t, err)
+	assert.Equal(t, "second archive", string(data))
+}
+
+func TestEncryptEmptyMessageDoesNotStoreKey(t *testing.T) {
+	keys := NewFolderKeyStore(memory.NewFolder("", memory.NewStorage()))
+	crypter := NewCrypter(&xorCrypter{mask: 0x5a}, keys)
+
+	encrypted := encrypt(t, crypter, nil)
+	assert.Empty(t, encrypted)
+	ids, err := keys.ListKeys()
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+
+	data, err := decrypt(crypter, encrypted)
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+func TestUnwrapKey_WithoutMagic(t *testing.T) {
+	master := &xorCrypter{mask: 0x5a}
+	var buf bytes.Buffer
+	writer, err := master.Encrypt(&buf)
+	assert.NoError(t, err)
+	_, err = writer.Write(make([]byte, dataKeyLen))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	_, err = UnwrapKey(master, buf.Bytes())
+	assert.Error(t, err)
+}
+
+func TestRewrapKeys(t *testing.T) {
+	keys := NewFolderKeyStore(memory.NewFolder("", memory.NewStorage()))
+	oldMaster, newMaster := &xorCrypter{mask: 0x5a}, &xorCrypter{mask: 0xa5}
+	encrypted := encrypt(t, NewCrypter(oldMaster, keys), []byte("archive"))
+
+	n, err := RewrapKeys(keys, oldMaster, newMaster)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	data, err := decrypt(NewCrypter(newMaster, keys), encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, "archive", string(data))
+	_, err = decrypt(NewCrypter(oldMaster, keys), encrypted)
+	assert.Error(t, err)
+}
+
+func TestRewrapKeys_Resume(t *testing.T) {
+	keys := NewFolderKeyStore(memory.NewFolder("", memory.NewStorage()))
+	oldMaster, newMaster := &xorCrypter{mask: 0x5a}, &xorCrypter{mask: 0xa5}
+	first := encrypt(t, NewCrypter(oldMaster, keys), []byte("first archive"))
+	n, err := RewrapKeys(keys, oldMaster, newMaster)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	second := encrypt(t, NewCrypter(oldMaster, keys), []byte("second archive"))
+	assert.NoError(t, keys.PutKey("broken", []byte("not a wrapped key")))
+
+	n, err = RewrapKeys(keys, oldMaster, newMaster)
+	assert.Error(t, err)
+	assert.Equal(t, 1, n)
+
+	crypter := NewCrypter(newMaster, keys)
+	data, err := decrypt(crypter, first)
+	assert.NoError(t, err)
+	assert.Equal(t, "first archive", string(data))
+	data, err = decrypt(crypter, second)
+	assert.NoError(t, err)
+	assert.Equal(t, "second archive", string(data))
+}
+
+func TestPurgeKeys(t *testing.T) {
+	keys := NewFolderKeyStore(memory.NewFolder("", memory.NewStorage()))
+	crypter := NewCrypter(&xorCrypter{mask: 0x5a}, keys)
+	used := encrypt(t, crypter, []byte("used archive"))
+	encrypt(t, crypter, []byte("deleted archive"))
+
+	id, ok, err := ReadKeyID(bytes.NewReader(used))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	n, err := PurgeKeys(keys, map[string]bool{id: true}, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	n, err = PurgeKeys(keys, map[string]bool{id: true}, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	infos, err := keys.ListKeys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{id}, []string{infos[0].ID})
+	data, err := decrypt(crypter, used)
+	assert.NoError(t, err)
+	assert.Equal(t, "used archive", string(data))
+}
+
+func TestReadKeyID_NotEncrypted(t *testing.T) {
+	_, ok, err := ReadKeyID(bytes.NewReader([]byte("plain")))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestEncryptionCycleWithMetadata(t *testing.T) {
+	keys := NewFolderKeyStore(memory.NewFolder("", memory.NewStorage()))
+	crypter := NewCrypter(&xorCrypter{mask: 0x5a}, keys)
+	encrypted := encrypt(t, crypter.WithMetadata(map[string]string{"name": "first"}), []byte("first archive"))
+
+	data, err := decrypt(crypter.WithMetadata(map[string]string{"name": "first"}), encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, "first archive", string(data))
+	data, err = decrypt(crypter, encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, "first archive", string(data))
+
+	_, err = decrypt(crypter.WithMetadata(map[string]string{"name": "second"}), encrypted)
+	assert.Error(t, err)
+}
+
+func TestDecryptWithMetadata_Tampered(t *testing.T) {
+	keys := NewFolderKeyStore(memory.NewFolder("", memory.NewStorage()))
+	crypter := NewCrypter(&xorCrypter{mask: 0x5a}, keys).WithMetadata(map[string]string{"name": "first"})
+	encrypted := encrypt(t, crypter, []byte("first archive"))
+
+	tampered := bytes.Replace(encrypted, []byte(`"first"`), []byte(`"fiRst"`), 1)
+	_, err := decrypt(crypter.WithMetadata(map[string]string{"name": "fiRst"}), tampered)
+	assert.Error(t, err)
+}
+
+func TestDecryptWithMetadata_ObjectWithoutMetadata(t *testing.T) {
+	keys := NewFolderKeyStore(memory.NewFolder("", memory.NewStorage()))
+	crypter := NewCrypter(&xorCrypter{mask: 0x5a}, keys)
+	encrypted := encrypt(t, crypter, []byte("archive"))
+
+	_, err := decrypt(crypter.WithMetadata(map[string]string{"name": "archive"}), encrypted)
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+package envelope
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/wal-g/storages/storage"
+)
+
+// KeysPath is the storage folder with wrapped data keys
+const KeysPath = "keys_005/"
+
+const keyFileSuffix = ".key"
+
+// KeyStore keeps wrapped data keys by their ids
+type KeyStore interface {
+	PutKey(id string, wrappedKey []byte) error
+	GetKey(id string) ([]byte, error)
+	ListKeys() ([]KeyInfo, error)
+	DeleteKeys(ids []string) error
+}
+
+// KeyInfo describes stored data key
+type KeyInfo struct {
+	ID           string
+	LastModified time.Time
+}
+
+// FolderKeyStore keeps each wrapped data key as a separate object in storage folder
+type FolderKeyStore struct {
+	folder storage.Folder
+}
+
+// NewFolderKeyStore builds key store on top of folder
+func NewFolderKeyStore(folder storage.Folder) *FolderKeyStore {
+	return &FolderKeyStore{folder: folder}
+}
+
+// PutKey uploads wrapped data key, existing key with the same id is replaced
+func (ks *FolderKeyStore) PutKey(id string, wrappedKey []byte) error {
+	return ks.folder.PutObject(id+keyFileSuffix, strings.NewReader(string(wrappedKey)))
+}
+
+// GetKey downloads wrapped data key
+func (ks *FolderKeyStore) GetKey(id string) ([]byte, error) {
+	reader, err := ks.folder.ReadObject(id + keyFileSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("can not read data key '%s': %w", id, err)
+	}
+	defer func() { _ = reader.Close() }()
+	return ioutil.ReadAll(reader)
+}
+
+// ListKeys returns all stored keys
+func (ks *FolderKeyStore) ListKeys() ([]KeyInfo, error) {
+	objects, _, err := ks.folder.ListFolder()
+	if err != nil {
+		return nil, fmt.Errorf("can not list data keys: %w", err)
+	}
+	keys := make([]KeyInfo, 0, len(objects))
+	for _, object := range objects {
+		if strings.HasSuffix(object.GetName(), keyFileSuffix) {
+			keys = append(keys, KeyInfo{
+				ID:           strings.TrimSuffix(object.GetName(), keyFileSuffix),
+				LastModified: object.GetLastModified(),
+			})
+		}
+	}
+	return keys, nil
+}
+
+// DeleteKeys deletes wrapped data keys
+func (ks *FolderKeyStore) DeleteKeys(ids []string) error {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, id+keyFileSuffix)
+	}
+	if err := ks.folder.DeleteObjects(names); err != nil {
+		return fmt.Errorf("can not delete data keys: %w", err)
+	}
+	return nil
+}
@@ -122,6 +122,19 @@ func (crypter *Crypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
 	return ioextensions.NewOnCloseFlusher(encryptedWriter, bufferedWriter), nil
 }
 
+// IsEncryptOnly reports whether the crypter has only public keys, so it can't decrypt data
+func (crypter *Crypter) IsEncryptOnly() (bool, error) {
+	if err := crypter.setupPubKey(); err != nil {
+		return false, err
+	}
+	for _, entity := range crypter.PubKey {
+		if entity.PrivateKey != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 // Decrypt creates decrypted reader from ordinary reader
 func (crypter *Crypter) Decrypt(reader io.Reader) (io.Reader, error) {
 	err := crypter.loadSecret()
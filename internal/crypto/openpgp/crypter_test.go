@@ -7,6 +7,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/wal-g/wal-g/internal/crypto"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
 )
 
 var pgpTestPrivateKey string
@@ -68,3 +70,29 @@ func TestEncryptionCycleFromEnv(t *testing.T) {
 func TestEncryptionCycleFromKeyPath(t *testing.T) {
 	EncryptionCycle(t, MockArmedCrypterFromKeyPath())
 }
+
+func TestVerifyCrypter(t *testing.T) {
+	assert.NoError(t, crypto.VerifyCrypter(MockArmedCrypterFromKeyPath()))
+}
+
+func TestVerifyCrypter_publicKey(t *testing.T) {
+	entityList, err := readPGPKey(PrivateKeyFilePath)
+	assert.NoError(t, err)
+	publicKey := new(bytes.Buffer)
+	armored, err := armor.Encode(publicKey, openpgp.PublicKeyType, nil)
+	assert.NoError(t, err)
+	for _, entity := range entityList {
+		assert.NoError(t, entity.Serialize(armored))
+	}
+	assert.NoError(t, armored.Close())
+
+	crypter := CrypterFromKey(publicKey.String(), noPassphrase)
+	encryptOnly, err := crypter.(*Crypter).IsEncryptOnly()
+	assert.NoError(t, err)
+	assert.True(t, encryptOnly)
+	assert.NoError(t, crypto.VerifyCrypter(crypter))
+}
+
+func TestVerifyCrypter_invalidKey(t *testing.T) {
+	assert.Error(t, crypto.VerifyCrypter(CrypterFromKey("not a key", noPassphrase)))
+}
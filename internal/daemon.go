@@ -0,0 +1,239 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	DaemonWalPushCommand  = "wal-push"
+	DaemonWalFetchCommand = "wal-fetch"
+	// DaemonOkResponse is sent on success, otherwise the response line starts with DaemonErrorResponse
+	DaemonOkResponse    = "OK"
+	DaemonErrorResponse = "ERROR"
+)
+
+// daemonCommandArgsCount is the number of arguments of each command, the last one takes the rest of the line
+var daemonCommandArgsCount = map[string]int{
+	DaemonWalPushCommand:  1,
+	DaemonWalFetchCommand: 2,
+}
+
+type UnknownDaemonCommandError struct {
+	error
+}
+
+func newUnknownDaemonCommandError(command string, argsCount int) UnknownDaemonCommandError {
+	return UnknownDaemonCommandError{errors.Errorf("Unknown daemon command '%s' with %d arguments", command, argsCount)}
+}
+
+func (err UnknownDaemonCommandError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+type RelativeDaemonPathError struct {
+	error
+}
+
+func newRelativeDaemonPathError(path string) RelativeDaemonPathError {
+	return RelativeDaemonPathError{errors.Errorf("Daemon request path '%s' is not absolute", path)}
+}
+
+func (err RelativeDaemonPathError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// DaemonRequest is sent by the client as a single line of text: the command and its arguments separated by spaces,
+// e.g. "wal-fetch 000000010000000000000001 /var/lib/postgresql/data/pg_wal/RECOVERYXLOG".
+// The plain text protocol allows to send requests from shell, without starting WAL-G for each of them.
+type DaemonRequest struct {
+	Command string
+	Args    []string
+}
+
+func parseDaemonRequest(line string) (DaemonRequest, error) {
+	fields := strings.SplitN(strings.TrimRight(line, "\r\n"), " ", 2)
+	request := DaemonRequest{Command: fields[0]}
+	argsCount, ok := daemonCommandArgsCount[request.Command]
+	if !ok || len(fields) < 2 {
+		return request, newUnknownDaemonCommandError(request.Command, len(fields)-1)
+	}
+	request.Args = strings.SplitN(fields[1], " ", argsCount)
+	if len(request.Args) != argsCount {
+		return request, newUnknownDaemonCommandError(request.Command, len(request.Args))
+	}
+	// paths are the last arguments, the daemon runs in another working directory
+	if walFilePath := request.Args[argsCount-1]; !filepath.IsAbs(walFilePath) {
+		return request, newRelativeDaemonPathError(walFilePath)
+	}
+	return request, nil
+}
+
+func (request DaemonRequest) String() string {
+	return strings.Join(append([]string{request.Command}, request.Args...), " ")
+}
+
+// DaemonServer executes wal-push and wal-fetch requests with the uploader and folder configured once at start
+type DaemonServer struct {
+	uploader *WalUploader
+	folder   storage.Folder
+	// pushes are serialized, since PostgreSQL archives segments one by one and delta files are not thread-safe
+	pushMutex sync.Mutex
+}
+
+func NewDaemonServer(uploader *WalUploader, folder storage.Folder) *DaemonServer {
+	uploader.UploadingFolder = uploader.UploadingFolder.GetSubFolder(utility.WalPath)
+	return &DaemonServer{uploader: uploader, folder: folder.GetSubFolder(utility.WalPath)}
+}
+
+// TODO : unit tests
+// HandleDaemon is invoked to perform wal-g daemon.
+// It serves requests of wal-g daemon-client on the unix socket until it is interrupted.
+func HandleDaemon(uploader *WalUploader, folder storage.Folder, socketPath string) {
+	// socket left by the previous daemon would prevent listening
+	err := os.Remove(socketPath)
+	if err != nil && !os.IsNotExist(err) {
+		tracelog.ErrorLogger.FatalError(err)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	tracelog.ErrorLogger.FatalfOnError("Failed to listen on socket: %v\n", err)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		tracelog.InfoLogger.Printf("Received %v, stopping daemon\n", sig)
+		utility.LoggedClose(listener, "")
+	}()
+
+	tracelog.InfoLogger.Printf("Listening on %s\n", socketPath)
+	err = NewDaemonServer(uploader, folder).Serve(listener)
+	tracelog.ErrorLogger.FatalOnError(err)
+}
+
+// Serve accepts connections until the listener is closed
+func (server *DaemonServer) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if opErr, ok := err.(*net.OpError); ok && opErr.Err.Error() == "use of closed network connection" {
+				return nil
+			}
+			return err
+		}
+		go server.handleConnection(conn)
+	}
+}
+
+func (server *DaemonServer) handleConnection(conn net.Conn) {
+	defer utility.LoggedClose(conn, "")
+	var request DaemonRequest
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err == nil {
+		request, err = parseDaemonRequest(line)
+	}
+	if err == nil {
+		err = server.execute(request)
+	}
+	response := DaemonOkResponse
+	if err != nil {
+		tracelog.ErrorLogger.Printf("Daemon request '%v' failed: %v\n", request, err)
+		response = DaemonErrorResponse + " " + strings.Replace(err.Error(), "\n", " ", -1)
+	}
+	_, err = conn.Write([]byte(response + "\n"))
+	if err != nil {
+		tracelog.ErrorLogger.Printf("Failed to send daemon response: %v\n", err)
+	}
+}
+
+func (server *DaemonServer) execute(request DaemonRequest) error {
+	switch request.Command {
+	case DaemonWalPushCommand:
+		return server.pushWal(request.Args[0])
+	case DaemonWalFetchCommand:
+		return server.fetchWal(request.Args[0], request.Args[1])
+	default:
+		return newUnknownDaemonCommandError(request.Command, len(request.Args))
+	}
+}
+
+// fetchWal downloads WAL file like wal-fetch does, with retries and fallback to the .partial segment
+func (server *DaemonServer) fetchWal(walFileName, location string) error {
+	retryPolicy, err := getWalFetchRetryPolicy()
+	if err != nil {
+		return err
+	}
+	return downloadWALFileOrPartialWithRetries(server.folder, walFileName, location, retryPolicy)
+}
+
+func (server *DaemonServer) pushWal(walFilePath string) error {
+	server.pushMutex.Lock()
+	defer server.pushMutex.Unlock()
+
+	uploader := server.uploader.clone()
+	if uploader.ArchiveStatusManager.isWalAlreadyUploaded(walFilePath) {
+		return uploader.ArchiveStatusManager.unmarkWalFile(walFilePath)
+	}
+	err := runPushHook(WalPushPreHookSetting, hookWalFilePathEnv+"="+walFilePath)
+	if err != nil {
+		return err
+	}
+	err = uploadWALFile(uploader, walFilePath, viper.GetBool(PreventWalOverwriteSetting))
+	if err != nil {
+		return err
+	}
+	if uploader.getUseWalDelta() {
+		uploader.FlushFiles()
+	}
+	return runPushHook(WalPushPostHookSetting, hookWalFilePathEnv+"="+walFilePath)
+}
+
+// SendDaemonRequest sends the command to the daemon listening on socketPath and waits for its result.
+// Paths are resolved by the client, since the daemon runs in another working directory.
+// The same request can be sent from shell, see DaemonRequest.
+func SendDaemonRequest(socketPath, command string, args []string) error {
+	request := DaemonRequest{Command: command, Args: make([]string, 0, len(args))}
+	for i, arg := range args {
+		// the first argument of wal-fetch is the name of WAL file, not a path
+		if command != DaemonWalFetchCommand || i > 0 {
+			absPath, err := filepath.Abs(arg)
+			if err != nil {
+				return err
+			}
+			arg = absPath
+		}
+		request.Args = append(request.Args, arg)
+	}
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to daemon")
+	}
+	defer utility.LoggedClose(conn, "")
+	_, err = conn.Write([]byte(request.String() + "\n"))
+	if err != nil {
+		return err
+	}
+	response, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return errors.Wrap(err, "failed to read daemon response")
+	}
+	response = strings.TrimRight(response, "\n")
+	if response != DaemonOkResponse {
+		return errors.New(strings.TrimPrefix(response, DaemonErrorResponse+" "))
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package internal_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/testtools"
+)
+
+// setWalFetchRetrySettings sets settings read by wal-fetch requests, defaults are not loaded in tests
+func setWalFetchRetrySettings() func() {
+	settings := []string{internal.WalFetchRetryWaitSetting, internal.WalFetchMaxRetryWaitSetting,
+		internal.WalFetchCooldownSetting}
+	for _, setting := range settings {
+		viper.Set(setting, "1")
+	}
+	return func() {
+		for _, setting := range settings {
+			viper.Set(setting, nil)
+		}
+	}
+}
+
+func TestDaemonPushesAndFetchesWal(t *testing.T) {
+	defer setWalFetchRetrySettings()()
+	dir, err := ioutil.TempDir("", "wal-g-daemon")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	uploader := internal.NewWalUploader(lz4.Compressor{}, folder, nil)
+	uploader.ArchiveStatusManager = internal.NewNopASM()
+	socketPath := filepath.Join(dir, "wal-g.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	defer listener.Close()
+	go internal.NewDaemonServer(uploader, folder).Serve(listener)
+
+	walName := "000000010000000000000001"
+	content := []byte("wal segment content")
+	walPath := filepath.Join(dir, walName)
+	require.NoError(t, ioutil.WriteFile(walPath, content, 0600))
+
+	err = internal.SendDaemonRequest(socketPath, internal.DaemonWalPushCommand, []string{walPath})
+	require.NoError(t, err)
+
+	fetchedPath := filepath.Join(dir, "fetched")
+	err = internal.SendDaemonRequest(socketPath, internal.DaemonWalFetchCommand, []string{walName, fetchedPath})
+	require.NoError(t, err)
+	fetched, err := ioutil.ReadFile(fetchedPath)
+	require.NoError(t, err)
+	assert.Equal(t, content, fetched)
+
+	err = internal.SendDaemonRequest(socketPath, internal.DaemonWalFetchCommand, []string{"000000010000000000000002", fetchedPath})
+	assert.Error(t, err)
+	// partial segment of the old timeline is fetched like wal-fetch does
+	partialName := "000000010000000000000003"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, partialName+internal.PartialWalSuffix), content, 0600))
+	err = internal.SendDaemonRequest(socketPath, internal.DaemonWalPushCommand, []string{filepath.Join(dir, partialName+internal.PartialWalSuffix)})
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "00000002.history"), []byte("1\t0/3000000\tno recovery target specified\n"), 0600))
+	err = internal.SendDaemonRequest(socketPath, internal.DaemonWalPushCommand, []string{filepath.Join(dir, "00000002.history")})
+	require.NoError(t, err)
+	partialPath := filepath.Join(dir, "fetched_partial")
+	err = internal.SendDaemonRequest(socketPath, internal.DaemonWalFetchCommand, []string{partialName, partialPath})
+	require.NoError(t, err)
+	fetched, err = ioutil.ReadFile(partialPath)
+	require.NoError(t, err)
+	assert.Equal(t, content, fetched)
+	err = internal.SendDaemonRequest(socketPath, "backup-push", []string{dir})
+	assert.Error(t, err)
+}
+
+func sendRawDaemonRequest(t *testing.T, socketPath, line string) string {
+	conn, err := net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte(line))
+	require.NoError(t, err)
+	response, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	return response
+}
+
+func TestDaemonServesPlainTextRequests(t *testing.T) {
+	defer setWalFetchRetrySettings()()
+	dir, err := ioutil.TempDir("", "wal-g daemon")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	uploader := internal.NewWalUploader(lz4.Compressor{}, folder, nil)
+	uploader.ArchiveStatusManager = internal.NewNopASM()
+	socketPath := filepath.Join(dir, "wal-g.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	defer listener.Close()
+	go internal.NewDaemonServer(uploader, folder).Serve(listener)
+
+	walName := "000000010000000000000001"
+	walPath := filepath.Join(dir, walName)
+	require.NoError(t, ioutil.WriteFile(walPath, []byte("wal segment content"), 0600))
+
+	// the same as: printf 'wal-push %s\n' "$PWD/%p" | socat -t 600 - UNIX-CONNECT:wal-g.sock
+	assert.Equal(t, "OK\n", sendRawDaemonRequest(t, socketPath, "wal-push "+walPath+"\n"))
+	assert.Equal(t, "OK\n", sendRawDaemonRequest(t, socketPath, "wal-fetch "+walName+" "+filepath.Join(dir, "fetched")+"\n"))
+	assert.Contains(t, sendRawDaemonRequest(t, socketPath, "wal-push "+walName+"\n"), "ERROR ")
+	assert.Contains(t, sendRawDaemonRequest(t, socketPath, "wal-fetch "+walName+"\n"), "ERROR ")
+}
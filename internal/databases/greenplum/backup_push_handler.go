@@ -0,0 +1,192 @@
+package greenplum
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	// ClusterBackupPrefix is the prefix of names of cluster backups
+	ClusterBackupPrefix = "backup_"
+
+	// ClusterBackupsPath is the folder of cluster sentinels, it is apart from basebackups_005,
+	// so cluster backups are never taken for backups of a single instance
+	ClusterBackupsPath = "cluster_basebackups_005/"
+
+	// SegmentBackupLinksPath is the folder of a segment where links from cluster backups to segment backups are kept
+	SegmentBackupLinksPath = "cluster_backup_links/"
+
+	// DefaultSegmentBackupCommand runs backup of a segment over ssh if WALG_GP_SEGMENT_BACKUP_COMMAND is not set
+	DefaultSegmentBackupCommand = "ssh {host} 'PGPORT={port} wal-g segment-backup-push {datadir} " +
+		"--content-id={content_id} --cluster-backup={backup_name}'"
+)
+
+// HandleBackupPush is invoked on the coordinator to perform wal-g backup-push.
+// Backups of all primary segments and of the coordinator are made in parallel by the segment command,
+// then a restore point is created on all of them and the cluster sentinel linking segment backups is uploaded.
+func HandleBackupPush(uploader *internal.Uploader) {
+	startTime := utility.TimeNowCrossPlatformUTC()
+	backupName := ClusterBackupPrefix + startTime.Format(utility.BackupTimeFormat)
+	folder := uploader.UploadingFolder
+
+	conn, err := internal.Connect()
+	tracelog.ErrorLogger.FatalOnError(err)
+	defer utility.LoggedClose(conn, "")
+	segments, err := getPrimarySegments(conn)
+	tracelog.ErrorLogger.FatalOnError(err)
+
+	commandTemplate, ok := internal.GetSetting(internal.GpSegmentBackupCmdSetting)
+	if !ok {
+		commandTemplate = DefaultSegmentBackupCommand
+	}
+	tracelog.InfoLogger.Printf("Starting backup %s of %d segments\n", backupName, len(segments))
+	err = runSegmentBackups(segments, commandTemplate, backupName)
+	tracelog.ErrorLogger.FatalOnError(err)
+
+	restoreLSNs, err := createRestorePoint(conn, backupName)
+	tracelog.ErrorLogger.FatalOnError(err)
+
+	sentinel := ClusterBackupSentinelDto{
+		RestorePoint: backupName,
+		Segments:     make([]SegmentBackup, 0, len(segments)),
+		StartTime:    startTime,
+		UserData:     internal.GetSentinelUserData(),
+	}
+	sentinel.Hostname, _ = os.Hostname()
+	for _, segment := range segments {
+		segmentBackupName, err := findSegmentBackup(folder, segment.ContentID, backupName)
+		tracelog.ErrorLogger.FatalOnError(err)
+		sentinel.Segments = append(sentinel.Segments, SegmentBackup{
+			Segment:    segment,
+			BackupName: segmentBackupName,
+			RestoreLSN: restoreLSNs[segment.ContentID],
+		})
+	}
+	sentinel.FinishTime = utility.TimeNowCrossPlatformUTC()
+
+	uploader.UploadingFolder = folder.GetSubFolder(ClusterBackupsPath)
+	err = internal.UploadSentinel(uploader, &sentinel, backupName)
+	tracelog.ErrorLogger.FatalOnError(err)
+	tracelog.InfoLogger.Printf("Cluster backup %s is complete\n", backupName)
+}
+
+// runSegmentBackups runs the segment command for all segments at once and waits for all of them
+func runSegmentBackups(segments []Segment, commandTemplate, backupName string) error {
+	errs := make([]error, len(segments))
+	var wg sync.WaitGroup
+	for i, segment := range segments {
+		wg.Add(1)
+		go func(i int, segment Segment) {
+			defer wg.Done()
+			errs[i] = runSegmentBackup(segment, commandTemplate, backupName)
+		}(i, segment)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			tracelog.ErrorLogger.Printf("Backup of segment %d on %s failed: %v\n",
+				segments[i].ContentID, segments[i].Hostname, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("backup of %d segments of %d failed", failed, len(segments))
+	}
+	return nil
+}
+
+func runSegmentBackup(segment Segment, commandTemplate, backupName string) error {
+	command := formatSegmentCommand(commandTemplate, segment, backupName)
+	tracelog.DebugLogger.Printf("Running backup of segment %d: %s\n", segment.ContentID, command)
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	cmd := exec.Command(shell, "-c", command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	tracelog.InfoLogger.Printf("Backup of segment %d on %s is complete\n", segment.ContentID, segment.Hostname)
+	return nil
+}
+
+// createRestorePoint creates a restore point with the same name on all segments,
+// recovering every segment to it gives a consistent state of the cluster
+func createRestorePoint(conn *pgx.Conn, name string) (map[int]string, error) {
+	rows, err := conn.Query("SELECT segment_id, restore_lsn::text FROM gp_create_restore_point($1)", name)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create restore point, is the gp_pitr extension installed?")
+	}
+	defer rows.Close()
+	restoreLSNs := make(map[int]string)
+	for rows.Next() {
+		var contentID int16
+		var lsn string
+		if err = rows.Scan(&contentID, &lsn); err != nil {
+			return nil, errors.Wrap(err, "failed to read restore point")
+		}
+		restoreLSNs[int(contentID)] = lsn
+	}
+	return restoreLSNs, errors.Wrap(rows.Err(), "failed to read restore point")
+}
+
+// HandleSegmentBackupPush is invoked on a segment host to perform wal-g segment-backup-push.
+// The backup is made in the folder of the segment, if it is made for a cluster backup, the link to it is uploaded,
+// so sentinel user data stays as configured.
+func HandleSegmentBackupPush(uploader *internal.WalUploader, dataDirectory string, contentID int, clusterBackupName string) {
+	segmentFolder := GetSegmentFolder(uploader.UploadingFolder, contentID)
+	uploader.UploadingFolder = segmentFolder
+	backupName := internal.HandleBackupPush(uploader, dataDirectory, false, false, false, false)
+	if clusterBackupName == "" {
+		return
+	}
+	err := uploadSegmentBackupLink(segmentFolder, clusterBackupName, backupName)
+	tracelog.ErrorLogger.FatalOnError(err)
+}
+
+// SegmentBackupLinkDto names the segment backup made for the cluster backup
+type SegmentBackupLinkDto struct {
+	BackupName string `json:"backup_name"`
+}
+
+func uploadSegmentBackupLink(segmentFolder storage.Folder, clusterBackupName, backupName string) error {
+	data, err := json.Marshal(SegmentBackupLinkDto{BackupName: backupName})
+	if err != nil {
+		return err
+	}
+	err = segmentFolder.GetSubFolder(SegmentBackupLinksPath).PutObject(clusterBackupName, bytes.NewReader(data))
+	return errors.Wrapf(err, "failed to link backup %s to cluster backup %s", backupName, clusterBackupName)
+}
+
+// findSegmentBackup returns the name of the backup of the segment made for the cluster backup
+func findSegmentBackup(folder storage.Folder, contentID int, clusterBackupName string) (string, error) {
+	reader, err := GetSegmentFolder(folder, contentID).GetSubFolder(SegmentBackupLinksPath).ReadObject(clusterBackupName)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to find backup of segment %d made for %s", contentID, clusterBackupName)
+	}
+	defer utility.LoggedClose(reader, "")
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to find backup of segment %d made for %s", contentID, clusterBackupName)
+	}
+	var link SegmentBackupLinkDto
+	if err = json.Unmarshal(data, &link); err != nil {
+		return "", errors.Wrapf(err, "failed to parse link to backup of segment %d", contentID)
+	}
+	return link.BackupName, nil
+}
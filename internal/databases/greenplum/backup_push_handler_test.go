@@ -0,0 +1,29 @@
+package greenplum
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/storages/memory"
+)
+
+func TestFormatSegmentCommand(t *testing.T) {
+	segment := Segment{ContentID: 2, Hostname: "sdw1", Port: 6002, DataDir: "/data/primary/gpseg2"}
+	command := formatSegmentCommand(DefaultSegmentBackupCommand, segment, "backup_20201015T120000Z")
+	assert.Equal(t, "ssh sdw1 'PGPORT=6002 wal-g segment-backup-push /data/primary/gpseg2 "+
+		"--content-id=2 --cluster-backup=backup_20201015T120000Z'", command)
+}
+
+func TestFindSegmentBackup(t *testing.T) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	require.NoError(t, uploadSegmentBackupLink(GetSegmentFolder(folder, 0), "backup_1", "base_000000010000000000000002"))
+
+	backupName, err := findSegmentBackup(folder, 0, "backup_1")
+	require.NoError(t, err)
+	assert.Equal(t, "base_000000010000000000000002", backupName)
+	_, err = findSegmentBackup(folder, 0, "backup_2")
+	assert.Error(t, err)
+	_, err = findSegmentBackup(folder, 1, "backup_1")
+	assert.Error(t, err)
+}
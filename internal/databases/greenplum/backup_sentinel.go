@@ -0,0 +1,23 @@
+package greenplum
+
+import "time"
+
+// SegmentBackup links a segment to its backup in the segment folder
+type SegmentBackup struct {
+	Segment
+	BackupName string `json:"backup_name"`
+	// RestoreLSN is the LSN of the cluster restore point on the segment
+	RestoreLSN string `json:"restore_lsn,omitempty"`
+}
+
+// ClusterBackupSentinelDto describes a backup of the whole cluster made of backups of all segments.
+// Segments are consistent with each other when recovered to RestorePoint.
+type ClusterBackupSentinelDto struct {
+	RestorePoint string          `json:"restore_point"`
+	Segments     []SegmentBackup `json:"segments"`
+	StartTime    time.Time       `json:"start_time"`
+	FinishTime   time.Time       `json:"finish_time"`
+	Hostname     string          `json:"hostname"`
+
+	UserData interface{} `json:"user_data,omitempty"`
+}
@@ -0,0 +1,69 @@
+package greenplum
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+)
+
+const (
+	// SegmentsPath is the folder where backups and WAL of every segment are stored in a subfolder of their own
+	SegmentsPath = "segments_005/"
+
+	// CoordinatorContentID is content id of the coordinator in gp_segment_configuration
+	CoordinatorContentID = -1
+)
+
+// Segment is a primary instance of the cluster, the coordinator is a segment with content id -1
+type Segment struct {
+	ContentID int    `json:"content_id"`
+	Hostname  string `json:"hostname"`
+	Port      int    `json:"port"`
+	DataDir   string `json:"data_dir"`
+}
+
+// GetSegmentFolder returns the folder where the segment with the given content id keeps its backups and WAL
+func GetSegmentFolder(folder storage.Folder, contentID int) storage.Folder {
+	return folder.GetSubFolder(SegmentsPath).GetSubFolder(fmt.Sprintf("seg%d/", contentID))
+}
+
+func getPrimarySegments(conn *pgx.Conn) ([]Segment, error) {
+	rows, err := conn.Query("SELECT content, hostname, port, datadir FROM gp_segment_configuration " +
+		"WHERE role = 'p' ORDER BY content")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query gp_segment_configuration")
+	}
+	defer rows.Close()
+	segments := make([]Segment, 0)
+	for rows.Next() {
+		var segment Segment
+		var contentID, port int32
+		if err = rows.Scan(&contentID, &segment.Hostname, &port, &segment.DataDir); err != nil {
+			return nil, errors.Wrap(err, "failed to read gp_segment_configuration")
+		}
+		segment.ContentID, segment.Port = int(contentID), int(port)
+		segments = append(segments, segment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read gp_segment_configuration")
+	}
+	if len(segments) == 0 {
+		return nil, errors.New("no primary segments found in gp_segment_configuration")
+	}
+	return segments, nil
+}
+
+// formatSegmentCommand substitutes segment placeholders in the command template
+func formatSegmentCommand(template string, segment Segment, backupName string) string {
+	return strings.NewReplacer(
+		"{host}", segment.Hostname,
+		"{port}", strconv.Itoa(segment.Port),
+		"{datadir}", segment.DataDir,
+		"{content_id}", strconv.Itoa(segment.ContentID),
+		"{backup_name}", backupName,
+	).Replace(template)
+}
@@ -0,0 +1,98 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/wal-g/tracelog"
+)
+
+// DefaultArchiveBufferLimit is the maximum size of archive kept in memory before upload
+const DefaultArchiveBufferLimit = 32 << 20
+
+// archiveBufferPool is shared by all uploaders, so memory is reused across uploads
+var archiveBufferPool = sync.Pool{
+	New: func() interface{} { return &bytes.Buffer{} },
+}
+
+// archiveBuffer keeps compressed archive before upload.
+// Data is kept in pooled memory buffer up to the limit and spilled to a temporary file above it.
+type archiveBuffer struct {
+	limit int
+	mem   *bytes.Buffer
+	file  *os.File
+	size  int64
+}
+
+func newArchiveBuffer(limit int) *archiveBuffer {
+	return &archiveBuffer{limit: limit, mem: archiveBufferPool.Get().(*bytes.Buffer)}
+}
+
+// ReadFrom reads stream until EOF, memory buffer never grows above the limit
+func (b *archiveBuffer) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.CopyN(b.mem, r, int64(b.limit))
+	b.size = n
+	if err == io.EOF {
+		return n, nil
+	}
+	if err != nil {
+		return n, err
+	}
+
+	file, err := ioutil.TempFile("", "wal-g-archive-")
+	if err != nil {
+		return n, fmt.Errorf("can not create archive spill file: %w", err)
+	}
+	b.file = file
+	tracelog.DebugLogger.Printf("Archive exceeds %d bytes, spilling it to %s", b.limit, file.Name())
+	if _, err := file.Write(b.mem.Bytes()); err != nil {
+		return n, err
+	}
+	b.mem.Reset()
+	m, err := io.Copy(file, r)
+	b.size += m
+	return b.size, err
+}
+
+// Len returns size of buffered data
+func (b *archiveBuffer) Len() int64 {
+	return b.size
+}
+
+// InMemory returns if data is kept in memory
+func (b *archiveBuffer) InMemory() bool {
+	return b.file == nil
+}
+
+// Bytes returns buffered data kept in memory, it is valid until Close
+func (b *archiveBuffer) Bytes() []byte {
+	return b.mem.Bytes()
+}
+
+// Reader returns reader of buffered data.
+// Memory reader provides io.ReaderAt+io.ReadSeeker which enables buffer pool usage of s3 upload.
+func (b *archiveBuffer) Reader() io.ReadSeeker {
+	if b.file != nil {
+		return io.NewSectionReader(b.file, 0, b.size)
+	}
+	return bytes.NewReader(b.mem.Bytes())
+}
+
+// Close returns memory buffer to the pool and removes spill file
+func (b *archiveBuffer) Close() error {
+	// buffer capacity may be doubled on the last growth
+	if b.mem.Cap() <= 2*b.limit {
+		b.mem.Reset()
+		archiveBufferPool.Put(b.mem)
+	}
+	b.mem = nil
+	if b.file == nil {
+		return nil
+	}
+	_ = b.file.Close()
+	return os.Remove(b.file.Name())
+}
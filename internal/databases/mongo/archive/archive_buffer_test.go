@@ -0,0 +1,40 @@
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveBuffer(t *testing.T) {
+	buf := newArchiveBuffer(16)
+	_, err := buf.ReadFrom(bytes.NewBufferString("small archive"))
+	require.NoError(t, err)
+	assert.True(t, buf.InMemory())
+	assert.Equal(t, int64(13), buf.Len())
+	data, err := ioutil.ReadAll(buf.Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, "small archive", string(data))
+	assert.NoError(t, buf.Close())
+}
+
+func TestArchiveBuffer_Spill(t *testing.T) {
+	payload := bytes.Repeat([]byte("large archive "), 10)
+	buf := newArchiveBuffer(16)
+	_, err := buf.ReadFrom(bytes.NewReader(payload))
+	require.NoError(t, err)
+	assert.False(t, buf.InMemory())
+	assert.Equal(t, int64(len(payload)), buf.Len())
+	data, err := ioutil.ReadAll(buf.Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, payload, data)
+
+	spillFile := buf.file.Name()
+	assert.NoError(t, buf.Close())
+	_, err = os.Stat(spillFile)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/internal/databases/mongo/client"
 	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"github.com/wal-g/tracelog"
 )
 
 // BackupInfoMarshalFunc defines sentinel unmarshal func
@@ -17,9 +19,16 @@ type BackupInfoMarshalFunc func(b Backup) ([]byte, error)
 
 type BackupListing interface {
 	Backups(backups []Backup, output io.Writer) error
+	Details(details []BackupDetail, output io.Writer) error
 	Names(backups []internal.BackupTime, output io.Writer) error
 }
 
+// BackupDetail extends backup sentinel data with storage state
+type BackupDetail struct {
+	Backup
+	OplogCovered bool
+}
+
 type TabbedBackupListing struct {
 	minwidth int
 	tabwidth int
@@ -55,6 +64,28 @@ func (bl *TabbedBackupListing) Backups(backups []Backup, output io.Writer) error
 	return writer.Flush()
 }
 
+func (bl *TabbedBackupListing) Details(details []BackupDetail, output io.Writer) error {
+	writer := tabwriter.NewWriter(output, bl.minwidth, bl.tabwidth, bl.padding, bl.padchar, bl.flags)
+
+	_, err := fmt.Fprintln(writer,
+		"name\tfinish_local_time\tts_before\tts_after\tdata_size\tcompressed_size\tversion\treplset\tincrement_from\toplog_covered")
+	if err != nil {
+		return err
+	}
+	for i := len(details) - 1; i >= 0; i-- {
+		b := details[i]
+		_, err := fmt.Fprintln(writer,
+			fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v",
+				b.BackupName, b.FinishLocalTime.Format(time.RFC3339), b.MongoMeta.Before.LastMajTS, b.MongoMeta.After.LastMajTS,
+				b.DataSize, b.CompressedSize, b.MongoMeta.Version, b.MongoMeta.ReplSetName, b.IncrementFrom, b.OplogCovered))
+		if err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
 func (bl *TabbedBackupListing) Names(backups []internal.BackupTime, output io.Writer) error {
 	writer := tabwriter.NewWriter(output, bl.minwidth, bl.tabwidth, bl.padding, bl.padchar, bl.flags)
 
@@ -81,6 +112,32 @@ type Backup struct {
 	FinishLocalTime time.Time   `json:"FinishLocalTime,omitempty"`
 	UserData        interface{} `json:"UserData,omitempty"`
 	MongoMeta       MongoMeta   `json:"MongoMeta,omitempty"`
+	IncrementFrom   string      `json:"IncrementFrom,omitempty"`
+	DataSize        int64       `json:"DataSize,omitempty"`
+	CompressedSize  int64       `json:"CompressedSize,omitempty"`
+	DataDigest      string      `json:"DataDigest,omitempty"`
+}
+
+// IsIncremental returns if backup is a delta of another backup
+func (b Backup) IsIncremental() bool {
+	return b.IncrementFrom != ""
+}
+
+// ConsistentTS returns timestamp oplog replay should start from after the backup is restored.
+// Backups made with 'mongodump --oplog' are consistent at the last dumped oplog record.
+func (b Backup) ConsistentTS() models.Timestamp {
+	if b.MongoMeta.DumpConsistentTS != nil {
+		return *b.MongoMeta.DumpConsistentTS
+	}
+	return b.MongoMeta.After.LastMajTS
+}
+
+// PhysicalBackupType marks backups of database files
+const PhysicalBackupType = "physical"
+
+// IsPhysical checks if backup contains database files instead of logical dump
+func (b Backup) IsPhysical() bool {
+	return b.MongoMeta.BackupType == PhysicalBackupType
 }
 
 // NodeMeta represents MongoDB node metadata
@@ -91,8 +148,24 @@ type NodeMeta struct {
 
 // MongoMeta includes NodeMeta Before and after backup
 type MongoMeta struct {
-	Before NodeMeta `json:"Before,omitempty"`
-	After  NodeMeta `json:"After,omitempty"`
+	Before                      NodeMeta              `json:"Before,omitempty"`
+	After                       NodeMeta              `json:"After,omitempty"`
+	Version                     string                `json:"Version,omitempty"`
+	FeatureCompatibilityVersion string                `json:"FeatureCompatibilityVersion,omitempty"`
+	ReplSetName                 string                `json:"ReplSetName,omitempty"`
+	Hosts                       []string              `json:"Hosts,omitempty"`
+	ReplSetConfig               *models.ReplSetConfig `json:"ReplSetConfig,omitempty"`
+	BackupType                  string                `json:"BackupType,omitempty"`
+	DumpConsistentTS            *models.Timestamp     `json:"DumpConsistentTS,omitempty"`
+	Files                       []PhysicalFile        `json:"Files,omitempty"`
+}
+
+// PhysicalFile describes database file of physical backup.
+// Delta backups contain only files which size or modification time differ from their base.
+type PhysicalFile struct {
+	Name    string    `json:"Name"`
+	Size    int64     `json:"Size"`
+	ModTime time.Time `json:"ModTime"`
 }
 
 // MongoMetaProvider defines interface to collect backup meta
@@ -121,6 +194,33 @@ func (m *MongoMetaDBProvider) Init() error {
 		LastTS:    lastTS,
 		LastMajTS: lastMajTS,
 	}
+
+	im, err := m.client.IsMaster(m.ctx)
+	if err != nil {
+		return fmt.Errorf("can not fetch replica set name: %w", err)
+	}
+	m.meta.ReplSetName = im.SetName
+	m.meta.Hosts = im.Hosts
+	version, err := m.client.ServerVersion(m.ctx)
+	if err != nil {
+		return fmt.Errorf("can not fetch server version: %w", err)
+	}
+	m.meta.Version = version
+
+	// topology details require extra privileges, backup is still usable without them
+	fcv, err := m.client.FeatureCompatibilityVersion(m.ctx)
+	if err != nil {
+		tracelog.WarningLogger.Printf("can not fetch feature compatibility version: %v", err)
+	}
+	m.meta.FeatureCompatibilityVersion = fcv
+	if im.SetName != "" {
+		config, err := m.client.ReplSetConfig(m.ctx)
+		if err != nil {
+			tracelog.WarningLogger.Printf("can not fetch replica set config: %v", err)
+		} else {
+			m.meta.ReplSetConfig = &config
+		}
+	}
 	return nil
 }
 
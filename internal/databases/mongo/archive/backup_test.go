@@ -0,0 +1,60 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	clientmocks "github.com/wal-g/wal-g/internal/databases/mongo/client/mocks"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMongoMetaDBProvider_Init(t *testing.T) {
+	config := models.ReplSetConfig{
+		ID:      "rs01",
+		Version: 3,
+		Members: []models.ReplSetMember{
+			{ID: 0, Host: "host1:27017", Priority: 1, Votes: 1},
+			{ID: 1, Host: "host2:27017", Hidden: true, Votes: 1},
+		},
+	}
+	lastTS := models.Timestamp{TS: 1579002001, Inc: 1}
+
+	driver := &clientmocks.MongoDriver{}
+	driver.On("LastWriteTS", mock.Anything).Return(lastTS, lastTS, nil)
+	driver.On("IsMaster", mock.Anything).
+		Return(models.IsMaster{SetName: "rs01", Hosts: []string{"host1:27017"}}, nil)
+	driver.On("ServerVersion", mock.Anything).Return("4.2.8", nil)
+	driver.On("FeatureCompatibilityVersion", mock.Anything).Return("4.0", nil)
+	driver.On("ReplSetConfig", mock.Anything).Return(config, nil)
+
+	provider := NewBackupMetaMongoProvider(context.TODO(), driver)
+	assert.NoError(t, provider.Init())
+	assert.Equal(t, MongoMeta{
+		Before:                      NodeMeta{LastTS: lastTS, LastMajTS: lastTS},
+		Version:                     "4.2.8",
+		FeatureCompatibilityVersion: "4.0",
+		ReplSetName:                 "rs01",
+		Hosts:                       []string{"host1:27017"},
+		ReplSetConfig:               &config,
+	}, provider.Meta())
+}
+
+func TestMongoMetaDBProvider_InitWithoutTopologyPrivileges(t *testing.T) {
+	lastTS := models.Timestamp{TS: 1579002001, Inc: 1}
+
+	driver := &clientmocks.MongoDriver{}
+	driver.On("LastWriteTS", mock.Anything).Return(lastTS, lastTS, nil)
+	driver.On("IsMaster", mock.Anything).Return(models.IsMaster{SetName: "rs01"}, nil)
+	driver.On("ServerVersion", mock.Anything).Return("4.2.8", nil)
+	driver.On("FeatureCompatibilityVersion", mock.Anything).Return("", fmt.Errorf("unauthorized"))
+	driver.On("ReplSetConfig", mock.Anything).Return(models.ReplSetConfig{}, fmt.Errorf("unauthorized"))
+
+	provider := NewBackupMetaMongoProvider(context.TODO(), driver)
+	assert.NoError(t, provider.Init())
+	assert.Nil(t, provider.Meta().ReplSetConfig)
+	assert.Equal(t, "4.2.8", provider.Meta().Version)
+}
@@ -0,0 +1,114 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const batchIndexLenSize = 8
+
+// BatchMember describes an oplog archive packed into a batch container.
+type BatchMember struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+}
+
+// BatchIndex describes batch container contents.
+// Container consists of compressed and encrypted member archives, followed by json encoded index
+// and its length as 8-byte big-endian integer.
+type BatchIndex struct {
+	Members []BatchMember `json:"members"`
+}
+
+// ReadBatchIndex extracts index from batch container contents.
+func ReadBatchIndex(container []byte) (BatchIndex, error) {
+	if len(container) < batchIndexLenSize {
+		return BatchIndex{}, fmt.Errorf("batch container is too short: %d bytes", len(container))
+	}
+	indexEnd := int64(len(container) - batchIndexLenSize)
+	indexLen := int64(binary.BigEndian.Uint64(container[indexEnd:]))
+	if indexLen > indexEnd {
+		return BatchIndex{}, fmt.Errorf("malformed batch container: index length %d exceeds container size", indexLen)
+	}
+	var index BatchIndex
+	if err := json.Unmarshal(container[indexEnd-indexLen:indexEnd], &index); err != nil {
+		return BatchIndex{}, fmt.Errorf("can not unmarshal batch index: %w", err)
+	}
+	for _, member := range index.Members {
+		if member.Offset < 0 || member.Size < 0 || member.Offset+member.Size > indexEnd-indexLen {
+			return BatchIndex{}, fmt.Errorf("malformed batch container: member %s is out of bounds", member.Name)
+		}
+	}
+	return index, nil
+}
+
+// oplogBatch accumulates consecutive oplog archives to be uploaded as a single container.
+type oplogBatch struct {
+	buf     bytes.Buffer
+	index   BatchIndex
+	first   models.Archive
+	last    models.Archive
+	started time.Time
+}
+
+// Len returns count of archives in batch
+func (b *oplogBatch) Len() int {
+	return len(b.index.Members)
+}
+
+// Size returns size of archives in batch
+func (b *oplogBatch) Size() int {
+	return b.buf.Len()
+}
+
+// Follows returns if given archive continues batch sequence
+func (b *oplogBatch) Follows(arch models.Archive) bool {
+	return b.Len() == 0 || (b.last.End == arch.Start && b.last.Ext == arch.Ext)
+}
+
+// Add appends archive contents to batch
+func (b *oplogBatch) Add(arch models.Archive, data []byte) {
+	if b.Len() == 0 {
+		b.first = arch
+		b.started = utility.TimeNowCrossPlatformLocal()
+	}
+	b.index.Members = append(b.index.Members, BatchMember{
+		Name:   arch.Filename(),
+		Offset: int64(b.buf.Len()),
+		Size:   int64(len(data)),
+	})
+	b.buf.Write(data)
+	b.last = arch
+}
+
+// Archive returns archive describing the whole batch
+func (b *oplogBatch) Archive() (models.Archive, error) {
+	return models.NewArchive(b.first.Start, b.last.End, b.first.Ext, models.ArchiveTypeBatch)
+}
+
+// Container returns batch contents followed by index
+func (b *oplogBatch) Container() ([]byte, error) {
+	index, err := json.Marshal(b.index)
+	if err != nil {
+		return nil, fmt.Errorf("can not marshal batch index: %w", err)
+	}
+	container := make([]byte, 0, b.buf.Len()+len(index)+batchIndexLenSize)
+	container = append(container, b.buf.Bytes()...)
+	container = append(container, index...)
+	indexLen := make([]byte, batchIndexLenSize)
+	binary.BigEndian.PutUint64(indexLen, uint64(len(index)))
+	return append(container, indexLen...), nil
+}
+
+// Reset empties batch for reuse
+func (b *oplogBatch) Reset() {
+	b.buf.Reset()
+	b.index.Members = nil
+}
@@ -0,0 +1,85 @@
+package archive
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+)
+
+type testWriteCloser struct {
+	strings.Builder
+}
+
+func (w *testWriteCloser) Close() error {
+	return nil
+}
+
+func TestStorageUploader_BatchesSmallOplogArchives(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	uploader := NewStorageUploader(internal.NewUploader(compression.Compressors[lz4.AlgorithmName], folder),
+		BatchOplogArchives(1<<20, time.Hour))
+	downloader := &StorageDownloader{oplogsFolder: folder, backupsFolder: folder}
+
+	tss := []models.Timestamp{{TS: 1, Inc: 1}, {TS: 2, Inc: 1}, {TS: 3, Inc: 1}, {TS: 4, Inc: 1}}
+	contents := []string{"first", "second", "third"}
+	for i, content := range contents {
+		assert.NoError(t, uploader.UploadOplogArchive(strings.NewReader(content), tss[i], tss[i+1]))
+	}
+	archives, err := downloader.ListOplogArchives()
+	assert.NoError(t, err)
+	assert.Empty(t, archives)
+
+	assert.NoError(t, uploader.UploadGapArchive(errors.New("gap"), tss[3], models.Timestamp{TS: 5, Inc: 1}))
+	archives, err = downloader.ListOplogArchives()
+	assert.NoError(t, err)
+	sort.Slice(archives, func(i, j int) bool { return archives[i].Type < archives[j].Type })
+	assert.Equal(t, []models.Archive{
+		{Start: tss[0], End: tss[3], Ext: lz4.FileExtension, Type: models.ArchiveTypeBatch},
+		{Start: tss[3], End: models.Timestamp{TS: 5, Inc: 1}, Ext: lz4.FileExtension, Type: models.ArchiveTypeGap},
+	}, archives)
+
+	all := &testWriteCloser{}
+	assert.NoError(t, downloader.DownloadOplogArchive(archives[0], all))
+	assert.Equal(t, "firstsecondthird", all.String())
+
+	since := &testWriteCloser{}
+	assert.NoError(t, downloader.DownloadOplogArchiveSince(archives[0], tss[2], since))
+	assert.Equal(t, "secondthird", since.String())
+}
+
+func TestStorageUploader_UploadsBatchOnTimeoutAndFlush(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	uploader := NewStorageUploader(internal.NewUploader(compression.Compressors[lz4.AlgorithmName], folder),
+		BatchOplogArchives(1<<20, 10*time.Millisecond))
+	downloader := &StorageDownloader{oplogsFolder: folder, backupsFolder: folder}
+
+	tss := []models.Timestamp{{TS: 1, Inc: 1}, {TS: 2, Inc: 1}, {TS: 3, Inc: 1}}
+	assert.NoError(t, uploader.UploadOplogArchive(strings.NewReader("first"), tss[0], tss[1]))
+	assert.Eventually(t, func() bool {
+		archives, err := downloader.ListOplogArchives()
+		return err == nil && len(archives) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	uploader.batchTimeout = time.Hour
+	assert.NoError(t, uploader.UploadOplogArchive(strings.NewReader("second"), tss[1], tss[2]))
+	assert.NoError(t, uploader.Flush())
+	archives, err := downloader.ListOplogArchives()
+	assert.NoError(t, err)
+	assert.Len(t, archives, 2)
+}
+
+func TestReadBatchIndex_MalformedContainer(t *testing.T) {
+	_, err := ReadBatchIndex([]byte{1, 2, 3})
+	assert.Error(t, err)
+	_, err = ReadBatchIndex([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 100})
+	assert.Error(t, err)
+}
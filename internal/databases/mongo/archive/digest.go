@@ -0,0 +1,87 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+)
+
+// DigestMismatchError is returned if downloaded data differs from data uploaded to storage
+type DigestMismatchError struct {
+	name     string
+	expected string
+	actual   string
+}
+
+func (err DigestMismatchError) Error() string {
+	return fmt.Sprintf("sha256 digest mismatch of '%s': expected %s, got %s", err.name, err.expected, err.actual)
+}
+
+func computeDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// uploadWithDigest uploads object and returns its digest, content is read twice
+func uploadWithDigest(upl internal.UploaderProvider, name string, content io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if err := upl.Upload(name, content); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readVerifiedObject reads object and verifies it with given digest. Object is not verified if digest is empty.
+func readVerifiedObject(folder storage.Folder, name, digest string) ([]byte, error) {
+	reader, err := folder.ReadObject(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(reader)
+	utility.LoggedClose(reader, "")
+	if err != nil {
+		return nil, fmt.Errorf("can not read %s: %w", name, err)
+	}
+	if digest == "" {
+		tracelog.DebugLogger.Printf("Digest of %s is not found, skipping verification", name)
+		return data, nil
+	}
+	if actual := computeDigest(data); actual != digest {
+		return nil, DigestMismatchError{name: name, expected: digest, actual: actual}
+	}
+	return data, nil
+}
+
+// digestWriter computes digest of data written to underlying writer, Close is deferred to the caller
+type digestWriter struct {
+	io.Writer
+	hash hash.Hash
+}
+
+func newDigestWriter(w io.Writer) *digestWriter {
+	h := sha256.New()
+	return &digestWriter{Writer: io.MultiWriter(w, h), hash: h}
+}
+
+func (w *digestWriter) Close() error {
+	return nil
+}
+
+func (w *digestWriter) Digest() string {
+	return hex.EncodeToString(w.hash.Sum(nil))
+}
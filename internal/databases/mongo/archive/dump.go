@@ -0,0 +1,147 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	dumpArchiveMagic      = 0x8199e26d
+	dumpArchiveTerminator = -1
+	dumpOplogCollection   = "oplog"
+	// oplog records may slightly exceed max user document size
+	maxDumpDocumentSize = models.MaxDocumentSize + 16*1024
+)
+
+type dumpNamespaceHeader struct {
+	Database   string `bson:"db"`
+	Collection string `bson:"collection"`
+	EOF        bool   `bson:"EOF"`
+}
+
+// DumpOplogTracker parses mongodump archive stream and tracks timestamp of the last dumped oplog record,
+// which is the consistency point of backup made with 'mongodump --archive --oplog'.
+type DumpOplogTracker struct {
+	pw     *io.PipeWriter
+	done   chan struct{}
+	lastTS *models.Timestamp
+	err    error
+}
+
+// NewDumpOplogTracker builds DumpOplogTracker, stream should be written to it.
+func NewDumpOplogTracker() *DumpOplogTracker {
+	pr, pw := io.Pipe()
+	t := &DumpOplogTracker{pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(t.done)
+		t.lastTS, t.err = parseDumpOplogTS(bufio.NewReader(pr))
+		// stream is drained anyway, so writer is never blocked
+		_, _ = io.Copy(ioutil.Discard, pr)
+	}()
+	return t
+}
+
+func (t *DumpOplogTracker) Write(p []byte) (int, error) {
+	return t.pw.Write(p)
+}
+
+// Close waits for the written stream to be parsed.
+func (t *DumpOplogTracker) Close() error {
+	if err := t.pw.Close(); err != nil {
+		return err
+	}
+	<-t.done
+	return nil
+}
+
+// LastTS returns timestamp of the last oplog record, nil is returned if stream contains no oplog.
+// It should be called after Close.
+func (t *DumpOplogTracker) LastTS() (*models.Timestamp, error) {
+	return t.lastTS, t.err
+}
+
+func parseDumpOplogTS(r io.Reader) (*models.Timestamp, error) {
+	var magic uint32
+	if err := binary.Read(r, binary.LittleEndian, &magic); err != nil {
+		return nil, fmt.Errorf("can not read archive magic number: %w", err)
+	}
+	if magic != dumpArchiveMagic {
+		return nil, fmt.Errorf("stream is not a mongodump archive")
+	}
+
+	// prelude: archive header and collections metadata
+	for {
+		doc, err := readDumpDocument(r)
+		if err != nil {
+			return nil, fmt.Errorf("can not read archive prelude: %w", err)
+		}
+		if doc == nil {
+			break
+		}
+	}
+
+	var lastTS *models.Timestamp
+	for {
+		doc, err := readDumpDocument(r)
+		if err == io.EOF {
+			return lastTS, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can not read namespace header: %w", err)
+		}
+		if doc == nil {
+			return nil, fmt.Errorf("unexpected terminator instead of namespace header")
+		}
+		header := dumpNamespaceHeader{}
+		if err := bson.Unmarshal(doc, &header); err != nil {
+			return nil, fmt.Errorf("can not unmarshal namespace header: %w", err)
+		}
+		isOplog := header.Database == "" && header.Collection == dumpOplogCollection
+
+		for {
+			doc, err := readDumpDocument(r)
+			if err != nil {
+				return nil, fmt.Errorf("can not read '%s.%s' document: %w", header.Database, header.Collection, err)
+			}
+			if doc == nil {
+				break
+			}
+			if !isOplog {
+				continue
+			}
+			ts, inc, ok := doc.Lookup("ts").TimestampOK()
+			if !ok {
+				return nil, fmt.Errorf("oplog record without timestamp")
+			}
+			lastTS = &models.Timestamp{TS: ts, Inc: inc}
+		}
+	}
+}
+
+// readDumpDocument reads next BSON document, nil is returned on block terminator.
+func readDumpDocument(r io.Reader) (bson.Raw, error) {
+	var sizeBuf [4]byte
+	if _, err := io.ReadFull(r, sizeBuf[:]); err != nil {
+		return nil, err
+	}
+	size := int32(binary.LittleEndian.Uint32(sizeBuf[:]))
+	if size == dumpArchiveTerminator {
+		return nil, nil
+	}
+	if size < 5 || size > maxDumpDocumentSize {
+		return nil, fmt.Errorf("invalid document size %d", size)
+	}
+	doc := make([]byte, size)
+	copy(doc, sizeBuf[:])
+	if _, err := io.ReadFull(r, doc[4:]); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
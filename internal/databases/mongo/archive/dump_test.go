@@ -0,0 +1,55 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func writeDumpDocs(t *testing.T, buf *bytes.Buffer, docs ...interface{}) {
+	for _, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		require.NoError(t, err)
+		buf.Write(raw)
+	}
+	require.NoError(t, binary.Write(buf, binary.LittleEndian, int32(dumpArchiveTerminator)))
+}
+
+func TestDumpOplogTracker(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, binary.Write(buf, binary.LittleEndian, uint32(dumpArchiveMagic)))
+	writeDumpDocs(t, buf, bson.M{"version": "0.1"}, bson.M{"db": "shop", "collection": "orders"})
+	writeDumpDocs(t, buf, bson.M{"db": "shop", "collection": "orders"}, bson.M{"_id": 1})
+	writeDumpDocs(t, buf, bson.M{"db": "", "collection": "oplog"},
+		bson.M{"ts": primitive.Timestamp{T: 1579541000, I: 1}, "op": "i"},
+		bson.M{"ts": primitive.Timestamp{T: 1579541003, I: 2}, "op": "u"})
+	writeDumpDocs(t, buf, bson.M{"db": "", "collection": "oplog", "EOF": true})
+
+	tracker := NewDumpOplogTracker()
+	_, err := io.Copy(tracker, buf)
+	require.NoError(t, err)
+	require.NoError(t, tracker.Close())
+
+	lastTS, err := tracker.LastTS()
+	assert.NoError(t, err)
+	assert.Equal(t, &models.Timestamp{TS: 1579541003, Inc: 2}, lastTS)
+}
+
+func TestDumpOplogTracker_NotArchive(t *testing.T) {
+	tracker := NewDumpOplogTracker()
+	_, err := io.Copy(tracker, bytes.NewBufferString("not a mongodump archive stream"))
+	require.NoError(t, err)
+	require.NoError(t, tracker.Close())
+
+	lastTS, err := tracker.LastTS()
+	assert.Error(t, err)
+	assert.Nil(t, lastTS)
+}
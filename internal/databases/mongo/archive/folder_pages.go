@@ -0,0 +1,48 @@
+package archive
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	s3storage "github.com/wal-g/storages/s3"
+	"github.com/wal-g/storages/storage"
+)
+
+// listFolderPages calls pageFunc for each page of folder objects, so the whole listing is not kept in memory.
+// S3 folders are listed by pages of ListObjectsV2, other storages do not support paging and are listed at once.
+func listFolderPages(folder storage.Folder, pageFunc func(objects []storage.Object) error) error {
+	if s3Folder, ok := folder.(*s3storage.Folder); ok {
+		return listS3FolderPages(s3Folder, pageFunc)
+	}
+	objects, _, err := folder.ListFolder()
+	if err != nil {
+		return err
+	}
+	return pageFunc(objects)
+}
+
+func listS3FolderPages(folder *s3storage.Folder, pageFunc func(objects []storage.Object) error) error {
+	input := &s3.ListObjectsV2Input{
+		Bucket:    folder.Bucket,
+		Prefix:    aws.String(folder.Path),
+		Delimiter: aws.String("/"),
+	}
+	var pageErr error
+	err := folder.S3API.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		objects := make([]storage.Object, 0, len(page.Contents))
+		for _, object := range page.Contents {
+			// some storages return the folder itself as a key
+			if *object.Key == folder.Path {
+				continue
+			}
+			objects = append(objects, storage.NewLocalObject(strings.TrimPrefix(*object.Key, folder.Path), *object.LastModified))
+		}
+		pageErr = pageFunc(objects)
+		return pageErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return pageErr
+}
@@ -0,0 +1,152 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+	"github.com/wal-g/wal-g/utility"
+
+	"github.com/wal-g/storages/storage"
+)
+
+// OplogIndexName is the name of oplog index object in oplog archives folder
+const OplogIndexName = "oplog_index.json"
+
+// oplogIndexUpdateAttempts is how many times index update is repeated if it is overwritten by a concurrent update
+const oplogIndexUpdateAttempts = 3
+
+// OplogRange is a contiguous range of archived oplog records
+type OplogRange struct {
+	Start models.Timestamp `json:"Start"`
+	End   models.Timestamp `json:"End"`
+}
+
+// OplogIndex records the timeline of oplog archives, so frequent checks do not list all archives.
+// Contiguous archives are merged into a single range, so index grows only with archiving gaps.
+// Index is updated without locks, so it may miss recent archives if concurrent updates overwrite each other:
+// readers rely on archives it contains and list archives to check the ones it doesn't.
+// Digests of uploaded archives are kept in index by archive name until archives are purged.
+type OplogIndex struct {
+	LastTS  models.Timestamp  `json:"LastTS"`
+	Ranges  []OplogRange      `json:"Ranges"`
+	Digests map[string]string `json:"Digests,omitempty"`
+}
+
+// NewOplogIndex builds index of given archives
+func NewOplogIndex(archives []models.Archive) OplogIndex {
+	index := OplogIndex{Ranges: []OplogRange{}}
+	for _, arch := range archives {
+		index.Add(arch)
+	}
+	return index
+}
+
+// Add records archive in index
+func (idx *OplogIndex) Add(arch models.Archive) {
+	idx.LastTS = models.MaxTS(idx.LastTS, arch.End)
+	if !arch.HasOplog() {
+		return
+	}
+	ranges := append(idx.Ranges, OplogRange{Start: arch.Start, End: arch.End})
+	sort.Slice(ranges, func(i, j int) bool {
+		return models.LessTS(ranges[i].Start, ranges[j].Start)
+	})
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if models.LessTS(last.End, r.Start) {
+			merged = append(merged, r)
+			continue
+		}
+		last.End = models.MaxTS(last.End, r.End)
+	}
+	idx.Ranges = merged
+}
+
+// AddDigest records SHA256 digest of archive, it is verified when archive is downloaded
+func (idx *OplogIndex) AddDigest(arch models.Archive, digest string) {
+	if idx.Digests == nil {
+		idx.Digests = make(map[string]string)
+	}
+	idx.Digests[arch.Filename()] = digest
+}
+
+// Digest returns SHA256 digest of archive, it is empty if archive was uploaded without digest
+func (idx OplogIndex) Digest(arch models.Archive) string {
+	return idx.Digests[arch.Filename()]
+}
+
+// Contains checks if archive is recorded in index
+func (idx OplogIndex) Contains(arch models.Archive) bool {
+	if models.LessTS(idx.LastTS, arch.End) {
+		return false
+	}
+	if !arch.HasOplog() {
+		return true
+	}
+	for _, r := range idx.Ranges {
+		if !models.LessTS(arch.Start, r.Start) && !models.LessTS(r.End, arch.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCovered checks if index contains contiguous oplog from since timestamp to the newest archived one,
+// the same way as IsCoveredByOplog does for archives.
+func (idx OplogIndex) IsCovered(since models.Timestamp) bool {
+	if len(idx.Ranges) == 0 {
+		return false
+	}
+	last := idx.Ranges[len(idx.Ranges)-1]
+	return models.LessTS(last.Start, since) && !models.LessTS(last.End, since)
+}
+
+// readOplogIndex downloads oplog index, false is returned if index does not exist
+func readOplogIndex(folder storage.Folder) (OplogIndex, bool, error) {
+	reader, exists, err := internal.TryDownloadFile(folder, OplogIndexName)
+	if err != nil || !exists {
+		return OplogIndex{}, false, err
+	}
+	data, err := ioutil.ReadAll(reader)
+	utility.LoggedClose(reader, "")
+	if err != nil {
+		return OplogIndex{}, false, fmt.Errorf("can not read oplog index: %w", err)
+	}
+	var index OplogIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return OplogIndex{}, false, fmt.Errorf("can not unmarshal oplog index: %w", err)
+	}
+	return index, true, nil
+}
+
+// loadOplogIndex downloads oplog index or builds it by listing archives if index does not exist
+func loadOplogIndex(folder storage.Folder) (OplogIndex, error) {
+	index, exists, err := readOplogIndex(folder)
+	if err != nil || exists {
+		return index, err
+	}
+	return listOplogIndex(folder)
+}
+
+// listOplogIndex builds oplog index by listing archives
+func listOplogIndex(folder storage.Folder) (OplogIndex, error) {
+	index := NewOplogIndex(nil)
+	err := forEachOplogArchive(folder, func(arch models.Archive) error {
+		index.Add(arch)
+		return nil
+	})
+	return index, err
+}
+
+func marshalOplogIndex(index OplogIndex) ([]byte, error) {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return nil, fmt.Errorf("can not marshal oplog index: %w", err)
+	}
+	return data, nil
+}
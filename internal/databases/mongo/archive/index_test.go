@@ -0,0 +1,140 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/storages/storage"
+)
+
+func TestOplogIndex_IsCovered(t *testing.T) {
+	archives := []models.Archive{
+		{Start: models.Timestamp{TS: 400, Inc: 1}, End: models.Timestamp{TS: 500, Inc: 1}, Ext: "br", Type: models.ArchiveTypeOplog},
+		{Start: models.Timestamp{TS: 100, Inc: 1}, End: models.Timestamp{TS: 200, Inc: 1}, Ext: "br", Type: models.ArchiveTypeOplog},
+		{Start: models.Timestamp{TS: 200, Inc: 1}, End: models.Timestamp{TS: 300, Inc: 1}, Ext: "br", Type: models.ArchiveTypeGap},
+		{Start: models.Timestamp{TS: 300, Inc: 1}, End: models.Timestamp{TS: 400, Inc: 1}, Ext: "br", Type: models.ArchiveTypeOplog},
+	}
+	index := NewOplogIndex(archives)
+	assert.Equal(t, models.Timestamp{TS: 500, Inc: 1}, index.LastTS)
+	assert.Equal(t, []OplogRange{
+		{Start: models.Timestamp{TS: 100, Inc: 1}, End: models.Timestamp{TS: 200, Inc: 1}},
+		{Start: models.Timestamp{TS: 300, Inc: 1}, End: models.Timestamp{TS: 500, Inc: 1}},
+	}, index.Ranges)
+
+	for _, ts := range []models.Timestamp{{TS: 150, Inc: 1}, {TS: 300, Inc: 1}, {TS: 350, Inc: 1}, {TS: 500, Inc: 1}, {TS: 600, Inc: 1}} {
+		assert.Equal(t, IsCoveredByOplog(archives, ts), index.IsCovered(ts), ts.String())
+	}
+	assert.False(t, NewOplogIndex(nil).IsCovered(models.Timestamp{TS: 150, Inc: 1}))
+}
+
+func TestStorageUploader_MaintainOplogIndex(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	uploader := NewStorageUploader(internal.NewUploader(compression.Compressors[lz4.AlgorithmName], folder),
+		MaintainOplogIndex(folder))
+	downloader := &StorageDownloader{oplogsFolder: folder, backupsFolder: folder}
+	purger := &StoragePurger{oplogsFolder: folder, backupsFolder: folder}
+
+	for i := uint32(1); i <= 3; i++ {
+		require.NoError(t, uploader.UploadOplogArchive(strings.NewReader("oplog"),
+			models.Timestamp{TS: i * 10, Inc: 1}, models.Timestamp{TS: i*10 + 10, Inc: 1}))
+	}
+	index, exists, err := readOplogIndex(folder)
+	require.NoError(t, err)
+	require.True(t, exists)
+	assert.Equal(t, []OplogRange{{Start: models.Timestamp{TS: 10, Inc: 1}, End: models.Timestamp{TS: 40, Inc: 1}}}, index.Ranges)
+	lastTS, err := downloader.LastKnownArchiveTS()
+	assert.NoError(t, err)
+	assert.Equal(t, models.Timestamp{TS: 40, Inc: 1}, lastTS)
+
+	first, err := models.NewArchive(models.Timestamp{TS: 10, Inc: 1}, models.Timestamp{TS: 20, Inc: 1}, "lz4", models.ArchiveTypeOplog)
+	require.NoError(t, err)
+	require.NoError(t, purger.DeleteOplogArchives([]models.Archive{first}))
+	index, err = downloader.OplogIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, []OplogRange{{Start: models.Timestamp{TS: 20, Inc: 1}, End: models.Timestamp{TS: 40, Inc: 1}}}, index.Ranges)
+	assert.Len(t, index.Digests, 2)
+	assert.Empty(t, index.Digest(first))
+}
+
+func TestStorageDownloader_LastKnownArchiveTSWithStaleIndex(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	uploader := NewStorageUploader(internal.NewUploader(compression.Compressors[lz4.AlgorithmName], folder),
+		MaintainOplogIndex(folder))
+	downloader := &StorageDownloader{oplogsFolder: folder, backupsFolder: folder}
+	require.NoError(t, uploader.UploadOplogArchive(strings.NewReader("oplog"),
+		models.Timestamp{TS: 10, Inc: 1}, models.Timestamp{TS: 20, Inc: 1}))
+
+	// archive uploaded without index update, e.g. if a concurrent update overwrote the index
+	require.NoError(t, folder.PutObject("oplog_20.1_30.1.lz4", strings.NewReader("oplog")))
+	index, _, err := readOplogIndex(folder)
+	require.NoError(t, err)
+	assert.Equal(t, models.Timestamp{TS: 20, Inc: 1}, index.LastTS)
+
+	lastTS, err := downloader.LastKnownArchiveTS()
+	assert.NoError(t, err)
+	assert.Equal(t, models.Timestamp{TS: 30, Inc: 1}, lastTS)
+}
+
+// racingIndexFolder overwrites oplog index with a stale one once, as a concurrent update does
+type racingIndexFolder struct {
+	storage.Folder
+	raced bool
+}
+
+func (f *racingIndexFolder) PutObject(name string, content io.Reader) error {
+	if err := f.Folder.PutObject(name, content); err != nil {
+		return err
+	}
+	if name != OplogIndexName || f.raced {
+		return nil
+	}
+	f.raced = true
+	data, err := marshalOplogIndex(NewOplogIndex(nil))
+	if err != nil {
+		return err
+	}
+	return f.Folder.PutObject(name, bytes.NewReader(data))
+}
+
+func TestStorageUploader_MaintainOplogIndex_ConcurrentUpdate(t *testing.T) {
+	folder := &racingIndexFolder{Folder: memory.NewFolder("", memory.NewStorage())}
+	uploader := NewStorageUploader(internal.NewUploader(compression.Compressors[lz4.AlgorithmName], folder),
+		MaintainOplogIndex(folder))
+	require.NoError(t, uploader.UploadOplogArchive(strings.NewReader("oplog"),
+		models.Timestamp{TS: 10, Inc: 1}, models.Timestamp{TS: 20, Inc: 1}))
+
+	index, exists, err := readOplogIndex(folder)
+	require.NoError(t, err)
+	require.True(t, exists)
+	assert.True(t, folder.raced)
+	assert.Equal(t, models.Timestamp{TS: 20, Inc: 1}, index.LastTS)
+}
+
+func TestStorageDownloader_ListedOplogIndex(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	uploader := NewStorageUploader(internal.NewUploader(compression.Compressors[lz4.AlgorithmName], folder))
+	require.NoError(t, uploader.UploadOplogArchive(strings.NewReader("oplog"),
+		models.Timestamp{TS: 10, Inc: 1}, models.Timestamp{TS: 20, Inc: 1}))
+	// stale index misses the archive
+	data, err := marshalOplogIndex(NewOplogIndex(nil))
+	require.NoError(t, err)
+	require.NoError(t, folder.PutObject(OplogIndexName, bytes.NewReader(data)))
+
+	downloader := &StorageDownloader{oplogsFolder: folder, backupsFolder: folder}
+	index, err := downloader.OplogIndex()
+	require.NoError(t, err)
+	assert.False(t, index.IsCovered(models.Timestamp{TS: 15, Inc: 1}))
+	index, err = downloader.ListedOplogIndex()
+	require.NoError(t, err)
+	assert.True(t, index.IsCovered(models.Timestamp{TS: 15, Inc: 1}))
+}
@@ -34,7 +34,7 @@ func SequenceBetweenTS(archives []models.Archive, since, until models.Timestamp)
 
 	for i := range archives {
 		arch := archives[i]
-		if arch.Type != models.ArchiveTypeOplog {
+		if !arch.HasOplog() {
 			continue
 		}
 		lastTSArch[arch.End] = &arch // TODO: we can have few archives with same endTS
@@ -66,6 +66,21 @@ func SequenceBetweenTS(archives []models.Archive, since, until models.Timestamp)
 	return nil, fmt.Errorf("cycles in archive sequence detected")
 }
 
+// IsCoveredByOplog checks if archives contain contiguous oplog from since timestamp to the newest archived one
+func IsCoveredByOplog(archives []models.Archive, since models.Timestamp) bool {
+	var lastTS *models.Timestamp
+	for i := range archives {
+		if archives[i].HasOplog() && (lastTS == nil || models.LessTS(*lastTS, archives[i].End)) {
+			lastTS = &archives[i].End
+		}
+	}
+	if lastTS == nil || models.LessTS(*lastTS, since) {
+		return false
+	}
+	_, err := SequenceBetweenTS(archives, since, *lastTS)
+	return err == nil
+}
+
 // BackupNamesFromBackupTimes forms list of backup names from BackupTime
 func BackupNamesFromBackupTimes(backups []internal.BackupTime) []string {
 	names := make([]string, 0, len(backups))
@@ -105,16 +120,30 @@ func SplitPurgingBackups(backups []Backup, retainCount *int, retainAfter *time.T
 		return backups[i].StartLocalTime.After(backups[j].StartLocalTime)
 	})
 
+	// delta backups are newer than their bases, so bases are met after retained deltas
+	requiredBases := make(map[string]bool)
+	retainBackup := func(backup Backup) {
+		retain = append(retain, backup)
+		if backup.IsIncremental() {
+			requiredBases[backup.IncrementFrom] = true
+		}
+	}
 	for _, backup := range backups {
 		if retainCount != nil && len(retain) < *retainCount { // TODO: fix condition, use func args
 			tracelog.DebugLogger.Printf("Preserving backup per retain count policy: %s", backup.BackupName)
-			retain = append(retain, backup)
+			retainBackup(backup)
 			continue
 		}
 
 		if retainAfter != nil && backup.StartLocalTime.After(*retainAfter) { // TODO: fix condition, use func args
 			tracelog.DebugLogger.Printf("Preserving backup per retain time policy: %s", backup.BackupName)
-			retain = append(retain, backup)
+			retainBackup(backup)
+			continue
+		}
+
+		if requiredBases[backup.BackupName] {
+			tracelog.DebugLogger.Printf("Preserving backup as a base of retained delta backup: %s", backup.BackupName)
+			retainBackup(backup)
 			continue
 		}
 		purge = append(purge, backup)
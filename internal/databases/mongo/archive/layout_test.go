@@ -341,6 +341,20 @@ var (
 	}
 )
 
+func TestIsCoveredByOplog(t *testing.T) {
+	archives := []models.Archive{
+		{Start: models.Timestamp{TS: 100, Inc: 1}, End: models.Timestamp{TS: 200, Inc: 1}, Ext: "br", Type: models.ArchiveTypeOplog},
+		{Start: models.Timestamp{TS: 200, Inc: 1}, End: models.Timestamp{TS: 300, Inc: 1}, Ext: "br", Type: models.ArchiveTypeGap},
+		{Start: models.Timestamp{TS: 300, Inc: 1}, End: models.Timestamp{TS: 400, Inc: 1}, Ext: "br", Type: models.ArchiveTypeOplog},
+		{Start: models.Timestamp{TS: 400, Inc: 1}, End: models.Timestamp{TS: 500, Inc: 1}, Ext: "br", Type: models.ArchiveTypeOplog},
+	}
+	assert.True(t, IsCoveredByOplog(archives, models.Timestamp{TS: 350, Inc: 1}))
+	assert.True(t, IsCoveredByOplog(archives, models.Timestamp{TS: 500, Inc: 1}))
+	assert.False(t, IsCoveredByOplog(archives, models.Timestamp{TS: 150, Inc: 1}))
+	assert.False(t, IsCoveredByOplog(archives, models.Timestamp{TS: 600, Inc: 1}))
+	assert.False(t, IsCoveredByOplog(nil, models.Timestamp{TS: 150, Inc: 1}))
+}
+
 func TestLastKnownInBackupTS(t *testing.T) {
 	type args struct {
 		backups []Backup
@@ -391,6 +405,14 @@ var (
 		{StartLocalTime: time.Unix(1579000100, 0), FinishLocalTime: time.Unix(1579000101, 0)},
 		{StartLocalTime: time.Unix(1579000001, 0), FinishLocalTime: time.Unix(1579000001, 0)},
 	}
+
+	DeltaSplitBackups = []Backup{
+		{BackupName: "delta_2", IncrementFrom: "delta_1", StartLocalTime: time.Unix(1579000500, 0)},
+		{BackupName: "full_2", StartLocalTime: time.Unix(1579000400, 0)},
+		{BackupName: "delta_1", IncrementFrom: "full_1", StartLocalTime: time.Unix(1579000300, 0)},
+		{BackupName: "full_1", StartLocalTime: time.Unix(1579000200, 0)},
+		{BackupName: "full_0", StartLocalTime: time.Unix(1579000100, 0)},
+	}
 )
 
 func IntPtr(i int) *int {
@@ -557,6 +579,17 @@ func TestSplitPurgingBackups(t *testing.T) {
 			wantRetain: SplitBackups[:4],
 			err:        nil,
 		},
+		{
+			name: "Purge_1,count=1_delta_chain_retained",
+			args: args{
+				backups:     DeltaSplitBackups,
+				retainCount: IntPtr(1),
+				retainAfter: nil,
+			},
+			wantPurge:  []Backup{DeltaSplitBackups[1], DeltaSplitBackups[4]},
+			wantRetain: []Backup{DeltaSplitBackups[0], DeltaSplitBackups[2], DeltaSplitBackups[3]},
+			err:        nil,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
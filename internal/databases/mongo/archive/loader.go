@@ -2,10 +2,15 @@ package archive
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"path"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/internal/compression"
@@ -14,10 +19,12 @@ import (
 	"github.com/wal-g/wal-g/utility"
 
 	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
 )
 
 var (
-	_ = []Uploader{&StorageUploader{}, &DiscardUploader{}}
+	_ = []Uploader{&StorageUploader{}, &DiscardUploader{}, &MultiUploader{}}
+	_ = []Flusher{&StorageUploader{}, &MultiUploader{}}
 	_ = []Downloader{&StorageDownloader{}}
 	_ = []Purger{&StoragePurger{}}
 )
@@ -30,23 +37,44 @@ type ErrWaiter interface {
 // Uploader defines interface to store mongodb backups and oplog archives
 type Uploader interface {
 	UploadOplogArchive(stream io.Reader, firstTS, lastTS models.Timestamp) error // TODO: rename firstTS
+	UploadCompressedOplogArchive(stream io.Reader, firstTS, lastTS models.Timestamp) error
 	UploadGapArchive(err error, firstTS, lastTS models.Timestamp) error
 	UploadBackup(stream io.Reader, cmd ErrWaiter, metaProvider MongoMetaProvider) error
+	UploadDeltaBackup(stream io.Reader, cmd ErrWaiter, base Backup, metaProvider MongoMetaProvider) error
+}
+
+// Flusher is implemented by uploaders which may hold oplog archives before uploading them
+type Flusher interface {
+	Flush() error
+}
+
+// FlushUploader uploads oplog archives held by uploader, if it holds any
+func FlushUploader(uploader Uploader) error {
+	if flusher, ok := uploader.(Flusher); ok {
+		return flusher.Flush()
+	}
+	return nil
 }
 
 // Downloader defines interface to fetch mongodb oplog archives
 type Downloader interface {
 	BackupMeta(name string) (Backup, error)
+	DownloadBackupStream(name string, writeCloser io.WriteCloser) error
 	DownloadOplogArchive(arch models.Archive, writeCloser io.WriteCloser) error
+	DownloadOplogArchiveSince(arch models.Archive, since models.Timestamp, writeCloser io.WriteCloser) error
 	ListOplogArchives() ([]models.Archive, error)
+	ListOplogArchivesBetween(since, until models.Timestamp) ([]models.Archive, error)
 	LoadBackups(names []string) ([]Backup, error)
 	ListBackupNames() ([]internal.BackupTime, error)
 	LastKnownArchiveTS() (models.Timestamp, error)
+	OplogIndex() (OplogIndex, error)
+	ListedOplogIndex() (OplogIndex, error)
 }
 
 type Purger interface {
 	DeleteBackups(backups []Backup) error
 	DeleteOplogArchives(archives []models.Archive) error
+	PlanBackupPurge(backup Backup, reason string) (BackupPurgePlan, error)
 }
 
 // StorageSettings defines storage relative paths
@@ -67,6 +95,10 @@ func NewDefaultStorageSettings() StorageSettings {
 type StorageDownloader struct {
 	oplogsFolder  storage.Folder
 	backupsFolder storage.Folder
+
+	indexMu sync.Mutex
+	// index is oplog index with digests of archives, it is downloaded again for archives newer than it
+	index *OplogIndex
 }
 
 // NewStorageDownloader builds mongodb downloader.
@@ -92,6 +124,23 @@ func (sd *StorageDownloader) BackupMeta(name string) (Backup, error) {
 	return sentinel, nil
 }
 
+// DownloadBackupStream downloads, decompresses and decrypts (if needed) backup stream.
+// Stream is verified with digest stored in backup sentinel, writeCloser is not closed on mismatch.
+func (sd *StorageDownloader) DownloadBackupStream(name string, writeCloser io.WriteCloser) error {
+	backup, err := sd.BackupMeta(name)
+	if err != nil {
+		return err
+	}
+	dst := newDigestWriter(writeCloser)
+	if err := internal.DownloadAndDecompressStream(internal.NewBackup(sd.backupsFolder, name), dst); err != nil {
+		return err
+	}
+	if backup.DataDigest != "" && backup.DataDigest != dst.Digest() {
+		return DigestMismatchError{name: name, expected: backup.DataDigest, actual: dst.Digest()}
+	}
+	return writeCloser.Close()
+}
+
 // LoadBackups downloads backups metadata
 func (sd *StorageDownloader) LoadBackups(names []string) ([]Backup, error) {
 	backups := make([]Backup, 0, len(names))
@@ -131,62 +180,199 @@ func (sd *StorageDownloader) ListBackupNames() ([]internal.BackupTime, error) {
 
 // DownloadOplogArchive downloads, decompresses and decrypts (if needed) oplog archive.
 func (sd *StorageDownloader) DownloadOplogArchive(arch models.Archive, writeCloser io.WriteCloser) error {
-	return internal.DownloadFile(sd.oplogsFolder, arch.Filename(), arch.Extension(), writeCloser)
+	return sd.DownloadOplogArchiveSince(arch, models.Timestamp{}, writeCloser)
 }
 
-// ListOplogArchives fetches all oplog archives existed in storage.
-func (sd *StorageDownloader) ListOplogArchives() ([]models.Archive, error) {
-	objects, _, err := sd.oplogsFolder.ListFolder()
+// DownloadOplogArchiveSince downloads, decompresses and decrypts (if needed) oplog archive.
+// Archive is verified with its digest recorded in oplog index before decompression, so corrupted records are never written.
+// Archives packed into batch container which end before since timestamp are skipped.
+func (sd *StorageDownloader) DownloadOplogArchiveSince(arch models.Archive, since models.Timestamp, writeCloser io.WriteCloser) error {
+	decompressor := compression.FindDecompressor(arch.Extension())
+	if decompressor == nil {
+		return fmt.Errorf("decompressor for extension '%s' was not found", arch.Extension())
+	}
+	digest, err := sd.archiveDigest(arch)
+	if err != nil {
+		return err
+	}
+	data, err := readVerifiedObject(sd.oplogsFolder, arch.Filename(), digest)
+	if err != nil {
+		return err
+	}
+
+	dst := &internal.EmptyWriteIgnorer{WriteCloser: writeCloser}
+	if arch.Type != models.ArchiveTypeBatch {
+		if err := internal.DecompressDecryptBytes(dst, ioutil.NopCloser(bytes.NewReader(data)), decompressor, internal.LogContentType); err != nil {
+			return err
+		}
+		utility.LoggedClose(writeCloser, "")
+		return nil
+	}
+
+	container := data
+	index, err := ReadBatchIndex(container)
 	if err != nil {
-		return nil, fmt.Errorf("can not list oplog archives folder: %w", err)
+		return fmt.Errorf("can not read index of batch container %s: %w", arch.Filename(), err)
 	}
 
-	archives := make([]models.Archive, 0, len(objects))
-	for _, key := range objects {
-		archName := key.GetName()
-		arch, err := models.ArchFromFilename(archName)
+	for _, member := range index.Members {
+		memberArch, err := models.ArchFromFilename(member.Name)
 		if err != nil {
-			return nil, fmt.Errorf("can not convert retrieve timestamps since oplog archive Ext '%s': %w", archName, err)
+			return fmt.Errorf("can not parse member of batch container %s: %w", arch.Filename(), err)
 		}
+		if models.LessTS(memberArch.End, since) {
+			continue
+		}
+		memberReader := ioutil.NopCloser(bytes.NewReader(container[member.Offset : member.Offset+member.Size]))
+		if err := internal.DecompressDecryptBytes(dst, memberReader, decompressor, internal.LogContentType); err != nil {
+			return fmt.Errorf("can not extract %s from batch container %s: %w", member.Name, arch.Filename(), err)
+		}
+	}
+	utility.LoggedClose(writeCloser, "")
+	return nil
+}
+
+// archiveDigest looks up digest of archive in oplog index. Index is cached by downloader,
+// it is downloaded again only if archive is newer than the cached index.
+func (sd *StorageDownloader) archiveDigest(arch models.Archive) (string, error) {
+	sd.indexMu.Lock()
+	defer sd.indexMu.Unlock()
+	if sd.index == nil || models.LessTS(sd.index.LastTS, arch.End) {
+		index, _, err := readOplogIndex(sd.oplogsFolder)
+		if err != nil {
+			return "", err
+		}
+		sd.index = &index
+	}
+	return sd.index.Digest(arch), nil
+}
+
+// ForEachOplogArchive calls archFunc for each oplog archive existed in storage, folder listing is not kept in memory.
+func (sd *StorageDownloader) ForEachOplogArchive(archFunc func(arch models.Archive) error) error {
+	return forEachOplogArchive(sd.oplogsFolder, archFunc)
+}
+
+func forEachOplogArchive(folder storage.Folder, archFunc func(arch models.Archive) error) error {
+	err := listFolderPages(folder, func(objects []storage.Object) error {
+		for _, key := range objects {
+			archName := key.GetName()
+			if archName == OplogIndexName {
+				continue
+			}
+			arch, err := models.ArchFromFilename(archName)
+			if err != nil {
+				return fmt.Errorf("can not convert retrieve timestamps since oplog archive Ext '%s': %w", archName, err)
+			}
+			if err := archFunc(arch); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("can not list oplog archives folder: %w", err)
+	}
+	return nil
+}
+
+// ListOplogArchives fetches all oplog archives existed in storage.
+func (sd *StorageDownloader) ListOplogArchives() ([]models.Archive, error) {
+	var archives []models.Archive
+	err := sd.ForEachOplogArchive(func(arch models.Archive) error {
 		archives = append(archives, arch)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return archives, nil
+}
+
+// ListOplogArchivesBetween fetches oplog archives which may contain records from since to until timestamps.
+func (sd *StorageDownloader) ListOplogArchivesBetween(since, until models.Timestamp) ([]models.Archive, error) {
+	var archives []models.Archive
+	err := sd.ForEachOplogArchive(func(arch models.Archive) error {
+		if !models.LessTS(arch.End, since) && !models.LessTS(until, arch.Start) {
+			archives = append(archives, arch)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return archives, nil
 }
 
 // LastKnownArchiveTS returns the most recent existed timestamp in storage folder.
+// Oplog index may miss the most recent archives, so archives are listed and a stale index is reported.
 func (sd *StorageDownloader) LastKnownArchiveTS() (models.Timestamp, error) {
-	maxTS := models.Timestamp{}
-	keys, _, err := sd.oplogsFolder.ListFolder()
+	index, indexed, err := readOplogIndex(sd.oplogsFolder)
 	if err != nil {
-		return models.Timestamp{}, fmt.Errorf("can not fetch keys since storage folder: %w ", err)
+		return models.Timestamp{}, err
 	}
-	for _, key := range keys {
-		filename := key.GetName()
-		arch, err := models.ArchFromFilename(filename)
-		if err != nil {
-			return models.Timestamp{}, fmt.Errorf("can not build archive since filename '%s': %w", filename, err)
-		}
-		maxTS = models.MaxTS(maxTS, arch.End)
+	lastTS := index.LastTS
+	err = sd.ForEachOplogArchive(func(arch models.Archive) error {
+		lastTS = models.MaxTS(lastTS, arch.End)
+		return nil
+	})
+	if err != nil {
+		return models.Timestamp{}, err
+	}
+	if indexed && lastTS != index.LastTS {
+		tracelog.WarningLogger.Printf("Oplog index is stale: last timestamp is '%s' in index, '%s' in storage",
+			index.LastTS, lastTS)
 	}
-	return maxTS, nil
+	return lastTS, nil
+}
+
+// OplogIndex returns timeline of oplog archives, archives are listed only if index is not stored yet.
+// Index may miss the most recent archives, see ListedOplogIndex.
+func (sd *StorageDownloader) OplogIndex() (OplogIndex, error) {
+	return loadOplogIndex(sd.oplogsFolder)
+}
+
+// ListedOplogIndex builds timeline of oplog archives by listing them, it is used to check what stored index misses.
+func (sd *StorageDownloader) ListedOplogIndex() (OplogIndex, error) {
+	return listOplogIndex(sd.oplogsFolder)
 }
 
 // DiscardUploader reads provided data and returns success
 type DiscardUploader struct {
-	compressor compression.Compressor
-	readerFrom io.ReaderFrom
+	compressor    compression.Compressor
+	logCrypter    crypto.Crypter
+	backupCrypter crypto.Crypter
+	readerFrom    io.ReaderFrom
 }
 
 // NewDiscardUploader builds DiscardUploader.
 func NewDiscardUploader(compressor compression.Compressor, readerFrom io.ReaderFrom) *DiscardUploader {
-	return &DiscardUploader{compressor, readerFrom}
+	return &DiscardUploader{
+		compressor:    compressor,
+		logCrypter:    internal.ConfigureCrypterForContentType(internal.LogContentType),
+		backupCrypter: internal.ConfigureCrypterForContentType(internal.BackupContentType),
+		readerFrom:    readerFrom,
+	}
+}
+
+// compressAndEncrypt processes stream the same way as it is processed on upload
+func compressAndEncrypt(reader io.Reader, compressor compression.Compressor, crypter crypto.Crypter) io.Reader {
+	if compressor == nil && crypter == nil {
+		return reader
+	}
+	return internal.CompressAndEncrypt(reader, compressor, crypter)
 }
 
 // UploadOplogArchive reads all data into memory, stream is compressed and encrypted if required
 func (d *DiscardUploader) UploadOplogArchive(archReader io.Reader, firstTS, lastTS models.Timestamp) error {
-	if d.compressor != nil {
-		archReader = internal.CompressAndEncrypt(archReader, d.compressor, internal.ConfigureCrypter())
-	}
+	return d.discardOplogArchive(compressAndEncrypt(archReader, d.compressor, d.logCrypter))
+}
+
+// UploadCompressedOplogArchive reads all data into memory, compressed stream is encrypted if required
+func (d *DiscardUploader) UploadCompressedOplogArchive(archReader io.Reader, firstTS, lastTS models.Timestamp) error {
+	return d.discardOplogArchive(compressAndEncrypt(archReader, nil, d.logCrypter))
+}
+
+func (d *DiscardUploader) discardOplogArchive(archReader io.Reader) error {
 	if d.readerFrom != nil {
 		if _, err := d.readerFrom.ReadFrom(archReader); err != nil {
 			return err
@@ -201,42 +387,293 @@ func (d *DiscardUploader) UploadGapArchive(err error, firstTS, lastTS models.Tim
 	return nil
 }
 
-// UploadBackup is not implemented yet
+// UploadBackup reads all data, stream is compressed and encrypted if required.
+// Sentinel is not uploaded but logged with backup throughput.
 func (d *DiscardUploader) UploadBackup(stream io.Reader, cmd ErrWaiter, metaProvider MongoMetaProvider) error {
-	panic("implement me")
+	return d.discardBackup(stream, cmd, metaProvider, "")
+}
+
+// UploadDeltaBackup reads all data of delta backup the same way as UploadBackup does.
+func (d *DiscardUploader) UploadDeltaBackup(stream io.Reader, cmd ErrWaiter, base Backup, metaProvider MongoMetaProvider) error {
+	return d.discardBackup(stream, cmd, metaProvider, base.BackupName)
+}
+
+func (d *DiscardUploader) discardBackup(stream io.Reader, cmd ErrWaiter, metaProvider MongoMetaProvider, incrementFrom string) error {
+	timeStart := utility.TimeNowCrossPlatformLocal()
+	backupName, err := internal.GetStreamBackupName(metaProvider.Meta().Before.LastMajTS.String())
+	if err != nil {
+		return err
+	}
+	dataSize, compressedSize, err := d.discardBackupStream(stream)
+	if err != nil {
+		return err
+	}
+
+	if err := metaProvider.Finalize(); err != nil {
+		return err
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return err
+	}
+
+	return d.discardSentinel(&Backup{
+		BackupName:      backupName,
+		StartLocalTime:  timeStart,
+		FinishLocalTime: utility.TimeNowCrossPlatformLocal(),
+		UserData:        internal.GetSentinelUserData(),
+		MongoMeta:       metaProvider.Meta(),
+		IncrementFrom:   incrementFrom,
+		DataSize:        dataSize,
+		CompressedSize:  compressedSize,
+	})
+}
+
+// discardBackupStream reads backup stream the same way as it is uploaded and returns its sizes
+func (d *DiscardUploader) discardBackupStream(stream io.Reader) (dataSize, compressedSize int64, err error) {
+	reader := compressAndEncrypt(internal.NewWithSizeReader(stream, &dataSize), d.compressor, d.backupCrypter)
+	reader = internal.NewWithSizeReader(reader, &compressedSize)
+	if d.readerFrom != nil {
+		_, err = d.readerFrom.ReadFrom(reader)
+	} else {
+		_, err = io.Copy(ioutil.Discard, reader)
+	}
+	return dataSize, compressedSize, err
+}
+
+// discardSentinel logs sentinel which would be uploaded
+func (d *DiscardUploader) discardSentinel(backup *Backup) error {
+	sentinel, err := json.Marshal(backup)
+	if err != nil {
+		return fmt.Errorf("can not marshal sentinel: %w", err)
+	}
+	seconds := backup.FinishLocalTime.Sub(backup.StartLocalTime).Seconds()
+	if seconds > 0 {
+		tracelog.InfoLogger.Printf("Backup stream is discarded: %d bytes read (%.2f MB/s), %d bytes after compression",
+			backup.DataSize, float64(backup.DataSize)/seconds/(1<<20), backup.CompressedSize)
+	}
+	tracelog.InfoLogger.Printf("Backup sentinel is not uploaded: %s", sentinel)
+	return nil
 }
 
 // StorageUploader extends base uploader with mongodb specific.
-// is NOT thread-safe
+// is NOT thread-safe, except that batch container is uploaded by timer concurrently with other calls
 type StorageUploader struct {
 	internal.UploaderProvider
-	crypter crypto.Crypter
-	buf     *bytes.Buffer
+	crypter      crypto.Crypter
+	bufLimit     int
+	batch        *oplogBatch
+	batchSize    int
+	batchTimeout time.Duration
+	indexFolder  storage.Folder
+
+	batchMu    sync.Mutex
+	batchTimer *time.Timer
+	// batchErr is the error of batch container upload by timer, it is returned by the next call
+	batchErr error
+}
+
+// StorageUploaderOption configures StorageUploader
+type StorageUploaderOption func(*StorageUploader)
+
+// BatchOplogArchives enables packing of oplog archives smaller than size into batch containers.
+// Container is uploaded when it reaches size or when its first archive is older than timeout.
+func BatchOplogArchives(size int, timeout time.Duration) StorageUploaderOption {
+	return func(su *StorageUploader) {
+		su.batchSize = size
+		su.batchTimeout = timeout
+	}
+}
+
+// MaintainOplogIndex enables updating of oplog index stored in oplog archives folder on each archive upload.
+func MaintainOplogIndex(oplogsFolder storage.Folder) StorageUploaderOption {
+	return func(su *StorageUploader) {
+		su.indexFolder = oplogsFolder
+	}
 }
 
 // NewStorageUploader builds mongodb uploader.
-func NewStorageUploader(upl internal.UploaderProvider) *StorageUploader {
+func NewStorageUploader(upl internal.UploaderProvider, opts ...StorageUploaderOption) *StorageUploader {
 	upl.DisableSizeTracking()
-	return &StorageUploader{upl, internal.ConfigureCrypter(), &bytes.Buffer{}}
+	su := &StorageUploader{
+		UploaderProvider: upl,
+		crypter:          internal.ConfigureCrypterForContentType(internal.LogContentType),
+		bufLimit:         DefaultArchiveBufferLimit,
+		batch:            &oplogBatch{},
+	}
+	for _, opt := range opts {
+		opt(su)
+	}
+	return su
 }
 
 // UploadOplogArchive compresses a stream and uploads it with given archive name.
 // TODO: test if upload content is readerAtSeeker
 func (su *StorageUploader) UploadOplogArchive(stream io.Reader, firstTS, lastTS models.Timestamp) error {
+	return su.uploadOplogArchive(internal.CompressAndEncrypt(stream, su.UploaderProvider.Compression(), su.crypter), firstTS, lastTS)
+}
+
+// UploadCompressedOplogArchive uploads a stream compressed with uploader compression, it is only encrypted.
+func (su *StorageUploader) UploadCompressedOplogArchive(stream io.Reader, firstTS, lastTS models.Timestamp) error {
+	return su.uploadOplogArchive(internal.CompressAndEncrypt(stream, nil, su.crypter), firstTS, lastTS)
+}
+
+func (su *StorageUploader) uploadOplogArchive(archReader io.Reader, firstTS, lastTS models.Timestamp) error {
 	arch, err := models.NewArchive(firstTS, lastTS, su.Compression().FileExtension(), models.ArchiveTypeOplog)
 	if err != nil {
 		return fmt.Errorf("can not build archive: %w", err)
 	}
 
-	_, err = su.buf.ReadFrom(internal.CompressAndEncrypt(stream, su.UploaderProvider.Compression(), su.crypter))
-	// TODO: warn if read > 2 * models.MaxDocumentSize and shrink buf capacity if it's too high
-	defer su.buf.Reset()
+	buf := newArchiveBuffer(su.bufLimit)
+	defer utility.LoggedClose(buf, "can not release archive buffer")
+	if _, err := buf.ReadFrom(archReader); err != nil {
+		return err
+	}
+
+	su.batchMu.Lock()
+	defer su.batchMu.Unlock()
+	if err := su.takeBatchErr(); err != nil {
+		return err
+	}
+
+	if su.batchSize <= 0 || buf.Len() >= int64(su.batchSize) || !buf.InMemory() {
+		if err := su.uploadBatch(); err != nil {
+			return err
+		}
+		digest, err := uploadWithDigest(su.UploaderProvider, arch.Filename(), buf.Reader())
+		if err != nil {
+			return err
+		}
+		return su.updateIndex(arch, digest)
+	}
+
+	if !su.batch.Follows(arch) {
+		if err := su.uploadBatch(); err != nil {
+			return err
+		}
+	}
+	su.batch.Add(arch, buf.Bytes())
+	if su.batch.Size() >= su.batchSize || utility.TimeNowCrossPlatformLocal().Sub(su.batch.started) >= su.batchTimeout {
+		return su.uploadBatch()
+	}
+	if su.batch.Len() == 1 {
+		su.batchTimer = time.AfterFunc(su.batchTimeout, su.uploadExpiredBatch)
+	}
+	return nil
+}
+
+// Flush uploads accumulated oplog archives, it is called when archiving stops
+func (su *StorageUploader) Flush() error {
+	su.batchMu.Lock()
+	defer su.batchMu.Unlock()
+	if err := su.takeBatchErr(); err != nil {
+		return err
+	}
+	return su.uploadBatch()
+}
+
+// uploadExpiredBatch uploads batch container by timer, so the last archives are uploaded
+// in time even if no more archives follow them
+func (su *StorageUploader) uploadExpiredBatch() {
+	su.batchMu.Lock()
+	defer su.batchMu.Unlock()
+	if su.batch.Len() == 0 || utility.TimeNowCrossPlatformLocal().Sub(su.batch.started) < su.batchTimeout {
+		return
+	}
+	if err := su.uploadBatch(); err != nil {
+		tracelog.ErrorLogger.Printf("Can not upload expired batch container: %v", err)
+		su.batchErr = err
+	}
+}
+
+// takeBatchErr returns and clears the error of batch container upload by timer
+func (su *StorageUploader) takeBatchErr() error {
+	err := su.batchErr
+	su.batchErr = nil
+	return err
+}
+
+// uploadBatch uploads accumulated oplog archives as a batch container.
+// Single archive is uploaded as is. Must be called with batchMu held.
+func (su *StorageUploader) uploadBatch() error {
+	if su.batchTimer != nil {
+		su.batchTimer.Stop()
+		su.batchTimer = nil
+	}
+	if su.batch == nil {
+		return nil
+	}
+	defer su.batch.Reset()
+	switch su.batch.Len() {
+	case 0:
+		return nil
+	case 1:
+		digest, err := uploadWithDigest(su.UploaderProvider, su.batch.first.Filename(), bytes.NewReader(su.batch.buf.Bytes()))
+		if err != nil {
+			return err
+		}
+		return su.updateIndex(su.batch.first, digest)
+	}
+
+	arch, err := su.batch.Archive()
+	if err != nil {
+		return fmt.Errorf("can not build batch archive: %w", err)
+	}
+	container, err := su.batch.Container()
 	if err != nil {
 		return err
 	}
+	digest, err := uploadWithDigest(su.UploaderProvider, arch.Filename(), bytes.NewReader(container))
+	if err != nil {
+		return fmt.Errorf("can not upload batch container %s: %w", arch.Filename(), err)
+	}
+	return su.updateIndex(arch, digest)
+}
+
+// updateIndex records uploaded archive and its digest in oplog index. Index is downloaded before each update,
+// so changes made by other processes (eg. purge) are kept. Index is read back after the update and the update
+// is repeated if a concurrent update overwrote it. Index is not required for archiving, so its failures are only logged.
+func (su *StorageUploader) updateIndex(arch models.Archive, digest string) error {
+	if su.indexFolder == nil {
+		return nil
+	}
+	for attempt := 1; attempt <= oplogIndexUpdateAttempts; attempt++ {
+		err := su.tryUpdateIndex(arch, digest)
+		if err == nil {
+			return nil
+		}
+		tracelog.WarningLogger.Printf("Can not update oplog index (attempt %d of %d): %v",
+			attempt, oplogIndexUpdateAttempts, err)
+	}
+	tracelog.WarningLogger.Printf("Oplog index misses archive '%s' until the next update, readers list archives instead",
+		arch.Filename())
+	return nil
+}
 
-	// providing io.ReaderAt+io.ReadSeeker to s3 upload enables buffer pool usage
-	return su.Upload(arch.Filename(), bytes.NewReader(su.buf.Bytes()))
+func (su *StorageUploader) tryUpdateIndex(arch models.Archive, digest string) error {
+	index, err := loadOplogIndex(su.indexFolder)
+	if err != nil {
+		return err
+	}
+	index.Add(arch)
+	if digest != "" {
+		index.AddDigest(arch, digest)
+	}
+	data, err := marshalOplogIndex(index)
+	if err != nil {
+		return err
+	}
+	if err := su.Upload(OplogIndexName, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("can not upload oplog index: %w", err)
+	}
+	index, _, err = readOplogIndex(su.indexFolder)
+	if err != nil {
+		return err
+	}
+	if !index.Contains(arch) || index.Digest(arch) != digest {
+		return fmt.Errorf("archive '%s' is overwritten by concurrent update", arch.Filename())
+	}
+	return nil
 }
 
 // UploadGap uploads mark indicating archiving gap.
@@ -244,25 +681,48 @@ func (su *StorageUploader) UploadGapArchive(archErr error, firstTS, lastTS model
 	if archErr == nil {
 		return fmt.Errorf("archErr must not be nil")
 	}
+	if err := su.Flush(); err != nil {
+		return err
+	}
 
 	arch, err := models.NewArchive(firstTS, lastTS, su.Compression().FileExtension(), models.ArchiveTypeGap)
 	if err != nil {
 		return fmt.Errorf("can not build archive: %w", err)
 	}
 
-	if err := su.PushStreamToDestination(strings.NewReader(archErr.Error()), arch.Filename()); err != nil {
+	gapReader := internal.CompressAndEncrypt(strings.NewReader(archErr.Error()), su.Compression(), su.crypter)
+	if err := su.Upload(arch.Filename(), gapReader); err != nil {
 		return fmt.Errorf("error while uploading stream: %w", err)
 	}
-	return nil
+	return su.updateIndex(arch, "")
 }
 
 // UploadBackup compresses a stream and uploads it.
 func (su *StorageUploader) UploadBackup(stream io.Reader, cmd ErrWaiter, metaProvider MongoMetaProvider) error {
+	return su.uploadBackup(stream, cmd, metaProvider, "")
+}
+
+// UploadDeltaBackup compresses a stream of files changed since base backup and uploads it.
+func (su *StorageUploader) UploadDeltaBackup(stream io.Reader, cmd ErrWaiter, base Backup, metaProvider MongoMetaProvider) error {
+	return su.uploadBackup(stream, cmd, metaProvider, base.BackupName)
+}
+
+func (su *StorageUploader) uploadBackup(stream io.Reader, cmd ErrWaiter, metaProvider MongoMetaProvider, incrementFrom string) error {
 	timeStart := utility.TimeNowCrossPlatformLocal()
-	backupName, err := su.PushStream(stream)
+	backupName, err := internal.GetStreamBackupName(metaProvider.Meta().Before.LastMajTS.String())
 	if err != nil {
 		return err
 	}
+	if err := internal.CheckBackupIsNew(su.Folder(), backupName); err != nil {
+		return err
+	}
+	var dataSize, compressedSize int64
+	digest := newDigestWriter(ioutil.Discard)
+	compressed := internal.CompressAndEncrypt(internal.NewWithSizeReader(io.TeeReader(stream, digest), &dataSize),
+		su.Compression(), internal.ConfigureCrypterForContentType(internal.BackupContentType))
+	if err := su.PushCompressedStreamAs(internal.NewWithSizeReader(compressed, &compressedSize), backupName); err != nil {
+		return err
+	}
 
 	if err := metaProvider.Finalize(); err != nil {
 		return err
@@ -277,6 +737,10 @@ func (su *StorageUploader) UploadBackup(stream io.Reader, cmd ErrWaiter, metaPro
 		FinishLocalTime: utility.TimeNowCrossPlatformLocal(),
 		UserData:        internal.GetSentinelUserData(),
 		MongoMeta:       metaProvider.Meta(),
+		IncrementFrom:   incrementFrom,
+		DataSize:        dataSize,
+		CompressedSize:  compressedSize,
+		DataDigest:      digest.Digest(),
 	}
 	return internal.UploadSentinel(su.UploaderProvider, backupSentinel, backupName)
 }
@@ -301,13 +765,12 @@ func NewStoragePurger(opts StorageSettings) (*StoragePurger, error) {
 func (sp *StoragePurger) DeleteBackups(backups []Backup) error {
 	keys := make([]string, 0, len(backups)*2)
 	for _, backup := range backups {
-		b := internal.NewBackup(sp.backupsFolder, backup.BackupName)
-		dataKeys, err := b.GetTarNames()
+		dataKeys, sentinelKey, err := sp.backupKeys(backup)
 		if err != nil {
 			return err
 		}
 		keys = append(keys, dataKeys...)
-		keys = append(keys, b.GetStopSentinelPath())
+		keys = append(keys, sentinelKey)
 	}
 
 	if err := sp.backupsFolder.DeleteObjects(keys); err != nil {
@@ -316,11 +779,61 @@ func (sp *StoragePurger) DeleteBackups(backups []Backup) error {
 	return nil
 }
 
+// PlanBackupPurge lists backup files which are deleted by DeleteBackups
+func (sp *StoragePurger) PlanBackupPurge(backup Backup, reason string) (BackupPurgePlan, error) {
+	dataKeys, sentinelKey, err := sp.backupKeys(backup)
+	if err != nil {
+		return BackupPurgePlan{}, err
+	}
+	return BackupPurgePlan{Name: backup.BackupName, Reason: reason, TarMembers: dataKeys, Sentinel: sentinelKey}, nil
+}
+
+// backupKeys lists all objects in the backup folder: the stream or its parts, there are no tar partitions in stream backups
+func (sp *StoragePurger) backupKeys(backup Backup) (dataKeys []string, sentinelKey string, err error) {
+	objects, err := storage.ListFolderRecursively(sp.backupsFolder.GetSubFolder(backup.BackupName))
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to list backup '%s' for deletion: %w", backup.BackupName, err)
+	}
+	dataKeys = make([]string, 0, len(objects))
+	for _, object := range objects {
+		dataKeys = append(dataKeys, path.Join(backup.BackupName, object.GetName()))
+	}
+	sort.Strings(dataKeys)
+	return dataKeys, internal.NewBackup(sp.backupsFolder, backup.BackupName).GetStopSentinelPath(), nil
+}
+
 // DeleteOplogArchives purges given oplogs files
 func (sp *StoragePurger) DeleteOplogArchives(archives []models.Archive) error {
 	oplogKeys := make([]string, 0, len(archives))
 	for _, arch := range archives {
 		oplogKeys = append(oplogKeys, arch.Filename())
 	}
-	return sp.oplogsFolder.DeleteObjects(oplogKeys)
+	if err := sp.oplogsFolder.DeleteObjects(oplogKeys); err != nil {
+		return err
+	}
+	return sp.rebuildOplogIndex()
+}
+
+// rebuildOplogIndex lists remaining archives and replaces oplog index, digests of remaining archives are kept
+func (sp *StoragePurger) rebuildOplogIndex() error {
+	prevIndex, _, err := readOplogIndex(sp.oplogsFolder)
+	if err != nil {
+		tracelog.WarningLogger.Printf("Digests of oplog archives are dropped from oplog index: %v", err)
+	}
+	index := NewOplogIndex(nil)
+	err = forEachOplogArchive(sp.oplogsFolder, func(arch models.Archive) error {
+		index.Add(arch)
+		if digest := prevIndex.Digest(arch); digest != "" {
+			index.AddDigest(arch, digest)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	data, err := marshalOplogIndex(index)
+	if err != nil {
+		return err
+	}
+	return sp.oplogsFolder.PutObject(OplogIndexName, bytes.NewReader(data))
 }
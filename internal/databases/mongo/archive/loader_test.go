@@ -0,0 +1,213 @@
+package archive
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/storages/memory"
+	s3storage "github.com/wal-g/storages/s3"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// pagedS3API lists objects of folder by pages of given size
+type pagedS3API struct {
+	s3iface.S3API
+	folder   storage.Folder
+	pageSize int
+	pages    int
+}
+
+func (api *pagedS3API) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	objects, _, err := api.folder.ListFolder()
+	if err != nil {
+		return err
+	}
+	for len(objects) > 0 {
+		n := api.pageSize
+		if n > len(objects) {
+			n = len(objects)
+		}
+		page := &s3.ListObjectsV2Output{}
+		for _, object := range objects[:n] {
+			page.Contents = append(page.Contents, &s3.Object{
+				Key:          aws.String(*input.Prefix + object.GetName()),
+				LastModified: aws.Time(object.GetLastModified()),
+			})
+		}
+		api.pages++
+		objects = objects[n:]
+		if !fn(page, len(objects) == 0) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// GetObject reports that objects do not exist, so oplog index is not found
+func (api *pagedS3API) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	return nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)
+}
+
+func TestStorageDownloader_ListOplogArchivesBetween(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	var archives []models.Archive
+	for i := uint32(1); i <= 10; i++ {
+		arch, err := models.NewArchive(models.Timestamp{TS: i * 10, Inc: 1}, models.Timestamp{TS: i*10 + 10, Inc: 1},
+			"lz4", models.ArchiveTypeOplog)
+		assert.NoError(t, err)
+		assert.NoError(t, folder.PutObject(arch.Filename(), strings.NewReader("")))
+		archives = append(archives, arch)
+	}
+	paged := &pagedS3API{folder: folder, pageSize: 3}
+	downloader := &StorageDownloader{oplogsFolder: s3storage.NewFolder(s3storage.Uploader{}, paged, "bucket", "oplog_005"), backupsFolder: folder}
+
+	all, err := downloader.ListOplogArchives()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, archives, all)
+	assert.Equal(t, 4, paged.pages)
+
+	between, err := downloader.ListOplogArchivesBetween(models.Timestamp{TS: 35, Inc: 1}, models.Timestamp{TS: 50, Inc: 1})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, archives[2:5], between)
+
+	lastTS, err := downloader.LastKnownArchiveTS()
+	assert.NoError(t, err)
+	assert.Equal(t, models.Timestamp{TS: 110, Inc: 1}, lastTS)
+}
+
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (b *bufferCloser) Close() error {
+	return nil
+}
+
+func TestStorageDownloader_DownloadOplogArchiveDigest(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	uploader := NewStorageUploader(internal.NewUploader(compression.Compressors[lz4.AlgorithmName], folder),
+		MaintainOplogIndex(folder))
+	downloader := &StorageDownloader{oplogsFolder: folder, backupsFolder: folder}
+	firstTS, lastTS := models.Timestamp{TS: 10, Inc: 1}, models.Timestamp{TS: 20, Inc: 1}
+	uploader.bufLimit = 8 // archive is spilled to temporary file
+	require.NoError(t, uploader.UploadOplogArchive(strings.NewReader("oplog records"), firstTS, lastTS))
+
+	objects, _, err := folder.ListFolder()
+	require.NoError(t, err)
+	assert.Len(t, objects, 2) // archive and oplog index, digest is stored in index
+	archives, err := downloader.ListOplogArchives()
+	require.NoError(t, err)
+	require.Len(t, archives, 1)
+	index, err := downloader.OplogIndex()
+	require.NoError(t, err)
+	assert.NotEmpty(t, index.Digest(archives[0]))
+
+	out := &bufferCloser{}
+	assert.NoError(t, downloader.DownloadOplogArchive(archives[0], out))
+	assert.Equal(t, "oplog records", out.String())
+
+	require.NoError(t, folder.PutObject(archives[0].Filename(), strings.NewReader("corrupted")))
+	out = &bufferCloser{}
+	err = downloader.DownloadOplogArchive(archives[0], out)
+	assert.IsType(t, DigestMismatchError{}, err)
+	assert.Empty(t, out.String())
+}
+
+func TestStorageDownloader_DownloadBackupStreamDigest(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	compressor := compression.Compressors[lz4.AlgorithmName]
+	uploader := internal.NewUploader(compressor, folder.GetSubFolder(utility.BaseBackupPath))
+	downloader := &StorageDownloader{oplogsFolder: folder, backupsFolder: folder.GetSubFolder(utility.BaseBackupPath)}
+	data := []byte("mongodump archive")
+	require.NoError(t, uploader.Upload("stream_1/stream."+compressor.FileExtension(),
+		internal.CompressAndEncrypt(bytes.NewReader(data), compressor, nil)))
+
+	require.NoError(t, internal.UploadSentinel(uploader, &Backup{DataDigest: computeDigest(data)}, "stream_1"))
+	out := &bufferCloser{}
+	assert.NoError(t, downloader.DownloadBackupStream("stream_1", out))
+	assert.Equal(t, data, out.Bytes())
+
+	require.NoError(t, internal.UploadSentinel(uploader, &Backup{DataDigest: computeDigest([]byte("other"))}, "stream_1"))
+	err := downloader.DownloadBackupStream("stream_1", &bufferCloser{})
+	assert.IsType(t, DigestMismatchError{}, err)
+}
+
+type staticMetaProvider struct {
+	meta MongoMeta
+}
+
+func (p *staticMetaProvider) Init() error     { return nil }
+func (p *staticMetaProvider) Finalize() error { return nil }
+func (p *staticMetaProvider) Meta() MongoMeta { return p.meta }
+
+type nopErrWaiter struct{}
+
+func (nopErrWaiter) Wait() error { return nil }
+
+func TestStorageUploader_UploadBackupCompressedSize(t *testing.T) {
+	viper.Set(internal.StreamPartSizeSetting, "0")
+	defer viper.Set(internal.StreamPartSizeSetting, nil)
+	folder := memory.NewFolder("", memory.NewStorage())
+	uploader := NewStorageUploader(internal.NewUploader(compression.Compressors[lz4.AlgorithmName], folder))
+	data := strings.Repeat("mongodump archive", 100)
+	require.NoError(t, uploader.UploadBackup(strings.NewReader(data), nopErrWaiter{}, &staticMetaProvider{}))
+
+	downloader := &StorageDownloader{oplogsFolder: folder, backupsFolder: folder}
+	backupTimes, err := downloader.ListBackupNames()
+	require.NoError(t, err)
+	require.Len(t, backupTimes, 1)
+	backup, err := downloader.BackupMeta(backupTimes[0].BackupName)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), backup.DataSize)
+	assert.NotZero(t, backup.CompressedSize)
+	assert.Less(t, backup.CompressedSize, backup.DataSize)
+}
+
+func TestDiscardUploader_EncryptsWithoutCompression(t *testing.T) {
+	viper.Set(internal.PgpKeyPathSetting, "../../../../test/testdata/waleGpgKey")
+	defer viper.Set(internal.PgpKeyPathSetting, nil)
+	discarded := &bytes.Buffer{}
+	uploader := NewDiscardUploader(nil, discarded)
+
+	dataSize, compressedSize, err := uploader.discardBackupStream(strings.NewReader("backup stream"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("backup stream")), dataSize)
+	assert.Equal(t, int64(discarded.Len()), compressedSize)
+	assert.NotContains(t, discarded.String(), "backup stream")
+}
+
+func TestStoragePurger_DeleteStreamBackupParts(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	for _, name := range []string{"stream_1/stream.lz4.part_000001", "stream_1/stream.lz4.part_000002",
+		"stream_1_backup_stop_sentinel.json", "stream_2/stream.lz4", "stream_2_backup_stop_sentinel.json"} {
+		require.NoError(t, folder.PutObject(name, strings.NewReader("data")))
+	}
+	purger := &StoragePurger{oplogsFolder: folder.GetSubFolder("oplog_005"), backupsFolder: folder}
+
+	plan, err := purger.PlanBackupPurge(Backup{BackupName: "stream_1"}, "retention")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"stream_1/stream.lz4.part_000001", "stream_1/stream.lz4.part_000002"}, plan.TarMembers)
+	assert.Equal(t, "stream_1_backup_stop_sentinel.json", plan.Sentinel)
+
+	assert.NoError(t, purger.DeleteBackups([]Backup{{BackupName: "stream_1"}}))
+	objects, err := storage.ListFolderRecursively(folder)
+	assert.NoError(t, err)
+	var names []string
+	for _, object := range objects {
+		names = append(names, object.GetName())
+	}
+	assert.ElementsMatch(t, []string{"stream_2/stream.lz4", "stream_2_backup_stop_sentinel.json"}, names)
+}
@@ -46,6 +46,20 @@ func (_m *Downloader) BackupMeta(name string) (archive.Backup, error) {
 	return r0, r1
 }
 
+// DownloadBackupStream provides a mock function with given fields: name, writeCloser
+func (_m *Downloader) DownloadBackupStream(name string, writeCloser io.WriteCloser) error {
+	ret := _m.Called(name, writeCloser)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, io.WriteCloser) error); ok {
+		r0 = rf(name, writeCloser)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // DownloadOplogArchive provides a mock function with given fields: arch, writeCloser
 func (_m *Downloader) DownloadOplogArchive(arch models.Archive, writeCloser io.WriteCloser) error {
 	ret := _m.Called(arch, writeCloser)
@@ -88,6 +102,20 @@ func (_m *Downloader) LastKnownArchiveTS() (models.Timestamp, error) {
 	return r0, r1
 }
 
+// DownloadOplogArchiveSince provides a mock function with given fields: arch, since, writeCloser
+func (_m *Downloader) DownloadOplogArchiveSince(arch models.Archive, since models.Timestamp, writeCloser io.WriteCloser) error {
+	ret := _m.Called(arch, since, writeCloser)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(models.Archive, models.Timestamp, io.WriteCloser) error); ok {
+		r0 = rf(arch, since, writeCloser)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // ListBackupNames provides a mock function with given fields:
 func (_m *Downloader) ListBackupNames() ([]internal.BackupTime, error) {
 	ret := _m.Called()
@@ -148,6 +176,50 @@ func (_m *Downloader) ListOplogArchives() ([]models.Archive, error) {
 	return r0, r1
 }
 
+// ListOplogArchivesBetween provides a mock function with given fields: since, until
+func (_m *Downloader) ListOplogArchivesBetween(since models.Timestamp, until models.Timestamp) ([]models.Archive, error) {
+	ret := _m.Called(since, until)
+
+	var r0 []models.Archive
+	if rf, ok := ret.Get(0).(func(models.Timestamp, models.Timestamp) []models.Archive); ok {
+		r0 = rf(since, until)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Archive)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(models.Timestamp, models.Timestamp) error); ok {
+		r1 = rf(since, until)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListedOplogIndex provides a mock function with given fields:
+func (_m *Downloader) ListedOplogIndex() (archive.OplogIndex, error) {
+	ret := _m.Called()
+
+	var r0 archive.OplogIndex
+	if rf, ok := ret.Get(0).(func() archive.OplogIndex); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(archive.OplogIndex)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // LoadBackups provides a mock function with given fields: names
 func (_m *Downloader) LoadBackups(names []string) ([]archive.Backup, error) {
 	ret := _m.Called(names)
@@ -177,3 +249,24 @@ func (_m *Downloader) LoadBackups(names []string) ([]archive.Backup, error) {
 
 	return r0, r1
 }
+
+// OplogIndex provides a mock function with given fields:
+func (_m *Downloader) OplogIndex() (archive.OplogIndex, error) {
+	ret := _m.Called()
+
+	var r0 archive.OplogIndex
+	if rf, ok := ret.Get(0).(func() archive.OplogIndex); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(archive.OplogIndex)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
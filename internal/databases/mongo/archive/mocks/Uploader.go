@@ -31,6 +31,34 @@ func (_m *Uploader) UploadBackup(stream io.Reader, cmd archive.ErrWaiter, metaPr
 	return r0
 }
 
+// UploadCompressedOplogArchive provides a mock function with given fields: stream, firstTS, lastTS
+func (_m *Uploader) UploadCompressedOplogArchive(stream io.Reader, firstTS models.Timestamp, lastTS models.Timestamp) error {
+	ret := _m.Called(stream, firstTS, lastTS)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(io.Reader, models.Timestamp, models.Timestamp) error); ok {
+		r0 = rf(stream, firstTS, lastTS)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UploadDeltaBackup provides a mock function with given fields: stream, cmd, base, metaProvider
+func (_m *Uploader) UploadDeltaBackup(stream io.Reader, cmd archive.ErrWaiter, base archive.Backup, metaProvider archive.MongoMetaProvider) error {
+	ret := _m.Called(stream, cmd, base, metaProvider)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(io.Reader, archive.ErrWaiter, archive.Backup, archive.MongoMetaProvider) error); ok {
+		r0 = rf(stream, cmd, base, metaProvider)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // UploadGapArchive provides a mock function with given fields: err, firstTS, lastTS
 func (_m *Uploader) UploadGapArchive(err error, firstTS models.Timestamp, lastTS models.Timestamp) error {
 	ret := _m.Called(err, firstTS, lastTS)
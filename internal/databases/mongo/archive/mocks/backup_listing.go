@@ -30,6 +30,20 @@ func (_m *BackupListing) Backups(backups []archive.Backup, output io.Writer) err
 	return r0
 }
 
+// Details provides a mock function with given fields: details, output
+func (_m *BackupListing) Details(details []archive.BackupDetail, output io.Writer) error {
+	ret := _m.Called(details, output)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func([]archive.BackupDetail, io.Writer) error); ok {
+		r0 = rf(details, output)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Names provides a mock function with given fields: backups, output
 func (_m *BackupListing) Names(backups []internal.BackupTime, output io.Writer) error {
 	ret := _m.Called(backups, output)
@@ -41,3 +41,24 @@ func (_m *Purger) DeleteOplogArchives(archives []models.Archive) error {
 
 	return r0
 }
+
+// PlanBackupPurge provides a mock function with given fields: backup, reason
+func (_m *Purger) PlanBackupPurge(backup archive.Backup, reason string) (archive.BackupPurgePlan, error) {
+	ret := _m.Called(backup, reason)
+
+	var r0 archive.BackupPurgePlan
+	if rf, ok := ret.Get(0).(func(archive.Backup, string) archive.BackupPurgePlan); ok {
+		r0 = rf(backup, reason)
+	} else {
+		r0 = ret.Get(0).(archive.BackupPurgePlan)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(archive.Backup, string) error); ok {
+		r1 = rf(backup, reason)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
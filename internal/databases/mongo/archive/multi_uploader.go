@@ -0,0 +1,340 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"github.com/wal-g/tracelog"
+)
+
+const (
+	multiUploaderChunkSize = 32 << 10
+	// multiUploaderBufferChunks is the number of chunks buffered for each destination, so slow mirror doesn't stall others
+	multiUploaderBufferChunks = 256
+	// multiUploaderMirrorTimeout is how long mirror may lag behind when its buffer is full or the stream is finished
+	multiUploaderMirrorTimeout = time.Minute
+)
+
+// UploadDestination is an uploader of one storage
+type UploadDestination struct {
+	Name     string
+	Uploader Uploader
+}
+
+// MultiUploader uploads backups and oplog archives to the primary storage and its mirrors.
+// Stream is read once and passed to all destinations concurrently, each destination has its own buffer.
+// Only primary storage failures are returned, mirror failures and timeouts are logged and counted per destination.
+// Gap is marked in the mirror which failed to upload oplog archive, so point-in-time recovery from it is refused.
+type MultiUploader struct {
+	destinations  []UploadDestination
+	failuresMu    sync.Mutex
+	failures      map[string]int
+	mirrorTimeout time.Duration
+}
+
+// NewMultiUploader builds MultiUploader, upload to primary destination is required.
+func NewMultiUploader(primary UploadDestination, mirrors ...UploadDestination) *MultiUploader {
+	return &MultiUploader{
+		destinations:  append([]UploadDestination{primary}, mirrors...),
+		failures:      make(map[string]int),
+		mirrorTimeout: multiUploaderMirrorTimeout,
+	}
+}
+
+// Failures returns number of failed uploads per destination, it is reported by oplog-push statistics.
+func (mu *MultiUploader) Failures() map[string]int {
+	mu.failuresMu.Lock()
+	defer mu.failuresMu.Unlock()
+	failures := make(map[string]int, len(mu.failures))
+	for name, count := range mu.failures {
+		failures[name] = count
+	}
+	return failures
+}
+
+// UploadOplogArchive uploads oplog archive to all destinations.
+func (mu *MultiUploader) UploadOplogArchive(stream io.Reader, firstTS, lastTS models.Timestamp) error {
+	errs, err := mu.fanOut(stream, func(upl Uploader, r io.Reader) error {
+		return upl.UploadOplogArchive(r, firstTS, lastTS)
+	})
+	if err != nil {
+		return err
+	}
+	return mu.handleOplogErrors(errs, firstTS, lastTS)
+}
+
+// UploadCompressedOplogArchive uploads compressed oplog archive to all destinations.
+func (mu *MultiUploader) UploadCompressedOplogArchive(stream io.Reader, firstTS, lastTS models.Timestamp) error {
+	errs, err := mu.fanOut(stream, func(upl Uploader, r io.Reader) error {
+		return upl.UploadCompressedOplogArchive(r, firstTS, lastTS)
+	})
+	if err != nil {
+		return err
+	}
+	return mu.handleOplogErrors(errs, firstTS, lastTS)
+}
+
+// handleOplogErrors marks gap of the archive in mirrors which failed to upload it
+func (mu *MultiUploader) handleOplogErrors(errs []error, firstTS, lastTS models.Timestamp) error {
+	for i, err := range errs[1:] {
+		if err == nil {
+			continue
+		}
+		dest := mu.destinations[i+1]
+		gapErr := fmt.Errorf("upload to mirror storage '%s' failed: %w", dest.Name, err)
+		if err := dest.Uploader.UploadGapArchive(gapErr, firstTS, lastTS); err != nil {
+			tracelog.WarningLogger.Printf("Can not mark oplog gap from '%s' to '%s' in mirror storage '%s': %v",
+				firstTS, lastTS, dest.Name, err)
+		}
+	}
+	return mu.handleErrors(errs)
+}
+
+// UploadGapArchive uploads gap mark to all destinations.
+func (mu *MultiUploader) UploadGapArchive(err error, firstTS, lastTS models.Timestamp) error {
+	errs := make([]error, len(mu.destinations))
+	for i, dest := range mu.destinations {
+		errs[i] = dest.Uploader.UploadGapArchive(err, firstTS, lastTS)
+	}
+	return mu.handleErrors(errs)
+}
+
+// Flush uploads oplog archives held by destinations.
+func (mu *MultiUploader) Flush() error {
+	errs := make([]error, len(mu.destinations))
+	for i, dest := range mu.destinations {
+		errs[i] = FlushUploader(dest.Uploader)
+	}
+	return mu.handleErrors(errs)
+}
+
+// UploadBackup uploads backup stream to all destinations, backup command and meta are finalized once.
+func (mu *MultiUploader) UploadBackup(stream io.Reader, cmd ErrWaiter, metaProvider MongoMetaProvider) error {
+	cmd = &onceWaiter{ErrWaiter: cmd}
+	metaProvider = &onceMetaProvider{MongoMetaProvider: metaProvider}
+	errs, err := mu.fanOut(stream, func(upl Uploader, r io.Reader) error {
+		return upl.UploadBackup(r, cmd, metaProvider)
+	})
+	if err != nil {
+		return err
+	}
+	return mu.handleErrors(errs)
+}
+
+// UploadDeltaBackup uploads delta backup stream to all destinations, backup command and meta are finalized once.
+func (mu *MultiUploader) UploadDeltaBackup(stream io.Reader, cmd ErrWaiter, base Backup, metaProvider MongoMetaProvider) error {
+	cmd = &onceWaiter{ErrWaiter: cmd}
+	metaProvider = &onceMetaProvider{MongoMetaProvider: metaProvider}
+	errs, err := mu.fanOut(stream, func(upl Uploader, r io.Reader) error {
+		return upl.UploadDeltaBackup(r, cmd, base, metaProvider)
+	})
+	if err != nil {
+		return err
+	}
+	return mu.handleErrors(errs)
+}
+
+// fanOut copies stream to all destinations and returns their upload errors. Primary destination is waited for,
+// mirrors are dropped if they lag behind the stream for longer than mirrorTimeout or don't finish upload
+// in mirrorTimeout after the stream end.
+func (mu *MultiUploader) fanOut(stream io.Reader, upload func(upl Uploader, r io.Reader) error) ([]error, error) {
+	destinations := make([]*destinationStream, len(mu.destinations))
+	for i, dest := range mu.destinations {
+		destinations[i] = newDestinationStream(dest.Uploader, upload)
+	}
+
+	readErr := copyToDestinations(stream, destinations, mu.mirrorTimeout)
+	for _, dest := range destinations {
+		dest.finish(readErr)
+	}
+
+	errs := make([]error, len(destinations))
+	errs[0] = <-destinations[0].result
+	timeout := time.After(mu.mirrorTimeout)
+	for i, dest := range destinations[1:] {
+		select {
+		case errs[i+1] = <-dest.result:
+		case <-timeout:
+			errs[i+1] = fmt.Errorf("upload is not finished in %v after the stream end", mu.mirrorTimeout)
+		}
+	}
+
+	if readErr != nil {
+		return nil, fmt.Errorf("can not read upload stream: %w", readErr)
+	}
+	return errs, nil
+}
+
+// destinationStream passes buffered chunks of the stream to the upload of one destination
+type destinationStream struct {
+	chunks   chan []byte
+	closeErr error
+	finished bool
+	// writeFailed is closed when upload stops reading the stream
+	writeFailed chan struct{}
+	result      chan error
+}
+
+func newDestinationStream(upl Uploader, upload func(upl Uploader, r io.Reader) error) *destinationStream {
+	dest := &destinationStream{
+		chunks:      make(chan []byte, multiUploaderBufferChunks),
+		writeFailed: make(chan struct{}),
+		result:      make(chan error, 1),
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		err := upload(upl, pr)
+		// unblock writer if upload is finished before the stream end
+		_ = pr.CloseWithError(err)
+		dest.result <- err
+	}()
+	go func() {
+		failed := false
+		for chunk := range dest.chunks {
+			if failed {
+				continue
+			}
+			if _, err := pw.Write(chunk); err != nil {
+				failed = true
+				close(dest.writeFailed)
+			}
+		}
+		_ = pw.CloseWithError(dest.closeErr)
+	}()
+	return dest
+}
+
+func (dest *destinationStream) alive() bool {
+	if dest.finished {
+		return false
+	}
+	select {
+	case <-dest.writeFailed:
+		return false
+	default:
+		return true
+	}
+}
+
+// send passes chunk to destination, waits for the buffer space no longer than timeout if it is positive
+func (dest *destinationStream) send(chunk []byte, timeout time.Duration) bool {
+	select {
+	case dest.chunks <- chunk:
+		return true
+	default:
+	}
+	if timeout <= 0 {
+		dest.chunks <- chunk
+		return true
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case dest.chunks <- chunk:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// finish closes the stream of destination with error, upload is finished successfully if err is nil
+func (dest *destinationStream) finish(err error) {
+	if dest.finished {
+		return
+	}
+	dest.finished = true
+	dest.closeErr = err
+	close(dest.chunks)
+}
+
+// copyToDestinations reads stream and passes its chunks to all destinations until all of them stop reading.
+// Mirror which doesn't accept a chunk in mirrorTimeout is dropped.
+func copyToDestinations(stream io.Reader, destinations []*destinationStream, mirrorTimeout time.Duration) error {
+	for {
+		chunk := make([]byte, multiUploaderChunkSize)
+		n, err := stream.Read(chunk)
+		if n > 0 {
+			alive := 0
+			for i, dest := range destinations {
+				if !dest.alive() {
+					continue
+				}
+				timeout := mirrorTimeout
+				if i == 0 {
+					timeout = 0
+				}
+				if !dest.send(chunk[:n], timeout) {
+					dest.finish(fmt.Errorf("mirror doesn't keep up with the stream for %v", mirrorTimeout))
+					continue
+				}
+				alive++
+			}
+			if alive == 0 {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (mu *MultiUploader) handleErrors(errs []error) error {
+	mu.failuresMu.Lock()
+	defer mu.failuresMu.Unlock()
+	for i, err := range errs[1:] {
+		if err == nil {
+			continue
+		}
+		name := mu.destinations[i+1].Name
+		mu.failures[name]++
+		tracelog.WarningLogger.Printf("Upload to mirror storage '%s' failed (%d failures): %v", name, mu.failures[name], err)
+	}
+	if errs[0] != nil {
+		mu.failures[mu.destinations[0].Name]++
+		return fmt.Errorf("upload to storage '%s' failed: %w", mu.destinations[0].Name, errs[0])
+	}
+	return nil
+}
+
+// onceWaiter waits for the command once and returns the same result to all callers
+type onceWaiter struct {
+	ErrWaiter
+	once sync.Once
+	err  error
+}
+
+func (w *onceWaiter) Wait() error {
+	w.once.Do(func() { w.err = w.ErrWaiter.Wait() })
+	return w.err
+}
+
+// onceMetaProvider finalizes backup meta once, so all destinations store the same sentinel
+type onceMetaProvider struct {
+	MongoMetaProvider
+	mu   sync.Mutex
+	once sync.Once
+	err  error
+}
+
+func (p *onceMetaProvider) Finalize() error {
+	p.once.Do(func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.err = p.MongoMetaProvider.Finalize()
+	})
+	return p.err
+}
+
+func (p *onceMetaProvider) Meta() MongoMeta {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.MongoMetaProvider.Meta()
+}
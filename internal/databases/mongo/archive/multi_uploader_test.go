@@ -0,0 +1,108 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingUploader struct {
+	Uploader
+	data []byte
+	gaps []models.Archive
+	err  error
+}
+
+func (u *recordingUploader) UploadGapArchive(archErr error, firstTS, lastTS models.Timestamp) error {
+	u.gaps = append(u.gaps, models.Archive{Start: firstTS, End: lastTS, Type: models.ArchiveTypeGap})
+	return nil
+}
+
+func (u *recordingUploader) UploadOplogArchive(stream io.Reader, firstTS, lastTS models.Timestamp) error {
+	if u.err != nil {
+		return u.err
+	}
+	data, err := ioutil.ReadAll(stream)
+	u.data = data
+	return err
+}
+
+func TestMultiUploader_UploadOplogArchive(t *testing.T) {
+	payload := bytes.Repeat([]byte("oplog"), multiUploaderChunkSize)
+	primary := &recordingUploader{}
+	mirror := &recordingUploader{}
+	failed := &recordingUploader{err: errors.New("bucket is unavailable")}
+
+	uploader := NewMultiUploader(UploadDestination{Name: "primary", Uploader: primary},
+		UploadDestination{Name: "dr", Uploader: mirror}, UploadDestination{Name: "broken", Uploader: failed})
+	err := uploader.UploadOplogArchive(bytes.NewReader(payload), models.Timestamp{TS: 1}, models.Timestamp{TS: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, payload, primary.data)
+	assert.Equal(t, payload, mirror.data)
+	assert.Equal(t, map[string]int{"broken": 1}, uploader.Failures())
+	assert.Empty(t, primary.gaps)
+	assert.Empty(t, mirror.gaps)
+	assert.Equal(t, []models.Archive{{Start: models.Timestamp{TS: 1}, End: models.Timestamp{TS: 2}, Type: models.ArchiveTypeGap}},
+		failed.gaps)
+}
+
+func TestMultiUploader_PrimaryFailure(t *testing.T) {
+	mirror := &recordingUploader{}
+	uploader := NewMultiUploader(UploadDestination{Name: "primary", Uploader: &recordingUploader{err: errors.New("denied")}},
+		UploadDestination{Name: "dr", Uploader: mirror})
+	err := uploader.UploadOplogArchive(strings.NewReader("oplog"), models.Timestamp{TS: 1}, models.Timestamp{TS: 2})
+	assert.Error(t, err)
+	assert.Equal(t, []byte("oplog"), mirror.data)
+	assert.Equal(t, map[string]int{"primary": 1}, uploader.Failures())
+	assert.Empty(t, mirror.gaps)
+}
+
+// stuckUploader doesn't read the stream until released
+type stuckUploader struct {
+	recordingUploader
+	release chan struct{}
+}
+
+func (u *stuckUploader) UploadOplogArchive(stream io.Reader, firstTS, lastTS models.Timestamp) error {
+	<-u.release
+	_, err := ioutil.ReadAll(stream)
+	return err
+}
+
+func TestMultiUploader_SlowMirrorDoesNotStallPrimary(t *testing.T) {
+	payload := bytes.Repeat([]byte("o"), 2*multiUploaderBufferChunks*multiUploaderChunkSize)
+	primary := &recordingUploader{}
+	slow := &stuckUploader{release: make(chan struct{})}
+	defer close(slow.release)
+
+	uploader := NewMultiUploader(UploadDestination{Name: "primary", Uploader: primary},
+		UploadDestination{Name: "slow", Uploader: slow})
+	uploader.mirrorTimeout = 10 * time.Millisecond
+	err := uploader.UploadOplogArchive(bytes.NewReader(payload), models.Timestamp{TS: 1}, models.Timestamp{TS: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, payload, primary.data)
+	assert.Equal(t, map[string]int{"slow": 1}, uploader.Failures())
+}
+
+func TestMultiUploader_MirrorTimeoutAfterStreamEnd(t *testing.T) {
+	primary := &recordingUploader{}
+	slow := &stuckUploader{release: make(chan struct{})}
+	defer close(slow.release)
+
+	uploader := NewMultiUploader(UploadDestination{Name: "primary", Uploader: primary},
+		UploadDestination{Name: "slow", Uploader: slow})
+	uploader.mirrorTimeout = 10 * time.Millisecond
+	err := uploader.UploadOplogArchive(strings.NewReader("oplog"), models.Timestamp{TS: 1}, models.Timestamp{TS: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("oplog"), primary.data)
+	assert.Equal(t, map[string]int{"slow": 1}, uploader.Failures())
+	assert.Len(t, slow.gaps, 1)
+}
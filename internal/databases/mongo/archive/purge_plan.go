@@ -0,0 +1,41 @@
+package archive
+
+import (
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+)
+
+// PurgePlan lists storage objects deleted by purge
+type PurgePlan struct {
+	DryRun        bool                    `json:"dry_run"`
+	Backups       []BackupPurgePlan       `json:"backups"`
+	OplogArchives []OplogArchivePurgePlan `json:"oplog_archives"`
+}
+
+// BackupPurgePlan lists files of purged backup
+type BackupPurgePlan struct {
+	Name       string   `json:"name"`
+	Reason     string   `json:"reason"`
+	TarMembers []string `json:"tar_members"`
+	Sentinel   string   `json:"sentinel"`
+}
+
+// OplogArchivePurgePlan describes purged oplog archive
+type OplogArchivePurgePlan struct {
+	Name    string           `json:"name"`
+	StartTS models.Timestamp `json:"start_ts"`
+	EndTS   models.Timestamp `json:"end_ts"`
+	Reason  string           `json:"reason"`
+}
+
+// NewPurgePlan builds empty PurgePlan
+func NewPurgePlan(dryRun bool) *PurgePlan {
+	return &PurgePlan{DryRun: dryRun, Backups: []BackupPurgePlan{}, OplogArchives: []OplogArchivePurgePlan{}}
+}
+
+// AddOplogArchives appends oplog archives purged for the same reason
+func (p *PurgePlan) AddOplogArchives(archives []models.Archive, reason string) {
+	for _, arch := range archives {
+		p.OplogArchives = append(p.OplogArchives,
+			OplogArchivePurgePlan{Name: arch.Filename(), StartTS: arch.Start, EndTS: arch.End, Reason: reason})
+	}
+}
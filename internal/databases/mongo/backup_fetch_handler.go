@@ -2,12 +2,122 @@ package mongo
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"strings"
 
-	"github.com/wal-g/storages/storage"
 	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+	"github.com/wal-g/wal-g/internal/limited"
+
+	"golang.org/x/time/rate"
 )
 
-func HandleBackupFetch(ctx context.Context, folder storage.Folder, backupName string, restoreCmd *exec.Cmd) {
-	internal.HandleBackupFetch(folder, backupName, internal.GetCommandStreamFetcher(restoreCmd))
+// BackupFetchOption configures passing of backup stream to restore command
+type BackupFetchOption func(*backupFetchOptions)
+
+type backupFetchOptions struct {
+	limiter *rate.Limiter
+}
+
+// RestoreRateLimit limits rate (bytes per second) of decompressed backup stream passed to restore command,
+// so restore does not saturate the target cluster. Zero means no limit.
+func RestoreRateLimit(bytesPerSecond int64) BackupFetchOption {
+	return func(opts *backupFetchOptions) {
+		if bytesPerSecond > 0 {
+			opts.limiter = rate.NewLimiter(rate.Limit(bytesPerSecond), int(bytesPerSecond+internal.DefaultDataBurstRateLimit))
+		}
+	}
+}
+
+// HandleBackupFetch passes backup stream to restore command.
+// Backup stream is verified with its digest while it is restored, restore command is killed on mismatch,
+// so it never finishes restore of corrupted backup.
+func HandleBackupFetch(ctx context.Context, downloader archive.Downloader, backupName string, restoreCmd *exec.Cmd,
+	opts ...BackupFetchOption) error {
+	fetchOpts := backupFetchOptions{}
+	for _, opt := range opts {
+		opt(&fetchOpts)
+	}
+
+	stdin, err := restoreCmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := restoreCmd.Start(); err != nil {
+		return fmt.Errorf("can not start restore command: %w", err)
+	}
+	var dst io.WriteCloser = stdin
+	if fetchOpts.limiter != nil {
+		dst = limited.NewWriteCloser(stdin, fetchOpts.limiter)
+	}
+	if err := downloader.DownloadBackupStream(backupName, dst); err != nil {
+		_ = restoreCmd.Process.Kill()
+		_ = restoreCmd.Wait()
+		return fmt.Errorf("can not fetch backup '%s': %w", backupName, err)
+	}
+	if err := restoreCmd.Wait(); err != nil {
+		return fmt.Errorf("restore command failed: %w", err)
+	}
+	return nil
+}
+
+// HandleLogicalBackupFetch passes stream of logical backup to restore command,
+// physical backups are restored with HandlePhysicalBackupFetch.
+func HandleLogicalBackupFetch(ctx context.Context, downloader archive.Downloader, backupName string, restoreCmd *exec.Cmd,
+	opts ...BackupFetchOption) error {
+	backup, err := downloader.BackupMeta(backupName)
+	if err != nil {
+		return err
+	}
+	if backup.IsPhysical() {
+		return fmt.Errorf("physical backup '%s' can not be restored with restore command", backupName)
+	}
+	return HandleBackupFetch(ctx, downloader, backupName, restoreCmd, opts...)
+}
+
+// RestoreNamespaceFilterEnv is the environment variable with mongorestore options built by NamespaceFilterArgs,
+// restore command passes them to mongorestore, e.g. 'mongorestore --archive $MONGODB_RESTORE_NS_FILTER | tee log'
+const RestoreNamespaceFilterEnv = "MONGODB_RESTORE_NS_FILTER"
+
+// NamespaceFilterArgs builds mongorestore options to restore only included and not excluded namespaces.
+// Namespace is either database name or <database>.<collection>, wildcards are allowed.
+func NamespaceFilterArgs(include, exclude []string) ([]string, error) {
+	args := make([]string, 0, len(include)+len(exclude))
+	for _, filter := range []struct {
+		option     string
+		namespaces []string
+	}{{"--nsInclude", include}, {"--nsExclude", exclude}} {
+		for _, ns := range filter.namespaces {
+			pattern, err := models.NamespacePattern(ns)
+			if err != nil {
+				return nil, err
+			}
+			// options are split by whitespace when the variable is expanded by restore command
+			if strings.ContainsAny(pattern, " \t\n") {
+				return nil, fmt.Errorf("namespace '%s' with whitespace can not be passed to restore command", ns)
+			}
+			args = append(args, fmt.Sprintf("%s=%s", filter.option, pattern))
+		}
+	}
+	return args, nil
+}
+
+// SetNamespaceFilterEnv passes namespace filter options to restore command in RestoreNamespaceFilterEnv.
+// Restore command must use the variable, otherwise the filters would be silently ignored.
+func SetNamespaceFilterEnv(restoreCmd *exec.Cmd, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	if !strings.Contains(strings.Join(restoreCmd.Args, " "), RestoreNamespaceFilterEnv) {
+		return fmt.Errorf("restore command does not use $%s, namespace filters can not be applied", RestoreNamespaceFilterEnv)
+	}
+	if restoreCmd.Env == nil {
+		restoreCmd.Env = os.Environ()
+	}
+	restoreCmd.Env = append(restoreCmd.Env, RestoreNamespaceFilterEnv+"="+strings.Join(args, " "))
+	return nil
 }
@@ -0,0 +1,79 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"testing"
+
+	archivemocks "github.com/wal-g/wal-g/internal/databases/mongo/archive/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNamespaceFilterArgs(t *testing.T) {
+	args, err := NamespaceFilterArgs([]string{"db1", "db2.coll"}, []string{"db2.tmp*"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--nsInclude=db1.*", "--nsInclude=db2.coll", "--nsExclude=db2.tmp*"}, args)
+
+	_, err = NamespaceFilterArgs([]string{".coll"}, nil)
+	assert.Error(t, err)
+}
+
+func TestNamespaceFilterArgs_Whitespace(t *testing.T) {
+	_, err := NamespaceFilterArgs([]string{"db.my coll"}, nil)
+	assert.Error(t, err)
+}
+
+func TestSetNamespaceFilterEnv(t *testing.T) {
+	cmd := exec.Command("/bin/sh", "-c", `printf '%s\n' $MONGODB_RESTORE_NS_FILTER | cat`)
+	assert.NoError(t, SetNamespaceFilterEnv(cmd, []string{"--nsInclude=db.*", "--nsExclude=db.tmp"}))
+	out, err := cmd.Output()
+	assert.NoError(t, err)
+	assert.Equal(t, "--nsInclude=db.*\n--nsExclude=db.tmp\n", string(out))
+}
+
+func TestSetNamespaceFilterEnv_NotUsedByCommand(t *testing.T) {
+	cmd := exec.Command("/bin/sh", "-c", "mongorestore --archive")
+	assert.Error(t, SetNamespaceFilterEnv(cmd, []string{"--nsInclude=db.*"}))
+	assert.NoError(t, SetNamespaceFilterEnv(cmd, nil))
+}
+
+func TestHandleBackupFetch_KillsRestoreOnDigestMismatch(t *testing.T) {
+	downloader := &archivemocks.Downloader{}
+	downloader.On("DownloadBackupStream", "stream_1", mock.Anything).
+		Run(func(args mock.Arguments) {
+			writer := args.Get(1).(io.WriteCloser)
+			_, err := writer.Write([]byte("corrupted"))
+			assert.NoError(t, err)
+		}).Return(errors.New("sha256 digest mismatch")).Once()
+
+	restoreCmd := exec.Command("/bin/sh", "-c", "cat >/dev/null && echo restored")
+	var out bytes.Buffer
+	restoreCmd.Stdout = &out
+	err := HandleBackupFetch(context.TODO(), downloader, "stream_1", restoreCmd)
+	assert.Error(t, err)
+	assert.Empty(t, out.String())
+	downloader.AssertExpectations(t)
+}
+
+func TestHandleBackupFetch(t *testing.T) {
+	downloader := &archivemocks.Downloader{}
+	downloader.On("DownloadBackupStream", "stream_1", mock.Anything).
+		Run(func(args mock.Arguments) {
+			writer := args.Get(1).(io.WriteCloser)
+			_, err := writer.Write([]byte("backup"))
+			assert.NoError(t, err)
+			assert.NoError(t, writer.Close())
+		}).Return(nil).Once()
+
+	restoreCmd := exec.Command("/bin/sh", "-c", "cat")
+	var out bytes.Buffer
+	restoreCmd.Stdout = &out
+	assert.NoError(t, HandleBackupFetch(context.TODO(), downloader, "stream_1", restoreCmd))
+	assert.Equal(t, "backup", out.String())
+	downloader.AssertExpectations(t)
+}
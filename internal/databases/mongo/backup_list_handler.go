@@ -9,7 +9,7 @@ import (
 )
 
 // HandleBackupsList prints current backups.
-func HandleBackupsList(downloader archive.Downloader, listing archive.BackupListing, output io.Writer, verbose bool) error {
+func HandleBackupsList(downloader archive.Downloader, listing archive.BackupListing, output io.Writer, verbose, detail bool) error {
 	backupTimes, err := downloader.ListBackupNames()
 	if err != nil {
 		return err
@@ -20,7 +20,7 @@ func HandleBackupsList(downloader archive.Downloader, listing archive.BackupList
 		return nil
 	}
 
-	if !verbose {
+	if !verbose && !detail {
 		return listing.Names(backupTimes, output)
 	}
 
@@ -29,5 +29,30 @@ func HandleBackupsList(downloader archive.Downloader, listing archive.BackupList
 		return err
 	}
 
-	return listing.Backups(backups, output)
+	if !detail {
+		return listing.Backups(backups, output)
+	}
+
+	index, err := downloader.OplogIndex()
+	if err != nil {
+		return err
+	}
+	listed := false
+	details := make([]archive.BackupDetail, 0, len(backups))
+	for _, backup := range backups {
+		covered := index.IsCovered(backup.ConsistentTS())
+		if !covered && !listed {
+			// stored index may miss recent archives, so archives are listed once to check it
+			if index, err = downloader.ListedOplogIndex(); err != nil {
+				return err
+			}
+			listed = true
+			covered = index.IsCovered(backup.ConsistentTS())
+		}
+		details = append(details, archive.BackupDetail{
+			Backup:       backup,
+			OplogCovered: covered,
+		})
+	}
+	return listing.Details(details, output)
 }
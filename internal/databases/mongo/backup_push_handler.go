@@ -1,19 +1,101 @@
 package mongo
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"os/exec"
 
 	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+	"github.com/wal-g/wal-g/internal/databases/mongo/client"
 	"github.com/wal-g/wal-g/utility"
 
 	"github.com/wal-g/tracelog"
 )
 
+const (
+	maxBackupFailovers  = 3
+	maxMemberSelections = 5
+)
+
+// dumpMetaProvider records consistency point of backup stream made with 'mongodump --archive --oplog'
+type dumpMetaProvider struct {
+	archive.MongoMetaProvider
+	tracker *archive.DumpOplogTracker
+}
+
+func (p *dumpMetaProvider) Finalize() error {
+	// backup stream is read completely at this point
+	if err := p.tracker.Close(); err != nil {
+		return err
+	}
+	return p.MongoMetaProvider.Finalize()
+}
+
+func (p *dumpMetaProvider) Meta() archive.MongoMeta {
+	meta := p.MongoMetaProvider.Meta()
+	lastTS, err := p.tracker.LastTS()
+	if err != nil {
+		tracelog.DebugLogger.Printf("Can not find consistency point in backup stream: %v", err)
+		return meta
+	}
+	meta.DumpConsistentTS = lastTS
+	return meta
+}
+
 // HandleBackupPush starts backup procedure.
 func HandleBackupPush(uploader archive.Uploader, metaProvider archive.MongoMetaProvider, backupCmd *exec.Cmd) error {
 	err := metaProvider.Init()
 	tracelog.ErrorLogger.FatalOnError(err)
 	stdout, err := utility.StartCommandWithStdoutPipe(backupCmd)
 	tracelog.ErrorLogger.FatalOnError(err)
-	return uploader.UploadBackup(stdout, backupCmd, metaProvider)
+	tracker := archive.NewDumpOplogTracker()
+	defer func() { _ = tracker.Close() }()
+	stream := io.TeeReader(stdout, tracker)
+	return uploader.UploadBackup(stream, backupCmd, &dumpMetaProvider{MongoMetaProvider: metaProvider, tracker: tracker})
+}
+
+// HandleMemberBackupPush runs backup command against the member selected by read preference.
+// If backup command fails, e.g. the member becomes unavailable mid-stream, backup is restarted from another member.
+func HandleMemberBackupPush(ctx context.Context, uploader archive.Uploader, metaProvider archive.MongoMetaProvider,
+	mongoClient client.MongoDriver, newBackupCmd func(host string) (*exec.Cmd, error)) error {
+	failedMembers := make(map[string]bool)
+	var backupErr error
+	for failovers := 0; ; failovers++ {
+		host, err := selectBackupMember(ctx, mongoClient, failedMembers)
+		if err != nil {
+			if backupErr != nil {
+				return fmt.Errorf("%v, backup can not be restarted: %w", backupErr, err)
+			}
+			return err
+		}
+		tracelog.InfoLogger.Printf("Backup source member is %s", host)
+		backupCmd, err := newBackupCmd(host)
+		if err != nil {
+			return err
+		}
+		backupErr = HandleBackupPush(uploader, metaProvider, backupCmd)
+		if backupErr == nil || failovers >= maxBackupFailovers || ctx.Err() != nil {
+			return backupErr
+		}
+		tracelog.WarningLogger.Printf("Backup from member %s failed, restarting from another member: %v", host, backupErr)
+		failedMembers[host] = true
+	}
+}
+
+// selectBackupMember returns address of the member selected by read preference, failed members are skipped
+func selectBackupMember(ctx context.Context, mongoClient client.MongoDriver, failedMembers map[string]bool) (string, error) {
+	var err error
+	for i := 0; i < maxMemberSelections; i++ {
+		im, imErr := mongoClient.IsMaster(ctx)
+		if imErr != nil {
+			err = imErr
+			continue
+		}
+		if !failedMembers[im.Me] {
+			return im.Me, nil
+		}
+		err = fmt.Errorf("selected member %s has already failed", im.Me)
+	}
+	return "", fmt.Errorf("can not select backup source member: %w", err)
 }
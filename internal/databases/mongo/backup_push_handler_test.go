@@ -0,0 +1,75 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"testing"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+	archivemocks "github.com/wal-g/wal-g/internal/databases/mongo/archive/mocks"
+	clientmocks "github.com/wal-g/wal-g/internal/databases/mongo/client/mocks"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHandleBackupPush_DiscardUploader(t *testing.T) {
+	metaProvider := &archivemocks.MongoMetaProvider{}
+	metaProvider.On("Init").Return(nil).Once()
+	metaProvider.On("Finalize").Return(nil).Once()
+	metaProvider.On("Meta").Return(archive.MongoMeta{})
+
+	discarded := &bytes.Buffer{}
+	uploader := archive.NewDiscardUploader(nil, discarded)
+
+	err := HandleBackupPush(uploader, metaProvider, exec.Command("echo", "backup stream"))
+	assert.NoError(t, err)
+	assert.Equal(t, "backup stream\n", discarded.String())
+	metaProvider.AssertExpectations(t)
+}
+
+func TestHandleMemberBackupPush_Failover(t *testing.T) {
+	metaProvider := &archivemocks.MongoMetaProvider{}
+	metaProvider.On("Init").Return(nil).Twice()
+	metaProvider.On("Finalize").Return(nil)
+	metaProvider.On("Meta").Return(archive.MongoMeta{})
+
+	mongoClient := &clientmocks.MongoDriver{}
+	mongoClient.On("IsMaster", mock.Anything).Return(models.IsMaster{Me: "host1:27017"}, nil).Once()
+	mongoClient.On("IsMaster", mock.Anything).Return(models.IsMaster{Me: "host1:27017"}, nil).Once()
+	mongoClient.On("IsMaster", mock.Anything).Return(models.IsMaster{Me: "host2:27017"}, nil).Once()
+
+	discarded := &bytes.Buffer{}
+	uploader := archive.NewDiscardUploader(nil, discarded)
+
+	var hosts []string
+	err := HandleMemberBackupPush(context.TODO(), uploader, metaProvider, mongoClient, func(host string) (*exec.Cmd, error) {
+		hosts = append(hosts, host)
+		if host == "host1:27017" {
+			return exec.Command("false"), nil
+		}
+		return exec.Command("echo", "backup stream"), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"host1:27017", "host2:27017"}, hosts)
+	assert.Equal(t, "backup stream\n", discarded.String())
+	mongoClient.AssertExpectations(t)
+	metaProvider.AssertExpectations(t)
+}
+
+func TestHandleMemberBackupPush_NoOtherMember(t *testing.T) {
+	metaProvider := &archivemocks.MongoMetaProvider{}
+	metaProvider.On("Init").Return(nil)
+	metaProvider.On("Finalize").Return(nil)
+	metaProvider.On("Meta").Return(archive.MongoMeta{})
+
+	mongoClient := &clientmocks.MongoDriver{}
+	mongoClient.On("IsMaster", mock.Anything).Return(models.IsMaster{Me: "host1:27017"}, nil)
+
+	err := HandleMemberBackupPush(context.TODO(), archive.NewDiscardUploader(nil, &bytes.Buffer{}), metaProvider, mongoClient,
+		func(host string) (*exec.Cmd, error) { return exec.Command("false"), nil })
+	assert.Error(t, err)
+	mongoClient.AssertNumberOfCalls(t, "IsMaster", 1+maxMemberSelections)
+}
@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// backupCursorKeepAlive is less than default cursor timeout (10 minutes)
+const backupCursorKeepAlive = time.Minute
+
+var _ = []BackupCursor{&MongoBackupCursor{}}
+
+// BackupFile is a database file which should be copied up to Size
+type BackupFile struct {
+	Path string
+	Size int64
+}
+
+// BackupCursor defines methods to work with an open WiredTiger backup cursor.
+// Checkpoint files are not modified or removed while cursor is open.
+type BackupCursor interface {
+	DBPath() string
+	Files() []BackupFile
+	OplogEnd() models.Timestamp
+	Close(ctx context.Context) error
+}
+
+// BackupCursorMeta is used to unmarshal metadata document of $backupCursor
+type BackupCursorMeta struct {
+	Metadata struct {
+		DBPath   string `bson:"dbpath"`
+		OplogEnd OpTime `bson:"oplogEnd"`
+	} `bson:"metadata"`
+}
+
+// BackupCursorFile is used to unmarshal file documents of $backupCursor
+type BackupCursorFile struct {
+	Filename string `bson:"filename"`
+	FileSize int64  `bson:"fileSize"`
+}
+
+// MongoBackupCursor implements BackupCursor with $backupCursor aggregation, cursor is kept alive until closed
+type MongoBackupCursor struct {
+	cursor   *mongo.Cursor
+	dbPath   string
+	files    []BackupFile
+	oplogEnd models.Timestamp
+	stopc    chan struct{}
+	wg       sync.WaitGroup
+}
+
+// OpenBackupCursor opens $backupCursor and reads the list of files to copy
+func (mc *MongoClient) OpenBackupCursor(ctx context.Context) (BackupCursor, error) {
+	cur, err := mc.c.Database("admin").Aggregate(ctx, mongo.Pipeline{{{Key: "$backupCursor", Value: bson.D{}}}})
+	if err != nil {
+		return nil, fmt.Errorf("$backupCursor aggregation failed: %w", err)
+	}
+
+	bc := &MongoBackupCursor{cursor: cur, stopc: make(chan struct{})}
+	if !cur.Next(ctx) {
+		_ = cur.Close(ctx)
+		return nil, fmt.Errorf("$backupCursor returned no metadata: %v", cur.Err())
+	}
+	meta := BackupCursorMeta{}
+	if err := cur.Decode(&meta); err != nil {
+		_ = cur.Close(ctx)
+		return nil, fmt.Errorf("can not decode $backupCursor metadata: %w", err)
+	}
+	bc.dbPath = meta.Metadata.DBPath
+	bc.oplogEnd = models.TimestampFromBson(meta.Metadata.OplogEnd.TS)
+
+	// cursor stays open after files are returned, so next batch is empty
+	for cur.TryNext(ctx) {
+		file := BackupCursorFile{}
+		if err := cur.Decode(&file); err != nil {
+			_ = cur.Close(ctx)
+			return nil, fmt.Errorf("can not decode $backupCursor file: %w", err)
+		}
+		bc.files = append(bc.files, BackupFile{Path: file.Filename, Size: file.FileSize})
+	}
+	if err := cur.Err(); err != nil {
+		_ = cur.Close(ctx)
+		return nil, fmt.Errorf("$backupCursor failed: %w", err)
+	}
+
+	bc.wg.Add(1)
+	go bc.keepAlive()
+	return bc, nil
+}
+
+func (bc *MongoBackupCursor) keepAlive() {
+	defer bc.wg.Done()
+	ticker := time.NewTicker(backupCursorKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-bc.stopc:
+			return
+		case <-ticker.C:
+			bc.cursor.TryNext(context.Background())
+		}
+	}
+}
+
+// DBPath returns dbPath of the node
+func (bc *MongoBackupCursor) DBPath() string {
+	return bc.dbPath
+}
+
+// Files returns files to copy
+func (bc *MongoBackupCursor) Files() []BackupFile {
+	return bc.files
+}
+
+// OplogEnd returns timestamp of the last oplog record in the copied files
+func (bc *MongoBackupCursor) OplogEnd() models.Timestamp {
+	return bc.oplogEnd
+}
+
+// Close stops keeping cursor alive and kills it
+func (bc *MongoBackupCursor) Close(ctx context.Context) error {
+	close(bc.stopc)
+	bc.wg.Wait()
+	return bc.cursor.Close(ctx)
+}
+
+// FsyncLock flushes all writes to disk and locks the node against writes
+func (mc *MongoClient) FsyncLock(ctx context.Context) error {
+	resp := CmdResponse{}
+	err := mc.c.Database("admin").RunCommand(ctx, bson.D{{Key: "fsync", Value: 1}, {Key: "lock", Value: true}},
+		options.RunCmd().SetReadPreference(mc.readPref)).Decode(&resp)
+	if err != nil {
+		return fmt.Errorf("fsync lock failed: %w", err)
+	}
+	return nil
+}
+
+// FsyncUnlock unlocks the node locked by FsyncLock
+func (mc *MongoClient) FsyncUnlock(ctx context.Context) error {
+	resp := CmdResponse{}
+	err := mc.c.Database("admin").RunCommand(ctx, bson.D{{Key: "fsyncUnlock", Value: 1}},
+		options.RunCmd().SetReadPreference(mc.readPref)).Decode(&resp)
+	if err != nil {
+		return fmt.Errorf("fsync unlock failed: %w", err)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/wal-g/wal-g/internal/databases/mongo/models"
 
@@ -12,6 +13,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 var (
@@ -47,13 +49,51 @@ type IsMasterLastWrite struct {
 // IsMaster is used to unmarshal results of IsMaster command
 type IsMaster struct {
 	IsMaster  bool              `bson:"ismaster"`
+	SetName   string            `bson:"setName"`
+	Me        string            `bson:"me"`
+	Hosts     []string          `bson:"hosts"`
 	LastWrite IsMasterLastWrite `bson:"lastWrite"`
 }
 
+// BuildInfo is used to unmarshal results of buildInfo command
+type BuildInfo struct {
+	Version string `bson:"version"`
+}
+
+// FCVParameter is used to unmarshal featureCompatibilityVersion from results of getParameter command
+type FCVParameter struct {
+	FeatureCompatibilityVersion struct {
+		Version string `bson:"version"`
+	} `bson:"featureCompatibilityVersion"`
+}
+
+// ReplSetGetConfig is used to unmarshal results of replSetGetConfig command
+type ReplSetGetConfig struct {
+	Config struct {
+		ID      string `bson:"_id"`
+		Version int    `bson:"version"`
+		Members []struct {
+			ID          int     `bson:"_id"`
+			Host        string  `bson:"host"`
+			ArbiterOnly bool    `bson:"arbiterOnly"`
+			Hidden      bool    `bson:"hidden"`
+			Priority    float64 `bson:"priority"`
+			Votes       int     `bson:"votes"`
+		} `bson:"members"`
+	} `bson:"config"`
+}
+
 // MongoDriver defines methods to work with mongodb.
 type MongoDriver interface {
 	EnsureIsMaster(ctx context.Context) error
 	IsMaster(ctx context.Context) (models.IsMaster, error)
+	ServerVersion(ctx context.Context) (string, error)
+	FeatureCompatibilityVersion(ctx context.Context) (string, error)
+	ReplSetConfig(ctx context.Context) (models.ReplSetConfig, error)
+	OpenBackupCursor(ctx context.Context) (BackupCursor, error)
+	FsyncLock(ctx context.Context) error
+	FsyncUnlock(ctx context.Context) error
+	SeedOplog(ctx context.Context, size int64, lastOp []byte) error
 	LastWriteTS(ctx context.Context) (lastTS, lastMajTS models.Timestamp, err error)
 	TailOplogFrom(ctx context.Context, from models.Timestamp) (OplogCursor, error)
 	ApplyOp(ctx context.Context, op db.Oplog) error
@@ -106,23 +146,72 @@ func (m *MongoOplogCursor) Next(ctx context.Context) bool {
 
 // MongoClient implements MongoDriver
 type MongoClient struct {
-	c *mongo.Client
+	c        *mongo.Client
+	readPref *readpref.ReadPref
+}
+
+// MongoClientOption configures MongoClient
+type MongoClientOption func(*MongoClient)
+
+// ReadFrom makes client discover replica set members by uri and read from member selected by read preference.
+// Member is reselected on every command, so reading continues from another member if the chosen one fails.
+func ReadFrom(readPref *readpref.ReadPref) MongoClientOption {
+	return func(mc *MongoClient) {
+		mc.readPref = readPref
+	}
+}
+
+// ParseReadPreference builds read preference from mode name and comma-separated tags in <name>:<value> format
+func ParseReadPreference(mode, tags string) (*readpref.ReadPref, error) {
+	rpMode, err := readpref.ModeFromString(mode)
+	if err != nil {
+		return nil, err
+	}
+	var opts []readpref.Option
+	if tags != "" {
+		var tagPairs []string
+		for _, t := range strings.Split(tags, ",") {
+			pair := strings.SplitN(t, ":", 2)
+			if len(pair) != 2 {
+				return nil, fmt.Errorf("tag '%s' is not in <name>:<value> format", t)
+			}
+			tagPairs = append(tagPairs, pair...)
+		}
+		opts = append(opts, readpref.WithTags(tagPairs...))
+	}
+	return readpref.New(rpMode, opts...)
 }
 
 // NewMongoClient builds MongoClient
-func NewMongoClient(ctx context.Context, uri string) (*MongoClient, error) {
+func NewMongoClient(ctx context.Context, uri string, opts ...MongoClientOption) (*MongoClient, error) {
+	mc := &MongoClient{readPref: readpref.Primary()}
+	for _, opt := range opts {
+		opt(mc)
+	}
+
 	client, err := mongo.Connect(ctx,
 		options.Client().ApplyURI(uri).
 			SetAppName(driverAppName).
-			SetDirect(true).
+			SetDirect(mc.ReadsFromPrimary()).
+			SetReadPreference(mc.readPref).
 			SetRetryReads(false))
 	if err != nil {
 		return nil, err
 	}
-	return &MongoClient{c: client}, client.Ping(ctx, nil)
+	mc.c = client
+	return mc, client.Ping(ctx, mc.readPref)
 }
 
+// ReadsFromPrimary returns if client is connected directly to the node given by uri (it must be a primary)
+func (mc *MongoClient) ReadsFromPrimary() bool {
+	return mc.readPref.Mode() == readpref.PrimaryMode
+}
+
+// EnsureIsMaster checks if client reads from primary, it is always ok for secondary reads
 func (mc *MongoClient) EnsureIsMaster(ctx context.Context) error {
+	if !mc.ReadsFromPrimary() {
+		return nil
+	}
 	im, err := mc.IsMaster(ctx)
 	if err != nil {
 		return err
@@ -136,13 +225,17 @@ func (mc *MongoClient) EnsureIsMaster(ctx context.Context) error {
 
 func (mc *MongoClient) IsMaster(ctx context.Context) (models.IsMaster, error) {
 	im := IsMaster{}
-	err := mc.c.Database("test").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&im)
+	err := mc.c.Database("test").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}},
+		options.RunCmd().SetReadPreference(mc.readPref)).Decode(&im)
 	if err != nil {
 		return models.IsMaster{}, fmt.Errorf("isMaster command failed: %w", err)
 	}
 
 	return models.IsMaster{
 		IsMaster: im.IsMaster,
+		SetName:  im.SetName,
+		Me:       im.Me,
+		Hosts:    im.Hosts,
 		LastWrite: models.IsMasterLastWrite{
 			OpTime: models.OpTime{
 				TS: models.TimestampFromBson(im.LastWrite.OpTime.TS),
@@ -154,6 +247,52 @@ func (mc *MongoClient) IsMaster(ctx context.Context) (models.IsMaster, error) {
 	}, nil
 }
 
+// ServerVersion fetches mongod version
+func (mc *MongoClient) ServerVersion(ctx context.Context) (string, error) {
+	bi := BuildInfo{}
+	err := mc.c.Database("admin").RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}},
+		options.RunCmd().SetReadPreference(mc.readPref)).Decode(&bi)
+	if err != nil {
+		return "", fmt.Errorf("buildInfo command failed: %w", err)
+	}
+	return bi.Version, nil
+}
+
+// FeatureCompatibilityVersion fetches featureCompatibilityVersion parameter
+func (mc *MongoClient) FeatureCompatibilityVersion(ctx context.Context) (string, error) {
+	fcv := FCVParameter{}
+	err := mc.c.Database("admin").RunCommand(ctx,
+		bson.D{{Key: "getParameter", Value: 1}, {Key: "featureCompatibilityVersion", Value: 1}},
+		options.RunCmd().SetReadPreference(mc.readPref)).Decode(&fcv)
+	if err != nil {
+		return "", fmt.Errorf("getParameter command failed: %w", err)
+	}
+	return fcv.FeatureCompatibilityVersion.Version, nil
+}
+
+// ReplSetConfig fetches replica set configuration
+func (mc *MongoClient) ReplSetConfig(ctx context.Context) (models.ReplSetConfig, error) {
+	rs := ReplSetGetConfig{}
+	err := mc.c.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetGetConfig", Value: 1}},
+		options.RunCmd().SetReadPreference(mc.readPref)).Decode(&rs)
+	if err != nil {
+		return models.ReplSetConfig{}, fmt.Errorf("replSetGetConfig command failed: %w", err)
+	}
+
+	config := models.ReplSetConfig{ID: rs.Config.ID, Version: rs.Config.Version}
+	for _, m := range rs.Config.Members {
+		config.Members = append(config.Members, models.ReplSetMember{
+			ID:          m.ID,
+			Host:        m.Host,
+			ArbiterOnly: m.ArbiterOnly,
+			Hidden:      m.Hidden,
+			Priority:    m.Priority,
+			Votes:       m.Votes,
+		})
+	}
+	return config, nil
+}
+
 // LastWriteTS fetches timestamps with last write
 // TODO: support non-replset setups
 func (mc *MongoClient) LastWriteTS(ctx context.Context) (lastTS, lastMajTS models.Timestamp, err error) {
@@ -221,6 +360,21 @@ func (mc *MongoClient) ApplyOp(ctx context.Context, op db.Oplog) error {
 	return nil
 }
 
+// SeedOplog creates oplog of standalone node and inserts the last applied record, so node can join replica set
+// and sync from this record.
+func (mc *MongoClient) SeedOplog(ctx context.Context, size int64, lastOp []byte) error {
+	local := mc.c.Database(oplogDatabaseName)
+	err := local.RunCommand(ctx,
+		bson.D{{Key: "create", Value: oplogCollectionName}, {Key: "capped", Value: true}, {Key: "size", Value: size}}).Err()
+	if err != nil {
+		return fmt.Errorf("can not create oplog collection: %w", err)
+	}
+	if _, err := local.Collection(oplogCollectionName).InsertOne(ctx, bson.Raw(lastOp)); err != nil {
+		return fmt.Errorf("can not insert oplog record: %w", err)
+	}
+	return nil
+}
+
 // BsonCursor implements OplogCursor with source io.reader
 type BsonCursor struct {
 	r      io.Reader
@@ -6,6 +6,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/tag"
 )
 
 func TestMongoOplogCursor_NextPush(t *testing.T) {
@@ -35,3 +37,21 @@ func TestBsonCursor_NextPush(t *testing.T) {
 
 	assert.False(t, m.Next(ctx))
 }
+
+func TestParseReadPreference(t *testing.T) {
+	rp, err := ParseReadPreference("secondary", "dc:east,rack:r1")
+	assert.NoError(t, err)
+	assert.Equal(t, readpref.SecondaryMode, rp.Mode())
+	assert.Equal(t, []tag.Set{{{Name: "dc", Value: "east"}, {Name: "rack", Value: "r1"}}}, rp.TagSets())
+
+	rp, err = ParseReadPreference("primary", "")
+	assert.NoError(t, err)
+	assert.Equal(t, readpref.PrimaryMode, rp.Mode())
+
+	_, err = ParseReadPreference("primary", "dc:east")
+	assert.Error(t, err)
+	_, err = ParseReadPreference("secondary", "dc")
+	assert.Error(t, err)
+	_, err = ParseReadPreference("any", "")
+	assert.Error(t, err)
+}
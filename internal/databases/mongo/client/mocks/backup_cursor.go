@@ -0,0 +1,76 @@
+// Code generated by Yandex patched mockery v1.1.0. DO NOT EDIT.
+
+package clientmocks
+
+import (
+	context "context"
+
+	client "github.com/wal-g/wal-g/internal/databases/mongo/client"
+
+	mock "github.com/stretchr/testify/mock"
+
+	models "github.com/wal-g/wal-g/internal/databases/mongo/models"
+)
+
+// BackupCursor is an autogenerated mock type for the BackupCursor type
+type BackupCursor struct {
+	mock.Mock
+}
+
+// Close provides a mock function with given fields: ctx
+func (_m *BackupCursor) Close(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DBPath provides a mock function with given fields:
+func (_m *BackupCursor) DBPath() string {
+	ret := _m.Called()
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// Files provides a mock function with given fields:
+func (_m *BackupCursor) Files() []client.BackupFile {
+	ret := _m.Called()
+
+	var r0 []client.BackupFile
+	if rf, ok := ret.Get(0).(func() []client.BackupFile); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]client.BackupFile)
+		}
+	}
+
+	return r0
+}
+
+// OplogEnd provides a mock function with given fields:
+func (_m *BackupCursor) OplogEnd() models.Timestamp {
+	ret := _m.Called()
+
+	var r0 models.Timestamp
+	if rf, ok := ret.Get(0).(func() models.Timestamp); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(models.Timestamp)
+	}
+
+	return r0
+}
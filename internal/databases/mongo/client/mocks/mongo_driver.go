@@ -61,6 +61,55 @@ func (_m *MongoDriver) EnsureIsMaster(ctx context.Context) error {
 	return r0
 }
 
+// FeatureCompatibilityVersion provides a mock function with given fields: ctx
+func (_m *MongoDriver) FeatureCompatibilityVersion(ctx context.Context) (string, error) {
+	ret := _m.Called(ctx)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context) string); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FsyncLock provides a mock function with given fields: ctx
+func (_m *MongoDriver) FsyncLock(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// FsyncUnlock provides a mock function with given fields: ctx
+func (_m *MongoDriver) FsyncUnlock(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // IsMaster provides a mock function with given fields: ctx
 func (_m *MongoDriver) IsMaster(ctx context.Context) (models.IsMaster, error) {
 	ret := _m.Called(ctx)
@@ -124,6 +173,92 @@ func (_m *MongoDriver) LastWriteTS(ctx context.Context) (models.Timestamp, model
 	return r0, r1, r2
 }
 
+// OpenBackupCursor provides a mock function with given fields: ctx
+func (_m *MongoDriver) OpenBackupCursor(ctx context.Context) (client.BackupCursor, error) {
+	ret := _m.Called(ctx)
+
+	var r0 client.BackupCursor
+	if rf, ok := ret.Get(0).(func(context.Context) client.BackupCursor); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(client.BackupCursor)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReplSetConfig provides a mock function with given fields: ctx
+func (_m *MongoDriver) ReplSetConfig(ctx context.Context) (models.ReplSetConfig, error) {
+	ret := _m.Called(ctx)
+
+	var r0 models.ReplSetConfig
+	if rf, ok := ret.Get(0).(func(context.Context) models.ReplSetConfig); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(models.ReplSetConfig)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SeedOplog provides a mock function with given fields: ctx, size, lastOp
+func (_m *MongoDriver) SeedOplog(ctx context.Context, size int64, lastOp []byte) error {
+	ret := _m.Called(ctx, size, lastOp)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, []byte) error); ok {
+		r0 = rf(ctx, size, lastOp)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ServerVersion provides a mock function with given fields: ctx
+func (_m *MongoDriver) ServerVersion(ctx context.Context) (string, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 1 {
+		rf, ok := ret.Get(0).(func(context.Context) (string, error))
+		if ok {
+			return rf(ctx)
+		}
+	}
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context) string); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // TailOplogFrom provides a mock function with given fields: ctx, from
 func (_m *MongoDriver) TailOplogFrom(ctx context.Context, from models.Timestamp) (client.OplogCursor, error) {
 	ret := _m.Called(ctx, from)
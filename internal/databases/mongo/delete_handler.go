@@ -1,6 +1,10 @@
 package mongo
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
@@ -10,10 +14,13 @@ import (
 )
 
 type PurgeSettings struct {
-	retainCount *int
-	retainAfter *time.Time
-	purgeOplog  bool
-	dryRun      bool
+	retainCount     *int
+	retainAfter     *time.Time
+	purgeOplog      bool
+	retainWithOplog bool
+	dryRun          bool
+	planOutput      io.Writer
+	plan            *archive.PurgePlan
 }
 
 type PurgeOption func(*PurgeSettings)
@@ -39,6 +46,13 @@ func PurgeOplog(purgeOplog bool) PurgeOption {
 	}
 }
 
+// PurgeRetainWithOplog purges oplog archives which are not needed for point-in-time recovery from retained backups
+func PurgeRetainWithOplog(retainWithOplog bool) PurgeOption {
+	return func(args *PurgeSettings) {
+		args.retainWithOplog = retainWithOplog
+	}
+}
+
 // PurgeDryRun ...
 func PurgeDryRun(dryRun bool) PurgeOption {
 	return func(args *PurgeSettings) {
@@ -46,12 +60,39 @@ func PurgeDryRun(dryRun bool) PurgeOption {
 	}
 }
 
+// PurgePlanOutput writes JSON list of deleted objects with reasons to output
+func PurgePlanOutput(output io.Writer) PurgeOption {
+	return func(args *PurgeSettings) {
+		args.planOutput = output
+	}
+}
+
 // HandlePurge delete backups and oplog archives according to settings
 func HandlePurge(downloader archive.Downloader, purger archive.Purger, setters ...PurgeOption) error {
 	opts := PurgeSettings{purgeOplog: false, dryRun: true}
 	for _, setter := range setters {
 		setter(&opts)
 	}
+	if opts.planOutput != nil {
+		opts.plan = archive.NewPurgePlan(opts.dryRun)
+	}
+
+	if err := handlePurge(downloader, purger, opts); err != nil {
+		return err
+	}
+
+	if opts.plan != nil {
+		encoder := json.NewEncoder(opts.planOutput)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(opts.plan)
+	}
+	return nil
+}
+
+func handlePurge(downloader archive.Downloader, purger archive.Purger, opts PurgeSettings) error {
+	if opts.retainWithOplog {
+		return HandleRetainWithOplogPurge(downloader, purger, opts)
+	}
 
 	_, retainBackups, err := HandleBackupsPurge(downloader, purger, opts)
 	if err != nil {
@@ -68,6 +109,45 @@ func HandlePurge(downloader archive.Downloader, purger archive.Purger, setters .
 	return nil
 }
 
+// planBackupsPurge adds backups files to purge plan if it is requested
+func planBackupsPurge(purger archive.Purger, backups []archive.Backup, opts PurgeSettings) error {
+	if opts.plan == nil {
+		return nil
+	}
+	reason := backupPurgeReason(opts)
+	for _, backup := range backups {
+		backupPlan, err := purger.PlanBackupPurge(backup, reason)
+		if err != nil {
+			return err
+		}
+		opts.plan.Backups = append(opts.plan.Backups, backupPlan)
+	}
+	return nil
+}
+
+// planOplogArchivesPurge adds oplog archives to purge plan if it is requested
+func planOplogArchivesPurge(archives []models.Archive, purgeBeforeTS models.Timestamp, opts PurgeSettings) {
+	if opts.plan == nil {
+		return
+	}
+	opts.plan.AddOplogArchives(archives,
+		fmt.Sprintf("ends before %v, the start of the oldest retained backup", purgeBeforeTS))
+}
+
+func backupPurgeReason(opts PurgeSettings) string {
+	var policies []string
+	if opts.retainCount != nil {
+		policies = append(policies, fmt.Sprintf("older than %d newest backups", *opts.retainCount))
+	}
+	if opts.retainAfter != nil {
+		policies = append(policies, fmt.Sprintf("started before %s", opts.retainAfter.Format(time.RFC3339)))
+	}
+	if len(policies) == 0 {
+		policies = append(policies, "no retain policy is set")
+	}
+	return strings.Join(append(policies, "not a base of retained delta backups"), ", ")
+}
+
 // HandleBackupsPurge delete backups according to settings
 func HandleBackupsPurge(downloader archive.Downloader, purger archive.Purger, opts PurgeSettings) (purge []archive.Backup, retain []archive.Backup, err error) {
 	backupTimes, err := downloader.ListBackupNames()
@@ -88,6 +168,9 @@ func HandleBackupsPurge(downloader archive.Downloader, purger archive.Purger, op
 	purge, retain, err = archive.SplitPurgingBackups(backups, opts.retainCount, opts.retainAfter)
 	tracelog.InfoLogger.Printf("Backups selected to be deleted: %v", archive.BackupNamesFromBackups(purge))
 	tracelog.InfoLogger.Printf("Backups selected to be retained: %v", archive.BackupNamesFromBackups(retain))
+	if err := planBackupsPurge(purger, purge, opts); err != nil {
+		return nil, nil, err
+	}
 
 	if !opts.dryRun {
 		if err := purger.DeleteBackups(purge); err != nil {
@@ -116,6 +199,7 @@ func HandleOplogArchivesPurge(downloader archive.Downloader, purger archive.Purg
 	tracelog.InfoLogger.Printf("Oplog archives will be purged if start_ts < %v", purgeBeforeTS)
 	purgeArchives := archive.SplitPurgingOplogArchives(archives, purgeBeforeTS)
 	tracelog.DebugLogger.Printf("Oplog archives selected to be deleted: %v", purgeArchives)
+	planOplogArchivesPurge(purgeArchives, purgeBeforeTS, opts)
 
 	if !opts.dryRun {
 		if err := purger.DeleteOplogArchives(purgeArchives); err != nil {
@@ -125,3 +209,70 @@ func HandleOplogArchivesPurge(downloader archive.Downloader, purger archive.Purg
 	}
 	return purgeArchives, nil
 }
+
+// HandleRetainWithOplogPurge deletes backups according to settings and oplog archives older than retained backups.
+// Purge is planned before deletion, oplog archives are never deleted if no backup is retained.
+func HandleRetainWithOplogPurge(downloader archive.Downloader, purger archive.Purger, opts PurgeSettings) error {
+	backupTimes, err := downloader.ListBackupNames()
+	if err != nil {
+		return err
+	}
+	if len(backupTimes) == 0 {
+		tracelog.InfoLogger.Println("No backups found")
+		return nil
+	}
+	backups, err := downloader.LoadBackups(archive.BackupNamesFromBackupTimes(backupTimes))
+	if err != nil {
+		return err
+	}
+	purgeBackups, retainBackups, err := archive.SplitPurgingBackups(backups, opts.retainCount, opts.retainAfter)
+	if err != nil {
+		return err
+	}
+	if len(retainBackups) == 0 {
+		return fmt.Errorf("no backups are retained, refusing to purge oplog archives needed for point-in-time recovery")
+	}
+
+	archives, err := downloader.ListOplogArchives()
+	if err != nil {
+		return err
+	}
+	purgeBeforeTS, err := archive.LastKnownInBackupTS(retainBackups)
+	if err != nil {
+		return err
+	}
+	purgeArchives := archive.SplitPurgingOplogArchives(archives, purgeBeforeTS)
+	retainArchives := make([]models.Archive, 0, len(archives)-len(purgeArchives))
+	for _, arch := range archives {
+		if !models.LessTS(arch.End, purgeBeforeTS) {
+			retainArchives = append(retainArchives, arch)
+		}
+	}
+
+	tracelog.InfoLogger.Printf("Backups selected to be deleted: %v", archive.BackupNamesFromBackups(purgeBackups))
+	tracelog.InfoLogger.Printf("Backups selected to be retained: %v", archive.BackupNamesFromBackups(retainBackups))
+	tracelog.InfoLogger.Printf("Oplog archives will be purged if end_ts < %v", purgeBeforeTS)
+	if err := planBackupsPurge(purger, purgeBackups, opts); err != nil {
+		return err
+	}
+	planOplogArchivesPurge(purgeArchives, purgeBeforeTS, opts)
+	for _, backup := range retainBackups {
+		if !archive.IsCoveredByOplog(retainArchives, backup.ConsistentTS()) {
+			tracelog.WarningLogger.Printf("Retained oplog archives do not cover point-in-time recovery from backup '%s'",
+				backup.BackupName)
+		}
+	}
+
+	if opts.dryRun {
+		return nil
+	}
+	if err := purger.DeleteBackups(purgeBackups); err != nil {
+		return err
+	}
+	tracelog.InfoLogger.Printf("Backups were purged: deleted: %d, retained: %v", len(purgeBackups), len(retainBackups))
+	if err := purger.DeleteOplogArchives(purgeArchives); err != nil {
+		return err
+	}
+	tracelog.InfoLogger.Printf("Oplog archives were purged: deleted: %d", len(purgeArchives))
+	return nil
+}
@@ -0,0 +1,92 @@
+package mongo
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+	archivemocks "github.com/wal-g/wal-g/internal/databases/mongo/archive/mocks"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func purgeTestBackup(name string, startTS uint32) archive.Backup {
+	return archive.Backup{
+		BackupName:     name,
+		StartLocalTime: time.Unix(int64(startTS), 0),
+		MongoMeta: archive.MongoMeta{
+			Before: archive.NodeMeta{LastMajTS: models.Timestamp{TS: startTS, Inc: 1}},
+			After:  archive.NodeMeta{LastMajTS: models.Timestamp{TS: startTS + 10, Inc: 1}},
+		},
+	}
+}
+
+func purgeTestArchive(start, end uint32) models.Archive {
+	return models.Archive{
+		Start: models.Timestamp{TS: start, Inc: 1},
+		End:   models.Timestamp{TS: end, Inc: 1},
+		Ext:   "lz4",
+		Type:  models.ArchiveTypeOplog,
+	}
+}
+
+func TestHandlePurge_RetainWithOplog(t *testing.T) {
+	backups := []archive.Backup{purgeTestBackup("stream_1", 100), purgeTestBackup("stream_2", 200), purgeTestBackup("stream_3", 300)}
+	archives := []models.Archive{
+		purgeTestArchive(50, 150), purgeTestArchive(150, 195), purgeTestArchive(195, 250), purgeTestArchive(250, 350),
+	}
+	downloader := pitrTestDownloader(backups...)
+	downloader.On("ListOplogArchives").Return(archives, nil)
+	purger := &archivemocks.Purger{}
+	purger.On("DeleteBackups", []archive.Backup{backups[0]}).Return(nil)
+	purger.On("DeleteOplogArchives", archives[:2]).Return(nil)
+
+	err := HandlePurge(downloader, purger, PurgeRetainCount(2), PurgeRetainWithOplog(true), PurgeDryRun(false))
+	assert.NoError(t, err)
+	downloader.AssertExpectations(t)
+	purger.AssertExpectations(t)
+}
+
+func TestHandlePurge_RetainWithOplogRefusesWithoutRetainedBackups(t *testing.T) {
+	downloader := pitrTestDownloader(purgeTestBackup("stream_1", 100))
+	purger := &archivemocks.Purger{}
+
+	err := HandlePurge(downloader, purger, PurgeRetainAfter(time.Unix(1000, 0)), PurgeRetainWithOplog(true), PurgeDryRun(false))
+	assert.Error(t, err)
+	purger.AssertNotCalled(t, "DeleteBackups")
+	purger.AssertNotCalled(t, "DeleteOplogArchives")
+}
+
+func TestHandlePurge_DryRunPlan(t *testing.T) {
+	backups := []archive.Backup{purgeTestBackup("stream_1", 100), purgeTestBackup("stream_2", 200)}
+	archives := []models.Archive{purgeTestArchive(50, 150), purgeTestArchive(150, 250)}
+	downloader := pitrTestDownloader(backups...)
+	downloader.On("ListOplogArchives").Return(archives, nil)
+	purger := &archivemocks.Purger{}
+	purger.On("PlanBackupPurge", backups[0], mock.Anything).Return(func(backup archive.Backup, reason string) archive.BackupPurgePlan {
+		return archive.BackupPurgePlan{Name: backup.BackupName, Reason: reason,
+			TarMembers: []string{"stream_1/stream.lz4"}, Sentinel: "stream_1_backup_stop_sentinel.json"}
+	}, nil)
+
+	output := &bytes.Buffer{}
+	err := HandlePurge(downloader, purger, PurgeRetainCount(1), PurgeOplog(true), PurgePlanOutput(output))
+	assert.NoError(t, err)
+	purger.AssertNotCalled(t, "DeleteBackups", mock.Anything)
+	purger.AssertNotCalled(t, "DeleteOplogArchives", mock.Anything)
+
+	plan := archive.PurgePlan{}
+	require.NoError(t, json.Unmarshal(output.Bytes(), &plan))
+	assert.True(t, plan.DryRun)
+	require.Len(t, plan.Backups, 1)
+	assert.Equal(t, "stream_1", plan.Backups[0].Name)
+	assert.Equal(t, []string{"stream_1/stream.lz4"}, plan.Backups[0].TarMembers)
+	assert.Contains(t, plan.Backups[0].Reason, "older than 1 newest backups")
+	require.Len(t, plan.OplogArchives, 1)
+	assert.Equal(t, archives[0].Filename(), plan.OplogArchives[0].Name)
+	assert.Contains(t, plan.OplogArchives[0].Reason, "ends before 200.1")
+}
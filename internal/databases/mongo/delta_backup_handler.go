@@ -0,0 +1,91 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+	"github.com/wal-g/wal-g/internal/databases/mongo/client"
+
+	"github.com/wal-g/tracelog"
+)
+
+const maxBackupChainLength = 1000
+
+// errWaiter implements archive.ErrWaiter for background goroutine
+type errWaiter struct {
+	errc chan error
+}
+
+func (w *errWaiter) Wait() error {
+	return <-w.errc
+}
+
+// HandleDeltaBackupPush uploads database files changed since the latest physical backup as its delta.
+// Files are compared with the files listed in the base backup by size and modification time.
+func HandleDeltaBackupPush(ctx context.Context, downloader archive.Downloader, uploader archive.Uploader,
+	metaProvider archive.MongoMetaProvider, mongoClient client.MongoDriver, dbPath string) error {
+	base, err := latestPhysicalBackup(downloader)
+	if err != nil {
+		return err
+	}
+	if len(base.MongoMeta.Files) == 0 {
+		return fmt.Errorf("latest physical backup '%s' does not list database files, full physical backup is required", base.BackupName)
+	}
+	tracelog.InfoLogger.Printf("Delta backup from '%s'", base.BackupName)
+	return pushPhysicalBackup(ctx, uploader, metaProvider, mongoClient, dbPath, &base)
+}
+
+// changedFiles returns files which are absent in base or differ from it by size or modification time
+func changedFiles(base, files []archive.PhysicalFile) []archive.PhysicalFile {
+	baseFiles := make(map[string]archive.PhysicalFile, len(base))
+	for _, file := range base {
+		baseFiles[file.Name] = file
+	}
+	var changed []archive.PhysicalFile
+	for _, file := range files {
+		baseFile, ok := baseFiles[file.Name]
+		if ok && baseFile.Size == file.Size && baseFile.ModTime.Equal(file.ModTime) {
+			continue
+		}
+		changed = append(changed, file)
+	}
+	return changed
+}
+
+// latestPhysicalBackup returns the most recently finished physical backup, logical backups can not be a base of delta
+func latestPhysicalBackup(downloader archive.Downloader) (archive.Backup, error) {
+	backupTimes, err := downloader.ListBackupNames()
+	if err != nil {
+		return archive.Backup{}, err
+	}
+	backups, err := downloader.LoadBackups(archive.BackupNamesFromBackupTimes(backupTimes))
+	if err != nil {
+		return archive.Backup{}, err
+	}
+	for _, backup := range backups {
+		if backup.IsPhysical() {
+			return backup, nil
+		}
+	}
+	return archive.Backup{}, fmt.Errorf("no physical backups found to make delta from")
+}
+
+// BackupChain returns the full backup and its deltas required to restore given backup, oldest first
+func BackupChain(downloader archive.Downloader, backupName string) ([]archive.Backup, error) {
+	var chain []archive.Backup
+	for name := backupName; ; {
+		backup, err := downloader.BackupMeta(name)
+		if err != nil {
+			return nil, err
+		}
+		chain = append([]archive.Backup{backup}, chain...)
+		if !backup.IsIncremental() {
+			return chain, nil
+		}
+		if len(chain) > maxBackupChainLength {
+			return nil, fmt.Errorf("backup chain of '%s' is too long, cycle is possible", backupName)
+		}
+		name = backup.IncrementFrom
+	}
+}
@@ -0,0 +1,63 @@
+package mongo
+
+import (
+	"testing"
+
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+	archivemocks "github.com/wal-g/wal-g/internal/databases/mongo/archive/mocks"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupChain(t *testing.T) {
+	full := archive.Backup{BackupName: "stream_1"}
+	delta1 := archive.Backup{BackupName: "stream_2", IncrementFrom: "stream_1"}
+	delta2 := archive.Backup{BackupName: "stream_3", IncrementFrom: "stream_2"}
+
+	downloader := &archivemocks.Downloader{}
+	downloader.On("BackupMeta", "stream_1").Return(full, nil)
+	downloader.On("BackupMeta", "stream_2").Return(delta1, nil)
+	downloader.On("BackupMeta", "stream_3").Return(delta2, nil)
+
+	chain, err := BackupChain(downloader, "stream_3")
+	assert.NoError(t, err)
+	assert.Equal(t, []archive.Backup{full, delta1, delta2}, chain)
+
+	chain, err = BackupChain(downloader, "stream_1")
+	assert.NoError(t, err)
+	assert.Equal(t, []archive.Backup{full}, chain)
+}
+
+func TestBackupChain_Cycle(t *testing.T) {
+	downloader := &archivemocks.Downloader{}
+	downloader.On("BackupMeta", "stream_1").Return(archive.Backup{BackupName: "stream_1", IncrementFrom: "stream_2"}, nil)
+	downloader.On("BackupMeta", "stream_2").Return(archive.Backup{BackupName: "stream_2", IncrementFrom: "stream_1"}, nil)
+
+	_, err := BackupChain(downloader, "stream_1")
+	assert.Error(t, err)
+}
+
+func TestLatestPhysicalBackup_SkipsLogicalBackups(t *testing.T) {
+	backups := []archive.Backup{
+		{BackupName: "stream_3"},
+		{BackupName: "stream_2", MongoMeta: archive.MongoMeta{BackupType: archive.PhysicalBackupType}},
+		{BackupName: "stream_1", MongoMeta: archive.MongoMeta{BackupType: archive.PhysicalBackupType}},
+	}
+	downloader := &archivemocks.Downloader{}
+	downloader.On("ListBackupNames").Return([]internal.BackupTime{{BackupName: "stream_1"}, {BackupName: "stream_2"}, {BackupName: "stream_3"}}, nil)
+	downloader.On("LoadBackups", []string{"stream_1", "stream_2", "stream_3"}).Return(backups, nil)
+
+	backup, err := latestPhysicalBackup(downloader)
+	assert.NoError(t, err)
+	assert.Equal(t, "stream_2", backup.BackupName)
+}
+
+func TestLatestPhysicalBackup_NoPhysicalBackups(t *testing.T) {
+	downloader := &archivemocks.Downloader{}
+	downloader.On("ListBackupNames").Return([]internal.BackupTime{{BackupName: "stream_1"}}, nil)
+	downloader.On("LoadBackups", []string{"stream_1"}).Return([]archive.Backup{{BackupName: "stream_1"}}, nil)
+
+	_, err := latestPhysicalBackup(downloader)
+	assert.Error(t, err)
+}
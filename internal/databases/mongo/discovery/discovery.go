@@ -31,7 +31,8 @@ func ResolveStartingTS(ctx context.Context, downloader archive.Downloader, mongo
 	return im.LastWrite.MajorityOpTime.TS, nil
 }
 
-// BuildCursorFromTS finds point to resume archiving or _restarts_ procedure from newest oplog document
+// BuildCursorFromTS finds point to resume archiving or resumes from the oldest available oplog document.
+// If since ts is not in oplog anymore, gap archive is uploaded to mark lost records.
 func BuildCursorFromTS(ctx context.Context, since models.Timestamp, uploader archive.Uploader, mongoClient client.MongoDriver) (oplogCursor client.OplogCursor, fromTS models.Timestamp, err error) {
 	oplogCursor, err = mongoClient.TailOplogFrom(ctx, since)
 	if err != nil {
@@ -53,24 +54,14 @@ func BuildCursorFromTS(ctx context.Context, since models.Timestamp, uploader arc
 		return oplogCursor, since, nil
 	}
 
-	// since ts is not exists, report gap and continue with newest timestamp
+	// since ts is not exists, report gap and continue with the oldest available document
 	gapErr := models.NewError(models.SplitFound, fmt.Sprintf("expected first ts is %v, but %v is given", since, op.TS))
 	tracelog.ErrorLogger.PrintError(gapErr)
 
-	tracelog.ErrorLogger.Printf("Reinitializing archiving with newest TS")
-	im, err := mongoClient.IsMaster(ctx)
-	if err != nil {
-		return nil, models.Timestamp{}, fmt.Errorf("can not fetch LastWrite.MajorityOpTime: %+v", err)
-	}
-	newestTS := im.LastWrite.MajorityOpTime.TS
-	if err := uploader.UploadGapArchive(gapErr, since, newestTS); err != nil {
+	tracelog.ErrorLogger.Printf("Resuming archiving from the oldest available TS %v", op.TS)
+	if err := uploader.UploadGapArchive(gapErr, since, op.TS); err != nil {
 		return nil, models.Timestamp{}, err
 	}
 
-	oplogCursor, err = mongoClient.TailOplogFrom(ctx, newestTS)
-	if err != nil {
-		return nil, models.Timestamp{}, fmt.Errorf("can not build oplog cursor from ts '%s': %+v", newestTS, err)
-	}
-
-	return oplogCursor, newestTS, nil
+	return oplogCursor, op.TS, nil
 }
@@ -59,7 +59,6 @@ func TestBuildCursorFromFolderTS(t *testing.T) {
 			args: func() args {
 				reqTS := models.Timestamp{TS: 1579001001, Inc: 1}
 				oldestTS := models.Timestamp{TS: 1579003001, Inc: 1}
-				newestTS := models.Timestamp{TS: 1579005001, Inc: 1}
 
 				return args{
 					ctx:   context.TODO(),
@@ -69,7 +68,7 @@ func TestBuildCursorFromFolderTS(t *testing.T) {
 						upl.On("UploadGapArchive",
 							mock.Anything,
 							reqTS,
-							newestTS).
+							oldestTS).
 							Return(nil).Once()
 						return &upl
 					}(),
@@ -80,31 +79,20 @@ func TestBuildCursorFromFolderTS(t *testing.T) {
 							panic(err)
 						}
 						firstCur := &clientmocks.OplogCursor{}
-						firstCur.On("Data").Return(firstCurDoc).Once().
+						firstCur.On("Data").Return(firstCurDoc).Twice().
 							On("Next", mock.Anything).Return(true).Once().
 							On("Push", firstCurDoc).Return(nil).Once()
 
-						secondCurDoc, err := RawDocFromTimestamp(newestTS)
-						if err != nil {
-							panic(err)
-						}
-						secondCur := &clientmocks.OplogCursor{}
-						secondCur.On("Data").Return(secondCurDoc).Once()
-
 						md := &clientmocks.MongoDriver{}
-						md.On("TailOplogFrom", mock.Anything, reqTS).Return(firstCur, nil).Once().
-							On("IsMaster", mock.Anything).
-							Return(models.IsMaster{LastWrite: models.IsMasterLastWrite{MajorityOpTime: models.OpTime{TS: newestTS}}}, nil).
-							On("TailOplogFrom", mock.Anything, newestTS).Return(secondCur, nil).Once()
+						md.On("TailOplogFrom", mock.Anything, reqTS).Return(firstCur, nil).Once()
 						return MongoDriverFields{
-							client:    md,
-							firstCur:  firstCur,
-							secondCur: secondCur,
+							client:   md,
+							firstCur: firstCur,
 						}
 					}(),
 				}
 			}(),
-			expectedSince: models.Timestamp{TS: 1579005001, Inc: 1},
+			expectedSince: models.Timestamp{TS: 1579003001, Inc: 1},
 			err:           nil,
 		},
 		{
@@ -189,47 +177,11 @@ func TestBuildCursorFromFolderTS(t *testing.T) {
 			}(),
 			err: fmt.Errorf("can not fetch first document: next failed"),
 		},
-		{
-			name: "isMaster_error",
-			args: func() args {
-				reqTS := models.Timestamp{TS: 1579001001, Inc: 1}
-				oldestTS := models.Timestamp{TS: 1579003001, Inc: 1}
-
-				return args{
-					ctx:   context.TODO(),
-					since: reqTS,
-					uploader: func() *archivemocks.Uploader {
-						return &archivemocks.Uploader{}
-					}(),
-					mongo: func() MongoDriverFields {
-						firstCurDoc, err := RawDocFromTimestamp(oldestTS)
-						if err != nil {
-							panic(err)
-						}
-						firstCur := &clientmocks.OplogCursor{}
-						firstCur.On("Data").Return(firstCurDoc).Once().
-							On("Next", mock.Anything).Return(true).Once().
-							On("Push", firstCurDoc).Return(nil).Once()
-
-						md := &clientmocks.MongoDriver{}
-						md.On("TailOplogFrom", mock.Anything, reqTS).Return(firstCur, nil).Once().
-							On("IsMaster", mock.Anything).Return(models.IsMaster{}, fmt.Errorf("isMaster error"))
-
-						return MongoDriverFields{
-							client:   md,
-							firstCur: firstCur,
-						}
-					}(),
-				}
-			}(),
-			err: fmt.Errorf("can not fetch LastWrite.MajorityOpTime: isMaster error"),
-		},
 		{
 			name: "UploadGapArchive_no_error",
 			args: func() args {
 				reqTS := models.Timestamp{TS: 1579001001, Inc: 1}
 				oldestTS := models.Timestamp{TS: 1579003001, Inc: 1}
-				newestTS := models.Timestamp{TS: 1579005001, Inc: 1}
 
 				return args{
 					ctx:   context.TODO(),
@@ -239,7 +191,7 @@ func TestBuildCursorFromFolderTS(t *testing.T) {
 						upl.On("UploadGapArchive",
 							mock.Anything,
 							reqTS,
-							newestTS).
+							oldestTS).
 							Return(fmt.Errorf("gap upload error")).Once()
 						return &upl
 					}(),
@@ -254,9 +206,7 @@ func TestBuildCursorFromFolderTS(t *testing.T) {
 							On("Push", firstCurDoc).Return(nil).Once()
 
 						md := &clientmocks.MongoDriver{}
-						md.On("TailOplogFrom", mock.Anything, reqTS).Return(firstCur, nil).Once().
-							On("IsMaster", mock.Anything).
-							Return(models.IsMaster{LastWrite: models.IsMasterLastWrite{MajorityOpTime: models.OpTime{TS: newestTS}}}, nil)
+						md.On("TailOplogFrom", mock.Anything, reqTS).Return(firstCur, nil).Once()
 						return MongoDriverFields{
 							client:   md,
 							firstCur: firstCur,
@@ -266,51 +216,6 @@ func TestBuildCursorFromFolderTS(t *testing.T) {
 			}(),
 			err: fmt.Errorf("gap upload error"),
 		},
-		{
-			name: "second_TailOplogFrom_error_error",
-			args: func() args {
-				reqTS := models.Timestamp{TS: 1579001001, Inc: 1}
-				oldestTS := models.Timestamp{TS: 1579003001, Inc: 1}
-				newestTS := models.Timestamp{TS: 1579005001, Inc: 1}
-
-				return args{
-					ctx:   context.TODO(),
-					since: reqTS,
-					uploader: func() *archivemocks.Uploader {
-						upl := archivemocks.Uploader{}
-						upl.On("UploadGapArchive",
-							mock.Anything,
-							reqTS,
-							newestTS).
-							Return(nil).Once()
-						return &upl
-					}(),
-					mongo: func() MongoDriverFields {
-
-						firstCurDoc, err := RawDocFromTimestamp(oldestTS)
-						if err != nil {
-							panic(err)
-						}
-						firstCur := &clientmocks.OplogCursor{}
-						firstCur.On("Data").Return(firstCurDoc).Once().
-							On("Next", mock.Anything).Return(true).Once().
-							On("Push", firstCurDoc).Return(nil).Once()
-
-						md := &clientmocks.MongoDriver{}
-						md.On("TailOplogFrom", mock.Anything, reqTS).Return(firstCur, nil).Once().
-							On("IsMaster", mock.Anything).
-							Return(models.IsMaster{LastWrite: models.IsMasterLastWrite{MajorityOpTime: models.OpTime{TS: newestTS}}}, nil).
-							On("TailOplogFrom", mock.Anything, newestTS).
-							Return(nil, fmt.Errorf("can not create second cursor")).Once()
-						return MongoDriverFields{
-							client:   md,
-							firstCur: firstCur,
-						}
-					}(),
-				}
-			}(),
-			err: fmt.Errorf("can not build oplog cursor from ts '1579005001.1': can not create second cursor"),
-		},
 	}
 
 	for _, tc := range tests {
@@ -13,10 +13,11 @@ const (
 	ArchNameTSDelimiter = "_"
 	ArchiveTypeOplog    = "oplog"
 	ArchiveTypeGap      = "gap"
+	ArchiveTypeBatch    = "batch"
 )
 
 var (
-	ArchRegexp = regexp.MustCompile(`^(oplog|gap)_(?P<startTS>[0-9]+\.[0-9]+)_(?P<endTS>[0-9]+\.[0-9]+)\.(?P<Ext>[^$]+)$`)
+	ArchRegexp = regexp.MustCompile(`^(oplog|gap|batch)_(?P<startTS>[0-9]+\.[0-9]+)_(?P<endTS>[0-9]+\.[0-9]+)\.(?P<Ext>[^$]+)$`)
 )
 
 // Archive defines oplog archive representation
@@ -32,7 +33,7 @@ func NewArchive(start, end Timestamp, ext string, atype string) (Archive, error)
 	if LessTS(end, start) {
 		return Archive{}, fmt.Errorf("malformed archive, Start timestamp < End timestamp: %s < %s", start, end)
 	}
-	if atype != ArchiveTypeOplog && atype != ArchiveTypeGap {
+	if atype != ArchiveTypeOplog && atype != ArchiveTypeGap && atype != ArchiveTypeBatch {
 		return Archive{}, fmt.Errorf("malformed archive, unknown type: %s", atype)
 	}
 
@@ -44,6 +45,11 @@ func (a Archive) In(ts Timestamp) bool {
 	return (LessTS(a.Start, ts) && LessTS(ts, a.End)) || a.End == ts
 }
 
+// HasOplog returns if archive contains oplog records: it is an oplog archive or a batch of consecutive oplog archives
+func (a Archive) HasOplog() bool {
+	return a.Type == ArchiveTypeOplog || a.Type == ArchiveTypeBatch
+}
+
 // Filename builds archive filename from timestamps, extension and type
 // example: oplog_1569009857.10_1569009101.99.lzma
 func (a Archive) Filename() string {
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// NamespacePattern validates namespace pattern given by user and returns it in <database>.<collection> form.
+// Pattern is either database name or <database>.<collection>, wildcards are allowed.
+// It is shared by backup-fetch and oplog-replay, so the same namespaces are accepted by both.
+func NamespacePattern(ns string) (string, error) {
+	if ns == "" || strings.HasPrefix(ns, ".") || strings.HasSuffix(ns, ".") {
+		return "", fmt.Errorf("invalid namespace '%s'", ns)
+	}
+	if !strings.Contains(ns, ".") {
+		ns += ".*"
+	}
+	if _, err := path.Match(ns, ""); err != nil {
+		return "", fmt.Errorf("invalid namespace '%s': %w", ns, err)
+	}
+	return ns, nil
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespacePattern(t *testing.T) {
+	for ns, expected := range map[string]string{
+		"shop":           "shop.*",
+		"shop.orders":    "shop.orders",
+		"tenant_*.users": "tenant_*.users",
+	} {
+		pattern, err := NamespacePattern(ns)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, pattern)
+	}
+
+	for _, ns := range []string{"", ".orders", "shop.", "shop.[orders"} {
+		_, err := NamespacePattern(ns)
+		assert.Error(t, err, ns)
+	}
+}
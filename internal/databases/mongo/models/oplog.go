@@ -125,5 +125,25 @@ type IsMasterLastWrite struct {
 // IsMaster ...
 type IsMaster struct {
 	IsMaster  bool
+	SetName   string
+	Me        string
+	Hosts     []string
 	LastWrite IsMasterLastWrite
 }
+
+// ReplSetMember is a replica set member of ReplSetConfig
+type ReplSetMember struct {
+	ID          int     `json:"ID"`
+	Host        string  `json:"Host"`
+	ArbiterOnly bool    `json:"ArbiterOnly,omitempty"`
+	Hidden      bool    `json:"Hidden,omitempty"`
+	Priority    float64 `json:"Priority"`
+	Votes       int     `json:"Votes"`
+}
+
+// ReplSetConfig is a replica set configuration
+type ReplSetConfig struct {
+	ID      string          `json:"ID"`
+	Version int             `json:"Version"`
+	Members []ReplSetMember `json:"Members"`
+}
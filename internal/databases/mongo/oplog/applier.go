@@ -5,14 +5,17 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/wal-g/wal-g/internal/databases/mongo/client"
 	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+	"github.com/wal-g/wal-g/utility"
 
 	"github.com/mongodb/mongo-tools-common/db"
 	"github.com/mongodb/mongo-tools-common/txn"
 	"github.com/wal-g/tracelog"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 var (
@@ -48,14 +51,72 @@ type DBApplier struct {
 	db           client.MongoDriver
 	txnBuffer    *txn.Buffer
 	preserveUUID bool
+	nsFilter     *NamespaceFilter
+
+	checkpoint      CheckpointStore
+	appliedTS       models.Timestamp
+	lastTS          models.Timestamp
+	checkpointSaved time.Time
+}
+
+// DBApplierOption configures DBApplier.
+type DBApplierOption func(*DBApplier)
+
+// WithNamespaceFilter sets filter to apply only ops of matched namespaces.
+func WithNamespaceFilter(filter *NamespaceFilter) DBApplierOption {
+	return func(ap *DBApplier) {
+		ap.nsFilter = filter
+	}
+}
+
+// WithCheckpoint skips records applied before appliedTS and saves timestamp of applied records to store,
+// so interrupted replay can be restarted. Checkpoint is saved only when no transaction is in progress.
+func WithCheckpoint(store CheckpointStore, appliedTS models.Timestamp) DBApplierOption {
+	return func(ap *DBApplier) {
+		ap.checkpoint = store
+		ap.appliedTS = appliedTS
+		ap.lastTS = appliedTS
+	}
 }
 
 // NewDBApplier builds DBApplier with given args.
-func NewDBApplier(m client.MongoDriver, preserveUUID bool) *DBApplier {
-	return &DBApplier{db: m, txnBuffer: txn.NewBuffer(), preserveUUID: preserveUUID}
+func NewDBApplier(m client.MongoDriver, preserveUUID bool, opts ...DBApplierOption) *DBApplier {
+	ap := &DBApplier{db: m, txnBuffer: txn.NewBuffer(), preserveUUID: preserveUUID}
+	for _, opt := range opts {
+		opt(ap)
+	}
+	return ap
 }
 
 func (ap *DBApplier) Apply(ctx context.Context, opr models.Oplog) error {
+	if ap.checkpoint != nil && !models.LessTS(ap.appliedTS, opr.TS) {
+		return nil
+	}
+	if err := ap.apply(ctx, opr); err != nil {
+		return err
+	}
+	if ap.checkpoint != nil {
+		ap.lastTS = opr.TS
+		if utility.TimeNowCrossPlatformLocal().Sub(ap.checkpointSaved) >= checkpointInterval {
+			return ap.saveCheckpoint()
+		}
+	}
+	return nil
+}
+
+// saveCheckpoint saves timestamp of the last applied record unless transaction is buffered
+func (ap *DBApplier) saveCheckpoint() error {
+	if ap.txnBuffer.OldestTimestamp() != (primitive.Timestamp{}) {
+		return nil
+	}
+	if err := ap.checkpoint.Save(ap.lastTS); err != nil {
+		return fmt.Errorf("can not save replay checkpoint: %w", err)
+	}
+	ap.checkpointSaved = utility.TimeNowCrossPlatformLocal()
+	return nil
+}
+
+func (ap *DBApplier) apply(ctx context.Context, opr models.Oplog) error {
 	op := db.Oplog{}
 	if err := bson.Unmarshal(opr.Data, &op); err != nil {
 		return fmt.Errorf("can not unmarshal oplog entry: %w", err)
@@ -85,6 +146,11 @@ func (ap *DBApplier) Apply(ctx context.Context, opr models.Oplog) error {
 }
 
 func (ap *DBApplier) Close(ctx context.Context) error {
+	if ap.checkpoint != nil {
+		if err := ap.saveCheckpoint(); err != nil {
+			return err
+		}
+	}
 	if err := ap.db.Close(ctx); err != nil {
 		return err
 	}
@@ -114,8 +180,20 @@ func (ap *DBApplier) shouldSkip(op db.Oplog) error {
 
 // handleNonTxnOp tries to apply given oplog record.
 func (ap *DBApplier) handleNonTxnOp(ctx context.Context, op db.Oplog) error {
+	var err error
+	if ap.nsFilter != nil {
+		var matched bool
+		op, matched, err = ap.nsFilter.FilterOp(op)
+		if err != nil {
+			return fmt.Errorf("error filtering oplog by namespace: %v", err)
+		}
+		if !matched {
+			tracelog.DebugLogger.Printf("skipping op %+v due to namespace filter", op)
+			return nil
+		}
+	}
+
 	if !ap.preserveUUID {
-		var err error
 		op, err = filterUUIDs(op)
 		if err != nil {
 			return fmt.Errorf("error filtering UUIDs from oplog: %v", err)
@@ -0,0 +1,55 @@
+package oplog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+)
+
+// checkpointInterval is the minimal interval between checkpoint saves during replay
+const checkpointInterval = time.Second
+
+// CheckpointStore persists timestamp of the last applied oplog record
+type CheckpointStore interface {
+	Load() (ts models.Timestamp, exists bool, err error)
+	Save(ts models.Timestamp) error
+}
+
+// FileCheckpointStore keeps checkpoint in a local file
+type FileCheckpointStore struct {
+	path string
+}
+
+// NewFileCheckpointStore builds FileCheckpointStore with given file path
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{path: path}
+}
+
+// Load reads checkpoint, false is returned if checkpoint file does not exist
+func (s *FileCheckpointStore) Load() (models.Timestamp, bool, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return models.Timestamp{}, false, nil
+	}
+	if err != nil {
+		return models.Timestamp{}, false, fmt.Errorf("can not read checkpoint file: %w", err)
+	}
+	ts, err := models.TimestampFromStr(strings.TrimSpace(string(data)))
+	if err != nil {
+		return models.Timestamp{}, false, fmt.Errorf("can not parse checkpoint file %s: %w", s.path, err)
+	}
+	return ts, true, nil
+}
+
+// Save replaces checkpoint file, previous checkpoint is kept if the process is killed while writing
+func (s *FileCheckpointStore) Save(ts models.Timestamp) error {
+	tmpPath := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, []byte(ts.String()+"\n"), 0600); err != nil {
+		return fmt.Errorf("can not write checkpoint file: %w", err)
+	}
+	return os.Rename(tmpPath, s.path)
+}
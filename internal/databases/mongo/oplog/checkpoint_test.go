@@ -0,0 +1,44 @@
+package oplog
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools-common/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	clientmocks "github.com/wal-g/wal-g/internal/databases/mongo/client/mocks"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDBApplier_WithCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := NewFileCheckpointStore(filepath.Join(dir, "replay.ts"))
+	_, exists, err := store.Load()
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	mongoClient := &clientmocks.MongoDriver{}
+	mongoClient.On("ApplyOp", mock.Anything, mock.Anything).Return(nil).Twice()
+	mongoClient.On("Close", mock.Anything).Return(nil)
+	applier := NewDBApplier(mongoClient, false, WithCheckpoint(store, models.Timestamp{TS: 2, Inc: 1}))
+	for i := uint32(1); i <= 4; i++ {
+		data, err := bson.Marshal(db.Oplog{Operation: "i", Namespace: "shop.orders", Object: bson.D{{Key: "_id", Value: i}}})
+		require.NoError(t, err)
+		assert.NoError(t, applier.Apply(context.Background(), models.Oplog{TS: models.Timestamp{TS: i, Inc: 1}, Data: data}))
+	}
+	assert.NoError(t, applier.Close(context.Background()))
+	mongoClient.AssertExpectations(t)
+
+	appliedTS, exists, err := store.Load()
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, models.Timestamp{TS: 4, Inc: 1}, appliedTS)
+}
@@ -0,0 +1,114 @@
+package oplog
+
+import (
+	"path"
+	"strings"
+
+	"github.com/mongodb/mongo-tools-common/db"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+)
+
+// NamespaceFilter selects oplog records by namespace.
+// Namespace pattern is either database name or <database>.<collection>, wildcards are allowed.
+type NamespaceFilter struct {
+	include []string
+	exclude []string
+}
+
+// NewNamespaceFilter builds NamespaceFilter, empty include list matches all namespaces.
+func NewNamespaceFilter(include, exclude []string) (*NamespaceFilter, error) {
+	f := &NamespaceFilter{}
+	var err error
+	if f.include, err = namespacePatterns(include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = namespacePatterns(exclude); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func namespacePatterns(namespaces []string) ([]string, error) {
+	patterns := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		pattern, err := models.NamespacePattern(ns)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// Match returns true if namespace is included and not excluded.
+func (f *NamespaceFilter) Match(ns string) bool {
+	if len(f.include) > 0 && !matchAny(f.include, ns) {
+		return false
+	}
+	return !matchAny(f.exclude, ns)
+}
+
+func matchAny(patterns []string, ns string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, ns); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterOp returns op with not matched nested applyOps ops removed, false is returned if nothing left to apply.
+func (f *NamespaceFilter) FilterOp(op db.Oplog) (db.Oplog, bool, error) {
+	if op.Operation != "c" {
+		return op, f.Match(op.Namespace), nil
+	}
+
+	if !isApplyOpsCmd(op.Object) {
+		return op, f.Match(commandNamespace(op)), nil
+	}
+
+	ops, err := unwrapNestedApplyOps(op.Object)
+	if err != nil {
+		return db.Oplog{}, false, err
+	}
+	filtered := make([]db.Oplog, 0, len(ops))
+	for _, nested := range ops {
+		nested, ok, err := f.FilterOp(nested)
+		if err != nil {
+			return db.Oplog{}, false, err
+		}
+		if ok {
+			filtered = append(filtered, nested)
+		}
+	}
+	if len(filtered) == 0 {
+		return op, false, nil
+	}
+	if len(filtered) == len(ops) {
+		return op, true, nil
+	}
+
+	op.Object, err = wrapNestedApplyOps(filtered)
+	if err != nil {
+		return db.Oplog{}, false, err
+	}
+	return op, true, nil
+}
+
+// commandNamespace returns namespace the command op is applied to,
+// e.g. 'db.coll' for {create: 'coll'} or 'db.$cmd' for database-wide commands.
+func commandNamespace(op db.Oplog) string {
+	if len(op.Object) == 0 {
+		return op.Namespace
+	}
+	cmd := op.Object[0]
+	name, ok := cmd.Value.(string)
+	if !ok {
+		return op.Namespace
+	}
+	if cmd.Key == "renameCollection" {
+		return name
+	}
+	dbName := strings.SplitN(op.Namespace, ".", 2)[0]
+	return dbName + "." + name
+}
@@ -0,0 +1,89 @@
+package oplog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mongodb/mongo-tools-common/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	clientmocks "github.com/wal-g/wal-g/internal/databases/mongo/client/mocks"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNamespaceFilter_Match(t *testing.T) {
+	filter, err := NewNamespaceFilter([]string{"shop", "billing.invoices", "tenant_*"}, []string{"shop.tmp_*"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		ns    string
+		match bool
+	}{
+		{"shop.orders", true},
+		{"shop.$cmd", true},
+		{"shop.tmp_orders", false},
+		{"billing.invoices", true},
+		{"billing.payments", false},
+		{"tenant_1.users", true},
+		{"other.users", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.match, filter.Match(tt.ns), tt.ns)
+	}
+
+	_, err = NewNamespaceFilter([]string{"shop."}, nil)
+	assert.Error(t, err)
+}
+
+func TestNamespaceFilter_FilterOp(t *testing.T) {
+	filter, err := NewNamespaceFilter([]string{"shop.orders"}, nil)
+	require.NoError(t, err)
+
+	op, ok, err := filter.FilterOp(db.Oplog{Operation: "c", Namespace: "shop.$cmd", Object: bson.D{{Key: "create", Value: "orders"}}})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "shop.$cmd", op.Namespace)
+
+	_, ok, err = filter.FilterOp(db.Oplog{Operation: "c", Namespace: "shop.$cmd", Object: bson.D{{Key: "drop", Value: "carts"}}})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, ok, err = filter.FilterOp(db.Oplog{Operation: "c", Namespace: "admin.$cmd",
+		Object: bson.D{{Key: "renameCollection", Value: "shop.orders"}, {Key: "to", Value: "shop.archive"}}})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	applyOps, err := wrapNestedApplyOps([]db.Oplog{
+		{Operation: "i", Namespace: "shop.orders", Object: bson.D{{Key: "_id", Value: 1}}},
+		{Operation: "i", Namespace: "shop.carts", Object: bson.D{{Key: "_id", Value: 2}}},
+	})
+	require.NoError(t, err)
+	op, ok, err = filter.FilterOp(db.Oplog{Operation: "c", Namespace: "admin.$cmd", Object: applyOps})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	nested, err := unwrapNestedApplyOps(op.Object)
+	require.NoError(t, err)
+	require.Len(t, nested, 1)
+	assert.Equal(t, "shop.orders", nested[0].Namespace)
+}
+
+func TestDBApplier_ApplyNamespaceFilter(t *testing.T) {
+	filter, err := NewNamespaceFilter(nil, []string{"billing"})
+	require.NoError(t, err)
+
+	mongoClient := &clientmocks.MongoDriver{}
+	mongoClient.On("ApplyOp", mock.Anything, mock.MatchedBy(func(op db.Oplog) bool {
+		return op.Namespace == "shop.orders"
+	})).Return(nil).Once()
+
+	applier := NewDBApplier(mongoClient, false, WithNamespaceFilter(filter))
+	for _, ns := range []string{"shop.orders", "billing.invoices"} {
+		data, err := bson.Marshal(db.Oplog{Operation: "i", Namespace: ns, Object: bson.D{{Key: "_id", Value: 1}}})
+		require.NoError(t, err)
+		assert.NoError(t, applier.Apply(context.Background(), models.Oplog{Data: data}))
+	}
+
+	mongoClient.AssertExpectations(t)
+}
@@ -3,9 +3,13 @@ package mongo
 import (
 	"context"
 	"sync"
+	"time"
 
+	"github.com/wal-g/wal-g/internal/databases/mongo/client"
 	"github.com/wal-g/wal-g/internal/databases/mongo/stages"
 	"github.com/wal-g/wal-g/utility"
+
+	"github.com/wal-g/tracelog"
 )
 
 // HandleOplogPush starts oplog archiving process: fetch, validate, upload to storage.
@@ -32,3 +36,22 @@ func HandleOplogPush(ctx context.Context, fetcher stages.Fetcher, applier stages
 
 	return utility.WaitFirstError(errs...)
 }
+
+// WaitForPrimary blocks until the node becomes a primary, node state is checked with given interval
+func WaitForPrimary(ctx context.Context, mongoClient client.MongoDriver, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		im, err := mongoClient.IsMaster(ctx)
+		if err != nil {
+			tracelog.WarningLogger.Printf("Can not check if node is a primary: %v", err)
+		} else if im.IsMaster {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package mongo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"github.com/wal-g/tracelog"
+)
+
+// MissingArchivesReason describes oplog range which is not covered by any archive
+const MissingArchivesReason = "oplog archives are missing"
+
+// OplogGap describes oplog range which can not be replayed
+type OplogGap struct {
+	Start  models.Timestamp
+	End    models.Timestamp
+	Reason string
+}
+
+// Duration returns wall clock duration of the gap
+func (gap OplogGap) Duration() time.Duration {
+	return time.Duration(gap.End.TS-gap.Start.TS) * time.Second
+}
+
+// FindOplogGaps returns gap archives with the error recorded by oplog-push and ranges not covered by any archive
+func FindOplogGaps(downloader archive.Downloader, archives []models.Archive) ([]OplogGap, error) {
+	sorted := make([]models.Archive, len(archives))
+	copy(sorted, archives)
+	sort.Slice(sorted, func(i, j int) bool {
+		return models.LessTS(sorted[i].Start, sorted[j].Start)
+	})
+
+	gaps := make([]OplogGap, 0)
+	var coveredTS *models.Timestamp
+	for i := range sorted {
+		arch := sorted[i]
+		if coveredTS != nil && models.LessTS(*coveredTS, arch.Start) {
+			gaps = append(gaps, OplogGap{Start: *coveredTS, End: arch.Start, Reason: MissingArchivesReason})
+		}
+		if arch.Type == models.ArchiveTypeGap {
+			reason, err := gapArchiveReason(downloader, arch)
+			if err != nil {
+				return nil, err
+			}
+			gaps = append(gaps, OplogGap{Start: arch.Start, End: arch.End, Reason: reason})
+		}
+		if coveredTS == nil || models.LessTS(*coveredTS, arch.End) {
+			coveredTS = &sorted[i].End
+		}
+	}
+	return gaps, nil
+}
+
+type gapReasonBuffer struct {
+	bytes.Buffer
+}
+
+func (b *gapReasonBuffer) Close() error {
+	return nil
+}
+
+// gapArchiveReason downloads error recorded in gap archive
+func gapArchiveReason(downloader archive.Downloader, arch models.Archive) (string, error) {
+	buf := &gapReasonBuffer{}
+	if err := downloader.DownloadOplogArchive(arch, buf); err != nil {
+		return "", fmt.Errorf("can not download gap archive %s: %w", arch.Filename(), err)
+	}
+	return buf.String(), nil
+}
+
+// HandleOplogReport prints archiving gaps, so point-in-time recovery coverage can be assessed
+func HandleOplogReport(downloader archive.Downloader, output io.Writer) error {
+	archives, err := downloader.ListOplogArchives()
+	if err != nil {
+		return err
+	}
+	if len(archives) == 0 {
+		tracelog.InfoLogger.Println("No oplog archives found")
+		return nil
+	}
+	gaps, err := FindOplogGaps(downloader, archives)
+	if err != nil {
+		return err
+	}
+
+	firstTS, lastTS := archives[0].Start, archives[0].End
+	for _, arch := range archives {
+		if models.LessTS(arch.Start, firstTS) {
+			firstTS = arch.Start
+		}
+		lastTS = models.MaxTS(lastTS, arch.End)
+	}
+	tracelog.InfoLogger.Printf("Oplog is archived from %v to %v in %d archives with %d gaps",
+		firstTS, lastTS, len(archives), len(gaps))
+	writer := tabwriter.NewWriter(output, 0, 0, 1, ' ', 0)
+	if _, err := fmt.Fprintln(writer, "start_ts\tend_ts\tstart_time\tduration\treason"); err != nil {
+		return err
+	}
+	for _, gap := range gaps {
+		_, err := fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\n", gap.Start, gap.End,
+			time.Unix(int64(gap.Start.TS), 0).UTC().Format(time.RFC3339), gap.Duration(), gap.Reason)
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,37 @@
+package mongo
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	archivemocks "github.com/wal-g/wal-g/internal/databases/mongo/archive/mocks"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleOplogReport(t *testing.T) {
+	gap := purgeTestArchive(150, 200)
+	gap.Type = models.ArchiveTypeGap
+	archives := []models.Archive{purgeTestArchive(300, 400), purgeTestArchive(100, 150), gap, purgeTestArchive(200, 250)}
+	downloader := &archivemocks.Downloader{}
+	downloader.On("ListOplogArchives").Return(archives, nil)
+	downloader.On("DownloadOplogArchive", gap, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		_, _ = args.Get(1).(io.Writer).Write([]byte("oplog is rotated"))
+	})
+
+	gaps, err := FindOplogGaps(downloader, archives)
+	require.NoError(t, err)
+	assert.Equal(t, []OplogGap{
+		{Start: models.Timestamp{TS: 150, Inc: 1}, End: models.Timestamp{TS: 200, Inc: 1}, Reason: "oplog is rotated"},
+		{Start: models.Timestamp{TS: 250, Inc: 1}, End: models.Timestamp{TS: 300, Inc: 1}, Reason: MissingArchivesReason},
+	}, gaps)
+
+	output := &bytes.Buffer{}
+	assert.NoError(t, HandleOplogReport(downloader, output))
+	assert.Contains(t, output.String(), "250.1    300.1  1970-01-01T00:04:10Z 50s      "+MissingArchivesReason)
+	downloader.AssertExpectations(t)
+}
@@ -0,0 +1,316 @@
+package mongo
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+	"github.com/wal-g/wal-g/internal/databases/mongo/client"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"github.com/wal-g/tracelog"
+)
+
+const mongodLockFile = "mongod.lock"
+
+// physicalMetaProvider marks backup as physical, data files are consistent at the given timestamp.
+// All database files are listed, so deltas of the backup can find changed files.
+type physicalMetaProvider struct {
+	archive.MongoMetaProvider
+	consistentTS models.Timestamp
+	files        []archive.PhysicalFile
+}
+
+func (p *physicalMetaProvider) Meta() archive.MongoMeta {
+	meta := p.MongoMetaProvider.Meta()
+	meta.BackupType = archive.PhysicalBackupType
+	meta.After = archive.NodeMeta{LastTS: p.consistentTS, LastMajTS: p.consistentTS}
+	meta.Files = p.files
+	return meta
+}
+
+// physicalBackupSource lists database files which are not changed until release
+type physicalBackupSource struct {
+	dbPath       string
+	files        []archive.PhysicalFile
+	consistentTS models.Timestamp
+	release      func() error
+}
+
+// openPhysicalBackupSource opens backup cursor, node is fsync locked if backup cursor is not supported
+func openPhysicalBackupSource(ctx context.Context, mongoClient client.MongoDriver, dbPath string) (*physicalBackupSource, error) {
+	var files []client.BackupFile
+	source := &physicalBackupSource{dbPath: dbPath}
+	cursor, err := mongoClient.OpenBackupCursor(ctx)
+	if err == nil {
+		tracelog.InfoLogger.Printf("Backup cursor is opened, %d files will be copied", len(cursor.Files()))
+		if cursor.DBPath() != "" {
+			source.dbPath = cursor.DBPath()
+		}
+		files = cursor.Files()
+		source.consistentTS = cursor.OplogEnd()
+		// released with background context, so the node is released even if backup is canceled
+		source.release = func() error { return cursor.Close(context.Background()) }
+	} else {
+		tracelog.WarningLogger.Printf("Backup cursor is not available, node will be fsync locked during backup: %v", err)
+		if dbPath == "" {
+			return nil, fmt.Errorf("dbPath is required to backup files of fsync locked node")
+		}
+		if err := mongoClient.FsyncLock(ctx); err != nil {
+			return nil, err
+		}
+		source.release = func() error { return mongoClient.FsyncUnlock(context.Background()) }
+		if source.consistentTS, _, err = mongoClient.LastWriteTS(ctx); err == nil {
+			files, err = listDBPathFiles(dbPath)
+		}
+		if err != nil {
+			_ = source.release()
+			return nil, err
+		}
+	}
+
+	if source.files, err = describeFiles(source.dbPath, files); err != nil {
+		_ = source.release()
+		return nil, err
+	}
+	return source, nil
+}
+
+// listDBPathFiles lists all regular files of dbPath except lock file
+func listDBPathFiles(dbPath string) ([]client.BackupFile, error) {
+	var files []client.BackupFile
+	err := filepath.Walk(dbPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Name() == mongodLockFile {
+			return nil
+		}
+		files = append(files, client.BackupFile{Path: path, Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can not list dbPath files: %w", err)
+	}
+	return files, nil
+}
+
+// describeFiles stats listed files, names are relative to dbPath
+func describeFiles(dbPath string, files []client.BackupFile) ([]archive.PhysicalFile, error) {
+	described := make([]archive.PhysicalFile, 0, len(files))
+	for _, file := range files {
+		name, err := filepath.Rel(dbPath, file.Path)
+		if err != nil || strings.HasPrefix(name, "..") {
+			return nil, fmt.Errorf("file '%s' is not in dbPath '%s'", file.Path, dbPath)
+		}
+		info, err := os.Stat(file.Path)
+		if err != nil {
+			return nil, err
+		}
+		described = append(described, archive.PhysicalFile{
+			Name:    filepath.ToSlash(name),
+			Size:    file.Size,
+			ModTime: info.ModTime().UTC(),
+		})
+	}
+	return described, nil
+}
+
+// HandlePhysicalBackupPush copies database files into tar stream and uploads it as a physical backup.
+// dbPath is used if node does not report it with backup cursor.
+func HandlePhysicalBackupPush(ctx context.Context, uploader archive.Uploader, metaProvider archive.MongoMetaProvider,
+	mongoClient client.MongoDriver, dbPath string) error {
+	return pushPhysicalBackup(ctx, uploader, metaProvider, mongoClient, dbPath, nil)
+}
+
+// pushPhysicalBackup uploads all database files, or only files changed since base if it is given
+func pushPhysicalBackup(ctx context.Context, uploader archive.Uploader, metaProvider archive.MongoMetaProvider,
+	mongoClient client.MongoDriver, dbPath string, base *archive.Backup) error {
+	if err := metaProvider.Init(); err != nil {
+		return err
+	}
+	source, err := openPhysicalBackupSource(ctx, mongoClient, dbPath)
+	if err != nil {
+		return err
+	}
+	files := source.files
+	if base != nil {
+		files = changedFiles(base.MongoMeta.Files, source.files)
+		tracelog.InfoLogger.Printf("%d of %d files are changed since backup '%s'", len(files), len(source.files), base.BackupName)
+	}
+
+	reader, writer := io.Pipe()
+	waiter := &errWaiter{errc: make(chan error, 1)}
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		err := writeFilesTar(writer, source.dbPath, files)
+		if releaseErr := source.release(); err == nil {
+			err = releaseErr
+		}
+		_ = writer.CloseWithError(err)
+		waiter.errc <- err
+	}()
+	physicalMeta := &physicalMetaProvider{metaProvider, source.consistentTS, source.files}
+	if base != nil {
+		err = uploader.UploadDeltaBackup(reader, waiter, *base, physicalMeta)
+	} else {
+		err = uploader.UploadBackup(reader, waiter, physicalMeta)
+	}
+	// unblocks tar writer if upload failed before reading the whole stream, so the node is released before return
+	_ = reader.CloseWithError(err)
+	<-released
+	return err
+}
+
+// writeFilesTar writes files to tar with paths relative to dbPath, files are copied up to their listed size
+func writeFilesTar(w io.Writer, dbPath string, files []archive.PhysicalFile) error {
+	tw := tar.NewWriter(w)
+	for _, file := range files {
+		path := filepath.Join(dbPath, filepath.FromSlash(file.Name))
+		if err := writeFileToTar(tw, path, file.Name, file.Size); err != nil {
+			return fmt.Errorf("can not copy file '%s': %w", path, err)
+		}
+	}
+	return tw.Close()
+}
+
+func writeFileToTar(tw *tar.Writer, path, name string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Size = size
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, f, size)
+	return err
+}
+
+// HandlePhysicalBackupFetch downloads files of physical backup chain to empty dbPath, mongod should be stopped.
+// Files of each delta backup overwrite files of its base, files which are not listed in the delta are removed.
+func HandlePhysicalBackupFetch(downloader archive.Downloader, chain []archive.Backup, dbPath string) error {
+	if err := os.MkdirAll(dbPath, 0700); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(dbPath)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("dbPath '%s' is not empty", dbPath)
+	}
+
+	for i, backup := range chain {
+		if !backup.IsPhysical() {
+			return fmt.Errorf("backup '%s' is not physical", backup.BackupName)
+		}
+		isDelta := i > 0
+		if isDelta {
+			if len(backup.MongoMeta.Files) == 0 {
+				return fmt.Errorf("delta backup '%s' does not list database files", backup.BackupName)
+			}
+			tracelog.InfoLogger.Printf("Applying delta backup '%s'", backup.BackupName)
+		}
+		if err := fetchPhysicalBackupFiles(downloader, backup, dbPath, isDelta); err != nil {
+			return fmt.Errorf("can not extract backup '%s': %w", backup.BackupName, err)
+		}
+		if isDelta {
+			if err := removeUnlistedFiles(dbPath, backup.MongoMeta.Files); err != nil {
+				return err
+			}
+		}
+	}
+	last := chain[len(chain)-1]
+	tracelog.InfoLogger.Printf("Backup '%s' is extracted to '%s', data is consistent at '%s'",
+		last.BackupName, dbPath, last.MongoMeta.After.LastMajTS)
+	return nil
+}
+
+func fetchPhysicalBackupFiles(downloader archive.Downloader, backup archive.Backup, dbPath string, overwrite bool) error {
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(downloader.DownloadBackupStream(backup.BackupName, writer))
+	}()
+	defer func() { _ = reader.Close() }()
+	return extractFilesTar(reader, dbPath, overwrite)
+}
+
+// removeUnlistedFiles removes files of dbPath which were deleted before delta backup was made
+func removeUnlistedFiles(dbPath string, files []archive.PhysicalFile) error {
+	listed := make(map[string]bool, len(files))
+	for _, file := range files {
+		listed[file.Name] = true
+	}
+	return filepath.Walk(dbPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		name, err := filepath.Rel(dbPath, path)
+		if err != nil {
+			return err
+		}
+		if listed[filepath.ToSlash(name)] {
+			return nil
+		}
+		tracelog.DebugLogger.Printf("Removing '%s', it is deleted in delta backup", path)
+		return os.Remove(path)
+	})
+}
+
+// extractFilesTar writes files from tar to dbPath, existing files are replaced only if overwrite is set
+func extractFilesTar(r io.Reader, dbPath string, overwrite bool) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dbPath, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dbPath)+string(os.PathSeparator)) {
+			return fmt.Errorf("file '%s' is out of dbPath", header.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		if err := extractFile(tr, path, header, overwrite); err != nil {
+			return err
+		}
+	}
+}
+
+func extractFile(r io.Reader, path string, header *tar.Header, overwrite bool) error {
+	flags := os.O_CREATE | os.O_EXCL | os.O_WRONLY
+	if overwrite {
+		flags = os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	}
+	f, err := os.OpenFile(path, flags, os.FileMode(header.Mode).Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,210 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+	archivemocks "github.com/wal-g/wal-g/internal/databases/mongo/archive/mocks"
+	clientmocks "github.com/wal-g/wal-g/internal/databases/mongo/client/mocks"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPhysicalBackupPushAndFetch_FsyncLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "physical_backup")
+	assert.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	dbPath, restorePath := filepath.Join(dir, "db"), filepath.Join(dir, "restore")
+	assert.NoError(t, os.MkdirAll(filepath.Join(dbPath, "journal"), 0700))
+	files := map[string]string{
+		"collection-1.wt":          "collection data",
+		"WiredTiger":               "WiredTiger 3.2.1",
+		"journal/WiredTigerLog.01": "journal",
+	}
+	for name, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dbPath, name), []byte(content), 0600))
+	}
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dbPath, mongodLockFile), []byte("1"), 0600))
+
+	lockTS := models.Timestamp{TS: 1579002001, Inc: 1}
+	mongoClient := &clientmocks.MongoDriver{}
+	mongoClient.On("OpenBackupCursor", mock.Anything).Return(nil, fmt.Errorf("unrecognized pipeline stage"))
+	mongoClient.On("FsyncLock", mock.Anything).Return(nil).Once()
+	mongoClient.On("LastWriteTS", mock.Anything).Return(lockTS, lockTS, nil)
+	mongoClient.On("FsyncUnlock", mock.Anything).Return(nil).Once()
+
+	metaProvider := &archivemocks.MongoMetaProvider{}
+	metaProvider.On("Init").Return(nil)
+	metaProvider.On("Meta").Return(archive.MongoMeta{Before: archive.NodeMeta{LastMajTS: models.Timestamp{TS: 1579002000, Inc: 1}}})
+
+	var stream bytes.Buffer
+	var backupMeta archive.MongoMeta
+	uploader := &archivemocks.Uploader{}
+	uploader.On("UploadBackup", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			_, err := stream.ReadFrom(args.Get(0).(io.Reader))
+			assert.NoError(t, err)
+			assert.NoError(t, args.Get(1).(archive.ErrWaiter).Wait())
+			backupMeta = args.Get(2).(archive.MongoMetaProvider).Meta()
+		}).Return(nil)
+
+	err = HandlePhysicalBackupPush(context.TODO(), uploader, metaProvider, mongoClient, dbPath)
+	assert.NoError(t, err)
+	mongoClient.AssertExpectations(t)
+	assert.Equal(t, archive.PhysicalBackupType, backupMeta.BackupType)
+	assert.Equal(t, lockTS, backupMeta.After.LastMajTS)
+
+	backup := archive.Backup{BackupName: "stream_1", MongoMeta: backupMeta}
+	downloader := &archivemocks.Downloader{}
+	downloader.On("DownloadBackupStream", "stream_1", mock.Anything).
+		Run(func(args mock.Arguments) {
+			_, err := args.Get(1).(io.Writer).Write(stream.Bytes())
+			assert.NoError(t, err)
+		}).Return(nil)
+
+	assert.NoError(t, HandlePhysicalBackupFetch(downloader, []archive.Backup{backup}, restorePath))
+	for name, content := range files {
+		data, err := ioutil.ReadFile(filepath.Join(restorePath, name))
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(data))
+	}
+	_, err = os.Stat(filepath.Join(restorePath, mongodLockFile))
+	assert.True(t, os.IsNotExist(err))
+
+	// dbPath must be empty
+	assert.Error(t, HandlePhysicalBackupFetch(downloader, []archive.Backup{backup}, restorePath))
+}
+
+func TestPhysicalBackupPush_UploadFailureUnlocksNode(t *testing.T) {
+	dbPath, err := ioutil.TempDir("", "physical_backup")
+	assert.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dbPath) }()
+	// larger than pipe can pass without reader
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dbPath, "collection-1.wt"), make([]byte, 1<<20), 0600))
+
+	lockTS := models.Timestamp{TS: 1579002001, Inc: 1}
+	mongoClient := &clientmocks.MongoDriver{}
+	mongoClient.On("OpenBackupCursor", mock.Anything).Return(nil, fmt.Errorf("unrecognized pipeline stage"))
+	mongoClient.On("FsyncLock", mock.Anything).Return(nil).Once()
+	mongoClient.On("LastWriteTS", mock.Anything).Return(lockTS, lockTS, nil)
+	mongoClient.On("FsyncUnlock", mock.Anything).Return(nil).Once()
+
+	metaProvider := &archivemocks.MongoMetaProvider{}
+	metaProvider.On("Init").Return(nil)
+	uploader := &archivemocks.Uploader{}
+	uploader.On("UploadBackup", mock.Anything, mock.Anything, mock.Anything).Return(fmt.Errorf("storage is unavailable"))
+
+	err = HandlePhysicalBackupPush(context.TODO(), uploader, metaProvider, mongoClient, dbPath)
+	assert.EqualError(t, err, "storage is unavailable")
+	mongoClient.AssertExpectations(t)
+}
+
+func TestDeltaBackupPushAndFetch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delta_backup")
+	assert.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	dbPath, restorePath := filepath.Join(dir, "db"), filepath.Join(dir, "restore")
+	assert.NoError(t, os.MkdirAll(dbPath, 0700))
+	writeFiles := func(files map[string]string) {
+		for name, content := range files {
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dbPath, name), []byte(content), 0600))
+		}
+	}
+	writeFiles(map[string]string{
+		"collection-1.wt": "collection data",
+		"collection-2.wt": "dropped collection",
+		"WiredTiger":      "WiredTiger 3.2.1",
+	})
+
+	lockTS := models.Timestamp{TS: 1579002001, Inc: 1}
+	mongoClient := &clientmocks.MongoDriver{}
+	mongoClient.On("OpenBackupCursor", mock.Anything).Return(nil, fmt.Errorf("unrecognized pipeline stage"))
+	mongoClient.On("FsyncLock", mock.Anything).Return(nil)
+	mongoClient.On("LastWriteTS", mock.Anything).Return(lockTS, lockTS, nil)
+	mongoClient.On("FsyncUnlock", mock.Anything).Return(nil)
+
+	metaProvider := &archivemocks.MongoMetaProvider{}
+	metaProvider.On("Init").Return(nil)
+	metaProvider.On("Meta").Return(archive.MongoMeta{})
+
+	streams := map[string]*bytes.Buffer{}
+	var backups []archive.Backup
+	upload := func(name string, args mock.Arguments, metaArg int) {
+		streams[name] = &bytes.Buffer{}
+		_, err := streams[name].ReadFrom(args.Get(0).(io.Reader))
+		assert.NoError(t, err)
+		assert.NoError(t, args.Get(1).(archive.ErrWaiter).Wait())
+		backups = append(backups, archive.Backup{BackupName: name, MongoMeta: args.Get(metaArg).(archive.MongoMetaProvider).Meta()})
+	}
+	uploader := &archivemocks.Uploader{}
+	uploader.On("UploadBackup", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { upload("stream_1", args, 2) }).Return(nil)
+	assert.NoError(t, HandlePhysicalBackupPush(context.TODO(), uploader, metaProvider, mongoClient, dbPath))
+
+	// mtime may have coarse resolution, so changed file is also resized
+	writeFiles(map[string]string{"collection-1.wt": "collection data changed", "collection-3.wt": "new collection"})
+	assert.NoError(t, os.Remove(filepath.Join(dbPath, "collection-2.wt")))
+
+	downloader := &archivemocks.Downloader{}
+	downloader.On("ListBackupNames").Return([]internal.BackupTime{{BackupName: "stream_1"}}, nil)
+	downloader.On("LoadBackups", []string{"stream_1"}).Return(func([]string) []archive.Backup { return backups }, nil)
+	uploader.On("UploadDeltaBackup", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			assert.Equal(t, "stream_1", args.Get(2).(archive.Backup).BackupName)
+			upload("stream_2", args, 3)
+		}).Return(nil)
+	assert.NoError(t, HandleDeltaBackupPush(context.TODO(), downloader, uploader, metaProvider, mongoClient, dbPath))
+	assert.Len(t, backups, 2)
+	assert.Len(t, backups[1].MongoMeta.Files, 3)
+	// unchanged files are not copied
+	assert.False(t, bytes.Contains(streams["stream_2"].Bytes(), []byte("WiredTiger 3.2.1")))
+	backups[1].IncrementFrom = "stream_1"
+
+	for name, stream := range streams {
+		data := stream.Bytes()
+		downloader.On("DownloadBackupStream", name, mock.Anything).
+			Run(func(args mock.Arguments) {
+				_, err := args.Get(1).(io.Writer).Write(data)
+				assert.NoError(t, err)
+			}).Return(nil)
+	}
+	assert.NoError(t, HandlePhysicalBackupFetch(downloader, backups, restorePath))
+	for name, content := range map[string]string{
+		"collection-1.wt": "collection data changed",
+		"collection-3.wt": "new collection",
+		"WiredTiger":      "WiredTiger 3.2.1",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(restorePath, name))
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(data))
+	}
+	_, err = os.Stat(filepath.Join(restorePath, "collection-2.wt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestChangedFiles(t *testing.T) {
+	modTime := time.Unix(1579002000, 0)
+	base := []archive.PhysicalFile{
+		{Name: "a.wt", Size: 1, ModTime: modTime},
+		{Name: "b.wt", Size: 1, ModTime: modTime},
+		{Name: "c.wt", Size: 1, ModTime: modTime},
+	}
+	files := []archive.PhysicalFile{
+		{Name: "a.wt", Size: 1, ModTime: modTime},
+		{Name: "b.wt", Size: 1, ModTime: modTime.Add(time.Second)},
+		{Name: "c.wt", Size: 2, ModTime: modTime},
+		{Name: "d.wt", Size: 1, ModTime: modTime},
+	}
+	assert.Equal(t, files[1:], changedFiles(base, files))
+}
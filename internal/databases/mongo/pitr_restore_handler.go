@@ -0,0 +1,77 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+	"github.com/wal-g/wal-g/internal/databases/mongo/stages"
+
+	"github.com/wal-g/tracelog"
+)
+
+// FindPITRBackup returns the latest logical backup which was finished before target timestamp.
+// Physical backups are skipped: they are restored to files of stopped mongod, so oplog can not be replayed after them.
+func FindPITRBackup(downloader archive.Downloader, target models.Timestamp) (archive.Backup, error) {
+	backupTimes, err := downloader.ListBackupNames()
+	if err != nil {
+		return archive.Backup{}, fmt.Errorf("can not list backups: %w", err)
+	}
+	backups, err := downloader.LoadBackups(archive.BackupNamesFromBackupTimes(backupTimes))
+	if err != nil {
+		return archive.Backup{}, fmt.Errorf("can not load backups: %w", err)
+	}
+
+	var found *archive.Backup
+	for i := range backups {
+		if backups[i].IsPhysical() {
+			continue
+		}
+		finishTS := backups[i].ConsistentTS()
+		if models.LessTS(target, finishTS) {
+			continue
+		}
+		if found == nil || models.LessTS(found.ConsistentTS(), finishTS) {
+			found = &backups[i]
+		}
+	}
+	if found == nil {
+		return archive.Backup{}, fmt.Errorf("can not find logical backup finished before target timestamp '%s'", target)
+	}
+	return *found, nil
+}
+
+// HandlePITRRestore restores the latest backup before target timestamp and replays oplog archives up to it.
+// Oplog coverage is checked before the backup is fetched.
+func HandlePITRRestore(ctx context.Context,
+	target models.Timestamp,
+	downloader archive.Downloader,
+	fetchBackup func(backupName string) error,
+	applier stages.Applier,
+	fetcherOpts ...stages.StorageFetcherOption) error {
+
+	backup, err := FindPITRBackup(downloader, target)
+	if err != nil {
+		return err
+	}
+	since := backup.ConsistentTS()
+	tracelog.InfoLogger.Printf("Backup '%s' is chosen to restore, oplog will be replayed from '%s' to '%s'",
+		backup.BackupName, since, target)
+
+	archives, err := downloader.ListOplogArchivesBetween(since, target)
+	if err != nil {
+		return err
+	}
+	path, err := archive.SequenceBetweenTS(archives, since, target)
+	if err != nil {
+		return fmt.Errorf("oplog archives do not cover range from '%s' to '%s': %w", since, target, err)
+	}
+
+	if err := fetchBackup(backup.BackupName); err != nil {
+		return fmt.Errorf("can not fetch backup '%s': %w", backup.BackupName, err)
+	}
+	tracelog.InfoLogger.Printf("Backup '%s' is restored, replaying oplog", backup.BackupName)
+
+	return HandleOplogReplay(ctx, since, target, stages.NewStorageFetcher(downloader, path, fetcherOpts...), applier)
+}
@@ -0,0 +1,83 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+	archivemocks "github.com/wal-g/wal-g/internal/databases/mongo/archive/mocks"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func pitrTestBackup(name string, finishTS uint32) archive.Backup {
+	return archive.Backup{
+		BackupName: name,
+		MongoMeta: archive.MongoMeta{
+			After: archive.NodeMeta{LastMajTS: models.Timestamp{TS: finishTS, Inc: 1}},
+		},
+	}
+}
+
+func pitrTestDownloader(backups ...archive.Backup) *archivemocks.Downloader {
+	downloader := &archivemocks.Downloader{}
+	backupTimes := make([]internal.BackupTime, 0, len(backups))
+	names := make([]string, 0, len(backups))
+	for _, backup := range backups {
+		backupTimes = append(backupTimes, internal.BackupTime{BackupName: backup.BackupName})
+		names = append(names, backup.BackupName)
+	}
+	downloader.On("ListBackupNames").Return(backupTimes, nil)
+	downloader.On("LoadBackups", names).Return(backups, nil)
+	return downloader
+}
+
+func TestFindPITRBackup(t *testing.T) {
+	downloader := pitrTestDownloader(
+		pitrTestBackup("stream_1", 100),
+		pitrTestBackup("stream_3", 300),
+		pitrTestBackup("stream_2", 200),
+	)
+
+	backup, err := FindPITRBackup(downloader, models.Timestamp{TS: 250, Inc: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "stream_2", backup.BackupName)
+
+	backup, err = FindPITRBackup(downloader, models.Timestamp{TS: 300, Inc: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "stream_3", backup.BackupName)
+
+	_, err = FindPITRBackup(downloader, models.Timestamp{TS: 50, Inc: 1})
+	assert.Error(t, err)
+	downloader.AssertExpectations(t)
+}
+
+func TestFindPITRBackup_SkipsPhysicalBackups(t *testing.T) {
+	physical := pitrTestBackup("stream_2", 200)
+	physical.MongoMeta.BackupType = archive.PhysicalBackupType
+	downloader := pitrTestDownloader(pitrTestBackup("stream_1", 100), physical)
+
+	backup, err := FindPITRBackup(downloader, models.Timestamp{TS: 250, Inc: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "stream_1", backup.BackupName)
+}
+
+func TestHandlePITRRestore_ChecksOplogCoverageBeforeFetch(t *testing.T) {
+	downloader := pitrTestDownloader(pitrTestBackup("stream_1", 100))
+	downloader.On("ListOplogArchivesBetween",
+		models.Timestamp{TS: 100, Inc: 1}, models.Timestamp{TS: 250, Inc: 1}).Return([]models.Archive{
+		{Start: models.Timestamp{TS: 200, Inc: 1}, End: models.Timestamp{TS: 300, Inc: 1}, Ext: "lz4", Type: models.ArchiveTypeOplog},
+	}, nil)
+
+	fetched := false
+	err := HandlePITRRestore(context.Background(), models.Timestamp{TS: 250, Inc: 1}, downloader,
+		func(backupName string) error {
+			fetched = true
+			return nil
+		}, nil)
+	assert.Error(t, err)
+	assert.False(t, fetched)
+	downloader.AssertExpectations(t)
+}
@@ -0,0 +1,111 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+	"github.com/wal-g/wal-g/internal/databases/mongo/client"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+	"github.com/wal-g/wal-g/internal/databases/mongo/oplog"
+	"github.com/wal-g/wal-g/internal/databases/mongo/stages"
+	"github.com/wal-g/wal-g/utility"
+
+	"github.com/wal-g/tracelog"
+)
+
+// SeedReplicaSettings defines the member to seed
+type SeedReplicaSettings struct {
+	Host      string
+	Delay     time.Duration
+	OplogSize int64
+}
+
+// lastOpApplier keeps the last applied oplog record
+type lastOpApplier struct {
+	oplog.Applier
+	last []byte
+}
+
+func (a *lastOpApplier) Apply(ctx context.Context, op models.Oplog) error {
+	if err := a.Applier.Apply(ctx, op); err != nil {
+		return err
+	}
+	a.last = append(a.last[:0], op.Data...)
+	return nil
+}
+
+// SeedTargetTS returns timestamp to replay oplog to for a member delayed by given duration.
+// It is the newest archived timestamp if archives are already older than the delay.
+func SeedTargetTS(lastArchivedTS models.Timestamp, now time.Time, delay time.Duration) models.Timestamp {
+	target := models.Timestamp{TS: uint32(now.Add(-delay).Unix()), Inc: 0}
+	if models.LessTS(lastArchivedTS, target) {
+		return lastArchivedTS
+	}
+	return target
+}
+
+// ReplSetAddCommand builds mongo shell command which adds hidden delayed member to the replica set of the backup
+func ReplSetAddCommand(backup archive.Backup, host string, delay time.Duration) (string, error) {
+	if backup.MongoMeta.ReplSetName == "" {
+		return "", fmt.Errorf("replica set of backup '%s' is unknown", backup.BackupName)
+	}
+	// slaveDelay is renamed to secondaryDelaySecs in 5.0
+	delayField := "slaveDelay"
+	if major, err := strconv.Atoi(strings.Split(backup.MongoMeta.Version, ".")[0]); err == nil && major >= 5 {
+		delayField = "secondaryDelaySecs"
+	}
+	return fmt.Sprintf(`rs.add({host: "%s", priority: 0, hidden: true, votes: 0, %s: %d})`,
+		host, delayField, int64(delay.Seconds())), nil
+}
+
+// HandleSeedReplica restores standalone node to the state delayed from the newest archived oplog,
+// seeds its oplog with the last replayed record and prints instructions to add it to the replica set of the backup.
+func HandleSeedReplica(ctx context.Context,
+	downloader archive.Downloader,
+	mongoClient client.MongoDriver,
+	applier oplog.Applier,
+	fetchBackup func(backupName string) error,
+	settings SeedReplicaSettings,
+	output io.Writer,
+	fetcherOpts ...stages.StorageFetcherOption) error {
+
+	lastArchivedTS, err := downloader.LastKnownArchiveTS()
+	if err != nil {
+		return err
+	}
+	target := SeedTargetTS(lastArchivedTS, utility.TimeNowCrossPlatformUTC(), settings.Delay)
+	if target == lastArchivedTS {
+		tracelog.WarningLogger.Printf("Newest archived timestamp '%s' is older than delay, replaying to it", target)
+	}
+
+	// physical backups are skipped, oplog is replayed to the restored node only after logical backup
+	backup, err := FindPITRBackup(downloader, target)
+	if err != nil {
+		return err
+	}
+	addCommand, err := ReplSetAddCommand(backup, settings.Host, settings.Delay)
+	if err != nil {
+		return err
+	}
+
+	recorder := &lastOpApplier{Applier: applier}
+	if err := HandlePITRRestore(ctx, target, downloader, fetchBackup, stages.NewGenericApplier(recorder), fetcherOpts...); err != nil {
+		return err
+	}
+	if recorder.last == nil {
+		return fmt.Errorf("no oplog records are replayed after backup '%s', oplog can not be seeded", backup.BackupName)
+	}
+	if err := mongoClient.SeedOplog(ctx, settings.OplogSize, recorder.last); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(output, "Node is restored to '%s' and its oplog is seeded.\n"+
+		"Restart it with --replSet %s option and run on the primary:\n%s\n",
+		target, backup.MongoMeta.ReplSetName, addCommand)
+	return err
+}
@@ -0,0 +1,56 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeedTargetTS(t *testing.T) {
+	now := time.Unix(1579010000, 0)
+
+	lastArchivedTS := models.Timestamp{TS: 1579009990, Inc: 3}
+	assert.Equal(t, models.Timestamp{TS: 1579006400}, SeedTargetTS(lastArchivedTS, now, time.Hour))
+
+	lastArchivedTS = models.Timestamp{TS: 1579000000, Inc: 3}
+	assert.Equal(t, lastArchivedTS, SeedTargetTS(lastArchivedTS, now, time.Hour))
+}
+
+func TestReplSetAddCommand(t *testing.T) {
+	backup := archive.Backup{BackupName: "stream_1", MongoMeta: archive.MongoMeta{ReplSetName: "rs01", Version: "4.2.8"}}
+	cmd, err := ReplSetAddCommand(backup, "host4:27017", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, `rs.add({host: "host4:27017", priority: 0, hidden: true, votes: 0, slaveDelay: 3600})`, cmd)
+
+	backup.MongoMeta.Version = "5.0.2"
+	cmd, err = ReplSetAddCommand(backup, "host4:27017", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, `rs.add({host: "host4:27017", priority: 0, hidden: true, votes: 0, secondaryDelaySecs: 3600})`, cmd)
+
+	backup.MongoMeta.ReplSetName = ""
+	_, err = ReplSetAddCommand(backup, "host4:27017", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestHandleSeedReplica_SkipsPhysicalBackups(t *testing.T) {
+	physical := pitrTestBackup("stream_1", 100)
+	physical.MongoMeta.BackupType = archive.PhysicalBackupType
+	physical.MongoMeta.ReplSetName = "rs01"
+	downloader := pitrTestDownloader(physical)
+	downloader.On("LastKnownArchiveTS").Return(models.Timestamp{TS: 200, Inc: 1}, nil)
+
+	fetched := false
+	err := HandleSeedReplica(context.Background(), downloader, nil, nil,
+		func(backupName string) error {
+			fetched = true
+			return nil
+		}, SeedReplicaSettings{Host: "host4:27017", Delay: time.Hour}, &bytes.Buffer{})
+	assert.Error(t, err)
+	assert.False(t, fetched)
+}
@@ -3,9 +3,11 @@ package stages
 import (
 	"context"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 
+	"github.com/wal-g/wal-g/internal/compression"
 	"github.com/wal-g/wal-g/internal/databases/mongo/archive"
 	"github.com/wal-g/wal-g/internal/databases/mongo/models"
 	"github.com/wal-g/wal-g/internal/databases/mongo/oplog"
@@ -57,22 +59,115 @@ func (dba *GenericApplier) Apply(ctx context.Context, ch chan *models.Oplog, wg
 
 // StorageApplier implements Applier interface for storage.
 type StorageApplier struct {
-	uploader     archive.Uploader
-	buf          Buffer
-	size         int
-	timeout      time.Duration
-	statsUpdater stats.OplogUploadStatsUpdater
+	uploader       archive.Uploader
+	buf            Buffer
+	size           int
+	timeout        time.Duration
+	statsUpdater   stats.OplogUploadStatsUpdater
+	compressedSize int
+	compressor     compression.Compressor
+}
+
+// StorageApplierOption configures StorageApplier
+type StorageApplierOption func(*StorageApplier)
+
+// ArchiveAfterCompressedSize enables archive upload when archive compressed with compressor reaches size.
+// Records are compressed while they are buffered and uploaded without recompression, so compressor must be
+// the compressor of uploader. Compressed data is flushed periodically to be counted, so archive may be a bit larger.
+func ArchiveAfterCompressedSize(size int, compressor compression.Compressor) StorageApplierOption {
+	return func(sa *StorageApplier) {
+		sa.compressedSize = size
+		sa.compressor = compressor
+	}
 }
 
 // NewStorageApplier builds StorageApplier.
-// TODO: switch to functional options
-func NewStorageApplier(uploader archive.Uploader, buf Buffer, archiveAfterSize int, archiveTimeout time.Duration, statsUpdater stats.OplogUploadStatsUpdater) *StorageApplier {
-	return &StorageApplier{uploader, buf, archiveAfterSize, archiveTimeout, statsUpdater}
+func NewStorageApplier(uploader archive.Uploader, buf Buffer, archiveAfterSize int, archiveTimeout time.Duration, statsUpdater stats.OplogUploadStatsUpdater, opts ...StorageApplierOption) *StorageApplier {
+	sa := &StorageApplier{uploader: uploader, buf: buf, size: archiveAfterSize, timeout: archiveTimeout, statsUpdater: statsUpdater}
+	for _, opt := range opts {
+		opt(sa)
+	}
+	return sa
+}
+
+// compressedFlushSize is the amount of raw data after which compressed data is flushed to be counted
+const compressedFlushSize = 64 << 10
+
+type flusher interface {
+	Flush() error
+}
+
+// archiveWriter writes oplog records to buffer, records are compressed if compressor is set
+type archiveWriter struct {
+	buf        Buffer
+	compressor compression.Compressor
+	writer     io.WriteCloser
+	rawSize    int
+	unflushed  int
+}
+
+func (w *archiveWriter) Write(p []byte) (int, error) {
+	if w.compressor == nil {
+		n, err := w.buf.Write(p)
+		w.rawSize += n
+		return n, err
+	}
+	if w.writer == nil {
+		w.writer = w.compressor.NewWriter(w.buf)
+	}
+	n, err := w.writer.Write(p)
+	w.rawSize += n
+	w.unflushed += n
+	if f, ok := w.writer.(flusher); ok && err == nil && w.unflushed >= compressedFlushSize {
+		w.unflushed = 0
+		err = f.Flush()
+	}
+	return n, err
+}
+
+// Finish completes compressed stream of written records
+func (w *archiveWriter) Finish() error {
+	if w.writer == nil {
+		return nil
+	}
+	err := w.writer.Close()
+	w.writer = nil
+	return err
+}
+
+// Reset drops written records
+func (w *archiveWriter) Reset() error {
+	if err := w.Finish(); err != nil {
+		return err
+	}
+	w.rawSize = 0
+	w.unflushed = 0
+	return w.buf.Reset()
+}
+
+// upload passes buffered archive to uploader, compressed archive is not compressed again
+func (sa *StorageApplier) upload(aw *archiveWriter, firstTS, lastTS models.Timestamp) error {
+	if err := aw.Finish(); err != nil {
+		return fmt.Errorf("can not compress archive: %w", err)
+	}
+	bufReader, err := sa.buf.Reader()
+	if err != nil {
+		return fmt.Errorf("can not get reader from buffer: %w", err)
+	}
+	if aw.compressor != nil {
+		return sa.uploader.UploadCompressedOplogArchive(bufReader, firstTS, lastTS)
+	}
+	return sa.uploader.UploadOplogArchive(bufReader, firstTS, lastTS)
 }
 
 // Apply runs working cycle that sends oplog records to storage.
 func (sa *StorageApplier) Apply(ctx context.Context, oplogc chan *models.Oplog, wg *sync.WaitGroup) (chan error, error) {
 	archiveTimer := time.NewTimer(sa.timeout)
+	validator := NewOplogValidator()
+	aw := &archiveWriter{buf: sa.buf}
+	if sa.compressedSize > 0 {
+		aw.compressor = sa.compressor
+	}
 	var lastKnownTS, batchStartTs models.Timestamp
 	restartBatch := true
 	batchDocs := 0
@@ -83,6 +178,7 @@ func (sa *StorageApplier) Apply(ctx context.Context, oplogc chan *models.Oplog,
 		defer wg.Done()
 		defer close(errc)
 		defer archiveTimer.Stop()
+		defer func() { _ = aw.Finish() }()
 		for oplogc != nil {
 			select {
 			case op, ok := <-oplogc:
@@ -90,43 +186,45 @@ func (sa *StorageApplier) Apply(ctx context.Context, oplogc chan *models.Oplog,
 					oplogc = nil
 					break
 				}
+				// out-of-order or corrupted records must not be uploaded, current batch is rejected
+				if err := validator.Validate(op); err != nil {
+					errc <- fmt.Errorf("oplog validation failed: %w", err)
+					return
+				}
 				if restartBatch {
 					batchStartTs = op.TS
 					restartBatch = false
 				}
 				lastKnownTS = op.TS
-				if _, err := sa.buf.Write(op.Data); err != nil {
+				if _, err := aw.Write(op.Data); err != nil {
 					errc <- fmt.Errorf("can not write op to buffer: %w", err)
 					return
 				}
 				batchDocs++
 				models.PutOplogEntry(op)
-				if sa.buf.Len() < sa.size {
+				if aw.compressor != nil && sa.buf.Len() >= sa.compressedSize {
+					tracelog.DebugLogger.Println("Initializing archive upload due to compressed archive size")
+				} else if aw.rawSize < sa.size {
 					continue
+				} else {
+					tracelog.DebugLogger.Println("Initializing archive upload due to archive size")
 				}
-				tracelog.DebugLogger.Println("Initializing archive upload due to archive size")
 
 			case <-archiveTimer.C:
 				tracelog.DebugLogger.Println("Initializing archive upload due to timeout expired")
 			}
 
 			utility.ResetTimer(archiveTimer, sa.timeout)
-			batchSize = sa.buf.Len()
+			batchSize = aw.rawSize
 			if batchSize == 0 {
 				continue
 			}
 
-			bufReader, err := sa.buf.Reader()
-			if err != nil {
-				errc <- fmt.Errorf("can not get reader from buffer: %w", err)
-				return
-			}
-
 			// TODO: move upload to the next stage, batch accumulation should not be blocked by upload
 			// or switch to PushStreamToDestination (async api):
 			// we don't know archive name beforehand, so upload stream and rename key (it leads to failures and require gc)
 			// but consumes less memory
-			if err := sa.uploader.UploadOplogArchive(bufReader, batchStartTs, lastKnownTS); err != nil {
+			if err := sa.upload(aw, batchStartTs, lastKnownTS); err != nil {
 				errc <- fmt.Errorf("can not upload oplog archive: %w", err)
 				return
 			}
@@ -134,7 +232,7 @@ func (sa *StorageApplier) Apply(ctx context.Context, oplogc chan *models.Oplog,
 				sa.statsUpdater.Update(batchDocs, batchSize, lastKnownTS)
 			}
 			batchDocs = 0
-			if err := sa.buf.Reset(); err != nil {
+			if err := aw.Reset(); err != nil {
 				errc <- fmt.Errorf("can not reset buffer for reuse: %w", err)
 				return
 			}
@@ -1,16 +1,21 @@
 package stages
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"math/rand"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/wal-g/wal-g/internal/compression/lz4"
 	archiveMocks "github.com/wal-g/wal-g/internal/databases/mongo/archive/mocks"
 	"github.com/wal-g/wal-g/internal/databases/mongo/models"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 // TODO: test archive timeout
@@ -191,3 +196,46 @@ func TestStorageApplier_Apply(t *testing.T) {
 		})
 	}
 }
+
+func TestStorageApplier_ApplyCompressedSize(t *testing.T) {
+	rnd := rand.New(rand.NewSource(0))
+	var records [][]byte
+	for i := 0; i < 8; i++ {
+		data := make([]byte, compressedFlushSize/4)
+		rnd.Read(data)
+		records = append(records, data)
+	}
+
+	// records are compressed once by applier, so archive is uploaded without recompression
+	uploaded := func(records [][]byte) func(args mock.Arguments) {
+		return func(args mock.Arguments) {
+			var data bytes.Buffer
+			assert.NoError(t, lz4.Decompressor{}.Decompress(&data, args.Get(0).(io.Reader)))
+			assert.Equal(t, bytes.Join(records, nil), data.Bytes())
+		}
+	}
+	uploader := &archiveMocks.Uploader{}
+	uploader.On("UploadCompressedOplogArchive", mock.Anything,
+		models.Timestamp{TS: 1579002001, Inc: 1},
+		models.Timestamp{TS: 1579002004, Inc: 1}).
+		Run(uploaded(records[:4])).Return(nil).Once()
+	uploader.On("UploadCompressedOplogArchive", mock.Anything,
+		models.Timestamp{TS: 1579002004, Inc: 1},
+		models.Timestamp{TS: 1579002008, Inc: 1}).
+		Run(uploaded(records[4:])).Return(nil).Once()
+
+	// incompressible records, compressed data is flushed and counted every 4 records
+	sa := NewStorageApplier(uploader, NewMemoryBuffer(), 1<<30, time.Hour, nil,
+		ArchiveAfterCompressedSize(compressedFlushSize-1024, lz4.Compressor{}))
+	oplogc := make(chan *models.Oplog)
+	errc, err := sa.Apply(context.TODO(), oplogc, &sync.WaitGroup{})
+	assert.Nil(t, err)
+
+	for i, data := range records {
+		oplogc <- &models.Oplog{TS: models.Timestamp{TS: 1579002001 + uint32(i), Inc: 1}, Data: data}
+	}
+	close(oplogc)
+
+	assert.Nil(t, <-errc)
+	uploader.AssertExpectations(t)
+}
@@ -54,18 +54,46 @@ type BetweenFetcher interface {
 
 // CursorMajFetcher implements Fetcher interface for mongodb
 type CursorMajFetcher struct {
-	db         client.MongoDriver
-	cur        client.OplogCursor
-	lwInterval time.Duration
+	db             client.MongoDriver
+	cur            client.OplogCursor
+	lwInterval     time.Duration
+	fromSecondary  bool
+	stopOnStepdown bool
+	steppedDown    bool
+}
+
+// CursorMajFetcherOption configures CursorMajFetcher
+type CursorMajFetcherOption func(*CursorMajFetcher)
+
+// ReadFromSecondary allows fetching from secondary members and resuming from another member
+// if cursor fails, e.g. when the member becomes unavailable.
+func ReadFromSecondary() CursorMajFetcherOption {
+	return func(dbf *CursorMajFetcher) {
+		dbf.fromSecondary = true
+	}
+}
+
+// StopOnStepdown stops fetching without error when the node is not a primary anymore,
+// so records fetched before stepdown can be archived. Check SteppedDown after fetching is finished.
+func StopOnStepdown() CursorMajFetcherOption {
+	return func(dbf *CursorMajFetcher) {
+		dbf.stopOnStepdown = true
+	}
 }
 
 // NewCursorMajFetcher builds CursorMajFetcher with given args.
-func NewCursorMajFetcher(m client.MongoDriver, cur client.OplogCursor, LWUpdateInterval time.Duration) *CursorMajFetcher {
-	return &CursorMajFetcher{m, cur, LWUpdateInterval}
+func NewCursorMajFetcher(m client.MongoDriver, cur client.OplogCursor, LWUpdateInterval time.Duration, opts ...CursorMajFetcherOption) *CursorMajFetcher {
+	dbf := &CursorMajFetcher{db: m, cur: cur, lwInterval: LWUpdateInterval}
+	for _, opt := range opts {
+		opt(dbf)
+	}
+	return dbf
 }
 
+const maxCursorFailovers = 3
+
 // Fetch returns channel of oplog records, channel is filled in background.
-// TODO: handle disconnects && stepdown
+// TODO: handle disconnects
 // TODO: use sessions
 // TODO: use context.WithTimeout
 func (dbf *CursorMajFetcher) Fetch(ctx context.Context, wg *sync.WaitGroup) (oplogc chan *models.Oplog, errc chan error, err error) {
@@ -78,54 +106,100 @@ func (dbf *CursorMajFetcher) Fetch(ctx context.Context, wg *sync.WaitGroup) (opl
 		defer close(oplogc)
 
 		majTs := models.Timestamp{}
-		for dbf.cur.Next(ctx) {
-			// TODO: benchmark decode vs. bson.Reader vs. bson.Raw.LookupErr
-			op, err := models.OplogFromRaw(dbf.cur.Data())
-			if err != nil {
-				errc <- fmt.Errorf("oplog record decoding failed: %w", err)
-				return
-			}
-
-			// TODO: move to separate component and fetch last writes in background
-			for models.LessTS(majTs, op.TS) {
-				time.Sleep(dbf.lwInterval)
-
-				im, err := dbf.db.IsMaster(ctx)
+		lastTS := models.Timestamp{}
+		failovers := 0
+		for {
+			for dbf.cur.Next(ctx) {
+				// TODO: benchmark decode vs. bson.Reader vs. bson.Raw.LookupErr
+				op, err := models.OplogFromRaw(dbf.cur.Data())
 				if err != nil {
-					errc <- err
+					errc <- fmt.Errorf("oplog record decoding failed: %w", err)
 					return
 				}
 
-				// TODO: support archiving from secondary
-				if !im.IsMaster {
-					errc <- fmt.Errorf("current node is not a primary")
-					return
+				// TODO: move to separate component and fetch last writes in background
+				for models.LessTS(majTs, op.TS) {
+					time.Sleep(dbf.lwInterval)
+
+					im, err := dbf.db.IsMaster(ctx)
+					if err != nil {
+						errc <- err
+						return
+					}
+
+					if !im.IsMaster && !dbf.fromSecondary {
+						if dbf.stopOnStepdown {
+							tracelog.WarningLogger.Printf("Current node is not a primary anymore, fetching is stopped after ts '%s'", lastTS)
+							dbf.steppedDown = true
+							return
+						}
+						errc <- fmt.Errorf("current node is not a primary")
+						return
+					}
+
+					majTs = im.LastWrite.MajorityOpTime.TS
 				}
 
-				majTs = im.LastWrite.MajorityOpTime.TS
+				lastTS = op.TS
+				failovers = 0
+				select {
+				case oplogc <- op:
+				case <-ctx.Done():
+					return
+				}
 			}
 
-			select {
-			case oplogc <- op:
-			case <-ctx.Done():
+			curErr := dbf.cur.Err()
+			if curErr != nil && curErr == ctx.Err() {
+				return
+			}
+			if !dbf.fromSecondary || lastTS == (models.Timestamp{}) || failovers >= maxCursorFailovers {
+				if curErr != nil {
+					errc <- fmt.Errorf("oplog cursor error: %w", curErr)
+					return
+				}
+				errc <- fmt.Errorf("oplog cursor exhausted")
 				return
 			}
-		}
 
-		if err := dbf.cur.Err(); err != nil {
-			if err == ctx.Err() {
+			failovers++
+			tracelog.WarningLogger.Printf("Oplog cursor failed (%v), resuming from ts '%s'", curErr, lastTS)
+			if err := dbf.reopenCursor(ctx, lastTS); err != nil {
+				errc <- err
 				return
 			}
-			errc <- fmt.Errorf("oplog cursor error: %w", err)
-			return
 		}
-		errc <- fmt.Errorf("oplog cursor exhausted")
-
 	}()
 
 	return oplogc, errc, nil
 }
 
+// SteppedDown returns true if fetching is stopped due to stepdown of the node
+func (dbf *CursorMajFetcher) SteppedDown() bool {
+	return dbf.steppedDown
+}
+
+// reopenCursor builds cursor started after lastTS, member selected for new cursor must have lastTS in its oplog
+func (dbf *CursorMajFetcher) reopenCursor(ctx context.Context, lastTS models.Timestamp) error {
+	_ = dbf.cur.Close(ctx)
+	cur, err := dbf.db.TailOplogFrom(ctx, lastTS)
+	if err != nil {
+		return fmt.Errorf("can not build oplog cursor from ts '%s': %w", lastTS, err)
+	}
+	if !cur.Next(ctx) {
+		return fmt.Errorf("can not fetch first document: %v", cur.Err())
+	}
+	op, err := models.OplogFromRaw(cur.Data())
+	if err != nil {
+		return fmt.Errorf("first oplog record decoding failed: %w", err)
+	}
+	if op.TS != lastTS {
+		return fmt.Errorf("expected first ts is %v, but %v is given", lastTS, op.TS)
+	}
+	dbf.cur = cur
+	return nil
+}
+
 // CloserBuffer defines buffer which wraps bytes.Buffer and has dummy implementation of Closer interface.
 type CloserBuffer struct {
 	*bytes.Buffer
@@ -145,11 +219,65 @@ func (cb *CloserBuffer) Close() error {
 type StorageFetcher struct {
 	downloader archive.Downloader
 	path       archive.Sequence
+	prefetch   int
+}
+
+// StorageFetcherOption configures StorageFetcher
+type StorageFetcherOption func(*StorageFetcher)
+
+// PrefetchArchives enables concurrent download and decompression of up to n archives
+// while the current one is being applied.
+func PrefetchArchives(n int) StorageFetcherOption {
+	return func(sf *StorageFetcher) {
+		sf.prefetch = n
+	}
 }
 
 // NewStorageFetcher builds StorageFetcher instance
-func NewStorageFetcher(downloader archive.Downloader, path archive.Sequence) *StorageFetcher {
-	return &StorageFetcher{downloader: downloader, path: path}
+func NewStorageFetcher(downloader archive.Downloader, path archive.Sequence, opts ...StorageFetcherOption) *StorageFetcher {
+	sf := &StorageFetcher{downloader: downloader, path: path}
+	for _, opt := range opts {
+		opt(sf)
+	}
+	return sf
+}
+
+// fetchedArchive is a downloaded and decompressed archive
+type fetchedArchive struct {
+	arch models.Archive
+	buf  *CloserBuffer
+	err  error
+}
+
+// downloadArchives downloads archives of path in background preserving the order.
+// At most 1+prefetch archives are downloaded or kept in memory at the same time,
+// each received archive must be released with release call.
+func (sf *StorageFetcher) downloadArchives(ctx context.Context, from models.Timestamp) (archives chan chan fetchedArchive, release func()) {
+	slots := make(chan struct{}, 1+sf.prefetch)
+	archives = make(chan chan fetchedArchive, 1+sf.prefetch)
+	go func() {
+		defer close(archives)
+		for _, arch := range sf.path {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			fetched := make(chan fetchedArchive, 1)
+			go func(arch models.Archive) {
+				tracelog.DebugLogger.Printf("Fetching archive %s", arch.Filename())
+				buf := NewCloserBuffer()
+				err := sf.downloader.DownloadOplogArchiveSince(arch, from, buf)
+				fetched <- fetchedArchive{arch: arch, buf: buf, err: err}
+			}(arch)
+			select {
+			case archives <- fetched:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return archives, func() { <-slots }
 }
 
 // FetchBetween returns channel of oplog records, channel is filled in background.
@@ -166,16 +294,16 @@ func (sf *StorageFetcher) FetchBetween(ctx context.Context, from models.Timestam
 		defer close(data)
 		defer close(errc)
 
-		buf := NewCloserBuffer() // TODO: switch to streaming interface
-		path := sf.path
+		downloadCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		archives, release := sf.downloadArchives(downloadCtx, from) // TODO: switch to streaming interface
 		firstFound := false
 
-		for _, arch := range path {
-			tracelog.DebugLogger.Printf("Fetching archive %s", arch.Filename())
-
-			err := sf.downloader.DownloadOplogArchive(arch, buf)
-			if err != nil {
-				errc <- fmt.Errorf("failed to download archive %s: %w", arch.Filename(), err)
+		for fetched := range archives {
+			result := <-fetched
+			arch, buf := result.arch, result.buf
+			if result.err != nil {
+				errc <- fmt.Errorf("failed to download archive %s: %w", arch.Filename(), result.err)
 				return
 			}
 
@@ -187,6 +315,7 @@ func (sf *StorageFetcher) FetchBetween(ctx context.Context, from models.Timestam
 						break
 					}
 					errc <- fmt.Errorf("error during read bson: %w", err)
+					return
 				}
 
 				op, err := models.OplogFromRaw(raw)
@@ -216,12 +345,16 @@ func (sf *StorageFetcher) FetchBetween(ctx context.Context, from models.Timestam
 					return
 				}
 			}
-			buf.Reset()
+			release()
 			if !firstFound { // TODO: do we need this check, add skip flag
 				errc <- fmt.Errorf("'from' timestamp '%s' was not found in first archive: %s", from, arch.Filename())
 				return
 			}
 		}
+		if ctx.Err() != nil {
+			tracelog.InfoLogger.Println("Oplog archives fetching is canceled")
+			return
+		}
 		errc <- fmt.Errorf("restore sequence was fetched, but restore point '%s' is not reached",
 			until)
 	}()
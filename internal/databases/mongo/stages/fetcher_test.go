@@ -86,10 +86,10 @@ type DownloaderFields struct {
 func SetupDownloaderMocks(ops ...[]*models.Oplog) DownloaderFields {
 	dl := archiveMocks.Downloader{}
 	archives, raws := ArchRawMocks(ops...)
-	dl.On("DownloadOplogArchive", mock.Anything, mock.Anything).
+	dl.On("DownloadOplogArchiveSince", mock.Anything, mock.Anything, mock.Anything).
 		Return(nil).
 		Run(func(args mock.Arguments) {
-			writer := args.Get(1).(io.WriteCloser)
+			writer := args.Get(2).(io.WriteCloser)
 			arch := args.Get(0).(models.Archive)
 			for i, a := range archives {
 				if a == arch {
@@ -141,6 +141,7 @@ func TestStorageFetcher_OplogBetween(t *testing.T) {
 	tests := []struct {
 		name     string
 		fields   DownloaderFields
+		prefetch int
 		args     args
 		wantOps  []*models.Oplog
 		wantErr  error
@@ -170,6 +171,19 @@ func TestStorageFetcher_OplogBetween(t *testing.T) {
 			wantOps:  ops[:len(ops)-1],
 			wantErrc: nil,
 		},
+		{
+			name:     "from_first_until_last,_three_archives,_prefetch",
+			fields:   SetupDownloaderMocks(ops[0:2], ops[2:3], ops[3:]),
+			prefetch: 2,
+			args: args{
+				ctx:   context.TODO(),
+				from:  ops[0].TS,
+				until: ops[len(ops)-1].TS,
+				wg:    &sync.WaitGroup{},
+			},
+			wantOps:  ops[:len(ops)-1],
+			wantErrc: nil,
+		},
 		{
 			name:   "from_second_until_pre-last,_three_archives",
 			fields: SetupDownloaderMocks(ops[0:3], ops[3:4], ops[4:]),
@@ -225,6 +239,7 @@ func TestStorageFetcher_OplogBetween(t *testing.T) {
 			sf := &StorageFetcher{
 				downloader: tt.fields.downloader,
 				path:       tt.fields.path,
+				prefetch:   tt.prefetch,
 			}
 
 			outc, errc, err := sf.FetchBetween(tt.args.ctx, tt.args.from, tt.args.until, tt.args.wg)
@@ -401,6 +416,60 @@ func TestDBFetcher_Fetch(t *testing.T) {
 	}
 }
 
+func TestDBFetcher_FetchFailover(t *testing.T) {
+	md := SetupMongoDriverOkMock()
+	firstCur := &mongoMocks.OplogCursor{}
+	firstCur.On("Next", mock.Anything).Return(true).Twice().
+		On("Data").Return(ops[0].Data).Once().
+		On("Data").Return(ops[1].Data).Once().
+		On("Next", mock.Anything).Return(false).Once().
+		On("Err").Return(fmt.Errorf("connection lost")).Once().
+		On("Close", mock.Anything).Return(nil).Once()
+
+	secondCur := &mongoMocks.OplogCursor{}
+	secondCur.On("Next", mock.Anything).Return(true).Twice().
+		On("Data").Return(ops[1].Data).Once().
+		On("Data").Return(ops[2].Data).Once().
+		On("Next", mock.Anything).Return(false).Once().
+		On("Err").Return(fmt.Errorf("connection lost")).Once().
+		On("Close", mock.Anything).Return(nil).Once()
+
+	md.On("TailOplogFrom", mock.Anything, ops[1].TS).Return(secondCur, nil).Once().
+		On("TailOplogFrom", mock.Anything, ops[2].TS).Return(nil, fmt.Errorf("no members available")).Once()
+
+	dbf := NewCursorMajFetcher(md, firstCur, time.Microsecond, ReadFromSecondary())
+	outc, errc, err := dbf.Fetch(context.TODO(), &sync.WaitGroup{})
+	assert.Nil(t, err)
+
+	outOpsCh := gatherOps(outc)
+	err, _ = <-errc
+	outOps := <-outOpsCh
+
+	assert.Equal(t, ops[:3], outOps)
+	assert.EqualError(t, err, "can not build oplog cursor from ts '1579002003.1': no members available")
+	md.AssertExpectations(t)
+	firstCur.AssertExpectations(t)
+	secondCur.AssertExpectations(t)
+}
+
+func TestDBFetcher_FetchStopOnStepdown(t *testing.T) {
+	dbFields := SetupSecondaryMongoDriverMocks(ops[0])
+	dbf := NewCursorMajFetcher(dbFields.mongo, dbFields.cursor, time.Microsecond, StopOnStepdown())
+	outc, errc, err := dbf.Fetch(context.TODO(), &sync.WaitGroup{})
+	assert.Nil(t, err)
+
+	outOpsCh := gatherOps(outc)
+	err, ok := <-errc
+	outOps := <-outOpsCh
+
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, []*models.Oplog{}, outOps)
+	assert.True(t, dbf.SteppedDown())
+	dbFields.mongo.AssertExpectations(t)
+	dbFields.cursor.AssertExpectations(t)
+}
+
 func TestDBFetcher_FetchBson(t *testing.T) {
 	type args struct {
 		ctx  context.Context
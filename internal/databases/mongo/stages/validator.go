@@ -0,0 +1,48 @@
+package stages
+
+import (
+	"fmt"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// OplogValidator checks that oplog records follow each other: timestamps are strictly increasing,
+// election terms ('t' field) are non-decreasing and hashes ('h' field, before 4.2) are well-formed.
+// Oplog records do not refer to previous ones, so missing records between valid neighbours can not be detected.
+type OplogValidator struct {
+	lastTS   models.Timestamp
+	lastTerm int64
+	started  bool
+}
+
+// NewOplogValidator builds OplogValidator.
+func NewOplogValidator() *OplogValidator {
+	return &OplogValidator{}
+}
+
+// Validate checks given oplog record against previously validated ones.
+func (v *OplogValidator) Validate(op *models.Oplog) error {
+	raw := bson.Raw(op.Data)
+	if h, err := raw.LookupErr("h"); err == nil && h.Type != bsontype.Int64 {
+		return fmt.Errorf("oplog record '%s' has malformed 'h' field of type %s", op.TS, h.Type)
+	}
+	term, hasTerm := raw.Lookup("t").Int64OK()
+
+	if v.started {
+		if !models.LessTS(v.lastTS, op.TS) {
+			return fmt.Errorf("oplog records are out of order: '%s' follows '%s'", op.TS, v.lastTS)
+		}
+		if hasTerm && term < v.lastTerm {
+			return fmt.Errorf("oplog record '%s' has term %d which is less than previous term %d", op.TS, term, v.lastTerm)
+		}
+	}
+	v.started = true
+	v.lastTS = op.TS
+	if hasTerm {
+		v.lastTerm = term
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package stages
+
+import (
+	"testing"
+
+	"github.com/wal-g/wal-g/internal/databases/mongo/models"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func validatorTestOp(t *testing.T, ts models.Timestamp, doc bson.M) *models.Oplog {
+	doc["ts"] = models.BsonTimestampFromOplogTS(ts)
+	raw, err := bson.Marshal(doc)
+	assert.NoError(t, err)
+	return &models.Oplog{TS: ts, Data: raw}
+}
+
+func TestOplogValidator_Validate(t *testing.T) {
+	v := NewOplogValidator()
+	assert.NoError(t, v.Validate(validatorTestOp(t, models.Timestamp{TS: 10, Inc: 1}, bson.M{"t": int64(2), "h": int64(7)})))
+	assert.NoError(t, v.Validate(validatorTestOp(t, models.Timestamp{TS: 10, Inc: 2}, bson.M{"t": int64(2)})))
+	assert.NoError(t, v.Validate(validatorTestOp(t, models.Timestamp{TS: 11, Inc: 1}, bson.M{"t": int64(3)})))
+
+	assert.EqualError(t, v.Validate(validatorTestOp(t, models.Timestamp{TS: 11, Inc: 1}, bson.M{"t": int64(3)})),
+		"oplog records are out of order: '11.1' follows '11.1'")
+	assert.EqualError(t, v.Validate(validatorTestOp(t, models.Timestamp{TS: 10, Inc: 5}, bson.M{"t": int64(3)})),
+		"oplog records are out of order: '10.5' follows '11.1'")
+	assert.EqualError(t, v.Validate(validatorTestOp(t, models.Timestamp{TS: 12, Inc: 1}, bson.M{"t": int64(2)})),
+		"oplog record '12.1' has term 2 which is less than previous term 3")
+	assert.EqualError(t, v.Validate(validatorTestOp(t, models.Timestamp{TS: 12, Inc: 1}, bson.M{"h": "hash"})),
+		"oplog record '12.1' has malformed 'h' field of type string")
+}
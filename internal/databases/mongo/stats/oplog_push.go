@@ -36,6 +36,11 @@ type OplogArchivedStatsReport struct {
 	Bytes  uint64           `json:"bytes"`
 }
 
+// MirrorFailuresReporter defines mirror storages upload failures fetching interface
+type MirrorFailuresReporter interface {
+	Failures() map[string]int
+}
+
 // OplogUploadStats implements OplogUploadStats -Reporter and -OplogPushUpdater
 type OplogUploadStats struct {
 	sync.Mutex
@@ -88,12 +93,14 @@ type OplogPushReport struct {
 	Mongo    struct {
 		LastKnownMajTS models.Timestamp `json:"last_known_maj_ts"`
 	} `json:"mongo"`
+	MirrorFailures map[string]int `json:"mirror_failures,omitempty"`
 }
 
 // OplogPushStats implements OplogPushUpdater
 type OplogPushStats struct {
 	ctx      context.Context
 	uploader OplogArchivedStatsReporter
+	mirrors  MirrorFailuresReporter
 	mc       client.MongoDriver
 	sync.Mutex
 	rep OplogPushReport
@@ -117,6 +124,13 @@ func EnableHTTPHandler(httpPattern string, srv webserver.WebServer) OplogPushSta
 	}
 }
 
+// EnableMirrorFailuresReport adds upload failures of mirror storages to stats
+func EnableMirrorFailuresReport(reporter MirrorFailuresReporter) OplogPushStatsOption {
+	return func(st *OplogPushStats) {
+		st.mirrors = reporter
+	}
+}
+
 // NewOplogPushStats builds OplogPushStats
 func NewOplogPushStats(ctx context.Context, opRep OplogArchivedStatsReporter, mc client.MongoDriver, opts ...OplogPushStatsOption) *OplogPushStats {
 	st := &OplogPushStats{
@@ -161,6 +175,9 @@ func (st *OplogPushStats) RunLogging(logInterval time.Duration, logger logFunc)
 			st.rep.Archived.Docs,
 			st.rep.Archived.Bytes,
 			st.rep.Mongo.LastKnownMajTS.TS-st.rep.Archived.LastTS.TS)
+		if len(st.rep.MirrorFailures) > 0 {
+			logger("OplogPushStatus: mirror storages upload failures %v", st.rep.MirrorFailures)
+		}
 		st.Unlock()
 	}
 }
@@ -172,6 +189,10 @@ func (st *OplogPushStats) Update() error {
 		return fmt.Errorf("can not update oplog push stats: %w", err)
 	}
 	uploader := st.uploader.Report()
+	var mirrorFailures map[string]int
+	if st.mirrors != nil {
+		mirrorFailures = st.mirrors.Failures()
+	}
 
 	st.Lock()
 	defer st.Unlock()
@@ -180,5 +201,6 @@ func (st *OplogPushStats) Update() error {
 	st.rep.Archived.Docs = uploader.Docs
 	st.rep.Archived.Bytes = uploader.Bytes
 	st.rep.Mongo.LastKnownMajTS = im.LastWrite.MajorityOpTime.TS
+	st.rep.MirrorFailures = mirrorFailures
 	return nil
 }
@@ -1,16 +1,158 @@
 package mysql
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
 	"github.com/wal-g/storages/storage"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
-	"os/exec"
 )
 
-func HandleBackupFetch(folder storage.Folder, backupName string, restoreCmd *exec.Cmd, prepareCmd *exec.Cmd) {
-	internal.HandleBackupFetch(folder, backupName, internal.GetCommandStreamFetcher(restoreCmd))
-	if prepareCmd != nil {
-		err := prepareCmd.Run()
-		tracelog.ErrorLogger.FatalfOnError("failed to prepare fetched backup: %v", err)
+// BackupFetchOptions describe how backup-fetch restores the backup
+type BackupFetchOptions struct {
+	// Prepare runs xtrabackup --prepare if no prepare command is configured
+	Prepare bool
+	// Schemas are schemas and schema.table tables to restore, all are restored if it's empty
+	Schemas []string
+	// ReplicationSQLPath is the file for the statement repositioning the restored server as a replica
+	ReplicationSQLPath string
+}
+
+// HandleBackupFetch restores the backup with WALG_STREAM_RESTORE_COMMAND and prepares it with
+// WALG_MYSQL_BACKUP_PREPARE_COMMAND. For increments the full backup is restored first,
+// then every increment of the chain is restored to a temporary directory and applied in order.
+// If prepare is set and no prepare command is configured, xtrabackup or mariabackup --prepare is run
+// on WALG_MYSQL_DATA_DIR, so the datadir can be started right away.
+// If schemas are given, only these schemas and schema.table tables are passed to the restore command.
+// Clone backups are tar archives of a consistent datadir, they are restored without prepare.
+func HandleBackupFetch(folder storage.Folder, backupName string, options BackupFetchOptions) {
+	filter, err := newSchemaFilter(options.Schemas)
+	tracelog.ErrorLogger.FatalOnError(err)
+	chain, err := getBackupChain(folder, backupName)
+	tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+	_, hasPrepareCmd := internal.GetSetting(internal.MysqlBackupPrepareCmd)
+	prepare := options.Prepare || hasPrepareCmd
+	if len(chain) > 1 && !prepare {
+		tracelog.ErrorLogger.Fatalf("%s or --prepare is required to apply increments\n", internal.MysqlBackupPrepareCmd)
+	}
+	tool := getFetchBackupTool(chain[len(chain)-1].sentinel)
+	if tool == BackupToolClone && filter != nil {
+		tracelog.ErrorLogger.Fatalf("Restore of selected schemas is not supported for %s backups\n", BackupToolClone)
+	}
+	for i, link := range chain {
+		isLast := i == len(chain)-1
+		if link.sentinel.IsIncremental() {
+			tracelog.InfoLogger.Printf("Applying increment %s\n", link.backup.Name)
+		}
+		err = fetchChainLink(link, filter, tool, prepare, isLast)
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+	}
+	if galera := chain[len(chain)-1].sentinel.Galera; galera != nil {
+		tracelog.InfoLogger.Printf("Backup is made on a node of Galera cluster %s and contains write sets up to seqno %d, "+
+			"the restored node can join the cluster with IST after it\n", galera.ClusterUUID, galera.Seqno)
+	}
+	if options.ReplicationSQLPath != "" {
+		err = writeReplicationSQL(options.ReplicationSQLPath, chain[len(chain)-1].sentinel)
+		tracelog.ErrorLogger.FatalfOnError("Failed to write replication statement: %v\n", err)
+	}
+}
+
+func fetchChainLink(link backupChainLink, filter *schemaFilter, tool string, prepare, isLast bool) error {
+	env := append(os.Environ(), BackupToolEnv+"="+tool)
+	var incrementalDir string
+	if link.sentinel.IsIncremental() {
+		var err error
+		incrementalDir, err = ioutil.TempDir("", "wal-g-mysql-increment")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(incrementalDir)
+		env = append(env, IncrementalDirEnv+"="+incrementalDir)
+	}
+	if !isLast && tool == BackupToolXtrabackup {
+		env = append(env, ApplyLogOnlyEnv+"="+xtrabackupApplyLogOnly)
+	}
+	if useMemory := viper.GetString(internal.MysqlPrepareMemorySetting); useMemory != "" {
+		env = append(env, UseMemoryEnv+"="+xtrabackupUseMemory+useMemory)
+	}
+	if filter != nil && isLast {
+		env = append(env, ExportEnv+"="+xtrabackupExport)
+	}
+
+	restoreCmd, err := internal.GetCommandSetting(internal.NameStreamRestoreCmd)
+	if err != nil {
+		return err
+	}
+	restoreCmd.Env = env
+	stdin, err := restoreCmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stderr := &bytes.Buffer{}
+	restoreCmd.Stderr = stderr
+	if err = restoreCmd.Start(); err != nil {
+		return errors.Wrap(err, "failed to start restore command")
+	}
+	if filter == nil {
+		err = internal.DownloadAndDecompressStream(link.backup, stdin)
+	} else {
+		filterWriter := newSchemaFilterWriter(stdin, filter)
+		err = internal.DownloadAndDecompressStream(link.backup, filterWriter)
+		if filterErr := filterWriter.wait(); err == nil {
+			err = filterErr
+		}
+	}
+	if err != nil {
+		_ = stdin.Close()
+	}
+	if cmdErr := restoreCmd.Wait(); cmdErr != nil {
+		tracelog.ErrorLogger.Printf("Restore command output:\n%s", stderr.String())
+		err = cmdErr
+	}
+	if err != nil || !prepare {
+		return err
+	}
+	if tool == BackupToolClone {
+		tracelog.InfoLogger.Printf("Backup made by %s is consistent, it's not prepared\n", BackupToolClone)
+		return nil
+	}
+
+	prepareCmd, err := getPrepareCommand(tool, incrementalDir, isLast, filter != nil)
+	if err != nil {
+		return err
+	}
+	prepareCmd.Env = env
+	return errors.Wrap(prepareCmd.Run(), "failed to prepare fetched backup")
+}
+
+// getPrepareCommand returns WALG_MYSQL_BACKUP_PREPARE_COMMAND if it's set, or --prepare of the datadir by the tool.
+// For partial restore the last prepare is run with --export, so tables can be imported as transportable tablespaces.
+// mariabackup applies increments without --apply-log-only, since it never rolls back uncommitted transactions
+// until the last prepare.
+func getPrepareCommand(tool, incrementalDir string, isLast, export bool) (*exec.Cmd, error) {
+	if _, ok := internal.GetSetting(internal.MysqlBackupPrepareCmd); ok {
+		return internal.GetCommandSetting(internal.MysqlBackupPrepareCmd)
+	}
+	args := []string{"--prepare", "--target-dir=" + viper.GetString(internal.MysqlDataDirSetting)}
+	if useMemory := viper.GetString(internal.MysqlPrepareMemorySetting); useMemory != "" {
+		args = append(args, xtrabackupUseMemory+useMemory)
+	}
+	if !isLast && tool == BackupToolXtrabackup {
+		args = append(args, xtrabackupApplyLogOnly)
+	}
+	if incrementalDir != "" {
+		args = append(args, "--incremental-dir="+incrementalDir)
+	}
+	if export && isLast {
+		args = append(args, xtrabackupExport)
 	}
+	tracelog.DebugLogger.Printf("Running %s %v\n", tool, args)
+	cmd := exec.Command(tool, args...)
+	cmd.Stderr = os.Stderr
+	return cmd, nil
 }
@@ -0,0 +1,49 @@
+package mysql
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func TestGetPrepareCommand_Xtrabackup(t *testing.T) {
+	viper.Set(internal.MysqlDataDirSetting, "/var/lib/mysql")
+	viper.Set(internal.MysqlPrepareMemorySetting, "2G")
+	defer viper.Set(internal.MysqlDataDirSetting, nil)
+	defer viper.Set(internal.MysqlPrepareMemorySetting, nil)
+
+	cmd, err := getPrepareCommand(BackupToolXtrabackup, "/tmp/increment", false, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{BackupToolXtrabackup, "--prepare", "--target-dir=/var/lib/mysql", "--use-memory=2G",
+		"--apply-log-only", "--incremental-dir=/tmp/increment"}, cmd.Args)
+
+	cmd, err = getPrepareCommand(BackupToolXtrabackup, "", true, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{BackupToolXtrabackup, "--prepare", "--target-dir=/var/lib/mysql", "--use-memory=2G"}, cmd.Args)
+
+	cmd, err = getPrepareCommand(BackupToolXtrabackup, "", true, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{BackupToolXtrabackup, "--prepare", "--target-dir=/var/lib/mysql", "--use-memory=2G",
+		"--export"}, cmd.Args)
+}
+
+func TestGetPrepareCommand_Custom(t *testing.T) {
+	viper.Set(internal.MysqlBackupPrepareCmd, "true")
+	defer viper.Set(internal.MysqlBackupPrepareCmd, nil)
+
+	cmd, err := getPrepareCommand(BackupToolXtrabackup, "", true, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "true", cmd.Args[len(cmd.Args)-1])
+}
+
+func TestGetPrepareCommand_Mariabackup(t *testing.T) {
+	viper.Set(internal.MysqlDataDirSetting, "/var/lib/mysql")
+	defer viper.Set(internal.MysqlDataDirSetting, nil)
+
+	cmd, err := getPrepareCommand(BackupToolMariabackup, "/tmp/increment", false, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{BackupToolMariabackup, "--prepare", "--target-dir=/var/lib/mysql",
+		"--incremental-dir=/tmp/increment"}, cmd.Args)
+}
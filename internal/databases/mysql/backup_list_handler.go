@@ -0,0 +1,131 @@
+package mysql
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// BackupDetail is the backup with details of the server and binlog position taken from its sentinel
+type BackupDetail struct {
+	internal.BackupTime
+	StartLocalTime      time.Time `json:"start_local_time"`
+	FinishLocalTime     time.Time `json:"finish_local_time"`
+	Hostname            string    `json:"hostname,omitempty"`
+	ServerVersion       string    `json:"server_version,omitempty"`
+	Tool                string    `json:"tool,omitempty"`
+	BinLogStart         string    `json:"binlog_start"`
+	BinLogStartPosition uint64    `json:"binlog_start_position,omitempty"`
+	BinLogEnd           string    `json:"binlog_end"`
+	GtidExecuted        string    `json:"gtid_executed,omitempty"`
+	CompressedSize      int64     `json:"compressed_size,omitempty"`
+	IncrementFrom       string    `json:"increment_from,omitempty"`
+}
+
+func newBackupDetail(backupTime internal.BackupTime, sentinel StreamSentinelDto) BackupDetail {
+	detail := BackupDetail{
+		BackupTime:          backupTime,
+		StartLocalTime:      sentinel.StartLocalTime,
+		FinishLocalTime:     sentinel.FinishLocalTime,
+		Hostname:            sentinel.Hostname,
+		ServerVersion:       sentinel.ServerVersion,
+		Tool:                sentinel.Tool,
+		BinLogStart:         sentinel.BinLogStart,
+		BinLogStartPosition: sentinel.BinLogStartPosition,
+		BinLogEnd:           sentinel.BinLogEnd,
+		GtidExecuted:        sentinel.GtidExecuted,
+		CompressedSize:      sentinel.CompressedSize,
+	}
+	if sentinel.IsIncremental() {
+		detail.IncrementFrom = *sentinel.IncrementFrom
+	}
+	return detail
+}
+
+// HandleDetailedBackupList prints backups with details from their sentinels
+func HandleDetailedBackupList(folder storage.Folder, output io.Writer, pretty bool, json bool) error {
+	backups, err := internal.GetBackups(folder)
+	if _, ok := err.(internal.NoBackupsFoundError); ok {
+		tracelog.InfoLogger.Println("No backups found")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	details, err := getBackupDetails(folder, backups)
+	if err != nil {
+		return err
+	}
+	switch {
+	case json:
+		return internal.WriteAsJson(details, output, pretty)
+	case pretty:
+		writePrettyBackupListDetails(details, output)
+		return nil
+	default:
+		return writeBackupListDetails(details, output)
+	}
+}
+
+func getBackupDetails(folder storage.Folder, backups []internal.BackupTime) ([]BackupDetail, error) {
+	details := make([]BackupDetail, 0, len(backups))
+	for _, backupTime := range backups {
+		backup := internal.NewBackup(folder.GetSubFolder(utility.BaseBackupPath), backupTime.BackupName)
+		var sentinel StreamSentinelDto
+		if err := internal.FetchStreamSentinel(backup, &sentinel); err != nil {
+			return nil, errors.Wrapf(err, "failed to fetch sentinel of %s", backupTime.BackupName)
+		}
+		details = append(details, newBackupDetail(backupTime, sentinel))
+	}
+	return details, nil
+}
+
+func writeBackupListDetails(details []BackupDetail, output io.Writer) error {
+	writer := tabwriter.NewWriter(output, 0, 0, 1, ' ', 0)
+	_, err := fmt.Fprintln(writer, "name\tlast_modified\tstart_local_time\tfinish_local_time\thostname\t"+
+		"server_version\ttool\tbinlog_start\tbinlog_start_position\tbinlog_end\tgtid_executed\tcompressed_size\tincrement_from")
+	if err != nil {
+		return err
+	}
+	for i := len(details) - 1; i >= 0; i-- {
+		b := details[i]
+		_, err = fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			b.BackupName, b.Time.Format(time.RFC3339), formatDetailTime(b.StartLocalTime),
+			formatDetailTime(b.FinishLocalTime), b.Hostname, b.ServerVersion, b.Tool, b.BinLogStart,
+			b.BinLogStartPosition, b.BinLogEnd, b.GtidExecuted, b.CompressedSize, b.IncrementFrom)
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func writePrettyBackupListDetails(details []BackupDetail, output io.Writer) {
+	writer := table.NewWriter()
+	writer.SetOutputMirror(output)
+	defer writer.Render()
+	writer.AppendHeader(table.Row{"#", "Name", "Last modified", "Start time", "Finish time", "Hostname",
+		"Server version", "Tool", "Binlog start", "Binlog start position", "Binlog end", "GTID executed",
+		"Compressed size", "Increment from"})
+	for i, b := range details {
+		writer.AppendRow(table.Row{i, b.BackupName, b.Time.Format(time.RFC850), formatDetailTime(b.StartLocalTime),
+			formatDetailTime(b.FinishLocalTime), b.Hostname, b.ServerVersion, b.Tool, b.BinLogStart,
+			b.BinLogStartPosition, b.BinLogEnd, b.GtidExecuted, b.CompressedSize, b.IncrementFrom})
+	}
+}
+
+// formatDetailTime formats the time from the sentinel, it's empty for backups made before the time was recorded
+func formatDetailTime(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.Format(time.RFC3339)
+}
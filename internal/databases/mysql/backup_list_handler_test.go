@@ -0,0 +1,52 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/wal-g/utility"
+)
+
+func TestHandleDetailedBackupList(t *testing.T) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	increment := "stream_1"
+	for name, sentinel := range map[string]StreamSentinelDto{
+		"stream_1": {BinLogStart: "mysql-bin.000001", BinLogStartPosition: 154, BinLogEnd: "mysql-bin.000002",
+			ServerVersion: "8.0.22", Hostname: "db1", Tool: BackupToolXtrabackup, CompressedSize: 1024,
+			GtidExecuted: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-23"},
+		"stream_2": {BinLogStart: "mysql-bin.000003", BinLogEnd: "mysql-bin.000003", IncrementFrom: &increment},
+	} {
+		content, err := json.Marshal(sentinel)
+		assert.NoError(t, err)
+		err = folder.GetSubFolder(utility.BaseBackupPath).PutObject(name+utility.SentinelSuffix, bytes.NewReader(content))
+		assert.NoError(t, err)
+	}
+
+	var output bytes.Buffer
+	assert.NoError(t, HandleDetailedBackupList(folder, &output, false, true))
+	var details []BackupDetail
+	assert.NoError(t, json.Unmarshal(output.Bytes(), &details))
+	assert.Len(t, details, 2)
+	byName := map[string]BackupDetail{details[0].BackupName: details[0], details[1].BackupName: details[1]}
+	assert.Equal(t, "8.0.22", byName["stream_1"].ServerVersion)
+	assert.Equal(t, uint64(154), byName["stream_1"].BinLogStartPosition)
+	assert.Equal(t, int64(1024), byName["stream_1"].CompressedSize)
+	assert.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-23", byName["stream_1"].GtidExecuted)
+	assert.Equal(t, "stream_1", byName["stream_2"].IncrementFrom)
+
+	output.Reset()
+	assert.NoError(t, HandleDetailedBackupList(folder, &output, false, false))
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[0], "server_version")
+}
+
+func TestHandleDetailedBackupList_NoBackups(t *testing.T) {
+	var output bytes.Buffer
+	assert.NoError(t, HandleDetailedBackupList(memory.NewFolder("in_memory/", memory.NewStorage()), &output, false, true))
+	assert.Empty(t, output.String())
+}
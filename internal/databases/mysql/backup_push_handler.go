@@ -1,39 +1,196 @@
 package mysql
 
 import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/storages/storage"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/utility"
 	"os/exec"
 )
 
-func HandleBackupPush(uploader *internal.Uploader, backupCmd *exec.Cmd) {
+func HandleBackupPush(uploader *internal.Uploader, backupCmd *exec.Cmd, isFullBackup bool) {
+	folder := uploader.UploadingFolder
 	uploader.UploadingFolder = uploader.UploadingFolder.GetSubFolder(utility.BaseBackupPath)
 
 	db, err := getMySQLConnection()
 	tracelog.ErrorLogger.FatalOnError(err)
 	defer utility.LoggedClose(db, "")
 
-	binlogStart := getMySQLCurrentBinlogFile(db)
+	tool, err := getPushBackupTool(db)
+	tracelog.ErrorLogger.FatalOnError(err)
+	var previousBackupName string
+	var previousSentinel StreamSentinelDto
+	// clone backups are always full
+	if !isFullBackup && tool != BackupToolClone {
+		previousBackupName, previousSentinel = getDeltaOrigin(folder)
+	}
+	gtidExecuted := getMySQLGtidExecuted(db)
+	serverVersion, err := getMySQLVersion(db)
+	if err != nil {
+		tracelog.WarningLogger.Printf("Failed to get server version: %v\n", err)
+	}
+	replication, err := getReplicationCoordinates(db)
+	if err != nil {
+		tracelog.WarningLogger.Printf("Failed to get replication coordinates: %v\n", err)
+	}
+	binlogStart, binlogStartPosition := getMySQLCurrentBinlogPosition(db)
 	tracelog.DebugLogger.Println("Binlog start file", binlogStart)
 	timeStart := utility.TimeNowCrossPlatformLocal()
 
-	stdout, stderr, err := utility.StartCommandWithStdoutStderr(backupCmd)
-	tracelog.ErrorLogger.FatalfOnError("failed to start backup create command: %v", err)
+	fileName, err := internal.GetStreamBackupName(fmt.Sprintf("%s_%d", binlogStart, binlogStartPosition))
+	tracelog.ErrorLogger.FatalOnError(err)
+	err = internal.CheckBackupIsNew(uploader.UploadingFolder, fileName)
+	tracelog.ErrorLogger.FatalOnError(err)
 
-	fileName, err := uploader.PushStream(stdout)
-	tracelog.ErrorLogger.FatalfOnError("failed to push backup: %v", err)
+	lsnDir, err := ioutil.TempDir("", "wal-g-mysql-lsn")
+	tracelog.ErrorLogger.FatalOnError(err)
+	defer os.RemoveAll(lsnDir)
+	if tool != BackupToolClone {
+		backupCmd.Env = append(os.Environ(), LsnDirEnv+"="+lsnDir, BackupToolEnv+"="+tool)
+	}
+	if previousBackupName != "" {
+		tracelog.InfoLogger.Printf("Delta backup from %s with LSN %d\n", previousBackupName, *previousSentinel.ToLSN)
+		backupCmd.Env = append(backupCmd.Env, fmt.Sprintf("%s=%d", IncrementalLsnEnv, *previousSentinel.ToLSN))
+	}
 
-	err = backupCmd.Wait()
+	galeraDesync, err := internal.GetBoolSetting(internal.MysqlGaleraDesyncSetting, false)
+	tracelog.ErrorLogger.FatalOnError(err)
+	desynced := false
+	if galeraDesync {
+		desynced, err = desyncGaleraNode(db)
+		tracelog.ErrorLogger.FatalOnError(err)
+	}
+	galera, err := getGaleraCoordinates(db)
 	if err != nil {
-		tracelog.ErrorLogger.Printf("Backup command output:\n%s", stderr.String())
-		tracelog.ErrorLogger.Fatalf("backup create command failed: %v", err)
+		tracelog.WarningLogger.Printf("Failed to get Galera cluster coordinates: %v\n", err)
+	}
+
+	var backupFiles map[string][]byte
+	if tool == BackupToolClone {
+		err = pushClone(db, uploader, fileName)
+	} else {
+		backupFiles, err = pushBackupStream(uploader, backupCmd, fileName)
+	}
+	if desynced {
+		resyncGaleraNode(db)
 	}
+	tracelog.ErrorLogger.FatalOnError(err)
+
+	replication = getBackupReplicationCoordinates(replication, backupFiles[xtrabackupSlaveInfoFile])
+	galera = getBackupGaleraCoordinates(galera, backupFiles[xtrabackupGaleraInfoFile])
 
 	binlogEnd := getMySQLCurrentBinlogFile(db)
 	tracelog.DebugLogger.Println("Binlog end file", binlogEnd)
-	sentinel := StreamSentinelDto{BinLogStart: binlogStart, BinLogEnd: binlogEnd, StartLocalTime: timeStart}
+	sentinel := StreamSentinelDto{BinLogStart: binlogStart, BinLogEnd: binlogEnd, StartLocalTime: timeStart,
+		BinLogStartPosition: binlogStartPosition, FinishLocalTime: utility.TimeNowCrossPlatformLocal(),
+		ServerVersion: serverVersion, CompressedSize: uploadedDataSize(uploader),
+		GtidExecuted: gtidExecuted, Replication: replication, Galera: galera}
+	sentinel.Hostname, _ = os.Hostname()
+	checkpoints, err := readXtrabackupCheckpoints(lsnDir)
+	tracelog.ErrorLogger.FatalOnError(err)
+	setSentinelIncrement(&sentinel, checkpoints, previousBackupName, previousSentinel)
+	if checkpoints != nil || tool == BackupToolClone {
+		sentinel.Tool = tool
+	}
 
 	err = internal.UploadSentinel(uploader, &sentinel, fileName)
 	tracelog.ErrorLogger.FatalOnError(err)
 }
+
+// pushBackupStream runs the backup command and uploads its output as the backup.
+// Metadata files of xtrabackup needed for the sentinel are collected from the stream and returned.
+func pushBackupStream(uploader *internal.Uploader, backupCmd *exec.Cmd, fileName string) (map[string][]byte, error) {
+	stdout, stderr, err := utility.StartCommandWithStdoutStderr(backupCmd)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start backup create command")
+	}
+	collector := newXbstreamFileCollector(xtrabackupSlaveInfoFile, xtrabackupGaleraInfoFile)
+	defer collector.finish()
+	if err = uploader.PushStreamAs(io.TeeReader(stdout, collector), fileName); err != nil {
+		return nil, errors.Wrap(err, "failed to push backup")
+	}
+	if err = backupCmd.Wait(); err != nil {
+		tracelog.ErrorLogger.Printf("Backup command output:\n%s", stderr.String())
+		return nil, errors.Wrap(err, "backup create command failed")
+	}
+	return collector.finish(), nil
+}
+
+// getDeltaOrigin returns the latest backup to take the increment from,
+// or empty name if a full backup should be made according to WALG_DELTA_MAX_STEPS
+func getDeltaOrigin(folder storage.Folder) (string, StreamSentinelDto) {
+	maxDeltas := viper.GetInt(internal.DeltaMaxStepsSetting)
+	if maxDeltas <= 0 {
+		return "", StreamSentinelDto{}
+	}
+	backup, err := internal.GetBackupByName(internal.LatestString, utility.BaseBackupPath, folder)
+	if _, ok := err.(internal.NoBackupsFoundError); ok {
+		tracelog.InfoLogger.Println("Couldn't find previous backup. Doing full backup.")
+		return "", StreamSentinelDto{}
+	}
+	tracelog.ErrorLogger.FatalOnError(err)
+	var sentinel StreamSentinelDto
+	err = internal.FetchStreamSentinel(backup, &sentinel)
+	tracelog.ErrorLogger.FatalOnError(err)
+	if sentinel.ToLSN == nil {
+		tracelog.InfoLogger.Println("LATEST backup has no xtrabackup LSN. Doing full backup.")
+		return "", StreamSentinelDto{}
+	}
+	if sentinel.IncrementCount != nil && *sentinel.IncrementCount >= maxDeltas {
+		tracelog.InfoLogger.Println("Reached max delta steps. Doing full backup.")
+		return "", StreamSentinelDto{}
+	}
+	return backup.Name, sentinel
+}
+
+// setSentinelIncrement records LSN range of the backup and links increments to the backup they are taken from
+func setSentinelIncrement(sentinel *StreamSentinelDto, checkpoints *xtrabackupCheckpoints,
+	previousBackupName string, previousSentinel StreamSentinelDto) {
+	if checkpoints == nil {
+		if previousBackupName != "" {
+			tracelog.ErrorLogger.Fatalf("%s is not found in %s, the backup command must pass --extra-lsndir=$%s "+
+				"to xtrabackup to make increments", xtrabackupCheckpointsFile, LsnDirEnv, LsnDirEnv)
+		}
+		return
+	}
+	sentinel.FromLSN = &checkpoints.FromLsn
+	sentinel.ToLSN = &checkpoints.ToLsn
+	if !checkpoints.isIncremental() {
+		if previousBackupName != "" {
+			tracelog.WarningLogger.Printf("Increment was requested, but xtrabackup made a full backup, "+
+				"the backup command must pass --incremental-lsn=$%s\n", IncrementalLsnEnv)
+		}
+		return
+	}
+	if previousBackupName == "" {
+		tracelog.ErrorLogger.Fatal("xtrabackup made an increment, but no backup to take it from was chosen")
+	}
+	incrementCount := 1
+	if previousSentinel.IncrementCount != nil {
+		incrementCount = *previousSentinel.IncrementCount + 1
+	}
+	fullName := previousBackupName
+	if previousSentinel.IncrementFullName != nil {
+		fullName = *previousSentinel.IncrementFullName
+	}
+	sentinel.IncrementFrom = &previousBackupName
+	sentinel.IncrementFullName = &fullName
+	sentinel.IncrementCount = &incrementCount
+}
+
+// uploadedDataSize returns size of the uploaded backup stream or 0 if the size is not tracked
+func uploadedDataSize(uploader *internal.Uploader) int64 {
+	size, err := uploader.UploadedDataSize()
+	if err != nil {
+		tracelog.DebugLogger.Printf("Compressed backup size is unknown: %v\n", err)
+		return 0
+	}
+	return size
+}
@@ -0,0 +1,89 @@
+package mysql
+
+import (
+	"os"
+	"path"
+
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/ioextensions"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// binlogPrefetcher downloads up to depth binlogs in parallel ahead of the one being handled,
+// while binlogs are handled strictly in their order. Downloads stop at the first gap marker.
+type binlogPrefetcher struct {
+	logFolder storage.Folder
+	dstDir    string
+	logFiles  []storage.Object
+	depth     int
+	// downloads are results of started downloads, which are not taken yet
+	downloads []chan error
+	started   int
+}
+
+func newBinlogPrefetcher(logFolder storage.Folder, dstDir string, logFiles []storage.Object, depth int) *binlogPrefetcher {
+	return &binlogPrefetcher{
+		logFolder: logFolder,
+		dstDir:    dstDir,
+		logFiles:  logFiles,
+		depth:     depth,
+		downloads: make([]chan error, len(logFiles)),
+	}
+}
+
+func (prefetcher *binlogPrefetcher) binlogPath(index int) string {
+	return path.Join(prefetcher.dstDir, utility.TrimFileExtension(prefetcher.logFiles[index].GetName()))
+}
+
+// get waits for the binlog to be downloaded and starts downloads of the following binlogs
+func (prefetcher *binlogPrefetcher) get(index int) (string, error) {
+	for ; prefetcher.started < len(prefetcher.logFiles) && prefetcher.started < index+prefetcher.depth; prefetcher.started++ {
+		if _, isGap := parseBinlogGapName(prefetcher.logFiles[prefetcher.started].GetName()); isGap {
+			break
+		}
+		prefetcher.download(prefetcher.started)
+	}
+	binlogPath := prefetcher.binlogPath(index)
+	err := <-prefetcher.downloads[index]
+	prefetcher.downloads[index] = nil
+	return binlogPath, err
+}
+
+func (prefetcher *binlogPrefetcher) download(index int) {
+	done := make(chan error, 1)
+	prefetcher.downloads[index] = done
+	binlogName := utility.TrimFileExtension(prefetcher.logFiles[index].GetName())
+	binlogPath := prefetcher.binlogPath(index)
+	go func() {
+		tracelog.InfoLogger.Printf("downloading %s into %s", binlogName, binlogPath)
+		err := downloadBinlogTo(prefetcher.logFolder, binlogName, binlogPath)
+		if err != nil {
+			tracelog.ErrorLogger.Printf("failed to download %s: %v", binlogName, err)
+		}
+		done <- err
+	}()
+}
+
+func downloadBinlogTo(logFolder storage.Folder, binlog string, binlogPath string) error {
+	reader, err := downloadBinlog(logFolder, binlog)
+	if err != nil {
+		return err
+	}
+	defer utility.LoggedClose(reader, "")
+	return ioextensions.CreateFileWith(binlogPath, reader)
+}
+
+// cancel waits for downloads which are not taken and removes their binlogs
+func (prefetcher *binlogPrefetcher) cancel() {
+	for index, done := range prefetcher.downloads {
+		if done == nil {
+			continue
+		}
+		<-done
+		prefetcher.downloads[index] = nil
+		if err := os.Remove(prefetcher.binlogPath(index)); err != nil && !os.IsNotExist(err) {
+			tracelog.WarningLogger.Printf("failed to remove prefetched binlog: %v", err)
+		}
+	}
+}
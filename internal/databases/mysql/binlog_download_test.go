@@ -0,0 +1,59 @@
+package mysql
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/utility"
+)
+
+func TestBinlogPrefetcher(t *testing.T) {
+	dstDir, err := ioutil.TempDir("", "binlogs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dstDir)
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	logFiles := make([]storage.Object, 0)
+	for _, binlog := range []string{"mysql-bin.000001", "mysql-bin.000002", "mysql-bin.000003"} {
+		putTestBinlog(t, folder, binlog, 1, 1)
+		logFiles = append(logFiles, storage.NewLocalObject(binlog+"."+lz4.FileExtension, utility.TimeNowCrossPlatformUTC()))
+	}
+
+	prefetcher := newBinlogPrefetcher(folder.GetSubFolder(BinlogPath), dstDir, logFiles, 2)
+	binlogPath, err := prefetcher.get(0)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dstDir, "mysql-bin.000001"), binlogPath)
+	assert.FileExists(t, binlogPath)
+	assert.NotNil(t, prefetcher.downloads[1])
+	assert.Nil(t, prefetcher.downloads[2])
+
+	prefetcher.cancel()
+	assert.FileExists(t, binlogPath)
+	_, err = os.Stat(filepath.Join(dstDir, "mysql-bin.000002"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestBinlogPrefetcher_StopsAtGap(t *testing.T) {
+	dstDir, err := ioutil.TempDir("", "binlogs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dstDir)
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	putTestBinlog(t, folder, "mysql-bin.000001", 1, 1)
+	putTestBinlog(t, folder, "mysql-bin.000004", 1, 1)
+	logFiles := []storage.Object{
+		storage.NewLocalObject("mysql-bin.000001."+lz4.FileExtension, utility.TimeNowCrossPlatformUTC()),
+		storage.NewLocalObject("gap_mysql-bin.000002_mysql-bin.000003."+lz4.FileExtension, utility.TimeNowCrossPlatformUTC()),
+		storage.NewLocalObject("mysql-bin.000004."+lz4.FileExtension, utility.TimeNowCrossPlatformUTC()),
+	}
+
+	prefetcher := newBinlogPrefetcher(folder.GetSubFolder(BinlogPath), dstDir, logFiles, 3)
+	_, err = prefetcher.get(0)
+	assert.NoError(t, err)
+	assert.Nil(t, prefetcher.downloads[2])
+	prefetcher.cancel()
+}
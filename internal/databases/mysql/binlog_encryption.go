@@ -0,0 +1,30 @@
+package mysql
+
+import (
+	"io"
+
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/internal/crypto/envelope"
+)
+
+// binlogNameMetadata is the envelope metadata binding the encrypted binlog to its name
+const binlogNameMetadata = "binlog"
+
+// configureBinlogCrypter returns the crypter of binlog archives. With envelope encryption each binlog has
+// its own data key, and the binlog name is recorded in the authenticated envelope header and checked on fetch,
+// so a binlog swapped with another one or tampered with in storage is detected.
+func configureBinlogCrypter(binlog string) crypto.Crypter {
+	crypter := internal.ConfigureCrypterForContentType(internal.LogContentType)
+	envelopeCrypter, ok := crypter.(*envelope.Crypter)
+	if !ok {
+		return crypter
+	}
+	return envelopeCrypter.WithMetadata(map[string]string{binlogNameMetadata: binlog})
+}
+
+// downloadBinlog downloads, decrypts and decompresses the binlog, checking its envelope metadata
+func downloadBinlog(logFolder storage.Folder, binlog string) (io.ReadCloser, error) {
+	return internal.DownloadAndDecompressWALFileWith(logFolder, binlog, configureBinlogCrypter(binlog))
+}
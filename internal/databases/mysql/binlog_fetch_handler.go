@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"github.com/pkg/errors"
 	"github.com/wal-g/storages/storage"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"time"
 )
 
 type indexHandler struct {
@@ -41,25 +43,70 @@ func (ih *indexHandler) createIndexFile() error {
 	return nil
 }
 
-func HandleBinlogFetch(folder storage.Folder, backupName string, untilDT string) {
-	backup, err := internal.GetBackupByName(backupName, utility.BaseBackupPath, folder)
-	tracelog.ErrorLogger.FatalfOnError("Unable to get backup %v", err)
+// BinlogFetchOptions is the range of binlogs to fetch and the directory to save them to.
+// The range starts from SinceTime or the first binlog with transactions missing in SinceGtid if either is set,
+// or from the backup otherwise. It ends at UntilTime and, if it's set, at UntilGtid.
+type BinlogFetchOptions struct {
+	BackupName string
+	SinceTime  string
+	SinceGtid  string
+	UntilTime  string
+	UntilGtid  string
+	// DstDir is the directory for binlogs, WALG_MYSQL_BINLOG_DST is used if it's empty
+	DstDir string
+}
 
-	startTs, err := getBinlogStartTs(folder, backup)
+func HandleBinlogFetch(folder storage.Folder, options BinlogFetchOptions) {
+	startTs, err := getBinlogFetchStartTs(folder, options)
 	tracelog.ErrorLogger.FatalOnError(err)
 
-	endTs, err := configureEndTs(untilDT)
+	endTs, err := configureEndTs(options.UntilTime)
 	tracelog.ErrorLogger.FatalOnError(err)
 
-	dstDir, err := internal.GetLogsDstSettings(internal.MysqlBinlogDstSetting)
+	endGtid, err := configureEndGtid(options.UntilGtid)
+	tracelog.ErrorLogger.FatalOnError(err)
+	endGtids, err := parseGtidSet(endGtid)
 	tracelog.ErrorLogger.FatalOnError(err)
 
+	dstDir := options.DstDir
+	if dstDir == "" {
+		dstDir, err = internal.GetLogsDstSettings(internal.MysqlBinlogDstSetting)
+		tracelog.ErrorLogger.FatalOnError(err)
+	}
+	err = os.MkdirAll(dstDir, 0750)
+	tracelog.ErrorLogger.FatalfOnError("Failed to create binlog directory: %v", err)
+
 	handler := newIndexHandler(dstDir)
 
 	tracelog.InfoLogger.Printf("Fetching binlogs since %s until %s", startTs, endTs)
-	err = fetchLogs(folder, dstDir, startTs, endTs, handler)
+	if endGtid != "" {
+		tracelog.InfoLogger.Printf("Fetching transactions up to GTID %s", endGtid)
+	}
+	err = fetchLogs(folder, dstDir, startTs, endTs, endGtids, handler)
 	tracelog.ErrorLogger.FatalfOnError("Failed to fetch binlogs: %v", err)
 
 	err = handler.createIndexFile()
 	tracelog.ErrorLogger.FatalfOnError("Failed to create binlog index file: %v", err)
 }
+
+// getBinlogFetchStartTs returns the upload time of binlogs starting from which the binlogs are fetched.
+// A single GTID uuid:N in SinceGtid is extended to uuid:1-N, so binlogs with transactions after it are fetched.
+func getBinlogFetchStartTs(folder storage.Folder, options BinlogFetchOptions) (time.Time, error) {
+	switch {
+	case options.SinceTime != "" && options.SinceGtid != "":
+		return time.Time{}, errors.New("only one of the start time and the start GTID can be given")
+	case options.SinceTime != "":
+		return time.Parse(time.RFC3339, options.SinceTime)
+	case options.SinceGtid != "":
+		sinceGtid, err := configureSinceGtid(options.SinceGtid)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return getBinlogStartTsByGtids(folder, sinceGtid)
+	}
+	backup, err := internal.GetBackupByName(options.BackupName, utility.BaseBackupPath, folder)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "unable to get backup")
+	}
+	return getBinlogStartTs(folder, backup)
+}
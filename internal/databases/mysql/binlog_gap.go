@@ -0,0 +1,123 @@
+package mysql
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// BinlogGapPrefix starts names of markers uploaded to the binlog folder in place of lost binlogs
+const BinlogGapPrefix = "gap_"
+
+var (
+	binlogNameRegexp    = regexp.MustCompile(`^(.+)\.([0-9]+)$`)
+	binlogGapNameRegexp = regexp.MustCompile(`^` + BinlogGapPrefix + `(.+\.[0-9]+)_(.+\.[0-9]+)$`)
+)
+
+type BinlogGapError struct {
+	error
+}
+
+func newBinlogGapError(gap binlogGap) BinlogGapError {
+	return BinlogGapError{errors.Errorf("binlogs %s..%s were purged before they were archived", gap.first, gap.last)}
+}
+
+func (err BinlogGapError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// binlogGap is the range of binlogs between the last archived binlog and the earliest binlog available on the server
+type binlogGap struct {
+	first string
+	last  string
+}
+
+func (gap binlogGap) name() string {
+	return BinlogGapPrefix + gap.first + "_" + gap.last
+}
+
+// findBinlogGap returns the gap if binlogs following the last archived one are not on the server anymore.
+// Nil is returned if nothing was archived yet, or binlogs are named differently, e.g. log_bin_basename was changed.
+func findBinlogGap(lastArchived string, earliestBinlog string) *binlogGap {
+	if lastArchived == "" || earliestBinlog == "" {
+		return nil
+	}
+	basename, lastArchivedNo, ok := parseBinlogName(lastArchived)
+	if !ok {
+		return nil
+	}
+	earliestBasename, earliestNo, ok := parseBinlogName(earliestBinlog)
+	if !ok || earliestBasename != basename || earliestNo <= lastArchivedNo+1 {
+		return nil
+	}
+	return &binlogGap{
+		first: formatBinlogName(earliestBinlog, lastArchivedNo+1),
+		last:  formatBinlogName(earliestBinlog, earliestNo-1),
+	}
+}
+
+// findLastArchivedBinlog returns the latest binlog in the binlog folder, a gap marker counts as its last binlog.
+// Storage is checked rather than the local cache, which is lost when binlog-push runs on another host or user.
+func findLastArchivedBinlog(logFolder storage.Folder) (string, error) {
+	logFiles, _, err := logFolder.ListFolder()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list archived binlogs")
+	}
+	lastArchived := ""
+	for _, logFile := range logFiles {
+		binlog := utility.TrimFileExtension(logFile.GetName())
+		if gap, isGap := parseBinlogGapName(logFile.GetName()); isGap {
+			binlog = gap.last
+		}
+		if _, _, ok := parseBinlogName(binlog); ok && binlog > lastArchived {
+			lastArchived = binlog
+		}
+	}
+	return lastArchived, nil
+}
+
+// parseBinlogName splits binlog name to its basename and sequence number, e.g. mysql-bin.000042
+func parseBinlogName(binlog string) (string, uint64, bool) {
+	match := binlogNameRegexp.FindStringSubmatch(binlog)
+	if match == nil {
+		return "", 0, false
+	}
+	number, err := strconv.ParseUint(match[2], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return match[1], number, true
+}
+
+// formatBinlogName makes the name of binlog with the number like the sample binlog name, keeping its zero padding
+func formatBinlogName(sample string, number uint64) string {
+	match := binlogNameRegexp.FindStringSubmatch(sample)
+	return fmt.Sprintf("%s.%0*d", match[1], len(match[2]), number)
+}
+
+// parseBinlogGapName returns the gap marked by the object, the name may have an extension
+func parseBinlogGapName(objectName string) (*binlogGap, bool) {
+	if !strings.HasPrefix(objectName, BinlogGapPrefix) {
+		return nil, false
+	}
+	match := binlogGapNameRegexp.FindStringSubmatch(utility.TrimFileExtension(objectName))
+	if match == nil {
+		return nil, false
+	}
+	return &binlogGap{first: match[1], last: match[2]}, true
+}
+
+// uploadBinlogGap uploads the marker with the explanation of the gap, so the loss of binlogs is visible in storage
+func uploadBinlogGap(uploader *internal.Uploader, gap binlogGap) error {
+	message := newBinlogGapError(gap).error.Error()
+	content := internal.CompressAndEncrypt(strings.NewReader(message), uploader.Compressor,
+		internal.ConfigureCrypterForContentType(internal.LogContentType))
+	return uploader.Upload(gap.name()+"."+uploader.Compressor.FileExtension(), content)
+}
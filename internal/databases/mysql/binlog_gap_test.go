@@ -0,0 +1,61 @@
+package mysql
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/storages/storage"
+)
+
+func TestFindBinlogGap(t *testing.T) {
+	gap := findBinlogGap("mysql-bin.000007", "mysql-bin.000010")
+	assert.Equal(t, &binlogGap{first: "mysql-bin.000008", last: "mysql-bin.000009"}, gap)
+	assert.Equal(t, "gap_mysql-bin.000008_mysql-bin.000009", gap.name())
+}
+
+func TestFindBinlogGap_NoGap(t *testing.T) {
+	assert.Nil(t, findBinlogGap("mysql-bin.000007", "mysql-bin.000008"))
+	assert.Nil(t, findBinlogGap("mysql-bin.000007", "mysql-bin.000003"))
+	assert.Nil(t, findBinlogGap("", "mysql-bin.000010"))
+	assert.Nil(t, findBinlogGap("mysql-bin.000007", "other-bin.000010"))
+}
+
+func TestFindLastArchivedBinlog(t *testing.T) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	lastArchived, err := findLastArchivedBinlog(folder)
+	assert.NoError(t, err)
+	assert.Empty(t, lastArchived)
+
+	for _, name := range []string{"mysql-bin.000007.lz4", "gap_mysql-bin.000008_mysql-bin.000009.lz4", "mysql-bin.000006.lz4"} {
+		assert.NoError(t, folder.PutObject(name, strings.NewReader("")))
+	}
+	lastArchived, err = findLastArchivedBinlog(folder)
+	assert.NoError(t, err)
+	assert.Equal(t, "mysql-bin.000009", lastArchived)
+}
+
+func TestParseBinlogGapName(t *testing.T) {
+	gap, ok := parseBinlogGapName("gap_mysql-bin.000008_mysql-bin.000009.lz4")
+	assert.True(t, ok)
+	assert.Equal(t, binlogGap{first: "mysql-bin.000008", last: "mysql-bin.000009"}, *gap)
+
+	_, ok = parseBinlogGapName("mysql-bin.000008.lz4")
+	assert.False(t, ok)
+}
+
+func TestWriteBinlogList(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	logFiles := []storage.Object{
+		storage.NewLocalObject("mysql-bin.000010.lz4", now.Add(time.Minute)),
+		storage.NewLocalObject("gap_mysql-bin.000008_mysql-bin.000009.lz4", now),
+	}
+	var output bytes.Buffer
+	writeBinlogList(logFiles, &output)
+	assert.Equal(t, "name                               type   last_modified\n"+
+		"mysql-bin.000008..mysql-bin.000009 gap    2020-01-01T00:00:00Z\n"+
+		"mysql-bin.000010                   binlog 2020-01-01T00:01:00Z\n", output.String())
+}
@@ -0,0 +1,42 @@
+package mysql
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	binlogListTypeBinlog = "binlog"
+	binlogListTypeGap    = "gap"
+)
+
+// HandleBinlogList prints archived binlogs and markers of gaps between them
+func HandleBinlogList(folder storage.Folder) {
+	logFiles, _, err := folder.GetSubFolder(BinlogPath).ListFolder()
+	tracelog.ErrorLogger.FatalOnError(err)
+	writeBinlogList(logFiles, os.Stdout)
+}
+
+func writeBinlogList(logFiles []storage.Object, output io.Writer) {
+	sort.Slice(logFiles, func(i, j int) bool {
+		return logFiles[i].GetLastModified().Before(logFiles[j].GetLastModified())
+	})
+	writer := tabwriter.NewWriter(output, 0, 0, 1, ' ', 0)
+	defer writer.Flush()
+	fmt.Fprintln(writer, "name\ttype\tlast_modified")
+	for _, logFile := range logFiles {
+		name, logType := utility.TrimFileExtension(logFile.GetName()), binlogListTypeBinlog
+		if gap, ok := parseBinlogGapName(logFile.GetName()); ok {
+			name, logType = gap.first+".."+gap.last, binlogListTypeGap
+		}
+		fmt.Fprintf(writer, "%v\t%v\t%v\n", name, logType, logFile.GetLastModified().Format(time.RFC3339))
+	}
+}
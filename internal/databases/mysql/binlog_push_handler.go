@@ -35,6 +35,19 @@ func HandleBinlogPush(uploader *internal.Uploader) {
 	binlogs, err := getMySQLSortedBinlogs(db)
 	tracelog.ErrorLogger.FatalOnError(err)
 
+	earliestBinlog := getMySQLCurrentBinlogFile(db)
+	if len(binlogs) > 0 {
+		earliestBinlog = binlogs[0]
+	}
+	lastArchived, err := findLastArchivedBinlog(uploader.UploadingFolder)
+	tracelog.ErrorLogger.FatalOnError(err)
+	if gap := findBinlogGap(lastArchived, earliestBinlog); gap != nil {
+		tracelog.ErrorLogger.PrintError(newBinlogGapError(*gap))
+		err = uploadBinlogGap(uploader, *gap)
+		tracelog.ErrorLogger.FatalfOnError("Failed to upload binlog gap marker: %v", err)
+		setLastArchivedBinlog(gap.last)
+	}
+
 	for _, binLog := range binlogs {
 		err = tryArchiveBinLog(uploader, path.Join(binlogsFolder, binLog), binLog)
 		tracelog.ErrorLogger.FatalOnError(err)
@@ -88,7 +101,8 @@ func tryArchiveBinLog(uploader *internal.Uploader, filename string, binLog strin
 		return errors.Wrapf(err, "upload: could not open '%s'\n", filename)
 	}
 	defer utility.LoggedClose(walFile, "")
-	err = uploader.UploadFile(walFile)
+	content := internal.CompressAndEncrypt(walFile, uploader.Compressor, configureBinlogCrypter(binLog))
+	err = uploader.Upload(binLog+"."+uploader.Compressor.FileExtension(), content)
 	if err != nil {
 		return errors.Wrapf(err, "upload: could not upload '%s'\n", filename)
 	}
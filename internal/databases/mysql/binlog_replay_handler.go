@@ -2,26 +2,38 @@ package mysql
 
 import (
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/wal-g/storages/storage"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/utility"
 	"os"
 	"path"
+	"regexp"
+	"strings"
 	"time"
 )
 
-const binlogFetchAhead = 2
+const (
+	binlogFetchAhead = 2
+
+	binlogEndGtidEnv = "WALG_MYSQL_BINLOG_END_GTID"
+)
+
+var gtidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}` +
+	`(:[0-9]+(-[0-9]+)?)+$`)
 
 type replayHandler struct {
-	logCh chan string
-	errCh chan error
-	endTs string
+	logCh   chan string
+	errCh   chan error
+	endTs   string
+	endGtid string
 }
 
-func newReplayHandler(endTs time.Time) *replayHandler {
+func newReplayHandler(endTs time.Time, endGtid string) *replayHandler {
 	rh := new(replayHandler)
 	rh.endTs = endTs.Local().Format(TimeMysqlFormat)
+	rh.endGtid = endGtid
 	rh.logCh = make(chan string, binlogFetchAhead)
 	rh.errCh = make(chan error, 1)
 	go rh.replayLogs()
@@ -50,6 +62,9 @@ func (rh *replayHandler) replayLog(binlogPath string) error {
 	env := os.Environ()
 	env = append(env, fmt.Sprintf("%s=%s", "WALG_MYSQL_CURRENT_BINLOG", binlogPath))
 	env = append(env, fmt.Sprintf("%s=%s", "WALG_MYSQL_BINLOG_END_TS", rh.endTs))
+	if rh.endGtid != "" {
+		env = append(env, fmt.Sprintf("%s=%s", binlogEndGtidEnv, rh.endGtid))
+	}
 	cmd.Env = env
 	return cmd.Run()
 }
@@ -68,7 +83,57 @@ func (rh *replayHandler) handleBinlog(binlogPath string) error {
 	}
 }
 
-func HandleBinlogReplay(folder storage.Folder, backupName string, untilDT string) {
+// configureEndGtid checks the GTID set, which transactions are replayed up to. The set is passed
+// to mysqlbinlog --include-gtids, which is a filter rather than a stop point: transactions out of the set are skipped.
+// So the set must be full, like gtid_executed of the server at the target point, where transactions of each server
+// are numbered from 1. A single GTID uuid:N is rejected, since transactions of other servers would be lost.
+func configureEndGtid(untilGtid string) (string, error) {
+	gtids, err := splitGtidSet(untilGtid)
+	if err != nil {
+		return "", err
+	}
+	for _, gtid := range gtids {
+		parts := strings.Split(gtid, ":")
+		if first := strings.SplitN(parts[1], "-", 2)[0]; first != "1" {
+			return "", errors.Errorf("'%s' is not a full GTID set: transactions of %s before %s are missing, "+
+				"use gtid_executed of the server at the target point", untilGtid, parts[0], first)
+		}
+	}
+	return strings.Join(gtids, ","), nil
+}
+
+// configureSinceGtid makes the GTID set, which transactions are skipped by binlog-fetch.
+// A single GTID uuid:N is extended to uuid:1-N, so binlogs with transactions after it are fetched.
+func configureSinceGtid(sinceGtid string) (string, error) {
+	gtids, err := splitGtidSet(sinceGtid)
+	if err != nil {
+		return "", err
+	}
+	for i, gtid := range gtids {
+		parts := strings.Split(gtid, ":")
+		if len(parts) == 2 && !strings.Contains(parts[1], "-") {
+			gtids[i] = fmt.Sprintf("%s:1-%s", parts[0], parts[1])
+		}
+	}
+	return strings.Join(gtids, ","), nil
+}
+
+// splitGtidSet splits the GTID set into GTIDs of each server, empty set is split into nothing
+func splitGtidSet(text string) ([]string, error) {
+	if text == "" {
+		return nil, nil
+	}
+	gtids := strings.Split(strings.Replace(text, " ", "", -1), ",")
+	for _, gtid := range gtids {
+		if !gtidRegexp.MatchString(gtid) {
+			return nil, errors.Errorf("'%s' is not a GTID set", text)
+		}
+	}
+	return gtids, nil
+}
+
+// HandleBinlogReplay replays binlogs since the backup until the time and, if it's set, the GTID
+func HandleBinlogReplay(folder storage.Folder, backupName string, untilDT string, untilGtid string) {
 	backup, err := internal.GetBackupByName(backupName, utility.BaseBackupPath, folder)
 	tracelog.ErrorLogger.FatalfOnError("Unable to get backup %v", err)
 
@@ -78,13 +143,22 @@ func HandleBinlogReplay(folder storage.Folder, backupName string, untilDT string
 	endTs, err := configureEndTs(untilDT)
 	tracelog.ErrorLogger.FatalOnError(err)
 
+	endGtid, err := configureEndGtid(untilGtid)
+	tracelog.ErrorLogger.FatalOnError(err)
+
 	dstDir, err := internal.GetLogsDstSettings(internal.MysqlBinlogDstSetting)
 	tracelog.ErrorLogger.FatalOnError(err)
 
-	handler := newReplayHandler(endTs)
+	endGtids, err := parseGtidSet(endGtid)
+	tracelog.ErrorLogger.FatalOnError(err)
+
+	handler := newReplayHandler(endTs, endGtid)
+	if endGtid != "" {
+		tracelog.InfoLogger.Printf("Replaying transactions up to GTID %s", endGtid)
+	}
 
 	tracelog.InfoLogger.Printf("Fetching binlogs since %s until %s", startTs, endTs)
-	err = fetchLogs(folder, dstDir, startTs, endTs, handler)
+	err = fetchLogs(folder, dstDir, startTs, endTs, endGtids, handler)
 	tracelog.ErrorLogger.FatalfOnError("Failed to fetch binlogs: %v", err)
 
 	err = handler.wait()
@@ -0,0 +1,42 @@
+package mysql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigureEndGtid_RejectsSingleGtid(t *testing.T) {
+	_, err := configureEndGtid("3E11FA47-71CA-11E1-9E33-C80AA9429562:23")
+	assert.Error(t, err)
+}
+
+func TestConfigureEndGtid_RejectsSetWithoutFirstTransactions(t *testing.T) {
+	_, err := configureEndGtid("3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5, 2174B383-5441-11E8-B90A-C80AA9429562:7-9")
+	assert.Error(t, err)
+}
+
+func TestConfigureEndGtid_Set(t *testing.T) {
+	endGtid, err := configureEndGtid("3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5:11-18, " +
+		"2174B383-5441-11E8-B90A-C80AA9429562:1")
+	assert.NoError(t, err)
+	assert.Equal(t, "3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5:11-18,2174B383-5441-11E8-B90A-C80AA9429562:1", endGtid)
+}
+
+func TestConfigureSinceGtid_SingleGtid(t *testing.T) {
+	sinceGtid, err := configureSinceGtid("3E11FA47-71CA-11E1-9E33-C80AA9429562:23, " +
+		"2174B383-5441-11E8-B90A-C80AA9429562:1-7")
+	assert.NoError(t, err)
+	assert.Equal(t, "3E11FA47-71CA-11E1-9E33-C80AA9429562:1-23,2174B383-5441-11E8-B90A-C80AA9429562:1-7", sinceGtid)
+}
+
+func TestConfigureEndGtid_Invalid(t *testing.T) {
+	_, err := configureEndGtid("mysql-bin.000001")
+	assert.Error(t, err)
+}
+
+func TestConfigureEndGtid_Empty(t *testing.T) {
+	endGtid, err := configureEndGtid("")
+	assert.NoError(t, err)
+	assert.Empty(t, endGtid)
+}
@@ -0,0 +1,100 @@
+package mysql
+
+import (
+	"path"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// BinlogRetention keeps binlogs needed for point-in-time recovery from the oldest retained backup to now,
+// which are binlogs starting from the purge boundary of the backup
+type BinlogRetention struct {
+	boundary         string
+	boundaryBasename string
+	boundaryNo       uint64
+	// boundaryArchivedAt is the time the boundary binlog was uploaded, it's nil if it's not archived yet
+	boundaryArchivedAt *time.Time
+}
+
+// NewBinlogRetention finds the first binlog needed by the backup and warns about holes in archived binlogs
+// after it, since point-in-time recovery is not possible across them
+func NewBinlogRetention(folder storage.Folder, backupName string) (*BinlogRetention, error) {
+	backup := internal.NewBackup(folder.GetSubFolder(utility.BaseBackupPath), backupName)
+	var sentinel StreamSentinelDto
+	if err := internal.FetchStreamSentinel(backup, &sentinel); err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch sentinel of %s", backupName)
+	}
+	boundary, err := getBinlogPurgeBoundary(folder, sentinel)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find binlogs needed by %s", backupName)
+	}
+	basename, number, ok := parseBinlogName(boundary)
+	if !ok {
+		return nil, errors.Errorf("unexpected name '%s' of the first binlog needed by %s", boundary, backupName)
+	}
+	logFiles, _, err := folder.GetSubFolder(BinlogPath).ListFolder()
+	if err != nil {
+		return nil, err
+	}
+	retention := &BinlogRetention{boundary: boundary, boundaryBasename: basename, boundaryNo: number}
+	for _, logFile := range logFiles {
+		if utility.TrimFileExtension(logFile.GetName()) == boundary {
+			archivedAt := logFile.GetLastModified()
+			retention.boundaryArchivedAt = &archivedAt
+		}
+	}
+	tracelog.InfoLogger.Printf("Binlogs are kept starting from %s needed by %s\n", boundary, backupName)
+	for _, hole := range retention.findCoverageHoles(logFiles) {
+		tracelog.WarningLogger.Printf("Binlogs %s..%s are not archived, "+
+			"point-in-time recovery is not possible across them\n", hole.first, hole.last)
+	}
+	return retention, nil
+}
+
+// IsPruned checks if the archived binlog or gap marker is older than the boundary binlog.
+// Binlogs of another basename, e.g. archived before log_bin_basename was changed, are compared by upload time.
+func (retention *BinlogRetention) IsPruned(object storage.Object) bool {
+	name := path.Base(object.GetName())
+	if gap, isGap := parseBinlogGapName(name); isGap {
+		name = gap.last
+	} else {
+		name = utility.TrimFileExtension(name)
+	}
+	if basename, number, ok := parseBinlogName(name); ok && basename == retention.boundaryBasename {
+		return number < retention.boundaryNo
+	}
+	return retention.boundaryArchivedAt != nil && object.GetLastModified().Before(*retention.boundaryArchivedAt)
+}
+
+// findCoverageHoles returns ranges of binlogs missing between the boundary binlog and the last archived one
+func (retention *BinlogRetention) findCoverageHoles(logFiles []storage.Object) []binlogGap {
+	numbers := make([]uint64, 0, len(logFiles))
+	for _, logFile := range logFiles {
+		if _, isGap := parseBinlogGapName(logFile.GetName()); isGap {
+			continue
+		}
+		basename, number, ok := parseBinlogName(utility.TrimFileExtension(logFile.GetName()))
+		if ok && basename == retention.boundaryBasename && number >= retention.boundaryNo {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	holes := make([]binlogGap, 0)
+	expected := retention.boundaryNo
+	for _, number := range numbers {
+		if number > expected {
+			holes = append(holes, binlogGap{
+				first: formatBinlogName(retention.boundary, expected),
+				last:  formatBinlogName(retention.boundary, number-1),
+			})
+		}
+		expected = number + 1
+	}
+	return holes
+}
@@ -0,0 +1,53 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+func TestNewBinlogRetention(t *testing.T) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	for _, binlog := range []string{"mysql-bin.000001", "mysql-bin.000002", "mysql-bin.000003", "mysql-bin.000005"} {
+		putTestBinlog(t, folder, binlog, 1, 1)
+	}
+	sentinel, err := json.Marshal(StreamSentinelDto{BinLogStart: "mysql-bin.000002"})
+	assert.NoError(t, err)
+	err = folder.GetSubFolder(utility.BaseBackupPath).PutObject("backup"+utility.SentinelSuffix, bytes.NewReader(sentinel))
+	assert.NoError(t, err)
+
+	retention, err := NewBinlogRetention(folder, "backup")
+	assert.NoError(t, err)
+	assert.Equal(t, "mysql-bin.000002", retention.boundary)
+	assert.NotNil(t, retention.boundaryArchivedAt)
+
+	logFiles, _, err := folder.GetSubFolder(BinlogPath).ListFolder()
+	assert.NoError(t, err)
+	assert.Equal(t, []binlogGap{{first: "mysql-bin.000004", last: "mysql-bin.000004"}},
+		retention.findCoverageHoles(logFiles))
+
+	now := time.Now()
+	assert.True(t, retention.IsPruned(storage.NewLocalObject(BinlogPath+"mysql-bin.000001.lz4", now)))
+	assert.False(t, retention.IsPruned(storage.NewLocalObject(BinlogPath+"mysql-bin.000002.lz4", now)))
+	assert.False(t, retention.IsPruned(storage.NewLocalObject(BinlogPath+"mysql-bin.000005.lz4", now)))
+	assert.True(t, retention.IsPruned(storage.NewLocalObject(BinlogPath+"gap_mysql-bin.000000_mysql-bin.000001.lz4", now)))
+	assert.False(t, retention.IsPruned(storage.NewLocalObject(BinlogPath+"gap_mysql-bin.000004_mysql-bin.000004.lz4", now)))
+}
+
+func TestBinlogRetention_OtherBasename(t *testing.T) {
+	archivedAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	retention := &BinlogRetention{boundary: "binlog.000002", boundaryBasename: "binlog", boundaryNo: 2,
+		boundaryArchivedAt: &archivedAt}
+	assert.True(t, retention.IsPruned(storage.NewLocalObject(BinlogPath+"mysql-bin.000042.lz4", archivedAt.Add(-time.Hour))))
+	assert.False(t, retention.IsPruned(storage.NewLocalObject(BinlogPath+"mysql-bin.000042.lz4", archivedAt.Add(time.Hour))))
+
+	// binlogs of other basename are kept while the boundary binlog is not archived
+	retention.boundaryArchivedAt = nil
+	assert.False(t, retention.IsPruned(storage.NewLocalObject(BinlogPath+"mysql-bin.000042.lz4", archivedAt.Add(-time.Hour))))
+}
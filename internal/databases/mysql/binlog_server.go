@@ -0,0 +1,563 @@
+package mysql
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	binlogServerVersion      = "5.7.99-wal-g"
+	binlogServerPollInterval = 5 * time.Second
+
+	// https://dev.mysql.com/doc/internals/en/text-protocol.html
+	comQuit           = 0x01
+	comQuery          = 0x03
+	comPing           = 0x0e
+	comBinlogDump     = 0x12
+	comRegisterSlave  = 0x15
+	comBinlogDumpGtid = 0x1e
+
+	binlogRotateEvent     = 4
+	binlogHeartbeatEvent  = 27
+	binlogArtificialFlag  = 0x20
+	binlogDumpThroughGtid = 0x04
+
+	errAccessDenied      = 1045
+	errUnknownCommand    = 1047
+	errNotSupportedYet   = 1235
+	errSourceFatalBinlog = 1236
+)
+
+var (
+	setUserVariableRegexp = regexp.MustCompile(`(?i)^SET\s+@(\w+)\s*:?=\s*(.+)$`)
+	systemVariableRegexp  = regexp.MustCompile(`(?i)^@@(?:GLOBAL\.|SESSION\.)?(\w+)$`)
+	userVariableRegexp    = regexp.MustCompile(`^@(\w+)$`)
+	showVariablesRegexp   = regexp.MustCompile(`(?i)^SHOW\s+(?:GLOBAL\s+|SESSION\s+)?VARIABLES\s+LIKE\s+'(\w+)'$`)
+	literalRegexp         = regexp.MustCompile(`^(?:'([^']*)'|"([^"]*)"|(-?[0-9]+))$`)
+)
+
+// BinlogServer serves archived binlogs to MySQL replicas: a replica connects to it like to its source
+// and dumps binlogs by position or GTIDs, then it waits for new binlogs to be archived.
+type BinlogServer struct {
+	logFolder    storage.Folder
+	user         string
+	password     string
+	serverID     uint32
+	serverUUID   string
+	checksum     bool
+	gtidMode     bool
+	pollInterval time.Duration
+	connections  uint32
+}
+
+// HandleBinlogServer serves archived binlogs on WALG_MYSQL_BINLOG_SERVER_HOST:WALG_MYSQL_BINLOG_SERVER_PORT
+func HandleBinlogServer(folder storage.Folder) {
+	user, err := internal.GetRequiredSetting(internal.MysqlBinlogServerUser)
+	tracelog.ErrorLogger.FatalOnError(err)
+	password, err := internal.GetRequiredSetting(internal.MysqlBinlogServerPassword)
+	tracelog.ErrorLogger.FatalOnError(err)
+	serverIDSetting, _ := internal.GetSetting(internal.MysqlBinlogServerID)
+	serverID, err := strconv.ParseUint(serverIDSetting, 10, 32)
+	if err != nil {
+		tracelog.ErrorLogger.Fatalf("invalid %s '%s'\n", internal.MysqlBinlogServerID, serverIDSetting)
+	}
+	server, err := newBinlogServer(folder.GetSubFolder(BinlogPath), user, password, uint32(serverID))
+	tracelog.ErrorLogger.FatalOnError(err)
+
+	host, _ := internal.GetSetting(internal.MysqlBinlogServerHost)
+	port, _ := internal.GetSetting(internal.MysqlBinlogServerPort)
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	tracelog.ErrorLogger.FatalOnError(err)
+	tracelog.InfoLogger.Printf("Serving archived binlogs on %s\n", listener.Addr())
+	tracelog.ErrorLogger.FatalOnError(server.serve(listener))
+}
+
+// newBinlogServer makes the server, binlog checksums and GTID mode are detected by the last archived binlog
+func newBinlogServer(logFolder storage.Folder, user, password string, serverID uint32) (*BinlogServer, error) {
+	server := &BinlogServer{
+		logFolder:    logFolder,
+		user:         user,
+		password:     password,
+		serverID:     serverID,
+		serverUUID:   uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("wal-g binlog server %d", serverID))).String(),
+		pollInterval: binlogServerPollInterval,
+	}
+	binlogs, _, err := server.listBinlogs()
+	if err != nil {
+		return nil, err
+	}
+	if len(binlogs) == 0 {
+		return nil, errors.New("no binlogs are archived yet")
+	}
+	head, err := server.downloadBinlogHead(binlogs[len(binlogs)-1])
+	if err != nil {
+		return nil, err
+	}
+	server.checksum, server.gtidMode = head.checksum, len(head.previousGtids) > 0
+	return server, nil
+}
+
+func (server *BinlogServer) serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go server.handleConnection(conn)
+	}
+}
+
+// listBinlogs returns sorted names of archived binlogs and gaps between them
+func (server *BinlogServer) listBinlogs() ([]string, []binlogGap, error) {
+	logFiles, _, err := server.logFolder.ListFolder()
+	if err != nil {
+		return nil, nil, err
+	}
+	binlogs := make([]string, 0, len(logFiles))
+	gaps := make([]binlogGap, 0)
+	for _, logFile := range logFiles {
+		if gap, isGap := parseBinlogGapName(logFile.GetName()); isGap {
+			gaps = append(gaps, *gap)
+		} else {
+			binlogs = append(binlogs, utility.TrimFileExtension(logFile.GetName()))
+		}
+	}
+	sort.Strings(binlogs)
+	return binlogs, gaps, nil
+}
+
+func (server *BinlogServer) downloadBinlogHead(binlog string) (binlogHead, error) {
+	reader, err := downloadBinlog(server.logFolder, binlog)
+	if err != nil {
+		return binlogHead{}, err
+	}
+	defer utility.LoggedClose(reader, "")
+	return readBinlogHead(reader)
+}
+
+// variable returns the value of the system variable asked by replicas, or nil if it's unknown
+func (server *BinlogServer) variable(name string) *string {
+	onOff := func(on bool) string {
+		if on {
+			return "ON"
+		}
+		return "OFF"
+	}
+	checksum := "NONE"
+	if server.checksum {
+		checksum = "CRC32"
+	}
+	values := map[string]string{
+		"server_id":                strconv.FormatUint(uint64(server.serverID), 10),
+		"server_uuid":              server.serverUUID,
+		"gtid_mode":                onOff(server.gtidMode),
+		"enforce_gtid_consistency": onOff(server.gtidMode),
+		"binlog_checksum":          checksum,
+		"version":                  binlogServerVersion,
+		"version_comment":          "WAL-G binlog server",
+		"log_bin":                  "1",
+		"time_zone":                "SYSTEM",
+		"character_set_server":     "utf8mb4",
+		"collation_server":         "utf8mb4_general_ci",
+		"gtid_domain_id":           "0",
+	}
+	value, ok := values[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+	return &value
+}
+
+// binlogServerSession is a connection of a replica
+type binlogServerSession struct {
+	server        *BinlogServer
+	conn          *mysqlPacketConn
+	remote        string
+	userVariables map[string]*string
+	// position is the end of the last event sent in the current binlog
+	position uint32
+}
+
+func (server *BinlogServer) handleConnection(netConn net.Conn) {
+	defer utility.LoggedClose(netConn, "")
+	session := &binlogServerSession{
+		server:        server,
+		conn:          newMysqlPacketConn(netConn),
+		remote:        netConn.RemoteAddr().String(),
+		userVariables: map[string]*string{},
+	}
+	if err := session.authenticate(atomic.AddUint32(&server.connections, 1)); err != nil {
+		tracelog.WarningLogger.Printf("Binlog server connection from %s is rejected: %v\n", session.remote, err)
+		return
+	}
+	if err := session.handleCommands(); err != nil && err != io.EOF {
+		tracelog.WarningLogger.Printf("Binlog server connection from %s is closed: %v\n", session.remote, err)
+	}
+}
+
+// authenticate checks the user and password with mysql_native_password,
+// clients with other default plugins are asked to switch to it
+func (session *binlogServerSession) authenticate(connectionID uint32) error {
+	salt, err := newAuthSalt()
+	if err != nil {
+		return err
+	}
+	if err = session.conn.writeHandshake(connectionID, binlogServerVersion, salt); err != nil {
+		return err
+	}
+	data, err := session.conn.readPacket()
+	if err != nil {
+		return err
+	}
+	response, err := parseHandshakeResponse(data)
+	if err != nil {
+		return err
+	}
+	authResponse := response.authResponse
+	if response.plugin != "" && response.plugin != mysqlNativePasswordPlugin {
+		if err = session.conn.writeAuthSwitch(salt); err != nil {
+			return err
+		}
+		if authResponse, err = session.conn.readPacket(); err != nil {
+			return err
+		}
+	}
+	expected := scrambleNativePassword(salt, session.server.password)
+	if response.user != session.server.user || subtle.ConstantTimeCompare(authResponse, expected) != 1 {
+		err = errors.Errorf("access denied for user '%s'", response.user)
+		_ = session.conn.writeError(errAccessDenied, "28000", err.Error())
+		return err
+	}
+	tracelog.InfoLogger.Printf("Replica %s is connected to binlog server\n", session.remote)
+	return session.conn.writeOK()
+}
+
+func (session *binlogServerSession) handleCommands() error {
+	for {
+		session.conn.sequence = 0
+		command, err := session.conn.readPacket()
+		if err != nil {
+			return err
+		}
+		if len(command) == 0 {
+			return errors.New("empty command")
+		}
+		switch command[0] {
+		case comQuit:
+			return nil
+		case comPing, comRegisterSlave:
+			err = session.conn.writeOK()
+		case comQuery:
+			err = session.handleQuery(string(command[1:]))
+		case comBinlogDump:
+			return session.handleBinlogDump(command[1:])
+		case comBinlogDumpGtid:
+			return session.handleBinlogDumpGtid(command[1:])
+		default:
+			err = session.conn.writeError(errUnknownCommand, "08S01", fmt.Sprintf("unknown command %d", command[0]))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handleQuery answers queries made by replicas before they dump binlogs: SET statements are acknowledged,
+// user variables are remembered, and system variables are selected
+func (session *binlogServerSession) handleQuery(query string) error {
+	query = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(query), ";"))
+	upperQuery := strings.ToUpper(query)
+	if match := setUserVariableRegexp.FindStringSubmatch(query); match != nil {
+		session.userVariables[strings.ToLower(match[1])] = session.evaluate(match[2])
+		return session.conn.writeOK()
+	}
+	if strings.HasPrefix(upperQuery, "SET ") {
+		return session.conn.writeOK()
+	}
+	if match := showVariablesRegexp.FindStringSubmatch(query); match != nil {
+		rows := make([][]*string, 0, 1)
+		if value := session.server.variable(match[1]); value != nil {
+			name := strings.ToLower(match[1])
+			rows = append(rows, []*string{&name, value})
+		}
+		return session.conn.writeResultSet([]string{"Variable_name", "Value"}, rows)
+	}
+	if strings.HasPrefix(upperQuery, "SELECT ") {
+		expressions := strings.Split(query[len("SELECT "):], ",")
+		columns := make([]string, 0, len(expressions))
+		row := make([]*string, 0, len(expressions))
+		for _, expression := range expressions {
+			expression = strings.TrimSpace(expression)
+			columns = append(columns, expression)
+			row = append(row, session.evaluate(expression))
+		}
+		return session.conn.writeResultSet(columns, [][]*string{row})
+	}
+	return session.conn.writeError(errNotSupportedYet, "42000",
+		fmt.Sprintf("WAL-G binlog server doesn't support '%s'", query))
+}
+
+// evaluate returns the value of system and user variables, literals and UNIX_TIMESTAMP(), or nil
+func (session *binlogServerSession) evaluate(expression string) *string {
+	expression = strings.TrimSpace(expression)
+	if match := systemVariableRegexp.FindStringSubmatch(expression); match != nil {
+		return session.server.variable(match[1])
+	}
+	if match := userVariableRegexp.FindStringSubmatch(expression); match != nil {
+		return session.userVariables[strings.ToLower(match[1])]
+	}
+	if match := literalRegexp.FindStringSubmatch(expression); match != nil {
+		value := match[1] + match[2] + match[3]
+		return &value
+	}
+	if strings.ToUpper(expression) == "UNIX_TIMESTAMP()" {
+		value := strconv.FormatInt(utility.TimeNowCrossPlatformUTC().Unix(), 10)
+		return &value
+	}
+	return nil
+}
+
+// handleBinlogDump parses COM_BINLOG_DUMP: position, flags, server id of the replica and binlog name
+func (session *binlogServerSession) handleBinlogDump(data []byte) error {
+	if len(data) < 10 {
+		return errors.New("truncated COM_BINLOG_DUMP")
+	}
+	position := binary.LittleEndian.Uint32(data)
+	binlog := string(data[10:])
+	return session.dumpBinlogs(binlog, position)
+}
+
+// handleBinlogDumpGtid parses COM_BINLOG_DUMP_GTID: flags, server id, binlog name and position, and GTIDs
+// of the replica. Binlogs are sent from the last one which has no transactions missing on the replica,
+// transactions the replica already has are skipped by the replica itself.
+func (session *binlogServerSession) handleBinlogDumpGtid(data []byte) error {
+	le := binary.LittleEndian
+	errTruncated := errors.New("truncated COM_BINLOG_DUMP_GTID")
+	if len(data) < 10 {
+		return errTruncated
+	}
+	flags, nameLength := le.Uint16(data), int(le.Uint32(data[6:]))
+	data = data[10:]
+	if len(data) < nameLength+8 {
+		return errTruncated
+	}
+	data = data[nameLength+8:]
+	replicaGtids := gtidSet{}
+	if flags&binlogDumpThroughGtid != 0 {
+		if len(data) < 4 || len(data) < 4+int(le.Uint32(data)) {
+			return errTruncated
+		}
+		var err error
+		if replicaGtids, err = parsePreviousGtidsEvent(data[4 : 4+le.Uint32(data)]); err != nil {
+			return err
+		}
+	}
+	binlog, err := session.server.findBinlogByGtids(replicaGtids)
+	if err != nil {
+		return session.writeDumpError(err)
+	}
+	return session.dumpBinlogs(binlog, BinlogMagicLength)
+}
+
+// findBinlogByGtids returns the last binlog whose Previous_gtids are executed on the replica
+func (server *BinlogServer) findBinlogByGtids(replicaGtids gtidSet) (string, error) {
+	binlogs, _, err := server.listBinlogs()
+	if err != nil {
+		return "", err
+	}
+	for i := len(binlogs) - 1; i >= 0; i-- {
+		head, err := server.downloadBinlogHead(binlogs[i])
+		if err != nil {
+			return "", err
+		}
+		if head.previousGtids == nil {
+			return "", errors.Errorf("binlog %s is written without GTIDs", binlogs[i])
+		}
+		if replicaGtids.contains(head.previousGtids) {
+			return binlogs[i], nil
+		}
+	}
+	return "", errors.New("the replica needs transactions which are not in archived binlogs")
+}
+
+// dumpBinlogs sends archived binlogs starting from the position, then waits for new binlogs to be archived
+func (session *binlogServerSession) dumpBinlogs(binlog string, position uint32) error {
+	binlogs, _, err := session.server.listBinlogs()
+	if err != nil {
+		return session.writeDumpError(err)
+	}
+	if binlog == "" && len(binlogs) > 0 {
+		binlog = binlogs[0]
+	}
+	if index := sort.SearchStrings(binlogs, binlog); index == len(binlogs) || binlogs[index] != binlog {
+		return session.writeDumpError(errors.Errorf("binlog '%s' is not archived", binlog))
+	}
+	if position < BinlogMagicLength {
+		position = BinlogMagicLength
+	}
+	tracelog.InfoLogger.Printf("Sending binlogs to replica %s from %s:%d\n", session.remote, binlog, position)
+	if err = session.writeEvent(session.server.makeRotateEvent(binlog, position)); err != nil {
+		return err
+	}
+	for {
+		rotated, err := session.sendBinlog(binlog, position)
+		if err != nil {
+			return session.writeDumpError(err)
+		}
+		next, err := session.waitNextBinlog(binlog)
+		if err != nil {
+			return session.writeDumpError(err)
+		}
+		if !rotated {
+			if err = session.writeEvent(session.server.makeRotateEvent(next, BinlogMagicLength)); err != nil {
+				return err
+			}
+		}
+		binlog, position = next, BinlogMagicLength
+	}
+}
+
+// sendBinlog sends events of the binlog ending after the position. Format_description event is always sent,
+// with zero position if the binlog is sent not from its start, so the replica doesn't move its position.
+// It returns whether the last event is Rotate event, which leads the replica to the next binlog.
+func (session *binlogServerSession) sendBinlog(binlog string, position uint32) (bool, error) {
+	reader, err := downloadBinlog(session.server.logFolder, binlog)
+	if err != nil {
+		return false, err
+	}
+	defer utility.LoggedClose(reader, "")
+	magic := make([]byte, BinlogMagicLength)
+	if _, err = io.ReadFull(reader, magic); err != nil {
+		return false, err
+	}
+	if string(magic) != string(BinlogMagic[:]) {
+		return false, fmt.Errorf("incorrect binlog magic: %v", magic)
+	}
+	session.position = BinlogMagicLength
+	lastEventType := byte(0)
+	for {
+		header := make([]byte, binlogEventHeaderV4Size)
+		if _, err = io.ReadFull(reader, header); err == io.EOF {
+			return lastEventType == binlogRotateEvent, nil
+		} else if err != nil {
+			return false, errors.Wrapf(err, "failed to read binlog %s", binlog)
+		}
+		eventHeader := ParseEventHeader(header)
+		if eventHeader.EventLength < binlogEventHeaderV4Size {
+			return false, errors.Errorf("invalid event length %d in binlog %s", eventHeader.EventLength, binlog)
+		}
+		event := make([]byte, eventHeader.EventLength)
+		copy(event, header)
+		if _, err = io.ReadFull(reader, event[binlogEventHeaderV4Size:]); err != nil {
+			return false, errors.Wrapf(err, "failed to read binlog %s", binlog)
+		}
+		start := session.position
+		session.position += eventHeader.EventLength
+		if eventHeader.TypeCode == binlogFormatDescriptionEvent {
+			if position > BinlogMagicLength {
+				setEventLogPosition(event, 0, session.server.checksum)
+			}
+		} else if start < position {
+			continue
+		}
+		if err = session.writeEvent(event); err != nil {
+			return false, err
+		}
+		lastEventType = eventHeader.TypeCode
+	}
+}
+
+// waitNextBinlog returns the binlog archived after the current one, sending heartbeats to the replica while waiting
+func (session *binlogServerSession) waitNextBinlog(current string) (string, error) {
+	for {
+		binlogs, gaps, err := session.server.listBinlogs()
+		if err != nil {
+			return "", err
+		}
+		next := ""
+		if index := sort.Search(len(binlogs), func(i int) bool { return binlogs[i] > current }); index < len(binlogs) {
+			next = binlogs[index]
+		}
+		for _, gap := range gaps {
+			if gap.first > current && (next == "" || gap.first <= next) {
+				return "", newBinlogGapError(gap)
+			}
+		}
+		if next != "" {
+			return next, nil
+		}
+		heartbeat := session.server.makeEvent(binlogHeartbeatEvent, session.position, 0, []byte(current))
+		if err = session.writeEvent(heartbeat); err != nil {
+			return "", err
+		}
+		time.Sleep(session.server.pollInterval)
+	}
+}
+
+// writeEvent sends the event prefixed with OK byte like MySQL does
+func (session *binlogServerSession) writeEvent(event []byte) error {
+	return session.conn.writePacket(append([]byte{mysqlPacketOK}, event...))
+}
+
+// writeDumpError sends the error to the replica, where it's shown in Last_IO_Error, and returns it
+func (session *binlogServerSession) writeDumpError(err error) error {
+	_ = session.conn.writeError(errSourceFatalBinlog, "HY000", err.Error())
+	return err
+}
+
+// makeEvent makes the event generated by the server, which is not in archived binlogs
+func (server *BinlogServer) makeEvent(eventType byte, logPosition uint32, flags uint16, body []byte) []byte {
+	le := binary.LittleEndian
+	length := binlogEventHeaderV4Size + len(body)
+	if server.checksum {
+		length += crc32.Size
+	}
+	event := make([]byte, binlogEventHeaderV4Size, length)
+	event[4] = eventType
+	le.PutUint32(event[5:], server.serverID)
+	le.PutUint32(event[9:], uint32(length))
+	le.PutUint32(event[13:], logPosition)
+	le.PutUint16(event[17:], flags)
+	event = append(event, body...)
+	if server.checksum {
+		event = append(event, make([]byte, crc32.Size)...)
+		setEventChecksum(event)
+	}
+	return event
+}
+
+// makeRotateEvent makes the artificial Rotate event, which tells the replica the binlog being sent
+func (server *BinlogServer) makeRotateEvent(binlog string, position uint32) []byte {
+	body := make([]byte, 8, 8+len(binlog))
+	binary.LittleEndian.PutUint64(body, uint64(position))
+	return server.makeEvent(binlogRotateEvent, 0, binlogArtificialFlag, append(body, binlog...))
+}
+
+func setEventLogPosition(event []byte, position uint32, checksum bool) {
+	binary.LittleEndian.PutUint32(event[13:], position)
+	if checksum {
+		setEventChecksum(event)
+	}
+}
+
+func setEventChecksum(event []byte) {
+	checksumOffset := len(event) - crc32.Size
+	binary.LittleEndian.PutUint32(event[checksumOffset:], crc32.ChecksumIEEE(event[:checksumOffset]))
+}
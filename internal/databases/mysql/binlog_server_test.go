@@ -0,0 +1,196 @@
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+)
+
+const binlogQueryEvent = 2
+
+func TestScrambleNativePassword(t *testing.T) {
+	salt := []byte("12345678901234567890")
+	assert.Len(t, scrambleNativePassword(salt, "secret"), 20)
+	assert.Equal(t, scrambleNativePassword(salt, "secret"), scrambleNativePassword(salt, "secret"))
+	assert.NotEqual(t, scrambleNativePassword(salt, "secret"), scrambleNativePassword(salt, "other"))
+	assert.Empty(t, scrambleNativePassword(salt, ""))
+}
+
+func TestLengthEncodedInt(t *testing.T) {
+	for _, value := range []uint64{0, 250, 251, 1 << 16, 1<<24 + 1, 1 << 40} {
+		encoded := appendLengthEncodedInt(nil, value)
+		decoded, size := readLengthEncodedInt(encoded)
+		assert.Equal(t, value, decoded)
+		assert.Equal(t, len(encoded), size)
+	}
+}
+
+func TestBinlogServer_Queries(t *testing.T) {
+	server := newTestBinlogServer(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = server.serve(listener) }()
+
+	db, err := sql.Open("mysql", fmt.Sprintf("repl:secret@tcp(%s)/", listener.Addr()))
+	assert.NoError(t, err)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	var serverID, uuid string
+	err = conn.QueryRowContext(context.Background(), "SELECT @@GLOBAL.SERVER_ID, @@server_uuid").Scan(&serverID, &uuid)
+	assert.NoError(t, err)
+	assert.Equal(t, "99999", serverID)
+	assert.Equal(t, server.serverUUID, uuid)
+
+	_, err = conn.ExecContext(context.Background(), "SET @master_binlog_checksum= @@global.binlog_checksum")
+	assert.NoError(t, err)
+	var checksum string
+	err = conn.QueryRowContext(context.Background(), "SELECT @master_binlog_checksum").Scan(&checksum)
+	assert.NoError(t, err)
+	assert.Equal(t, "CRC32", checksum)
+
+	var name, gtidMode string
+	err = conn.QueryRowContext(context.Background(), "SHOW VARIABLES LIKE 'GTID_MODE'").Scan(&name, &gtidMode)
+	assert.NoError(t, err)
+	assert.Equal(t, "OFF", gtidMode)
+
+	wrongDB, err := sql.Open("mysql", fmt.Sprintf("repl:wrong@tcp(%s)/", listener.Addr()))
+	assert.NoError(t, err)
+	defer wrongDB.Close()
+	assert.Error(t, wrongDB.Ping())
+}
+
+func TestBinlogServer_Dump(t *testing.T) {
+	server := newTestBinlogServer(t)
+	client := dumpTestBinlogs(server, "mysql-bin.000001", BinlogMagicLength)
+
+	assertArtificialRotate(t, server, readTestEvent(t, client), "mysql-bin.000001")
+	event := readTestEvent(t, client)
+	assert.Equal(t, byte(binlogFormatDescriptionEvent), event[4])
+	assert.Equal(t, byte(binlogQueryEvent), readTestEvent(t, client)[4])
+	assert.Equal(t, byte(binlogRotateEvent), readTestEvent(t, client)[4])
+	assert.Equal(t, byte(binlogFormatDescriptionEvent), readTestEvent(t, client)[4])
+	assert.Equal(t, byte(binlogQueryEvent), readTestEvent(t, client)[4])
+	// mysql-bin.000002 has no Rotate event at the end, so the server waits for the next binlog
+	heartbeat := readTestEvent(t, client)
+	assert.Equal(t, byte(binlogHeartbeatEvent), heartbeat[4])
+	assert.Equal(t, "mysql-bin.000002", string(heartbeat[binlogEventHeaderV4Size:len(heartbeat)-crc32.Size]))
+
+	putTestServerBinlog(t, server, "mysql-bin.000003", false)
+	for event = readTestEvent(t, client); event[4] == binlogHeartbeatEvent; event = readTestEvent(t, client) {
+	}
+	assertArtificialRotate(t, server, event, "mysql-bin.000003")
+	assert.Equal(t, byte(binlogFormatDescriptionEvent), readTestEvent(t, client)[4])
+}
+
+func TestBinlogServer_DumpFromPosition(t *testing.T) {
+	server := newTestBinlogServer(t)
+	client := dumpTestBinlogs(server, "mysql-bin.000001", testBinlogRotatePosition)
+
+	assertArtificialRotate(t, server, readTestEvent(t, client), "mysql-bin.000001")
+	event := readTestEvent(t, client)
+	assert.Equal(t, byte(binlogFormatDescriptionEvent), event[4])
+	assert.Equal(t, uint32(0), binary.LittleEndian.Uint32(event[13:]))
+	assertTestEventChecksum(t, event)
+	assert.Equal(t, byte(binlogRotateEvent), readTestEvent(t, client)[4])
+	assert.Equal(t, byte(binlogFormatDescriptionEvent), readTestEvent(t, client)[4])
+}
+
+func TestBinlogServer_DumpNotArchived(t *testing.T) {
+	server := newTestBinlogServer(t)
+	client := dumpTestBinlogs(server, "mysql-bin.000042", BinlogMagicLength)
+	packet, err := client.readPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(mysqlPacketErr), packet[0])
+	assert.Contains(t, string(packet), "mysql-bin.000042")
+}
+
+// testBinlogRotatePosition is the position of Rotate event in mysql-bin.000001
+var testBinlogRotatePosition uint32
+
+func newTestBinlogServer(t *testing.T) *BinlogServer {
+	logFolder := memory.NewFolder("in_memory/", memory.NewStorage()).GetSubFolder(BinlogPath)
+	server := &BinlogServer{logFolder: logFolder, serverID: 99999, checksum: true}
+	putTestServerBinlog(t, server, "mysql-bin.000001", true)
+	putTestServerBinlog(t, server, "mysql-bin.000002", false)
+	server, err := newBinlogServer(logFolder, "repl", "secret", 99999)
+	assert.NoError(t, err)
+	server.pollInterval = 10 * time.Millisecond
+	return server
+}
+
+// putTestServerBinlog puts the binlog of Format_description, Query and optionally Rotate events with checksums
+func putTestServerBinlog(t *testing.T, server *BinlogServer, name string, rotate bool) {
+	binlog := bytes.NewBuffer(append([]byte{}, BinlogMagic[:]...))
+	formatDescription := make([]byte, 2+50+4+1+1)
+	formatDescription[0], formatDescription[len(formatDescription)-1] = 4, binlogChecksumAlgorithmCRC32
+	for _, event := range [][]byte{
+		server.makeEvent(binlogFormatDescriptionEvent, 0, 0, formatDescription),
+		server.makeEvent(binlogQueryEvent, 0, 0, []byte("BEGIN")),
+	} {
+		setEventLogPosition(event, uint32(binlog.Len()+len(event)), true)
+		binlog.Write(event)
+	}
+	if rotate {
+		testBinlogRotatePosition = uint32(binlog.Len())
+		body := make([]byte, 8)
+		binary.LittleEndian.PutUint64(body, BinlogMagicLength)
+		event := server.makeEvent(binlogRotateEvent, 0, 0, append(body, "mysql-bin.000002"...))
+		setEventLogPosition(event, uint32(binlog.Len()+len(event)), true)
+		binlog.Write(event)
+	}
+	content := internal.CompressAndEncrypt(binlog, compression.Compressors[lz4.AlgorithmName], nil)
+	assert.NoError(t, server.logFolder.PutObject(name+"."+lz4.FileExtension, content))
+}
+
+// dumpTestBinlogs starts the dump in the session of the server and returns the client side of the connection
+func dumpTestBinlogs(server *BinlogServer, binlog string, position uint32) *mysqlPacketConn {
+	clientConn, serverConn := net.Pipe()
+	session := &binlogServerSession{server: server, conn: newMysqlPacketConn(serverConn), remote: "test"}
+	session.conn.sequence = 1
+	go func() {
+		_ = session.dumpBinlogs(binlog, position)
+		_ = serverConn.Close()
+	}()
+	client := newMysqlPacketConn(clientConn)
+	client.sequence = 1
+	return client
+}
+
+func readTestEvent(t *testing.T, client *mysqlPacketConn) []byte {
+	packet, err := client.readPacket()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(mysqlPacketOK), packet[0], string(packet))
+	event := packet[1:]
+	assert.Equal(t, uint32(len(event)), binary.LittleEndian.Uint32(event[9:]))
+	assertTestEventChecksum(t, event)
+	return event
+}
+
+func assertTestEventChecksum(t *testing.T, event []byte) {
+	checksumOffset := len(event) - crc32.Size
+	assert.Equal(t, crc32.ChecksumIEEE(event[:checksumOffset]), binary.LittleEndian.Uint32(event[checksumOffset:]))
+}
+
+func assertArtificialRotate(t *testing.T, server *BinlogServer, event []byte, binlog string) {
+	assert.Equal(t, byte(binlogRotateEvent), event[4])
+	assert.Equal(t, server.serverID, binary.LittleEndian.Uint32(event[5:]))
+	assert.Equal(t, uint16(binlogArtificialFlag), binary.LittleEndian.Uint16(event[17:]))
+	assert.Equal(t, binlog, string(event[binlogEventHeaderV4Size+8:len(event)-crc32.Size]))
+}
@@ -0,0 +1,91 @@
+package mysql
+
+import (
+	"archive/tar"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const cloneDirPrefix = "wal-g-clone-"
+
+// pushClone clones the server with the CLONE plugin of MySQL 8.0.17+ to a new directory in WALG_MYSQL_CLONE_DIR
+// and uploads the directory as a tar stream. The cloned directory is consistent, it needs no prepare.
+func pushClone(db *sql.DB, uploader *internal.Uploader, fileName string) error {
+	parentDir, ok := internal.GetSetting(internal.MysqlCloneDirSetting)
+	if !ok {
+		return errors.Errorf("%s is required for %s backups", internal.MysqlCloneDirSetting, BackupToolClone)
+	}
+	cloneDir := filepath.Join(parentDir, cloneDirPrefix+fileName)
+	tracelog.InfoLogger.Printf("Cloning data directory to %s\n", cloneDir)
+	// the directory is removed even if clone fails, since the server may have created it
+	defer func() {
+		if err := os.RemoveAll(cloneDir); err != nil {
+			tracelog.WarningLogger.Printf("Failed to remove cloned data directory %s: %v\n", cloneDir, err)
+		}
+	}()
+	// CLONE doesn't support placeholders of prepared statements
+	if _, err := db.Exec(fmt.Sprintf("CLONE LOCAL DATA DIRECTORY = '%s'", escapeSQLString(cloneDir))); err != nil {
+		return errors.Wrap(err, "failed to clone data directory")
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(writeDirectoryTar(writer, cloneDir))
+	}()
+	err := uploader.PushStreamAs(reader, fileName)
+	_ = reader.CloseWithError(err)
+	return errors.Wrap(err, "failed to push cloned data directory")
+}
+
+// writeDirectoryTar writes the content of the directory as a tar archive with paths relative to the directory
+func writeDirectoryTar(output io.Writer, dir string) error {
+	tarWriter := tar.NewWriter(output)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err = tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer utility.LoggedClose(file, "")
+		_, err = io.Copy(tarWriter, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tarWriter.Close()
+}
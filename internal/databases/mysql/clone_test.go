@@ -0,0 +1,43 @@
+package mysql
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDirectoryTar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal-g-test-clone")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "mysql"), 0750))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ibdata1"), []byte("system tablespace"), 0640))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "mysql", "user.ibd"), []byte("users"), 0640))
+
+	var archive bytes.Buffer
+	assert.NoError(t, writeDirectoryTar(&archive, dir))
+
+	contents := make(map[string]string)
+	reader := tar.NewReader(&archive)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		content, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		contents[header.Name] = string(content)
+	}
+	assert.Equal(t, map[string]string{
+		"ibdata1":        "system tablespace",
+		"mysql/":         "",
+		"mysql/user.ibd": "users",
+	}, contents)
+}
@@ -0,0 +1,120 @@
+package mysql
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// xtrabackupGaleraInfoFile is written to the backup by xtrabackup and mariabackup with --galera-info
+const xtrabackupGaleraInfoFile = "xtrabackup_galera_info"
+
+// GaleraCoordinates is the position of the Galera (e.g. Percona XtraDB Cluster) node, on which the backup is made,
+// in the replication stream of its cluster
+type GaleraCoordinates struct {
+	ClusterUUID string `json:"ClusterUUID"`
+	// Seqno is the last write set in the backup, as recorded in xtrabackup_galera_info
+	Seqno int64 `json:"Seqno"`
+}
+
+// getGaleraCoordinates returns coordinates of the node, or nil if the server is not a Galera cluster node.
+// Its seqno is replaced by the one of the backup data with getBackupGaleraCoordinates.
+func getGaleraCoordinates(db *sql.DB) (*GaleraCoordinates, error) {
+	rows, err := db.Query("SHOW GLOBAL STATUS WHERE Variable_name IN ('wsrep_cluster_state_uuid', 'wsrep_last_committed')")
+	if err != nil {
+		return nil, err
+	}
+	defer utility.LoggedClose(rows, "")
+	status := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err = rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		status[name] = value
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	clusterUUID, seqno := status["wsrep_cluster_state_uuid"], status["wsrep_last_committed"]
+	if clusterUUID == "" || seqno == "" {
+		return nil, nil
+	}
+	coordinates := &GaleraCoordinates{ClusterUUID: clusterUUID}
+	if coordinates.Seqno, err = strconv.ParseInt(seqno, 10, 64); err != nil {
+		return nil, errors.Wrapf(err, "unexpected wsrep_last_committed '%s'", seqno)
+	}
+	return coordinates, nil
+}
+
+// getBackupGaleraCoordinates sets the seqno of the backup data from xtrabackup_galera_info, which xtrabackup writes
+// under the backup lock at the end of the backup. wsrep_last_committed read before the backup doesn't match the data,
+// so without xtrabackup_galera_info the coordinates are not recorded.
+func getBackupGaleraCoordinates(galera *GaleraCoordinates, galeraInfo []byte) *GaleraCoordinates {
+	if galera == nil {
+		return nil
+	}
+	if galeraInfo == nil {
+		tracelog.WarningLogger.Printf("Backup is made on a Galera cluster node, but %s is not found in the backup, "+
+			"Galera coordinates are not recorded: the backup command must pass --galera-info\n", xtrabackupGaleraInfoFile)
+		return nil
+	}
+	coordinates, err := parseGaleraInfo(string(galeraInfo))
+	if err != nil {
+		tracelog.WarningLogger.Printf("Galera coordinates are not recorded: %v\n", err)
+		return nil
+	}
+	return coordinates
+}
+
+// parseGaleraInfo parses xtrabackup_galera_info, which starts with the cluster UUID and seqno as uuid:seqno,
+// mariabackup also writes the GTID after them
+func parseGaleraInfo(galeraInfo string) (*GaleraCoordinates, error) {
+	fields := strings.Fields(galeraInfo)
+	if len(fields) == 0 {
+		return nil, errors.Errorf("%s is empty", xtrabackupGaleraInfoFile)
+	}
+	separator := strings.LastIndex(fields[0], ":")
+	if separator <= 0 {
+		return nil, errors.Errorf("unrecognized %s: %s", xtrabackupGaleraInfoFile, galeraInfo)
+	}
+	seqno, err := strconv.ParseInt(fields[0][separator+1:], 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unexpected seqno in %s", xtrabackupGaleraInfoFile)
+	}
+	return &GaleraCoordinates{ClusterUUID: fields[0][:separator], Seqno: seqno}, nil
+}
+
+// desyncGaleraNode enables wsrep_desync, so that the node, slowed down by the backup, doesn't stall the cluster
+// with flow control. It returns false if the node was already desynced by someone else and must be left as is.
+func desyncGaleraNode(db *sql.DB) (bool, error) {
+	var wsrepOn, wsrepDesync bool
+	if err := db.QueryRow("SELECT @@GLOBAL.wsrep_on, @@GLOBAL.wsrep_desync").Scan(&wsrepOn, &wsrepDesync); err != nil {
+		return false, errors.Wrap(err, "failed to check wsrep_desync, the server is not a Galera cluster node")
+	}
+	if !wsrepOn {
+		return false, errors.New("wsrep_on is disabled, the server is not a Galera cluster node")
+	}
+	if wsrepDesync {
+		tracelog.WarningLogger.Println("Galera node is already desynced, it won't be re-synced after backup")
+		return false, nil
+	}
+	if _, err := db.Exec("SET GLOBAL wsrep_desync = ON"); err != nil {
+		return false, errors.Wrap(err, "failed to desync Galera node")
+	}
+	tracelog.InfoLogger.Println("Galera node is desynced for backup")
+	return true, nil
+}
+
+// resyncGaleraNode disables wsrep_desync, the node catches up with the cluster before flow control is applied to it
+func resyncGaleraNode(db *sql.DB) {
+	if _, err := db.Exec("SET GLOBAL wsrep_desync = OFF"); err != nil {
+		tracelog.ErrorLogger.Printf("Failed to re-sync Galera node, run 'SET GLOBAL wsrep_desync = OFF' on it: %v\n", err)
+		return
+	}
+	tracelog.InfoLogger.Println("Galera node is re-synced")
+}
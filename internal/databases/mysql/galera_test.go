@@ -0,0 +1,30 @@
+package mysql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetBackupGaleraCoordinates(t *testing.T) {
+	galera := &GaleraCoordinates{ClusterUUID: "e7bd6f45-7a3b-11ea-a4f1-2e1a5d4d6f80", Seqno: 10}
+	galeraInfo := "e7bd6f45-7a3b-11ea-a4f1-2e1a5d4d6f80:42\n"
+
+	assert.Equal(t, &GaleraCoordinates{ClusterUUID: "e7bd6f45-7a3b-11ea-a4f1-2e1a5d4d6f80", Seqno: 42},
+		getBackupGaleraCoordinates(galera, []byte(galeraInfo)))
+}
+
+func TestGetBackupGaleraCoordinates_MariaDB(t *testing.T) {
+	galera := &GaleraCoordinates{ClusterUUID: "e7bd6f45-7a3b-11ea-a4f1-2e1a5d4d6f80", Seqno: 10}
+	galeraInfo := "e7bd6f45-7a3b-11ea-a4f1-2e1a5d4d6f80:42 0-1-42\n"
+
+	assert.Equal(t, &GaleraCoordinates{ClusterUUID: "e7bd6f45-7a3b-11ea-a4f1-2e1a5d4d6f80", Seqno: 42},
+		getBackupGaleraCoordinates(galera, []byte(galeraInfo)))
+}
+
+func TestGetBackupGaleraCoordinates_WithoutGaleraInfo(t *testing.T) {
+	galera := &GaleraCoordinates{ClusterUUID: "e7bd6f45-7a3b-11ea-a4f1-2e1a5d4d6f80", Seqno: 10}
+	assert.Nil(t, getBackupGaleraCoordinates(galera, nil))
+	assert.Nil(t, getBackupGaleraCoordinates(galera, []byte("garbage")))
+	assert.Nil(t, getBackupGaleraCoordinates(nil, []byte("e7bd6f45-7a3b-11ea-a4f1-2e1a5d4d6f80:42")))
+}
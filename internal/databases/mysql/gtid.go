@@ -0,0 +1,319 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	// https://dev.mysql.com/doc/internals/en/binlog-event-header.html
+	binlogEventHeaderV4Size       = 19
+	binlogPreviousGtidsEvent      = 35
+	binlogFormatDescriptionEvent  = 15
+	binlogPreviousGtidsMaxEvents  = 4
+	binlogPreviousGtidsSidLength  = 16
+	binlogPreviousGtidsMaxEventSz = 16 * utility.Mebibyte
+	binlogChecksumAlgorithmOffset = 5
+	binlogChecksumAlgorithmCRC32  = 1
+)
+
+type gtidInterval struct {
+	start uint64
+	end   uint64
+}
+
+// gtidSet maps server UUIDs to sorted non-overlapping intervals of transaction numbers, both ends are inclusive
+type gtidSet map[string][]gtidInterval
+
+// parseGtidSet parses GTID set in the text form of gtid_executed, e.g. 3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5:11
+func parseGtidSet(text string) (gtidSet, error) {
+	set := gtidSet{}
+	text = strings.NewReplacer(" ", "", "\n", "", "\t", "").Replace(text)
+	if text == "" {
+		return set, nil
+	}
+	for _, gtids := range strings.Split(text, ",") {
+		parts := strings.Split(gtids, ":")
+		if len(parts) < 2 {
+			return nil, errors.Errorf("invalid GTID set '%s'", text)
+		}
+		uuid := strings.ToLower(parts[0])
+		for _, interval := range parts[1:] {
+			bounds := strings.SplitN(interval, "-", 2)
+			start, err := strconv.ParseUint(bounds[0], 10, 64)
+			if err != nil {
+				return nil, errors.Errorf("invalid GTID set '%s'", text)
+			}
+			end := start
+			if len(bounds) == 2 {
+				if end, err = strconv.ParseUint(bounds[1], 10, 64); err != nil || end < start {
+					return nil, errors.Errorf("invalid GTID set '%s'", text)
+				}
+			}
+			set.add(uuid, gtidInterval{start, end})
+		}
+	}
+	return set, nil
+}
+
+func (set gtidSet) add(uuid string, interval gtidInterval) {
+	intervals := append(set[uuid], interval)
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].start < intervals[j].start
+	})
+	merged := intervals[:1]
+	for _, next := range intervals[1:] {
+		last := &merged[len(merged)-1]
+		if next.start <= last.end+1 {
+			if next.end > last.end {
+				last.end = next.end
+			}
+			continue
+		}
+		merged = append(merged, next)
+	}
+	set[uuid] = merged
+}
+
+// contains checks if every transaction of the other set is in the set
+func (set gtidSet) contains(other gtidSet) bool {
+	for uuid, intervals := range other {
+		for _, interval := range intervals {
+			if !set.containsInterval(uuid, interval) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (set gtidSet) containsInterval(uuid string, interval gtidInterval) bool {
+	for _, own := range set[uuid] {
+		if own.start <= interval.start && interval.end <= own.end {
+			return true
+		}
+	}
+	return false
+}
+
+// readBinlogPreviousGtids reads the Previous_gtids event from the beginning of the binlog,
+// which is the set of transactions executed before the binlog. Nil is returned if there is no such event.
+func readBinlogPreviousGtids(reader io.Reader) (gtidSet, error) {
+	head, err := readBinlogHead(reader)
+	return head.previousGtids, err
+}
+
+// binlogHead is what is known about the binlog from the events at its beginning
+type binlogHead struct {
+	// checksum is true if events end with CRC32 checksum
+	checksum      bool
+	previousGtids gtidSet
+}
+
+// readBinlogHead reads Format_description and Previous_gtids events from the beginning of the binlog
+func readBinlogHead(reader io.Reader) (binlogHead, error) {
+	var head binlogHead
+	magic := make([]byte, BinlogMagicLength)
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return head, err
+	}
+	if string(magic) != string(BinlogMagic[:]) {
+		return head, fmt.Errorf("incorrect binlog magic: %v", magic)
+	}
+	header := make([]byte, binlogEventHeaderV4Size)
+	for i := 0; i < binlogPreviousGtidsMaxEvents; i++ {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return head, err
+		}
+		event := ParseEventHeader(header)
+		if event.EventLength < binlogEventHeaderV4Size || event.EventLength > binlogPreviousGtidsMaxEventSz {
+			return head, fmt.Errorf("invalid binlog event length %d", event.EventLength)
+		}
+		body := make([]byte, event.EventLength-binlogEventHeaderV4Size)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return head, err
+		}
+		if event.TypeCode == binlogPreviousGtidsEvent {
+			var err error
+			head.previousGtids, err = parsePreviousGtidsEvent(body)
+			return head, err
+		}
+		if event.TypeCode != binlogFormatDescriptionEvent {
+			break
+		}
+		head.checksum = parseFormatDescriptionChecksum(body)
+	}
+	return head, nil
+}
+
+// parseFormatDescriptionChecksum checks the checksum algorithm of the binlog, which is the byte before
+// the checksum of Format_description event itself. The event always has space for the checksum.
+func parseFormatDescriptionChecksum(body []byte) bool {
+	if len(body) < binlogChecksumAlgorithmOffset {
+		return false
+	}
+	return body[len(body)-binlogChecksumAlgorithmOffset] == binlogChecksumAlgorithmCRC32
+}
+
+// parsePreviousGtidsEvent parses the event body: number of UUIDs, and for each UUID its intervals,
+// where the end of an interval is exclusive. Checksum after the body is ignored.
+func parsePreviousGtidsEvent(body []byte) (gtidSet, error) {
+	le := binary.LittleEndian
+	errTruncated := errors.New("truncated Previous_gtids binlog event")
+	if len(body) < 8 {
+		return nil, errTruncated
+	}
+	set := gtidSet{}
+	sidCount := le.Uint64(body)
+	offset := 8
+	for i := uint64(0); i < sidCount; i++ {
+		if len(body) < offset+binlogPreviousGtidsSidLength+8 {
+			return nil, errTruncated
+		}
+		sid := hex.EncodeToString(body[offset : offset+binlogPreviousGtidsSidLength])
+		uuid := fmt.Sprintf("%s-%s-%s-%s-%s", sid[0:8], sid[8:12], sid[12:16], sid[16:20], sid[20:32])
+		offset += binlogPreviousGtidsSidLength
+		intervalCount := le.Uint64(body[offset:])
+		offset += 8
+		for j := uint64(0); j < intervalCount; j++ {
+			if len(body) < offset+16 {
+				return nil, errTruncated
+			}
+			start, end := le.Uint64(body[offset:]), le.Uint64(body[offset+8:])
+			offset += 16
+			if end > start {
+				set.add(uuid, gtidInterval{start, end - 1})
+			}
+		}
+	}
+	return set, nil
+}
+
+// getMySQLGtidExecuted returns gtid_executed of the server, or empty string if it has no GTIDs, e.g. it's MariaDB
+func getMySQLGtidExecuted(db *sql.DB) string {
+	var gtidExecuted string
+	err := db.QueryRow("SELECT @@global.gtid_executed").Scan(&gtidExecuted)
+	if err != nil {
+		tracelog.DebugLogger.Printf("Failed to get gtid_executed: %v", err)
+		return ""
+	}
+	return gtidExecuted
+}
+
+// getBinlogPurgeBoundary returns the first binlog needed to roll the backup forward.
+// Binlogs before the backup start binlog are checked with Previous_gtids of their successors:
+// a binlog is kept if it has transactions missing in GTIDs of the backup.
+// Without GTIDs in the sentinel the backup start binlog is the boundary.
+func getBinlogPurgeBoundary(folder storage.Folder, sentinel StreamSentinelDto) (string, error) {
+	if sentinel.GtidExecuted == "" {
+		return sentinel.BinLogStart, nil
+	}
+	backupGtids, err := parseGtidSet(sentinel.GtidExecuted)
+	if err != nil {
+		return "", err
+	}
+	logFolder := folder.GetSubFolder(BinlogPath)
+	logFiles, _, err := logFolder.ListFolder()
+	if err != nil {
+		return "", err
+	}
+	binlogs := make([]string, 0, len(logFiles))
+	for _, logFile := range logFiles {
+		if _, isGap := parseBinlogGapName(logFile.GetName()); !isGap {
+			binlogs = append(binlogs, utility.TrimFileExtension(logFile.GetName()))
+		}
+	}
+	sort.Strings(binlogs)
+	next := sort.SearchStrings(binlogs, sentinel.BinLogStart)
+	if next >= len(binlogs) || binlogs[next] != sentinel.BinLogStart {
+		// the start binlog is not archived yet, binlogs before it can't be checked
+		next = len(binlogs)
+	}
+	for ; next > 0 && next < len(binlogs); next-- {
+		previousGtids, err := downloadBinlogPreviousGtids(logFolder, binlogs[next])
+		if err != nil {
+			return "", err
+		}
+		if previousGtids == nil {
+			// the binlog is written without GTIDs, so are binlogs before it
+			return binlogs[next], nil
+		}
+		if backupGtids.contains(previousGtids) {
+			return binlogs[next], nil
+		}
+		tracelog.InfoLogger.Printf("Binlog %s has transactions missing in backup GTIDs, it's kept\n",
+			binlogs[next-1])
+	}
+	if next < len(binlogs) {
+		return binlogs[next], nil
+	}
+	return sentinel.BinLogStart, nil
+}
+
+// isBinlogAfterGtids checks if Previous_gtids of the local binlog contain the GTID set,
+// so all of its transactions are in the preceding binlogs
+func isBinlogAfterGtids(binlogPath string, gtids gtidSet) (bool, error) {
+	file, err := os.Open(binlogPath)
+	if err != nil {
+		return false, err
+	}
+	defer utility.LoggedClose(file, "")
+	previousGtids, err := readBinlogPreviousGtids(file)
+	if err != nil {
+		return false, err
+	}
+	return previousGtids != nil && previousGtids.contains(gtids), nil
+}
+
+// getBinlogStartTsByGtids returns the upload time of the first archived binlog,
+// which has transactions missing in the GTID set
+func getBinlogStartTsByGtids(folder storage.Folder, gtids string) (time.Time, error) {
+	logFiles, _, err := folder.GetSubFolder(BinlogPath).ListFolder()
+	if err != nil {
+		return time.Time{}, err
+	}
+	uploadTimes := make(map[string]time.Time, len(logFiles))
+	var lastBinlog string
+	for _, logFile := range logFiles {
+		if _, isGap := parseBinlogGapName(logFile.GetName()); isGap {
+			continue
+		}
+		binlog := utility.TrimFileExtension(logFile.GetName())
+		uploadTimes[binlog] = logFile.GetLastModified()
+		if binlog > lastBinlog {
+			lastBinlog = binlog
+		}
+	}
+	if lastBinlog == "" {
+		return time.Time{}, errors.New("no binlogs are archived")
+	}
+	// the search for binlogs needed by a backup with the GTIDs from the last archived binlog
+	first, err := getBinlogPurgeBoundary(folder, StreamSentinelDto{BinLogStart: lastBinlog, GtidExecuted: gtids})
+	if err != nil {
+		return time.Time{}, err
+	}
+	tracelog.InfoLogger.Printf("Binlog %s is the first with transactions missing in %s\n", first, gtids)
+	return uploadTimes[first], nil
+}
+
+func downloadBinlogPreviousGtids(logFolder storage.Folder, binlog string) (gtidSet, error) {
+	reader, err := downloadBinlog(logFolder, binlog)
+	if err != nil {
+		return nil, err
+	}
+	defer utility.LoggedClose(reader, "")
+	return readBinlogPreviousGtids(reader)
+}
@@ -0,0 +1,143 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const testServerUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+func TestParseGtidSet(t *testing.T) {
+	set, err := parseGtidSet("3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5:6-10:15,\n" +
+		"2174B383-5441-11E8-B90A-C80AA9429562:7")
+	assert.NoError(t, err)
+	assert.Equal(t, gtidSet{
+		testServerUUID:                         {{1, 10}, {15, 15}},
+		"2174b383-5441-11e8-b90a-c80aa9429562": {{7, 7}},
+	}, set)
+
+	_, err = parseGtidSet("mysql-bin.000001")
+	assert.Error(t, err)
+}
+
+func TestGtidSetContains(t *testing.T) {
+	set, _ := parseGtidSet(testServerUUID + ":1-10:15-20")
+	other, _ := parseGtidSet(testServerUUID + ":3-7:15")
+	assert.True(t, set.contains(other))
+	other, _ = parseGtidSet(testServerUUID + ":3-12")
+	assert.False(t, set.contains(other))
+	other, _ = parseGtidSet("2174B383-5441-11E8-B90A-C80AA9429562:1")
+	assert.False(t, set.contains(other))
+	assert.True(t, set.contains(gtidSet{}))
+}
+
+func TestReadBinlogPreviousGtids(t *testing.T) {
+	set, err := readBinlogPreviousGtids(bytes.NewReader(makeTestBinlog(1, 42)))
+	assert.NoError(t, err)
+	assert.Equal(t, gtidSet{testServerUUID: {{1, 41}}}, set)
+}
+
+func TestGetBinlogPurgeBoundary(t *testing.T) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	putTestBinlog(t, folder, "mysql-bin.000001", 1, 1)
+	putTestBinlog(t, folder, "mysql-bin.000002", 1, 10)
+	putTestBinlog(t, folder, "mysql-bin.000003", 1, 20)
+
+	boundary, err := getBinlogPurgeBoundary(folder, StreamSentinelDto{BinLogStart: "mysql-bin.000003",
+		GtidExecuted: testServerUUID + ":1-25"})
+	assert.NoError(t, err)
+	assert.Equal(t, "mysql-bin.000003", boundary)
+
+	// transactions 15..19 of mysql-bin.000002 are missing in the backup, e.g. it's restored from an older one
+	boundary, err = getBinlogPurgeBoundary(folder, StreamSentinelDto{BinLogStart: "mysql-bin.000003",
+		GtidExecuted: testServerUUID + ":1-14"})
+	assert.NoError(t, err)
+	assert.Equal(t, "mysql-bin.000002", boundary)
+
+	boundary, err = getBinlogPurgeBoundary(folder, StreamSentinelDto{BinLogStart: "mysql-bin.000003"})
+	assert.NoError(t, err)
+	assert.Equal(t, "mysql-bin.000003", boundary)
+}
+
+func TestIsBinlogAfterGtids(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlogs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	binlogPath := filepath.Join(dir, "mysql-bin.000003")
+	assert.NoError(t, ioutil.WriteFile(binlogPath, makeTestBinlog(1, 20), 0640))
+
+	reached, err := isBinlogAfterGtids(binlogPath, gtidSet{testServerUUID: {{1, 12}}})
+	assert.NoError(t, err)
+	assert.True(t, reached)
+	reached, err = isBinlogAfterGtids(binlogPath, gtidSet{testServerUUID: {{1, 25}}})
+	assert.NoError(t, err)
+	assert.False(t, reached)
+}
+
+func TestGetBinlogStartTsByGtids(t *testing.T) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	_, err := getBinlogStartTsByGtids(folder, testServerUUID+":1-14")
+	assert.Error(t, err)
+
+	putTestBinlog(t, folder, "mysql-bin.000001", 1, 1)
+	putTestBinlog(t, folder, "mysql-bin.000002", 1, 10)
+	putTestBinlog(t, folder, "mysql-bin.000003", 1, 20)
+	logFiles, _, err := folder.GetSubFolder(BinlogPath).ListFolder()
+	assert.NoError(t, err)
+	uploadTimes := make(map[string]time.Time)
+	for _, logFile := range logFiles {
+		uploadTimes[utility.TrimFileExtension(logFile.GetName())] = logFile.GetLastModified()
+	}
+
+	startTs, err := getBinlogStartTsByGtids(folder, testServerUUID+":1-14")
+	assert.NoError(t, err)
+	assert.Equal(t, uploadTimes["mysql-bin.000002"], startTs)
+	startTs, err = getBinlogStartTsByGtids(folder, testServerUUID+":1-25")
+	assert.NoError(t, err)
+	assert.Equal(t, uploadTimes["mysql-bin.000003"], startTs)
+}
+
+func putTestBinlog(t *testing.T, folder *memory.Folder, name string, start, end uint64) {
+	content := internal.CompressAndEncrypt(bytes.NewReader(makeTestBinlog(start, end)),
+		compression.Compressors[lz4.AlgorithmName], nil)
+	err := folder.GetSubFolder(BinlogPath).PutObject(name+"."+lz4.FileExtension, content)
+	assert.NoError(t, err)
+}
+
+// makeTestBinlog makes the beginning of a binlog with Previous_gtids event of the test server with [start, end)
+func makeTestBinlog(start, end uint64) []byte {
+	le := binary.LittleEndian
+	var binlog bytes.Buffer
+	binlog.Write(BinlogMagic[:])
+	writeEvent := func(typeCode byte, body []byte) {
+		header := make([]byte, binlogEventHeaderV4Size)
+		header[4] = typeCode
+		le.PutUint32(header[9:], uint32(binlogEventHeaderV4Size+len(body)))
+		binlog.Write(header)
+		binlog.Write(body)
+	}
+	writeEvent(binlogFormatDescriptionEvent, make([]byte, 100))
+	sid, _ := hex.DecodeString(strings.Replace(testServerUUID, "-", "", -1))
+	body := make([]byte, 8+16+8+16)
+	le.PutUint64(body, 1)
+	copy(body[8:], sid)
+	le.PutUint64(body[24:], 1)
+	le.PutUint64(body[32:], start)
+	le.PutUint64(body[40:], end)
+	writeEvent(binlogPreviousGtidsEvent, body)
+	return binlog.Bytes()
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/wal-g/storages/storage"
 	"io/ioutil"
 	"math"
+	"os"
 	"path"
 	"sort"
 	"strings"
@@ -47,17 +48,28 @@ func scanToMap(rows *sql.Rows, dst map[string]interface{}) error {
 }
 
 func getMySQLCurrentBinlogFile(db *sql.DB) (fileName string) {
+	fileName, _ = getMySQLCurrentBinlogPosition(db)
+	return fileName
+}
+
+func getMySQLCurrentBinlogPosition(db *sql.DB) (fileName string, position uint64) {
 	rows, err := db.Query("SHOW MASTER STATUS")
 	tracelog.ErrorLogger.FatalOnError(err)
 	defer utility.LoggedClose(rows, "")
 	var logFileName string
+	var logPosition uint64
 	for rows.Next() {
-		err = scanToMap(rows, map[string]interface{}{"File": &logFileName})
+		err = scanToMap(rows, map[string]interface{}{"File": &logFileName, "Position": &logPosition})
 		tracelog.ErrorLogger.FatalOnError(err)
-		return logFileName
+		return logFileName, logPosition
 	}
 	tracelog.ErrorLogger.Fatalf("Failed to obtain current binlog file")
-	return ""
+	return "", 0
+}
+
+func getMySQLVersion(db *sql.DB) (version string, err error) {
+	err = db.QueryRow("SELECT VERSION()").Scan(&version)
+	return version, err
 }
 
 func getMySQLConnection() (*sql.DB, error) {
@@ -127,26 +139,73 @@ type StreamSentinelDto struct {
 	BinLogStart    string `json:"BinLogStart,omitempty"`
 	BinLogEnd      string `json:"BinLogEnd,omitempty"`
 	StartLocalTime time.Time
+	// BinLogStartPosition is the position in BinLogStart at the start of the backup
+	BinLogStartPosition uint64 `json:"BinLogStartPosition,omitempty"`
+	FinishLocalTime     time.Time
+	// ServerVersion and Hostname describe the server the backup is made of
+	ServerVersion string `json:"ServerVersion,omitempty"`
+	Hostname      string `json:"Hostname,omitempty"`
+	// CompressedSize is the size of the uploaded backup stream, it's zero if the size is unknown
+	CompressedSize int64 `json:"CompressedSize,omitempty"`
+	// GtidExecuted is gtid_executed at the start of the backup, binlogs with other transactions are kept by delete
+	GtidExecuted string `json:"GtidExecuted,omitempty"`
+
+	// LSN range of the backup made by xtrabackup, increments are taken from ToLSN
+	FromLSN *uint64 `json:"FromLSN,omitempty"`
+	ToLSN   *uint64 `json:"ToLSN,omitempty"`
+	// IncrementFrom is the backup the increment is applied to, IncrementFullName is the full backup of the chain
+	IncrementFrom     *string `json:"IncrementFrom,omitempty"`
+	IncrementFullName *string `json:"IncrementFullName,omitempty"`
+	IncrementCount    *int    `json:"IncrementCount,omitempty"`
+	// Tool is xtrabackup or mariabackup, which made the backup
+	Tool string `json:"Tool,omitempty"`
+	// Replication is the position in the stream of the source at the start of the backup, if it's made on a replica
+	Replication *ReplicationCoordinates `json:"Replication,omitempty"`
+	// Galera is the position of the node in the replication stream of its Galera cluster at the start of the backup
+	Galera *GaleraCoordinates `json:"Galera,omitempty"`
+}
+
+func (dto *StreamSentinelDto) IsIncremental() bool {
+	return dto.IncrementFrom != nil
 }
 
 type binlogHandler interface {
 	handleBinlog(binlogPath string) error
 }
 
-func fetchLogs(folder storage.Folder, dstDir string, startTs time.Time, endTs time.Time, handler binlogHandler) error {
+// fetchLogs fetches binlogs uploaded since startTs until the binlog started after endTs.
+// If endGtids is not empty, fetch also stops before the binlog, which Previous_gtids contain all of endGtids.
+func fetchLogs(folder storage.Folder, dstDir string, startTs time.Time, endTs time.Time, endGtids gtidSet,
+	handler binlogHandler) error {
 	logFolder := folder.GetSubFolder(BinlogPath)
 	logsToFetch, err := getLogsCoveringInterval(logFolder, startTs)
 	if err != nil {
 		return err
 	}
-	for _, logFile := range logsToFetch {
-		binlogName := utility.TrimFileExtension(logFile.GetName())
-		binlogPath := path.Join(dstDir, binlogName)
-		tracelog.InfoLogger.Printf("downloading %s into %s", binlogName, binlogPath)
-		if err = internal.DownloadWALFileTo(logFolder, binlogName, binlogPath); err != nil {
-			tracelog.ErrorLogger.Printf("failed to download %s: %v", binlogName, err)
+	concurrency, err := internal.GetMaxConcurrency(internal.DownloadConcurrencySetting)
+	if err != nil {
+		return err
+	}
+	prefetcher := newBinlogPrefetcher(logFolder, dstDir, logsToFetch, concurrency)
+	defer prefetcher.cancel()
+	for index, logFile := range logsToFetch {
+		if gap, ok := parseBinlogGapName(logFile.GetName()); ok {
+			return newBinlogGapError(*gap)
+		}
+		binlogPath, err := prefetcher.get(index)
+		if err != nil {
 			return err
 		}
+		if len(endGtids) > 0 {
+			reached, err := isBinlogAfterGtids(binlogPath, endGtids)
+			if err != nil {
+				return err
+			}
+			if reached {
+				tracelog.InfoLogger.Printf("All transactions up to GTID are fetched before %s\n", path.Base(binlogPath))
+				return os.Remove(binlogPath)
+			}
+		}
 		timestamp, err := GetBinlogStartTimestamp(binlogPath)
 		if err != nil {
 			return err
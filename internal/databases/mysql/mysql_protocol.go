@@ -0,0 +1,296 @@
+package mysql
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Server side of MySQL client/server protocol, just enough for replicas to connect and dump binlogs:
+// https://dev.mysql.com/doc/internals/en/client-server-protocol.html
+const (
+	mysqlMaxPacketSize  = 1<<24 - 1
+	mysqlProtocolV10    = 10
+	mysqlAuthSaltLength = 20
+
+	mysqlClientLongPassword         = 0x00000001
+	mysqlClientConnectWithDB        = 0x00000008
+	mysqlClientProtocol41           = 0x00000200
+	mysqlClientTransactions         = 0x00002000
+	mysqlClientSecureConnection     = 0x00008000
+	mysqlClientPluginAuth           = 0x00080000
+	mysqlClientPluginAuthLenencData = 0x00200000
+	mysqlServerCapabilities         = mysqlClientLongPassword | mysqlClientConnectWithDB | mysqlClientProtocol41 |
+		mysqlClientTransactions | mysqlClientSecureConnection | mysqlClientPluginAuth | mysqlClientPluginAuthLenencData
+
+	mysqlNativePasswordPlugin = "mysql_native_password"
+	mysqlCharsetUtf8          = 33
+	mysqlStatusAutocommit     = 0x0002
+	mysqlTypeVarString        = 0xfd
+
+	mysqlPacketOK         = 0x00
+	mysqlPacketAuthSwitch = 0xfe
+	mysqlPacketEOF        = 0xfe
+	mysqlPacketErr        = 0xff
+	mysqlNullValue        = 0xfb
+)
+
+// mysqlPacketConn reads and writes packets of the protocol, the sequence is reset to zero by each command
+type mysqlPacketConn struct {
+	reader   *bufio.Reader
+	writer   io.Writer
+	sequence byte
+}
+
+func newMysqlPacketConn(conn io.ReadWriter) *mysqlPacketConn {
+	return &mysqlPacketConn{reader: bufio.NewReader(conn), writer: conn}
+}
+
+// readPacket reads the payload, joining packets of 16MB split by the sender
+func (conn *mysqlPacketConn) readPacket() ([]byte, error) {
+	var payload []byte
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(conn.reader, header); err != nil {
+			return nil, err
+		}
+		length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+		if header[3] != conn.sequence {
+			return nil, errors.Errorf("packet out of order: got sequence %d, expected %d", header[3], conn.sequence)
+		}
+		conn.sequence++
+		chunk := make([]byte, length)
+		if _, err := io.ReadFull(conn.reader, chunk); err != nil {
+			return nil, err
+		}
+		payload = append(payload, chunk...)
+		if length < mysqlMaxPacketSize {
+			return payload, nil
+		}
+	}
+}
+
+// writePacket writes the payload, splitting it to packets of 16MB
+func (conn *mysqlPacketConn) writePacket(payload []byte) error {
+	for {
+		length := minInt(len(payload), mysqlMaxPacketSize)
+		packet := make([]byte, 4, 4+length)
+		packet[0], packet[1], packet[2], packet[3] = byte(length), byte(length>>8), byte(length>>16), conn.sequence
+		conn.sequence++
+		if _, err := conn.writer.Write(append(packet, payload[:length]...)); err != nil {
+			return err
+		}
+		payload = payload[length:]
+		if length < mysqlMaxPacketSize {
+			return nil
+		}
+	}
+}
+
+func (conn *mysqlPacketConn) writeOK() error {
+	return conn.writePacket([]byte{mysqlPacketOK, 0, 0, mysqlStatusAutocommit, 0, 0, 0})
+}
+
+func (conn *mysqlPacketConn) writeEOF() error {
+	return conn.writePacket([]byte{mysqlPacketEOF, 0, 0, mysqlStatusAutocommit, 0})
+}
+
+func (conn *mysqlPacketConn) writeError(code uint16, state string, message string) error {
+	payload := []byte{mysqlPacketErr, byte(code), byte(code >> 8), '#'}
+	payload = append(payload, state...)
+	return conn.writePacket(append(payload, message...))
+}
+
+// writeResultSet writes text rows of string columns, nil values are NULL
+func (conn *mysqlPacketConn) writeResultSet(columns []string, rows [][]*string) error {
+	if err := conn.writePacket(appendLengthEncodedInt(nil, uint64(len(columns)))); err != nil {
+		return err
+	}
+	for _, column := range columns {
+		definition := appendLengthEncodedString(nil, "def")
+		for _, name := range []string{"", "", "", column, column} {
+			definition = appendLengthEncodedString(definition, name)
+		}
+		definition = append(definition, 0x0c, mysqlCharsetUtf8, 0, 0, 1, 0, 0, mysqlTypeVarString, 0, 0, 0, 0, 0)
+		if err := conn.writePacket(definition); err != nil {
+			return err
+		}
+	}
+	if err := conn.writeEOF(); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var payload []byte
+		for _, value := range row {
+			if value == nil {
+				payload = append(payload, mysqlNullValue)
+			} else {
+				payload = appendLengthEncodedString(payload, *value)
+			}
+		}
+		if err := conn.writePacket(payload); err != nil {
+			return err
+		}
+	}
+	return conn.writeEOF()
+}
+
+func (conn *mysqlPacketConn) writeHandshake(connectionID uint32, serverVersion string, salt []byte) error {
+	le := binary.LittleEndian
+	capabilities := uint32(mysqlServerCapabilities)
+	payload := append([]byte{mysqlProtocolV10}, serverVersion...)
+	payload = append(payload, 0, 0, 0, 0, 0)
+	le.PutUint32(payload[len(payload)-4:], connectionID)
+	payload = append(payload, salt[:8]...)
+	payload = append(payload, 0,
+		byte(capabilities), byte(capabilities>>8), mysqlCharsetUtf8, mysqlStatusAutocommit, 0,
+		byte(capabilities>>16), byte(capabilities>>24), byte(len(salt)+1))
+	payload = append(payload, make([]byte, 10)...)
+	payload = append(append(payload, salt[8:]...), 0)
+	return conn.writePacket(append(append(payload, mysqlNativePasswordPlugin...), 0))
+}
+
+// writeAuthSwitch asks the client to authenticate with mysql_native_password instead of its default plugin
+func (conn *mysqlPacketConn) writeAuthSwitch(salt []byte) error {
+	payload := append([]byte{mysqlPacketAuthSwitch}, mysqlNativePasswordPlugin...)
+	payload = append(append(payload, 0), salt...)
+	return conn.writePacket(append(payload, 0))
+}
+
+type mysqlHandshakeResponse struct {
+	user         string
+	authResponse []byte
+	plugin       string
+}
+
+func parseHandshakeResponse(data []byte) (*mysqlHandshakeResponse, error) {
+	errTruncated := errors.New("truncated handshake response")
+	if len(data) < 32 {
+		return nil, errTruncated
+	}
+	capabilities := binary.LittleEndian.Uint32(data)
+	if capabilities&mysqlClientProtocol41 == 0 {
+		return nil, errors.New("client doesn't support protocol 4.1")
+	}
+	response := &mysqlHandshakeResponse{}
+	data = data[32:]
+	var ok bool
+	if response.user, data, ok = readNulTerminatedString(data); !ok {
+		return nil, errTruncated
+	}
+	var authLength uint64
+	switch {
+	case capabilities&mysqlClientPluginAuthLenencData != 0:
+		var size int
+		if authLength, size = readLengthEncodedInt(data); size == 0 {
+			return nil, errTruncated
+		}
+		data = data[size:]
+	case capabilities&mysqlClientSecureConnection != 0 && len(data) > 0:
+		authLength, data = uint64(data[0]), data[1:]
+	default:
+		var auth string
+		if auth, data, ok = readNulTerminatedString(data); !ok {
+			return nil, errTruncated
+		}
+		response.authResponse = []byte(auth)
+	}
+	if uint64(len(data)) < authLength {
+		return nil, errTruncated
+	}
+	if authLength > 0 {
+		response.authResponse, data = data[:authLength], data[authLength:]
+	}
+	if capabilities&mysqlClientConnectWithDB != 0 {
+		if _, data, ok = readNulTerminatedString(data); !ok {
+			return nil, errTruncated
+		}
+	}
+	if capabilities&mysqlClientPluginAuth != 0 {
+		// the plugin name may lack the terminating zero at the end of the packet
+		response.plugin, _, _ = readNulTerminatedString(append(data, 0))
+	}
+	return response, nil
+}
+
+// newAuthSalt makes random printable salt, it must have no zero bytes as it's sent as a zero-terminated string
+func newAuthSalt() ([]byte, error) {
+	salt := make([]byte, mysqlAuthSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	for i := range salt {
+		salt[i] = salt[i]%94 + 33
+	}
+	return salt, nil
+}
+
+// scrambleNativePassword computes SHA1(password) XOR SHA1(salt + SHA1(SHA1(password))), empty for empty password
+func scrambleNativePassword(salt []byte, password string) []byte {
+	if password == "" {
+		return []byte{}
+	}
+	passwordHash := sha1.Sum([]byte(password))
+	passwordDoubleHash := sha1.Sum(passwordHash[:])
+	scramble := sha1.Sum(append(append([]byte{}, salt...), passwordDoubleHash[:]...))
+	for i := range scramble {
+		scramble[i] ^= passwordHash[i]
+	}
+	return scramble[:]
+}
+
+func appendLengthEncodedInt(buffer []byte, value uint64) []byte {
+	switch {
+	case value < 251:
+		return append(buffer, byte(value))
+	case value < 1<<16:
+		return append(buffer, 0xfc, byte(value), byte(value>>8))
+	case value < 1<<24:
+		return append(buffer, 0xfd, byte(value), byte(value>>8), byte(value>>16))
+	default:
+		encoded := make([]byte, 8)
+		binary.LittleEndian.PutUint64(encoded, value)
+		return append(append(buffer, 0xfe), encoded...)
+	}
+}
+
+func appendLengthEncodedString(buffer []byte, value string) []byte {
+	return append(appendLengthEncodedInt(buffer, uint64(len(value))), value...)
+}
+
+// readLengthEncodedInt returns the value and its size, the size is zero if data is truncated
+func readLengthEncodedInt(data []byte) (uint64, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	size := 1
+	switch data[0] {
+	case 0xfc:
+		size = 3
+	case 0xfd:
+		size = 4
+	case 0xfe:
+		size = 9
+	default:
+		return uint64(data[0]), 1
+	}
+	if len(data) < size {
+		return 0, 0
+	}
+	encoded := make([]byte, 8)
+	copy(encoded, data[1:size])
+	return binary.LittleEndian.Uint64(encoded), size
+}
+
+func readNulTerminatedString(data []byte) (string, []byte, bool) {
+	for i, value := range data {
+		if value == 0 {
+			return string(data[:i]), data[i+1:], true
+		}
+	}
+	return "", data, false
+}
@@ -0,0 +1,168 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// xtrabackupSlaveInfoFile is written to the backup by xtrabackup and mariabackup with --slave-info
+const xtrabackupSlaveInfoFile = "xtrabackup_slave_info"
+
+var (
+	slaveInfoLogFileRegexp      = regexp.MustCompile(`(?i)MASTER_LOG_FILE\s*=\s*'([^']*)'`)
+	slaveInfoLogPosRegexp       = regexp.MustCompile(`(?i)MASTER_LOG_POS\s*=\s*([0-9]+)`)
+	slaveInfoGtidPurgedRegexp   = regexp.MustCompile(`(?i)gtid_purged\s*=\s*'([^']*)'`)
+	slaveInfoAutoPositionRegexp = regexp.MustCompile(`(?i)MASTER_AUTO_POSITION\s*=\s*1`)
+)
+
+// ReplicationCoordinates is the position of the replica, on which the backup is made, in the stream of its source
+type ReplicationCoordinates struct {
+	SourceHost string `json:"SourceHost"`
+	SourcePort int64  `json:"SourcePort"`
+	// SourceLogFile and SourceLogPos are coordinates in binlogs of the source of the last event in the backup,
+	// ExecutedGtidSet is gtid_purged of the backup, they are taken from xtrabackup_slave_info
+	SourceLogFile   string `json:"SourceLogFile"`
+	SourceLogPos    uint64 `json:"SourceLogPos"`
+	ExecutedGtidSet string `json:"ExecutedGtidSet,omitempty"`
+	AutoPosition    bool   `json:"AutoPosition,omitempty"`
+	// RetrievedGtidSet and SecondsBehindSource are read at the start of the backup
+	RetrievedGtidSet    string `json:"RetrievedGtidSet,omitempty"`
+	SecondsBehindSource *int64 `json:"SecondsBehindSource,omitempty"`
+}
+
+// getReplicationCoordinates returns coordinates of the replica, or nil if the server is not a replica.
+// Its source position is replaced by the one of the backup data with getBackupReplicationCoordinates.
+// SHOW REPLICA STATUS of MySQL 8.0.22+ is tried first, then SHOW SLAVE STATUS of older MySQL and MariaDB.
+func getReplicationCoordinates(db *sql.DB) (*ReplicationCoordinates, error) {
+	rows, err := db.Query("SHOW REPLICA STATUS")
+	if err != nil {
+		tracelog.DebugLogger.Printf("SHOW REPLICA STATUS failed, trying SHOW SLAVE STATUS: %v", err)
+		rows, err = db.Query("SHOW SLAVE STATUS")
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer utility.LoggedClose(rows, "")
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var host, logFile, retrievedGtids, executedGtids sql.NullString
+	var port, secondsBehind, autoPosition sql.NullInt64
+	var logPos sql.NullInt64
+	err = scanToMap(rows, map[string]interface{}{
+		"Master_Host":           &host,
+		"Source_Host":           &host,
+		"Master_Port":           &port,
+		"Source_Port":           &port,
+		"Relay_Master_Log_File": &logFile,
+		"Relay_Source_Log_File": &logFile,
+		"Exec_Master_Log_Pos":   &logPos,
+		"Exec_Source_Log_Pos":   &logPos,
+		"Seconds_Behind_Master": &secondsBehind,
+		"Seconds_Behind_Source": &secondsBehind,
+		"Retrieved_Gtid_Set":    &retrievedGtids,
+		"Executed_Gtid_Set":     &executedGtids,
+		"Auto_Position":         &autoPosition,
+	})
+	if err != nil {
+		return nil, err
+	}
+	coordinates := &ReplicationCoordinates{
+		SourceHost:       host.String,
+		SourcePort:       port.Int64,
+		SourceLogFile:    logFile.String,
+		SourceLogPos:     uint64(logPos.Int64),
+		RetrievedGtidSet: strings.Replace(retrievedGtids.String, "\n", "", -1),
+		ExecutedGtidSet:  strings.Replace(executedGtids.String, "\n", "", -1),
+		AutoPosition:     autoPosition.Int64 == 1,
+	}
+	if secondsBehind.Valid {
+		coordinates.SecondsBehindSource = &secondsBehind.Int64
+	}
+	return coordinates, nil
+}
+
+// getBackupReplicationCoordinates sets the source position of the backup data from xtrabackup_slave_info,
+// which xtrabackup writes under the backup lock at the end of the backup. The position read by SHOW SLAVE STATUS
+// before the backup doesn't match the data, so without xtrabackup_slave_info the coordinates are not recorded.
+func getBackupReplicationCoordinates(replication *ReplicationCoordinates, slaveInfo []byte) *ReplicationCoordinates {
+	if replication == nil {
+		return nil
+	}
+	if slaveInfo == nil {
+		tracelog.WarningLogger.Printf("Backup is made on a replica, but %s is not found in the backup, "+
+			"replication coordinates are not recorded: the backup command must pass --slave-info\n", xtrabackupSlaveInfoFile)
+		return nil
+	}
+	if err := replication.setPositionFromSlaveInfo(string(slaveInfo)); err != nil {
+		tracelog.WarningLogger.Printf("Replication coordinates are not recorded: %v\n", err)
+		return nil
+	}
+	return replication
+}
+
+// setPositionFromSlaveInfo parses CHANGE MASTER TO statement of xtrabackup_slave_info, with the binlog coordinates
+// or MASTER_AUTO_POSITION=1 after SET GLOBAL gtid_purged
+func (coordinates *ReplicationCoordinates) setPositionFromSlaveInfo(slaveInfo string) error {
+	autoPosition := slaveInfoAutoPositionRegexp.MatchString(slaveInfo)
+	logFile := slaveInfoLogFileRegexp.FindStringSubmatch(slaveInfo)
+	logPos := slaveInfoLogPosRegexp.FindStringSubmatch(slaveInfo)
+	if !autoPosition && (logFile == nil || logPos == nil) {
+		return errors.Errorf("unrecognized %s: %s", xtrabackupSlaveInfoFile, slaveInfo)
+	}
+	coordinates.AutoPosition = autoPosition
+	coordinates.SourceLogFile, coordinates.SourceLogPos = "", 0
+	if logFile != nil && logPos != nil {
+		position, err := strconv.ParseUint(logPos[1], 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "unexpected binlog position in %s", xtrabackupSlaveInfoFile)
+		}
+		coordinates.SourceLogFile, coordinates.SourceLogPos = logFile[1], position
+	}
+	coordinates.ExecutedGtidSet = ""
+	if gtidPurged := slaveInfoGtidPurgedRegexp.FindStringSubmatch(slaveInfo); gtidPurged != nil {
+		coordinates.ExecutedGtidSet = strings.Replace(gtidPurged[1], "\n", "", -1)
+	}
+	return nil
+}
+
+// changeSourceSQL makes the statement to reposition the restored server as a replica of the same source.
+// Credentials are not known to WAL-G, so they must be given with CHANGE MASTER TO MASTER_USER, MASTER_PASSWORD.
+func (coordinates *ReplicationCoordinates) changeSourceSQL() string {
+	options := []string{
+		fmt.Sprintf("MASTER_HOST='%s'", escapeSQLString(coordinates.SourceHost)),
+		fmt.Sprintf("MASTER_PORT=%d", coordinates.SourcePort),
+	}
+	if coordinates.AutoPosition {
+		options = append(options, "MASTER_AUTO_POSITION=1")
+	} else {
+		options = append(options,
+			fmt.Sprintf("MASTER_LOG_FILE='%s'", escapeSQLString(coordinates.SourceLogFile)),
+			fmt.Sprintf("MASTER_LOG_POS=%d", coordinates.SourceLogPos))
+	}
+	return "CHANGE MASTER TO " + strings.Join(options, ", ") + ";\n"
+}
+
+func escapeSQLString(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+}
+
+// writeReplicationSQL writes the statement to reposition the restored server as a replica
+func writeReplicationSQL(path string, sentinel StreamSentinelDto) error {
+	if sentinel.Replication == nil {
+		tracelog.WarningLogger.Println("Backup is not made on a replica, replication statement is not written")
+		return nil
+	}
+	statement := sentinel.Replication.changeSourceSQL()
+	tracelog.InfoLogger.Printf("Backup is made on a replica of %s:%d, writing %s",
+		sentinel.Replication.SourceHost, sentinel.Replication.SourcePort, path)
+	return ioutil.WriteFile(path, []byte(statement), 0600)
+}
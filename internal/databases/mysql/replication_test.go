@@ -0,0 +1,70 @@
+package mysql
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeSourceSQL_LogPosition(t *testing.T) {
+	coordinates := ReplicationCoordinates{SourceHost: "db1.example.com", SourcePort: 3306,
+		SourceLogFile: "mysql-bin.000042", SourceLogPos: 1337}
+	assert.Equal(t, "CHANGE MASTER TO MASTER_HOST='db1.example.com', MASTER_PORT=3306, "+
+		"MASTER_LOG_FILE='mysql-bin.000042', MASTER_LOG_POS=1337;\n", coordinates.changeSourceSQL())
+}
+
+func TestChangeSourceSQL_AutoPosition(t *testing.T) {
+	coordinates := ReplicationCoordinates{SourceHost: "db'1", SourcePort: 3306, AutoPosition: true,
+		ExecutedGtidSet: testServerUUID + ":1-42"}
+	assert.Equal(t, "CHANGE MASTER TO MASTER_HOST='db\\'1', MASTER_PORT=3306, MASTER_AUTO_POSITION=1;\n",
+		coordinates.changeSourceSQL())
+}
+
+func TestWriteReplicationSQL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal-g-test-replication")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "replication.sql")
+
+	err = writeReplicationSQL(path, StreamSentinelDto{})
+	assert.NoError(t, err)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	err = writeReplicationSQL(path, StreamSentinelDto{Replication: &ReplicationCoordinates{SourceHost: "db1",
+		SourcePort: 3306, AutoPosition: true}})
+	assert.NoError(t, err)
+	statement, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "CHANGE MASTER TO MASTER_HOST='db1', MASTER_PORT=3306, MASTER_AUTO_POSITION=1;\n", string(statement))
+}
+
+func TestGetBackupReplicationCoordinates_LogPosition(t *testing.T) {
+	replication := &ReplicationCoordinates{SourceHost: "db1", SourcePort: 3306,
+		SourceLogFile: "mysql-bin.000001", SourceLogPos: 4, ExecutedGtidSet: testServerUUID + ":1-10"}
+	slaveInfo := "CHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000042', MASTER_LOG_POS=1337;\n"
+
+	assert.Equal(t, &ReplicationCoordinates{SourceHost: "db1", SourcePort: 3306,
+		SourceLogFile: "mysql-bin.000042", SourceLogPos: 1337},
+		getBackupReplicationCoordinates(replication, []byte(slaveInfo)))
+}
+
+func TestGetBackupReplicationCoordinates_AutoPosition(t *testing.T) {
+	replication := &ReplicationCoordinates{SourceHost: "db1", SourcePort: 3306, ExecutedGtidSet: testServerUUID + ":1-10"}
+	slaveInfo := "SET GLOBAL gtid_purged='" + testServerUUID + ":1-42';\nCHANGE MASTER TO MASTER_AUTO_POSITION=1;\n"
+
+	assert.Equal(t, &ReplicationCoordinates{SourceHost: "db1", SourcePort: 3306,
+		ExecutedGtidSet: testServerUUID + ":1-42", AutoPosition: true},
+		getBackupReplicationCoordinates(replication, []byte(slaveInfo)))
+}
+
+func TestGetBackupReplicationCoordinates_WithoutSlaveInfo(t *testing.T) {
+	replication := &ReplicationCoordinates{SourceHost: "db1", SourcePort: 3306,
+		SourceLogFile: "mysql-bin.000001", SourceLogPos: 4}
+	assert.Nil(t, getBackupReplicationCoordinates(replication, nil))
+	assert.Nil(t, getBackupReplicationCoordinates(replication, []byte("garbage")))
+	assert.Nil(t, getBackupReplicationCoordinates(nil, []byte("CHANGE MASTER TO MASTER_AUTO_POSITION=1;")))
+}
@@ -0,0 +1,169 @@
+package mysql
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	dumpUseRegexp      = regexp.MustCompile("^USE `([^`]+)`;")
+	dumpDatabaseRegexp = regexp.MustCompile("^-- Current Database: `([^`]+)`")
+	dumpTableRegexp    = regexp.MustCompile("^-- (?:Table structure for table|Dumping data for table|" +
+		"Temporary view structure for view|Final view structure for view|Temporary table structure for view) `([^`]+)`")
+	dumpDatabaseLevelRegexp = regexp.MustCompile("^-- Dumping (?:events|routines) for database")
+)
+
+// schemaFilter selects schemas and tables to restore, a table is given as schema.table
+type schemaFilter struct {
+	schemas map[string]bool
+	tables  map[string]map[string]bool
+}
+
+func newSchemaFilter(patterns []string) (*schemaFilter, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	filter := &schemaFilter{schemas: map[string]bool{}, tables: map[string]map[string]bool{}}
+	for _, pattern := range patterns {
+		parts := strings.Split(pattern, ".")
+		switch {
+		case len(parts) == 1 && parts[0] != "":
+			filter.schemas[parts[0]] = true
+		case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+			if filter.tables[parts[0]] == nil {
+				filter.tables[parts[0]] = map[string]bool{}
+			}
+			filter.tables[parts[0]][parts[1]] = true
+		default:
+			return nil, errors.Errorf("'%s' is neither a schema nor schema.table", pattern)
+		}
+	}
+	return filter, nil
+}
+
+// matchesSchema checks if the whole schema or some of its tables are selected
+func (filter *schemaFilter) matchesSchema(schema string) bool {
+	return filter.schemas[schema] || filter.tables[schema] != nil
+}
+
+func (filter *schemaFilter) matchesTable(schema, table string) bool {
+	return filter.schemas[schema] || filter.tables[schema][table]
+}
+
+// matchesPath checks if the file of xtrabackup backup is needed. Files outside of schema directories,
+// like the system tablespace and xtrabackup metadata, are always needed to prepare the backup.
+// Files of a table are named after it, e.g. t.ibd, t.frm, t#P#p0.ibd or t.ibd.delta in increments,
+// and db.opt with schema options is kept with any table.
+func (filter *schemaFilter) matchesPath(path string) bool {
+	path = strings.TrimPrefix(path, "./")
+	slash := strings.Index(path, "/")
+	if slash < 0 {
+		return true
+	}
+	schema, file := path[:slash], path[slash+1:]
+	if filter.schemas[schema] {
+		return true
+	}
+	if filter.tables[schema] == nil {
+		return false
+	}
+	table := file
+	if end := strings.IndexAny(file, ".#"); end >= 0 {
+		table = file[:end]
+	}
+	return filter.tables[schema][table] || file == "db.opt"
+}
+
+// filterSchemaStream copies only selected schemas and tables of the backup stream.
+// xbstream of xtrabackup is filtered by paths of its files, other streams are treated as SQL dumps.
+func filterSchemaStream(reader io.Reader, writer io.Writer, filter *schemaFilter) error {
+	bufferedReader := bufio.NewReader(reader)
+	magic, err := bufferedReader.Peek(len(xbstreamMagic))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if string(magic) == xbstreamMagic {
+		return filterXbstream(bufferedReader, writer, filter)
+	}
+	return filterSQLDump(bufferedReader, writer, filter)
+}
+
+// filterXbstream copies chunks of selected files
+func filterXbstream(reader io.Reader, writer io.Writer, filter *schemaFilter) error {
+	return readXbstream(reader, func(path string, header []byte, payload io.Reader) error {
+		if !filter.matchesPath(path) {
+			return nil
+		}
+		if _, err := writer.Write(header); err != nil {
+			return err
+		}
+		_, err := io.Copy(writer, payload)
+		return errors.Wrapf(err, "failed to copy xbstream chunk of %s", path)
+	})
+}
+
+// filterSQLDump copies statements of selected schemas and tables from mysqldump output.
+// Schemas are switched by USE statements, so the dump must be made with --databases or --all-databases,
+// and tables are found by comments of mysqldump before their sections. Statements before the first schema are kept.
+func filterSQLDump(reader *bufio.Reader, writer io.Writer, filter *schemaFilter) error {
+	var schema, table string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if match := dumpDatabaseRegexp.FindStringSubmatch(line); match != nil {
+			schema, table = match[1], ""
+		} else if match := dumpUseRegexp.FindStringSubmatch(line); match != nil {
+			schema, table = match[1], ""
+		} else if match := dumpTableRegexp.FindStringSubmatch(line); match != nil {
+			table = match[1]
+		} else if dumpDatabaseLevelRegexp.MatchString(line) {
+			table = ""
+		}
+		if schema == "" || filter.matchesSchema(schema) && (table == "" || filter.matchesTable(schema, table)) {
+			if _, writeErr := io.WriteString(writer, line); writeErr != nil {
+				return writeErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// schemaFilterWriter filters the backup stream written to it before passing it to the restore command
+type schemaFilterWriter struct {
+	*io.PipeWriter
+	done   chan error
+	result error
+	waited bool
+}
+
+func newSchemaFilterWriter(dst io.WriteCloser, filter *schemaFilter) *schemaFilterWriter {
+	reader, writer := io.Pipe()
+	filterWriter := &schemaFilterWriter{PipeWriter: writer, done: make(chan error, 1)}
+	go func() {
+		err := filterSchemaStream(reader, dst, filter)
+		_ = reader.CloseWithError(err)
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+		filterWriter.done <- err
+	}()
+	return filterWriter
+}
+
+// wait closes the writer if it's not closed yet and returns the error of filtering
+func (filterWriter *schemaFilterWriter) wait() error {
+	if !filterWriter.waited {
+		_ = filterWriter.PipeWriter.Close()
+		filterWriter.result = <-filterWriter.done
+		filterWriter.waited = true
+	}
+	return filterWriter.result
+}
@@ -0,0 +1,102 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaFilterMatchesPath(t *testing.T) {
+	filter, err := newSchemaFilter([]string{"shop", "crm.clients"})
+	assert.NoError(t, err)
+	assert.True(t, filter.matchesPath("ibdata1"))
+	assert.True(t, filter.matchesPath("xtrabackup_checkpoints"))
+	assert.True(t, filter.matchesPath("shop/orders.ibd"))
+	assert.True(t, filter.matchesPath("./crm/clients.ibd.delta"))
+	assert.True(t, filter.matchesPath("crm/clients#P#p0.ibd"))
+	assert.True(t, filter.matchesPath("crm/db.opt"))
+	assert.False(t, filter.matchesPath("crm/clients_archive.ibd"))
+	assert.False(t, filter.matchesPath("mysql/user.frm"))
+}
+
+func TestNewSchemaFilter_Invalid(t *testing.T) {
+	_, err := newSchemaFilter([]string{"crm.clients.id"})
+	assert.Error(t, err)
+	filter, err := newSchemaFilter(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, filter)
+}
+
+func TestFilterSchemaStream_SQLDump(t *testing.T) {
+	dump := "SET NAMES utf8mb4;\n" +
+		"-- Current Database: `crm`\n" +
+		"CREATE DATABASE `crm`;\n" +
+		"USE `crm`;\n" +
+		"-- Table structure for table `clients`\n" +
+		"CREATE TABLE `clients` (id int);\n" +
+		"-- Dumping data for table `clients`\n" +
+		"INSERT INTO `clients` VALUES (1);\n" +
+		"-- Table structure for table `leads`\n" +
+		"CREATE TABLE `leads` (id int);\n" +
+		"-- Current Database: `shop`\n" +
+		"USE `shop`;\n" +
+		"CREATE TABLE `orders` (id int);"
+	filter, _ := newSchemaFilter([]string{"crm.clients"})
+	var output bytes.Buffer
+	err := filterSchemaStream(strings.NewReader(dump), &output, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, "SET NAMES utf8mb4;\n"+
+		"-- Current Database: `crm`\n"+
+		"CREATE DATABASE `crm`;\n"+
+		"USE `crm`;\n"+
+		"-- Table structure for table `clients`\n"+
+		"CREATE TABLE `clients` (id int);\n"+
+		"-- Dumping data for table `clients`\n"+
+		"INSERT INTO `clients` VALUES (1);\n", output.String())
+}
+
+func TestFilterSchemaStream_Xbstream(t *testing.T) {
+	var stream bytes.Buffer
+	writeXbstreamChunk(&stream, "ibdata1", xbstreamChunkPayload, "system")
+	writeXbstreamChunk(&stream, "shop/orders.ibd", xbstreamChunkPayload, "orders")
+	writeXbstreamChunk(&stream, "crm/clients.ibd", xbstreamChunkPayload, "clients")
+	writeXbstreamChunk(&stream, "shop/orders.ibd", xbstreamChunkEOF, "")
+	writeXbstreamChunk(&stream, "crm/clients.ibd", xbstreamChunkEOF, "")
+
+	var expected bytes.Buffer
+	writeXbstreamChunk(&expected, "ibdata1", xbstreamChunkPayload, "system")
+	writeXbstreamChunk(&expected, "crm/clients.ibd", xbstreamChunkPayload, "clients")
+	writeXbstreamChunk(&expected, "crm/clients.ibd", xbstreamChunkEOF, "")
+
+	filter, _ := newSchemaFilter([]string{"crm"})
+	var output bytes.Buffer
+	err := filterSchemaStream(&stream, &output, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, expected.Bytes(), output.Bytes())
+}
+
+func TestFilterSchemaStream_XbstreamTruncated(t *testing.T) {
+	var stream bytes.Buffer
+	writeXbstreamChunk(&stream, "crm/clients.ibd", xbstreamChunkPayload, "clients")
+	filter, _ := newSchemaFilter([]string{"crm"})
+	err := filterSchemaStream(bytes.NewReader(stream.Bytes()[:stream.Len()-2]), &bytes.Buffer{}, filter)
+	assert.Error(t, err)
+}
+
+func writeXbstreamChunk(stream *bytes.Buffer, path string, chunkType byte, payload string) {
+	le := binary.LittleEndian
+	stream.WriteString(xbstreamMagic)
+	stream.WriteByte(0)
+	stream.WriteByte(chunkType)
+	_ = binary.Write(stream, le, uint32(len(path)))
+	stream.WriteString(path)
+	if chunkType == xbstreamChunkPayload {
+		_ = binary.Write(stream, le, uint64(len(payload)))
+		_ = binary.Write(stream, le, uint64(0))
+		_ = binary.Write(stream, le, uint32(0))
+		stream.WriteString(payload)
+	}
+}
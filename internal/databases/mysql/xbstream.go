@@ -0,0 +1,132 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	xbstreamMagic         = "XBSTCK01"
+	xbstreamChunkPayload  = 'P'
+	xbstreamChunkEOF      = 'E'
+	xbstreamMaxPathLength = 4096
+	// xbstreamMaxCollectedSize limits files collected from the stream, they are small metadata files
+	xbstreamMaxCollectedSize = utility.Mebibyte
+)
+
+// readXbstream reads chunks of the xbstream. Each chunk is the magic, flags, type, path length and path,
+// and payload chunks are followed by payload length, offset, checksum and the payload itself.
+// handleChunk gets the path and the header of the chunk and its payload, the unread part of payload is skipped.
+func readXbstream(reader io.Reader, handleChunk func(path string, header []byte, payload io.Reader) error) error {
+	le := binary.LittleEndian
+	for {
+		header := make([]byte, len(xbstreamMagic)+6)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.Wrap(err, "failed to read xbstream chunk")
+		}
+		if string(header[:len(xbstreamMagic)]) != xbstreamMagic {
+			return errors.New("invalid xbstream chunk magic")
+		}
+		chunkType := header[len(xbstreamMagic)+1]
+		pathLength := le.Uint32(header[len(xbstreamMagic)+2:])
+		if pathLength > xbstreamMaxPathLength {
+			return errors.Errorf("invalid xbstream path length %d", pathLength)
+		}
+		path := make([]byte, pathLength)
+		if _, err := io.ReadFull(reader, path); err != nil {
+			return errors.Wrap(err, "failed to read xbstream chunk")
+		}
+		chunk := bytes.NewBuffer(append(header, path...))
+		var payloadLength uint64
+		switch chunkType {
+		case xbstreamChunkEOF:
+		case xbstreamChunkPayload:
+			payloadHeader := make([]byte, 20)
+			if _, err := io.ReadFull(reader, payloadHeader); err != nil {
+				return errors.Wrap(err, "failed to read xbstream chunk")
+			}
+			chunk.Write(payloadHeader)
+			payloadLength = le.Uint64(payloadHeader)
+		default:
+			return errors.Errorf("unsupported xbstream chunk type '%c' of %s", chunkType, path)
+		}
+		payload := &io.LimitedReader{R: reader, N: int64(payloadLength)}
+		if err := handleChunk(string(path), chunk.Bytes(), payload); err != nil {
+			return err
+		}
+		if _, err := io.Copy(ioutil.Discard, payload); err != nil {
+			return errors.Wrapf(err, "failed to read xbstream chunk of %s", path)
+		}
+		if payload.N > 0 {
+			return errors.Wrapf(io.ErrUnexpectedEOF, "failed to read xbstream chunk of %s", path)
+		}
+	}
+}
+
+// xbstreamFileCollector collects metadata files, e.g. xtrabackup_slave_info, from the xbstream
+// made by xtrabackup or mariabackup while the stream is uploaded. The stream is written to the collector
+// and parsed in the background. Nothing is collected from other streams, e.g. made by mysqldump.
+type xbstreamFileCollector struct {
+	names  map[string]bool
+	files  map[string][]byte
+	writer *io.PipeWriter
+	done   chan struct{}
+}
+
+func newXbstreamFileCollector(names ...string) *xbstreamFileCollector {
+	reader, writer := io.Pipe()
+	collector := &xbstreamFileCollector{
+		names:  make(map[string]bool),
+		files:  make(map[string][]byte),
+		writer: writer,
+		done:   make(chan struct{}),
+	}
+	for _, name := range names {
+		collector.names[name] = true
+	}
+	go func() {
+		defer close(collector.done)
+		err := readXbstream(reader, collector.collectChunk)
+		if err != nil {
+			tracelog.DebugLogger.Printf("Backup metadata is not collected, the stream is not an xbstream: %v\n", err)
+			// the rest of the stream is drained, so the upload doesn't wait for the collector
+			_, _ = io.Copy(ioutil.Discard, reader)
+		}
+	}()
+	return collector
+}
+
+func (collector *xbstreamFileCollector) collectChunk(path string, header []byte, payload io.Reader) error {
+	if !collector.names[path] {
+		return nil
+	}
+	content, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return err
+	}
+	if len(collector.files[path])+len(content) > xbstreamMaxCollectedSize {
+		return errors.Errorf("%s is too large", path)
+	}
+	collector.files[path] = append(collector.files[path], content...)
+	return nil
+}
+
+func (collector *xbstreamFileCollector) Write(p []byte) (int, error) {
+	return collector.writer.Write(p)
+}
+
+// finish waits until the stream written so far is parsed and returns contents of the collected files by their paths
+func (collector *xbstreamFileCollector) finish() map[string][]byte {
+	_ = collector.writer.Close()
+	<-collector.done
+	return collector.files
+}
@@ -0,0 +1,37 @@
+package mysql
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXbstreamFileCollector(t *testing.T) {
+	var stream bytes.Buffer
+	writeXbstreamChunk(&stream, "ibdata1", xbstreamChunkPayload, "system")
+	writeXbstreamChunk(&stream, xtrabackupSlaveInfoFile, xbstreamChunkPayload, "CHANGE MASTER TO ")
+	writeXbstreamChunk(&stream, xtrabackupSlaveInfoFile, xbstreamChunkPayload, "MASTER_AUTO_POSITION=1;\n")
+	writeXbstreamChunk(&stream, xtrabackupSlaveInfoFile, xbstreamChunkEOF, "")
+	expected := stream.Bytes()
+
+	collector := newXbstreamFileCollector(xtrabackupSlaveInfoFile)
+	uploaded, err := ioutil.ReadAll(io.TeeReader(bytes.NewReader(expected), collector))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, uploaded)
+	assert.Equal(t, map[string][]byte{xtrabackupSlaveInfoFile: []byte("CHANGE MASTER TO MASTER_AUTO_POSITION=1;\n")},
+		collector.finish())
+}
+
+func TestXbstreamFileCollector_NotXbstream(t *testing.T) {
+	dump := strings.Repeat("INSERT INTO t VALUES (1);\n", 10000)
+
+	collector := newXbstreamFileCollector(xtrabackupSlaveInfoFile)
+	uploaded, err := ioutil.ReadAll(io.TeeReader(strings.NewReader(dump), collector))
+	assert.NoError(t, err)
+	assert.Equal(t, dump, string(uploaded))
+	assert.Empty(t, collector.finish())
+}
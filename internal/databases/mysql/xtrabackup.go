@@ -0,0 +1,168 @@
+package mysql
+
+import (
+	"bufio"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// Tools making physical backups, Percona xtrabackup for MySQL and mariabackup for MariaDB.
+// Clone backups are made by the CLONE plugin of the server itself.
+const (
+	BackupToolXtrabackup  = "xtrabackup"
+	BackupToolMariabackup = "mariabackup"
+	BackupToolClone       = "clone"
+)
+
+// Environment variables passed to backup, restore and prepare commands to make xtrabackup increments
+const (
+	// LsnDirEnv is a directory for xtrabackup --extra-lsndir, where it writes xtrabackup_checkpoints
+	LsnDirEnv = "WALG_MYSQL_LSN_DIR"
+	// IncrementalLsnEnv is the LSN for xtrabackup --incremental-lsn, it is set only for increments
+	IncrementalLsnEnv = "WALG_MYSQL_INCREMENTAL_LSN"
+	// IncrementalDirEnv is a directory where the increment is restored and prepared from, it is empty for full backups
+	IncrementalDirEnv = "WALG_MYSQL_INCREMENTAL_DIR"
+	// ApplyLogOnlyEnv is --apply-log-only for all but the last backup of the chain being prepared
+	ApplyLogOnlyEnv = "WALG_MYSQL_APPLY_LOG_ONLY"
+	// UseMemoryEnv is --use-memory with WALG_MYSQL_PREPARE_USE_MEMORY for the prepare command, if the setting is set
+	UseMemoryEnv = "WALG_MYSQL_USE_MEMORY"
+	// ExportEnv is --export for the last prepare of partial restore, so tables can be imported
+	ExportEnv = "WALG_MYSQL_EXPORT"
+	// BackupToolEnv is xtrabackup or mariabackup, all commands get it to run the right tool
+	BackupToolEnv = "WALG_MYSQL_BACKUP_TOOL"
+
+	xtrabackupCheckpointsFile  = "xtrabackup_checkpoints"
+	mariabackupCheckpointsFile = "mariadb_backup_checkpoints"
+	xtrabackupApplyLogOnly     = "--apply-log-only"
+	xtrabackupUseMemory        = "--use-memory="
+	xtrabackupExport           = "--export"
+)
+
+// xtrabackupCheckpoints is the LSN range of a backup written by xtrabackup to xtrabackup_checkpoints
+type xtrabackupCheckpoints struct {
+	BackupType string
+	FromLsn    uint64
+	ToLsn      uint64
+}
+
+func (checkpoints xtrabackupCheckpoints) isIncremental() bool {
+	return checkpoints.BackupType == "incremental"
+}
+
+// readXtrabackupCheckpoints reads xtrabackup_checkpoints from the directory given to xtrabackup --extra-lsndir.
+// Newer mariabackup names the file mariadb_backup_checkpoints.
+// Nil is returned if the file doesn't exist, e.g. the backup is made not by xtrabackup.
+func readXtrabackupCheckpoints(lsnDir string) (*xtrabackupCheckpoints, error) {
+	for _, name := range []string{xtrabackupCheckpointsFile, mariabackupCheckpointsFile} {
+		file, err := os.Open(filepath.Join(lsnDir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer utility.LoggedClose(file, "")
+		return parseXtrabackupCheckpoints(file)
+	}
+	return nil, nil
+}
+
+// getPushBackupTool returns WALG_MYSQL_BACKUP_TOOL, or mariabackup for MariaDB servers and xtrabackup otherwise
+func getPushBackupTool(db *sql.DB) (string, error) {
+	if tool, ok := internal.GetSetting(internal.MysqlBackupToolSetting); ok {
+		return tool, validateBackupTool(tool)
+	}
+	version, err := getMySQLVersion(db)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		return BackupToolMariabackup, nil
+	}
+	return BackupToolXtrabackup, nil
+}
+
+// getFetchBackupTool returns the tool recorded in the sentinel, since the server may be not running during fetch.
+// Backups made by older versions of WAL-G use WALG_MYSQL_BACKUP_TOOL or xtrabackup.
+// Clone backups always record the tool, so older backups are never taken for them.
+func getFetchBackupTool(sentinel StreamSentinelDto) string {
+	if sentinel.Tool != "" {
+		return sentinel.Tool
+	}
+	if tool, ok := internal.GetSetting(internal.MysqlBackupToolSetting); ok {
+		if err := validateBackupTool(tool); err != nil {
+			tracelog.ErrorLogger.FatalError(err)
+		}
+		if tool != BackupToolClone {
+			return tool
+		}
+	}
+	return BackupToolXtrabackup
+}
+
+func validateBackupTool(tool string) error {
+	if tool != BackupToolXtrabackup && tool != BackupToolMariabackup && tool != BackupToolClone {
+		return errors.Errorf("invalid %s '%s', expected %s, %s or %s",
+			internal.MysqlBackupToolSetting, tool, BackupToolXtrabackup, BackupToolMariabackup, BackupToolClone)
+	}
+	return nil
+}
+
+func parseXtrabackupCheckpoints(reader io.Reader) (*xtrabackupCheckpoints, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) == 2 {
+			values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	checkpoints := &xtrabackupCheckpoints{BackupType: values["backup_type"]}
+	var err error
+	if checkpoints.FromLsn, err = strconv.ParseUint(values["from_lsn"], 10, 64); err != nil {
+		return nil, errors.Wrapf(err, "invalid from_lsn in %s", xtrabackupCheckpointsFile)
+	}
+	if checkpoints.ToLsn, err = strconv.ParseUint(values["to_lsn"], 10, 64); err != nil {
+		return nil, errors.Wrapf(err, "invalid to_lsn in %s", xtrabackupCheckpointsFile)
+	}
+	return checkpoints, nil
+}
+
+// backupChainLink is a backup of the chain restored by backup-fetch
+type backupChainLink struct {
+	backup   *internal.Backup
+	sentinel StreamSentinelDto
+}
+
+// getBackupChain returns the full backup and its increments up to the backup in the order of restoration
+func getBackupChain(folder storage.Folder, backupName string) ([]backupChainLink, error) {
+	chain := make([]backupChainLink, 0)
+	for {
+		backup, err := internal.GetBackupByName(backupName, utility.BaseBackupPath, folder)
+		if err != nil {
+			return nil, err
+		}
+		var sentinel StreamSentinelDto
+		if err = internal.FetchStreamSentinel(backup, &sentinel); err != nil {
+			return nil, err
+		}
+		chain = append([]backupChainLink{{backup, sentinel}}, chain...)
+		if !sentinel.IsIncremental() {
+			return chain, nil
+		}
+		backupName = *sentinel.IncrementFrom
+	}
+}
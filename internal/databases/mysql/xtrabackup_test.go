@@ -0,0 +1,70 @@
+package mysql
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseXtrabackupCheckpoints(t *testing.T) {
+	checkpoints, err := parseXtrabackupCheckpoints(strings.NewReader(
+		"backup_type = incremental\nfrom_lsn = 1626007\nto_lsn = 1638170\nlast_lsn = 1638179\ncompact = 0\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, xtrabackupCheckpoints{BackupType: "incremental", FromLsn: 1626007, ToLsn: 1638170}, *checkpoints)
+	assert.True(t, checkpoints.isIncremental())
+}
+
+func TestParseXtrabackupCheckpoints_Full(t *testing.T) {
+	checkpoints, err := parseXtrabackupCheckpoints(strings.NewReader(
+		"backup_type = full-backuped\nfrom_lsn = 0\nto_lsn = 1626007\n"))
+	assert.NoError(t, err)
+	assert.False(t, checkpoints.isIncremental())
+	assert.Equal(t, uint64(1626007), checkpoints.ToLsn)
+}
+
+func TestParseXtrabackupCheckpoints_NoLsn(t *testing.T) {
+	_, err := parseXtrabackupCheckpoints(strings.NewReader("backup_type = full-backuped\n"))
+	assert.Error(t, err)
+}
+
+func TestSetSentinelIncrement_Chain(t *testing.T) {
+	fullName := "stream_20200101T000000Z"
+	fullCount := 1
+	previous := StreamSentinelDto{IncrementFrom: &fullName, IncrementFullName: &fullName, IncrementCount: &fullCount}
+	sentinel := StreamSentinelDto{}
+	setSentinelIncrement(&sentinel, &xtrabackupCheckpoints{BackupType: "incremental", FromLsn: 10, ToLsn: 20},
+		"stream_20200102T000000Z", previous)
+	assert.True(t, sentinel.IsIncremental())
+	assert.Equal(t, "stream_20200102T000000Z", *sentinel.IncrementFrom)
+	assert.Equal(t, fullName, *sentinel.IncrementFullName)
+	assert.Equal(t, 2, *sentinel.IncrementCount)
+	assert.Equal(t, uint64(20), *sentinel.ToLSN)
+}
+
+func TestReadXtrabackupCheckpoints_Mariabackup(t *testing.T) {
+	lsnDir, err := ioutil.TempDir("", "wal-g-test-lsn")
+	assert.NoError(t, err)
+	defer os.RemoveAll(lsnDir)
+	err = ioutil.WriteFile(filepath.Join(lsnDir, mariabackupCheckpointsFile),
+		[]byte("backup_type = full-backuped\nfrom_lsn = 0\nto_lsn = 42\n"), 0644)
+	assert.NoError(t, err)
+
+	checkpoints, err := readXtrabackupCheckpoints(lsnDir)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(42), checkpoints.ToLsn)
+}
+
+func TestGetFetchBackupTool(t *testing.T) {
+	assert.Equal(t, BackupToolMariabackup, getFetchBackupTool(StreamSentinelDto{Tool: BackupToolMariabackup}))
+	assert.Equal(t, BackupToolXtrabackup, getFetchBackupTool(StreamSentinelDto{}))
+	assert.Equal(t, BackupToolClone, getFetchBackupTool(StreamSentinelDto{Tool: BackupToolClone}))
+}
+
+func TestValidateBackupTool(t *testing.T) {
+	assert.NoError(t, validateBackupTool(BackupToolClone))
+	assert.Error(t, validateBackupTool("mysqlbackup"))
+}
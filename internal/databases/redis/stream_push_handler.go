@@ -17,7 +17,7 @@ func HandleBackupPush(uploader *internal.Uploader, backupCmd *exec.Cmd) {
 	tracelog.ErrorLogger.FatalfOnError("failed to start backup create command: %v", err)
 
 	backupName := "dump_" + time.Now().Format(time.RFC3339)
-	compressed := internal.CompressAndEncrypt(stdout, uploader.Compressor, internal.ConfigureCrypter())
+	compressed := internal.CompressAndEncrypt(stdout, uploader.Compressor, internal.ConfigureCrypterForContentType(internal.BackupContentType))
 	err = uploader.Upload(backupName, compressed)
 	tracelog.ErrorLogger.FatalOnError(err)
 
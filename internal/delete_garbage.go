@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const DeleteGarbageUsageExample = "garbage"
+
+// walGarbageBoundary is the oldest WAL still needed by the remaining backups
+type walGarbageBoundary struct {
+	segmentNo WalSegmentNo
+	timeline  uint32
+}
+
+// HandleDeleteGarbage removes WAL archives left after backups were deleted: segments older than the start
+// of the oldest remaining backup and history files of timelines older than the timeline of that backup.
+// WAL of permanent backups and WAL protected by walProtection are kept.
+func HandleDeleteGarbage(folder storage.Folder, confirmed bool, walProtection *WalProtection) {
+	boundary, err := getWalGarbageBoundary(folder)
+	tracelog.ErrorLogger.FatalOnError(err)
+	tracelog.InfoLogger.Printf("WAL before segment %s is not needed by backups\n",
+		boundary.segmentNo.getFilename(boundary.timeline))
+	permanentBackups, permanentWals, err := getPermanentObjects(folder)
+	tracelog.ErrorLogger.FatalOnError(err)
+	err = deleteObjectsWhere(folder, confirmed, func(object storage.Object) bool {
+		return boundary.isGarbage(object.GetName()) && !isPermanent(object.GetName(), permanentBackups, permanentWals) &&
+			!walProtection.isProtected(object.GetName())
+	})
+	tracelog.ErrorLogger.FatalOnError(err)
+}
+
+// getWalGarbageBoundary finds the earliest start segment and the earliest timeline among the remaining backups.
+// Start WAL is taken from backup names, so backups without metadata are accounted too.
+func getWalGarbageBoundary(folder storage.Folder) (walGarbageBoundary, error) {
+	backups, err := GetBackups(folder)
+	if err != nil {
+		return walGarbageBoundary{}, errors.Wrap(err, "no WAL is deleted without backups")
+	}
+	boundary := walGarbageBoundary{segmentNo: WalSegmentNo(^uint64(0)), timeline: ^uint32(0)}
+	for _, backup := range backups {
+		timeline, segmentNo, err := ParseWALFilename(backup.WalFileName)
+		if err != nil {
+			return walGarbageBoundary{}, errors.Wrapf(err, "failed to find start WAL of backup %s", backup.BackupName)
+		}
+		if WalSegmentNo(segmentNo) < boundary.segmentNo {
+			boundary.segmentNo = WalSegmentNo(segmentNo)
+		}
+		if timeline < boundary.timeline {
+			boundary.timeline = timeline
+		}
+	}
+	return boundary, nil
+}
+
+// isGarbage checks if the object is a WAL archive, a bundle or a history file which no backup needs.
+// Segments are compared regardless of their timelines, so WAL of timelines forked later is never deleted.
+func (boundary walGarbageBoundary) isGarbage(objectName string) bool {
+	if !strings.HasPrefix(objectName, utility.WalPath) {
+		return false
+	}
+	if strings.HasPrefix(objectName, utility.WalPath+WalBundlePath) {
+		name := utility.TrimFileExtension(strings.TrimPrefix(objectName, utility.WalPath+WalBundlePath))
+		_, _, last, err := parseWalBundleName(name)
+		return err == nil && last < boundary.segmentNo
+	}
+	name := strings.TrimPrefix(objectName, utility.WalPath)
+	if strings.Contains(name, utility.PathSeparator) {
+		return false
+	}
+	if timeline, ok := parseTimelineHistoryFilename(name); ok {
+		return timeline < boundary.timeline
+	}
+	if timeline, ok := parseTimelineHistoryFilename(utility.TrimFileExtension(name)); ok {
+		return timeline < boundary.timeline
+	}
+	// segments may have suffixes such as .partial or .00000028.backup before the compression extension
+	if len(name) < 24 || (len(name) > 24 && name[24] != '.') {
+		return false
+	}
+	_, segmentNo, err := ParseWALFilename(name[:24])
+	return err == nil && WalSegmentNo(segmentNo) < boundary.segmentNo
+}
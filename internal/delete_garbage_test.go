@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/wal-g/utility"
+)
+
+func TestGetWalGarbageBoundary(t *testing.T) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	for _, name := range []string{
+		"base_000000030000000000000010",
+		"base_000000020000000000000007",
+		"base_00000003000000000000000C_D_000000020000000000000007",
+	} {
+		err := folder.PutObject(utility.BaseBackupPath+name+utility.SentinelSuffix, &bytes.Buffer{})
+		assert.NoError(t, err)
+	}
+
+	boundary, err := getWalGarbageBoundary(folder)
+	assert.NoError(t, err)
+	assert.Equal(t, walGarbageBoundary{segmentNo: 7, timeline: 2}, boundary)
+}
+
+func TestGetWalGarbageBoundary_NoBackups(t *testing.T) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	_, err := getWalGarbageBoundary(folder)
+	assert.Error(t, err)
+}
+
+func TestWalGarbageBoundary_IsGarbage(t *testing.T) {
+	boundary := walGarbageBoundary{segmentNo: 7, timeline: 2}
+
+	assert.True(t, boundary.isGarbage(utility.WalPath+"000000010000000000000006.lz4"))
+	assert.True(t, boundary.isGarbage(utility.WalPath+"000000010000000000000006.partial.lz4"))
+	assert.True(t, boundary.isGarbage(utility.WalPath+"000000010000000000000006.00000028.backup.lz4"))
+	assert.False(t, boundary.isGarbage(utility.WalPath+"000000010000000000000007.lz4"))
+	assert.False(t, boundary.isGarbage(utility.WalPath+"000000030000000000000008.lz4"))
+	assert.True(t, boundary.isGarbage(utility.WalPath+"00000001.history.lz4"))
+	assert.True(t, boundary.isGarbage(utility.WalPath+"00000001.history"))
+	assert.False(t, boundary.isGarbage(utility.WalPath+"00000002.history.lz4"))
+	assert.True(t, boundary.isGarbage(utility.WalPath+WalBundlePath+"000000010000000000000006_000000010000000000000002.lz4"))
+	assert.False(t, boundary.isGarbage(utility.WalPath+WalBundlePath+"000000010000000000000007_000000010000000000000002.lz4"))
+	assert.False(t, boundary.isGarbage(utility.WalPath+"unknown.lz4"))
+	assert.False(t, boundary.isGarbage(utility.BaseBackupPath+"base_000000010000000000000004"+utility.SentinelSuffix))
+}
@@ -45,7 +45,7 @@ var MaxTime = time.Unix(1<<63-62135596801, 999999999)
 
 // TODO : unit tests
 func getLatestBackupName(folder storage.Folder) (string, error) {
-	sortTimes, err := getBackups(folder)
+	sortTimes, err := GetBackups(folder)
 	if err != nil {
 		return "", err
 	}
@@ -54,8 +54,8 @@ func getLatestBackupName(folder storage.Folder) (string, error) {
 }
 
 // TODO : unit tests
-// getBackups receives backup descriptions and sorts them by time
-func getBackups(folder storage.Folder) (backups []BackupTime, err error) {
+// GetBackups receives backup descriptions and sorts them by time
+func GetBackups(folder storage.Folder) (backups []BackupTime, err error) {
 	backups, _, err = getBackupsAndGarbage(folder)
 	if err != nil {
 		return nil, err
@@ -308,66 +308,82 @@ func getRetainChoiceFunc(retentionCount, modifier int,
 
 func DeleteEverything(folder storage.Folder,
 	confirmed bool,
-	args []string) {
+	args []string,
+	walProtection *WalProtection) {
 	forceModifier := false
 	modifier := extractDeleteEverythingModifierFromArgs(args)
 	if modifier == ForceDeleteModifier {
 		forceModifier = true
 	}
-	permanentBackups, permanentWals := getPermanentObjects(folder)
+	permanentBackups, permanentWals, err := getPermanentObjects(folder)
+	if err != nil && !forceModifier {
+		tracelog.ErrorLogger.FatalError(err)
+	}
 	if len(permanentBackups) > 0 && !forceModifier {
 		tracelog.ErrorLogger.Fatal(fmt.Sprintf("Found permanent objects: backups=%v, wals=%v\n", permanentBackups, permanentWals))
 	}
 
-	filter := func(object storage.Object) bool { return true }
-	err := storage.DeleteObjectsWhere(folder, confirmed, filter)
+	filter := func(object storage.Object) bool { return !walProtection.isProtected(object.GetName()) }
+	err = deleteObjectsWhere(folder, confirmed, filter)
 	tracelog.ErrorLogger.FatalOnError(err)
 }
 
 func DeleteBeforeTarget(folder storage.Folder, target storage.Object,
 	confirmed bool,
 	isFullBackup func(object storage.Object) bool,
-	less func(object1, object2 storage.Object) bool) error {
+	less func(object1, object2 storage.Object) bool,
+	walProtection *WalProtection) error {
 
 	if !isFullBackup(target) {
 		errorMessage := "%v is incremental and it's predecessors cannot be deleted. Consider FIND_FULL option."
 		return utility.NewForbiddenActionError(fmt.Sprintf(errorMessage, target.GetName()))
 	}
 	tracelog.InfoLogger.Println("Start delete")
-	permanentBackups, permanentWals := getPermanentObjects(folder)
+	permanentBackups, permanentWals, err := getPermanentObjects(folder)
+	if err != nil {
+		return err
+	}
 	if len(permanentBackups) > 0 {
 		tracelog.InfoLogger.Printf("Found permanent objects: backups=%v, wals=%v\n", permanentBackups, permanentWals)
 	}
-	return storage.DeleteObjectsWhere(folder, confirmed, func(object storage.Object) bool {
-		return less(object, target) && !isPermanent(object.GetName(), permanentBackups, permanentWals)
+	return deleteObjectsWhere(folder, confirmed, func(object storage.Object) bool {
+		isBefore := less(object, target) || isConfigSnapshotBefore(object.GetName(), target.GetLastModified())
+		return isBefore && !isTimelineHistoryFile(object.GetName()) &&
+			!isPermanent(object.GetName(), permanentBackups, permanentWals) &&
+			!walProtection.isProtected(object.GetName())
 	})
 }
 
-func getPermanentObjects(folder storage.Folder) (map[string]bool, map[string]bool) {
+// getPermanentObjects returns permanent backups and WAL segments needed to restore them.
+// An error is returned if permanence of some backup can't be checked, so delete doesn't remove it by mistake.
+// Backups without metadata, made by older versions of WAL-G, can't be permanent.
+func getPermanentObjects(folder storage.Folder) (map[string]bool, map[string]bool, error) {
 	tracelog.InfoLogger.Println("retrieving permanent objects")
-	backupTimes, err := getBackups(folder)
+	permanentBackups := map[string]bool{}
+	permanentWals := map[string]bool{}
+	backupTimes, err := GetBackups(folder)
+	if _, ok := err.(NoBackupsFoundError); ok {
+		return permanentBackups, permanentWals, nil
+	}
 	if err != nil {
-		return map[string]bool{}, map[string]bool{}
+		return permanentBackups, permanentWals, errors.Wrap(err, "failed to retrieve permanent objects")
 	}
 
-	permanentBackups := map[string]bool{}
-	permanentWals := map[string]bool{}
 	for _, backupTime := range backupTimes {
-		backup, err := GetBackupByName(backupTime.BackupName, utility.BaseBackupPath, folder)
-		if err != nil {
-			tracelog.ErrorLogger.Printf("failed to get backup by name with error %s, ignoring...", err.Error())
+		backup := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), backupTime.BackupName)
+		meta, err := backup.fetchMeta()
+		if _, ok := errors.Cause(err).(storage.ObjectNotFoundError); ok {
 			continue
 		}
-		meta, err := backup.fetchMeta()
 		if err != nil {
-			tracelog.ErrorLogger.Printf("failed to fetch backup meta for backup %s with error %s, ignoring...", backupTime.BackupName, err.Error())
-			continue
+			return permanentBackups, permanentWals,
+				errors.Wrapf(err, "failed to check if backup %s is permanent", backupTime.BackupName)
 		}
 		if meta.IsPermanent {
 			timelineID64, err := strconv.ParseUint(backupTime.BackupName[len(utility.BackupNamePrefix):len(utility.BackupNamePrefix)+8], 0x10, sizeofInt32bits)
 			if err != nil {
-				tracelog.ErrorLogger.Printf("failed to parse backup timeline for backup %s with error %s, ignoring...", backupTime.BackupName, err.Error())
-				continue
+				return permanentBackups, permanentWals,
+					errors.Wrapf(err, "failed to parse timeline of permanent backup %s", backupTime.BackupName)
 			}
 			timelineID := uint32(timelineID64)
 
@@ -379,25 +395,55 @@ func getPermanentObjects(folder storage.Folder) (map[string]bool, map[string]boo
 			permanentBackups[backupTime.BackupName[len(utility.BackupNamePrefix):len(utility.BackupNamePrefix)+24]] = true
 		}
 	}
-	return permanentBackups, permanentWals
+	return permanentBackups, permanentWals, nil
+}
+
+// isTimelineHistoryFile checks if the object is a timeline history file. History files are kept by delete:
+// they are tiny and recovery to a later timeline needs them, even if backups of earlier timelines are deleted.
+func isTimelineHistoryFile(objectName string) bool {
+	if !strings.HasPrefix(objectName, utility.WalPath) {
+		return false
+	}
+	_, ok := parseTimelineHistoryFilename(utility.TrimFileExtension(strings.TrimPrefix(objectName, utility.WalPath)))
+	return ok
 }
 
 func isPermanent(objectName string, permanentBackups map[string]bool, permanentWals map[string]bool) bool {
-	if objectName[:len(utility.WalPath)] == utility.WalPath {
+	if strings.HasPrefix(objectName, utility.WalPath+WalBundlePath) {
+		return isPermanentWalBundle(objectName, permanentWals)
+	}
+	if strings.HasPrefix(objectName, utility.WalPath) && len(objectName) >= len(utility.WalPath)+24 {
 		wal := objectName[len(utility.WalPath) : len(utility.WalPath)+24]
 		return permanentWals[wal]
 	}
-	if objectName[:len(utility.BaseBackupPath)] == utility.BaseBackupPath {
-		backup := objectName[len(utility.BaseBackupPath)+len(utility.BackupNamePrefix) : len(utility.BaseBackupPath)+len(utility.BackupNamePrefix)+24]
+	backupPrefix := utility.BaseBackupPath + utility.BackupNamePrefix
+	if strings.HasPrefix(objectName, backupPrefix) && len(objectName) >= len(backupPrefix)+24 {
+		backup := objectName[len(backupPrefix) : len(backupPrefix)+24]
 		return permanentBackups[backup]
 	}
-	// should not reach here, default to false
+	// objects of other prefixes are not needed to restore permanent backups, history files are kept by delete anyway
+	return false
+}
+
+// isPermanentWalBundle checks if WAL bundle contains segments of permanent backups
+func isPermanentWalBundle(objectName string, permanentWals map[string]bool) bool {
+	name := utility.TrimFileExtension(strings.TrimPrefix(objectName, utility.WalPath+WalBundlePath))
+	timeline, first, last, err := parseWalBundleName(name)
+	if err != nil {
+		return false
+	}
+	for segmentNo := first; segmentNo <= last; segmentNo = segmentNo.next() {
+		if permanentWals[segmentNo.getFilename(timeline)] {
+			return true
+		}
+	}
 	return false
 }
 
 func HandleDeleteBefore(folder storage.Folder, args []string, confirmed bool,
 	isFullBackup func(object storage.Object) bool,
-	less func(object1, object2 storage.Object) bool) {
+	less func(object1, object2 storage.Object) bool,
+	walProtection *WalProtection) {
 
 	modifier, beforeStr := extractDeleteModifierFromArgs(args)
 	timeLine, err := time.Parse(time.RFC3339, beforeStr)
@@ -413,13 +459,14 @@ func HandleDeleteBefore(folder storage.Folder, args []string, confirmed bool,
 		tracelog.InfoLogger.Printf("No backup found for deletion")
 		os.Exit(0)
 	}
-	err = DeleteBeforeTarget(folder, target, confirmed, isFullBackup, less)
+	err = DeleteBeforeTarget(folder, target, confirmed, isFullBackup, less, walProtection)
 	tracelog.ErrorLogger.FatalOnError(err)
 }
 
 func HandleDeleteRetain(folder storage.Folder, args []string, confirmed bool,
 	isFullBackup func(object storage.Object) bool,
-	less func(object1, object2 storage.Object) bool) {
+	less func(object1, object2 storage.Object) bool,
+	walProtection *WalProtection) {
 
 	modifier, retantionStr := extractDeleteModifierFromArgs(args)
 	retentionCount, err := strconv.Atoi(retantionStr)
@@ -431,13 +478,14 @@ func HandleDeleteRetain(folder storage.Folder, args []string, confirmed bool,
 		tracelog.InfoLogger.Printf("No backup found for deletion")
 		os.Exit(0)
 	}
-	err = DeleteBeforeTarget(folder, target, confirmed, isFullBackup, less)
+	err = DeleteBeforeTarget(folder, target, confirmed, isFullBackup, less, walProtection)
 	tracelog.ErrorLogger.FatalOnError(err)
 }
 
 func HandleDeletaRetainAfter(folder storage.Folder, args []string, confirmed bool,
 	isFullBackup func(object storage.Object) bool,
-	less func(object1, object2 storage.Object) bool) {
+	less func(object1, object2 storage.Object) bool,
+	walProtection *WalProtection) {
 
 	modifier, retentionSir, afterStr := extractDeleteRetainModifierFromArgs(args)
 	retentionCount, err := strconv.Atoi(retentionSir)
@@ -458,7 +506,7 @@ func HandleDeletaRetainAfter(folder storage.Folder, args []string, confirmed boo
 		os.Exit(0)
 	}
 
-	err = DeleteBeforeTarget(folder, target, confirmed, isFullBackup, less)
+	err = DeleteBeforeTarget(folder, target, confirmed, isFullBackup, less, walProtection)
 	tracelog.ErrorLogger.FatalOnError(err)
 }
 
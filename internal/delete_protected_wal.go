@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"strings"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// replicationSlotsLsnQuery returns positions of replication slots, WAL after them is still needed by replicas
+const replicationSlotsLsnQuery = "select restart_lsn::text from pg_replication_slots where restart_lsn is not null"
+
+// WalProtection keeps WAL archives which are still needed by lagging replicas or subscribers from deletion.
+// A nil WalProtection protects nothing.
+type WalProtection struct {
+	// firstSegmentNo is the first WAL segment which delete must keep on every timeline
+	firstSegmentNo *WalSegmentNo
+}
+
+func NewWalProtection() *WalProtection {
+	return &WalProtection{}
+}
+
+// ProtectFromLsn makes delete keep WAL archives starting from the segment containing lsn.
+// If it is called several times, the oldest LSN is protected.
+func (protection *WalProtection) ProtectFromLsn(lsn uint64) {
+	segmentNo := newWalSegmentNo(lsn)
+	if protection.firstSegmentNo == nil || segmentNo < *protection.firstSegmentNo {
+		protection.firstSegmentNo = &segmentNo
+		tracelog.InfoLogger.Printf("WAL archives starting from LSN %s are protected from deletion\n", pgx.FormatLSN(lsn))
+	}
+}
+
+// ProtectReplicationSlots protects WAL needed by replication slots of the database.
+// LSNs are queried with ProtectedLsnQuerySetting if it is set.
+func (protection *WalProtection) ProtectReplicationSlots() error {
+	query := replicationSlotsLsnQuery
+	if customQuery, ok := GetSetting(ProtectedLsnQuerySetting); ok && customQuery != "" {
+		query = customQuery
+	}
+	conn, err := Connect()
+	if err != nil {
+		return err
+	}
+	defer utility.LoggedClose(conn, "")
+	lsns, err := queryProtectedLsns(conn, query)
+	if err != nil {
+		return err
+	}
+	if len(lsns) == 0 {
+		tracelog.InfoLogger.Println("No replication slots found, no WAL is protected")
+	}
+	for _, lsn := range lsns {
+		protection.ProtectFromLsn(lsn)
+	}
+	return nil
+}
+
+func queryProtectedLsns(conn *pgx.Conn, query string) ([]uint64, error) {
+	rows, err := conn.Query(query)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query protected LSNs with '%s'", query)
+	}
+	defer rows.Close()
+	lsns := make([]uint64, 0)
+	for rows.Next() {
+		var lsnStr string
+		if err = rows.Scan(&lsnStr); err != nil {
+			return nil, errors.Wrap(err, "failed to read protected LSN")
+		}
+		lsn, err := pgx.ParseLSN(lsnStr)
+		if err != nil {
+			return nil, err
+		}
+		lsns = append(lsns, lsn)
+	}
+	return lsns, rows.Err()
+}
+
+// isProtected checks if the object is a WAL archive or a bundle with segments protected by ProtectFromLsn
+func (protection *WalProtection) isProtected(objectName string) bool {
+	if protection == nil || protection.firstSegmentNo == nil || !strings.HasPrefix(objectName, utility.WalPath) {
+		return false
+	}
+	if strings.HasPrefix(objectName, utility.WalPath+WalBundlePath) {
+		name := utility.TrimFileExtension(strings.TrimPrefix(objectName, utility.WalPath+WalBundlePath))
+		_, _, last, err := parseWalBundleName(name)
+		return err == nil && last >= *protection.firstSegmentNo
+	}
+	name := utility.TrimFileExtension(strings.TrimPrefix(objectName, utility.WalPath))
+	_, segmentNo, err := ParseWALFilename(strings.TrimSuffix(name, PartialWalSuffix))
+	return err == nil && WalSegmentNo(segmentNo) >= *protection.firstSegmentNo
+}
@@ -0,0 +1,26 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/utility"
+)
+
+func TestIsProtectedWal(t *testing.T) {
+	var noProtection *WalProtection
+	assert.False(t, noProtection.isProtected(utility.WalPath+"000000010000000000000003.lz4"))
+	protection := NewWalProtection()
+	assert.False(t, protection.isProtected(utility.WalPath+"000000010000000000000003.lz4"))
+
+	protection.ProtectFromLsn(5 * WalSegmentSize)
+	protection.ProtectFromLsn(3*WalSegmentSize + 100)
+	protection.ProtectFromLsn(4 * WalSegmentSize)
+
+	assert.False(t, protection.isProtected(utility.WalPath+"000000010000000000000002.lz4"))
+	assert.True(t, protection.isProtected(utility.WalPath+"000000010000000000000003.lz4"))
+	assert.True(t, protection.isProtected(utility.WalPath+"000000020000000000000004.partial.lz4"))
+	assert.False(t, protection.isProtected(utility.WalPath+WalBundlePath+"000000010000000000000002_000000010000000000000001.lz4"))
+	assert.True(t, protection.isProtected(utility.WalPath+WalBundlePath+"000000010000000000000003_000000010000000000000001.lz4"))
+	assert.False(t, protection.isProtected(utility.BaseBackupPath+"base_000000010000000000000004_backup_stop_sentinel.json"))
+}
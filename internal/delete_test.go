@@ -231,13 +231,71 @@ func TestDeleteBeforeTargetWithPermanentBackups(t *testing.T) {
 
 	// attempt delete
 	target := storage.NewLocalObject("", utility.TimeNowCrossPlatformLocal().Add(time.Duration(1*int(time.Minute))))
-	err := internal.DeleteBeforeTarget(folder, target, true, isFullBackup, lessByTime)
+	err := internal.DeleteBeforeTarget(folder, target, true, isFullBackup, lessByTime, nil)
 	assert.NoError(t, err)
 
 	// verify expected permanent still exists
 	verifyThatExistBackupsAndWals(t, expectBackupExistAfterDelete, expectWalExistAfterDelete, folder)
 }
 
+func TestDeleteBeforeTargetKeepsEverythingIfPermanenceIsUnknown(t *testing.T) {
+	folder := testtools.CreateMockStorageFolderWithPermanentBackups(t)
+	backupFolder := folder.GetSubFolder(utility.BaseBackupPath)
+	err := backupFolder.PutObject("base_000000010000000000000006_D_000000010000000000000004/"+utility.MetadataFileName,
+		strings.NewReader("{"))
+	assert.NoError(t, err)
+
+	target := storage.NewLocalObject("", utility.TimeNowCrossPlatformLocal().Add(time.Duration(1*int(time.Minute))))
+	err = internal.DeleteBeforeTarget(folder, target, true, isFullBackup, lessByTime, nil)
+	assert.Error(t, err)
+
+	verifyThatExistBackupsAndWals(t, map[string]bool{
+		"base_000000010000000000000006_D_000000010000000000000004": true,
+	}, map[string]bool{
+		"000000010000000000000003": true,
+	}, folder)
+}
+
+func TestDeleteBeforeTargetKeepsHistoryFiles(t *testing.T) {
+	folder := testtools.CreateMockStorageFolderWithPermanentBackups(t)
+	walFolder := folder.GetSubFolder(utility.WalPath)
+	assert.NoError(t, walFolder.PutObject("00000002.history.lz4", strings.NewReader("")))
+
+	target := storage.NewLocalObject("", utility.TimeNowCrossPlatformLocal().Add(time.Duration(1*int(time.Minute))))
+	err := internal.DeleteBeforeTarget(folder, target, true, isFullBackup, lessByTime, nil)
+	assert.NoError(t, err)
+
+	exists, err := walFolder.Exists("00000002.history.lz4")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestDeleteBeforeTargetDeletesOlderConfigSnapshots(t *testing.T) {
+	folder := testtools.CreateMockStorageFolderWithPermanentBackups(t)
+	configFolder := folder.GetSubFolder(utility.ConfigPath)
+	targetTime := utility.TimeNowCrossPlatformUTC()
+	olderSnapshot := internal.ConfigSnapshotPrefix + targetTime.Add(-time.Hour).Format(utility.BackupTimeFormat)
+	newerSnapshot := internal.ConfigSnapshotPrefix + targetTime.Add(time.Hour).Format(utility.BackupTimeFormat)
+	for _, snapshotName := range []string{olderSnapshot, newerSnapshot} {
+		assert.NoError(t, configFolder.PutObject(snapshotName+"/stream.lz4", strings.NewReader("")))
+		assert.NoError(t, configFolder.PutObject(snapshotName+utility.SentinelSuffix, strings.NewReader("{}")))
+	}
+
+	// config snapshots have no LSN in their names, so they are never less than backups by LSN
+	lessByLsn := func(object1, object2 storage.Object) bool { return false }
+	target := storage.NewLocalObject("", targetTime)
+	err := internal.DeleteBeforeTarget(folder, target, true, isFullBackup, lessByLsn, nil)
+	assert.NoError(t, err)
+
+	for snapshotName, expectExists := range map[string]bool{olderSnapshot: false, newerSnapshot: true} {
+		for _, objectName := range []string{snapshotName + "/stream.lz4", snapshotName + utility.SentinelSuffix} {
+			exists, err := configFolder.Exists(objectName)
+			assert.NoError(t, err)
+			assert.Equal(t, expectExists, exists, "errored on "+objectName)
+		}
+	}
+}
+
 func createMockFolderWithTime(t *testing.T, baseTime time.Time) *mocks.MockFolder {
 	baseNamePrefix := "base_"
 	deltaMark := "_D_"
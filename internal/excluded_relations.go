@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"path"
+	"strings"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// relationFilePathsQuery returns paths of the relation, its TOAST table and indexes of both relative to the data directory
+const relationFilePathsQuery = `WITH rel AS (SELECT oid, reltoastrelid FROM pg_class WHERE oid = $1::regclass)
+SELECT pg_relation_filepath(oid) FROM rel
+UNION ALL SELECT pg_relation_filepath(reltoastrelid) FROM rel WHERE reltoastrelid <> 0
+UNION ALL SELECT pg_relation_filepath(indexrelid) FROM pg_index
+WHERE indrelid IN (SELECT oid FROM rel UNION ALL SELECT reltoastrelid FROM rel)`
+
+// resolveExcludedRelations finds files of relations given as database.schema.relation.
+// Relations are resolved in their databases, the returned map holds paths of relation files by relation name.
+func resolveExcludedRelations(conn *pgx.Conn, relations []string) (map[string][]string, error) {
+	var currentDatabase string
+	if err := conn.QueryRow("SELECT current_database()").Scan(&currentDatabase); err != nil {
+		return nil, errors.Wrap(err, "failed to get current database")
+	}
+	relationsByDatabase := make(map[string][]string)
+	for _, relation := range relations {
+		parts := strings.SplitN(relation, ".", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("relation '%s' in %s must be given as database.schema.relation",
+				relation, BackupExcludeRelsSetting)
+		}
+		relationsByDatabase[parts[0]] = append(relationsByDatabase[parts[0]], parts[1])
+	}
+
+	excluded := make(map[string][]string)
+	for database, databaseRelations := range relationsByDatabase {
+		databaseConn := conn
+		if database != currentDatabase {
+			var err error
+			if databaseConn, err = connectToDatabase(database); err != nil {
+				return nil, err
+			}
+			defer utility.LoggedClose(databaseConn, "")
+		}
+		for _, relation := range databaseRelations {
+			paths, err := queryRelationFilePaths(databaseConn, relation)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to find files of relation %s.%s", database, relation)
+			}
+			excluded[database+"."+relation] = paths
+		}
+	}
+	return excluded, nil
+}
+
+func connectToDatabase(database string) (*pgx.Conn, error) {
+	config, err := pgx.ParseEnvLibpq()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read environment variables")
+	}
+	config.Database = database
+	conn, err := pgx.Connect(config)
+	return conn, errors.Wrapf(err, "failed to connect to database %s", database)
+}
+
+func queryRelationFilePaths(conn *pgx.Conn, relation string) ([]string, error) {
+	rows, err := conn.Query(relationFilePathsQuery, relation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	paths := make([]string, 0)
+	for rows.Next() {
+		var filePath *string
+		if err = rows.Scan(&filePath); err != nil {
+			return nil, err
+		}
+		// relations without storage have no path
+		if filePath != nil {
+			paths = append(paths, utility.PathSeparator+*filePath)
+		}
+	}
+	return paths, rows.Err()
+}
+
+// newExcludedRelationFiles collects paths of excluded relation files to look up walked files in it
+func newExcludedRelationFiles(excludedRelations map[string][]string) map[string]bool {
+	files := make(map[string]bool)
+	for _, paths := range excludedRelations {
+		for _, filePath := range paths {
+			files[filePath] = true
+		}
+	}
+	return files
+}
+
+// isExcludedRelationFile checks if the file is a segment or a fork of an excluded relation file,
+// e.g. /base/16384/16385.1 or /base/16384/16385_fsm for /base/16384/16385
+func isExcludedRelationFile(excludedFiles map[string]bool, fileRelPath string) bool {
+	if len(excludedFiles) == 0 {
+		return false
+	}
+	directory, name := path.Split(fileRelPath)
+	if separator := strings.IndexAny(name, "._"); separator >= 0 {
+		name = name[:separator]
+	}
+	return excludedFiles[directory+name]
+}
+
+// getExcludedRelationStubs returns main files of relations excluded from the backup,
+// they are restored as empty files, so the relations can be truncated after restore
+func getExcludedRelationStubs(backup *Backup) ([]string, error) {
+	sentinelDto, err := backup.GetSentinel()
+	if err != nil {
+		return nil, err
+	}
+	stubs := make([]string, 0)
+	for relation, paths := range sentinelDto.ExcludedRelations {
+		tracelog.WarningLogger.Printf("Relation %s was excluded from backup %s, it must be truncated after restore\n",
+			relation, backup.Name)
+		stubs = append(stubs, paths...)
+	}
+	return stubs, nil
+}
@@ -0,0 +1,21 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsExcludedRelationFile(t *testing.T) {
+	excludedFiles := newExcludedRelationFiles(map[string][]string{
+		"shop.public.queue": {"/base/16384/16385", "/base/16384/16390"},
+	})
+
+	assert.True(t, isExcludedRelationFile(excludedFiles, "/base/16384/16385"))
+	assert.True(t, isExcludedRelationFile(excludedFiles, "/base/16384/16385.1"))
+	assert.True(t, isExcludedRelationFile(excludedFiles, "/base/16384/16385_fsm"))
+	assert.True(t, isExcludedRelationFile(excludedFiles, "/base/16384/16390_vm"))
+	assert.False(t, isExcludedRelationFile(excludedFiles, "/base/16384/163851"))
+	assert.False(t, isExcludedRelationFile(excludedFiles, "/base/16385/16385"))
+	assert.False(t, isExcludedRelationFile(nil, "/base/16384/16385"))
+}
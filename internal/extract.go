@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal/compression"
 	"github.com/wal-g/wal-g/internal/crypto"
@@ -55,6 +56,24 @@ func (err UnsupportedFileTypeError) Error() string {
 	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
 }
 
+// FailedTarPartsError is used to signal tar parts
+// that could not be extracted even after all retries.
+type FailedTarPartsError struct {
+	error
+	TarNames []string
+}
+
+func newFailedTarPartsError(tarNames []string) FailedTarPartsError {
+	return FailedTarPartsError{
+		errors.Errorf("failed to extract files:\n%s\n", strings.Join(tarNames, "\n")),
+		tarNames,
+	}
+}
+
+func (err FailedTarPartsError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
 // EmptyWriteIgnorer handles 0 byte write in LZ4 package
 // to stop pipe reader/writer from blocking.
 type EmptyWriteIgnorer struct {
@@ -146,63 +165,121 @@ func ExtractAll(tarInterpreter TarInterpreter, files []ReaderMaker) error {
 		return newNoFilesToExtractError()
 	}
 
+	failed, err := extractAllWithRetries(tarInterpreter, files)
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("failed to extract files:\n%s\n",
+			strings.Join(readerMakersToFilePaths(failed), "\n"))
+	}
+	return nil
+}
+
+// ExtractAllDeferringFailures makes a single extraction pass over all files,
+// putting aside the ones which failed. They are retried only after the pass is
+// complete: first from the original location, then, if failoverFolder is set,
+// from the same path in failoverFolder.
+// Files which could not be extracted at all are reported via FailedTarPartsError.
+func ExtractAllDeferringFailures(tarInterpreter TarInterpreter, files []ReaderMaker,
+	failoverFolder storage.Folder) error {
+	if len(files) == 0 {
+		return newNoFilesToExtractError()
+	}
+
+	downloadingConcurrency, err := getMaxExtractConcurrency()
+	if err != nil {
+		return err
+	}
+	failed := tryExtractFiles(files, tarInterpreter, downloadingConcurrency)
+	if len(failed) == 0 {
+		return nil
+	}
+	tracelog.WarningLogger.Printf("Failed to extract %d file(s), will retry them now:\n%s\n",
+		len(failed), strings.Join(readerMakersToFilePaths(failed), "\n"))
+
+	failed, err = extractAllWithRetries(tarInterpreter, failed)
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 && failoverFolder != nil {
+		tracelog.WarningLogger.Printf("Retrying %d file(s) from failover storage\n", len(failed))
+		failoverFiles := make([]ReaderMaker, 0, len(failed))
+		for _, file := range failed {
+			failoverFiles = append(failoverFiles, newStorageReaderMaker(failoverFolder, file.Path()))
+		}
+		failed, err = extractAllWithRetries(tarInterpreter, failoverFiles)
+		if err != nil {
+			return err
+		}
+	}
+	if len(failed) > 0 {
+		return newFailedTarPartsError(readerMakersToFilePaths(failed))
+	}
+	return nil
+}
+
+// extractAllWithRetries extracts files, retrying failed ones with decreasing concurrency,
+// until either all of them are extracted or a whole run fails with the concurrency of 1.
+// Returns the files that were not extracted.
+func extractAllWithRetries(tarInterpreter TarInterpreter, files []ReaderMaker) (failed []ReaderMaker, err error) {
 	retrier := newExponentialRetrier(MinExtractRetryWait, MaxExtractRetryWait)
 	// Set maximum number of goroutines spun off by ExtractAll
-	downloadingConcurrency, err := getMaxDownloadConcurrency()
+	downloadingConcurrency, err := getMaxExtractConcurrency()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	for currentRun := files; len(currentRun) > 0; {
-		var failed []ReaderMaker
 		failed = tryExtractFiles(currentRun, tarInterpreter, downloadingConcurrency)
 		if downloadingConcurrency > 1 {
 			downloadingConcurrency /= 2
 		} else if len(failed) == len(currentRun) {
-			return errors.Errorf("failed to extract files:\n%s\n",
-				strings.Join(readerMakersToFilePaths(failed), "\n"))
+			return failed, nil
 		}
 		currentRun = failed
 		if len(failed) > 0 {
 			retrier.retry()
 		}
 	}
-	return nil
+	return nil, nil
+}
+
+// tarSlotsAcquirer is implemented by interpreters limiting the number of tars extracted to each destination.
+// Slots are acquired before a tar is scheduled, so a tar waiting for a busy destination doesn't occupy
+// a downloading slot and doesn't block extraction of tars to other destinations.
+type tarSlotsAcquirer interface {
+	limitsTars() bool
+	acquireTarSlots(tarPath string) (release func())
 }
 
 // TODO : unit tests
 func tryExtractFiles(files []ReaderMaker, tarInterpreter TarInterpreter, downloadingConcurrency int) (failed []ReaderMaker) {
 	downloadingContext := context.TODO()
 	downloadingSemaphore := semaphore.NewWeighted(int64(downloadingConcurrency))
-	crypter := ConfigureCrypter()
+	crypter := ConfigureCrypterForContentType(BackupContentType)
 	isFailed := sync.Map{}
 
+	slotsAcquirer, limitsTars := tarInterpreter.(tarSlotsAcquirer)
+	limitsTars = limitsTars && slotsAcquirer.limitsTars()
+	scheduled := sync.WaitGroup{}
 	for _, file := range files {
-		_ = downloadingSemaphore.Acquire(downloadingContext, 1)
-		fileClosure := file
-
-		extractingReader, pipeWriter := io.Pipe()
-		decompressingWriter := &EmptyWriteIgnorer{pipeWriter}
-		go func() {
-			err := DecryptAndDecompressTar(decompressingWriter, fileClosure, crypter)
-			utility.LoggedClose(decompressingWriter, "")
-			tracelog.InfoLogger.Printf("Finished decompression of %s", fileClosure.Path())
-			if err != nil {
-				isFailed.Store(fileClosure, true)
-				tracelog.ErrorLogger.Println(fileClosure.Path(), err)
-			}
-		}()
-		go func() {
-			defer downloadingSemaphore.Release(1)
-			err := extractOne(tarInterpreter, extractingReader)
-			err = errors.Wrapf(err, "Extraction error in %s", fileClosure.Path())
-			utility.LoggedClose(extractingReader, "")
-			tracelog.InfoLogger.Printf("Finished extraction of %s", fileClosure.Path())
-			if err != nil {
-				isFailed.Store(fileClosure, true)
-				tracelog.ErrorLogger.Println(err)
-			}
-		}()
+		if !limitsTars {
+			_ = downloadingSemaphore.Acquire(downloadingContext, 1)
+			extractFile(file, tarInterpreter, crypter, &isFailed, func() { downloadingSemaphore.Release(1) })
+			continue
+		}
+		scheduled.Add(1)
+		go func(file ReaderMaker) {
+			defer scheduled.Done()
+			releaseSlots := slotsAcquirer.acquireTarSlots(file.Path())
+			_ = downloadingSemaphore.Acquire(downloadingContext, 1)
+			extractFile(file, tarInterpreter, crypter, &isFailed, func() {
+				downloadingSemaphore.Release(1)
+				releaseSlots()
+			})
+		}(file)
 	}
+	scheduled.Wait()
 
 	_ = downloadingSemaphore.Acquire(downloadingContext, int64(downloadingConcurrency))
 	isFailed.Range(func(failedFile, _ interface{}) bool {
@@ -211,3 +288,30 @@ func tryExtractFiles(files []ReaderMaker, tarInterpreter TarInterpreter, downloa
 	})
 	return failed
 }
+
+// extractFile downloads and extracts the file in the background, release is called when extraction is finished
+func extractFile(fileClosure ReaderMaker, tarInterpreter TarInterpreter, crypter crypto.Crypter,
+	isFailed *sync.Map, release func()) {
+	extractingReader, pipeWriter := io.Pipe()
+	decompressingWriter := &EmptyWriteIgnorer{pipeWriter}
+	go func() {
+		err := DecryptAndDecompressTar(decompressingWriter, fileClosure, crypter)
+		utility.LoggedClose(decompressingWriter, "")
+		tracelog.InfoLogger.Printf("Finished decompression of %s", fileClosure.Path())
+		if err != nil {
+			isFailed.Store(fileClosure, true)
+			tracelog.ErrorLogger.Println(fileClosure.Path(), err)
+		}
+	}()
+	go func() {
+		defer release()
+		err := extractOne(tarInterpreter, extractingReader)
+		err = errors.Wrapf(err, "Extraction error in %s", fileClosure.Path())
+		utility.LoggedClose(extractingReader, "")
+		tracelog.InfoLogger.Printf("Finished extraction of %s", fileClosure.Path())
+		if err != nil {
+			isFailed.Store(fileClosure, true)
+			tracelog.ErrorLogger.Println(err)
+		}
+	}()
+}
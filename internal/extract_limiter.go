@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wal-g/wal-g/utility"
+	"golang.org/x/sync/semaphore"
+)
+
+// extractLimiter limits number of files written concurrently to each of the configured directories
+// (tablespace locations or mount points), so extraction to several disks can saturate each disk independently.
+type extractLimiter struct {
+	// directories are sorted from the longest, so the most specific directory is chosen
+	directories []string
+	semaphores  map[string]*semaphore.Weighted
+}
+
+func newExtractLimiter(concurrencies map[string]int) *extractLimiter {
+	limiter := &extractLimiter{
+		directories: make([]string, 0, len(concurrencies)),
+		semaphores:  make(map[string]*semaphore.Weighted, len(concurrencies)),
+	}
+	for directory, concurrency := range concurrencies {
+		limiter.directories = append(limiter.directories, directory)
+		limiter.semaphores[directory] = semaphore.NewWeighted(int64(concurrency))
+	}
+	sort.Slice(limiter.directories, func(i, j int) bool {
+		return len(limiter.directories[i]) > len(limiter.directories[j])
+	})
+	return limiter
+}
+
+// acquire blocks until the file at targetPath can be written. Returned function releases the slot.
+func (limiter *extractLimiter) acquire(targetPath string) func() {
+	return limiter.acquireAll([]string{targetPath})
+}
+
+// acquireAll blocks until files at all targetPaths can be written, taking one slot in each of their directories.
+// Directories are acquired in the same order by everyone, so concurrent callers do not deadlock.
+// Returned function releases the slots.
+func (limiter *extractLimiter) acquireAll(targetPaths []string) func() {
+	directorySet := make(map[string]bool)
+	for _, targetPath := range targetPaths {
+		if directory, ok := limiter.directoryOf(targetPath); ok {
+			directorySet[directory] = true
+		}
+	}
+	directories := make([]string, 0, len(directorySet))
+	for directory := range directorySet {
+		directories = append(directories, directory)
+	}
+	sort.Strings(directories)
+	for _, directory := range directories {
+		_ = limiter.semaphores[directory].Acquire(context.TODO(), 1)
+	}
+	return func() {
+		for _, directory := range directories {
+			limiter.semaphores[directory].Release(1)
+		}
+	}
+}
+
+// directoryOf returns the most specific of configured directories containing targetPath
+func (limiter *extractLimiter) directoryOf(targetPath string) (string, bool) {
+	for _, directory := range limiter.directories {
+		if utility.IsInDirectory(targetPath, directory) {
+			return directory, true
+		}
+	}
+	return "", false
+}
+
+// resolveExtractPath returns the path where the file from backup is actually written:
+// files of tablespaces are written to tablespace locations instead of pg_tblspc symlinks.
+// spec must be the one used to create the symlinks, i.e. already remapped by --tablespace-map.
+func resolveExtractPath(dbDataDirectory string, spec *TablespaceSpec, fileName string) string {
+	if spec != nil {
+		relativeName := strings.TrimPrefix(fileName, utility.PathSeparator)
+		for _, location := range spec.tablespaceLocations() {
+			if strings.HasPrefix(relativeName, location.Symlink+utility.PathSeparator) {
+				return path.Join(location.Location, strings.TrimPrefix(relativeName, location.Symlink))
+			}
+		}
+	}
+	return path.Join(dbDataDirectory, fileName)
+}
+
+// ParseExtractConcurrencies parses directory=concurrency pairs separated by commas
+func ParseExtractConcurrencies(value string) (map[string]int, error) {
+	concurrencies := make(map[string]int)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || !filepath.IsAbs(parts[0]) {
+			return nil, fmt.Errorf("Invalid extraction concurrency '%s', expected /absolute/directory=concurrency.\n", pair)
+		}
+		concurrency, err := strconv.Atoi(parts[1])
+		if err != nil || concurrency < MinAllowedConcurrency {
+			return nil, fmt.Errorf("Invalid extraction concurrency of '%s': '%s'.\n", parts[0], parts[1])
+		}
+		concurrencies[filepath.Clean(parts[0])] = concurrency
+	}
+	return concurrencies, nil
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExtractConcurrencies(t *testing.T) {
+	concurrencies, err := ParseExtractConcurrencies("/mnt/disk1=4, /mnt/disk2/=8")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"/mnt/disk1": 4, "/mnt/disk2": 8}, concurrencies)
+
+	concurrencies, err = ParseExtractConcurrencies("")
+	assert.NoError(t, err)
+	assert.Empty(t, concurrencies)
+
+	_, err = ParseExtractConcurrencies("mnt/disk1=4")
+	assert.Error(t, err)
+	_, err = ParseExtractConcurrencies("/mnt/disk1=0")
+	assert.Error(t, err)
+	_, err = ParseExtractConcurrencies("/mnt/disk1")
+	assert.Error(t, err)
+}
+
+func TestResolveExtractPath(t *testing.T) {
+	spec := NewTablespaceSpec("/psql")
+	spec.addTablespace("16384", "/mnt/disk1/ts")
+
+	assert.Equal(t, "/mnt/disk1/ts/PG_12/16385/16386",
+		resolveExtractPath("/psql", &spec, "pg_tblspc/16384/PG_12/16385/16386"))
+	assert.Equal(t, "/mnt/disk1/ts/PG_12/16385/16386",
+		resolveExtractPath("/psql", &spec, "/pg_tblspc/16384/PG_12/16385/16386"))
+	assert.Equal(t, "/psql/base/1/1259", resolveExtractPath("/psql", &spec, "base/1/1259"))
+	assert.Equal(t, "/psql/base/1/1259", resolveExtractPath("/psql", nil, "base/1/1259"))
+}
+
+func TestExtractLimiterChoosesMostSpecificDirectory(t *testing.T) {
+	limiter := newExtractLimiter(map[string]int{"/mnt": 1, "/mnt/disk1": 1})
+
+	// both files hold their own pools, so the second acquire does not block
+	releaseDisk := limiter.acquire("/mnt/disk1/ts/file")
+	releaseMnt := limiter.acquire("/mnt/other/file")
+	assert.False(t, limiter.semaphores["/mnt/disk1"].TryAcquire(1))
+	assert.False(t, limiter.semaphores["/mnt"].TryAcquire(1))
+	releaseDisk()
+	releaseMnt()
+
+	// files outside of configured directories are not limited
+	limiter.acquire("/psql/base/1/1259")()
+	assert.True(t, limiter.semaphores["/mnt"].TryAcquire(1))
+}
+
+func TestExtractLimiterAcquireAll(t *testing.T) {
+	limiter := newExtractLimiter(map[string]int{"/mnt/disk1": 1, "/mnt/disk2": 2})
+
+	release := limiter.acquireAll([]string{"/mnt/disk1/a", "/mnt/disk1/b", "/mnt/disk2/c", "/psql/base/1/1259"})
+	// a single slot is taken in each directory
+	assert.False(t, limiter.semaphores["/mnt/disk1"].TryAcquire(1))
+	assert.True(t, limiter.semaphores["/mnt/disk2"].TryAcquire(1))
+	limiter.semaphores["/mnt/disk2"].Release(1)
+	release()
+
+	assert.True(t, limiter.semaphores["/mnt/disk1"].TryAcquire(1))
+	assert.True(t, limiter.semaphores["/mnt/disk2"].TryAcquire(2))
+}
+
+func TestFileTarInterpreterAcquiresTarSlotsOfRemappedTablespaces(t *testing.T) {
+	spec := NewTablespaceSpec("/home/psql")
+	spec.addTablespace("16384", "/mnt/disk1/ts")
+	remapped, err := spec.remapped("/psql", map[string]string{"/mnt/disk1/ts": "/mnt/disk2/ts"})
+	assert.NoError(t, err)
+	sentinel := BackupSentinelDto{
+		TablespaceSpec: remapped,
+		TarFileSets:    map[string][]string{"part_001.tar.lz4": {"/pg_tblspc/16384/PG_12/16385/16386"}},
+	}
+	tarInterpreter := NewFileTarInterpreter("/psql", sentinel, nil, false)
+	tarInterpreter.SetExtractConcurrencies(map[string]int{"/mnt/disk1": 1, "/mnt/disk2": 1})
+	assert.True(t, tarInterpreter.limitsTars())
+
+	release := tarInterpreter.acquireTarSlots("base_000000010000000000000002/tar_partitions/part_001.tar.lz4")
+	assert.True(t, tarInterpreter.extractLimiter.semaphores["/mnt/disk1"].TryAcquire(1))
+	assert.False(t, tarInterpreter.extractLimiter.semaphores["/mnt/disk2"].TryAcquire(1))
+	release()
+
+	// tars unknown to the sentinel are not limited
+	tarInterpreter.acquireTarSlots("base_000000010000000000000002/tar_partitions/part_002.tar.lz4")()
+	assert.True(t, tarInterpreter.extractLimiter.semaphores["/mnt/disk2"].TryAcquire(1))
+}
@@ -7,7 +7,9 @@ import (
 	"testing"
 
 	"github.com/pkg/errors"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/storages/memory"
 	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/internal/crypto/openpgp"
 	"github.com/wal-g/wal-g/testtools"
@@ -57,6 +59,43 @@ func TestTar(t *testing.T) {
 	assert.Equalf(t, bCopy, buf.Out, "extract: Unbundled tar output does not match input.")
 }
 
+func TestExtractAllDeferringFailures_failoverFolder(t *testing.T) {
+	defer setupExtractRetryTest()()
+
+	member := &bytes.Buffer{}
+	testtools.CreateTar(member, &io.LimitedReader{R: testtools.NewStrideByteReader(10), N: 1024})
+	failoverFolder := memory.NewFolder("", memory.NewStorage())
+	assert.NoError(t, failoverFolder.PutObject("part_1.tar", bytes.NewReader(member.Bytes())))
+
+	buf := &testtools.BufferTarInterpreter{}
+	files := []internal.ReaderMaker{&FailingReaderMaker{"part_1.tar"}}
+	err := internal.ExtractAllDeferringFailures(buf, files, failoverFolder)
+	assert.NoError(t, err)
+	assert.Len(t, buf.Out, 1024)
+}
+
+func TestExtractAllDeferringFailures_reportsFailedTars(t *testing.T) {
+	defer setupExtractRetryTest()()
+
+	files := []internal.ReaderMaker{&FailingReaderMaker{"part_1.tar"}, &FailingReaderMaker{"part_2.tar"}}
+	err := internal.ExtractAllDeferringFailures(&testtools.NOPTarInterpreter{}, files, nil)
+	assert.IsType(t, internal.FailedTarPartsError{}, err)
+	assert.ElementsMatch(t, []string{"part_1.tar", "part_2.tar"}, err.(internal.FailedTarPartsError).TarNames)
+}
+
+// setupExtractRetryTest disables retry delays and limits download concurrency,
+// returning a function which restores the previous values.
+func setupExtractRetryTest() func() {
+	concurrency := viper.Get(internal.DownloadConcurrencySetting)
+	minWait, maxWait := internal.MinExtractRetryWait, internal.MaxExtractRetryWait
+	viper.Set(internal.DownloadConcurrencySetting, "1")
+	internal.MinExtractRetryWait, internal.MaxExtractRetryWait = 0, 0
+	return func() {
+		viper.Set(internal.DownloadConcurrencySetting, concurrency)
+		internal.MinExtractRetryWait, internal.MaxExtractRetryWait = minWait, maxWait
+	}
+}
+
 //func TestExtractAll(t *testing.T) {
 //	os.Setenv("WALE_GPG_KEY_ID", "3C19717A2B308DF0")
 //	os.Setenv("WALG_DOWNLOAD_CONCURRENCY", "1")
@@ -249,3 +288,11 @@ type BufferReaderMaker struct {
 
 func (b *BufferReaderMaker) Reader() (io.ReadCloser, error) { return ioutil.NopCloser(b.Buf), nil }
 func (b *BufferReaderMaker) Path() string                   { return b.Key }
+
+// Used to mock files which can not be downloaded.
+type FailingReaderMaker struct {
+	Key string
+}
+
+func (f *FailingReaderMaker) Reader() (io.ReadCloser, error) { return nil, errors.New("unavailable") }
+func (f *FailingReaderMaker) Path() string                   { return f.Key }
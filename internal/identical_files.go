@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// skipIdenticalFiles excludes files identical to the ones in the backup from filesToUnwrap.
+// A file is identical if its modification time is the same as in the backup, the way delta backups skip unchanged files,
+// or if its content matches the checksum in the backup. The modification time describes the file as of the backup,
+// so such files are excluded from the whole delta chain, including incremented ones.
+// Tars holding only identical files are not downloaded then, e.g. when restore is repeated after a failure.
+func skipIdenticalFiles(dbDataDirectory string, files BackupFileList,
+	filesToUnwrap map[string]bool) (map[string]bool, error) {
+	if filesToUnwrap == nil {
+		return filesToUnwrap, nil
+	}
+	remainingFiles := make(map[string]bool, len(filesToUnwrap))
+	skippedCount := 0
+	for fileName := range filesToUnwrap {
+		description, ok := files[fileName]
+		if !ok {
+			remainingFiles[fileName] = true
+			continue
+		}
+		isIdentical, err := isFileIdentical(path.Join(dbDataDirectory, fileName), description)
+		if err != nil {
+			return nil, err
+		}
+		if !isIdentical {
+			remainingFiles[fileName] = true
+			continue
+		}
+		tracelog.DebugLogger.Printf("Skipping '%s', it is identical to the file in the backup\n", fileName)
+		skippedCount++
+	}
+	if skippedCount > 0 {
+		tracelog.InfoLogger.Printf("Skipped %d files identical to the ones in the backup\n", skippedCount)
+	}
+	return remainingFiles, nil
+}
+
+func isFileIdentical(filePath string, description BackupFileDescription) (bool, error) {
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to stat '%s' to compare with the backup", filePath)
+	}
+	if !description.MTime.IsZero() && info.Mode().IsRegular() && info.ModTime().Equal(description.MTime) {
+		return true, nil
+	}
+	if description.SHA256 == "" || description.IsIncremented || description.IsSkipped {
+		return false, nil
+	}
+	return hasFileChecksum(filePath, description.SHA256)
+}
+
+// hasFileChecksum checks if the local file exists and has the given SHA256 checksum
+func hasFileChecksum(filePath, checksum string) (bool, error) {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to open '%s' to compare with the backup", filePath)
+	}
+	defer utility.LoggedClose(file, "")
+	fileHash := sha256.New()
+	if _, err = io.Copy(fileHash, NewDiskLimitReader(file)); err != nil {
+		return false, errors.Wrapf(err, "failed to read '%s' to compare with the backup", filePath)
+	}
+	return hex.EncodeToString(fileHash.Sum(nil)) == checksum, nil
+}
+
+// checkDirectoryForRestore checks that the directory is empty or holds only files of the backup, e.g. left by a failed
+// fetch. The fetch is resumed then: identical files are skipped by skipIdenticalFiles and the others are overwritten.
+func checkDirectoryForRestore(dbDataDirectory string, sentinelDto BackupSentinelDto) error {
+	isEmpty, err := isDirectoryEmpty(dbDataDirectory)
+	if err != nil || isEmpty {
+		return err
+	}
+	if sentinelDto.Files == nil {
+		return newNonEmptyDbDataDirectoryError(dbDataDirectory)
+	}
+	foreignFiles := 0
+	err = walkDataDirectory(dbDataDirectory, func(filePath, relativePath string, info os.FileInfo) error {
+		if _, ok := sentinelDto.Files[relativePath]; ok {
+			return nil
+		}
+		if UtilityFilePaths[relativePath] || UtilityFilePaths[strings.TrimPrefix(relativePath, utility.PathSeparator)] {
+			return nil
+		}
+		tracelog.DebugLogger.Printf("File %s does not exist in the backup\n", filePath)
+		foreignFiles++
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to check files of '%s'", dbDataDirectory)
+	}
+	if foreignFiles > 0 {
+		return newNonEmptyDbDataDirectoryError(dbDataDirectory)
+	}
+	tracelog.InfoLogger.Printf("Directory %s holds only files of the backup, resuming restore\n", dbDataDirectory)
+	return nil
+}
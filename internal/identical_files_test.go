@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkipIdenticalFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "identical_files")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "base", "1"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "base", "1", "1000"), []byte("same"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "base", "1", "1001"), []byte("changed"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "base", "1", "1003"), []byte("same"), 0600))
+
+	checksum := sha256.Sum256([]byte("same"))
+	sameChecksum := hex.EncodeToString(checksum[:])
+	files := BackupFileList{
+		"/base/1/1000": {SHA256: sameChecksum},
+		"/base/1/1001": {SHA256: sameChecksum},
+		"/base/1/1002": {SHA256: sameChecksum},
+		"/base/1/1003": {SHA256: sameChecksum, IsIncremented: true},
+		"/base/1/1004": {},
+	}
+	filesToUnwrap := map[string]bool{
+		"/base/1/1000": true, "/base/1/1001": true, "/base/1/1002": true, "/base/1/1003": true, "/base/1/1004": true,
+		"/backup_label": true,
+	}
+
+	remainingFiles, err := skipIdenticalFiles(dir, files, filesToUnwrap)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{
+		"/base/1/1001": true, "/base/1/1002": true, "/base/1/1003": true, "/base/1/1004": true,
+		"/backup_label": true,
+	}, remainingFiles)
+}
+
+func TestSkipIdenticalFiles_SkipsTarsOfFilesWithSameModTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "identical_files")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "base", "1"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "base", "1", "1000"), []byte("restored"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "base", "1", "1001"), []byte("changed"), 0600))
+	mtime := time.Date(2020, 5, 1, 10, 0, 0, 123456789, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "base", "1", "1000"), mtime, mtime))
+
+	sentinelDto := BackupSentinelDto{
+		Files: BackupFileList{
+			"/base/1/1000": {IsIncremented: true, MTime: mtime},
+			"/base/1/1001": {IsSkipped: true, MTime: mtime},
+		},
+		TarFileSets: map[string][]string{
+			"part_1.tar.lz4": {"/base/1/1000"},
+			"part_2.tar.lz4": {"/base/1/1001"},
+		},
+	}
+	filesToUnwrap := map[string]bool{"/base/1/1000": true, "/base/1/1001": true}
+
+	remainingFiles, err := skipIdenticalFiles(dir, sentinelDto.Files, filesToUnwrap)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"/base/1/1001": true}, remainingFiles)
+	assert.False(t, shouldUnwrapTar("part_1.tar.lz4", sentinelDto, remainingFiles))
+	assert.True(t, shouldUnwrapTar("part_2.tar.lz4", sentinelDto, remainingFiles))
+
+	baseFilesToUnwrap, err := GetBaseFilesToUnwrap(sentinelDto.Files, remainingFiles)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"/base/1/1001": true}, baseFilesToUnwrap)
+}
+
+func TestSkipIdenticalFiles_UnwrapAll(t *testing.T) {
+	remainingFiles, err := skipIdenticalFiles("/nonexistent", BackupFileList{}, UnwrapAll)
+	require.NoError(t, err)
+	assert.Nil(t, remainingFiles)
+}
+
+func TestCheckDirectoryForRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "identical_files")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sentinelDto := BackupSentinelDto{Files: BackupFileList{"/base/1/1000": {}}}
+	assert.NoError(t, checkDirectoryForRestore(dir, sentinelDto))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "base", "1"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "base", "1", "1000"), []byte("partial"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, BackupLabelFilename), []byte("label"), 0600))
+	assert.NoError(t, checkDirectoryForRestore(dir, sentinelDto))
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "base", "1", "1001"), []byte("foreign"), 0600))
+	assert.IsType(t, NonEmptyDbDataDirectoryError{}, checkDirectoryForRestore(dir, sentinelDto))
+	assert.IsType(t, NonEmptyDbDataDirectoryError{}, checkDirectoryForRestore(dir, BackupSentinelDto{}))
+}
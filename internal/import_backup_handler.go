@@ -0,0 +1,267 @@
+package internal
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/ioextensions"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	importBaseTarName = "base.tar"
+	importWalTarName  = "pg_wal.tar"
+	gzipFileExtension = ".gz"
+)
+
+type UnsupportedImportBackupError struct {
+	error
+}
+
+func newUnsupportedImportBackupError(reason string) UnsupportedImportBackupError {
+	return UnsupportedImportBackupError{errors.Errorf("Backup can't be imported: %s", reason)}
+}
+
+func (err UnsupportedImportBackupError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// TODO : unit tests
+// HandleImportBackup is invoked to perform wal-g import-backup.
+// The output of pg_basebackup in tar or plain format is uploaded as a full backup named by its start WAL file.
+// WAL included into the backup is uploaded to WAL storage, its end is used as the finish LSN of the backup.
+func HandleImportBackup(uploader *WalUploader, backupDirectory string, isPermanent bool) {
+	folder := uploader.UploadingFolder
+	walUploader := uploader.clone()
+	walUploader.UploadingFolder = folder.GetSubFolder(utility.WalPath)
+	uploader.UploadingFolder = folder.GetSubFolder(utility.BaseBackupPath)
+
+	var info *RemoteBackupInfo
+	var walFiles []string
+	var err error
+	if _, statErr := os.Stat(filepath.Join(backupDirectory, BackupLabelFilename)); statErr == nil {
+		info, walFiles, err = importPlainBackup(uploader, walUploader, backupDirectory)
+	} else {
+		info, walFiles, err = importTarBackup(uploader, walUploader, backupDirectory)
+	}
+	tracelog.ErrorLogger.FatalfOnError("Failed to import backup: %v\n", err)
+
+	finishLsn, err := importedBackupFinishLsn(info, walFiles)
+	tracelog.ErrorLogger.FatalOnError(err)
+	uploader.finish()
+	walUploader.finish()
+	if uploader.Failed.Load().(bool) {
+		tracelog.ErrorLogger.Fatalf("Uploading failed during '%s' backup.\n", info.Name)
+	}
+
+	var meta ExtendedMetadataDto
+	meta.StartTime = info.StartTime
+	if meta.StartTime.IsZero() {
+		meta.StartTime = utility.TimeNowCrossPlatformUTC()
+	}
+	meta.Hostname, _ = os.Hostname()
+	meta.DataDir = backupDirectory
+	meta.IsPermanent = isPermanent
+	sentinelDto := &BackupSentinelDto{
+		BackupStartLSN:   &info.StartLSN,
+		BackupFinishLSN:  &finishLsn,
+		PgVersion:        info.PgVersion,
+		Files:            info.Files,
+		UserData:         GetSentinelUserData(),
+		SystemIdentifier: info.SystemIdentifier,
+		UncompressedSize: info.UncompressedSize,
+		CompressedSize:   atomic.LoadInt64(uploader.tarSize),
+	}
+	err = uploadMetadata(uploader.Uploader, sentinelDto, info.Name, meta)
+	tracelog.ErrorLogger.FatalfOnError("Failed to upload metadata file for backup: %v\n", err)
+	err = UploadSentinel(uploader.Uploader, sentinelDto, info.Name)
+	tracelog.ErrorLogger.FatalfOnError("Failed to upload sentinel file for backup: %v\n", err)
+	tracelog.InfoLogger.Println("Imported backup with name " + info.Name)
+}
+
+// importPlainBackup uploads the data directory written by pg_basebackup -F plain
+func importPlainBackup(uploader, walUploader *WalUploader, backupDirectory string) (*RemoteBackupInfo, []string, error) {
+	label, err := ioutil.ReadFile(filepath.Join(backupDirectory, BackupLabelFilename))
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := parseBackupLabel(string(label))
+	if err != nil {
+		return nil, nil, err
+	}
+	pgVersion, err := ioutil.ReadFile(filepath.Join(backupDirectory, pgVersionFileName))
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.PgVersion, err = parsePgVersion(string(pgVersion)); err != nil {
+		return nil, nil, err
+	}
+	pgControl, err := ioutil.ReadFile(filepath.Join(backupDirectory, PgControlPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	info.SystemIdentifier = parseSystemIdentifier(pgControl)
+	if err = CheckBackupIsNew(uploader.UploadingFolder, info.Name); err != nil {
+		return nil, nil, err
+	}
+
+	// WAL directory is excluded from backups, so its segments are uploaded to WAL storage
+	walFiles := make([]string, 0)
+	for _, walDirectory := range []string{"pg_wal", "pg_xlog"} {
+		walInfos, err := ioutil.ReadDir(filepath.Join(backupDirectory, walDirectory))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, walInfo := range walInfos {
+			if !walInfo.Mode().IsRegular() || !isImportedWalFile(walInfo.Name()) {
+				continue
+			}
+			file, err := os.Open(filepath.Join(backupDirectory, walDirectory, walInfo.Name()))
+			if err != nil {
+				return nil, nil, err
+			}
+			err = walUploader.UploadWalFile(newNamedReaderImpl(file, walInfo.Name()))
+			utility.LoggedClose(file, "")
+			if err != nil {
+				return nil, nil, err
+			}
+			walFiles = append(walFiles, walInfo.Name())
+		}
+	}
+
+	files, uncompressedSize, err := uploadDirectoryAsBackup(uploader.Uploader, backupDirectory, info.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info.UncompressedSize = uncompressedSize
+	files.Range(func(key, value interface{}) bool {
+		info.Files[key.(string)] = value.(BackupFileDescription)
+		return true
+	})
+	return info, walFiles, nil
+}
+
+// importTarBackup uploads base.tar written by pg_basebackup -F tar and WAL from pg_wal.tar.
+// Tarballs of tablespaces are not supported.
+func importTarBackup(uploader, walUploader *WalUploader, backupDirectory string) (*RemoteBackupInfo, []string, error) {
+	infos, err := ioutil.ReadDir(backupDirectory)
+	if err != nil {
+		return nil, nil, err
+	}
+	var baseTarPath, walTarPath string
+	for _, fileInfo := range infos {
+		name := strings.TrimSuffix(fileInfo.Name(), gzipFileExtension)
+		switch {
+		case name == importBaseTarName:
+			baseTarPath = filepath.Join(backupDirectory, fileInfo.Name())
+		case name == importWalTarName:
+			walTarPath = filepath.Join(backupDirectory, fileInfo.Name())
+		case strings.HasSuffix(name, ".tar"):
+			return nil, nil, newUnsupportedImportBackupError(fmt.Sprintf("tablespace tarball %s", fileInfo.Name()))
+		}
+	}
+	if baseTarPath == "" {
+		return nil, nil, newUnsupportedImportBackupError(
+			fmt.Sprintf("neither %s nor %s are found in %s", BackupLabelFilename, importBaseTarName, backupDirectory))
+	}
+
+	baseTar, err := openImportedTar(baseTarPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer utility.LoggedClose(baseTar, "")
+	makeTarBallMaker := func(backupName string) (TarBallMaker, error) {
+		if err := CheckBackupIsNew(uploader.UploadingFolder, backupName); err != nil {
+			return nil, err
+		}
+		return NewStorageTarBallMaker(backupName, uploader.Uploader), nil
+	}
+	info, err := RepackBaseBackupStream(baseTar, makeTarBallMaker, ConfigureCrypterForContentType(BackupContentType),
+		viper.GetInt64(TarSizeThresholdSetting), uploader.Compressor.FileExtension())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	walFiles := info.WalFiles
+	if walTarPath != "" {
+		walTar, err := openImportedTar(walTarPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer utility.LoggedClose(walTar, "")
+		tarReader := tar.NewReader(walTar)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "failed to read %s", walTarPath)
+			}
+			name := filepath.Base(header.Name)
+			if header.Typeflag != tar.TypeReg || !isImportedWalFile(name) {
+				continue
+			}
+			if err = walUploader.UploadWalFile(newNamedReaderImpl(tarReader, name)); err != nil {
+				return nil, nil, err
+			}
+			walFiles = append(walFiles, name)
+		}
+	}
+	return info, walFiles, nil
+}
+
+// openImportedTar opens the tarball, tarballs compressed by pg_basebackup -z are decompressed
+func openImportedTar(tarPath string) (io.ReadCloser, error) {
+	file, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(tarPath, gzipFileExtension) {
+		return file, nil
+	}
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		utility.LoggedClose(file, "")
+		return nil, errors.Wrapf(err, "failed to decompress %s", tarPath)
+	}
+	return &ioextensions.ReadCascadeCloser{Reader: gzipReader, Closer: file}, nil
+}
+
+func isImportedWalFile(name string) bool {
+	return isWalFilename(name) || strings.HasSuffix(name, ".history")
+}
+
+// importedBackupFinishLsn is the end of the last WAL segment of the backup timeline included into the backup.
+// It is not less than the LSN where the backup has finished, so the backup is consistent with this WAL.
+func importedBackupFinishLsn(info *RemoteBackupInfo, walFiles []string) (uint64, error) {
+	var lastSegmentNo WalSegmentNo
+	found := false
+	for _, name := range walFiles {
+		timeline, segmentNo, err := ParseWALFilename(name)
+		if err != nil || timeline != info.Timeline {
+			continue
+		}
+		if !found || WalSegmentNo(segmentNo) > lastSegmentNo {
+			lastSegmentNo = WalSegmentNo(segmentNo)
+			found = true
+		}
+	}
+	if !found || lastSegmentNo.next().firstLsn() <= info.StartLSN {
+		return 0, newUnsupportedImportBackupError("backup does not include WAL, take it with pg_basebackup -X fetch or -X stream")
+	}
+	return lastSegmentNo.next().firstLsn(), nil
+}
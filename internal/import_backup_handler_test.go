@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"archive/tar"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/utility"
+)
+
+func writeTestTar(t *testing.T, tarPath string, files map[string][]byte, order []string) {
+	file, err := os.Create(tarPath)
+	require.NoError(t, err)
+	defer file.Close()
+	writer := tar.NewWriter(file)
+	for _, name := range order {
+		require.NoError(t, writer.WriteHeader(&tar.Header{Name: name, Mode: 0600,
+			Size: int64(len(files[name])), Typeflag: tar.TypeReg, ModTime: time.Unix(1, 0)}))
+		_, err := writer.Write(files[name])
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+}
+
+func TestImportTarBackup(t *testing.T) {
+	dir, err := createTempDir("import")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	pgControl := make([]byte, 16)
+	binary.LittleEndian.PutUint64(pgControl, 42)
+	baseFiles := map[string][]byte{
+		BackupLabelFilename: []byte("START WAL LOCATION: 0/2000028 (file 000000010000000000000002)\n" +
+			"START TIME: 2020-05-12 10:20:30 UTC\nSTART TIMELINE: 1\n"),
+		"PG_VERSION":        []byte("9.6\n"),
+		"base/1/1259":       []byte("relation"),
+		"global/pg_control": pgControl,
+	}
+	writeTestTar(t, filepath.Join(dir, "base.tar"), baseFiles,
+		[]string{BackupLabelFilename, "PG_VERSION", "base/1/1259", "global/pg_control"})
+	walFiles := map[string][]byte{
+		"000000010000000000000002": []byte("wal"),
+		"000000010000000000000003": []byte("wal"),
+	}
+	writeTestTar(t, filepath.Join(dir, "pg_wal.tar"), walFiles,
+		[]string{"000000010000000000000002", "000000010000000000000003"})
+
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	uploader := NewWalUploader(lz4.Compressor{}, folder.GetSubFolder(utility.BaseBackupPath), nil)
+	walUploader := NewWalUploader(lz4.Compressor{}, folder.GetSubFolder(utility.WalPath), nil)
+	info, importedWal, err := importTarBackup(uploader, walUploader, dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, "base_000000010000000000000002", info.Name)
+	assert.Equal(t, 90600, info.PgVersion)
+	assert.Equal(t, uint64(42), *info.SystemIdentifier)
+	assert.Equal(t, time.Date(2020, 5, 12, 10, 20, 30, 0, time.UTC), info.StartTime)
+	assert.Contains(t, info.Files, "/base/1/1259")
+	finishLsn, err := importedBackupFinishLsn(info, importedWal)
+	require.NoError(t, err)
+	assert.Equal(t, 4*WalSegmentSize, finishLsn)
+	exists, err := folder.GetSubFolder(utility.WalPath).Exists("000000010000000000000003.lz4")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestImportedBackupFinishLsn_NoWal(t *testing.T) {
+	info := &RemoteBackupInfo{StartLSN: 2*WalSegmentSize + 40, Timeline: 2}
+	_, err := importedBackupFinishLsn(info, []string{"000000010000000000000002", "00000002.history"})
+	assert.IsType(t, UnsupportedImportBackupError{}, err)
+}
+
+func TestParsePgVersion(t *testing.T) {
+	version, err := parsePgVersion("12\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 120000, version)
+	version, err = parsePgVersion("9.6")
+	assert.NoError(t, err)
+	assert.Equal(t, 90600, version)
+	_, err = parsePgVersion("abc")
+	assert.Error(t, err)
+}
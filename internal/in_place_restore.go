@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const postmasterPidFilename = "postmaster.pid"
+
+// inPlaceKeptDirectories are not cleaned by in-place restore, since they hold server logs rather than cluster data
+var inPlaceKeptDirectories = map[string]bool{
+	"log":    true,
+	"pg_log": true,
+}
+
+// relationFilenameRegexp matches segment files of relations including their free space map, visibility map and init forks
+var relationFilenameRegexp = regexp.MustCompile(`^\d+(_(fsm|vm|init))?([.]\d+)?$`)
+
+type InPlaceRestoreError struct {
+	error
+}
+
+func newInPlaceRestoreError(dbDataDirectory, reason string) InPlaceRestoreError {
+	return InPlaceRestoreError{errors.Errorf("Can't restore backup in place into %s: %s", dbDataDirectory, reason)}
+}
+
+func (err InPlaceRestoreError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// prepareInPlaceRestore checks that the data directory can be reused and removes relation files which do not exist
+// in the backup, e.g. of tables dropped after the backup, so they do not waste space after restore.
+// Other files, like postgresql.auto.conf added by user, server logs and paths excluded from the backup by patterns, are kept.
+func prepareInPlaceRestore(dbDataDirectory string, sentinelDto BackupSentinelDto) error {
+	_, err := os.Stat(filepath.Join(dbDataDirectory, postmasterPidFilename))
+	if err == nil {
+		return newInPlaceRestoreError(dbDataDirectory,
+			fmt.Sprintf("%s exists, the server must be stopped", postmasterPidFilename))
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	if sentinelDto.Files == nil {
+		return newInPlaceRestoreError(dbDataDirectory, "backup has no list of files")
+	}
+
+	removedCount := 0
+	err = walkDataDirectory(dbDataDirectory, func(filePath, relativePath string, info os.FileInfo) error {
+		if _, ok := sentinelDto.Files[relativePath]; ok || !isRelationFile(relativePath) {
+			return nil
+		}
+		topDirectory := strings.Split(strings.TrimPrefix(relativePath, utility.PathSeparator), utility.PathSeparator)[0]
+		if inPlaceKeptDirectories[topDirectory] || matchesExcludePatterns(sentinelDto.ExcludePatterns, relativePath) {
+			return nil
+		}
+		tracelog.DebugLogger.Printf("Removing relation file %s, it does not exist in the backup\n", filePath)
+		err := os.Remove(filePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		removedCount++
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to remove files which do not exist in the backup")
+	}
+	tracelog.InfoLogger.Printf("Removed %d relation files which do not exist in the backup\n", removedCount)
+	return nil
+}
+
+func isRelationFile(relativePath string) bool {
+	topDirectory := strings.Split(strings.TrimPrefix(relativePath, utility.PathSeparator), utility.PathSeparator)[0]
+	if topDirectory != DefaultTablespace && topDirectory != GlobalTablespace && topDirectory != NonDefaultTablespace {
+		return false
+	}
+	return relationFilenameRegexp.MatchString(path.Base(relativePath))
+}
+
+// setRestoredModTime sets modification time of the restored file to the one recorded in the backup,
+// so the file is skipped by skipIdenticalFiles if restore is repeated before it is changed
+func setRestoredModTime(targetPath string, description BackupFileDescription) error {
+	if description.MTime.IsZero() {
+		return nil
+	}
+	err := os.Chtimes(targetPath, description.MTime, description.MTime)
+	return errors.Wrapf(err, "Interpret: failed to set modification time of '%s'", targetPath)
+}
+
+// rewriteFileInPlace writes the file from the backup over the existing one.
+// Only pages which differ from the existing content are written, the file is truncated to the size in the backup.
+func rewriteFileInPlace(fileReader io.Reader, fileInfo *tar.Header, targetPath string) error {
+	err := PrepareDirs(fileInfo.Name, targetPath)
+	if err != nil {
+		return errors.Wrap(err, "Interpret: failed to create all directories")
+	}
+	file, err := os.OpenFile(targetPath, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open file: '%s'", targetPath)
+	}
+	defer utility.LoggedClose(file, "")
+
+	backupPage := make([]byte, DatabasePageSize)
+	existingPage := make([]byte, DatabasePageSize)
+	var offset int64
+	rewrittenPages := 0
+	for {
+		pageSize, err := io.ReadFull(fileReader, backupPage)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return errors.Wrapf(err, "Interpret: failed to read '%s' from backup", fileInfo.Name)
+		}
+		existingSize, readErr := io.ReadFull(file, existingPage[:pageSize])
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return errors.Wrapf(readErr, "Interpret: failed to read existing file '%s'", targetPath)
+		}
+		if existingSize != pageSize || !bytes.Equal(existingPage[:pageSize], backupPage[:pageSize]) {
+			if _, err := file.WriteAt(backupPage[:pageSize], offset); err != nil {
+				return errors.Wrapf(err, "Interpret: failed to write '%s'", targetPath)
+			}
+			rewrittenPages++
+		}
+		offset += int64(pageSize)
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() != offset {
+		if err = file.Truncate(offset); err != nil {
+			return errors.Wrapf(err, "Interpret: failed to truncate '%s'", targetPath)
+		}
+		rewrittenPages++
+	}
+	if err = os.Chmod(targetPath, os.FileMode(fileInfo.Mode)); err != nil {
+		return errors.Wrap(err, "Interpret: chmod failed")
+	}
+	if rewrittenPages == 0 {
+		tracelog.DebugLogger.Printf("'%s' is not changed\n", targetPath)
+		return nil
+	}
+	tracelog.DebugLogger.Printf("Rewrote %d pages of '%s'\n", rewrittenPages, targetPath)
+	return errors.Wrap(file.Sync(), "Interpret: fsync failed")
+}
+
+// removeExistingLink removes file in place of link being restored, since links can't be overwritten
+func removeExistingLink(targetPath string) error {
+	err := os.Remove(targetPath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Interpret: failed to remove existing '%s'", targetPath)
+	}
+	return nil
+}
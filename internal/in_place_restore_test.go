@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteFileInPlace(t *testing.T) {
+	dir, err := createTempDir("in_place")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "base", "1", "1259")
+	writeTestRelationFile(t, filePath, makeTestPage(0x100), makeTestPage(0x200), makeTestPage(0x300))
+
+	backupData := append(makeTestPage(0x100), makeTestPage(0x250)...)
+	header := &tar.Header{Name: "/base/1/1259", Mode: 0600, Size: int64(len(backupData))}
+	err = rewriteFileInPlace(bytes.NewReader(backupData), header, filePath)
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, backupData, data)
+}
+
+func TestFileTarInterpreter_SetsModTimeOfRestoredFiles(t *testing.T) {
+	for _, inPlace := range []bool{false, true} {
+		dir, err := createTempDir("in_place")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+		filePath := filepath.Join(dir, "base", "1", "1259")
+		writeTestRelationFile(t, filePath, makeTestPage(0x100))
+		mtime := time.Date(2020, 5, 1, 10, 0, 0, 123456789, time.UTC)
+
+		sentinelDto := BackupSentinelDto{Files: BackupFileList{"/base/1/1259": {MTime: mtime}}}
+		interpreter := NewFileTarInterpreter(dir, sentinelDto, nil, false)
+		interpreter.inPlace = inPlace
+		backupData := makeTestPage(0x200)
+		err = interpreter.Interpret(bytes.NewReader(backupData),
+			&tar.Header{Name: "/base/1/1259", Mode: 0600, Size: int64(len(backupData)), Typeflag: tar.TypeReg})
+		assert.NoError(t, err)
+
+		info, err := os.Stat(filePath)
+		assert.NoError(t, err)
+		assert.True(t, info.ModTime().Equal(mtime), "in place: %v", inPlace)
+	}
+}
+
+func TestPrepareInPlaceRestore(t *testing.T) {
+	dir, err := createTempDir("in_place")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeTestRelationFile(t, filepath.Join(dir, "base", "1", "1259"), makeTestPage(0x100))
+	writeTestRelationFile(t, filepath.Join(dir, "base", "1", "16384"), makeTestPage(0x100))
+	writeTestRelationFile(t, filepath.Join(dir, "base", "1", "16384_vm"), makeTestPage(0x100))
+	writeTestRelationFile(t, filepath.Join(dir, "base", "1", "pg_internal.init"))
+	writeTestRelationFile(t, filepath.Join(dir, "pg_wal", "000000010000000000000001"))
+	writeTestRelationFile(t, filepath.Join(dir, "log", "postgresql.log"))
+	writeTestRelationFile(t, filepath.Join(dir, "postgresql.auto.conf"))
+	sentinelDto := BackupSentinelDto{Files: BackupFileList{"/base/1/1259": BackupFileDescription{}}}
+
+	writeTestRelationFile(t, filepath.Join(dir, postmasterPidFilename))
+	err = prepareInPlaceRestore(dir, sentinelDto)
+	assert.IsType(t, InPlaceRestoreError{}, err)
+	assert.NoError(t, os.Remove(filepath.Join(dir, postmasterPidFilename)))
+
+	err = prepareInPlaceRestore(dir, sentinelDto)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, "base", "1", "1259"))
+	assert.FileExists(t, filepath.Join(dir, "log", "postgresql.log"))
+	assert.FileExists(t, filepath.Join(dir, "postgresql.auto.conf"))
+	assert.FileExists(t, filepath.Join(dir, "pg_wal", "000000010000000000000001"))
+	assert.FileExists(t, filepath.Join(dir, "base", "1", "pg_internal.init"))
+	assert.NoFileExists(t, filepath.Join(dir, "base", "1", "16384"))
+	assert.NoFileExists(t, filepath.Join(dir, "base", "1", "16384_vm"))
+}
@@ -79,7 +79,7 @@ func (pageReader *IncrementalPageReader) Close() error {
 
 // TODO : unit tests
 // TODO : "initialize" is rather meaningless name, maybe this func should be decomposed
-func (pageReader *IncrementalPageReader) initialize(deltaBitmap *roaring.Bitmap) (size int64, err error) {
+func (pageReader *IncrementalPageReader) initialize(deltaBitmap, extraBlocks *roaring.Bitmap) (size int64, err error) {
 	var headerBuffer bytes.Buffer
 	headerBuffer.Write(IncrementFileHeader)
 	fileSize := pageReader.FileSize
@@ -94,6 +94,9 @@ func (pageReader *IncrementalPageReader) initialize(deltaBitmap *roaring.Bitmap)
 	} else {
 		pageReader.DeltaBitmapInitialize(deltaBitmap)
 	}
+	if extraBlocks != nil {
+		pageReader.AddExtraBlocks(extraBlocks)
+	}
 
 	pageReader.WriteDiffMapToHeader(&headerBuffer)
 	pageReader.Next = headerBuffer.Bytes()
@@ -114,6 +117,21 @@ func (pageReader *IncrementalPageReader) DeltaBitmapInitialize(deltaBitmap *roar
 	}
 }
 
+// AddExtraBlocks adds blocks which must be sent regardless of their LSN,
+// e.g. blocks changed on a stale replica after it diverged. Blocks stay sorted.
+func (pageReader *IncrementalPageReader) AddExtraBlocks(extraBlocks *roaring.Bitmap) {
+	blocks := roaring.BitmapOf(pageReader.Blocks...)
+	it := extraBlocks.Iterator()
+	for it.HasNext() {
+		blockNo := it.Next()
+		if pageReader.FileSize < int64(blockNo+1)*DatabasePageSize {
+			break
+		}
+		blocks.Add(blockNo)
+	}
+	pageReader.Blocks = blocks.ToArray()
+}
+
 func (pageReader *IncrementalPageReader) FullScanInitialize() error {
 	pageBytes := make([]byte, DatabasePageSize)
 	for currentBlockNumber := uint32(0); ; currentBlockNumber++ {
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/ioextensions"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// PAX records of tar members holding a part of a file split between tarballs
+const (
+	splitOffsetPaxRecord = "WALG.split_offset"
+	splitSizePaxRecord   = "WALG.split_size"
+)
+
+// shouldSplitFile checks if the file is sent in full and is bigger than a tarball
+func (bundle *Bundle) shouldSplitFile(info os.FileInfo, path string, wasInBase bool) bool {
+	if !bundle.SplitLargeFiles || info.Size() <= bundle.TarSizeThreshold {
+		return false
+	}
+	isIncremented := bundle.getIncrementBaseLsn() != nil && (wasInBase || bundle.forceIncremental) && isPagedFile(info, path)
+	return !isIncremented
+}
+
+// packLargeFile splits the file into parts of TarSizeThreshold bytes, which are packed into different tarballs
+// and uploaded in parallel. Each part is a tar member with the name of the file and its offset in PAX records.
+func (bundle *Bundle) packLargeFile(path string, info os.FileInfo, fileInfoHeader *tar.Header) {
+	fileSize := info.Size()
+	tracelog.DebugLogger.Printf("Splitting %s of %d bytes into parts\n", fileInfoHeader.Name, fileSize)
+	bundle.getFiles().Store(fileInfoHeader.Name, BackupFileDescription{IsSkipped: false, IsIncremented: false, MTime: info.ModTime()})
+	for offset := int64(0); offset < fileSize; offset += bundle.TarSizeThreshold {
+		partHeader := *fileInfoHeader
+		partHeader.Size = fileSize - offset
+		if partHeader.Size > bundle.TarSizeThreshold {
+			partHeader.Size = bundle.TarSizeThreshold
+		}
+		partHeader.PAXRecords = map[string]string{
+			splitOffsetPaxRecord: strconv.FormatInt(offset, 10),
+			splitSizePaxRecord:   strconv.FormatInt(fileSize, 10),
+		}
+		tarBall := bundle.Deque()
+		tarBall.SetUp(bundle.Crypter)
+		go func(offset int64) {
+			err := packFilePart(tarBall, &partHeader, path, offset)
+			if err != nil {
+				panic(err)
+			}
+			bundle.addTablespaceSize(partHeader.Name, partHeader.Size)
+			bundle.addTarFile(tarBall, partHeader.Name)
+			err = bundle.CheckSizeAndEnqueueBack(tarBall)
+			if err != nil {
+				panic(err)
+			}
+		}(offset)
+	}
+}
+
+// packFilePart packs partHeader.Size bytes of the file starting from offset, a truncated file is padded with zeroes
+func packFilePart(tarBall TarBall, partHeader *tar.Header, path string, offset int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "packFilePart: failed to open file '%s'\n", path)
+	}
+	defer utility.LoggedClose(file, "")
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "packFilePart: failed to seek file '%s'\n", path)
+	}
+	partReader := &io.LimitedReader{
+		R: io.MultiReader(NewDiskLimitReader(file), &ioextensions.ZeroReader{}),
+		N: partHeader.Size,
+	}
+	packedSize, err := PackFileTo(tarBall, partHeader, partReader)
+	if err != nil {
+		return errors.Wrap(err, "packFilePart: operation failed")
+	}
+	if packedSize != partHeader.Size {
+		return newTarSizeError(packedSize, partHeader.Size)
+	}
+	return nil
+}
+
+// getFilePartPosition returns offset of the part and the size of the whole file if the tar member is a part of a file
+func getFilePartPosition(header *tar.Header) (offset, fileSize int64, isPart bool, err error) {
+	offsetStr, isPart := header.PAXRecords[splitOffsetPaxRecord]
+	if !isPart {
+		return 0, 0, false, nil
+	}
+	offset, err = strconv.ParseInt(offsetStr, 10, 64)
+	if err != nil {
+		return 0, 0, true, errors.Wrapf(err, "invalid offset of the part of '%s'", header.Name)
+	}
+	fileSize, err = strconv.ParseInt(header.PAXRecords[splitSizePaxRecord], 10, 64)
+	if err != nil {
+		return 0, 0, true, errors.Wrapf(err, "invalid size of the split file '%s'", header.Name)
+	}
+	return offset, fileSize, true, nil
+}
+
+// unwrapFilePart writes the part at its offset, parts of a file may be extracted concurrently and in any order
+func unwrapFilePart(fileReader io.Reader, header *tar.Header, targetPath string, offset, fileSize int64) error {
+	err := PrepareDirs(header.Name, targetPath)
+	if err != nil {
+		return errors.Wrap(err, "Interpret: failed to create all directories")
+	}
+	file, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open file: '%s'", targetPath)
+	}
+	defer utility.LoggedClose(file, "")
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() > fileSize {
+		// the file is restored over a bigger one
+		if err = file.Truncate(fileSize); err != nil {
+			return errors.Wrapf(err, "Interpret: failed to truncate '%s'", targetPath)
+		}
+	}
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "Interpret: failed to seek '%s'", targetPath)
+	}
+	if _, err = io.Copy(file, fileReader); err != nil {
+		return errors.Wrap(err, "Interpret: copy failed")
+	}
+	if err = os.Chmod(targetPath, os.FileMode(header.Mode)); err != nil {
+		return errors.Wrap(err, "Interpret: chmod failed")
+	}
+	return errors.Wrap(file.Sync(), "Interpret: fsync failed")
+}
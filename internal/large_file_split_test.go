@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnwrapFilePart_RestoresSplitFile(t *testing.T) {
+	dir, err := createTempDir("split")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	data := []byte("0123456789abcdefghij")
+	const partSize = 8
+
+	var archive bytes.Buffer
+	tarWriter := tar.NewWriter(&archive)
+	for offset := 0; offset < len(data); offset += partSize {
+		end := offset + partSize
+		if end > len(data) {
+			end = len(data)
+		}
+		header := &tar.Header{Name: "/base/1/16384", Mode: 0600, Size: int64(end - offset), Typeflag: tar.TypeReg,
+			PAXRecords: map[string]string{
+				splitOffsetPaxRecord: strconv.Itoa(offset),
+				splitSizePaxRecord:   strconv.Itoa(len(data)),
+			}}
+		assert.NoError(t, tarWriter.WriteHeader(header))
+		_, err = tarWriter.Write(data[offset:end])
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tarWriter.Close())
+
+	type part struct {
+		header *tar.Header
+		data   []byte
+	}
+	var parts []part
+	tarReader := tar.NewReader(&archive)
+	for header, err := tarReader.Next(); err == nil; header, err = tarReader.Next() {
+		partData, err := ioutil.ReadAll(tarReader)
+		assert.NoError(t, err)
+		parts = append(parts, part{header, partData})
+	}
+	assert.Equal(t, 3, len(parts))
+
+	targetPath := filepath.Join(dir, "base", "1", "16384")
+	// the file is restored over a bigger one, parts are extracted in any order
+	assert.NoError(t, os.MkdirAll(filepath.Dir(targetPath), 0755))
+	assert.NoError(t, ioutil.WriteFile(targetPath, bytes.Repeat([]byte("x"), 2*len(data)), 0600))
+	for i := len(parts) - 1; i >= 0; i-- {
+		offset, fileSize, isPart, err := getFilePartPosition(parts[i].header)
+		assert.NoError(t, err)
+		assert.True(t, isPart)
+		err = unwrapFilePart(bytes.NewReader(parts[i].data), parts[i].header, targetPath, offset, fileSize)
+		assert.NoError(t, err)
+	}
+	restored, err := ioutil.ReadFile(targetPath)
+	assert.NoError(t, err)
+	assert.Equal(t, data, restored)
+
+	_, _, isPart, err := getFilePartPosition(&tar.Header{Name: "/base/1/1259"})
+	assert.NoError(t, err)
+	assert.False(t, isPart)
+}
@@ -19,6 +19,10 @@ func NewReader(reader io.Reader, limiter *rate.Limiter) *Reader {
 }
 
 func (r *Reader) Read(buf []byte) (int, error) {
+	// limiter does not allow waiting for more than burst bytes at once
+	if len(buf) > r.limiter.Burst() {
+		buf = buf[:r.limiter.Burst()]
+	}
 	n, err := r.reader.Read(buf)
 
 	if err != nil {
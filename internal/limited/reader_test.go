@@ -0,0 +1,34 @@
+package limited_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/limited"
+	"github.com/wal-g/wal-g/utility"
+	"golang.org/x/time/rate"
+)
+
+func TestLimitedReaderReadsLargerThanBurst(t *testing.T) {
+	data := bytes.Repeat([]byte("limited"), 300)
+	start := utility.TimeNowCrossPlatformLocal()
+
+	// single read buffer is larger than burst, so read is cut to burst
+	reader := limited.NewReader(bytes.NewReader(data), rate.NewLimiter(rate.Limit(10000), int(1024)))
+	buf := make([]byte, len(data))
+	read := 0
+	for read < len(data) {
+		n, err := reader.Read(buf[read:])
+		assert.NoError(t, err)
+		assert.True(t, n <= 1024)
+		read += n
+	}
+	end := utility.TimeNowCrossPlatformLocal()
+
+	assert.Equal(t, data, buf)
+	if end.Sub(start) < time.Millisecond*80 {
+		t.Errorf("Rate limiter did not work")
+	}
+}
@@ -0,0 +1,41 @@
+package limited
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+type WriteCloser struct {
+	writer  io.WriteCloser
+	limiter *rate.Limiter
+}
+
+func NewWriteCloser(writer io.WriteCloser, limiter *rate.Limiter) *WriteCloser {
+	return &WriteCloser{writer, limiter}
+}
+
+func (w *WriteCloser) Write(buf []byte) (int, error) {
+	written := 0
+	for written < len(buf) {
+		// limiter does not allow waiting for more than burst bytes at once
+		chunk := buf[written:]
+		if len(chunk) > w.limiter.Burst() {
+			chunk = chunk[:w.limiter.Burst()]
+		}
+		if err := w.limiter.WaitN(context.TODO(), len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.writer.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (w *WriteCloser) Close() error {
+	return w.writer.Close()
+}
@@ -0,0 +1,40 @@
+package limited_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/limited"
+	"github.com/wal-g/wal-g/utility"
+	"golang.org/x/time/rate"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (w *nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestLimitedWriteCloser(t *testing.T) {
+	data := bytes.Repeat([]byte("limited"), 300)
+	buffer := &bytes.Buffer{}
+	start := utility.TimeNowCrossPlatformLocal()
+
+	// single write is larger than burst, so it is limited by chunks
+	writer := limited.NewWriteCloser(&nopWriteCloser{buffer}, rate.NewLimiter(rate.Limit(10000), int(1024)))
+	n, err := writer.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	end := utility.TimeNowCrossPlatformLocal()
+
+	assert.Equal(t, len(data), n)
+	assert.Equal(t, data, buffer.Bytes())
+	if end.Sub(start) < time.Millisecond*80 {
+		t.Errorf("Rate limiter did not work")
+	}
+}
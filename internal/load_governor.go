@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	loadAveragePath = "/proc/loadavg"
+	ioPressurePath  = "/proc/pressure/io"
+)
+
+// LoadGovernor pauses reading of backed up files while the host is under pressure, it is nil if not configured
+var LoadGovernor *loadGovernor
+
+// loadProbe reports if the host is under pressure
+type loadProbe struct {
+	name  string
+	check func() (bool, error)
+}
+
+// loadGovernor samples probes in background, readers wait while any probe reports pressure.
+// After reading was paused for maxPause in total, the governor stops pausing, so the backup can't be stalled forever.
+type loadGovernor struct {
+	probes    []loadProbe
+	interval  time.Duration
+	maxPause  time.Duration
+	startOnce sync.Once
+	mutex     sync.Mutex
+	resumed   *sync.Cond
+	pressure  []string
+	// pausedSince is the start of the current pause, pausedTotal is the duration of the previous ones
+	pausedSince time.Time
+	pausedTotal time.Duration
+	exhausted   bool
+}
+
+// newLoadGovernor builds the governor, zero maxPause means that the total pause is not limited
+func newLoadGovernor(interval, maxPause time.Duration, probes ...loadProbe) *loadGovernor {
+	governor := &loadGovernor{probes: probes, interval: interval, maxPause: maxPause}
+	governor.resumed = sync.NewCond(&governor.mutex)
+	return governor
+}
+
+// ConfigureLoadGovernor sets up LoadGovernor from WALG_LOAD_THROTTLE_* settings, it stays nil if no probe is configured
+func ConfigureLoadGovernor() error {
+	var probes []loadProbe
+	if maxLoadStr, ok := GetSetting(LoadThrottleMaxLoadSetting); ok {
+		maxLoad, err := strconv.ParseFloat(maxLoadStr, 64)
+		if err != nil {
+			return errors.Wrapf(err, "number expected for %s setting but given '%s'", LoadThrottleMaxLoadSetting, maxLoadStr)
+		}
+		probes = append(probes, loadProbe{"load average", func() (bool, error) {
+			return checkLoadAverage(loadAveragePath, maxLoad)
+		}})
+	}
+	if maxPressureStr, ok := GetSetting(LoadThrottleMaxIOSetting); ok {
+		maxPressure, err := strconv.ParseFloat(maxPressureStr, 64)
+		if err != nil {
+			return errors.Wrapf(err, "number expected for %s setting but given '%s'", LoadThrottleMaxIOSetting, maxPressureStr)
+		}
+		probes = append(probes, loadProbe{"IO pressure", func() (bool, error) {
+			return checkIOPressure(ioPressurePath, maxPressure)
+		}})
+	}
+	if _, ok := GetSetting(LoadThrottleCommandSetting); ok {
+		probes = append(probes, loadProbe{"command", checkLoadCommand})
+	}
+	if len(probes) == 0 {
+		return nil
+	}
+	interval, err := GetDurationSetting(LoadThrottleIntervalSetting)
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return errors.Errorf("positive number of seconds expected for %s setting but given %v",
+			LoadThrottleIntervalSetting, interval)
+	}
+	maxPause, err := GetDurationSetting(LoadThrottleMaxPauseSetting)
+	if err != nil {
+		return err
+	}
+	if maxPause < 0 {
+		return errors.Errorf("non-negative number of seconds expected for %s setting but given %v",
+			LoadThrottleMaxPauseSetting, maxPause)
+	}
+	LoadGovernor = newLoadGovernor(interval, maxPause, probes...)
+	return nil
+}
+
+// wait blocks while the host is under pressure, sampling starts with the first call
+func (governor *loadGovernor) wait() {
+	governor.startOnce.Do(func() {
+		governor.sample()
+		go governor.run()
+	})
+	governor.mutex.Lock()
+	defer governor.mutex.Unlock()
+	for len(governor.pressure) > 0 && !governor.exhausted {
+		governor.resumed.Wait()
+	}
+}
+
+func (governor *loadGovernor) run() {
+	ticker := time.NewTicker(governor.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !governor.sample() {
+			return
+		}
+	}
+}
+
+// sample runs all probes, a probe which fails is logged and does not pause reading.
+// Returns false when the total pause is exhausted and sampling is no longer needed.
+func (governor *loadGovernor) sample() bool {
+	pressure := make([]string, 0)
+	for _, probe := range governor.probes {
+		isUnderPressure, err := probe.check()
+		if err != nil {
+			tracelog.WarningLogger.Printf("Failed to check %s of the host: %v\n", probe.name, err)
+			continue
+		}
+		if isUnderPressure {
+			pressure = append(pressure, probe.name)
+		}
+	}
+
+	governor.mutex.Lock()
+	defer governor.mutex.Unlock()
+	now := time.Now()
+	if len(pressure) > 0 && len(governor.pressure) == 0 {
+		tracelog.InfoLogger.Printf("Host is under pressure (%s), pausing reading of files\n", strings.Join(pressure, ", "))
+		governor.pausedSince = now
+	}
+	if len(pressure) == 0 && len(governor.pressure) > 0 {
+		tracelog.InfoLogger.Println("Host pressure dropped, resuming reading of files")
+		governor.pausedTotal += now.Sub(governor.pausedSince)
+		governor.resumed.Broadcast()
+	}
+	governor.pressure = pressure
+	if len(pressure) > 0 && governor.maxPause > 0 && governor.pausedTotal+now.Sub(governor.pausedSince) >= governor.maxPause {
+		tracelog.WarningLogger.Printf("Reading of files was paused for %v in total, it is not paused anymore\n",
+			governor.maxPause)
+		governor.exhausted = true
+		governor.resumed.Broadcast()
+	}
+	return !governor.exhausted
+}
+
+// governedReader waits for the governor before each read
+type governedReader struct {
+	reader   io.Reader
+	governor *loadGovernor
+}
+
+func (reader *governedReader) Read(p []byte) (int, error) {
+	reader.governor.wait()
+	return reader.reader.Read(p)
+}
+
+// checkLoadAverage compares 1 minute load average per CPU with maxLoad
+func checkLoadAverage(path string, maxLoad float64) (bool, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return false, errors.Errorf("unexpected content of %s", path)
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return false, errors.Wrapf(err, "unexpected content of %s", path)
+	}
+	return load/float64(runtime.NumCPU()) > maxLoad, nil
+}
+
+// checkIOPressure compares the share of time some tasks were stalled on IO in last 10 seconds with maxPressure
+func checkIOPressure(path string, maxPressure float64) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer utility.LoggedClose(file, "")
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "some" || !strings.HasPrefix(fields[1], "avg10=") {
+			continue
+		}
+		pressure, err := strconv.ParseFloat(strings.TrimPrefix(fields[1], "avg10="), 64)
+		if err != nil {
+			return false, errors.Wrapf(err, "unexpected content of %s", path)
+		}
+		return pressure > maxPressure, nil
+	}
+	if err = scanner.Err(); err != nil {
+		return false, err
+	}
+	return false, errors.Errorf("unexpected content of %s", path)
+}
+
+// checkLoadCommand runs the user command, non-zero exit code means that the host is under pressure
+func checkLoadCommand() (bool, error) {
+	cmd, err := GetCommandSetting(LoadThrottleCommandSetting)
+	if err != nil {
+		return false, err
+	}
+	err = cmd.Run()
+	if _, ok := err.(*exec.ExitError); ok {
+		return true, nil
+	}
+	return false, err
+}
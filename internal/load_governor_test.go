@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLoadAverage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "load_governor")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "loadavg")
+	require.NoError(t, ioutil.WriteFile(path, []byte("0.50 0.40 0.30 1/100 12345\n"), 0644))
+
+	isUnderPressure, err := checkLoadAverage(path, 1000)
+	assert.NoError(t, err)
+	assert.False(t, isUnderPressure)
+	isUnderPressure, err = checkLoadAverage(path, 0)
+	assert.NoError(t, err)
+	assert.True(t, isUnderPressure)
+}
+
+func TestCheckIOPressure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "load_governor")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "io")
+	content := "some avg10=35.50 avg60=20.00 avg300=5.00 total=123456\n" +
+		"full avg10=10.00 avg60=5.00 avg300=1.00 total=23456\n"
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+
+	isUnderPressure, err := checkIOPressure(path, 50)
+	assert.NoError(t, err)
+	assert.False(t, isUnderPressure)
+	isUnderPressure, err = checkIOPressure(path, 30)
+	assert.NoError(t, err)
+	assert.True(t, isUnderPressure)
+}
+
+func TestLoadGovernor_PausesWhileUnderPressure(t *testing.T) {
+	var isUnderPressure int32 = 1
+	governor := newLoadGovernor(10*time.Millisecond, 0, loadProbe{"test", func() (bool, error) {
+		return atomic.LoadInt32(&isUnderPressure) == 1, nil
+	}})
+
+	resumed := make(chan struct{})
+	go func() {
+		governor.wait()
+		close(resumed)
+	}()
+	select {
+	case <-resumed:
+		t.Fatal("governor did not pause under pressure")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	atomic.StoreInt32(&isUnderPressure, 0)
+	select {
+	case <-resumed:
+	case <-time.After(time.Second):
+		t.Fatal("governor did not resume after pressure dropped")
+	}
+}
+
+func TestLoadGovernor_StopsPausingAfterMaxPause(t *testing.T) {
+	governor := newLoadGovernor(10*time.Millisecond, 50*time.Millisecond, loadProbe{"test", func() (bool, error) {
+		return true, nil
+	}})
+
+	resumed := make(chan struct{})
+	go func() {
+		governor.wait()
+		close(resumed)
+	}()
+	select {
+	case <-resumed:
+	case <-time.After(time.Second):
+		t.Fatal("governor did not resume after max pause")
+	}
+	governor.wait()
+}
+
+func TestConfigureLoadGovernor_RejectsNonPositiveInterval(t *testing.T) {
+	viper.Set(LoadThrottleMaxLoadSetting, "1.5")
+	defer viper.Set(LoadThrottleMaxLoadSetting, nil)
+	viper.Set(LoadThrottleIntervalSetting, "0")
+	defer viper.Set(LoadThrottleIntervalSetting, "5")
+
+	assert.Error(t, ConfigureLoadGovernor())
+}
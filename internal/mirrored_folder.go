@@ -0,0 +1,412 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const primaryDestinationName = "primary"
+
+// MirrorStatus is the upload status of one mirror storage
+type MirrorStatus struct {
+	Name string
+	// FailedObject is the first object which was not uploaded, later objects are not uploaded to the mirror
+	FailedObject string
+	Err          error
+}
+
+type MissingDeltaBaseError struct {
+	error
+}
+
+func newMissingDeltaBaseError(backupName, baseName string) MissingDeltaBaseError {
+	return MissingDeltaBaseError{errors.Errorf(
+		"backup %s is based on %s, which is missing in the mirror storage", backupName, baseName)}
+}
+
+func (err MissingDeltaBaseError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// mirrorDestination is a folder of the mirror storage, queue is shared by all its subfolders
+type mirrorDestination struct {
+	folder storage.Folder
+	queue  *mirrorQueue
+}
+
+// MirroredFolder reads from the primary storage and uploads objects to the primary storage and its mirrors.
+// Content is uploaded to the primary storage and spooled to a temporary file at the same time,
+// then it is uploaded to each mirror in the background in the same order, so a slow mirror doesn't stall the primary
+// until the spool is full. Deletions are passed to the mirrors in the same order as uploads.
+// Only primary storage failures are returned. A mirror which failed to upload an object is skipped afterwards,
+// so it never gets a sentinel of an incomplete backup, as well as a sentinel of a delta backup without its base.
+type MirroredFolder struct {
+	storage.Folder
+	mirrors []mirrorDestination
+	mutex   *sync.Mutex
+	spool   *mirrorSpoolLimiter
+}
+
+// NewMirroredFolder builds MirroredFolder with mirrors named by their config files.
+// At most maxSpooledObjects objects of maxSpoolSize bytes in total wait for the mirrors,
+// further uploads are blocked until the mirrors catch up.
+func NewMirroredFolder(primary storage.Folder, mirrors map[string]storage.Folder,
+	maxSpooledObjects int, maxSpoolSize int64) *MirroredFolder {
+	names := make([]string, 0, len(mirrors))
+	for name := range mirrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	folder := &MirroredFolder{Folder: primary, mutex: &sync.Mutex{},
+		spool: newMirrorSpoolLimiter(maxSpooledObjects, maxSpoolSize)}
+	for _, name := range names {
+		queue := newMirrorQueue(&MirrorStatus{Name: name})
+		go queue.run(folder)
+		folder.mirrors = append(folder.mirrors, mirrorDestination{folder: mirrors[name], queue: queue})
+	}
+	return folder
+}
+
+// ConfigureMirroredFolder wraps the folder to upload to mirror storages from WALG_UPLOAD_MIRROR_CONFIGS.
+// Returns `<nil>` folder if no mirrors are configured.
+func ConfigureMirroredFolder(primary storage.Folder) (*MirroredFolder, error) {
+	mirrors, err := ConfigureUploadMirrorFolders()
+	if err != nil || len(mirrors) == 0 {
+		return nil, err
+	}
+	maxSpooledObjects, maxSpoolSize, err := getMirrorSpoolLimits()
+	if err != nil {
+		return nil, err
+	}
+	return NewMirroredFolder(primary, mirrors, maxSpooledObjects, maxSpoolSize), nil
+}
+
+func (folder *MirroredFolder) GetSubFolder(subFolderRelativePath string) storage.Folder {
+	subFolder := &MirroredFolder{Folder: folder.Folder.GetSubFolder(subFolderRelativePath),
+		mutex: folder.mutex, spool: folder.spool}
+	for _, mirror := range folder.mirrors {
+		subFolder.mirrors = append(subFolder.mirrors, mirrorDestination{
+			folder: mirror.folder.GetSubFolder(subFolderRelativePath),
+			queue:  mirror.queue,
+		})
+	}
+	return subFolder
+}
+
+func (folder *MirroredFolder) PutObject(name string, content io.Reader) error {
+	mirrors := folder.aliveMirrors()
+	if len(mirrors) == 0 {
+		return folder.Folder.PutObject(name, content)
+	}
+	spool, err := newSpooledObject(len(mirrors))
+	if err != nil {
+		return err
+	}
+	err = folder.Folder.PutObject(name, io.TeeReader(content, spool.file))
+	var size int64
+	if err == nil {
+		size, err = spool.file.Seek(0, io.SeekCurrent)
+	}
+	if closeErr := spool.file.Close(); err == nil && closeErr != nil {
+		err = errors.Wrapf(closeErr, "failed to spool '%s' for mirror storages", name)
+	}
+	if err != nil {
+		spool.remove()
+		return err
+	}
+	// backpressure: the object is queued when older spooled objects are uploaded to the mirrors
+	folder.spool.acquire(size)
+	spool.limiter, spool.size = folder.spool, size
+	for _, mirror := range mirrors {
+		mirror.queue.push(mirrorUpload{folder: mirror.folder, name: name, spool: spool})
+	}
+	return nil
+}
+
+// DeleteObjects deletes objects from the primary storage, then from the mirrors after the objects queued before
+func (folder *MirroredFolder) DeleteObjects(objectRelativePaths []string) error {
+	if err := folder.Folder.DeleteObjects(objectRelativePaths); err != nil {
+		return err
+	}
+	for _, mirror := range folder.aliveMirrors() {
+		mirror.queue.push(mirrorUpload{folder: mirror.folder, name: strings.Join(objectRelativePaths, ", "),
+			deleted: objectRelativePaths})
+	}
+	return nil
+}
+
+// Wait blocks until all objects uploaded to the primary storage are uploaded to the mirrors or skipped
+func (folder *MirroredFolder) Wait() {
+	for _, mirror := range folder.mirrors {
+		mirror.queue.waitGroup.Wait()
+	}
+}
+
+// Statuses returns upload statuses of the mirrors
+func (folder *MirroredFolder) Statuses() []MirrorStatus {
+	folder.mutex.Lock()
+	defer folder.mutex.Unlock()
+	statuses := make([]MirrorStatus, 0, len(folder.mirrors))
+	for _, mirror := range folder.mirrors {
+		statuses = append(statuses, *mirror.queue.status)
+	}
+	return statuses
+}
+
+// ReportStatuses waits for uploads to the mirrors, logs upload status of every storage
+// and returns an error if some mirror failed
+func (folder *MirroredFolder) ReportStatuses() error {
+	folder.Wait()
+	tracelog.InfoLogger.Printf("Upload to storage '%s': OK\n", primaryDestinationName)
+	failed := 0
+	for _, status := range folder.Statuses() {
+		if status.Err == nil {
+			tracelog.InfoLogger.Printf("Upload to storage '%s': OK\n", status.Name)
+			continue
+		}
+		failed++
+		tracelog.WarningLogger.Printf("Upload to storage '%s': FAILED on '%s': %v\n", status.Name, status.FailedObject, status.Err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("upload failed to %d of %d mirror storages", failed, len(folder.mirrors))
+	}
+	return nil
+}
+
+// WarnOnFailedMirrors waits for uploads to the mirrors and logs upload status of every storage,
+// failed mirrors are only warned about. WAL archiving doesn't fail because of a mirror,
+// otherwise Postgres would keep WAL while the mirror is unavailable.
+func (folder *MirroredFolder) WarnOnFailedMirrors() {
+	if err := folder.ReportStatuses(); err != nil {
+		tracelog.WarningLogger.Printf("WAL is uploaded to the primary storage, but %v\n", err)
+	}
+}
+
+func (folder *MirroredFolder) aliveMirrors() []mirrorDestination {
+	folder.mutex.Lock()
+	defer folder.mutex.Unlock()
+	alive := make([]mirrorDestination, 0, len(folder.mirrors))
+	for _, mirror := range folder.mirrors {
+		if mirror.queue.status.Err == nil {
+			alive = append(alive, mirror)
+		}
+	}
+	return alive
+}
+
+func (folder *MirroredFolder) isFailed(status *MirrorStatus) bool {
+	folder.mutex.Lock()
+	defer folder.mutex.Unlock()
+	return status.Err != nil
+}
+
+func (folder *MirroredFolder) markFailed(status *MirrorStatus, objectName string, err error) {
+	folder.mutex.Lock()
+	defer folder.mutex.Unlock()
+	if status.Err != nil {
+		return
+	}
+	status.FailedObject = objectName
+	status.Err = err
+	tracelog.WarningLogger.Printf("Upload of '%s' to mirror storage '%s' failed, the mirror is skipped from now on: %v\n",
+		objectName, status.Name, err)
+}
+
+// uploadToMirror uploads the spooled object or deletes objects. A sentinel of a delta backup is uploaded only
+// if the whole chain of its base backups is in the mirror, otherwise the backup can't be restored from it.
+func (folder *MirroredFolder) uploadToMirror(upload mirrorUpload) error {
+	if upload.spool == nil {
+		return upload.folder.DeleteObjects(upload.deleted)
+	}
+	if strings.HasSuffix(upload.name, utility.SentinelSuffix) {
+		if err := checkMirroredDeltaChain(upload.folder, upload.name, upload.spool.path); err != nil {
+			return err
+		}
+	}
+	file, err := os.Open(upload.spool.path)
+	if err != nil {
+		return err
+	}
+	defer utility.LoggedClose(file, "")
+	return upload.folder.PutObject(upload.name, file)
+}
+
+// checkMirroredDeltaChain checks that sentinels of all base backups of the backup exist in the mirror folder
+func checkMirroredDeltaChain(mirrorFolder storage.Folder, sentinelName, sentinelPath string) error {
+	data, err := ioutil.ReadFile(sentinelPath)
+	if err != nil {
+		return err
+	}
+	backupName := strings.TrimSuffix(sentinelName, utility.SentinelSuffix)
+	for {
+		var sentinelDto BackupSentinelDto
+		if err = json.Unmarshal(data, &sentinelDto); err != nil || sentinelDto.IncrementFrom == nil {
+			// objects with the sentinel suffix which are not backup sentinels are uploaded as is
+			return nil
+		}
+		baseName := *sentinelDto.IncrementFrom
+		data, err = readMirroredObject(mirrorFolder, baseName+utility.SentinelSuffix)
+		if _, ok := errors.Cause(err).(storage.ObjectNotFoundError); ok {
+			return newMissingDeltaBaseError(backupName, baseName)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to check base backup %s in the mirror storage", baseName)
+		}
+		backupName = baseName
+	}
+}
+
+func readMirroredObject(folder storage.Folder, name string) ([]byte, error) {
+	reader, err := folder.ReadObject(name)
+	if err != nil {
+		return nil, err
+	}
+	defer utility.LoggedClose(reader, "")
+	return ioutil.ReadAll(reader)
+}
+
+// spooledObject is a temporary copy of an uploaded object, it is removed after all mirrors are done with it
+type spooledObject struct {
+	file *os.File
+	path string
+	refs int32
+	// limiter is set when the object is queued, its size is released on removal
+	limiter *mirrorSpoolLimiter
+	size    int64
+}
+
+func newSpooledObject(refs int) (*spooledObject, error) {
+	file, err := ioutil.TempFile("", "wal-g-mirror-")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create temporary file for mirror storages")
+	}
+	return &spooledObject{file: file, path: file.Name(), refs: int32(refs)}, nil
+}
+
+func (spool *spooledObject) release() {
+	if atomic.AddInt32(&spool.refs, -1) == 0 {
+		spool.remove()
+	}
+}
+
+func (spool *spooledObject) remove() {
+	if err := os.Remove(spool.path); err != nil {
+		tracelog.WarningLogger.Printf("Failed to remove temporary file %s: %v\n", spool.path, err)
+	}
+	if spool.limiter != nil {
+		spool.limiter.release(spool.size)
+	}
+}
+
+// mirrorSpoolLimiter bounds the number and total size of spooled objects, which are shared by all mirrors.
+// An object larger than the limit is queued alone. Objects being uploaded to the primary storage
+// are spooled before they are counted, so the spool may exceed the limit by them.
+type mirrorSpoolLimiter struct {
+	cond       *sync.Cond
+	maxObjects int
+	maxSize    int64
+	objects    int
+	size       int64
+}
+
+func newMirrorSpoolLimiter(maxObjects int, maxSize int64) *mirrorSpoolLimiter {
+	return &mirrorSpoolLimiter{cond: sync.NewCond(&sync.Mutex{}), maxObjects: maxObjects, maxSize: maxSize}
+}
+
+func (limiter *mirrorSpoolLimiter) acquire(size int64) {
+	limiter.cond.L.Lock()
+	defer limiter.cond.L.Unlock()
+	if limiter.isFull(size) {
+		tracelog.DebugLogger.Printf("Mirror spool is full with %d objects of %d bytes, waiting for mirror storages\n",
+			limiter.objects, limiter.size)
+	}
+	for limiter.isFull(size) {
+		limiter.cond.Wait()
+	}
+	limiter.objects++
+	limiter.size += size
+}
+
+func (limiter *mirrorSpoolLimiter) isFull(size int64) bool {
+	return limiter.objects > 0 && (limiter.objects >= limiter.maxObjects || limiter.size+size > limiter.maxSize)
+}
+
+func (limiter *mirrorSpoolLimiter) release(size int64) {
+	limiter.cond.L.Lock()
+	defer limiter.cond.L.Unlock()
+	limiter.objects--
+	limiter.size -= size
+	limiter.cond.Broadcast()
+}
+
+// mirrorUpload is an upload of the spooled object, or a deletion of objects if spool is nil
+type mirrorUpload struct {
+	folder  storage.Folder
+	name    string
+	spool   *spooledObject
+	deleted []string
+}
+
+// mirrorQueue uploads objects to the mirror one by one in the order they were uploaded to the primary storage,
+// so the sentinel of a backup is uploaded after its files. Objects wait in spool files, see mirrorSpoolLimiter.
+type mirrorQueue struct {
+	status    *MirrorStatus
+	mutex     sync.Mutex
+	pending   []mirrorUpload
+	wakeup    chan struct{}
+	waitGroup sync.WaitGroup
+}
+
+func newMirrorQueue(status *MirrorStatus) *mirrorQueue {
+	return &mirrorQueue{status: status, wakeup: make(chan struct{}, 1)}
+}
+
+func (queue *mirrorQueue) push(upload mirrorUpload) {
+	queue.waitGroup.Add(1)
+	queue.mutex.Lock()
+	queue.pending = append(queue.pending, upload)
+	queue.mutex.Unlock()
+	select {
+	case queue.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (queue *mirrorQueue) pop() (mirrorUpload, bool) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	if len(queue.pending) == 0 {
+		return mirrorUpload{}, false
+	}
+	upload := queue.pending[0]
+	queue.pending = queue.pending[1:]
+	return upload, true
+}
+
+func (queue *mirrorQueue) run(folder *MirroredFolder) {
+	for range queue.wakeup {
+		for upload, ok := queue.pop(); ok; upload, ok = queue.pop() {
+			if !folder.isFailed(queue.status) {
+				if err := folder.uploadToMirror(upload); err != nil {
+					folder.markFailed(queue.status, upload.name, err)
+				}
+			}
+			if upload.spool != nil {
+				upload.spool.release()
+			}
+			queue.waitGroup.Done()
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package internal_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/wal-g/internal"
+)
+
+// failingFolder fails uploads of objects with the given name
+type failingFolder struct {
+	storage.Folder
+	failedName string
+}
+
+func (folder *failingFolder) GetSubFolder(subFolderRelativePath string) storage.Folder {
+	return &failingFolder{folder.Folder.GetSubFolder(subFolderRelativePath), folder.failedName}
+}
+
+func (folder *failingFolder) PutObject(name string, content io.Reader) error {
+	if name == folder.failedName {
+		_, _ = io.CopyN(ioutil.Discard, content, 10)
+		return errors.New("injected failure")
+	}
+	return folder.Folder.PutObject(name, content)
+}
+
+func readObject(t *testing.T, folder storage.Folder, name string) string {
+	reader, err := folder.ReadObject(name)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestMirroredFolder_UploadsToAllStorages(t *testing.T) {
+	primary := memory.NewFolder("in_memory/", memory.NewStorage())
+	mirror := memory.NewFolder("in_memory/", memory.NewStorage())
+	folder := internal.NewMirroredFolder(primary, map[string]storage.Folder{"dr.yaml": mirror}, 64, 1<<30)
+
+	content := strings.Repeat("backup data", 10000)
+	err := folder.GetSubFolder("basebackups_005/").PutObject("base_1/tar_partitions/part_1.tar.lz4", bytes.NewBufferString(content))
+	require.NoError(t, err)
+	folder.Wait()
+
+	name := "basebackups_005/base_1/tar_partitions/part_1.tar.lz4"
+	assert.Equal(t, content, readObject(t, primary, name))
+	assert.Equal(t, content, readObject(t, mirror, name))
+	assert.NoError(t, folder.ReportStatuses())
+}
+
+func TestMirroredFolder_SkipsFailedMirror(t *testing.T) {
+	primary := memory.NewFolder("in_memory/", memory.NewStorage())
+	healthy := memory.NewFolder("in_memory/", memory.NewStorage())
+	broken := memory.NewFolder("in_memory/", memory.NewStorage())
+	folder := internal.NewMirroredFolder(primary, map[string]storage.Folder{
+		"dr.yaml":     healthy,
+		"broken.yaml": &failingFolder{broken, "part_1.tar.lz4"},
+	}, 64, 1<<30)
+	backupFolder := folder.GetSubFolder("base_1/")
+
+	content := strings.Repeat("backup data", 10000)
+	require.NoError(t, backupFolder.PutObject("part_1.tar.lz4", bytes.NewBufferString(content)))
+	require.NoError(t, folder.PutObject("base_1_backup_stop_sentinel.json", bytes.NewBufferString("{}")))
+	folder.Wait()
+
+	assert.Equal(t, content, readObject(t, primary, "base_1/part_1.tar.lz4"))
+	assert.Equal(t, content, readObject(t, healthy, "base_1/part_1.tar.lz4"))
+	assert.Equal(t, "{}", readObject(t, healthy, "base_1_backup_stop_sentinel.json"))
+	exists, err := broken.Exists("base_1_backup_stop_sentinel.json")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	statuses := folder.Statuses()
+	require.Len(t, statuses, 2)
+	assert.Equal(t, "broken.yaml", statuses[0].Name)
+	assert.Equal(t, "part_1.tar.lz4", statuses[0].FailedObject)
+	assert.Error(t, statuses[0].Err)
+	assert.NoError(t, statuses[1].Err)
+	assert.Error(t, folder.ReportStatuses())
+}
+
+func TestMirroredFolder_ReturnsPrimaryError(t *testing.T) {
+	primary := &failingFolder{memory.NewFolder("in_memory/", memory.NewStorage()), "part_1.tar.lz4"}
+	mirror := memory.NewFolder("in_memory/", memory.NewStorage())
+	folder := internal.NewMirroredFolder(primary, map[string]storage.Folder{"dr.yaml": mirror}, 64, 1<<30)
+
+	err := folder.PutObject("part_1.tar.lz4", bytes.NewBufferString(strings.Repeat("backup data", 10000)))
+	assert.Error(t, err)
+}
+
+// slowFolder blocks uploads until it is released
+type slowFolder struct {
+	storage.Folder
+	release chan struct{}
+}
+
+func (folder *slowFolder) GetSubFolder(subFolderRelativePath string) storage.Folder {
+	return &slowFolder{folder.Folder.GetSubFolder(subFolderRelativePath), folder.release}
+}
+
+func (folder *slowFolder) PutObject(name string, content io.Reader) error {
+	<-folder.release
+	return folder.Folder.PutObject(name, content)
+}
+
+func TestMirroredFolder_SlowMirrorDoesNotStallPrimary(t *testing.T) {
+	primary := memory.NewFolder("in_memory/", memory.NewStorage())
+	mirror := memory.NewFolder("in_memory/", memory.NewStorage())
+	release := make(chan struct{})
+	folder := internal.NewMirroredFolder(primary, map[string]storage.Folder{"dr.yaml": &slowFolder{mirror, release}}, 64, 1<<30)
+
+	content := strings.Repeat("backup data", 10000)
+	uploaded := make(chan error)
+	go func() {
+		uploaded <- folder.PutObject("part_1.tar.lz4", bytes.NewBufferString(content))
+	}()
+	select {
+	case err := <-uploaded:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("upload to the primary storage waits for the mirror")
+	}
+	assert.Equal(t, content, readObject(t, primary, "part_1.tar.lz4"))
+
+	close(release)
+	assert.NoError(t, folder.ReportStatuses())
+	assert.Equal(t, content, readObject(t, mirror, "part_1.tar.lz4"))
+}
+
+func TestMirroredFolder_SkipsDeltaWithoutBaseInMirror(t *testing.T) {
+	primary := memory.NewFolder("in_memory/", memory.NewStorage())
+	mirror := memory.NewFolder("in_memory/", memory.NewStorage())
+	require.NoError(t, primary.PutObject("base_000000010000000000000002_backup_stop_sentinel.json",
+		bytes.NewBufferString("{}")))
+	folder := internal.NewMirroredFolder(primary, map[string]storage.Folder{"dr.yaml": mirror}, 64, 1<<30)
+
+	sentinel := `{"DeltaFrom":"base_000000010000000000000002"}`
+	require.NoError(t, folder.PutObject("base_000000010000000000000004_D_000000010000000000000002_backup_stop_sentinel.json",
+		bytes.NewBufferString(sentinel)))
+
+	assert.Error(t, folder.ReportStatuses())
+	exists, err := mirror.Exists("base_000000010000000000000004_D_000000010000000000000002_backup_stop_sentinel.json")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	statuses := folder.Statuses()
+	require.Len(t, statuses, 1)
+	assert.IsType(t, internal.MissingDeltaBaseError{}, statuses[0].Err)
+}
+
+func TestMirroredFolder_UploadsDeltaWithBaseInMirror(t *testing.T) {
+	primary := memory.NewFolder("in_memory/", memory.NewStorage())
+	mirror := memory.NewFolder("in_memory/", memory.NewStorage())
+	folder := internal.NewMirroredFolder(primary, map[string]storage.Folder{"dr.yaml": mirror}, 64, 1<<30)
+
+	require.NoError(t, folder.PutObject("base_000000010000000000000002_backup_stop_sentinel.json",
+		bytes.NewBufferString("{}")))
+	sentinel := `{"DeltaFrom":"base_000000010000000000000002"}`
+	require.NoError(t, folder.PutObject("base_000000010000000000000004_D_000000010000000000000002_backup_stop_sentinel.json",
+		bytes.NewBufferString(sentinel)))
+
+	assert.NoError(t, folder.ReportStatuses())
+	assert.Equal(t, sentinel,
+		readObject(t, mirror, "base_000000010000000000000004_D_000000010000000000000002_backup_stop_sentinel.json"))
+}
+
+func TestMirroredFolder_BlocksWhenSpoolIsFull(t *testing.T) {
+	primary := memory.NewFolder("in_memory/", memory.NewStorage())
+	mirror := memory.NewFolder("in_memory/", memory.NewStorage())
+	release := make(chan struct{})
+	folder := internal.NewMirroredFolder(primary, map[string]storage.Folder{"dr.yaml": &slowFolder{mirror, release}}, 1, 1<<30)
+
+	require.NoError(t, folder.PutObject("part_1.tar.lz4", bytes.NewBufferString("backup data")))
+	uploaded := make(chan error)
+	go func() {
+		uploaded <- folder.PutObject("part_2.tar.lz4", bytes.NewBufferString("backup data"))
+	}()
+	select {
+	case <-uploaded:
+		t.Fatal("upload doesn't wait for the mirror when the spool is full")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-uploaded)
+	assert.NoError(t, folder.ReportStatuses())
+	assert.Equal(t, "backup data", readObject(t, mirror, "part_2.tar.lz4"))
+}
+
+func TestMirroredFolder_DeletesFromMirrors(t *testing.T) {
+	primary := memory.NewFolder("in_memory/", memory.NewStorage())
+	mirror := memory.NewFolder("in_memory/", memory.NewStorage())
+	folder := internal.NewMirroredFolder(primary, map[string]storage.Folder{"dr.yaml": mirror}, 64, 1<<30)
+	walFolder := folder.GetSubFolder("wal_005/")
+
+	require.NoError(t, walFolder.PutObject("000000010000000000000001.partial.lz4", bytes.NewBufferString("partial")))
+	require.NoError(t, walFolder.DeleteObjects([]string{"000000010000000000000001.partial.lz4"}))
+	assert.NoError(t, folder.ReportStatuses())
+
+	for _, storageFolder := range []storage.Folder{primary, mirror} {
+		exists, err := storageFolder.Exists("wal_005/000000010000000000000001.partial.lz4")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	}
+}
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"archive/tar"
+	"fmt"
 	"io/ioutil"
 	"sync/atomic"
 
@@ -22,6 +23,7 @@ func (tarBall *NOPTarBall) Size() int64            { return atomic.LoadInt64(tar
 func (tarBall *NOPTarBall) AddSize(i int64)        { atomic.AddInt64(tarBall.allTarballsSize, i) }
 func (tarBall *NOPTarBall) TarWriter() *tar.Writer { return tarBall.tarWriter }
 func (tarBall *NOPTarBall) AwaitUploads()          {}
+func (tarBall *NOPTarBall) Name() string           { return fmt.Sprintf("part_%0.3d.tar", tarBall.number) }
 
 // NOPTarBallMaker creates a new NOPTarBall. Used
 // for testing purposes.
@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	// number of parallel checksum lanes, see checksum_impl.h
+	checksumSums     = 32
+	checksumFnvPrime = 16777619
+	// offset of pd_checksum in page header
+	pageChecksumOffset = 8
+	// maxReportedCorruptBlocks limits the number of corrupt block numbers recorded for a file
+	maxReportedCorruptBlocks = 10
+)
+
+var checksumBaseOffsets = [checksumSums]uint32{
+	0x5B1F36E9, 0xB8525960, 0x02AB50AA, 0x1DE66D2A,
+	0x79FF467A, 0x9BB9F8A3, 0x217E7CD2, 0x83E13D2C,
+	0xF8D4474F, 0xE39EB970, 0x42C6AE16, 0x993216FA,
+	0x7B093B5D, 0x98DAFF3C, 0xF718902A, 0x0B1C9CDB,
+	0xE58F764B, 0x187636BC, 0x5D7B3BB1, 0xE73DE7DE,
+	0x92BEC979, 0xCCA6C0B2, 0x304A0979, 0x85AA43D4,
+	0x783125BB, 0x6CA8EAA2, 0xE407EAC6, 0x4B5CFC3E,
+	0x9FBF8C76, 0x15CA20BE, 0xF2CA9FFF, 0x3E3D0D3C,
+}
+
+type PageChecksumMismatchError struct {
+	error
+}
+
+func newPageChecksumMismatchError(fileName string, blockNo uint32, expected, actual uint16) PageChecksumMismatchError {
+	return PageChecksumMismatchError{errors.Errorf("Page checksum mismatch in '%s' block %d: expected %d, got %d",
+		fileName, blockNo, expected, actual)}
+}
+
+func (err PageChecksumMismatchError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+func checksumComp(checksum, value uint32) uint32 {
+	tmp := checksum ^ value
+	return tmp*checksumFnvPrime ^ (tmp >> 17)
+}
+
+// pgChecksumPage computes Postgres data checksum of the page, the same way as pg_checksum_page() does.
+// blockNo is the number of the block in the whole relation, not in the segment file.
+func pgChecksumPage(page []byte, blockNo uint32) uint16 {
+	sums := checksumBaseOffsets
+	rows := len(page) / (sizeofInt32 * checksumSums)
+	for i := 0; i < rows; i++ {
+		for j := 0; j < checksumSums; j++ {
+			offset := (i*checksumSums + j) * sizeofInt32
+			value := binary.LittleEndian.Uint32(page[offset:])
+			// pd_checksum is considered to be zero
+			if offset == pageChecksumOffset {
+				value &^= 0xFFFF
+			}
+			sums[j] = checksumComp(sums[j], value)
+		}
+	}
+	// two rounds of zeroes for additional mixing
+	for i := 0; i < 2; i++ {
+		for j := 0; j < checksumSums; j++ {
+			sums[j] = checksumComp(sums[j], 0)
+		}
+	}
+	result := uint32(0)
+	for j := 0; j < checksumSums; j++ {
+		result ^= sums[j]
+	}
+	result ^= blockNo
+	return uint16(result%65535 + 1)
+}
+
+// verifyPageChecksum checks data checksum of the page.
+// New pages and pages changed after the backup start are not verified, since they are restored from WAL.
+func verifyPageChecksum(page []byte, fileName string, blockNo uint32, backupStartLsn uint64) error {
+	header, err := parsePostgresPageHeader(bytes.NewReader(page))
+	if err != nil {
+		return err
+	}
+	if header.isNew() || header.lsn() >= backupStartLsn {
+		return nil
+	}
+	if actual := pgChecksumPage(page, blockNo); actual != header.pdChecksum {
+		return newPageChecksumMismatchError(fileName, blockNo, header.pdChecksum, actual)
+	}
+	return nil
+}
+
+// CorruptBlocksInfo reports pages with wrong checksums found in a file while pushing or fetching backup
+type CorruptBlocksInfo struct {
+	CorruptBlocksCount int
+	// SomeCorruptBlocks are numbers of blocks in the file, at most maxReportedCorruptBlocks of them
+	SomeCorruptBlocks []uint32
+}
+
+// pageChecksumVerifyingReader verifies checksums of pages read from paged file.
+// Mismatches are logged and recorded instead of failing the read.
+type pageChecksumVerifyingReader struct {
+	reader         io.Reader
+	fileName       string
+	firstBlockNo   uint32
+	blockNo        uint32
+	backupStartLsn uint64
+	page           []byte
+	pageOffset     int
+	corruptBlocks  *CorruptBlocksInfo
+	// rereadPage reads the block of the segment file again, it is set when the file is read while it may be written
+	rereadPage func(blockNo uint32, page []byte) error
+}
+
+// newCorruptBlocksCollectingReader verifies checksums without failing, corrupt blocks are returned by CorruptBlocks
+func newCorruptBlocksCollectingReader(reader io.Reader, fileName string, backupStartLsn uint64) (*pageChecksumVerifyingReader, error) {
+	relFileId, err := GetRelFileIdFrom(fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get relation segment number of '%s'", fileName)
+	}
+	return &pageChecksumVerifyingReader{
+		reader:         reader,
+		fileName:       fileName,
+		firstBlockNo:   uint32(relFileId * BlocksInRelFile),
+		blockNo:        uint32(relFileId * BlocksInRelFile),
+		backupStartLsn: backupStartLsn,
+		page:           make([]byte, DatabasePageSize),
+	}, nil
+}
+
+func (reader *pageChecksumVerifyingReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	for data := p[:n]; len(data) > 0; {
+		copied := copy(reader.page[reader.pageOffset:], data)
+		data = data[copied:]
+		reader.pageOffset += copied
+		if reader.pageOffset < len(reader.page) {
+			break
+		}
+		if verifyErr := reader.verifyPage(); verifyErr != nil {
+			tracelog.WarningLogger.Println(verifyErr.Error())
+			reader.addCorruptBlock(reader.blockNo - reader.firstBlockNo)
+		}
+		reader.blockNo++
+		reader.pageOffset = 0
+	}
+	return n, err
+}
+
+// verifyPage checks the page read last. A page being written while it is read may be torn,
+// so a mismatched page is read again: it is corrupt only if it still mismatches and was not changed after the backup start.
+func (reader *pageChecksumVerifyingReader) verifyPage() error {
+	err := verifyPageChecksum(reader.page, reader.fileName, reader.blockNo, reader.backupStartLsn)
+	if err == nil || reader.rereadPage == nil {
+		return err
+	}
+	page := make([]byte, DatabasePageSize)
+	if rereadErr := reader.rereadPage(reader.blockNo-reader.firstBlockNo, page); rereadErr != nil {
+		tracelog.WarningLogger.Printf("Failed to read block %d of '%s' again: %v\n",
+			reader.blockNo-reader.firstBlockNo, reader.fileName, rereadErr)
+		return err
+	}
+	return verifyPageChecksum(page, reader.fileName, reader.blockNo, reader.backupStartLsn)
+}
+
+// readFilePage reads the block of the file, it is used to read pages with wrong checksums again
+func readFilePage(filePath string, blockNo uint32, page []byte) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer utility.LoggedClose(file, "")
+	_, err = file.ReadAt(page, int64(blockNo)*DatabasePageSize)
+	return err
+}
+
+func (reader *pageChecksumVerifyingReader) addCorruptBlock(blockNo uint32) {
+	if reader.corruptBlocks == nil {
+		reader.corruptBlocks = &CorruptBlocksInfo{}
+	}
+	reader.corruptBlocks.CorruptBlocksCount++
+	if len(reader.corruptBlocks.SomeCorruptBlocks) < maxReportedCorruptBlocks {
+		reader.corruptBlocks.SomeCorruptBlocks = append(reader.corruptBlocks.SomeCorruptBlocks, blockNo)
+	}
+}
+
+// CorruptBlocks returns blocks with wrong checksums read so far, nil if there are none
+func (reader *pageChecksumVerifyingReader) CorruptBlocks() *CorruptBlocksInfo {
+	return reader.corruptBlocks
+}
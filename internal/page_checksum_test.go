@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeChecksummedPage(lsn uint64, blockNo uint32, fill byte) []byte {
+	page := make([]byte, DatabasePageSize)
+	binary.LittleEndian.PutUint32(page[0:], uint32(lsn>>32))
+	binary.LittleEndian.PutUint32(page[4:], uint32(lsn))
+	binary.LittleEndian.PutUint16(page[12:], headerSize)               // pd_lower
+	binary.LittleEndian.PutUint16(page[14:], uint16(DatabasePageSize)) // pd_upper
+	binary.LittleEndian.PutUint16(page[16:], uint16(DatabasePageSize)) // pd_special
+	binary.LittleEndian.PutUint16(page[18:], uint16(DatabasePageSize+layoutVersion))
+	for i := headerSize; i < len(page); i++ {
+		page[i] = fill
+	}
+	binary.LittleEndian.PutUint16(page[pageChecksumOffset:], pgChecksumPage(page, blockNo))
+	return page
+}
+
+func TestPgChecksumPage_IgnoresStoredChecksum(t *testing.T) {
+	page := makeChecksummedPage(0x100, 7, 0xAB)
+	checksum := pgChecksumPage(page, 7)
+	binary.LittleEndian.PutUint16(page[pageChecksumOffset:], 0)
+
+	assert.Equal(t, checksum, pgChecksumPage(page, 7))
+	assert.NotEqual(t, checksum, pgChecksumPage(page, 8))
+}
+
+// makeFixturePage builds a page with pd_lsn 0/1000028, empty line pointer array
+// and 32 bytes of special space filled with i % 251
+func makeFixturePage() []byte {
+	page := make([]byte, DatabasePageSize)
+	binary.LittleEndian.PutUint32(page[4:], 0x1000028)
+	binary.LittleEndian.PutUint16(page[12:], headerSize)
+	binary.LittleEndian.PutUint16(page[14:], 8160)
+	binary.LittleEndian.PutUint16(page[16:], uint16(DatabasePageSize))
+	binary.LittleEndian.PutUint16(page[18:], uint16(DatabasePageSize+layoutVersion))
+	for i := 8160; i < len(page); i++ {
+		page[i] = byte(i % 251)
+	}
+	return page
+}
+
+func TestPgChecksumPage_KnownChecksums(t *testing.T) {
+	page := makeFixturePage()
+
+	// expected values are computed by pg_checksum_page() of PostgreSQL checksum_impl.h
+	assert.Equal(t, uint16(26855), pgChecksumPage(page, 0))
+	assert.Equal(t, uint16(26853), pgChecksumPage(page, uint32(BlocksInRelFile)))
+	assert.Equal(t, uint16(26852), pgChecksumPage(page, uint32(BlocksInRelFile+1)))
+
+	binary.LittleEndian.PutUint16(page[pageChecksumOffset:], 26853)
+	assert.NoError(t, verifyPageChecksum(page, "base/13000/16384.1", uint32(BlocksInRelFile), 0x2000000))
+	assert.IsType(t, PageChecksumMismatchError{}, verifyPageChecksum(page, "base/13000/16384.1", 0, 0x2000000))
+}
+
+func TestPageChecksumVerifyingReader_SkipsPagesChangedDuringBackup(t *testing.T) {
+	page := makeChecksummedPage(0x2000, 0, 1)
+	page[100] ^= 0xFF
+	newPage := make([]byte, DatabasePageSize)
+
+	reader, err := newCorruptBlocksCollectingReader(bytes.NewReader(append(page, newPage...)), "base/13000/16384", 0x1000)
+	assert.NoError(t, err)
+	_, err = ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Nil(t, reader.CorruptBlocks())
+}
+
+func TestCorruptBlocksCollectingReader(t *testing.T) {
+	blockNo := uint32(BlocksInRelFile)
+	data := append(makeChecksummedPage(0x100, blockNo, 1), makeChecksummedPage(0x200, blockNo+1, 2)...)
+	data = append(data, makeChecksummedPage(0x300, blockNo+2, 3)...)
+	data[DatabasePageSize+100] ^= 0xFF
+
+	reader, err := newCorruptBlocksCollectingReader(bytes.NewReader(data), "base/13000/16384.1", 0x1000)
+	assert.NoError(t, err)
+	readData, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, data, readData)
+	assert.Equal(t, &CorruptBlocksInfo{CorruptBlocksCount: 1, SomeCorruptBlocks: []uint32{1}}, reader.CorruptBlocks())
+}
+
+func TestCorruptBlocksCollectingReader_RereadsMismatchedPages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal-g-checksums")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "16384")
+
+	// the first page was torn while read and has been rewritten after the backup start since then,
+	// the second one is corrupt on disk
+	tornPage := makeChecksummedPage(0x100, 0, 1)
+	copy(tornPage[DatabasePageSize/2:], bytes.Repeat([]byte{2}, int(DatabasePageSize/2)))
+	corruptPage := makeChecksummedPage(0x100, 1, 3)
+	corruptPage[100] ^= 0xFF
+	onDisk := append(makeChecksummedPage(0x2000, 0, 2), corruptPage...)
+	require.NoError(t, ioutil.WriteFile(filePath, onDisk, 0600))
+
+	reader, err := newCorruptBlocksCollectingReader(bytes.NewReader(append(tornPage, corruptPage...)), filePath, 0x1000)
+	require.NoError(t, err)
+	reader.rereadPage = func(blockNo uint32, page []byte) error {
+		return readFilePage(filePath, blockNo, page)
+	}
+	_, err = ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, &CorruptBlocksInfo{CorruptBlocksCount: 1, SomeCorruptBlocks: []uint32{1}}, reader.CorruptBlocks())
+}
@@ -68,6 +68,34 @@ func (deltaMap *PagedFileDeltaMap) AddLocationsToDelta(locations []walparser.Blo
 	}
 }
 
+// AddPtrackPagemap adds blocks of relation segment file marked in ptrack pagemap.
+// Bit i of byte j in pagemap stands for block j*8+i of the segment.
+func (deltaMap *PagedFileDeltaMap) AddPtrackPagemap(filePath string, pagemap []byte) error {
+	if !pagedFilenameRegexp.MatchString(path.Base(filePath)) {
+		return nil
+	}
+	relFileNode, err := GetRelFileNodeFrom(filePath)
+	if err != nil {
+		return err
+	}
+	relFileId, err := GetRelFileIdFrom(filePath)
+	if err != nil {
+		return err
+	}
+	firstBlockNo := uint32(relFileId * BlocksInRelFile)
+	for byteNo, bits := range pagemap {
+		for bitNo := uint32(0); bitNo < 8; bitNo++ {
+			if bits&(1<<bitNo) != 0 {
+				deltaMap.AddLocationToDelta(walparser.BlockLocation{
+					RelationFileNode: *relFileNode,
+					BlockNo:          firstBlockNo + uint32(byteNo)*8 + bitNo,
+				})
+			}
+		}
+	}
+	return nil
+}
+
 // TODO : unit test no bitmap found
 func (deltaMap *PagedFileDeltaMap) GetDeltaBitmapFor(filePath string) (*roaring.Bitmap, error) {
 	relFileNode, err := GetRelFileNodeFrom(filePath)
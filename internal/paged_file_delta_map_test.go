@@ -80,3 +80,25 @@ func TestGetDeltaBitmapFor(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []uint32{23, 134}, bitmap.ToArray())
 }
+
+func TestAddPtrackPagemap(t *testing.T) {
+	deltaMap := internal.NewPagedFileDeltaMap()
+	err := deltaMap.AddPtrackPagemap("base/16384/16390.1", []byte{0x05, 0x80})
+	assert.NoError(t, err)
+	err = deltaMap.AddPtrackPagemap("base/16384/16390", []byte{0x02})
+	assert.NoError(t, err)
+	// not a relation segment file
+	err = deltaMap.AddPtrackPagemap("base/16384/16390_fsm", []byte{0xff})
+	assert.NoError(t, err)
+
+	bitmap, err := deltaMap.GetDeltaBitmapFor("base/16384/16390.1")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{0, 2, 15}, bitmap.ToArray())
+
+	bitmap, err = deltaMap.GetDeltaBitmapFor("base/16384/16390")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{1}, bitmap.ToArray())
+
+	_, err = deltaMap.GetDeltaBitmapFor("base/16384/16391")
+	assert.IsType(t, internal.NoBitmapFoundError{}, err)
+}
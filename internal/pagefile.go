@@ -116,7 +116,10 @@ func isPagedFile(info os.FileInfo, filePath string) bool {
 	return true
 }
 
-func ReadIncrementalFile(filePath string, fileSize int64, lsn uint64, deltaBitmap *roaring.Bitmap) (fileReader io.ReadCloser, size int64, err error) {
+// ReadIncrementalFile reads blocks changed since lsn (or blocks from deltaBitmap, if it is given)
+// and extraBlocks, which are included regardless of their LSN
+func ReadIncrementalFile(filePath string, fileSize int64, lsn uint64,
+	deltaBitmap, extraBlocks *roaring.Bitmap) (fileReader io.ReadCloser, size int64, err error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, 0, err
@@ -129,7 +132,7 @@ func ReadIncrementalFile(filePath string, fileSize int64, lsn uint64, deltaBitma
 	}
 
 	pageReader := &IncrementalPageReader{fileReadSeekCloser, fileSize, lsn, nil, nil}
-	incrementSize, err := pageReader.initialize(deltaBitmap)
+	incrementSize, err := pageReader.initialize(deltaBitmap, extraBlocks)
 	if err != nil {
 		return nil, 0, err
 	}
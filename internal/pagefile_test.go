@@ -107,7 +107,7 @@ func postgresReadIncrementTest(localLSN uint64, t *testing.T) {
 	if err != nil {
 		fmt.Print(err.Error())
 	}
-	reader, size, err := internal.ReadIncrementalFile(pagedFileName, fileInfo.Size(), localLSN, nil)
+	reader, size, err := internal.ReadIncrementalFile(pagedFileName, fileInfo.Size(), localLSN, nil, nil)
 	if err != nil {
 		fmt.Print(err.Error())
 	}
@@ -336,7 +336,7 @@ func checkAllWrittenBlocksCorrect(mockFile *MockReadWriterAt, sourceFile io.Read
 
 func readIncrementToBuffer(localLSN uint64) []byte {
 	fileInfo, _ := os.Stat(pagedFileName)
-	reader, _, _ := internal.ReadIncrementalFile(pagedFileName, fileInfo.Size(), localLSN, nil)
+	reader, _, _ := internal.ReadIncrementalFile(pagedFileName, fileInfo.Size(), localLSN, nil, nil)
 	buf, _ := ioutil.ReadAll(reader)
 	return buf
 }
@@ -25,16 +25,19 @@ func HandleWALPrefetch(uploader *WalUploader, walFileName string, location strin
 	var fileName = walFileName
 	location = path.Dir(location)
 	waitGroup := &sync.WaitGroup{}
-	concurrency, err := getMaxDownloadConcurrency()
+	depth, err := getPrefetchDepth()
 	tracelog.ErrorLogger.FatalOnError(err)
+	concurrency, err := getMaxPrefetchConcurrency()
+	tracelog.ErrorLogger.FatalOnError(err)
+	downloadSemaphore := make(chan struct{}, concurrency)
 
-	for i := 0; i < concurrency; i++ {
+	for i := 0; i < depth; i++ {
 		fileName, err = GetNextWalFilename(fileName)
 		if err != nil {
 			tracelog.ErrorLogger.Println("WAL-prefetch failed: ", err, " file: ", fileName)
 		}
 		waitGroup.Add(1)
-		go prefetchFile(location, folder, fileName, waitGroup)
+		go prefetchFile(location, folder, fileName, waitGroup, downloadSemaphore)
 
 		prefaultStartLsn, shouldPrefault, timelineId, err := shouldPrefault(fileName)
 		if err != nil {
@@ -51,6 +54,9 @@ func HandleWALPrefetch(uploader *WalUploader, walFileName string, location strin
 	go CleanupPrefetchDirectories(walFileName, location, FileSystemCleaner{})
 
 	waitGroup.Wait()
+
+	prefetchLocation, _, _, _ := getPrefetchLocations(location, walFileName)
+	trimPrefetchSpool(prefetchLocation, getPrefetchSpoolLimit())
 }
 
 // TODO : unit tests
@@ -159,7 +165,7 @@ func (bundle *Bundle) prefaultFile(path string, info os.FileInfo, fileInfoHeader
 				return errors.Wrapf(err, "packFileIntoTar: failed to find corresponding bitmap '%s'\n", path)
 			}
 			tracelog.InfoLogger.Println("Prefaulting ", path)
-			fileReader, fileInfoHeader.Size, err = ReadIncrementalFile(path, info.Size(), *incrementBaseLsn, bitmap)
+			fileReader, fileInfoHeader.Size, err = ReadIncrementalFile(path, info.Size(), *incrementBaseLsn, bitmap, nil)
 			if _, ok := err.(InvalidBlockError); ok {
 				return nil
 			} else if err != nil {
@@ -179,7 +185,8 @@ func (bundle *Bundle) prefaultFile(path string, info os.FileInfo, fileInfoHeader
 }
 
 // TODO : unit tests
-func prefetchFile(location string, folder storage.Folder, walFileName string, waitGroup *sync.WaitGroup) {
+func prefetchFile(location string, folder storage.Folder, walFileName string, waitGroup *sync.WaitGroup,
+	downloadSemaphore chan struct{}) {
 	defer func() {
 		if r := recover(); r != nil {
 			tracelog.ErrorLogger.Println("Prefetch unsuccessful ", walFileName, r)
@@ -191,11 +198,20 @@ func prefetchFile(location string, folder storage.Folder, walFileName string, wa
 	_, errO := os.Stat(oldPath)
 	_, errN := os.Stat(newPath)
 
-	if (errO == nil || !os.IsNotExist(errO)) || (errN == nil || !os.IsNotExist(errN)) {
+	if errN == nil {
+		// File is already prefetched, mark it as recently used for spool trimming
+		now := time.Now()
+		_ = os.Chtimes(newPath, now, now)
+		return
+	}
+	if (errO == nil || !os.IsNotExist(errO)) || !os.IsNotExist(errN) {
 		// Seems someone is doing something about this file
 		return
 	}
 
+	downloadSemaphore <- struct{}{}
+	defer func() { <-downloadSemaphore }()
+
 	tracelog.InfoLogger.Println("WAL-prefetch file: ", walFileName)
 	os.MkdirAll(runningLocation, 0755)
 
@@ -221,13 +237,13 @@ func getPrefetchLocations(location string, walFileName string) (prefetchLocation
 
 // TODO : unit tests
 func forkPrefetch(walFileName string, location string) {
-	concurrency, err := getMaxDownloadConcurrency()
+	depth, err := getPrefetchDepth()
 	if err != nil {
 		tracelog.ErrorLogger.Println("WAL-prefetch failed: ", err)
 	}
 	if strings.Contains(walFileName, "history") ||
 		strings.Contains(walFileName, "partial") ||
-		concurrency == 1 {
+		depth == 0 {
 		return // There will be nothing ot prefetch anyway
 	}
 	cmd := exec.Command(os.Args[0], "wal-prefetch", walFileName, location)
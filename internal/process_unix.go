@@ -0,0 +1,22 @@
+// +build !windows
+
+package internal
+
+import (
+	"os"
+	"syscall"
+)
+
+// isProcessRunning checks if the process with pid exists on this host
+func isProcessRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// signal 0 checks the process without sending a signal, EPERM means it is owned by another user
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
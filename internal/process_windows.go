@@ -0,0 +1,20 @@
+// +build windows
+
+package internal
+
+import (
+	"os"
+)
+
+// isProcessRunning checks if the process with pid exists on this host
+func isProcessRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = process.Release()
+	return true
+}
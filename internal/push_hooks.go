@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+const (
+	// HookFailurePolicyFail makes a failed hook fail the command, a failed pre hook prevents the push
+	HookFailurePolicyFail = "fail"
+	// HookFailurePolicyWarn makes a failed hook only log a warning
+	HookFailurePolicyWarn = "warn"
+
+	hookDataDirectoryEnv = "WALG_HOOK_DATA_DIRECTORY"
+	hookBackupNameEnv    = "WALG_HOOK_BACKUP_NAME"
+	hookWalFilePathEnv   = "WALG_HOOK_WAL_FILE_PATH"
+)
+
+type InvalidHookFailurePolicyError struct {
+	error
+}
+
+func newInvalidHookFailurePolicyError(policy string) InvalidHookFailurePolicyError {
+	return InvalidHookFailurePolicyError{errors.Errorf("Invalid %s '%s', expected %s or %s",
+		HookFailurePolicySetting, policy, HookFailurePolicyFail, HookFailurePolicyWarn)}
+}
+
+func (err InvalidHookFailurePolicyError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// runPushHook runs the hook command configured by hookSetting with additional environment variables.
+// The hook is killed after WALG_HOOK_TIMEOUT. An error is returned only if the hook failed
+// and WALG_HOOK_FAILURE_POLICY is fail, otherwise the failure is logged.
+func runPushHook(hookSetting string, env ...string) error {
+	if command, ok := GetSetting(hookSetting); !ok || command == "" {
+		return nil
+	}
+	policy, _ := GetSetting(HookFailurePolicySetting)
+	if policy != HookFailurePolicyFail && policy != HookFailurePolicyWarn {
+		return newInvalidHookFailurePolicyError(policy)
+	}
+	err := runHookCommand(hookSetting, env)
+	if err == nil {
+		return nil
+	}
+	if policy == HookFailurePolicyWarn {
+		tracelog.WarningLogger.Printf("%v\n", err)
+		return nil
+	}
+	return err
+}
+
+func runHookCommand(hookSetting string, env []string) error {
+	timeout, err := GetDurationSetting(HookTimeoutSetting)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd, err := GetCommandSettingContext(ctx, hookSetting)
+	if err != nil {
+		return err
+	}
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stdout
+	tracelog.InfoLogger.Printf("Running %s\n", hookSetting)
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.Errorf("%s timed out after %v", hookSetting, timeout)
+	}
+	return errors.Wrapf(err, "%s failed", hookSetting)
+}
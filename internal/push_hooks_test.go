@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func setPushHookSettings(hook, policy, timeout string) func() {
+	viper.Set(WalPushPreHookSetting, hook)
+	viper.Set(HookFailurePolicySetting, policy)
+	viper.Set(HookTimeoutSetting, timeout)
+	return func() {
+		viper.Set(WalPushPreHookSetting, nil)
+		viper.Set(HookFailurePolicySetting, nil)
+		viper.Set(HookTimeoutSetting, nil)
+	}
+}
+
+func TestRunPushHook_NotConfigured(t *testing.T) {
+	assert.NoError(t, runPushHook(WalPushPreHookSetting))
+}
+
+func TestRunPushHook_PassesEnvironment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "push_hook")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "output")
+	defer setPushHookSettings("echo $WALG_HOOK_WAL_FILE_PATH > "+output, HookFailurePolicyFail, "10")()
+
+	err = runPushHook(WalPushPreHookSetting, hookWalFilePathEnv+"=pg_wal/000000010000000000000003")
+	assert.NoError(t, err)
+	content, err := ioutil.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, "pg_wal/000000010000000000000003\n", string(content))
+}
+
+func TestRunPushHook_FailurePolicy(t *testing.T) {
+	reset := setPushHookSettings("exit 3", HookFailurePolicyFail, "10")
+	assert.Error(t, runPushHook(WalPushPreHookSetting))
+	reset()
+
+	reset = setPushHookSettings("exit 3", HookFailurePolicyWarn, "10")
+	assert.NoError(t, runPushHook(WalPushPreHookSetting))
+	reset()
+
+	defer setPushHookSettings("exit 3", "ignore", "10")()
+	assert.IsType(t, InvalidHookFailurePolicyError{}, runPushHook(WalPushPreHookSetting))
+}
+
+func TestRunPushHook_Timeout(t *testing.T) {
+	defer setPushHookSettings("sleep 5", HookFailurePolicyFail, "1")()
+	err := runPushHook(WalPushPreHookSetting)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+}
@@ -2,6 +2,8 @@ package internal
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx"
 	"github.com/pkg/errors"
@@ -32,6 +34,18 @@ func (err UnsupportedPostgresVersionError) Error() string {
 	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
 }
 
+type StandbyBackupError struct {
+	error
+}
+
+func newStandbyBackupError(reason string) StandbyBackupError {
+	return StandbyBackupError{errors.Errorf("Backup from standby is not possible: %s", reason)}
+}
+
+func (err StandbyBackupError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
 // The QueryRunner interface for controlling database during backup
 type QueryRunner interface {
 	// This call should inform the database that we are going to copy cluster's contents
@@ -85,6 +99,33 @@ func (queryRunner *PgQueryRunner) BuildStopBackup() (string, error) {
 	}
 }
 
+// BuildGetReplayLsn formats a query to retrieve the last WAL location replayed by standby
+func (queryRunner *PgQueryRunner) BuildGetReplayLsn() string {
+	if queryRunner.Version >= 100000 {
+		return "select pg_last_wal_replay_lsn()::text"
+	}
+	return "select pg_last_xlog_replay_location()::text"
+}
+
+// BuildGetCurrentLsn formats a query to retrieve the current WAL location of primary or the last replayed location of standby
+func (queryRunner *PgQueryRunner) BuildGetCurrentLsn() string {
+	if queryRunner.Version >= 100000 {
+		return "select (case when pg_is_in_recovery() then pg_last_wal_replay_lsn() else pg_current_wal_lsn() end)::text"
+	}
+	return "select (case when pg_is_in_recovery() then pg_last_xlog_replay_location() else pg_current_xlog_location() end)::text"
+}
+
+// BuildGetReplayLag formats a query to retrieve replay lag of standby in seconds.
+// Standby which replayed all received WAL is not lagging even if primary is idle.
+func (queryRunner *PgQueryRunner) BuildGetReplayLag() string {
+	if queryRunner.Version >= 100000 {
+		return "select case when pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() then 0 " +
+			"else coalesce(extract(epoch from now() - pg_last_xact_replay_timestamp()), 0) end"
+	}
+	return "select case when pg_last_xlog_receive_location() = pg_last_xlog_replay_location() then 0 " +
+		"else coalesce(extract(epoch from now() - pg_last_xact_replay_timestamp()), 0) end"
+}
+
 // NewPgQueryRunner builds QueryRunner from available connection
 func newPgQueryRunner(conn *pgx.Conn) (*PgQueryRunner, error) {
 	r := &PgQueryRunner{connection: conn}
@@ -137,6 +178,175 @@ func (queryRunner *PgQueryRunner) startBackup(backup string) (backupName string,
 	return backupName, lsnString, inRecovery, dataDir, nil
 }
 
+// checkStandby verifies that a consistent backup can be taken if the database is a standby.
+// Zero maxReplayLag disables the replay lag check.
+func (queryRunner *PgQueryRunner) checkStandby(maxReplayLag time.Duration) error {
+	conn := queryRunner.connection
+	var inRecovery bool
+	if err := conn.QueryRow("select pg_is_in_recovery()").Scan(&inRecovery); err != nil {
+		return errors.Wrap(err, "QueryRunner CheckStandby: pg_is_in_recovery() failed")
+	}
+	if !inRecovery {
+		return nil
+	}
+
+	// backup_label is returned by pg_stop_backup() only for non-exclusive backups
+	if queryRunner.Version < 90600 {
+		return newStandbyBackupError(fmt.Sprintf("non-exclusive backup requires Postgres 9.6 or newer, but version is %d", queryRunner.Version))
+	}
+
+	var fullPageWrites string
+	if err := conn.QueryRow("show full_page_writes").Scan(&fullPageWrites); err != nil {
+		return errors.Wrap(err, "QueryRunner CheckStandby: show full_page_writes failed")
+	}
+	if fullPageWrites != "on" {
+		return newStandbyBackupError("full_page_writes is off")
+	}
+
+	if maxReplayLag == 0 {
+		return nil
+	}
+	var lagSeconds float64
+	if err := conn.QueryRow(queryRunner.BuildGetReplayLag()).Scan(&lagSeconds); err != nil {
+		return errors.Wrap(err, "QueryRunner CheckStandby: getting replay lag failed")
+	}
+	lag := time.Duration(lagSeconds * float64(time.Second))
+	if lag > maxReplayLag {
+		return newStandbyBackupError(fmt.Sprintf("replay lag %v exceeds %s of %v", lag, StandbyMaxReplayLagSetting, maxReplayLag))
+	}
+	tracelog.InfoLogger.Printf("Taking backup from standby, replay lag is %v\n", lag)
+	return nil
+}
+
+// getDataChecksums checks if data checksums are enabled in the cluster
+func (queryRunner *PgQueryRunner) getDataChecksums() (enabled bool, err error) {
+	var dataChecksums string
+	err = queryRunner.connection.QueryRow("show data_checksums").Scan(&dataChecksums)
+	return dataChecksums == "on", errors.Wrap(err, "QueryRunner GetDataChecksums: show data_checksums failed")
+}
+
+// getConfigFilePaths returns locations of the main configuration file, pg_hba.conf and pg_ident.conf
+func (queryRunner *PgQueryRunner) getConfigFilePaths() (paths []string, err error) {
+	var configFile, hbaFile, identFile string
+	err = queryRunner.connection.QueryRow("select current_setting('config_file'), "+
+		"current_setting('hba_file'), current_setting('ident_file')").Scan(&configFile, &hbaFile, &identFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "QueryRunner GetConfigFilePaths: getting configuration files failed")
+	}
+	return []string{configFile, hbaFile, identFile}, nil
+}
+
+// getSslFilePaths returns configured certificate, CA and CRL files and the private key file separately,
+// relative paths are relative to the data directory
+func (queryRunner *PgQueryRunner) getSslFilePaths() (paths []string, keyFile string, err error) {
+	var certFile, caFile, crlFile string
+	err = queryRunner.connection.QueryRow("select current_setting('ssl_cert_file'), current_setting('ssl_key_file'), "+
+		"current_setting('ssl_ca_file'), current_setting('ssl_crl_file')").Scan(&certFile, &keyFile, &caFile, &crlFile)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "QueryRunner GetSslFilePaths: getting SSL files failed")
+	}
+	for _, path := range []string{certFile, caFile, crlFile} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, keyFile, nil
+}
+
+// getObjectOids retrieves names and oids of databases or tablespaces
+func (queryRunner *PgQueryRunner) getObjectOids(query string) (oids map[string]uint32, err error) {
+	rows, err := queryRunner.connection.Query(query)
+	if err != nil {
+		return nil, errors.Wrapf(err, "QueryRunner GetObjectOids: '%s' failed", query)
+	}
+	defer rows.Close()
+	oids = make(map[string]uint32)
+	for rows.Next() {
+		var oid int64
+		var name string
+		if err = rows.Scan(&oid, &name); err != nil {
+			return nil, errors.Wrap(err, "QueryRunner GetObjectOids: failed to parse row")
+		}
+		oids[name] = uint32(oid)
+	}
+	return oids, errors.Wrap(rows.Err(), "QueryRunner GetObjectOids: failed to read rows")
+}
+
+// getDatabaseOids retrieves oids of databases by their names
+func (queryRunner *PgQueryRunner) getDatabaseOids() (map[string]uint32, error) {
+	return queryRunner.getObjectOids("select oid::int8, datname from pg_database")
+}
+
+// getTablespaceOids retrieves oids of tablespaces by their names
+func (queryRunner *PgQueryRunner) getTablespaceOids() (map[string]uint32, error) {
+	return queryRunner.getObjectOids("select oid::int8, spcname from pg_tablespace")
+}
+
+// getPtrackPagemapset retrieves bitmaps of blocks changed since the given LSN from ptrack extension.
+// Maps are returned for relation segment files, bits are numbers of blocks in segment.
+func (queryRunner *PgQueryRunner) getPtrackPagemapset(sinceLsn uint64) (pagemaps map[string][]byte, err error) {
+	conn := queryRunner.connection
+	var version string
+	err = conn.QueryRow("select extversion from pg_extension where extname = 'ptrack'").Scan(&version)
+	if err == pgx.ErrNoRows {
+		return nil, errors.New("QueryRunner GetPtrackPagemapset: ptrack extension is not installed")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "QueryRunner GetPtrackPagemapset: getting ptrack version failed")
+	}
+	if strings.HasPrefix(version, "1.") {
+		return nil, errors.Errorf("QueryRunner GetPtrackPagemapset: ptrack %s is not supported, 2.0 or newer is needed", version)
+	}
+
+	var initLsnStr string
+	if err = conn.QueryRow("select ptrack_init_lsn()::text").Scan(&initLsnStr); err != nil {
+		return nil, errors.Wrap(err, "QueryRunner GetPtrackPagemapset: getting ptrack init LSN failed")
+	}
+	initLsn, err := pgx.ParseLSN(initLsnStr)
+	if err != nil {
+		return nil, errors.Wrap(err, "QueryRunner GetPtrackPagemapset: failed to parse ptrack init LSN")
+	}
+	if initLsn > sinceLsn {
+		return nil, errors.Errorf("QueryRunner GetPtrackPagemapset: ptrack tracks changes since %s, "+
+			"which is after the previous backup", initLsnStr)
+	}
+
+	rows, err := conn.Query("select path, pagemap from ptrack_get_pagemapset($1::text::pg_lsn)", pgx.FormatLSN(sinceLsn))
+	if err != nil {
+		return nil, errors.Wrap(err, "QueryRunner GetPtrackPagemapset: ptrack_get_pagemapset failed")
+	}
+	defer rows.Close()
+	pagemaps = make(map[string][]byte)
+	for rows.Next() {
+		var path string
+		var pagemap []byte
+		if err = rows.Scan(&path, &pagemap); err != nil {
+			return nil, errors.Wrap(err, "QueryRunner GetPtrackPagemapset: failed to parse row")
+		}
+		pagemaps[path] = pagemap
+	}
+	return pagemaps, errors.Wrap(rows.Err(), "QueryRunner GetPtrackPagemapset: failed to read rows")
+}
+
+// getReplayLsn retrieves the last WAL location replayed by standby
+func (queryRunner *PgQueryRunner) getReplayLsn() (lsn uint64, err error) {
+	var lsnStr string
+	if err = queryRunner.connection.QueryRow(queryRunner.BuildGetReplayLsn()).Scan(&lsnStr); err != nil {
+		return 0, errors.Wrap(err, "QueryRunner GetReplayLsn: getting replay LSN failed")
+	}
+	lsn, err = pgx.ParseLSN(lsnStr)
+	return lsn, errors.Wrap(err, "QueryRunner GetReplayLsn: failed to parse replay LSN")
+}
+
+func (queryRunner *PgQueryRunner) getCurrentLsn() (lsn uint64, err error) {
+	var lsnStr string
+	if err = queryRunner.connection.QueryRow(queryRunner.BuildGetCurrentLsn()).Scan(&lsnStr); err != nil {
+		return 0, errors.Wrap(err, "QueryRunner GetCurrentLsn: getting current LSN failed")
+	}
+	lsn, err = pgx.ParseLSN(lsnStr)
+	return lsn, errors.Wrap(err, "QueryRunner GetCurrentLsn: failed to parse current LSN")
+}
+
 // StopBackup informs the database that copy is over
 func (queryRunner *PgQueryRunner) stopBackup() (label string, offsetMap string, lsnStr string, err error) {
 	tracelog.InfoLogger.Println("Calling pg_stop_backup()")
@@ -52,3 +52,14 @@ func TestBuildStopBackup(t *testing.T) {
 	queryString, err = queryBuilder.BuildStopBackup()
 	assert.Equal(t, "SELECT labelfile, spcmapfile, lsn FROM pg_stop_backup(false)", queryString)
 }
+
+// Tests building standby replay queries
+func TestBuildGetReplay(t *testing.T) {
+	queryBuilder := &internal.PgQueryRunner{Version: 90600}
+	assert.Equal(t, "select pg_last_xlog_replay_location()::text", queryBuilder.BuildGetReplayLsn())
+	assert.Contains(t, queryBuilder.BuildGetReplayLag(), "pg_last_xlog_receive_location() = pg_last_xlog_replay_location()")
+
+	queryBuilder.Version = 100000
+	assert.Equal(t, "select pg_last_wal_replay_lsn()::text", queryBuilder.BuildGetReplayLsn())
+	assert.Contains(t, queryBuilder.BuildGetReplayLag(), "pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn()")
+}
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	// DefaultRestoreCommand is used in generated recovery configuration if no restore command is given
+	DefaultRestoreCommand = "wal-g wal-fetch \"%f\" \"%p\""
+
+	recoveryConfName   = "recovery.conf"
+	autoConfName       = "postgresql.auto.conf"
+	recoverySignalName = "recovery.signal"
+	standbySignalName  = "standby.signal"
+	pgVersionFileName  = "PG_VERSION"
+
+	// Postgres 12 moved recovery settings to postgresql.conf
+	recoverySignalMinVersion = 12
+
+	// recovery_target_timeline = 'current' is the default, which can be set explicitly since Postgres 12
+	currentTimelineMinVersion = 12
+	currentRecoveryTimeline   = "current"
+	latestRecoveryTimeline    = "latest"
+)
+
+// RecoveryTargetActions are values of recovery_target_action
+var RecoveryTargetActions = []string{"pause", "promote", "shutdown"}
+
+type MultipleRecoveryTargetsError struct {
+	error
+}
+
+func newMultipleRecoveryTargetsError() MultipleRecoveryTargetsError {
+	return MultipleRecoveryTargetsError{errors.New("At most one of recovery target time, lsn and name can be specified")}
+}
+
+func (err MultipleRecoveryTargetsError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+type InvalidRecoverySettingError struct {
+	error
+}
+
+func newInvalidRecoverySettingError(name, value string, expected string) InvalidRecoverySettingError {
+	return InvalidRecoverySettingError{errors.Errorf("Invalid %s '%s', expected %s", name, value, expected)}
+}
+
+func (err InvalidRecoverySettingError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// RecoveryConfig describes recovery settings written to fetched data directory
+type RecoveryConfig struct {
+	RestoreCommand string
+	TargetTime     string
+	TargetLsn      string
+	TargetName     string
+	TargetAction   string
+	// TargetTimeline is current, latest or a numeric timeline id
+	TargetTimeline string
+	// Standby makes the cluster a standby instead of recovering to the target
+	Standby         bool
+	PrimaryConnInfo string
+}
+
+// IsEmpty checks if no recovery settings are given, so recovery configuration should not be written
+func (config RecoveryConfig) IsEmpty() bool {
+	return config == RecoveryConfig{}
+}
+
+// Validate checks that recovery settings are consistent
+func (config RecoveryConfig) Validate() error {
+	targets := 0
+	for _, target := range []string{config.TargetTime, config.TargetLsn, config.TargetName} {
+		if target != "" {
+			targets++
+		}
+	}
+	if targets > 1 {
+		return newMultipleRecoveryTargetsError()
+	}
+	if config.TargetAction != "" && !isRecoveryTargetAction(config.TargetAction) {
+		return newInvalidRecoverySettingError("recovery_target_action", config.TargetAction,
+			strings.Join(RecoveryTargetActions, ", "))
+	}
+	switch config.TargetTimeline {
+	case "", currentRecoveryTimeline, latestRecoveryTimeline:
+	default:
+		if timeline, err := strconv.ParseUint(config.TargetTimeline, 10, 32); err != nil || timeline == 0 {
+			return newInvalidRecoverySettingError("recovery_target_timeline", config.TargetTimeline,
+				"current, latest or a timeline id")
+		}
+	}
+	return nil
+}
+
+func isRecoveryTargetAction(action string) bool {
+	for _, targetAction := range RecoveryTargetActions {
+		if action == targetAction {
+			return true
+		}
+	}
+	return false
+}
+
+// lines returns recovery settings in postgresql.conf format for the Postgres major version
+func (config RecoveryConfig) lines(version int) []string {
+	restoreCommand := config.RestoreCommand
+	if restoreCommand == "" {
+		restoreCommand = DefaultRestoreCommand
+	}
+	targetTimeline := config.TargetTimeline
+	if targetTimeline == currentRecoveryTimeline && version < currentTimelineMinVersion {
+		targetTimeline = ""
+	}
+	settings := []struct {
+		name  string
+		value string
+	}{
+		{"restore_command", restoreCommand},
+		{"recovery_target_time", config.TargetTime},
+		{"recovery_target_lsn", config.TargetLsn},
+		{"recovery_target_name", config.TargetName},
+		{"recovery_target_action", config.TargetAction},
+		{"recovery_target_timeline", targetTimeline},
+		{"primary_conninfo", config.PrimaryConnInfo},
+	}
+	lines := make([]string, 0, len(settings))
+	for _, setting := range settings {
+		if setting.value == "" {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s = '%s'", setting.name, strings.Replace(setting.value, "'", "''", -1)))
+	}
+	return lines
+}
+
+// readPgMajorVersion reads major version of data directory, e.g. 9.6 is returned as 9
+func readPgMajorVersion(dbDataDirectory string) (int, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dbDataDirectory, pgVersionFileName))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read Postgres version of fetched backup")
+	}
+	version := strings.SplitN(strings.TrimSpace(string(data)), ".", 2)[0]
+	major, err := strconv.Atoi(version)
+	return major, errors.Wrapf(err, "failed to parse Postgres version '%s'", strings.TrimSpace(string(data)))
+}
+
+// WriteRecoveryConfig writes recovery settings to fetched data directory.
+// Since Postgres 12 settings are appended to postgresql.auto.conf and recovery.signal is created,
+// older versions get recovery.conf.
+func WriteRecoveryConfig(dbDataDirectory string, config RecoveryConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	dbDataDirectory = utility.ResolveSymlink(dbDataDirectory)
+	version, err := readPgMajorVersion(dbDataDirectory)
+	if err != nil {
+		return err
+	}
+	lines := config.lines(version)
+	if config.Standby && version < recoverySignalMinVersion {
+		lines = append(lines, "standby_mode = 'on'")
+	}
+	content := strings.Join(lines, "\n") + "\n"
+
+	if version < recoverySignalMinVersion {
+		path := filepath.Join(dbDataDirectory, recoveryConfName)
+		tracelog.InfoLogger.Printf("Writing recovery configuration to %s\n", path)
+		return errors.Wrap(ioutil.WriteFile(path, []byte(content), 0600), "failed to write recovery configuration")
+	}
+
+	path := filepath.Join(dbDataDirectory, autoConfName)
+	tracelog.InfoLogger.Printf("Appending recovery configuration to %s\n", path)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open postgresql.auto.conf")
+	}
+	_, err = file.WriteString("# recovery settings added by wal-g\n" + content)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to write recovery configuration")
+	}
+	signalName := recoverySignalName
+	if config.Standby {
+		signalName = standbySignalName
+	}
+	return errors.Wrapf(ioutil.WriteFile(filepath.Join(dbDataDirectory, signalName), nil, 0600),
+		"failed to create %s", signalName)
+}
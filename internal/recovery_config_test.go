@@ -0,0 +1,121 @@
+package internal_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func prepareDataDirectory(t *testing.T, version string) string {
+	dir, err := ioutil.TempDir("", "recovery_config")
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "PG_VERSION"), []byte(version+"\n"), 0600)
+	require.NoError(t, err)
+	return dir
+}
+
+func TestWriteRecoveryConfig_RecoveryConf(t *testing.T) {
+	dir := prepareDataDirectory(t, "9.6")
+	defer os.RemoveAll(dir)
+
+	err := internal.WriteRecoveryConfig(dir, internal.RecoveryConfig{TargetTime: "2020-06-01 12:00:00+00"})
+	assert.NoError(t, err)
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "recovery.conf"))
+	assert.NoError(t, err)
+	assert.Equal(t, "restore_command = 'wal-g wal-fetch \"%f\" \"%p\"'\n"+
+		"recovery_target_time = '2020-06-01 12:00:00+00'\n", string(content))
+	_, err = os.Stat(filepath.Join(dir, "recovery.signal"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWriteRecoveryConfig_AutoConf(t *testing.T) {
+	dir := prepareDataDirectory(t, "12")
+	defer os.RemoveAll(dir)
+	err := ioutil.WriteFile(filepath.Join(dir, "postgresql.auto.conf"), []byte("work_mem = '4MB'\n"), 0600)
+	require.NoError(t, err)
+
+	err = internal.WriteRecoveryConfig(dir, internal.RecoveryConfig{
+		RestoreCommand: "cp /archive/%f %p",
+		TargetName:     "before'drop",
+		TargetAction:   "promote",
+	})
+	assert.NoError(t, err)
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "postgresql.auto.conf"))
+	assert.NoError(t, err)
+	assert.Equal(t, "work_mem = '4MB'\n"+
+		"# recovery settings added by wal-g\n"+
+		"restore_command = 'cp /archive/%f %p'\n"+
+		"recovery_target_name = 'before''drop'\n"+
+		"recovery_target_action = 'promote'\n", string(content))
+	_, err = os.Stat(filepath.Join(dir, "recovery.signal"))
+	assert.NoError(t, err)
+}
+
+func TestWriteRecoveryConfig_Standby(t *testing.T) {
+	for _, version := range []string{"11", "12"} {
+		dir := prepareDataDirectory(t, version)
+		defer os.RemoveAll(dir)
+
+		err := internal.WriteRecoveryConfig(dir, internal.RecoveryConfig{Standby: true, PrimaryConnInfo: "host=primary"})
+		assert.NoError(t, err)
+
+		_, err = os.Stat(filepath.Join(dir, "recovery.signal"))
+		assert.True(t, os.IsNotExist(err))
+		if version == "11" {
+			content, err := ioutil.ReadFile(filepath.Join(dir, "recovery.conf"))
+			assert.NoError(t, err)
+			assert.Equal(t, "restore_command = 'wal-g wal-fetch \"%f\" \"%p\"'\n"+
+				"primary_conninfo = 'host=primary'\n"+
+				"standby_mode = 'on'\n", string(content))
+		} else {
+			_, err = os.Stat(filepath.Join(dir, "standby.signal"))
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestWriteRecoveryConfig_MultipleTargets(t *testing.T) {
+	dir := prepareDataDirectory(t, "12")
+	defer os.RemoveAll(dir)
+
+	err := internal.WriteRecoveryConfig(dir, internal.RecoveryConfig{TargetTime: "2020-06-01", TargetLsn: "0/3000000"})
+	assert.IsType(t, internal.MultipleRecoveryTargetsError{}, err)
+}
+
+func TestWriteRecoveryConfig_TargetTimeline(t *testing.T) {
+	for version, expected := range map[string]string{
+		"11": "restore_command = 'wal-g wal-fetch \"%f\" \"%p\"'\n",
+		"12": "# recovery settings added by wal-g\n" +
+			"restore_command = 'wal-g wal-fetch \"%f\" \"%p\"'\n" +
+			"recovery_target_timeline = 'current'\n",
+	} {
+		dir := prepareDataDirectory(t, version)
+		defer os.RemoveAll(dir)
+
+		err := internal.WriteRecoveryConfig(dir, internal.RecoveryConfig{TargetTimeline: "current"})
+		assert.NoError(t, err)
+
+		name := "postgresql.auto.conf"
+		if version == "11" {
+			name = "recovery.conf"
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(content))
+	}
+}
+
+func TestRecoveryConfig_Validate(t *testing.T) {
+	assert.NoError(t, internal.RecoveryConfig{TargetAction: "shutdown", TargetTimeline: "latest"}.Validate())
+	assert.NoError(t, internal.RecoveryConfig{TargetTimeline: "3"}.Validate())
+	assert.IsType(t, internal.InvalidRecoverySettingError{}, internal.RecoveryConfig{TargetAction: "stop"}.Validate())
+	assert.IsType(t, internal.InvalidRecoverySettingError{}, internal.RecoveryConfig{TargetTimeline: "0"}.Validate())
+	assert.IsType(t, internal.InvalidRecoverySettingError{}, internal.RecoveryConfig{TargetTimeline: "newest"}.Validate())
+}
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/internal/crypto/envelope"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// KeyPurgeGracePeriod is the age of data keys which are never purged,
+// so keys of objects being uploaded during the purge are kept.
+const KeyPurgeGracePeriod = 24 * time.Hour
+
+// HandleRekey rewraps data keys of envelope encrypted objects of given type from old to new master key.
+// Encrypted objects are not changed. Keys already wrapped with the new master key are skipped,
+// so the rekey interrupted by an error is finished by running it again.
+func HandleRekey(contentType ContentType, keys envelope.KeyStore, oldMaster, newMaster crypto.Crypter) error {
+	count, err := envelope.RewrapKeys(keys, oldMaster, newMaster)
+	if err != nil {
+		return fmt.Errorf("rekey of %s objects failed, %d data keys are rewrapped: %w", contentType, count, err)
+	}
+	tracelog.InfoLogger.Printf("Data keys of %s objects are rewrapped: %d", contentType, count)
+	return nil
+}
+
+// usedKeysIndexName is the index of data keys used by storage objects. Objects are listed on each collection
+// of used keys, but headers are read only from objects which are not in the index or were changed since indexed.
+const usedKeysIndexName = envelope.KeysPath + "used_keys_index.json"
+
+// usedKeysIndexEntry is the data key id of indexed object, the id is empty if object is not envelope encrypted
+type usedKeysIndexEntry struct {
+	KeyID        string    `json:"key_id,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// CollectUsedKeyIDs reads envelope headers of objects in the storage and returns ids of their data keys.
+// Headers are not read again from objects recorded in the used keys index.
+func CollectUsedKeyIDs(folder storage.Folder) (map[string]bool, error) {
+	objects, err := storage.ListFolderRecursively(folder)
+	if err != nil {
+		return nil, fmt.Errorf("can not list storage objects: %w", err)
+	}
+	index, err := loadUsedKeysIndex(folder)
+	if err != nil {
+		return nil, err
+	}
+	updated := make(map[string]usedKeysIndexEntry, len(objects))
+	used := make(map[string]bool)
+	read := 0
+	for _, object := range objects {
+		if strings.HasPrefix(object.GetName(), envelope.KeysPath) {
+			continue
+		}
+		entry, ok := index[object.GetName()]
+		if !ok || !entry.LastModified.Equal(object.GetLastModified()) {
+			id, _, err := readKeyID(folder, object.GetName())
+			if err != nil {
+				return nil, err
+			}
+			entry = usedKeysIndexEntry{KeyID: id, LastModified: object.GetLastModified()}
+			read++
+		}
+		updated[object.GetName()] = entry
+		if entry.KeyID != "" {
+			used[entry.KeyID] = true
+		}
+	}
+	tracelog.InfoLogger.Printf("Envelope headers are read from %d of %d objects, others are indexed", read, len(updated))
+	if err := storeUsedKeysIndex(folder, updated); err != nil {
+		return nil, err
+	}
+	return used, nil
+}
+
+func loadUsedKeysIndex(folder storage.Folder) (map[string]usedKeysIndexEntry, error) {
+	index := make(map[string]usedKeysIndexEntry)
+	reader, err := folder.ReadObject(usedKeysIndexName)
+	if _, ok := errors.Cause(err).(storage.ObjectNotFoundError); ok {
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can not read used keys index: %w", err)
+	}
+	defer reader.Close()
+	if err := json.NewDecoder(reader).Decode(&index); err != nil {
+		tracelog.WarningLogger.Printf("Used keys index is corrupted, headers of all objects are read: %v", err)
+		return make(map[string]usedKeysIndexEntry), nil
+	}
+	return index, nil
+}
+
+func storeUsedKeysIndex(folder storage.Folder, index map[string]usedKeysIndexEntry) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := folder.PutObject(usedKeysIndexName, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("can not upload used keys index: %w", err)
+	}
+	return nil
+}
+
+// readKeyID reads only the envelope header, the rest of object is not downloaded
+func readKeyID(folder storage.Folder, objectName string) (string, bool, error) {
+	reader, err := folder.ReadObject(objectName)
+	if err != nil {
+		return "", false, fmt.Errorf("can not read object '%s': %w", objectName, err)
+	}
+	defer reader.Close()
+	id, ok, err := envelope.ReadKeyID(reader)
+	if err != nil {
+		return "", false, fmt.Errorf("can not read envelope header of '%s': %w", objectName, err)
+	}
+	return id, ok, nil
+}
+
+// HandlePurgeKeys deletes data keys of given type which are not used by any object and are older than KeyPurgeGracePeriod.
+func HandlePurgeKeys(contentType ContentType, keys envelope.KeyStore, used map[string]bool) error {
+	count, err := envelope.PurgeKeys(keys, used, utility.TimeNowCrossPlatformUTC().Add(-KeyPurgeGracePeriod))
+	if err != nil {
+		return fmt.Errorf("purge of %s data keys failed: %w", contentType, err)
+	}
+	tracelog.InfoLogger.Printf("Unused data keys of %s objects are deleted: %d", contentType, count)
+	return nil
+}
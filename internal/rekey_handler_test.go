@@ -0,0 +1,87 @@
+package internal_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/crypto/envelope"
+	"github.com/wal-g/wal-g/internal/crypto/openpgp"
+)
+
+func TestCollectUsedKeyIDs(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	keys := envelope.NewFolderKeyStore(folder.GetSubFolder(envelope.KeysPath).GetSubFolder("backup"))
+	crypter := envelope.NewCrypter(openpgp.CrypterFromKeyPath(PrivateKeyFilePath, noPassphrase), keys)
+
+	var buf bytes.Buffer
+	writer, err := crypter.Encrypt(&buf)
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte("backup"))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	encrypted := buf.Bytes()
+	assert.NoError(t, folder.PutObject("basebackups_005/base_1/tar_partitions/part_1.tar.lz4", bytes.NewReader(encrypted)))
+	assert.NoError(t, folder.PutObject("basebackups_005/base_1_backup_stop_sentinel.json", bytes.NewReader([]byte("{}"))))
+
+	used, err := internal.CollectUsedKeyIDs(folder)
+	assert.NoError(t, err)
+	id, ok, err := envelope.ReadKeyID(bytes.NewReader(encrypted))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]bool{id: true}, used)
+
+	assert.NoError(t, internal.HandlePurgeKeys(internal.BackupContentType, keys, used))
+	reader, err := crypter.Decrypt(bytes.NewReader(encrypted))
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "backup", string(data))
+}
+
+func TestCollectUsedKeyIDs_ReadsOnlyNotIndexedObjects(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	keys := envelope.NewFolderKeyStore(folder.GetSubFolder(envelope.KeysPath).GetSubFolder("backup"))
+	crypter := envelope.NewCrypter(openpgp.CrypterFromKeyPath(PrivateKeyFilePath, noPassphrase), keys)
+	encrypt := func(data string) []byte {
+		var buf bytes.Buffer
+		writer, err := crypter.Encrypt(&buf)
+		assert.NoError(t, err)
+		_, err = writer.Write([]byte(data))
+		assert.NoError(t, err)
+		assert.NoError(t, writer.Close())
+		return buf.Bytes()
+	}
+	assert.NoError(t, folder.PutObject("wal_005/000000010000000000000001.lz4", bytes.NewReader(encrypt("wal"))))
+	used, err := internal.CollectUsedKeyIDs(folder)
+	assert.NoError(t, err)
+	assert.Len(t, used, 1)
+
+	// indexed objects are not read again, so the unreadable object would fail the collection otherwise
+	readFailing := &readFailingFolder{Folder: folder, failing: "wal_005/000000010000000000000001.lz4"}
+	assert.NoError(t, folder.PutObject("wal_005/000000010000000000000002.lz4", bytes.NewReader(encrypt("wal"))))
+	indexedUsed, err := internal.CollectUsedKeyIDs(readFailing)
+	assert.NoError(t, err)
+	assert.Len(t, indexedUsed, 2)
+	for id := range used {
+		assert.True(t, indexedUsed[id])
+	}
+}
+
+type readFailingFolder struct {
+	storage.Folder
+	failing string
+}
+
+func (folder *readFailingFolder) ReadObject(objectRelativePath string) (io.ReadCloser, error) {
+	if objectRelativePath == folder.failing {
+		return nil, errors.New("object is not expected to be read")
+	}
+	return folder.Folder.ReadObject(objectRelativePath)
+}
@@ -0,0 +1,371 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgproto3"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/utility"
+)
+
+var (
+	backupLabelStartRegexp    = regexp.MustCompile(`START WAL LOCATION: ([0-9A-F]+/[0-9A-F]+) \(file ([0-9A-F]{24})\)`)
+	backupLabelTimelineRegexp = regexp.MustCompile(`START TIMELINE: (\d+)`)
+	backupLabelTimeRegexp     = regexp.MustCompile(`START TIME: (.+)`)
+)
+
+const backupLabelTimeFormat = "2006-01-02 15:04:05 MST"
+
+type UnsupportedRemoteBackupError struct {
+	error
+}
+
+func newUnsupportedRemoteBackupError(reason string) UnsupportedRemoteBackupError {
+	return UnsupportedRemoteBackupError{errors.Errorf("Remote backup is not possible: %s", reason)}
+}
+
+func (err UnsupportedRemoteBackupError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+type InvalidBaseBackupStreamError struct {
+	error
+}
+
+func newInvalidBaseBackupStreamError(reason string) InvalidBaseBackupStreamError {
+	return InvalidBaseBackupStreamError{errors.Errorf("Invalid base backup stream: %s", reason)}
+}
+
+func (err InvalidBaseBackupStreamError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// RemoteBackupInfo describes the base backup taken with BASE_BACKUP command of the replication protocol
+type RemoteBackupInfo struct {
+	Name             string
+	StartLSN         uint64
+	Timeline         uint32
+	StartTime        time.Time
+	PgVersion        int
+	SystemIdentifier *uint64
+	Files            BackupFileList
+	UncompressedSize int64
+	// WalFiles are names of WAL segments included into the backup, e.g. by pg_basebackup -X fetch
+	WalFiles []string
+}
+
+// TODO : unit tests
+// HandleRemoteBackupPush is invoked to perform wal-g backup-push --remote.
+// The base backup is taken with BASE_BACKUP command over the replication protocol,
+// so no access to the data directory is needed. Remote backups are always full.
+func HandleRemoteBackupPush(uploader *WalUploader, isPermanent bool) {
+	folder := uploader.UploadingFolder
+	uploader.UploadingFolder = folder.GetSubFolder(utility.BaseBackupPath)
+	crypter := ConfigureCrypterForContentType(BackupContentType)
+
+	var meta ExtendedMetadataDto
+	meta.StartTime = utility.TimeNowCrossPlatformUTC()
+	meta.Hostname, _ = os.Hostname()
+	meta.IsPermanent = isPermanent
+
+	conn, err := Connect()
+	tracelog.ErrorLogger.FatalOnError(err)
+	defer utility.LoggedClose(conn, "")
+	queryRunner, err := newPgQueryRunner(conn)
+	tracelog.ErrorLogger.FatalOnError(err)
+	tablespaceOids, err := queryRunner.getTablespaceOids()
+	tracelog.ErrorLogger.FatalOnError(err)
+	// pg_default and pg_global always exist, other tablespaces are sent in separate tar streams
+	if len(tablespaceOids) > 2 {
+		tracelog.ErrorLogger.FatalError(newUnsupportedRemoteBackupError("cluster has tablespaces"))
+	}
+	dataChecksums, err := queryRunner.getDataChecksums()
+	if err != nil {
+		tracelog.WarningLogger.Printf("Couldn't check if data checksums are enabled because of error: '%v'\n", err)
+	}
+	databaseOids, err := queryRunner.getDatabaseOids()
+	if err != nil {
+		tracelog.WarningLogger.Printf("Couldn't get database oids because of error: '%v'\n", err)
+	}
+
+	replicationConn, replicationNetConn, err := connectReplicationWithNetConn()
+	tracelog.ErrorLogger.FatalOnError(err)
+	defer utility.LoggedClose(replicationConn, "")
+	label := utility.CeilTimeUpToMicroseconds(time.Now()).String()
+	stream, streamWriter := io.Pipe()
+	finishLsns := make(chan uint64, 1)
+	go func() {
+		tracelog.InfoLogger.Println("Calling BASE_BACKUP")
+		finishLsn, err := runBaseBackup(replicationNetConn, fmt.Sprintf("BASE_BACKUP LABEL '%s' FAST", label), streamWriter)
+		_ = streamWriter.CloseWithError(err)
+		finishLsns <- finishLsn
+	}()
+
+	makeTarBallMaker := func(backupName string) (TarBallMaker, error) {
+		if err := CheckBackupIsNew(uploader.UploadingFolder, backupName); err != nil {
+			return nil, err
+		}
+		return NewStorageTarBallMaker(backupName, uploader.Uploader), nil
+	}
+	info, err := RepackBaseBackupStream(stream, makeTarBallMaker, crypter,
+		viper.GetInt64(TarSizeThresholdSetting), uploader.Compressor.FileExtension())
+	_ = stream.CloseWithError(err)
+	tracelog.ErrorLogger.FatalOnError(err)
+	// the stream is read till the end, so BASE_BACKUP has returned the stop backup LSN
+	finishLsn := <-finishLsns
+
+	uploader.finish()
+	if uploader.Failed.Load().(bool) {
+		tracelog.ErrorLogger.Fatalf("Uploading failed during '%s' backup.\n", info.Name)
+	}
+
+	sentinelDto := &BackupSentinelDto{
+		BackupStartLSN:   &info.StartLSN,
+		BackupFinishLSN:  &finishLsn,
+		PgVersion:        queryRunner.Version,
+		Files:            info.Files,
+		UserData:         GetSentinelUserData(),
+		SystemIdentifier: queryRunner.SystemIdentifier,
+		DataChecksums:    dataChecksums,
+		DatabaseOids:     databaseOids,
+		TablespaceOids:   tablespaceOids,
+		UncompressedSize: info.UncompressedSize,
+		CompressedSize:   atomic.LoadInt64(uploader.tarSize),
+	}
+	err = uploadMetadata(uploader.Uploader, sentinelDto, info.Name, meta)
+	if err != nil {
+		tracelog.ErrorLogger.Printf("Failed to upload metadata file for backup: %s %v", info.Name, err)
+		tracelog.ErrorLogger.FatalError(err)
+	}
+	err = UploadSentinel(uploader.Uploader, sentinelDto, info.Name)
+	if err != nil {
+		tracelog.ErrorLogger.Printf("Failed to upload sentinel file for backup: %s", info.Name)
+		tracelog.ErrorLogger.FatalError(err)
+	}
+	tracelog.InfoLogger.Println("Wrote backup with name " + info.Name)
+}
+
+// runBaseBackup runs BASE_BACKUP over the replication connection and writes the tar stream
+// of the base tablespace to tarStream. It returns the LSN where the backup stopped,
+// which is sent in the last result set, after the tar stream.
+func runBaseBackup(conn io.ReadWriter, query string, tarStream io.Writer) (uint64, error) {
+	frontend, err := pgproto3.NewFrontend(conn, conn)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = conn.Write((&pgproto3.Query{String: query}).Encode(nil)); err != nil {
+		return 0, errors.Wrap(err, "failed to send BASE_BACKUP")
+	}
+	copyStreams := 0
+	var finishLsn string
+	for {
+		message, err := frontend.Receive()
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to read BASE_BACKUP result")
+		}
+		switch message := message.(type) {
+		case *pgproto3.CopyOutResponse:
+			copyStreams++
+			if copyStreams > 1 {
+				return 0, newUnsupportedRemoteBackupError("BASE_BACKUP sent more than one tar stream")
+			}
+		case *pgproto3.CopyData:
+			if _, err = tarStream.Write(message.Data); err != nil {
+				return 0, err
+			}
+		case *pgproto3.DataRow:
+			// rows of the last result set, sent after the tar stream, hold the stop backup LSN and timeline
+			if copyStreams > 0 && len(message.Values) > 0 {
+				finishLsn = string(message.Values[0])
+			}
+		case *pgproto3.ErrorResponse:
+			return 0, errors.Errorf("BASE_BACKUP failed: %s (SQLSTATE %s)", message.Message, message.Code)
+		case *pgproto3.ReadyForQuery:
+			if finishLsn == "" {
+				return 0, newInvalidBaseBackupStreamError("BASE_BACKUP has not returned the stop backup LSN")
+			}
+			return pgx.ParseLSN(finishLsn)
+		}
+	}
+}
+
+// RepackBaseBackupStream reads tar stream of the base tablespace sent by BASE_BACKUP and packs its files
+// into tarballs of at most tarSizeThreshold bytes. backup_label is the first file of the stream,
+// the backup is named by its start WAL file. pg_control is packed into a separate tarball after all other files.
+func RepackBaseBackupStream(stream io.Reader, makeTarBallMaker func(backupName string) (TarBallMaker, error),
+	crypter crypto.Crypter, tarSizeThreshold int64, compressorFileExtension string) (*RemoteBackupInfo, error) {
+	tarReader := tar.NewReader(stream)
+	labelHeader, err := tarReader.Next()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the first file of base backup")
+	}
+	if labelHeader.Name != BackupLabelFilename {
+		return nil, newInvalidBaseBackupStreamError(fmt.Sprintf("expected %s, got '%s'", BackupLabelFilename, labelHeader.Name))
+	}
+	label, err := ioutil.ReadAll(tarReader)
+	if err != nil {
+		return nil, err
+	}
+	info, err := parseBackupLabel(string(label))
+	if err != nil {
+		return nil, err
+	}
+	tarBallMaker, err := makeTarBallMaker(info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	tarBall := tarBallMaker.Make(false)
+	tarBall.SetUp(crypter)
+	_, err = PackFileTo(tarBall, labelHeader, bytes.NewReader(label))
+	if err != nil {
+		return nil, err
+	}
+	var pgControlHeader *tar.Header
+	var pgControl []byte
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read base backup")
+		}
+		if header.Name != TablespaceMapFilename {
+			header.Name = utility.PathSeparator + header.Name
+		}
+		if header.Name == PgControlPath {
+			pgControlHeader = header
+			if pgControl, err = ioutil.ReadAll(tarReader); err != nil {
+				return nil, err
+			}
+			info.SystemIdentifier = parseSystemIdentifier(pgControl)
+			continue
+		}
+		var fileReader io.Reader = tarReader
+		if header.Name == utility.PathSeparator+pgVersionFileName {
+			pgVersion, err := ioutil.ReadAll(tarReader)
+			if err != nil {
+				return nil, err
+			}
+			if info.PgVersion, err = parsePgVersion(string(pgVersion)); err != nil {
+				return nil, err
+			}
+			fileReader = bytes.NewReader(pgVersion)
+		}
+		if walDirectory := path.Dir(header.Name); (walDirectory == "/pg_wal" || walDirectory == "/pg_xlog") &&
+			isWalFilename(path.Base(header.Name)) {
+			info.WalFiles = append(info.WalFiles, path.Base(header.Name))
+		}
+		if tarBall.Size() > tarSizeThreshold {
+			if err = tarBall.CloseTar(); err != nil {
+				return nil, err
+			}
+			tarBall = tarBallMaker.Make(false)
+			tarBall.SetUp(crypter)
+		}
+		if _, err = PackFileTo(tarBall, header, fileReader); err != nil {
+			return nil, err
+		}
+		info.UncompressedSize += header.Size
+		if header.Typeflag == tar.TypeReg && header.Name != TablespaceMapFilename {
+			info.Files[header.Name] = BackupFileDescription{MTime: header.ModTime}
+		}
+	}
+	// the rest of the stream is read, so errors of BASE_BACKUP are not missed
+	if _, err = io.Copy(ioutil.Discard, stream); err != nil {
+		return nil, errors.Wrap(err, "failed to read base backup")
+	}
+	if err = tarBall.CloseTar(); err != nil {
+		return nil, err
+	}
+	if pgControlHeader == nil {
+		return nil, newInvalidBaseBackupStreamError("pg_control is not found")
+	}
+
+	// pg_control is uploaded after the rest of the backup, like in backups of local data directory
+	tarBall.AwaitUploads()
+	tarBall = tarBallMaker.Make(false)
+	tarBall.SetUp(crypter, "pg_control.tar."+compressorFileExtension)
+	if _, err = PackFileTo(tarBall, pgControlHeader, bytes.NewReader(pgControl)); err != nil {
+		return nil, err
+	}
+	info.UncompressedSize += pgControlHeader.Size + labelHeader.Size
+	return info, tarBall.CloseTar()
+}
+
+// parseBackupLabel reads start WAL location and timeline from backup_label
+func parseBackupLabel(label string) (*RemoteBackupInfo, error) {
+	startMatch := backupLabelStartRegexp.FindStringSubmatch(label)
+	if startMatch == nil {
+		return nil, newInvalidBaseBackupStreamError("backup_label has no start WAL location")
+	}
+	startLSN, err := pgx.ParseLSN(startMatch[1])
+	if err != nil {
+		return nil, err
+	}
+	timeline, _, err := ParseWALFilename(startMatch[2])
+	if err != nil {
+		return nil, err
+	}
+	if timelineMatch := backupLabelTimelineRegexp.FindStringSubmatch(label); timelineMatch != nil {
+		labelTimeline, err := strconv.ParseUint(timelineMatch[1], 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		timeline = uint32(labelTimeline)
+	}
+	var startTime time.Time
+	if timeMatch := backupLabelTimeRegexp.FindStringSubmatch(label); timeMatch != nil {
+		startTime, _ = time.Parse(backupLabelTimeFormat, strings.TrimSpace(timeMatch[1]))
+	}
+	return &RemoteBackupInfo{
+		Name:      utility.BackupNamePrefix + startMatch[2],
+		StartLSN:  startLSN,
+		Timeline:  timeline,
+		StartTime: startTime.UTC(),
+		Files:     make(BackupFileList),
+	}, nil
+}
+
+// parsePgVersion converts content of PG_VERSION to the number returned by server_version_num, e.g. 9.6 to 90600
+func parsePgVersion(content string) (int, error) {
+	parts := strings.SplitN(strings.TrimSpace(content), ".", 2)
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse Postgres version '%s'", strings.TrimSpace(content))
+	}
+	if len(parts) == 1 {
+		return major * 10000, nil
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse Postgres version '%s'", strings.TrimSpace(content))
+	}
+	return major*10000 + minor*100, nil
+}
+
+// parseSystemIdentifier reads system identifier, the first field of pg_control
+func parseSystemIdentifier(pgControl []byte) *uint64 {
+	if len(pgControl) < 8 {
+		return nil
+	}
+	systemIdentifier := binary.LittleEndian.Uint64(pgControl)
+	return &systemIdentifier
+}
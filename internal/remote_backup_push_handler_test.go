@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/pgproto3"
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/crypto"
+)
+
+type memoryTarBall struct {
+	name   string
+	size   int64
+	buffer bytes.Buffer
+	writer *tar.Writer
+}
+
+func (tarBall *memoryTarBall) SetUp(crypter crypto.Crypter, args ...string) {
+	if len(args) > 0 {
+		tarBall.name = args[0]
+	}
+	tarBall.writer = tar.NewWriter(&tarBall.buffer)
+}
+func (tarBall *memoryTarBall) CloseTar() error        { return tarBall.writer.Close() }
+func (tarBall *memoryTarBall) Size() int64            { return tarBall.size }
+func (tarBall *memoryTarBall) AddSize(size int64)     { tarBall.size += size }
+func (tarBall *memoryTarBall) TarWriter() *tar.Writer { return tarBall.writer }
+func (tarBall *memoryTarBall) AwaitUploads()          {}
+func (tarBall *memoryTarBall) Name() string           { return tarBall.name }
+
+type memoryTarBallMaker struct {
+	tarBalls []*memoryTarBall
+}
+
+func (maker *memoryTarBallMaker) Make(dedicatedUploader bool) TarBall {
+	tarBall := &memoryTarBall{}
+	maker.tarBalls = append(maker.tarBalls, tarBall)
+	return tarBall
+}
+
+func readTarNames(t *testing.T, data []byte) []string {
+	names := make([]string, 0)
+	reader := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := reader.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, header.Name)
+	}
+	return names
+}
+
+func TestRepackBaseBackupStream(t *testing.T) {
+	var stream bytes.Buffer
+	writer := tar.NewWriter(&stream)
+	files := []struct {
+		name    string
+		content string
+	}{
+		{BackupLabelFilename, "START WAL LOCATION: 0/2000028 (file 000000010000000000000002)\n" +
+			"CHECKPOINT LOCATION: 0/2000060\nSTART TIMELINE: 1\n"},
+		{"base/1/1259", "relation"},
+		{"global/pg_control", "control"},
+		{"base/1/1249", "another relation"},
+	}
+	for _, file := range files {
+		assert.NoError(t, writer.WriteHeader(&tar.Header{Name: file.name, Mode: 0600,
+			Size: int64(len(file.content)), Typeflag: tar.TypeReg, ModTime: time.Unix(1, 0)}))
+		_, err := writer.Write([]byte(file.content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, writer.Close())
+
+	maker := &memoryTarBallMaker{}
+	var madeFor string
+	info, err := RepackBaseBackupStream(&stream, func(backupName string) (TarBallMaker, error) {
+		madeFor = backupName
+		return maker, nil
+	}, nil, 1, "lz4")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "base_000000010000000000000002", info.Name)
+	assert.Equal(t, info.Name, madeFor)
+	assert.Equal(t, uint64(0x2000028), info.StartLSN)
+	assert.Equal(t, uint32(1), info.Timeline)
+	assert.Equal(t, BackupFileList{
+		"/base/1/1259": BackupFileDescription{MTime: time.Unix(1, 0)},
+		"/base/1/1249": BackupFileDescription{MTime: time.Unix(1, 0)},
+	}, info.Files)
+
+	// tarballs are switched after exceeding size threshold, pg_control is packed last
+	assert.Len(t, maker.tarBalls, 4)
+	assert.Equal(t, []string{BackupLabelFilename}, readTarNames(t, maker.tarBalls[0].buffer.Bytes()))
+	assert.Equal(t, []string{"/base/1/1259"}, readTarNames(t, maker.tarBalls[1].buffer.Bytes()))
+	assert.Equal(t, []string{"/base/1/1249"}, readTarNames(t, maker.tarBalls[2].buffer.Bytes()))
+	assert.Equal(t, "pg_control.tar.lz4", maker.tarBalls[3].name)
+	assert.Equal(t, []string{PgControlPath}, readTarNames(t, maker.tarBalls[3].buffer.Bytes()))
+}
+
+func TestParseBackupLabelWithoutStartLocation(t *testing.T) {
+	_, err := parseBackupLabel("CHECKPOINT LOCATION: 0/2000060\n")
+	assert.IsType(t, InvalidBaseBackupStreamError{}, err)
+}
+
+type replicationConnMock struct {
+	io.Reader
+	sent bytes.Buffer
+}
+
+func (conn *replicationConnMock) Write(p []byte) (int, error) {
+	return conn.sent.Write(p)
+}
+
+func encodeBackendMessages(messages ...interface{ Encode([]byte) []byte }) []byte {
+	var data []byte
+	for _, message := range messages {
+		data = message.Encode(data)
+	}
+	return data
+}
+
+func TestRunBaseBackup_ReturnsStopBackupLsn(t *testing.T) {
+	lsnFields := []pgproto3.FieldDescription{{Name: "recptr", DataTypeOID: 25}, {Name: "tli", DataTypeOID: 20}}
+	conn := &replicationConnMock{Reader: bytes.NewReader(encodeBackendMessages(
+		&pgproto3.RowDescription{Fields: lsnFields},
+		&pgproto3.DataRow{Values: [][]byte{[]byte("0/2000028"), []byte("1")}},
+		&pgproto3.CommandComplete{CommandTag: "SELECT"},
+		&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{{Name: "spcoid"}, {Name: "spclocation"}, {Name: "size"}}},
+		&pgproto3.DataRow{Values: [][]byte{nil, nil, nil}},
+		&pgproto3.CommandComplete{CommandTag: "SELECT"},
+		&pgproto3.CopyOutResponse{},
+		&pgproto3.CopyData{Data: []byte("tar ")},
+		&pgproto3.CopyData{Data: []byte("stream")},
+		&pgproto3.CopyDone{},
+		&pgproto3.RowDescription{Fields: lsnFields},
+		&pgproto3.DataRow{Values: [][]byte{[]byte("0/20000F8"), []byte("1")}},
+		&pgproto3.CommandComplete{CommandTag: "SELECT"},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	))}
+	var tarStream bytes.Buffer
+
+	finishLsn, err := runBaseBackup(conn, "BASE_BACKUP", &tarStream)
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0x20000F8), finishLsn)
+	assert.Equal(t, "tar stream", tarStream.String())
+	assert.Equal(t, (&pgproto3.Query{String: "BASE_BACKUP"}).Encode(nil), conn.sent.Bytes())
+}
+
+func TestRunBaseBackup_ReturnsServerError(t *testing.T) {
+	conn := &replicationConnMock{Reader: bytes.NewReader(encodeBackendMessages(
+		&pgproto3.ErrorResponse{Severity: "ERROR", Code: "55000", Message: "WAL level not sufficient"},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	))}
+
+	_, err := runBaseBackup(conn, "BASE_BACKUP", &bytes.Buffer{})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "WAL level not sufficient")
+}
@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	// objects with smaller oids are created by initdb, their files are always restored
+	firstNormalObjectOid = 16384
+	// oid of pg_default tablespace, its relations are stored in base directory
+	defaultTablespaceOid = 1663
+)
+
+// relationFileRegexp matches relation segment files, their free space and visibility maps and init forks
+var relationFileRegexp = regexp.MustCompile(`^\d+(_(fsm|vm|init))?(\.\d+)?$`)
+
+type UnknownRestoreOnlyNameError struct {
+	error
+}
+
+func newUnknownRestoreOnlyNameError(name string) UnknownRestoreOnlyNameError {
+	return UnknownRestoreOnlyNameError{errors.Errorf("Database or tablespace '%s' is not found in backup", name)}
+}
+
+func (err UnknownRestoreOnlyNameError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+type PartialRestoreUnsupportedError struct {
+	error
+}
+
+func newPartialRestoreUnsupportedError(reason string) PartialRestoreUnsupportedError {
+	return PartialRestoreUnsupportedError{errors.Errorf("Partial restore of backup is not possible: %s", reason)}
+}
+
+func (err PartialRestoreUnsupportedError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// restoreOnlyFilter decides which relation files belong to selected databases and tablespaces
+type restoreOnlyFilter struct {
+	databases   map[uint32]bool
+	tablespaces map[uint32]bool
+}
+
+func newRestoreOnlyFilter(sentinelDto BackupSentinelDto, names []string) (*restoreOnlyFilter, error) {
+	if len(sentinelDto.DatabaseOids) == 0 {
+		return nil, newPartialRestoreUnsupportedError("backup has no database oids, it was made by an older WAL-G")
+	}
+	filter := &restoreOnlyFilter{make(map[uint32]bool), make(map[uint32]bool)}
+	for _, name := range names {
+		if oid, ok := sentinelDto.DatabaseOids[name]; ok {
+			filter.databases[oid] = true
+		} else if oid, ok := sentinelDto.TablespaceOids[name]; ok {
+			filter.tablespaces[oid] = true
+		} else {
+			return nil, newUnknownRestoreOnlyNameError(name)
+		}
+	}
+	return filter, nil
+}
+
+// shouldRestore checks if the file should be restored. Only relation files of databases created by user
+// can be left out, other files are needed to start the cluster.
+func (filter *restoreOnlyFilter) shouldRestore(filePath string) bool {
+	tablespaceOid, databaseOid, isRelation := parseRelationPath(filePath)
+	return !isRelation || databaseOid < firstNormalObjectOid ||
+		filter.databases[databaseOid] || filter.tablespaces[tablespaceOid]
+}
+
+// parseRelationPath parses path of file in backup, which is either base/<database>/<relation>
+// or pg_tblspc/<tablespace>/<version directory>/<database>/<relation>
+func parseRelationPath(filePath string) (tablespaceOid, databaseOid uint32, isRelation bool) {
+	parts := strings.Split(strings.TrimPrefix(filePath, utility.PathSeparator), utility.PathSeparator)
+	var databasePart string
+	switch {
+	case len(parts) == 3 && parts[0] == DefaultTablespace:
+		tablespaceOid, databasePart = defaultTablespaceOid, parts[1]
+	case len(parts) == 5 && parts[0] == TablespaceFolder:
+		oid, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return 0, 0, false
+		}
+		tablespaceOid, databasePart = uint32(oid), parts[3]
+	default:
+		return 0, 0, false
+	}
+	if !relationFileRegexp.MatchString(parts[len(parts)-1]) {
+		return 0, 0, false
+	}
+	oid, err := strconv.ParseUint(databasePart, 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	return tablespaceOid, uint32(oid), true
+}
+
+// selectRestoreOnlyFiles leaves in filesToUnwrap only files of selected databases and tablespaces.
+// Relation files of other databases are returned to be replaced by empty stubs.
+func selectRestoreOnlyFiles(backup *Backup, restoreOnly []string,
+	filesToUnwrap map[string]bool) (selected map[string]bool, stubs []string, err error) {
+	if len(restoreOnly) == 0 {
+		return filesToUnwrap, nil, nil
+	}
+	if filesToUnwrap == nil {
+		return nil, nil, newPartialRestoreUnsupportedError("backup has no list of files")
+	}
+	sentinelDto, err := backup.GetSentinel()
+	if err != nil {
+		return nil, nil, err
+	}
+	filter, err := newRestoreOnlyFilter(sentinelDto, restoreOnly)
+	if err != nil {
+		return nil, nil, err
+	}
+	selected = make(map[string]bool, len(filesToUnwrap))
+	for file := range filesToUnwrap {
+		if filter.shouldRestore(file) {
+			selected[file] = true
+		} else {
+			stubs = append(stubs, file)
+		}
+	}
+	tracelog.InfoLogger.Printf("Partial restore: %d relation files of other databases are replaced by empty stubs\n",
+		len(stubs))
+	return selected, stubs, nil
+}
+
+// createEmptyStubs creates empty files in place of relation files which were not restored
+func createEmptyStubs(dbDataDirectory string, stubs []string) error {
+	for _, stub := range stubs {
+		targetPath := path.Join(dbDataDirectory, stub)
+		if err := PrepareDirs(stub, targetPath); err != nil {
+			return errors.Wrapf(err, "failed to create directories for stub '%s'", targetPath)
+		}
+		file, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create stub '%s'", targetPath)
+		}
+		utility.LoggedClose(file, "")
+	}
+	return nil
+}
+
+// restoreWalDirectory creates pg_wal with archive_status, since WAL is never included into backups
+// and pg_wal is missing in backups of clusters where it is a symlink. Segments needed to reach consistency
+// are fetched by restore_command during recovery.
+func restoreWalDirectory(dbDataDirectory string) error {
+	walDirectory, err := getWalDirectory(dbDataDirectory)
+	if err != nil {
+		// PG_VERSION is not restored, e.g. with --mask, so WAL directory name is unknown
+		tracelog.WarningLogger.Printf("WAL directory is not created: %v\n", err)
+		return nil
+	}
+	if _, err = os.Lstat(walDirectory); os.IsNotExist(err) {
+		tracelog.InfoLogger.Printf("Creating WAL directory %s\n", walDirectory)
+	}
+	return os.MkdirAll(path.Join(walDirectory, archiveStatusDir), 0700)
+}
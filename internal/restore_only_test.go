@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRelationPath(t *testing.T) {
+	tablespaceOid, databaseOid, isRelation := parseRelationPath("/base/16390/16400.1")
+	assert.True(t, isRelation)
+	assert.Equal(t, uint32(defaultTablespaceOid), tablespaceOid)
+	assert.Equal(t, uint32(16390), databaseOid)
+
+	tablespaceOid, databaseOid, isRelation = parseRelationPath("/pg_tblspc/16385/PG_12_201909212/16390/16400_vm")
+	assert.True(t, isRelation)
+	assert.Equal(t, uint32(16385), tablespaceOid)
+	assert.Equal(t, uint32(16390), databaseOid)
+
+	for _, filePath := range []string{"/base/16390/PG_VERSION", "/base/16390/pg_filenode.map", "/global/1262", "/pg_xact/0000"} {
+		_, _, isRelation = parseRelationPath(filePath)
+		assert.False(t, isRelation, filePath)
+	}
+}
+
+func TestRestoreOnlyFilter(t *testing.T) {
+	sentinelDto := BackupSentinelDto{
+		DatabaseOids:   map[string]uint32{"postgres": 13000, "db1": 16390, "db2": 16391},
+		TablespaceOids: map[string]uint32{"pg_default": 1663, "space1": 16385},
+	}
+	filter, err := newRestoreOnlyFilter(sentinelDto, []string{"db1", "space1"})
+	assert.NoError(t, err)
+
+	assert.True(t, filter.shouldRestore("/base/16390/16400"))
+	assert.True(t, filter.shouldRestore("/base/13000/1259"))
+	assert.True(t, filter.shouldRestore("/base/16391/PG_VERSION"))
+	assert.True(t, filter.shouldRestore("/pg_tblspc/16385/PG_12_201909212/16391/16500"))
+	assert.True(t, filter.shouldRestore("/global/pg_control"))
+	assert.False(t, filter.shouldRestore("/base/16391/16400"))
+	assert.False(t, filter.shouldRestore("/base/16391/16400_fsm"))
+
+	_, err = newRestoreOnlyFilter(sentinelDto, []string{"unknown"})
+	assert.IsType(t, UnknownRestoreOnlyNameError{}, err)
+
+	_, err = newRestoreOnlyFilter(BackupSentinelDto{}, []string{"db1"})
+	assert.IsType(t, PartialRestoreUnsupportedError{}, err)
+}
+
+func TestRestoreWalDirectory(t *testing.T) {
+	for version, walDirectory := range map[string]string{"9.6": "pg_xlog", "12": "pg_wal"} {
+		dir, err := ioutil.TempDir("", "restore_wal_directory")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "PG_VERSION"), []byte(version+"\n"), 0600))
+
+		assert.NoError(t, restoreWalDirectory(dir))
+		info, err := os.Stat(filepath.Join(dir, walDirectory, "archive_status"))
+		assert.NoError(t, err)
+		assert.True(t, info.IsDir())
+	}
+}
+
+func TestRestoreWalDirectory_UnknownVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "restore_wal_directory")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, restoreWalDirectory(dir))
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
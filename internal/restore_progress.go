@@ -0,0 +1,251 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/ioextensions"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// DefaultTablespaceName is the key of files of the data directory in BackupSentinelDto.TablespaceSizes
+const DefaultTablespaceName = "pg_default"
+
+// getFileTablespace returns oid of the tablespace of the backup file, or pg_default for files of the data directory
+func getFileTablespace(fileRelPath string) string {
+	tablespacePath := utility.PathSeparator + TablespaceFolder + utility.PathSeparator
+	if !strings.HasPrefix(fileRelPath, tablespacePath) {
+		return DefaultTablespaceName
+	}
+	oid := strings.TrimPrefix(fileRelPath, tablespacePath)
+	if separator := strings.Index(oid, utility.PathSeparator); separator >= 0 {
+		oid = oid[:separator]
+	}
+	return oid
+}
+
+// RestoreProgressReport is the state of backup extraction reported periodically by backup-fetch
+type RestoreProgressReport struct {
+	Backup          string  `json:"backup"`
+	DownloadedBytes int64   `json:"downloaded_bytes"`
+	DownloadSize    int64   `json:"download_size"`
+	ExtractedBytes  int64   `json:"extracted_bytes"`
+	ExtractSize     int64   `json:"extract_size"`
+	Percent         float64 `json:"percent"`
+	// Tablespaces are percentages of extracted bytes of tablespaces by their names
+	Tablespaces    map[string]float64 `json:"tablespaces,omitempty"`
+	ElapsedSeconds int64              `json:"elapsed_seconds"`
+	EtaSeconds     *int64             `json:"eta_seconds,omitempty"`
+	Done           bool               `json:"done"`
+}
+
+// restoreProgress counts downloaded and extracted bytes of a backup and reports them every interval
+type restoreProgress struct {
+	backupName       string
+	downloadSize     int64
+	extractSize      int64
+	tablespaceSizes  map[string]int64
+	tablespaceNames  map[string]string
+	interval         time.Duration
+	asJSON           bool
+	output           io.Writer
+	startTime        time.Time
+	downloadedBytes  int64
+	extractedBytes   int64
+	tablespaceMutex  sync.Mutex
+	tablespaceBytes  map[string]int64
+	stop             chan struct{}
+	stopOnce         sync.Once
+	reporterFinished chan struct{}
+}
+
+// newRestoreProgress returns nil if progress reporting is disabled by WALG_RESTORE_PROGRESS_INTERVAL
+func newRestoreProgress(backupName string, sentinelDto BackupSentinelDto) *restoreProgress {
+	interval, err := GetDurationSetting(RestoreProgressSetting)
+	if err != nil {
+		tracelog.WarningLogger.Printf("Restore progress is not reported: %v\n", err)
+		return nil
+	}
+	if interval <= 0 {
+		return nil
+	}
+	tablespaceNames := make(map[string]string)
+	for name, oid := range sentinelDto.TablespaceOids {
+		tablespaceNames[strconv.FormatUint(uint64(oid), 10)] = name
+	}
+	return &restoreProgress{
+		backupName:       backupName,
+		downloadSize:     sentinelDto.CompressedSize,
+		extractSize:      sentinelDto.UncompressedSize,
+		tablespaceSizes:  sentinelDto.TablespaceSizes,
+		tablespaceNames:  tablespaceNames,
+		interval:         interval,
+		asJSON:           viper.GetBool(RestoreProgressJSONSetting),
+		output:           os.Stderr,
+		tablespaceBytes:  make(map[string]int64),
+		stop:             make(chan struct{}),
+		reporterFinished: make(chan struct{}),
+	}
+}
+
+func (progress *restoreProgress) start() {
+	progress.startTime = time.Now()
+	go func() {
+		defer close(progress.reporterFinished)
+		ticker := time.NewTicker(progress.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				progress.print(progress.report(time.Now(), false))
+			case <-progress.stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopReporting stops periodic reporting, it may be called several times
+func (progress *restoreProgress) stopReporting() {
+	progress.stopOnce.Do(func() {
+		close(progress.stop)
+		<-progress.reporterFinished
+	})
+}
+
+// finish stops periodic reporting and prints the final report of the complete extraction
+func (progress *restoreProgress) finish() {
+	progress.stopReporting()
+	progress.print(progress.report(time.Now(), true))
+}
+
+// wrapReaderMakers counts bytes downloaded by readers of the tars
+func (progress *restoreProgress) wrapReaderMakers(readerMakers []ReaderMaker) []ReaderMaker {
+	wrapped := make([]ReaderMaker, 0, len(readerMakers))
+	for _, readerMaker := range readerMakers {
+		wrapped = append(wrapped, &countingReaderMaker{readerMaker, &progress.downloadedBytes})
+	}
+	return wrapped
+}
+
+func (progress *restoreProgress) addExtracted(fileRelPath string, size int64) {
+	atomic.AddInt64(&progress.extractedBytes, size)
+	tablespace := getFileTablespace(fileRelPath)
+	progress.tablespaceMutex.Lock()
+	progress.tablespaceBytes[tablespace] += size
+	progress.tablespaceMutex.Unlock()
+}
+
+func (progress *restoreProgress) report(now time.Time, done bool) RestoreProgressReport {
+	report := RestoreProgressReport{
+		Backup:          progress.backupName,
+		DownloadedBytes: atomic.LoadInt64(&progress.downloadedBytes),
+		DownloadSize:    progress.downloadSize,
+		ExtractedBytes:  atomic.LoadInt64(&progress.extractedBytes),
+		ExtractSize:     progress.extractSize,
+		ElapsedSeconds:  int64(now.Sub(progress.startTime).Seconds()),
+		Done:            done,
+	}
+	report.Percent = getPercent(report.ExtractedBytes, report.ExtractSize, done)
+	if len(progress.tablespaceSizes) > 0 {
+		report.Tablespaces = make(map[string]float64)
+		progress.tablespaceMutex.Lock()
+		for tablespace, size := range progress.tablespaceSizes {
+			name, ok := progress.tablespaceNames[tablespace]
+			if !ok {
+				name = tablespace
+			}
+			report.Tablespaces[name] = getPercent(progress.tablespaceBytes[tablespace], size, done)
+		}
+		progress.tablespaceMutex.Unlock()
+	}
+	// the rate of extraction since the start is assumed to hold for the rest of the backup
+	if !done && report.ExtractedBytes > 0 && report.ExtractedBytes < report.ExtractSize {
+		elapsed := now.Sub(progress.startTime)
+		remaining := time.Duration(float64(elapsed) *
+			float64(report.ExtractSize-report.ExtractedBytes) / float64(report.ExtractedBytes))
+		eta := int64(remaining.Seconds())
+		report.EtaSeconds = &eta
+	}
+	return report
+}
+
+// getPercent is capped at 100, since sizes of the sentinel don't account for retried downloads
+func getPercent(value, total int64, done bool) float64 {
+	if done {
+		return 100
+	}
+	if total <= 0 {
+		return 0
+	}
+	percent := float64(value) * 100 / float64(total)
+	if percent > 100 {
+		return 100
+	}
+	return percent
+}
+
+func (progress *restoreProgress) print(report RestoreProgressReport) {
+	if progress.asJSON {
+		line, err := json.Marshal(report)
+		if err != nil {
+			tracelog.WarningLogger.Printf("Failed to marshal restore progress: %v\n", err)
+			return
+		}
+		_, _ = fmt.Fprintln(progress.output, string(line))
+		return
+	}
+	_, _ = fmt.Fprintln(progress.output, formatRestoreProgress(report))
+}
+
+func formatRestoreProgress(report RestoreProgressReport) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "Restore of %s: %.1f%%, extracted %d of %d bytes, downloaded %d of %d bytes",
+		report.Backup, report.Percent, report.ExtractedBytes, report.ExtractSize,
+		report.DownloadedBytes, report.DownloadSize)
+	if len(report.Tablespaces) > 0 {
+		names := make([]string, 0, len(report.Tablespaces))
+		for name := range report.Tablespaces {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		tablespaces := make([]string, 0, len(names))
+		for _, name := range names {
+			tablespaces = append(tablespaces, fmt.Sprintf("%s %.1f%%", name, report.Tablespaces[name]))
+		}
+		fmt.Fprintf(&builder, ", tablespaces: %s", strings.Join(tablespaces, ", "))
+	}
+	elapsed := time.Duration(report.ElapsedSeconds) * time.Second
+	fmt.Fprintf(&builder, ", elapsed %v", elapsed)
+	if report.EtaSeconds != nil {
+		fmt.Fprintf(&builder, ", ETA %v", time.Duration(*report.EtaSeconds)*time.Second)
+	}
+	return builder.String()
+}
+
+// countingReaderMaker adds the number of bytes read by its readers to the counter
+type countingReaderMaker struct {
+	ReaderMaker
+	counter *int64
+}
+
+func (readerMaker *countingReaderMaker) Reader() (io.ReadCloser, error) {
+	readCloser, err := readerMaker.ReaderMaker.Reader()
+	if err != nil {
+		return nil, err
+	}
+	return &ioextensions.ReadCascadeCloser{
+		Reader: NewWithSizeReader(readCloser, readerMaker.counter),
+		Closer: readCloser,
+	}, nil
+}
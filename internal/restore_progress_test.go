@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetFileTablespace(t *testing.T) {
+	assert.Equal(t, DefaultTablespaceName, getFileTablespace("/base/16384/16385"))
+	assert.Equal(t, DefaultTablespaceName, getFileTablespace("/global/pg_control"))
+	assert.Equal(t, "16400", getFileTablespace("/pg_tblspc/16400/PG_12_201909212/16384/16385"))
+}
+
+func TestRestoreProgressReport(t *testing.T) {
+	output := &bytes.Buffer{}
+	progress := &restoreProgress{
+		backupName:      "base_000000010000000000000002",
+		downloadSize:    100,
+		extractSize:     400,
+		tablespaceSizes: map[string]int64{DefaultTablespaceName: 300, "16400": 100},
+		tablespaceNames: map[string]string{"16400": "archive"},
+		asJSON:          true,
+		output:          output,
+		startTime:       time.Unix(0, 0),
+		tablespaceBytes: make(map[string]int64),
+	}
+	progress.addExtracted("/base/16384/16385", 150)
+	progress.addExtracted("/pg_tblspc/16400/PG_12_201909212/16384/16386", 50)
+
+	report := progress.report(time.Unix(60, 0), false)
+	assert.Equal(t, 50.0, report.Percent)
+	assert.Equal(t, map[string]float64{DefaultTablespaceName: 50, "archive": 50}, report.Tablespaces)
+	require.NotNil(t, report.EtaSeconds)
+	assert.Equal(t, int64(60), *report.EtaSeconds)
+
+	progress.print(report)
+	var printed RestoreProgressReport
+	require.NoError(t, json.Unmarshal(output.Bytes(), &printed))
+	assert.Equal(t, report, printed)
+
+	report = progress.report(time.Unix(90, 0), true)
+	assert.Equal(t, 100.0, report.Percent)
+	assert.Nil(t, report.EtaSeconds)
+}
@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+)
+
+const postgresBinaryName = "postgres"
+
+var postgresVersionRegexp = regexp.MustCompile(`\(PostgreSQL\) (\d+)(?:\.(\d+))?`)
+
+type RestoreVersionMismatchError struct {
+	error
+}
+
+func newRestoreVersionMismatchError(backupName string, backupVersion int, target string, targetVersion int) RestoreVersionMismatchError {
+	return RestoreVersionMismatchError{errors.Errorf(
+		"Backup %s was made by Postgres %s, but %s is of Postgres %s. "+
+			"Data files are incompatible between major versions, use --ignore-version-mismatch to restore anyway",
+		backupName, formatPgMajorVersion(backupVersion), target, formatPgMajorVersion(targetVersion))}
+}
+
+func (err RestoreVersionMismatchError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// WithRestoreVersionCheck wraps the fetcher to check that the backup has the same major version of Postgres
+// as the data directory it is restored into and the Postgres binaries installed on the host.
+func WithRestoreVersionCheck(dbDataDirectory string,
+	fetcher func(folder storage.Folder, backup Backup)) func(folder storage.Folder, backup Backup) {
+	return func(folder storage.Folder, backup Backup) {
+		sentinelDto, err := backup.GetSentinel()
+		tracelog.ErrorLogger.FatalfOnError("Failed to fetch backup: %v\n", err)
+		err = checkRestoreVersion(backup.Name, sentinelDto.PgVersion, dbDataDirectory, findPostgresBinary())
+		tracelog.ErrorLogger.FatalOnError(err)
+		fetcher(folder, backup)
+	}
+}
+
+// checkRestoreVersion compares major version of the backup with PG_VERSION of existing data directory
+// and with version of the postgres binary. Checks are skipped if some of the versions are unknown.
+func checkRestoreVersion(backupName string, backupVersion int, dbDataDirectory, postgresBinary string) error {
+	if backupVersion == 0 {
+		tracelog.WarningLogger.Printf("Postgres version of backup %s is unknown, it is not checked\n", backupName)
+		return nil
+	}
+	pgVersionPath := filepath.Join(dbDataDirectory, pgVersionFileName)
+	content, err := ioutil.ReadFile(pgVersionPath)
+	if err == nil {
+		dataDirectoryVersion, err := parsePgVersion(string(content))
+		if err != nil {
+			return errors.Wrapf(err, "failed to read Postgres version of %s", dbDataDirectory)
+		}
+		if pgMajorVersion(dataDirectoryVersion) != pgMajorVersion(backupVersion) {
+			return newRestoreVersionMismatchError(backupName, backupVersion,
+				fmt.Sprintf("data directory %s", dbDataDirectory), dataDirectoryVersion)
+		}
+	} else if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to read %s", pgVersionPath)
+	}
+
+	if postgresBinary == "" {
+		tracelog.InfoLogger.Printf("%s binary is not found, its version is not checked\n", postgresBinaryName)
+		return nil
+	}
+	binaryVersion, err := getPostgresBinaryVersion(postgresBinary)
+	if err != nil {
+		tracelog.WarningLogger.Printf("Version of %s is not checked: %v\n", postgresBinary, err)
+		return nil
+	}
+	if pgMajorVersion(binaryVersion) != pgMajorVersion(backupVersion) {
+		return newRestoreVersionMismatchError(backupName, backupVersion, postgresBinary, binaryVersion)
+	}
+	return nil
+}
+
+// findPostgresBinary looks for postgres in WALG_PG_BIN_DIR or in PATH, empty string is returned if it is not found
+func findPostgresBinary() string {
+	if binDir, ok := GetSetting(PgBinDirSetting); ok {
+		return filepath.Join(binDir, postgresBinaryName)
+	}
+	binaryPath, err := exec.LookPath(postgresBinaryName)
+	if err != nil {
+		return ""
+	}
+	return binaryPath
+}
+
+// getPostgresBinaryVersion returns version of the binary in server_version_num format
+func getPostgresBinaryVersion(postgresBinary string) (int, error) {
+	output, err := exec.Command(postgresBinary, "--version").Output()
+	if err != nil {
+		return 0, err
+	}
+	return parsePostgresVersionOutput(string(output))
+}
+
+// parsePostgresVersionOutput parses output of `postgres --version`, e.g. "postgres (PostgreSQL) 9.6.20"
+func parsePostgresVersionOutput(output string) (int, error) {
+	match := postgresVersionRegexp.FindStringSubmatch(output)
+	if match == nil {
+		return 0, errors.Errorf("unexpected output of postgres --version: '%s'", output)
+	}
+	major, _ := strconv.Atoi(match[1])
+	if major >= 10 || match[2] == "" {
+		return major * 10000, nil
+	}
+	minor, _ := strconv.Atoi(match[2])
+	return major*10000 + minor*100, nil
+}
+
+// pgMajorVersion truncates server_version_num to the major version, e.g. 90620 to 90600 and 120004 to 120000
+func pgMajorVersion(version int) int {
+	if version >= 100000 {
+		return version / 10000 * 10000
+	}
+	return version / 100 * 100
+}
+
+func formatPgMajorVersion(version int) string {
+	if version >= 100000 {
+		return strconv.Itoa(version / 10000)
+	}
+	return fmt.Sprintf("%d.%d", version/10000, version/100%100)
+}
@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePostgresVersionOutput(t *testing.T) {
+	for output, expected := range map[string]int{
+		"postgres (PostgreSQL) 12.4 (Ubuntu 12.4-1.pgdg20.04+1)\n": 120000,
+		"postgres (PostgreSQL) 9.6.20\n":                           90600,
+		"postgres (PostgreSQL) 13beta1\n":                          130000,
+	} {
+		version, err := parsePostgresVersionOutput(output)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, version, output)
+	}
+	_, err := parsePostgresVersionOutput("unknown")
+	assert.Error(t, err)
+}
+
+func TestCheckRestoreVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "restore_version")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	binary := filepath.Join(dir, "postgres")
+	require.NoError(t, ioutil.WriteFile(binary, []byte("#!/bin/sh\necho 'postgres (PostgreSQL) 12.4'\n"), 0755))
+	dataDirectory := filepath.Join(dir, "data")
+	require.NoError(t, os.Mkdir(dataDirectory, 0700))
+
+	assert.NoError(t, checkRestoreVersion("base_1", 120003, dataDirectory, binary))
+	err = checkRestoreVersion("base_1", 110009, dataDirectory, binary)
+	assert.IsType(t, RestoreVersionMismatchError{}, err)
+	assert.NoError(t, checkRestoreVersion("base_1", 110009, dataDirectory, ""))
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dataDirectory, pgVersionFileName), []byte("9.6\n"), 0600))
+	err = checkRestoreVersion("base_1", 120003, dataDirectory, "")
+	assert.IsType(t, RestoreVersionMismatchError{}, err)
+	assert.Contains(t, err.Error(), "Postgres 9.6")
+	assert.NoError(t, checkRestoreVersion("base_1", 0, dataDirectory, binary))
+}
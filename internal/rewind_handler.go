@@ -0,0 +1,298 @@
+package internal
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	pgRewindBinaryName = "pg_rewind"
+
+	// pg_control lost prevCheckPoint in Postgres 11
+	pgControlVersionWithoutPrevCheckpoint = 1100
+	pgControlCheckpointOffset             = 32
+)
+
+// pgControlCheckpoint is the latest checkpoint of a cluster recorded in pg_control
+type pgControlCheckpoint struct {
+	Lsn      uint64
+	RedoLsn  uint64
+	Timeline uint32
+}
+
+// RewindOptions describe how wal-g rewind runs pg_rewind and configures the rewound cluster
+type RewindOptions struct {
+	SourceServer string
+	DryRun       bool
+	PgRewindArgs []string
+	// WriteStandbyConfig makes the rewound cluster a standby of the source restoring WAL with RestoreCommand
+	WriteStandbyConfig bool
+	RestoreCommand     string
+}
+
+// HandleRewind is invoked to perform wal-g rewind. WAL of the target cluster which pg_rewind needs to find
+// the point of divergence from the source and which is already removed from pg_wal is fetched from storage,
+// then pg_rewind is run and the target is configured as a standby of the source restoring WAL from storage.
+func HandleRewind(folder storage.Folder, targetDataDirectory string, options RewindOptions) {
+	targetDataDirectory = utility.ResolveSymlink(targetDataDirectory)
+	segments, err := getRewindWalSegments(folder, targetDataDirectory, options.SourceServer)
+	tracelog.ErrorLogger.FatalfOnError("Failed to find WAL needed to rewind: %v\n", err)
+	err = fetchRewindWalSegments(folder, targetDataDirectory, segments)
+	tracelog.ErrorLogger.FatalfOnError("Failed to fetch WAL needed to rewind: %v\n", err)
+
+	err = runPgRewind(targetDataDirectory, options)
+	tracelog.ErrorLogger.FatalfOnError("pg_rewind failed: %v\n", err)
+	if options.DryRun || !options.WriteStandbyConfig {
+		return
+	}
+	config := RecoveryConfig{
+		RestoreCommand:  options.RestoreCommand,
+		Standby:         true,
+		PrimaryConnInfo: options.SourceServer,
+	}
+	err = WriteRecoveryConfig(targetDataDirectory, config)
+	tracelog.ErrorLogger.FatalOnError(err)
+}
+
+// getRewindWalSegments returns names of WAL segments of the target which pg_rewind reads:
+// from the last checkpoint before the divergence to the latest checkpoint of the target.
+func getRewindWalSegments(folder storage.Folder, targetDataDirectory, sourceServer string) ([]string, error) {
+	pgControl, err := ioutil.ReadFile(filepath.Join(targetDataDirectory, PgControlPath))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read pg_control of the target")
+	}
+	checkpoint, err := parsePgControlCheckpoint(pgControl)
+	if err != nil {
+		return nil, err
+	}
+	sourceTimeline, err := getSourceTimeline(sourceServer)
+	if err != nil {
+		return nil, err
+	}
+	walFolder := folder.GetSubFolder(utility.WalPath)
+	if sourceTimeline == checkpoint.Timeline {
+		tracelog.InfoLogger.Printf("Source and target are on timeline %d, no WAL is fetched\n", sourceTimeline)
+		return nil, nil
+	}
+	sourceHistory, err := downloadTimelineHistory(walFolder, sourceTimeline)
+	if err != nil {
+		return nil, err
+	}
+	divergenceLsn, ok := findTimelineSwitch(sourceHistory, checkpoint.Timeline)
+	if !ok {
+		return nil, errors.Errorf("timeline %d of the target is not in the history of timeline %d of the source",
+			checkpoint.Timeline, sourceTimeline)
+	}
+	tracelog.InfoLogger.Printf("Target diverged from timeline %d of the source at LSN %x\n",
+		sourceTimeline, divergenceLsn)
+
+	startLsn := checkpoint.RedoLsn
+	if startLsn > divergenceLsn {
+		// the target made checkpoints after the divergence, so an older one is needed,
+		// the start of a backup is always the redo point of a checkpoint
+		startLsn, err = findBackupStartBefore(folder, divergenceLsn)
+		if err != nil {
+			return nil, err
+		}
+	}
+	endLsn := checkpoint.Lsn
+	if endLsn < divergenceLsn {
+		endLsn = divergenceLsn
+	}
+	targetHistory, err := readTargetTimelineHistory(walFolder, targetDataDirectory, checkpoint.Timeline)
+	if err != nil {
+		return nil, err
+	}
+	return getTimelineSegmentNames(targetHistory, checkpoint.Timeline, startLsn, endLsn), nil
+}
+
+// parsePgControlCheckpoint reads the location of the latest checkpoint, its redo point and timeline
+func parsePgControlCheckpoint(pgControl []byte) (pgControlCheckpoint, error) {
+	if len(pgControl) < 12 {
+		return pgControlCheckpoint{}, errors.New("pg_control is too short")
+	}
+	checkpointCopyOffset := pgControlCheckpointOffset + 8
+	if binary.LittleEndian.Uint32(pgControl[8:12]) < pgControlVersionWithoutPrevCheckpoint {
+		checkpointCopyOffset += 8
+	}
+	if len(pgControl) < checkpointCopyOffset+12 {
+		return pgControlCheckpoint{}, errors.New("pg_control is too short")
+	}
+	return pgControlCheckpoint{
+		Lsn:      binary.LittleEndian.Uint64(pgControl[pgControlCheckpointOffset:]),
+		RedoLsn:  binary.LittleEndian.Uint64(pgControl[checkpointCopyOffset:]),
+		Timeline: binary.LittleEndian.Uint32(pgControl[checkpointCopyOffset+8:]),
+	}, nil
+}
+
+func getSourceTimeline(sourceServer string) (uint32, error) {
+	config, err := pgx.ParseConnectionString(sourceServer)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse connection string of the source")
+	}
+	conn, err := pgx.Connect(config)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to connect to the source")
+	}
+	defer utility.LoggedClose(conn, "")
+	var timeline int32
+	err = conn.QueryRow("SELECT timeline_id FROM pg_control_checkpoint()").Scan(&timeline)
+	return uint32(timeline), errors.Wrap(err, "failed to read timeline of the source")
+}
+
+// findTimelineSwitch returns the LSN at which the timeline ended according to the history
+func findTimelineSwitch(history []TimelineHistoryRecord, timeline uint32) (uint64, bool) {
+	for _, record := range history {
+		if record.Timeline == timeline {
+			return record.SwitchLsn, true
+		}
+	}
+	return 0, false
+}
+
+// findBackupStartBefore returns the start LSN of the latest backup started before the LSN
+func findBackupStartBefore(folder storage.Folder, lsn uint64) (uint64, error) {
+	backups, err := GetBackups(folder)
+	if err != nil {
+		return 0, err
+	}
+	baseBackupFolder := folder.GetSubFolder(utility.BaseBackupPath)
+	for _, backupTime := range backups {
+		meta, err := NewBackup(baseBackupFolder, backupTime.BackupName).fetchMeta()
+		if err != nil {
+			tracelog.WarningLogger.Printf("Skipping backup %s: %v\n", backupTime.BackupName, err)
+			continue
+		}
+		if meta.StartLsn <= lsn {
+			tracelog.InfoLogger.Printf("WAL is fetched from the start of backup %s\n", backupTime.BackupName)
+			return meta.StartLsn, nil
+		}
+	}
+	return 0, errors.Errorf("no backup started before LSN %x, WAL needed to rewind can't be found", lsn)
+}
+
+// readTargetTimelineHistory reads the history of the target timeline from pg_wal of the target or from storage
+func readTargetTimelineHistory(walFolder storage.Folder, targetDataDirectory string,
+	timeline uint32) ([]TimelineHistoryRecord, error) {
+	if timeline == 1 {
+		return nil, nil
+	}
+	walDirectory, err := getWalDirectory(targetDataDirectory)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Join(walDirectory, formatTimelineHistoryFilename(timeline)))
+	if os.IsNotExist(err) {
+		return downloadTimelineHistory(walFolder, timeline)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer utility.LoggedClose(file, "")
+	return ParseTimelineHistory(file)
+}
+
+// getTimelineSegmentNames returns names of segments holding WAL between the LSNs according to the history,
+// a segment containing a timeline switch is returned for both timelines
+func getTimelineSegmentNames(history []TimelineHistoryRecord, timeline uint32, startLsn, endLsn uint64) []string {
+	names := make([]string, 0)
+	for segmentNo := newWalSegmentNo(startLsn); segmentNo <= newWalSegmentNo(endLsn); segmentNo = segmentNo.next() {
+		segmentStart := segmentNo.firstLsn()
+		segmentEnd := segmentNo.next().firstLsn()
+		timelineStart := uint64(0)
+		for _, record := range history {
+			if timelineStart < segmentEnd && segmentStart < record.SwitchLsn {
+				names = append(names, segmentNo.getFilename(record.Timeline))
+			}
+			timelineStart = record.SwitchLsn
+		}
+		if timelineStart < segmentEnd {
+			names = append(names, segmentNo.getFilename(timeline))
+		}
+	}
+	return names
+}
+
+// fetchRewindWalSegments fetches segments missing in pg_wal of the target to a temporary directory,
+// then moves them to pg_wal, so pg_rewind never sees a partially fetched segment
+func fetchRewindWalSegments(folder storage.Folder, targetDataDirectory string, segments []string) error {
+	if len(segments) == 0 {
+		return nil
+	}
+	walDirectory, err := getWalDirectory(targetDataDirectory)
+	if err != nil {
+		return err
+	}
+	tempDirectory, err := ioutil.TempDir(walDirectory, ".wal-g-rewind")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDirectory)
+	policy, err := getWalFetchRetryPolicy()
+	if err != nil {
+		return err
+	}
+	walFolder := folder.GetSubFolder(utility.WalPath)
+	fetched := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		if _, err = os.Stat(filepath.Join(walDirectory, segment)); err == nil {
+			continue
+		}
+		err = downloadWALFileRetrying(walFolder, segment, filepath.Join(tempDirectory, segment), policy)
+		if isWalFileNotFound(err) {
+			tracelog.WarningLogger.Printf("Segment %s is not archived\n", segment)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		tracelog.InfoLogger.Printf("Fetched %s\n", segment)
+		fetched = append(fetched, segment)
+	}
+	for _, segment := range fetched {
+		err = os.Rename(filepath.Join(tempDirectory, segment), filepath.Join(walDirectory, segment))
+		if err != nil {
+			return err
+		}
+	}
+	tracelog.InfoLogger.Printf("Fetched %d segments to %s\n", len(fetched), walDirectory)
+	return nil
+}
+
+// getWalDirectory returns pg_wal of the data directory, or pg_xlog before Postgres 10
+func getWalDirectory(dataDirectory string) (string, error) {
+	version, err := readPgMajorVersion(dataDirectory)
+	if err != nil {
+		return "", err
+	}
+	if version < 10 {
+		return filepath.Join(dataDirectory, "pg_xlog"), nil
+	}
+	return filepath.Join(dataDirectory, "pg_wal"), nil
+}
+
+func runPgRewind(targetDataDirectory string, options RewindOptions) error {
+	pgRewind := pgRewindBinaryName
+	if binDir, ok := GetSetting(PgBinDirSetting); ok {
+		pgRewind = filepath.Join(binDir, pgRewindBinaryName)
+	}
+	args := []string{"--target-pgdata=" + targetDataDirectory, "--source-server=" + options.SourceServer}
+	if options.DryRun {
+		args = append(args, "--dry-run")
+	}
+	args = append(args, options.PgRewindArgs...)
+	tracelog.InfoLogger.Printf("Running %s %v\n", pgRewind, args)
+	cmd := exec.Command(pgRewind, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeTestPgControl(version uint32, checkpointCopyOffset int) []byte {
+	pgControl := make([]byte, 256)
+	binary.LittleEndian.PutUint32(pgControl[8:], version)
+	binary.LittleEndian.PutUint64(pgControl[32:], 0x3000060)
+	binary.LittleEndian.PutUint64(pgControl[checkpointCopyOffset:], 0x3000028)
+	binary.LittleEndian.PutUint32(pgControl[checkpointCopyOffset+8:], 2)
+	return pgControl
+}
+
+func TestParsePgControlCheckpoint(t *testing.T) {
+	expected := pgControlCheckpoint{Lsn: 0x3000060, RedoLsn: 0x3000028, Timeline: 2}
+
+	checkpoint, err := parsePgControlCheckpoint(makeTestPgControl(1002, 48))
+	require.NoError(t, err)
+	assert.Equal(t, expected, checkpoint)
+
+	checkpoint, err = parsePgControlCheckpoint(makeTestPgControl(1300, 40))
+	require.NoError(t, err)
+	assert.Equal(t, expected, checkpoint)
+
+	_, err = parsePgControlCheckpoint(make([]byte, 8))
+	assert.Error(t, err)
+}
+
+func TestGetTimelineSegmentNames(t *testing.T) {
+	history := []TimelineHistoryRecord{{Timeline: 1, SwitchLsn: 0x3000100}}
+
+	names := getTimelineSegmentNames(history, 2, 0x2000028, 0x4000000)
+	assert.Equal(t, []string{
+		"000000010000000000000002",
+		"000000010000000000000003",
+		"000000020000000000000003",
+		"000000020000000000000004",
+	}, names)
+
+	names = getTimelineSegmentNames(nil, 1, 0x2000028, 0x2000100)
+	assert.Equal(t, []string{"000000010000000000000002"}, names)
+}
+
+func TestFindTimelineSwitch(t *testing.T) {
+	history := []TimelineHistoryRecord{{Timeline: 1, SwitchLsn: 0x3000100}, {Timeline: 2, SwitchLsn: 0x5000000}}
+
+	lsn, ok := findTimelineSwitch(history, 2)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(0x5000000), lsn)
+	_, ok = findTimelineSwitch(history, 3)
+	assert.False(t, ok)
+}
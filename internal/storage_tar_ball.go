@@ -16,6 +16,7 @@ import (
 type StorageTarBall struct {
 	backupName      string
 	partNumber      int
+	name            string
 	allTarballsSize *int64
 	writeCloser     io.Closer
 	tarWriter       *tar.Writer
@@ -34,6 +35,7 @@ func (tarBall *StorageTarBall) SetUp(crypter crypto.Crypter, names ...string) {
 		} else {
 			name = fmt.Sprintf("part_%0.3d.tar.%v", tarBall.partNumber, tarBall.uploader.Compressor.FileExtension())
 		}
+		tarBall.name = name
 		writeCloser := tarBall.startUpload(name, crypter)
 
 		tarBall.writeCloser = writeCloser
@@ -67,43 +69,63 @@ func (tarBall *StorageTarBall) AwaitUploads() {
 // TODO : unit tests
 // startUpload creates a compressing writer and runs upload in the background once
 // a compressed tar member is finished writing.
+// With the upload memory budget the tarball is compressed in the background too,
+// so it goes on compressing and uploading after it is closed, while the next tarball is packed.
 func (tarBall *StorageTarBall) startUpload(name string, crypter crypto.Crypter) io.WriteCloser {
-	pipeReader, pipeWriter := io.Pipe()
 	uploader := tarBall.uploader
-
 	path := tarBall.backupName + TarPartitionFolderName + name
 
 	tracelog.InfoLogger.Printf("Starting part %d ...\n", tarBall.partNumber)
 
+	if uploader.memoryBudget != nil {
+		compressedReader, uncompressedWriter := startBudgetedCompression(uploader.memoryBudget,
+			func(compressedWriter io.WriteCloser) (io.WriteCloser, error) {
+				return tarBall.newCompressingWriter(compressedWriter, crypter)
+			})
+		tarBall.runUpload(path, compressedReader)
+		return uncompressedWriter
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	tarBall.runUpload(path, pipeReader)
+	writeCloser, err := tarBall.newCompressingWriter(pipeWriter, crypter)
+	if err != nil {
+		tracelog.ErrorLogger.Fatal("upload: encryption error ", err)
+	}
+	return writeCloser
+}
+
+// runUpload uploads the content in the background, the content is closed if upload fails
+func (tarBall *StorageTarBall) runUpload(path string, content io.ReadCloser) {
+	uploader := tarBall.uploader
 	uploader.waitGroup.Add(1)
 	go func() {
 		defer uploader.waitGroup.Done()
 
-		err := uploader.Upload(path, NewNetworkLimitReader(pipeReader))
+		err := uploader.Upload(path, NewNetworkLimitReader(content))
 		if compressingError, ok := err.(CompressAndEncryptError); ok {
 			tracelog.ErrorLogger.Printf("could not upload '%s' due to compression error\n%+v\n", path, compressingError)
 		}
 		if err != nil {
 			tracelog.ErrorLogger.Printf("upload: could not upload '%s'\n", path)
 			tracelog.ErrorLogger.Printf("%v\n", err)
-			err = pipeReader.Close()
+			err = content.Close()
 			tracelog.ErrorLogger.FatalfOnError("Failed to close pipe: %v", err)
 		}
 	}()
+}
 
-	var writerToCompress io.WriteCloser = pipeWriter
-
+// newCompressingWriter compresses and encrypts data into the writer, which is closed together with the returned one
+func (tarBall *StorageTarBall) newCompressingWriter(writer io.WriteCloser, crypter crypto.Crypter) (io.WriteCloser, error) {
+	var writerToCompress = writer
 	if crypter != nil {
-		encryptedWriter, err := crypter.Encrypt(pipeWriter)
-
+		encryptedWriter, err := crypter.Encrypt(writer)
 		if err != nil {
-			tracelog.ErrorLogger.Fatal("upload: encryption error ", err)
+			return nil, err
 		}
-
-		writerToCompress = &CascadeWriteCloser{encryptedWriter, pipeWriter}
+		writerToCompress = &CascadeWriteCloser{encryptedWriter, writer}
 	}
-
-	return &CascadeWriteCloser{uploader.Compressor.NewWriter(writerToCompress), writerToCompress}
+	return &CascadeWriteCloser{tarBall.uploader.Compressor.NewWriter(writerToCompress), writerToCompress}, nil
 }
 
 // Size accumulated in this tarball
@@ -113,3 +135,5 @@ func (tarBall *StorageTarBall) Size() int64 { return atomic.LoadInt64(tarBall.al
 func (tarBall *StorageTarBall) AddSize(i int64) { atomic.AddInt64(tarBall.allTarballsSize, i) }
 
 func (tarBall *StorageTarBall) TarWriter() *tar.Writer { return tarBall.tarWriter }
+
+func (tarBall *StorageTarBall) Name() string { return tarBall.name }
@@ -36,18 +36,25 @@ func GetLogsDstSettings(operationLogsDstEnvVariable string) (dstFolder string, e
 }
 
 // TODO : unit tests
-// downloadAndDecompressStream downloads, decompresses and writes stream to stdout
-func downloadAndDecompressStream(backup *Backup, writeCloser io.WriteCloser) error {
+// DownloadAndDecompressStream downloads, decompresses and writes stream to stdout
+func DownloadAndDecompressStream(backup *Backup, writeCloser io.WriteCloser) error {
 	for _, decompressor := range compression.Decompressors {
-		archiveReader, exists, err := TryDownloadFile(backup.BaseBackupFolder, getStreamName(backup.Name, decompressor.FileExtension()))
+		streamName := getStreamName(backup.Name, decompressor.FileExtension())
+		archiveReader, exists, err := TryDownloadFile(backup.BaseBackupFolder, streamName)
 		if err != nil {
 			return err
 		}
+		if !exists {
+			archiveReader, exists, err = tryDownloadStreamParts(backup.BaseBackupFolder, streamName)
+			if err != nil {
+				return err
+			}
+		}
 		if !exists {
 			continue
 		}
 
-		err = DecompressDecryptBytes(&EmptyWriteIgnorer{WriteCloser: writeCloser}, archiveReader, decompressor)
+		err = DecompressDecryptBytes(&EmptyWriteIgnorer{WriteCloser: writeCloser}, archiveReader, decompressor, BackupContentType)
 		if err != nil {
 			return err
 		}
@@ -67,8 +74,8 @@ func FetchStreamSentinel(backup *Backup, sentinelDto interface{}) error {
 	return errors.Wrap(err, "failed to unmarshal sentinel")
 }
 
-// DownloadFile downloads, decompresses and decrypts
-func DownloadFile(folder storage.Folder, filename, ext string, writeCloser io.WriteCloser) error {
+// DownloadFile downloads, decompresses and decrypts object of given content type
+func DownloadFile(folder storage.Folder, filename, ext string, contentType ContentType, writeCloser io.WriteCloser) error {
 	decompressor := compression.FindDecompressor(ext)
 	if decompressor == nil {
 		return fmt.Errorf("decompressor for extension '%s' was not found", ext)
@@ -81,7 +88,7 @@ func DownloadFile(folder storage.Folder, filename, ext string, writeCloser io.Wr
 		return fmt.Errorf("File '%s' does not exist.\n", filename)
 	}
 
-	err = DecompressDecryptBytes(&EmptyWriteIgnorer{WriteCloser: writeCloser}, archiveReader, decompressor)
+	err = DecompressDecryptBytes(&EmptyWriteIgnorer{WriteCloser: writeCloser}, archiveReader, decompressor, contentType)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,275 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	streamPartSeparator   = ".part_"
+	maxStreamPartAttempts = 5
+)
+
+var MinStreamPartRetryWait = time.Second
+var MaxStreamPartRetryWait = time.Minute
+
+// streamUploadState is persisted locally after each uploaded part of a stream.
+// Hostname and Pid identify the process uploading the stream, so parts of running uploads are not cleaned up.
+type streamUploadState struct {
+	DstPath  string            `json:"DstPath"`
+	Hostname string            `json:"Hostname,omitempty"`
+	Pid      int               `json:"Pid,omitempty"`
+	Parts    []streamPartState `json:"Parts"`
+}
+
+// streamPartState identifies uploaded part, so the part of restarted upload is skipped if it has the same content
+type streamPartState struct {
+	Size   int64  `json:"Size"`
+	SHA256 string `json:"SHA256"`
+}
+
+func getStreamPartName(dstPath string, part int) string {
+	return fmt.Sprintf("%s%s%06d", dstPath, streamPartSeparator, part)
+}
+
+// pushStreamParts uploads compressed stream as objects of partSize bytes.
+// Each part is kept in memory until it is uploaded, so failed part is uploaded again
+// instead of the whole stream. If stateDir is set, upload progress is persisted there,
+// and restarted upload of the same dstPath skips parts which are in storage and have the same content.
+// Parts are reused only if the stream is reproduced byte by byte, e.g. not for encrypted streams.
+func (uploader *Uploader) pushStreamParts(stream io.Reader, dstPath string, partSize int64, stateDir string) error {
+	var resumed streamUploadState
+	uploadedParts := make(map[string]bool)
+	if stateDir != "" {
+		var err error
+		if resumed, err = uploader.loadStreamUploadState(stateDir, dstPath); err != nil {
+			return err
+		}
+		if len(resumed.Parts) > 0 {
+			parts, _, err := listStreamParts(uploader.UploadingFolder, dstPath)
+			if err != nil {
+				return err
+			}
+			for _, part := range parts {
+				uploadedParts[part] = true
+			}
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	state := streamUploadState{DstPath: dstPath, Hostname: hostname, Pid: os.Getpid()}
+	skipped := 0
+	buf := &bytes.Buffer{}
+	for {
+		buf.Reset()
+		n, err := io.CopyN(buf, stream, partSize)
+		if err != nil && err != io.EOF {
+			return errors.Wrapf(err, "failed to read part %d of stream %s", len(state.Parts)+1, dstPath)
+		}
+		if n == 0 && len(state.Parts) > 0 {
+			break
+		}
+
+		part := len(state.Parts) + 1
+		partName := getStreamPartName(dstPath, part)
+		digest := sha256.Sum256(buf.Bytes())
+		partState := streamPartState{Size: n, SHA256: hex.EncodeToString(digest[:])}
+		if part <= len(resumed.Parts) && resumed.Parts[part-1] == partState && uploadedParts[path.Base(partName)] {
+			skipped++
+		} else if err := uploader.uploadStreamPart(partName, buf.Bytes()); err != nil {
+			return err
+		}
+		state.Parts = append(state.Parts, partState)
+		if stateDir != "" {
+			if err := saveStreamUploadState(stateDir, state); err != nil {
+				return err
+			}
+		}
+		if n < partSize {
+			break
+		}
+	}
+
+	// parts of the previous attempt beyond the end of the stream
+	var staleParts []string
+	for part := len(state.Parts) + 1; part <= len(resumed.Parts); part++ {
+		staleParts = append(staleParts, getStreamPartName(dstPath, part))
+	}
+	if len(staleParts) > 0 {
+		if err := uploader.UploadingFolder.DeleteObjects(staleParts); err != nil {
+			return err
+		}
+	}
+
+	tracelog.InfoLogger.Printf("Stream %s is uploaded in %d parts, %d parts of the interrupted upload are reused",
+		dstPath, len(state.Parts), skipped)
+	if stateDir != "" {
+		return os.Remove(streamUploadStatePath(stateDir, dstPath))
+	}
+	return nil
+}
+
+func (uploader *Uploader) uploadStreamPart(partName string, data []byte) error {
+	retrier := newExponentialRetrier(MinStreamPartRetryWait, MaxStreamPartRetryWait)
+	var err error
+	for attempt := 1; attempt <= maxStreamPartAttempts; attempt++ {
+		if err = uploader.Upload(partName, bytes.NewReader(data)); err == nil {
+			return nil
+		}
+		tracelog.WarningLogger.Printf("Failed to upload stream part %s (attempt %d of %d): %v",
+			partName, attempt, maxStreamPartAttempts, err)
+		if attempt < maxStreamPartAttempts {
+			retrier.retry()
+		}
+	}
+	return errors.Wrapf(err, "failed to upload stream part %s", partName)
+}
+
+// loadStreamUploadState returns the state of interrupted upload of dstPath to resume it.
+// Parts of other interrupted uploads are deleted, since their backups are not finished.
+// Uploads of processes which are still running on this host, or of other hosts, are left alone.
+func (uploader *Uploader) loadStreamUploadState(stateDir, dstPath string) (streamUploadState, error) {
+	resumed := streamUploadState{DstPath: dstPath}
+	hostname, _ := os.Hostname()
+	stateFiles, err := filepath.Glob(filepath.Join(stateDir, "*.json"))
+	if err != nil {
+		return resumed, err
+	}
+	for _, stateFile := range stateFiles {
+		data, err := ioutil.ReadFile(stateFile)
+		if err != nil {
+			return resumed, err
+		}
+		state := streamUploadState{}
+		if err := json.Unmarshal(data, &state); err != nil {
+			return resumed, errors.Wrapf(err, "failed to unmarshal stream upload state %s", stateFile)
+		}
+		if state.DstPath == dstPath {
+			tracelog.InfoLogger.Printf("Upload of stream %s was interrupted after %d parts, resuming it", dstPath, len(state.Parts))
+			resumed = state
+			continue
+		}
+		if state.Pid != 0 && (state.Hostname != hostname || isProcessRunning(state.Pid)) {
+			tracelog.InfoLogger.Printf("Upload of stream %s is owned by pid %d on %s, its parts are kept",
+				state.DstPath, state.Pid, state.Hostname)
+			continue
+		}
+		tracelog.WarningLogger.Printf("Upload of stream %s was interrupted after %d parts, deleting its parts",
+			state.DstPath, len(state.Parts))
+		parts := make([]string, 0, len(state.Parts))
+		for part := 1; part <= len(state.Parts); part++ {
+			parts = append(parts, getStreamPartName(state.DstPath, part))
+		}
+		if err := uploader.UploadingFolder.DeleteObjects(parts); err != nil {
+			return resumed, err
+		}
+		if err := os.Remove(stateFile); err != nil {
+			return resumed, err
+		}
+	}
+	return resumed, nil
+}
+
+func streamUploadStatePath(stateDir, dstPath string) string {
+	return filepath.Join(stateDir, strings.ReplaceAll(dstPath, "/", "_")+".json")
+}
+
+func saveStreamUploadState(stateDir string, state streamUploadState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	statePath := streamUploadStatePath(stateDir, state.DstPath)
+	// rename keeps the previous state if the process is killed while writing
+	tmpPath := statePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, statePath)
+}
+
+// listStreamParts returns sorted names of stream parts relative to the returned folder of the stream
+func listStreamParts(folder storage.Folder, streamName string) ([]string, storage.Folder, error) {
+	streamFolder := folder.GetSubFolder(utility.SanitizePath(path.Dir(streamName)) + "/")
+	objects, _, err := streamFolder.ListFolder()
+	if err != nil {
+		return nil, nil, err
+	}
+	prefix := path.Base(streamName) + streamPartSeparator
+	var parts []string
+	for _, object := range objects {
+		if strings.HasPrefix(object.GetName(), prefix) {
+			parts = append(parts, object.GetName())
+		}
+	}
+	sort.Strings(parts)
+	return parts, streamFolder, nil
+}
+
+// tryDownloadStreamParts opens stream uploaded by parts as a single reader
+func tryDownloadStreamParts(folder storage.Folder, streamName string) (io.ReadCloser, bool, error) {
+	parts, streamFolder, err := listStreamParts(folder, streamName)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(parts) == 0 {
+		return nil, false, nil
+	}
+	return &streamPartsReader{folder: streamFolder, parts: parts}, true, nil
+}
+
+// streamPartsReader reads stream parts one by one
+type streamPartsReader struct {
+	folder  storage.Folder
+	parts   []string
+	current io.ReadCloser
+}
+
+func (r *streamPartsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			reader, err := r.folder.ReadObject(r.parts[0])
+			if err != nil {
+				return 0, err
+			}
+			r.current = reader
+			r.parts = r.parts[1:]
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			err = r.current.Close()
+			r.current = nil
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *streamPartsReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/storages/storage"
+)
+
+func TestPushStreamParts_RoundTrip(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	uploader := NewUploader(nil, folder)
+	stateDir, err := ioutil.TempDir("", "stream_parts")
+	require.NoError(t, err)
+	defer os.RemoveAll(stateDir)
+
+	data := bytes.Repeat([]byte("0123456789"), 5)
+	dstPath := getStreamName("stream_20200101T000000Z", "lz4")
+	require.NoError(t, uploader.pushStreamParts(bytes.NewReader(data), dstPath, 15, stateDir))
+
+	reader, exists, err := tryDownloadStreamParts(folder, dstPath)
+	require.NoError(t, err)
+	require.True(t, exists)
+	downloaded, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+	assert.Equal(t, data, downloaded)
+
+	stateFiles, err := filepath.Glob(filepath.Join(stateDir, "*"))
+	assert.NoError(t, err)
+	assert.Empty(t, stateFiles)
+}
+
+func TestPushStreamParts_CleansUpInterruptedUpload(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	uploader := NewUploader(nil, folder)
+	stateDir, err := ioutil.TempDir("", "stream_parts")
+	require.NoError(t, err)
+	defer os.RemoveAll(stateDir)
+
+	interrupted := getStreamName("stream_20200101T000000Z", "lz4")
+	for part := 1; part <= 2; part++ {
+		require.NoError(t, folder.PutObject(getStreamPartName(interrupted, part), bytes.NewBufferString("part")))
+	}
+	require.NoError(t, saveStreamUploadState(stateDir, streamUploadState{DstPath: interrupted,
+		Parts: []streamPartState{{Size: 4}, {Size: 4}}}))
+
+	dstPath := getStreamName("stream_20200102T000000Z", "lz4")
+	require.NoError(t, uploader.pushStreamParts(bytes.NewBufferString("data"), dstPath, 15, stateDir))
+
+	_, exists, err := tryDownloadStreamParts(folder, interrupted)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	_, exists, err = tryDownloadStreamParts(folder, dstPath)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestPushStreamParts_KeepsUploadOfRunningProcess(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	uploader := NewUploader(nil, folder)
+	stateDir, err := ioutil.TempDir("", "stream_parts")
+	require.NoError(t, err)
+	defer os.RemoveAll(stateDir)
+
+	running := getStreamName("stream_20200101T000000Z", "lz4")
+	require.NoError(t, folder.PutObject(getStreamPartName(running, 1), bytes.NewBufferString("part")))
+	hostname, _ := os.Hostname()
+	require.NoError(t, saveStreamUploadState(stateDir, streamUploadState{DstPath: running,
+		Hostname: hostname, Pid: os.Getppid(), Parts: []streamPartState{{Size: 4}}}))
+
+	dstPath := getStreamName("stream_20200102T000000Z", "lz4")
+	require.NoError(t, uploader.pushStreamParts(bytes.NewBufferString("data"), dstPath, 15, stateDir))
+
+	_, exists, err := tryDownloadStreamParts(folder, running)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	_, err = os.Stat(streamUploadStatePath(stateDir, running))
+	assert.NoError(t, err)
+}
+
+// failingPartFolder fails uploads of objects with the given name
+type failingPartFolder struct {
+	storage.Folder
+	failedName string
+	uploaded   []string
+}
+
+func (f *failingPartFolder) PutObject(name string, content io.Reader) error {
+	if name == f.failedName {
+		return errors.New("connection reset")
+	}
+	f.uploaded = append(f.uploaded, name)
+	return f.Folder.PutObject(name, content)
+}
+
+func TestPushStreamParts_ResumesInterruptedUpload(t *testing.T) {
+	defer func(wait time.Duration) { MinStreamPartRetryWait, MaxStreamPartRetryWait = wait, wait }(MinStreamPartRetryWait)
+	MinStreamPartRetryWait, MaxStreamPartRetryWait = time.Millisecond, time.Millisecond
+	stateDir, err := ioutil.TempDir("", "stream_parts")
+	require.NoError(t, err)
+	defer os.RemoveAll(stateDir)
+
+	data := bytes.Repeat([]byte("0123456789"), 5)
+	dstPath := getStreamName("stream_20200101T000000Z", "lz4")
+	folder := &failingPartFolder{Folder: memory.NewFolder("", memory.NewStorage()), failedName: getStreamPartName(dstPath, 3)}
+	assert.Error(t, NewUploader(nil, folder).pushStreamParts(bytes.NewReader(data), dstPath, 15, stateDir))
+	assert.Equal(t, []string{getStreamPartName(dstPath, 1), getStreamPartName(dstPath, 2)}, folder.uploaded)
+
+	// the first part differs, so it is uploaded again
+	data[0] = 'x'
+	folder.failedName, folder.uploaded = "", nil
+	require.NoError(t, NewUploader(nil, folder).pushStreamParts(bytes.NewReader(data), dstPath, 15, stateDir))
+	assert.Equal(t, []string{getStreamPartName(dstPath, 1), getStreamPartName(dstPath, 3),
+		getStreamPartName(dstPath, 4)}, folder.uploaded)
+
+	reader, exists, err := tryDownloadStreamParts(folder, dstPath)
+	require.NoError(t, err)
+	require.True(t, exists)
+	downloaded, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, data, downloaded)
+}
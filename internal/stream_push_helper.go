@@ -6,6 +6,7 @@ import (
 	"path"
 
 	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/compression"
 	"github.com/wal-g/wal-g/utility"
 )
 
@@ -17,17 +18,65 @@ const (
 // PushStream compresses a stream and push it
 func (uploader *Uploader) PushStream(stream io.Reader) (string, error) {
 	backupName := StreamPrefix + utility.TimeNowCrossPlatformUTC().Format(utility.BackupTimeFormat)
-	dstPath := getStreamName(backupName, uploader.Compressor.FileExtension())
-	err := uploader.PushStreamToDestination(stream, dstPath)
+	err := uploader.PushStreamAs(stream, backupName)
 
 	return backupName, err
 }
 
+// PushStreamAs compresses a stream and push it as a backup with given name.
+// Callers check that the backup is new with CheckBackupIsNew before they start the backup.
+func (uploader *Uploader) PushStreamAs(stream io.Reader, backupName string) error {
+	return uploader.PushCompressedStreamAs(compressBackupStream(stream, uploader.Compressor), backupName)
+}
+
+// PushCompressedStreamAs pushes a stream already compressed with uploader compressor and encrypted
+// as a backup with given name, so callers can count compressed bytes of the backup.
+func (uploader *Uploader) PushCompressedStreamAs(compressed io.Reader, backupName string) error {
+	dstPath := getStreamName(backupName, uploader.Compressor.FileExtension())
+	return uploader.pushCompressedStreamToDestination(compressed, dstPath)
+}
+
+// GetStreamBackupName builds stream backup name from the source position (e.g. binlog position or oplog timestamp)
+// if deterministic backup naming is enabled, otherwise from the current time
+func GetStreamBackupName(sourcePosition string) (string, error) {
+	deterministic, err := GetBoolSetting(DeterministicNamingSetting, false)
+	if err != nil {
+		return "", err
+	}
+	if deterministic {
+		return StreamPrefix + sourcePosition, nil
+	}
+	return StreamPrefix + utility.TimeNowCrossPlatformUTC().Format(utility.BackupTimeFormat), nil
+}
+
 // TODO : unit tests
 // PushStreamToDestination compresses a stream and push it to specifyed destination
 func (uploader *Uploader) PushStreamToDestination(stream io.Reader, dstPath string) error {
-	compressed := CompressAndEncrypt(stream, uploader.Compressor, ConfigureCrypter())
-	err := uploader.Upload(dstPath, compressed)
+	return uploader.pushCompressedStreamToDestination(compressBackupStream(stream, uploader.Compressor), dstPath)
+}
+
+func compressBackupStream(stream io.Reader, compressor compression.Compressor) io.Reader {
+	return CompressAndEncrypt(stream, compressor, ConfigureCrypterForContentType(BackupContentType))
+}
+
+func (uploader *Uploader) pushCompressedStreamToDestination(compressed io.Reader, dstPath string) error {
+	compressed = NewNetworkLimitReader(compressed)
+	partSize, err := GetStreamPartSize()
+	if err != nil {
+		return err
+	}
+	if partSize > 0 {
+		stateDir, _ := GetSetting(StreamPartStateDirSetting)
+		if stateDir != "" && ConfigureCrypterForContentType(BackupContentType) != nil {
+			// encrypted parts differ on every upload, so they are never reused
+			tracelog.WarningLogger.Printf("%s is ignored, since upload of encrypted stream can't be resumed",
+				StreamPartStateDirSetting)
+			stateDir = ""
+		}
+		err = uploader.pushStreamParts(compressed, dstPath, partSize, stateDir)
+	} else {
+		err = uploader.Upload(dstPath, compressed)
+	}
 	tracelog.InfoLogger.Println("FILE PATH:", dstPath)
 
 	return err
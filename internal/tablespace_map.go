@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// remapTablespaceMapFile rewrites locations in tablespace_map of fetched backup,
+// since Postgres recreates pg_tblspc symlinks from this file during recovery.
+func remapTablespaceMapFile(dbDataDirectory string, tablespaceMap map[string]string) error {
+	path := filepath.Join(dbDataDirectory, TablespaceMapFilename)
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read tablespace_map")
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		// each line is "<oid> <location>"
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		for oldLocation, newLocation := range tablespaceMap {
+			if utility.PathsEqual(parts[1], oldLocation) {
+				lines[i] = parts[0] + " " + newLocation
+				break
+			}
+		}
+	}
+	tracelog.InfoLogger.Printf("Rewriting tablespace locations in %s\n", path)
+	return errors.Wrap(ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0600), "failed to write tablespace_map")
+}
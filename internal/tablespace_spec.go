@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"strings"
 
+	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/utility"
 )
 
@@ -173,3 +175,45 @@ func (spec *TablespaceSpec) MarshalJSON() ([]byte, error) {
 	}
 	return json.Marshal(toMarshal)
 }
+
+// remapped returns copy of the spec with tablespaces found in tablespaceMap relocated to new locations.
+// Symlinks of the copy are placed in dbDataDirectory.
+func (spec *TablespaceSpec) remapped(dbDataDirectory string, tablespaceMap map[string]string) (*TablespaceSpec, error) {
+	result := NewTablespaceSpec(dbDataDirectory)
+	found := make(map[string]bool)
+	for _, symlinkName := range spec.TablespaceNames() {
+		location, _ := spec.location(symlinkName)
+		actualLocation := location.Location
+		for oldLocation, newLocation := range tablespaceMap {
+			if utility.PathsEqual(actualLocation, oldLocation) {
+				tracelog.InfoLogger.Printf("Relocating tablespace %s from %s to %s\n", symlinkName, actualLocation, newLocation)
+				actualLocation = newLocation
+				found[oldLocation] = true
+				break
+			}
+		}
+		result.addTablespace(symlinkName, actualLocation)
+	}
+	for oldLocation := range tablespaceMap {
+		if !found[oldLocation] {
+			return nil, fmt.Errorf("Tablespace at path %s wasn't found.\n", oldLocation)
+		}
+	}
+	return &result, nil
+}
+
+// ParseTablespaceMap parses tablespace relocations given as old=new location pairs
+func ParseTablespaceMap(pairs []string) (map[string]string, error) {
+	tablespaceMap := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid tablespace mapping '%s', expected old=new.\n", pair)
+		}
+		if !filepath.IsAbs(parts[1]) {
+			return nil, fmt.Errorf("New tablespace location '%s' must be an absolute path.\n", parts[1])
+		}
+		tablespaceMap[parts[0]] = parts[1]
+	}
+	return tablespaceMap, nil
+}
@@ -2,6 +2,8 @@ package internal
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"sort"
 	"testing"
@@ -185,3 +187,66 @@ func TestTablespaceLocations(t *testing.T) {
 
 	assert.Equal(t, tablespaceLocations, returnedLocations)
 }
+
+func TestRemappedTablespaceSpec(t *testing.T) {
+	spec := setUpIsTablespaceSymlink(t)
+
+	remapped, err := spec.remapped("/restore/", map[string]string{"/home/ismirn0ff/space1": "/mnt/space1"})
+	assert.NoError(t, err)
+
+	basePrefix, _ := remapped.BasePrefix()
+	assert.Equal(t, "/restore", basePrefix)
+	assert.Equal(t, TablespaceLocation{Location: "/mnt/space1", Symlink: "pg_tblspc/3"}, requireLocation(t, *remapped, "3"))
+	assert.Equal(t, TablespaceLocation{Location: "/home/ismirn0ff/space2", Symlink: "pg_tblspc/1"}, requireLocation(t, *remapped, "1"))
+	// source spec is not changed
+	assert.Equal(t, "/home/ismirn0ff/space1", requireLocation(t, spec, "3").Location)
+}
+
+func TestRemappedTablespaceSpec_NotFound(t *testing.T) {
+	spec := setUpIsTablespaceSymlink(t)
+
+	_, err := spec.remapped("/restore", map[string]string{"/home/ismirn0ff/space4": "/mnt/space4"})
+	assert.Error(t, err)
+}
+
+func TestParseTablespaceMap(t *testing.T) {
+	tablespaceMap, err := ParseTablespaceMap([]string{"/old/space1=/new/space1", "/old/space2=/new/space=2"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"/old/space1": "/new/space1", "/old/space2": "/new/space=2"}, tablespaceMap)
+
+	_, err = ParseTablespaceMap([]string{"/old/space1"})
+	assert.Error(t, err)
+	_, err = ParseTablespaceMap([]string{"/old/space1=relative"})
+	assert.Error(t, err)
+}
+
+func TestRemapTablespaceMapFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tablespace_map")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, TablespaceMapFilename)
+	err = ioutil.WriteFile(path, []byte("16384 /old/space1\n16385 /old/space2\n"), 0600)
+	assert.NoError(t, err)
+
+	err = remapTablespaceMapFile(dir, map[string]string{"/old/space1/": "/new/space1"})
+	assert.NoError(t, err)
+
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "16384 /new/space1\n16385 /old/space2\n", string(content))
+}
+
+func TestRemapTablespaceSpec_RestoreSpecIsRemappedOnce(t *testing.T) {
+	spec := NewTablespaceSpec("/psql")
+	addTablespaces(&spec, []TablespaceLocation{{Location: "/home/ts1", Symlink: "16384"}})
+
+	remapped, err := remapTablespaceSpec(nil, &spec, "/restore", map[string]string{"/home/ts1": "/mnt/ts1"})
+	assert.NoError(t, err)
+	location := requireLocation(t, *remapped, "16384")
+	assert.Equal(t, utility.NormalizePath("/mnt/ts1"), location.Location)
+
+	// the remapped spec is passed to all backups of the chain and is not remapped again
+	withoutMap, err := remapTablespaceSpec(nil, remapped, "/restore", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, remapped, withoutMap)
+}
@@ -16,6 +16,8 @@ type TarBall interface {
 	AddSize(int64)
 	TarWriter() *tar.Writer
 	AwaitUploads()
+	// Name is the name of the tar file in the backup, it is known after SetUp
+	Name() string
 }
 
 func PackFileTo(tarBall TarBall, fileInfoHeader *tar.Header, fileContent io.Reader) (fileSize int64, err error) {
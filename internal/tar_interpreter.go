@@ -27,12 +27,17 @@ type FileTarInterpreter struct {
 	FilesToUnwrap   map[string]bool
 
 	createNewIncrementalFiles bool
+	extractLimiter            *extractLimiter
+	// inPlace means that files are written over existing ones, rewriting only changed pages
+	inPlace bool
+	// progress counts extracted bytes if restore progress is reported
+	progress *restoreProgress
 }
 
 func NewFileTarInterpreter(
 	dbDataDirectory string, sentinel BackupSentinelDto, filesToUnwrap map[string]bool, createNewIncrementalFiles bool,
 ) *FileTarInterpreter {
-	return &FileTarInterpreter{dbDataDirectory, sentinel, filesToUnwrap, createNewIncrementalFiles}
+	return &FileTarInterpreter{dbDataDirectory, sentinel, filesToUnwrap, createNewIncrementalFiles, nil, false, nil}
 }
 
 // TODO : unit tests
@@ -49,8 +54,18 @@ func (tarInterpreter *FileTarInterpreter) unwrapRegularFileOld(fileReader io.Rea
 	// If this file is incremental we use it's base version from incremental path
 	if haveFileDescription && tarInterpreter.Sentinel.IsIncremental() && fileDescription.IsIncremented {
 		err := ApplyFileIncrement(targetPath, fileReader, tarInterpreter.createNewIncrementalFiles)
+		if err == nil {
+			err = setRestoredModTime(targetPath, fileDescription)
+		}
 		return errors.Wrapf(err, "Interpret: failed to apply increment for '%s'", targetPath)
 	}
+	if tarInterpreter.inPlace {
+		err := rewriteFileInPlace(fileReader, fileInfo, targetPath)
+		if err != nil {
+			return err
+		}
+		return setRestoredModTime(targetPath, fileDescription)
+	}
 	err := PrepareDirs(fileInfo.Name, targetPath)
 	if err != nil {
 		return errors.Wrap(err, "Interpret: failed to create all directories")
@@ -80,7 +95,10 @@ func (tarInterpreter *FileTarInterpreter) unwrapRegularFileOld(fileReader io.Rea
 	}
 
 	err = file.Sync()
-	return errors.Wrap(err, "Interpret: fsync failed")
+	if err != nil {
+		return errors.Wrap(err, "Interpret: fsync failed")
+	}
+	return setRestoredModTime(targetPath, fileDescription)
 }
 
 // Interpret extracts a tar file to disk and creates needed directories.
@@ -91,6 +109,33 @@ func (tarInterpreter *FileTarInterpreter) Interpret(fileReader io.Reader, fileIn
 	targetPath := path.Join(tarInterpreter.DBDataDirectory, fileInfo.Name)
 	switch fileInfo.Typeflag {
 	case tar.TypeReg, tar.TypeRegA:
+		if tarInterpreter.progress != nil {
+			defer tarInterpreter.progress.addExtracted(fileInfo.Name, fileInfo.Size)
+		}
+		offset, fileSize, isPart, err := getFilePartPosition(fileInfo)
+		if err != nil {
+			return err
+		}
+		if isPart {
+			if tarInterpreter.FilesToUnwrap != nil && !tarInterpreter.FilesToUnwrap[fileInfo.Name] {
+				return nil
+			}
+			// pages of parts are not verified, since blocks are numbered from the beginning of the file
+			return unwrapFilePart(fileReader, fileInfo, targetPath, offset, fileSize)
+		}
+		checksumReader, err := tarInterpreter.verifyingPageChecksums(fileReader, fileInfo)
+		if err != nil {
+			return err
+		}
+		if checksumReader != nil {
+			fileReader = checksumReader
+			defer warnCorruptBlocksRestored(fileInfo.Name, checksumReader)
+		}
+		if tarInterpreter.extractLimiter != nil && !tarInterpreter.limitsTars() {
+			// contents of tars are unknown for backups of older versions, so each file waits for its directory
+			release := tarInterpreter.extractLimiter.acquire(tarInterpreter.extractPath(fileInfo.Name))
+			defer release()
+		}
 		// temporary switch to determine if new unwrap logic should be used
 		if useNewUnwrapImplementation {
 			return tarInterpreter.unwrapRegularFileNew(fileReader, fileInfo, targetPath)
@@ -105,10 +150,20 @@ func (tarInterpreter *FileTarInterpreter) Interpret(fileReader io.Reader, fileIn
 			return errors.Wrap(err, "Interpret: chmod failed")
 		}
 	case tar.TypeLink:
+		if tarInterpreter.inPlace {
+			if err := removeExistingLink(targetPath); err != nil {
+				return err
+			}
+		}
 		if err := os.Link(fileInfo.Name, targetPath); err != nil {
 			return errors.Wrapf(err, "Interpret: failed to create hardlink %s", targetPath)
 		}
 	case tar.TypeSymlink:
+		if tarInterpreter.inPlace {
+			if err := removeExistingLink(targetPath); err != nil {
+				return err
+			}
+		}
 		if err := os.Symlink(fileInfo.Name, targetPath); err != nil {
 			return errors.Wrapf(err, "Interpret: failed to create symlink %s", targetPath)
 		}
@@ -116,6 +171,58 @@ func (tarInterpreter *FileTarInterpreter) Interpret(fileReader io.Reader, fileIn
 	return nil
 }
 
+// SetExtractConcurrencies limits number of files written concurrently to each of the given directories
+func (tarInterpreter *FileTarInterpreter) SetExtractConcurrencies(concurrencies map[string]int) {
+	if len(concurrencies) == 0 {
+		tarInterpreter.extractLimiter = nil
+		return
+	}
+	tarInterpreter.extractLimiter = newExtractLimiter(concurrencies)
+}
+
+// limitsTars checks if extraction concurrencies are applied to whole tars before they are scheduled for extraction
+func (tarInterpreter *FileTarInterpreter) limitsTars() bool {
+	return tarInterpreter.extractLimiter != nil && len(tarInterpreter.Sentinel.TarFileSets) > 0
+}
+
+// acquireTarSlots blocks until the tar can be extracted to all the directories its files are written to
+func (tarInterpreter *FileTarInterpreter) acquireTarSlots(tarPath string) func() {
+	tarFiles := tarInterpreter.Sentinel.TarFileSets[path.Base(tarPath)]
+	targetPaths := make([]string, 0, len(tarFiles))
+	for _, fileName := range tarFiles {
+		targetPaths = append(targetPaths, tarInterpreter.extractPath(fileName))
+	}
+	return tarInterpreter.extractLimiter.acquireAll(targetPaths)
+}
+
+// extractPath returns the path the file is written to, following tablespace symlinks
+func (tarInterpreter *FileTarInterpreter) extractPath(fileName string) string {
+	return resolveExtractPath(tarInterpreter.DBDataDirectory, tarInterpreter.Sentinel.TablespaceSpec, fileName)
+}
+
+// verifyingPageChecksums wraps reader of a paged file to verify its page checksums if they are enabled in the cluster.
+// Returns nil if the file is not verified. Increments are not verified.
+func (tarInterpreter *FileTarInterpreter) verifyingPageChecksums(fileReader io.Reader,
+	fileInfo *tar.Header) (*pageChecksumVerifyingReader, error) {
+	sentinel := tarInterpreter.Sentinel
+	if !sentinel.DataChecksums || sentinel.BackupStartLSN == nil ||
+		sentinel.Files[fileInfo.Name].IsIncremented || !isPagedFile(fileInfo.FileInfo(), fileInfo.Name) {
+		return nil, nil
+	}
+	return newCorruptBlocksCollectingReader(fileReader, fileInfo.Name, *sentinel.BackupStartLSN)
+}
+
+// warnCorruptBlocksRestored reports restored pages with wrong checksums.
+// Fetch does not fail on them: a page torn by a concurrent write is overwritten by WAL replay,
+// so only pages not fixed by recovery mean real corruption.
+func warnCorruptBlocksRestored(fileName string, reader *pageChecksumVerifyingReader) {
+	if corruptBlocks := reader.CorruptBlocks(); corruptBlocks != nil {
+		tracelog.WarningLogger.Printf("'%s' restored with %d pages with wrong checksums, e.g. blocks %v. "+
+			"They are expected to be overwritten by WAL replay, otherwise Postgres will report them on read\n",
+			fileName, corruptBlocks.CorruptBlocksCount, corruptBlocks.SomeCorruptBlocks)
+	}
+}
+
 // PrepareDirs makes sure all dirs exist
 func PrepareDirs(fileName string, targetPath string) error {
 	if fileName == targetPath {
@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// Tombstone is an audit record of one deletion run.
+// It keeps the names and modification times of the deleted objects,
+// so the state of the storage at a past moment can be reconstructed.
+type Tombstone struct {
+	DeletedAt time.Time         `json:"deleted_at"`
+	Objects   []TombstoneObject `json:"objects"`
+}
+
+type TombstoneObject struct {
+	Name         string    `json:"name"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+func isTombstoneObject(object storage.Object) bool {
+	return strings.HasPrefix(object.GetName(), utility.TombstonePath)
+}
+
+// deleteObjectsWhere deletes objects like storage.DeleteObjectsWhere does
+// and leaves a tombstone with deleted objects after a confirmed deletion.
+// Tombstones themselves are never deleted.
+func deleteObjectsWhere(folder storage.Folder, confirmed bool, filter func(object storage.Object) bool) error {
+	deleted := make([]storage.Object, 0)
+	err := storage.DeleteObjectsWhere(folder, confirmed, func(object storage.Object) bool {
+		if isTombstoneObject(object) || !filter(object) {
+			return false
+		}
+		deleted = append(deleted, object)
+		return true
+	})
+	if err != nil || !confirmed || len(deleted) == 0 {
+		return err
+	}
+	return writeTombstone(folder, deleted)
+}
+
+func writeTombstone(folder storage.Folder, objects []storage.Object) error {
+	tombstone := Tombstone{
+		DeletedAt: utility.TimeNowCrossPlatformUTC(),
+		Objects:   make([]TombstoneObject, len(objects)),
+	}
+	for i, object := range objects {
+		tombstone.Objects[i] = TombstoneObject{object.GetName(), object.GetLastModified()}
+	}
+	bytesTombstone, err := json.Marshal(&tombstone)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("tombstone_%d.json", tombstone.DeletedAt.UnixNano())
+	tracelog.InfoLogger.Printf("Writing tombstone %s for %d deleted objects\n", name, len(objects))
+	return folder.GetSubFolder(utility.TombstonePath).PutObject(name, bytes.NewReader(bytesTombstone))
+}
+
+func fetchTombstones(folder storage.Folder) ([]Tombstone, error) {
+	tombstoneFolder := folder.GetSubFolder(utility.TombstonePath)
+	objects, _, err := tombstoneFolder.ListFolder()
+	if err != nil {
+		return nil, err
+	}
+	tombstones := make([]Tombstone, 0, len(objects))
+	for _, object := range objects {
+		reader, err := tombstoneFolder.ReadObject(object.GetName())
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(reader)
+		utility.LoggedClose(reader, "")
+		if err != nil {
+			return nil, err
+		}
+		var tombstone Tombstone
+		err = json.Unmarshal(data, &tombstone)
+		if err != nil {
+			return nil, err
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+	return tombstones, nil
+}
+
+// GetObjectsAsOf reconstructs the list of objects which existed in the given subfolders
+// of the folder at the given moment: objects which are still present and objects which were
+// deleted later, according to tombstones. Only direct children of the subfolders are listed,
+// object names are relative to the folder.
+func GetObjectsAsOf(folder storage.Folder, asOf time.Time, paths ...string) ([]storage.Object, error) {
+	tombstones, err := fetchTombstones(folder)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]storage.Object, 0)
+	for _, path := range paths {
+		present, _, err := folder.GetSubFolder(path).ListFolder()
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range present {
+			if !object.GetLastModified().After(asOf) {
+				objects = append(objects, storage.NewLocalObject(path+object.GetName(), object.GetLastModified()))
+			}
+		}
+		for _, tombstone := range tombstones {
+			if !tombstone.DeletedAt.After(asOf) {
+				continue
+			}
+			for _, object := range tombstone.Objects {
+				if isDirectChild(object.Name, path) && !object.LastModified.After(asOf) {
+					objects = append(objects, storage.NewLocalObject(object.Name, object.LastModified))
+				}
+			}
+		}
+	}
+	return objects, nil
+}
+
+// GetBackupsAsOf returns backups which existed in the storage at the given moment, sorted by time
+func GetBackupsAsOf(folder storage.Folder, asOf time.Time) ([]BackupTime, error) {
+	objects, err := GetObjectsAsOf(folder, asOf, utility.BaseBackupPath)
+	if err != nil {
+		return nil, err
+	}
+	return getBackupsFromObjects(objects), nil
+}
+
+func isDirectChild(name string, path string) bool {
+	return strings.HasPrefix(name, path) && !strings.Contains(strings.TrimPrefix(name, path), "/")
+}
+
+// getBackupsFromObjects picks backup sentinels among objects listed from the storage root
+// and returns backups sorted by time
+func getBackupsFromObjects(objects []storage.Object) []BackupTime {
+	sentinels := make([]storage.Object, 0)
+	for _, object := range objects {
+		name := object.GetName()
+		if !isDirectChild(name, utility.BaseBackupPath) || !strings.HasSuffix(name, utility.SentinelSuffix) {
+			continue
+		}
+		name = strings.TrimPrefix(name, utility.BaseBackupPath)
+		sentinels = append(sentinels, storage.NewLocalObject(name, object.GetLastModified()))
+	}
+	return getBackupTimeSlices(sentinels)
+}
+
+// countWals returns the number of WAL archives among objects listed from the storage root
+// and the names of the oldest and the newest of them
+func countWals(objects []storage.Object) (count int, oldest, newest string) {
+	for _, object := range objects {
+		name := object.GetName()
+		if !isDirectChild(name, utility.WalPath) {
+			continue
+		}
+		name = utility.TrimFileExtension(strings.TrimPrefix(name, utility.WalPath))
+		if count == 0 || name < oldest {
+			oldest = name
+		}
+		if count == 0 || name > newest {
+			newest = name
+		}
+		count++
+	}
+	return count, oldest, newest
+}
@@ -0,0 +1,95 @@
+package internal_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/utility"
+)
+
+func TestGetObjectsAsOf_ReturnsDeletedObjects(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	oldBackup := "base_000000010000000000000002" + utility.SentinelSuffix
+	newBackup := "base_000000010000000000000004" + utility.SentinelSuffix
+	assert.NoError(t, folder.PutObject(utility.BaseBackupPath+oldBackup, &bytes.Buffer{}))
+	assert.NoError(t, folder.PutObject(utility.WalPath+"000000010000000000000002.lz4", &bytes.Buffer{}))
+	time.Sleep(time.Millisecond)
+	beforeNewBackup := time.Now()
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, folder.PutObject(utility.BaseBackupPath+newBackup, &bytes.Buffer{}))
+
+	target := storage.NewLocalObject(newBackup, time.Now())
+	isFullBackup := func(object storage.Object) bool { return true }
+	less := func(object1, object2 storage.Object) bool {
+		return strings.Contains(object1.GetName(), "000000010000000000000002")
+	}
+	err := internal.DeleteBeforeTarget(folder, target, true, isFullBackup, less, nil)
+	assert.NoError(t, err)
+	afterDelete := time.Now()
+
+	objectsNow := objectNames(t, folder, afterDelete)
+	assert.ElementsMatch(t, []string{utility.BaseBackupPath + newBackup}, objectsNow)
+
+	objectsBefore := objectNames(t, folder, beforeNewBackup)
+	assert.ElementsMatch(t, []string{
+		utility.BaseBackupPath + oldBackup,
+		utility.WalPath + "000000010000000000000002.lz4",
+	}, objectsBefore)
+}
+
+func TestGetObjectsAsOf_ListsOnlyGivenPaths(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	backup := "base_000000010000000000000002" + utility.SentinelSuffix
+	assert.NoError(t, folder.PutObject(utility.BaseBackupPath+backup, &bytes.Buffer{}))
+	assert.NoError(t, folder.PutObject(utility.BaseBackupPath+"base_000000010000000000000002/metadata.json", &bytes.Buffer{}))
+	assert.NoError(t, folder.PutObject(utility.WalPath+"000000010000000000000002.lz4", &bytes.Buffer{}))
+
+	objects, err := internal.GetObjectsAsOf(folder, time.Now(), utility.BaseBackupPath)
+	assert.NoError(t, err)
+	assert.Len(t, objects, 1)
+	assert.Equal(t, utility.BaseBackupPath+backup, objects[0].GetName())
+}
+
+func TestGetBackupsAsOf(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	oldBackup := "base_000000010000000000000002"
+	newBackup := "base_000000010000000000000004"
+	assert.NoError(t, folder.PutObject(utility.BaseBackupPath+oldBackup+utility.SentinelSuffix, &bytes.Buffer{}))
+	time.Sleep(time.Millisecond)
+	beforeNewBackup := time.Now()
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, folder.PutObject(utility.BaseBackupPath+newBackup+utility.SentinelSuffix, &bytes.Buffer{}))
+
+	target := storage.NewLocalObject(newBackup+utility.SentinelSuffix, time.Now())
+	isFullBackup := func(object storage.Object) bool { return true }
+	less := func(object1, object2 storage.Object) bool {
+		return strings.Contains(object1.GetName(), "000000010000000000000002")
+	}
+	assert.NoError(t, internal.DeleteBeforeTarget(folder, target, true, isFullBackup, less, nil))
+
+	backups, err := internal.GetBackupsAsOf(folder, beforeNewBackup)
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+	assert.Equal(t, oldBackup, backups[0].BackupName)
+
+	backups, err = internal.GetBackupsAsOf(folder, time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+	assert.Equal(t, newBackup, backups[0].BackupName)
+}
+
+func objectNames(t *testing.T, folder storage.Folder, asOf time.Time) []string {
+	objects, err := internal.GetObjectsAsOf(folder, asOf, utility.BaseBackupPath, utility.WalPath)
+	assert.NoError(t, err)
+	names := make([]string, len(objects))
+	for i, object := range objects {
+		names[i] = object.GetName()
+	}
+	return names
+}
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// uploadChunkSize is the size of data chunks passed between packing, compression and upload of tarballs
+const uploadChunkSize = 1 << 20
+
+// uploadMemoryBudget limits data of tarballs buffered in memory by the whole process.
+// Each tarball is compressed in its own goroutine, so parts closed by packing are compressed concurrently
+// with the ones being packed while the budget allows. Uncompressed and compressed data get separate halves
+// of the budget: compression always finds room for its output freed by uploads, so it can't be stalled
+// by packing which waits for compression.
+type uploadMemoryBudget struct {
+	uncompressed *memoryPool
+	compressed   *memoryPool
+}
+
+func newUploadMemoryBudget(limit int64) *uploadMemoryBudget {
+	return &uploadMemoryBudget{
+		uncompressed: newMemoryPool(limit / 2),
+		compressed:   newMemoryPool(limit - limit/2),
+	}
+}
+
+// memoryPool is the part of the budget, each pool fits at least one chunk
+type memoryPool struct {
+	limit     int64
+	semaphore *semaphore.Weighted
+}
+
+func newMemoryPool(limit int64) *memoryPool {
+	if limit < uploadChunkSize {
+		limit = uploadChunkSize
+	}
+	return &memoryPool{limit: limit, semaphore: semaphore.NewWeighted(limit)}
+}
+
+// acquire blocks until size bytes fit into the pool
+func (pool *memoryPool) acquire(size int64) {
+	_ = pool.semaphore.Acquire(context.TODO(), size)
+}
+
+func (pool *memoryPool) release(size int64) {
+	pool.semaphore.Release(size)
+}
+
+// budgetedPipe is a pipe which lets the writer go ahead of the reader while buffered chunks fit into the pool
+type budgetedPipe struct {
+	pool      *memoryPool
+	chunks    chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	// writerCloseOnce guards chunks, the writer may be closed with an error after a failed Close
+	writerCloseOnce sync.Once
+	// err is returned to the reader after all chunks instead of io.EOF, it is set before chunks are closed
+	err error
+
+	pending []byte
+	reading []byte
+	// readingSize is the size of the chunk being read, it is released after the chunk is read
+	readingSize int64
+}
+
+type budgetedPipeReader struct {
+	pipe *budgetedPipe
+}
+
+type budgetedPipeWriter struct {
+	pipe *budgetedPipe
+}
+
+func newBudgetedPipe(pool *memoryPool) (*budgetedPipeReader, *budgetedPipeWriter) {
+	pipe := &budgetedPipe{
+		pool:   pool,
+		chunks: make(chan []byte, pool.limit/uploadChunkSize+1),
+		done:   make(chan struct{}),
+	}
+	return &budgetedPipeReader{pipe}, &budgetedPipeWriter{pipe}
+}
+
+func (reader *budgetedPipeReader) Read(p []byte) (int, error) {
+	pipe := reader.pipe
+	if len(pipe.reading) == 0 {
+		pipe.pool.release(pipe.readingSize)
+		pipe.readingSize = 0
+		chunk, ok := <-pipe.chunks
+		if !ok {
+			if pipe.err != nil {
+				return 0, pipe.err
+			}
+			return 0, io.EOF
+		}
+		pipe.reading = chunk
+		pipe.readingSize = int64(len(chunk))
+	}
+	n := copy(p, pipe.reading)
+	pipe.reading = pipe.reading[n:]
+	return n, nil
+}
+
+// Close stops the pipe, e.g. when upload fails. Buffered chunks are returned to the pool.
+func (reader *budgetedPipeReader) Close() error {
+	pipe := reader.pipe
+	pipe.closeOnce.Do(func() {
+		close(pipe.done)
+		pipe.pool.release(pipe.readingSize)
+		pipe.readingSize = 0
+		go func() {
+			for chunk := range pipe.chunks {
+				pipe.pool.release(int64(len(chunk)))
+			}
+		}()
+	})
+	return nil
+}
+
+func (writer *budgetedPipeWriter) Write(p []byte) (int, error) {
+	pipe := writer.pipe
+	written := 0
+	for len(p) > 0 {
+		if pipe.pending == nil {
+			pipe.pending = make([]byte, 0, uploadChunkSize)
+		}
+		n := copy(pipe.pending[len(pipe.pending):cap(pipe.pending)], p)
+		pipe.pending = pipe.pending[:len(pipe.pending)+n]
+		p = p[n:]
+		written += n
+		if len(pipe.pending) == cap(pipe.pending) {
+			if err := writer.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (writer *budgetedPipeWriter) flush() error {
+	pipe := writer.pipe
+	chunk := pipe.pending
+	pipe.pending = nil
+	if len(chunk) == 0 {
+		return nil
+	}
+	select {
+	case <-pipe.done:
+		return io.ErrClosedPipe
+	default:
+	}
+	pipe.pool.acquire(int64(len(chunk)))
+	select {
+	case pipe.chunks <- chunk:
+		return nil
+	case <-pipe.done:
+		pipe.pool.release(int64(len(chunk)))
+		return io.ErrClosedPipe
+	}
+}
+
+// Close sends buffered data to the reader, which gets io.EOF after it
+func (writer *budgetedPipeWriter) Close() error {
+	err := writer.flush()
+	writer.pipe.writerCloseOnce.Do(func() { close(writer.pipe.chunks) })
+	return err
+}
+
+// closeWithError stops the pipe, the reader gets err after the data sent before
+func (writer *budgetedPipeWriter) closeWithError(err error) {
+	writer.pipe.pending = nil
+	writer.pipe.writerCloseOnce.Do(func() {
+		writer.pipe.err = err
+		close(writer.pipe.chunks)
+	})
+}
+
+// startBudgetedCompression returns the writer of uncompressed data, which is compressed in the background
+// into the returned reader. Both sides buffer data within the budget. If compression fails,
+// the reader gets the error, if the reader is closed, writes fail with io.ErrClosedPipe.
+func startBudgetedCompression(budget *uploadMemoryBudget,
+	newCompressingWriter func(io.WriteCloser) (io.WriteCloser, error)) (*budgetedPipeReader, io.WriteCloser) {
+	uncompressedReader, uncompressedWriter := newBudgetedPipe(budget.uncompressed)
+	compressedReader, compressedWriter := newBudgetedPipe(budget.compressed)
+	go func() {
+		defer uncompressedReader.Close()
+		compressingWriter, err := newCompressingWriter(compressedWriter)
+		if err == nil {
+			_, err = io.Copy(compressingWriter, uncompressedReader)
+		}
+		if err == nil {
+			err = compressingWriter.Close()
+			if err == nil {
+				return
+			}
+		}
+		compressedWriter.closeWithError(err)
+	}()
+	return compressedReader, uncompressedWriter
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudgetedPipe_TransfersData(t *testing.T) {
+	pool := newMemoryPool(2 * uploadChunkSize)
+	data := make([]byte, 5*uploadChunkSize+123)
+	rand.Read(data)
+	reader, writer := newBudgetedPipe(pool)
+	go func() {
+		_, err := io.Copy(writer, bytes.NewReader(data))
+		assert.NoError(t, err)
+		assert.NoError(t, writer.Close())
+	}()
+
+	result, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, data, result)
+	assert.True(t, pool.semaphore.TryAcquire(pool.limit))
+}
+
+func TestBudgetedPipe_WriterStopsWhenReaderIsClosed(t *testing.T) {
+	pool := newMemoryPool(uploadChunkSize)
+	reader, writer := newBudgetedPipe(pool)
+	assert.NoError(t, reader.Close())
+
+	_, err := writer.Write(make([]byte, 3*uploadChunkSize))
+	assert.Equal(t, io.ErrClosedPipe, err)
+	assert.NoError(t, writer.Close())
+}
+
+func TestBudgetedCompression_CompressesTarballsConcurrently(t *testing.T) {
+	budget := newUploadMemoryBudget(16 * uploadChunkSize)
+	data := make([]byte, 3*uploadChunkSize+123)
+	rand.Read(data)
+	copying := func(writer io.WriteCloser) (io.WriteCloser, error) { return writer, nil }
+
+	// both tarballs are written and closed before any of them is uploaded
+	firstReader, firstWriter := startBudgetedCompression(budget, copying)
+	secondReader, secondWriter := startBudgetedCompression(budget, copying)
+	for _, writer := range []io.WriteCloser{firstWriter, secondWriter} {
+		_, err := writer.Write(data)
+		assert.NoError(t, err)
+		assert.NoError(t, writer.Close())
+	}
+
+	for _, reader := range []io.Reader{firstReader, secondReader} {
+		result, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, data, result)
+	}
+}
+
+func TestBudgetedCompression_ReturnsCompressionError(t *testing.T) {
+	budget := newUploadMemoryBudget(2 * uploadChunkSize)
+	compressionErr := errors.New("compression failed")
+	reader, writer := startBudgetedCompression(budget, func(io.WriteCloser) (io.WriteCloser, error) {
+		return nil, compressionErr
+	})
+
+	_, err := ioutil.ReadAll(reader)
+	assert.Equal(t, compressionErr, err)
+	assert.NoError(t, writer.Close())
+}
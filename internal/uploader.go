@@ -6,6 +6,7 @@ import (
 	"sync"
 	"sync/atomic"
 
+	"github.com/pkg/errors"
 	"github.com/wal-g/storages/storage"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal/compression"
@@ -16,9 +17,13 @@ type UploaderProvider interface {
 	Upload(path string, content io.Reader) error
 	UploadFile(file NamedReader) error
 	PushStream(stream io.Reader) (string, error)
+	PushStreamAs(stream io.Reader, backupName string) error
+	PushCompressedStreamAs(compressed io.Reader, backupName string) error
 	PushStreamToDestination(stream io.Reader, dstPath string) error
 	Compression() compression.Compressor
 	DisableSizeTracking()
+	UploadedDataSize() (int64, error)
+	Folder() storage.Folder
 }
 
 // Uploader contains fields associated with uploading tarballs.
@@ -30,6 +35,13 @@ type Uploader struct {
 	ArchiveStatusManager ArchiveStatusManager
 	Failed               atomic.Value
 	tarSize              *int64
+	// memoryBudget limits data of tarballs compressed in the background, it is shared by clones
+	memoryBudget *uploadMemoryBudget
+}
+
+// Folder returns the folder which uploader uploads to
+func (uploader *Uploader) Folder() storage.Folder {
+	return uploader.UploadingFolder
 }
 
 // UploadObject
@@ -71,13 +83,14 @@ func (uploader *Uploader) clone() *Uploader {
 		uploader.ArchiveStatusManager,
 		uploader.Failed,
 		uploader.tarSize,
+		uploader.memoryBudget,
 	}
 }
 
 // TODO : unit tests
-// UploadFile compresses a file and uploads it.
+// UploadFile compresses a log file (WAL, binlog or delta file) and uploads it.
 func (uploader *Uploader) UploadFile(file NamedReader) error {
-	compressedFile := CompressAndEncrypt(file, uploader.Compressor, ConfigureCrypter())
+	compressedFile := CompressAndEncrypt(file, uploader.Compressor, ConfigureCrypterForContentType(LogContentType))
 	dstPath := utility.SanitizePath(filepath.Base(file.Name()) + "." + uploader.Compressor.FileExtension())
 
 	err := uploader.Upload(dstPath, compressedFile)
@@ -90,6 +103,14 @@ func (uploader *Uploader) DisableSizeTracking() {
 	uploader.tarSize = nil
 }
 
+// UploadedDataSize returns size of uploaded data, unless size tracking is disabled
+func (uploader *Uploader) UploadedDataSize() (int64, error) {
+	if uploader.tarSize == nil {
+		return -1, errors.New("size tracking is disabled")
+	}
+	return atomic.LoadInt64(uploader.tarSize), nil
+}
+
 // Compression returns configured compressor
 func (uploader *Uploader) Compression() compression.Compressor {
 	return uploader.Compressor
@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	WalArchiveCheckOkStatus       = "OK"
+	WalArchiveCheckMissingStatus  = "MISSING_IN_STORAGE"
+	WalArchiveCheckMismatchStatus = "STATUS_MISMATCH"
+
+	// doneSuffix marks WAL files which were archived by archive_command
+	doneSuffix = ".done"
+)
+
+// WalArchiveCheckResult is the report of wal-archive-check
+type WalArchiveCheckResult struct {
+	Status string `json:"status"`
+	// MissingInStorage are marked as archived by PostgreSQL, but are not found in storage
+	MissingInStorage []string `json:"missing_in_storage"`
+	// ArchivedButReady are found in storage, but PostgreSQL considers them not archived
+	ArchivedButReady []string `json:"archived_but_ready"`
+	DoneCount        int      `json:"done_count"`
+	ReadyCount       int      `json:"ready_count"`
+}
+
+// TODO : unit tests
+// HandleWalArchiveCheck is invoked to perform wal-g wal-archive-check.
+// WAL files in archive_status of the data directory are compared with WAL archived in storage.
+func HandleWalArchiveCheck(folder storage.Folder, dbDataDirectory string, output io.Writer) {
+	walDirectory, err := findWalDirectory(dbDataDirectory)
+	tracelog.ErrorLogger.FatalOnError(err)
+	done, ready, err := readArchiveStatus(walDirectory)
+	tracelog.ErrorLogger.FatalfOnError("Failed to read archive status: %v\n", err)
+
+	walFolder := folder.GetSubFolder(utility.WalPath)
+	objects, _, err := walFolder.ListFolder()
+	tracelog.ErrorLogger.FatalfOnError("Failed to list WAL archives: %v\n", err)
+	archived := make([]string, 0, len(objects))
+	for _, object := range objects {
+		archived = append(archived, utility.TrimFileExtension(object.GetName()))
+	}
+	bundled, err := listBundledSegments(walFolder)
+	tracelog.ErrorLogger.FatalfOnError("Failed to list WAL bundles: %v\n", err)
+	archived = append(archived, bundled...)
+
+	result := CheckWalArchive(done, ready, archived)
+	err = WriteAsJson(result, output, true)
+	tracelog.ErrorLogger.FatalOnError(err)
+}
+
+// CheckWalArchive compares WAL files marked as archived (done) or waiting for archiving (ready)
+// with names of WAL files found in storage, given without file extension
+func CheckWalArchive(done, ready, archived []string) WalArchiveCheckResult {
+	archivedSet := make(map[string]bool, len(archived))
+	for _, name := range archived {
+		archivedSet[name] = true
+	}
+	result := WalArchiveCheckResult{
+		Status:           WalArchiveCheckOkStatus,
+		MissingInStorage: []string{},
+		ArchivedButReady: []string{},
+		DoneCount:        len(done),
+		ReadyCount:       len(ready),
+	}
+	for _, name := range done {
+		if !archivedSet[name] {
+			result.MissingInStorage = append(result.MissingInStorage, name)
+		}
+	}
+	for _, name := range ready {
+		if archivedSet[name] {
+			result.ArchivedButReady = append(result.ArchivedButReady, name)
+		}
+	}
+	sort.Strings(result.MissingInStorage)
+	sort.Strings(result.ArchivedButReady)
+	if len(result.MissingInStorage) > 0 {
+		result.Status = WalArchiveCheckMissingStatus
+	} else if len(result.ArchivedButReady) > 0 {
+		result.Status = WalArchiveCheckMismatchStatus
+	}
+	return result
+}
+
+// findWalDirectory returns pg_wal of the data directory, or pg_xlog for PostgreSQL older than 10
+func findWalDirectory(dbDataDirectory string) (string, error) {
+	for _, walDirectory := range []string{"pg_wal", "pg_xlog"} {
+		walDirectoryPath := filepath.Join(dbDataDirectory, walDirectory)
+		if _, err := os.Stat(walDirectoryPath); err == nil {
+			return walDirectoryPath, nil
+		}
+	}
+	return "", errors.Errorf("neither pg_wal nor pg_xlog found in %s", dbDataDirectory)
+}
+
+// readArchiveStatus returns names of WAL files with .done and .ready status files
+func readArchiveStatus(walDirectory string) (done, ready []string, err error) {
+	statusFiles, err := ioutil.ReadDir(filepath.Join(walDirectory, archiveStatusDir))
+	if err != nil {
+		return nil, nil, err
+	}
+	done = make([]string, 0)
+	ready = make([]string, 0)
+	for _, statusFile := range statusFiles {
+		name := statusFile.Name()
+		switch {
+		case strings.HasSuffix(name, doneSuffix):
+			done = append(done, strings.TrimSuffix(name, doneSuffix))
+		case strings.HasSuffix(name, readySuffix):
+			ready = append(ready, strings.TrimSuffix(name, readySuffix))
+		}
+	}
+	return done, ready, nil
+}
@@ -0,0 +1,31 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func TestCheckWalArchive(t *testing.T) {
+	done := []string{"000000010000000000000002", "000000010000000000000001", "00000002.history"}
+	ready := []string{"000000020000000000000003", "000000020000000000000004"}
+	archived := []string{"000000010000000000000001", "00000002.history", "000000020000000000000003"}
+
+	result := internal.CheckWalArchive(done, ready, archived)
+
+	assert.Equal(t, internal.WalArchiveCheckMissingStatus, result.Status)
+	assert.Equal(t, []string{"000000010000000000000002"}, result.MissingInStorage)
+	assert.Equal(t, []string{"000000020000000000000003"}, result.ArchivedButReady)
+	assert.Equal(t, 3, result.DoneCount)
+	assert.Equal(t, 2, result.ReadyCount)
+}
+
+func TestCheckWalArchive_Ok(t *testing.T) {
+	result := internal.CheckWalArchive([]string{"000000010000000000000001"}, []string{"000000010000000000000002"},
+		[]string{"000000010000000000000001"})
+
+	assert.Equal(t, internal.WalArchiveCheckOkStatus, result.Status)
+	assert.Empty(t, result.MissingInStorage)
+	assert.Empty(t, result.ArchivedButReady)
+}
@@ -0,0 +1,428 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/ioextensions"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	// WalBundlePath is the folder inside WAL folder where bundles of old WAL segments are stored
+	WalBundlePath = "bundles/"
+
+	DefaultWalBundleSegments = 256
+
+	walBundleSuffix      = ".bundle"
+	walBundleIndexSuffix = ".json"
+)
+
+// WalBundleEntry describes where WAL archive is stored inside a bundle
+type WalBundleEntry struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+}
+
+// WalBundleIndex lists WAL archives stored in a bundle. Archives are stored as is, i.e. compressed and encrypted.
+type WalBundleIndex struct {
+	Segments []WalBundleEntry `json:"segments"`
+}
+
+func (index WalBundleIndex) find(walFileName string) (WalBundleEntry, bool) {
+	for _, entry := range index.Segments {
+		if utility.TrimFileExtension(entry.Name) == walFileName {
+			return entry, true
+		}
+	}
+	return WalBundleEntry{}, false
+}
+
+// walBundleName is built from the last and the first bundled segments, so the bundle
+// is deleted with delete retain/before only when all its segments are older than the target.
+func walBundleName(first, last string) string {
+	return last + "_" + first
+}
+
+// parseWalBundleName returns timeline and range of segments of the bundle
+func parseWalBundleName(name string) (timeline uint32, first, last WalSegmentNo, err error) {
+	parts := strings.Split(name, "_")
+	if len(parts) != 2 {
+		return 0, 0, 0, errors.Errorf("invalid WAL bundle name '%s'", name)
+	}
+	timeline, lastNo, err := ParseWALFilename(parts[0])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	_, firstNo, err := ParseWALFilename(parts[1])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return timeline, WalSegmentNo(firstNo), WalSegmentNo(lastNo), nil
+}
+
+// TODO : unit tests
+// HandleWalBundle is invoked to perform wal-g wal-bundle.
+// It merges WAL archives older than the newest full backup into bundles of segmentsPerBundle segments.
+func HandleWalBundle(folder storage.Folder, segmentsPerBundle int) {
+	boundary, err := findNewestFullBackupSegmentNo(folder)
+	tracelog.ErrorLogger.FatalfOnError("Failed to find the newest full backup: %v\n", err)
+
+	walFolder := folder.GetSubFolder(utility.WalPath)
+	objects, _, err := walFolder.ListFolder()
+	tracelog.ErrorLogger.FatalfOnError("Failed to list WAL archives: %v\n", err)
+
+	groups := groupWalBundles(objects, boundary, segmentsPerBundle)
+	if len(groups) == 0 {
+		tracelog.InfoLogger.Println("No WAL archives older than the newest full backup to bundle")
+		return
+	}
+	for _, group := range groups {
+		err = uploadWalBundle(walFolder, group)
+		tracelog.ErrorLogger.FatalfOnError("Failed to bundle WAL archives: %v\n", err)
+	}
+}
+
+func findNewestFullBackupSegmentNo(folder storage.Folder) (WalSegmentNo, error) {
+	backups, err := GetBackups(folder)
+	if err != nil {
+		return 0, err
+	}
+	for _, backupTime := range backups {
+		sentinelDto, err := NewBackup(folder.GetSubFolder(utility.BaseBackupPath), backupTime.BackupName).GetSentinel()
+		if err != nil {
+			return 0, err
+		}
+		if sentinelDto.IsIncremental() {
+			continue
+		}
+		_, logSegNo, err := ParseWALFilename(backupTime.WalFileName)
+		if err != nil {
+			return 0, err
+		}
+		tracelog.InfoLogger.Printf("Bundling WAL archives older than full backup %s\n", backupTime.BackupName)
+		return WalSegmentNo(logSegNo), nil
+	}
+	return 0, NewNoBackupsFoundError()
+}
+
+// groupWalBundles groups WAL archives older than boundary into bundles of consecutive segments of one timeline.
+// History, backup history and partial files are not bundled.
+func groupWalBundles(objects []storage.Object, boundary WalSegmentNo, segmentsPerBundle int) [][]storage.Object {
+	segments := make([]storage.Object, 0, len(objects))
+	for _, object := range objects {
+		_, logSegNo, err := ParseWALFilename(utility.TrimFileExtension(object.GetName()))
+		if err == nil && WalSegmentNo(logSegNo) < boundary {
+			segments = append(segments, object)
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].GetName() < segments[j].GetName()
+	})
+
+	groups := make([][]storage.Object, 0)
+	var group []storage.Object
+	for _, segment := range segments {
+		if len(group) > 0 {
+			timeline := group[0].GetName()[:8]
+			if len(group) == segmentsPerBundle || segment.GetName()[:8] != timeline {
+				groups = append(groups, group)
+				group = nil
+			}
+		}
+		group = append(group, segment)
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// uploadWalBundle uploads the bundle and its index, then deletes bundled WAL archives
+func uploadWalBundle(walFolder storage.Folder, segments []storage.Object) error {
+	first := utility.TrimFileExtension(segments[0].GetName())
+	last := utility.TrimFileExtension(segments[len(segments)-1].GetName())
+	name := walBundleName(first, last)
+	tracelog.InfoLogger.Printf("Bundling %d WAL archives from %s to %s\n", len(segments), first, last)
+
+	index := WalBundleIndex{Segments: make([]WalBundleEntry, 0, len(segments))}
+	names := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		names = append(names, segment.GetName())
+	}
+
+	reader, writer := io.Pipe()
+	writeResult := make(chan error, 1)
+	go func() {
+		err := writeWalBundle(walFolder, names, &index, writer)
+		_ = writer.CloseWithError(err)
+		writeResult <- err
+	}()
+	bundleFolder := walFolder.GetSubFolder(WalBundlePath)
+	err := bundleFolder.PutObject(name+walBundleSuffix, reader)
+	_ = reader.Close()
+	if writeErr := <-writeResult; err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to upload WAL bundle '%s'", name)
+	}
+
+	indexBytes, err := json.Marshal(&index)
+	if err != nil {
+		return err
+	}
+	// the index is uploaded after the bundle, so bundles without index are ignored by wal-fetch
+	err = bundleFolder.PutObject(name+walBundleIndexSuffix, bytes.NewReader(indexBytes))
+	if err != nil {
+		return errors.Wrapf(err, "failed to upload index of WAL bundle '%s'", name)
+	}
+	return walFolder.DeleteObjects(names)
+}
+
+// writeWalBundle concatenates WAL archives and records their offsets in index
+func writeWalBundle(walFolder storage.Folder, names []string, index *WalBundleIndex, writer io.Writer) error {
+	offset := int64(0)
+	for _, name := range names {
+		segmentReader, err := walFolder.ReadObject(name)
+		if err != nil {
+			return err
+		}
+		size, err := io.Copy(writer, segmentReader)
+		utility.LoggedClose(segmentReader, "")
+		if err != nil {
+			return err
+		}
+		index.Segments = append(index.Segments, WalBundleEntry{Name: name, Offset: offset, Size: size})
+		offset += size
+	}
+	return nil
+}
+
+// readWalBundleIndexes reads indexes of bundles. If walFileName is not empty, only the bundle
+// which may contain it is read.
+func readWalBundleIndexes(walFolder storage.Folder, walFileName string) (map[string]WalBundleIndex, error) {
+	var timeline uint32
+	var segmentNo WalSegmentNo
+	if walFileName != "" {
+		segmentTimeline, logSegNo, err := ParseWALFilename(walFileName)
+		if err != nil {
+			return nil, nil
+		}
+		timeline, segmentNo = segmentTimeline, WalSegmentNo(logSegNo)
+	}
+
+	bundleFolder := walFolder.GetSubFolder(WalBundlePath)
+	objects, _, err := bundleFolder.ListFolder()
+	if err != nil {
+		return nil, err
+	}
+	indexes := make(map[string]WalBundleIndex)
+	for _, object := range objects {
+		if !strings.HasSuffix(object.GetName(), walBundleIndexSuffix) {
+			continue
+		}
+		name := strings.TrimSuffix(object.GetName(), walBundleIndexSuffix)
+		bundleTimeline, first, last, err := parseWalBundleName(name)
+		if err != nil {
+			continue
+		}
+		if walFileName != "" && (bundleTimeline != timeline || segmentNo < first || segmentNo > last) {
+			continue
+		}
+		index, err := readWalBundleIndex(bundleFolder, object.GetName())
+		if err != nil {
+			return nil, err
+		}
+		indexes[name] = index
+	}
+	return indexes, nil
+}
+
+func readWalBundleIndex(bundleFolder storage.Folder, indexName string) (WalBundleIndex, error) {
+	var index WalBundleIndex
+	reader, err := bundleFolder.ReadObject(indexName)
+	if err != nil {
+		return index, err
+	}
+	defer utility.LoggedClose(reader, "")
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return index, err
+	}
+	err = json.Unmarshal(data, &index)
+	return index, errors.Wrapf(err, "failed to parse index of WAL bundle '%s'", indexName)
+}
+
+// listBundledSegments returns names of WAL segments stored in bundles
+func listBundledSegments(walFolder storage.Folder) ([]string, error) {
+	indexes, err := readWalBundleIndexes(walFolder, "")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, index := range indexes {
+		for _, entry := range index.Segments {
+			names = append(names, utility.TrimFileExtension(entry.Name))
+		}
+	}
+	return names, nil
+}
+
+// walBundleCatalog caches the listing of bundles of a WAL folder and their indexes, so fetching many segments
+// in one process, e.g. by wal-prefetch, lists bundles once and reads each index once
+type walBundleCatalog struct {
+	mutex        sync.Mutex
+	bundleFolder storage.Folder
+	// bundleNames are names of bundles with uploaded indexes, nil until listed
+	bundleNames []string
+	listedAt    time.Time
+	// entries of read indexes by bundle name, then by segment name
+	entries map[string]map[string]WalBundleEntry
+}
+
+// walBundleListingTTL limits how long a miss is answered from the cached listing, since bundles are created concurrently
+const walBundleListingTTL = time.Minute
+
+// walBundleCatalogs holds catalogs of WAL folders used by the process
+var walBundleCatalogs sync.Map
+
+func getWalBundleCatalog(walFolder storage.Folder) *walBundleCatalog {
+	catalog := &walBundleCatalog{
+		bundleFolder: walFolder.GetSubFolder(WalBundlePath),
+		entries:      make(map[string]map[string]WalBundleEntry),
+	}
+	if !reflect.TypeOf(walFolder).Comparable() {
+		return catalog
+	}
+	cached, _ := walBundleCatalogs.LoadOrStore(walFolder, catalog)
+	return cached.(*walBundleCatalog)
+}
+
+// find returns the bundle holding the segment and its place in the bundle.
+// On a miss the listing is refreshed, unless it is fresh.
+func (catalog *walBundleCatalog) find(walFileName string) (string, WalBundleEntry, bool, error) {
+	segmentTimeline, logSegNo, err := ParseWALFilename(walFileName)
+	if err != nil {
+		return "", WalBundleEntry{}, false, nil
+	}
+	catalog.mutex.Lock()
+	defer catalog.mutex.Unlock()
+	if catalog.bundleNames == nil {
+		if err = catalog.list(); err != nil {
+			return "", WalBundleEntry{}, false, err
+		}
+	}
+	name, entry, ok, err := catalog.findListed(walFileName, segmentTimeline, WalSegmentNo(logSegNo))
+	if ok || err != nil || time.Since(catalog.listedAt) < walBundleListingTTL {
+		return name, entry, ok, err
+	}
+	if err = catalog.list(); err != nil {
+		return "", WalBundleEntry{}, false, err
+	}
+	return catalog.findListed(walFileName, segmentTimeline, WalSegmentNo(logSegNo))
+}
+
+func (catalog *walBundleCatalog) list() error {
+	objects, _, err := catalog.bundleFolder.ListFolder()
+	if err != nil {
+		return err
+	}
+	catalog.bundleNames = make([]string, 0, len(objects))
+	for _, object := range objects {
+		if strings.HasSuffix(object.GetName(), walBundleIndexSuffix) {
+			catalog.bundleNames = append(catalog.bundleNames, strings.TrimSuffix(object.GetName(), walBundleIndexSuffix))
+		}
+	}
+	catalog.listedAt = time.Now()
+	return nil
+}
+
+// findListed looks for the segment in listed bundles, reading indexes of bundles whose range contains it
+func (catalog *walBundleCatalog) findListed(walFileName string, timeline uint32,
+	segmentNo WalSegmentNo) (string, WalBundleEntry, bool, error) {
+	for _, name := range catalog.bundleNames {
+		bundleTimeline, first, last, err := parseWalBundleName(name)
+		if err != nil || bundleTimeline != timeline || segmentNo < first || segmentNo > last {
+			continue
+		}
+		entries, ok := catalog.entries[name]
+		if !ok {
+			index, err := readWalBundleIndex(catalog.bundleFolder, name+walBundleIndexSuffix)
+			if err != nil {
+				return "", WalBundleEntry{}, false, err
+			}
+			entries = make(map[string]WalBundleEntry, len(index.Segments))
+			for _, entry := range index.Segments {
+				entries[utility.TrimFileExtension(entry.Name)] = entry
+			}
+			catalog.entries[name] = entries
+		}
+		if entry, ok := entries[walFileName]; ok {
+			return name, entry, true, nil
+		}
+	}
+	return "", WalBundleEntry{}, false, nil
+}
+
+// readWalBundleRange reads size bytes of the bundle starting from offset.
+// Seekable objects, e.g. local files, are seeked, other objects are read sequentially skipping the bytes before offset.
+func readWalBundleRange(bundleFolder storage.Folder, bundleName string, offset, size int64) (io.ReadCloser, error) {
+	bundleReader, err := bundleFolder.ReadObject(bundleName)
+	if err != nil {
+		return nil, err
+	}
+	if seeker, ok := bundleReader.(io.Seeker); ok {
+		_, err = seeker.Seek(offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(ioutil.Discard, bundleReader, offset)
+	}
+	if err != nil {
+		utility.LoggedClose(bundleReader, "")
+		return nil, errors.Wrapf(err, "failed to read WAL bundle '%s'", bundleName)
+	}
+	return &ioextensions.ReadCascadeCloser{
+		Reader: io.LimitReader(bundleReader, size),
+		Closer: bundleReader,
+	}, nil
+}
+
+// downloadAndDecompressBundledWALFile looks for WAL file in bundles
+func downloadAndDecompressBundledWALFile(walFolder storage.Folder, walFileName string) (io.ReadCloser, error) {
+	catalog := getWalBundleCatalog(walFolder)
+	name, entry, ok, err := catalog.find(walFileName)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, newArchiveNonExistenceError(walFileName)
+	}
+	decompressor := compression.FindDecompressor(utility.GetFileExtension(entry.Name))
+	if decompressor == nil {
+		return nil, errors.Errorf("unknown compression of bundled WAL archive '%s'", entry.Name)
+	}
+	archiveReader, err := readWalBundleRange(catalog.bundleFolder, name+walBundleSuffix, entry.Offset, entry.Size)
+	if err != nil {
+		return nil, err
+	}
+	tracelog.InfoLogger.Printf("Fetching %s from WAL bundle %s\n", walFileName, name)
+	reader, writer := io.Pipe()
+	go func() {
+		err := DecompressDecryptBytes(&EmptyWriteIgnorer{writer}, archiveReader, decompressor, LogContentType)
+		utility.LoggedClose(archiveReader, "")
+		_ = writer.CloseWithError(err)
+	}()
+	return reader, nil
+}
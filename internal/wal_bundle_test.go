@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/storages/fs"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/internal/ioextensions"
+)
+
+func putCompressedWal(t *testing.T, walFolder *memory.Folder, name string) {
+	var buffer bytes.Buffer
+	writer := lz4.Compressor{}.NewWriter(&buffer)
+	_, err := writer.Write([]byte("data of " + name))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	assert.NoError(t, walFolder.PutObject(name+"."+lz4.FileExtension, &buffer))
+}
+
+func TestWalBundleName(t *testing.T) {
+	name := walBundleName("000000010000000000000001", "0000000100000000000000FF")
+	assert.Equal(t, "0000000100000000000000FF_000000010000000000000001", name)
+
+	timeline, first, last, err := parseWalBundleName(name)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), timeline)
+	assert.Equal(t, WalSegmentNo(1), first)
+	assert.Equal(t, WalSegmentNo(0xFF), last)
+
+	_, _, _, err = parseWalBundleName("000000010000000000000001")
+	assert.Error(t, err)
+}
+
+func TestWalBundleUploadAndFetch(t *testing.T) {
+	walFolder := memory.NewFolder("in_memory/", memory.NewStorage())
+	for _, name := range []string{"000000010000000000000001", "000000010000000000000002",
+		"000000010000000000000003", "000000020000000000000003", "000000020000000000000004"} {
+		putCompressedWal(t, walFolder, name)
+	}
+	assert.NoError(t, walFolder.PutObject("00000002.history.lz4", bytes.NewReader([]byte("history"))))
+
+	objects, _, err := walFolder.ListFolder()
+	assert.NoError(t, err)
+	groups := groupWalBundles(objects, WalSegmentNo(4), 2)
+	groupNames := make([][]string, 0, len(groups))
+	for _, group := range groups {
+		names := make([]string, 0, len(group))
+		for _, object := range group {
+			names = append(names, object.GetName())
+		}
+		groupNames = append(groupNames, names)
+	}
+	assert.Equal(t, [][]string{
+		{"000000010000000000000001.lz4", "000000010000000000000002.lz4"},
+		{"000000010000000000000003.lz4"},
+		{"000000020000000000000003.lz4"},
+	}, groupNames)
+
+	for _, group := range groups {
+		assert.NoError(t, uploadWalBundle(walFolder, group))
+	}
+	exists, err := walFolder.Exists("000000010000000000000002.lz4")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	reader, err := DownloadAndDecompressWALFile(walFolder, "000000010000000000000002")
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "data of 000000010000000000000002", string(data))
+
+	// not bundled segment is fetched as usual
+	reader, err = DownloadAndDecompressWALFile(walFolder, "000000020000000000000004")
+	assert.NoError(t, err)
+	data, err = ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "data of 000000020000000000000004", string(data))
+
+	_, err = DownloadAndDecompressWALFile(walFolder, "000000010000000000000004")
+	assert.IsType(t, ArchiveNonExistenceError{}, err)
+
+	bundled, err := listBundledSegments(walFolder)
+	assert.NoError(t, err)
+	sort.Strings(bundled)
+	assert.Equal(t, []string{"000000010000000000000001", "000000010000000000000002",
+		"000000010000000000000003", "000000020000000000000003"}, bundled)
+}
+
+// listCountingFolder counts listings of its bundles folder
+type listCountingFolder struct {
+	storage.Folder
+	listings *int
+}
+
+func (folder listCountingFolder) GetSubFolder(subFolderRelativePath string) storage.Folder {
+	return listCountingFolder{folder.Folder.GetSubFolder(subFolderRelativePath), folder.listings}
+}
+
+func (folder listCountingFolder) ListFolder() ([]storage.Object, []storage.Folder, error) {
+	*folder.listings++
+	return folder.Folder.ListFolder()
+}
+
+func TestWalBundleCatalog_ListsBundlesOnce(t *testing.T) {
+	memoryFolder := memory.NewFolder("in_memory/", memory.NewStorage())
+	names := []string{"000000010000000000000001", "000000010000000000000002", "000000010000000000000003"}
+	for _, name := range names {
+		putCompressedWal(t, memoryFolder, name)
+	}
+	objects, _, err := memoryFolder.ListFolder()
+	assert.NoError(t, err)
+	assert.NoError(t, uploadWalBundle(memoryFolder, groupWalBundles(objects, WalSegmentNo(4), 3)[0]))
+
+	listings := 0
+	walFolder := listCountingFolder{memoryFolder, &listings}
+	for _, name := range names {
+		reader, err := downloadAndDecompressBundledWALFile(walFolder, name)
+		assert.NoError(t, err)
+		data, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, "data of "+name, string(data))
+	}
+	_, err = downloadAndDecompressBundledWALFile(walFolder, "000000010000000000000004")
+	assert.IsType(t, ArchiveNonExistenceError{}, err)
+	assert.Equal(t, 1, listings)
+}
+
+func TestReadWalBundleRange_SeeksLocalFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal_bundle")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	folder := fs.NewFolder(dir, "")
+	assert.NoError(t, folder.PutObject("bundle", bytes.NewReader([]byte("0123456789"))))
+
+	reader, err := readWalBundleRange(folder, "bundle", 3, 4)
+	assert.NoError(t, err)
+	defer reader.Close()
+	_, isFile := reader.(*ioextensions.ReadCascadeCloser).Closer.(*os.File)
+	assert.True(t, isFile)
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "3456", string(data))
+}
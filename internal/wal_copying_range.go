@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const timelineHistorySuffix = ".history"
+
+// walCopyingRange selects WAL needed to restore a backup: segments of the backup timeline from the backup start to last.
+// With history segments of later timelines which descend from the backup timeline are selected too,
+// each one from the segment it was switched at.
+type walCopyingRange struct {
+	// firstSegments are the first segments needed on each selected timeline
+	firstSegments map[uint32]WalSegmentNo
+	last          WalSegmentNo
+}
+
+// newWalCopyingRange builds the range of WAL from the backup start to its finish,
+// or with history to lastSegmentNo (unlimited if it is nil).
+// Timelines of the history are found by history files among objects of the folder.
+func newWalCopyingRange(backup *Backup, folder storage.Folder, objects []storage.Object,
+	withHistory bool, lastSegmentNo *WalSegmentNo) (walCopyingRange, error) {
+	meta, err := backup.fetchMeta()
+	if err != nil {
+		return walCopyingRange{}, err
+	}
+	startWalFilename, err := getBackupStartWalFilename(backup.Name)
+	if err != nil {
+		return walCopyingRange{}, err
+	}
+	timeline, _, err := ParseWALFilename(startWalFilename)
+	if err != nil {
+		return walCopyingRange{}, err
+	}
+	walRange := walCopyingRange{
+		firstSegments: map[uint32]WalSegmentNo{timeline: newWalSegmentNo(meta.StartLsn)},
+		last:          newWalSegmentNo(meta.FinishLsn - 1),
+	}
+	if !withHistory {
+		return walRange, nil
+	}
+	walRange.last = WalSegmentNo(math.MaxUint64)
+	if lastSegmentNo != nil {
+		walRange.last = *lastSegmentNo
+	}
+	walFolder := folder.GetSubFolder(utility.WalPath)
+	for _, laterTimeline := range listHistoryTimelines(objects) {
+		if laterTimeline <= timeline {
+			continue
+		}
+		history, err := downloadTimelineHistory(walFolder, laterTimeline)
+		if err != nil {
+			return walCopyingRange{}, errors.Wrapf(err, "failed to read history of timeline %d", laterTimeline)
+		}
+		if len(history) == 0 || !descendsFromBackup(history, timeline, meta.StartLsn) {
+			continue
+		}
+		walRange.firstSegments[laterTimeline] = newWalSegmentNo(history[len(history)-1].SwitchLsn)
+	}
+	return walRange, nil
+}
+
+// getBackupStartWalFilename returns the name of the WAL segment the backup was started at, e.g. for base_000000010000000000000002
+func getBackupStartWalFilename(backupName string) (string, error) {
+	if !strings.HasPrefix(backupName, utility.BackupNamePrefix) || len(backupName) < len(utility.BackupNamePrefix)+24 {
+		return "", errors.Errorf("failed to find start WAL segment of backup '%s'", backupName)
+	}
+	return backupName[len(utility.BackupNamePrefix) : len(utility.BackupNamePrefix)+24], nil
+}
+
+// listHistoryTimelines returns timelines of history files among objects listed recursively from the storage root
+func listHistoryTimelines(objects []storage.Object) []uint32 {
+	timelines := make([]uint32, 0)
+	for _, object := range objects {
+		if !strings.HasPrefix(object.GetName(), utility.WalPath) {
+			continue
+		}
+		name := utility.TrimFileExtension(strings.TrimPrefix(object.GetName(), utility.WalPath))
+		if timeline, ok := parseTimelineHistoryFilename(name); ok {
+			timelines = append(timelines, timeline)
+		}
+	}
+	return timelines
+}
+
+// descendsFromBackup checks if the timeline with the history was switched from the backup timeline after the backup start
+func descendsFromBackup(history []TimelineHistoryRecord, backupTimeline uint32, backupStartLsn uint64) bool {
+	for _, record := range history {
+		if record.Timeline == backupTimeline {
+			return record.SwitchLsn > backupStartLsn
+		}
+	}
+	return false
+}
+
+// contains checks the name of a WAL archive, a bundle or a timeline history file relative to the WAL folder
+func (walRange walCopyingRange) contains(name string) bool {
+	name = utility.TrimFileExtension(name)
+	if strings.HasPrefix(name, WalBundlePath) {
+		timeline, first, last, err := parseWalBundleName(strings.TrimPrefix(name, WalBundlePath))
+		return err == nil && walRange.containsSegments(timeline, first, last)
+	}
+	if timeline, ok := parseTimelineHistoryFilename(name); ok {
+		_, selected := walRange.firstSegments[timeline]
+		return selected
+	}
+	timeline, segmentNo, err := ParseWALFilename(strings.TrimSuffix(name, PartialWalSuffix))
+	return err == nil && walRange.containsSegments(timeline, WalSegmentNo(segmentNo), WalSegmentNo(segmentNo))
+}
+
+// containsSegments checks if segments from first to last of the timeline intersect with the range
+func (walRange walCopyingRange) containsSegments(timeline uint32, first, last WalSegmentNo) bool {
+	firstSegment, ok := walRange.firstSegments[timeline]
+	return ok && first <= walRange.last && last >= firstSegment
+}
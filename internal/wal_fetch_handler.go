@@ -16,6 +16,7 @@ import (
 	"github.com/wal-g/storages/storage"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/crypto"
 	"github.com/wal-g/wal-g/internal/ioextensions"
 	"github.com/wal-g/wal-g/utility"
 )
@@ -99,7 +100,14 @@ func HandleWALFetch(folder storage.Folder, walFileName string, location string,
 		time.Sleep(50 * time.Millisecond)
 	}
 
-	err := DownloadWALFileTo(folder, walFileName, location)
+	retryPolicy, err := getWalFetchRetryPolicy()
+	tracelog.ErrorLogger.FatalOnError(err)
+	err = downloadWALFileOrPartialWithRetries(folder, walFileName, location, retryPolicy)
+	if _, isHistory := parseTimelineHistoryFilename(walFileName); isHistory && isWalFileNotFound(err) {
+		// Postgres looks for histories of later timelines on every recovery start, most of them don't exist
+		tracelog.InfoLogger.Printf("Timeline history %s is not archived\n", walFileName)
+		os.Exit(1)
+	}
 	tracelog.ErrorLogger.FatalOnError(err)
 }
 
@@ -135,8 +143,14 @@ func TryDownloadFile(folder storage.Folder, path string) (walFileReader io.ReadC
 }
 
 // TODO : unit tests
-func DecompressDecryptBytes(dst io.Writer, archiveReader io.ReadCloser, decompressor compression.Decompressor) error {
-	crypter := ConfigureCrypter()
+func DecompressDecryptBytes(dst io.Writer, archiveReader io.ReadCloser, decompressor compression.Decompressor,
+	contentType ContentType) error {
+	return DecompressDecryptBytesWith(dst, archiveReader, decompressor, ConfigureCrypterForContentType(contentType))
+}
+
+// DecompressDecryptBytesWith decrypts the archive with the given crypter, if it's not nil, and decompresses it
+func DecompressDecryptBytesWith(dst io.Writer, archiveReader io.ReadCloser, decompressor compression.Decompressor,
+	crypter crypto.Crypter) error {
 	if crypter != nil {
 		reader, err := crypter.Decrypt(archiveReader)
 		if err != nil {
@@ -222,6 +236,13 @@ func putCachedDecompressorInFirstPlace(decompressors []compression.Decompressor)
 
 // TODO : unit tests
 func DownloadAndDecompressWALFile(folder storage.Folder, walFileName string) (io.ReadCloser, error) {
+	return DownloadAndDecompressWALFileWith(folder, walFileName, ConfigureCrypterForContentType(LogContentType))
+}
+
+// DownloadAndDecompressWALFileWith downloads the log file decrypting it with the given crypter,
+// e.g. the one checking the metadata of the file
+func DownloadAndDecompressWALFileWith(folder storage.Folder, walFileName string,
+	crypter crypto.Crypter) (io.ReadCloser, error) {
 	for _, decompressor := range putCachedDecompressorInFirstPlace(compression.Decompressors) {
 		archiveReader, exists, err := TryDownloadFile(folder, walFileName+"."+decompressor.FileExtension())
 		if err != nil {
@@ -233,12 +254,12 @@ func DownloadAndDecompressWALFile(folder storage.Folder, walFileName string) (io
 		_ = SetLastDecompressor(decompressor)
 		reader, writer := io.Pipe()
 		go func() {
-			err = DecompressDecryptBytes(&EmptyWriteIgnorer{writer}, archiveReader, decompressor)
+			err = DecompressDecryptBytesWith(&EmptyWriteIgnorer{writer}, archiveReader, decompressor, crypter)
 			_ = writer.CloseWithError(err)
 		}()
 		return reader, nil
 	}
-	return nil, newArchiveNonExistenceError(walFileName)
+	return downloadAndDecompressBundledWALFile(folder, walFileName)
 }
 
 // TODO : unit tests
@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+)
+
+const walFetchBreakerFileName = "wal_fetch_breaker.json"
+
+type WalFetchBreakerOpenError struct {
+	error
+}
+
+func newWalFetchBreakerOpenError(openUntil time.Time, failures int) WalFetchBreakerOpenError {
+	return WalFetchBreakerOpenError{errors.Errorf(
+		"Storage failed %d times in a row, WAL is not fetched until %s", failures, openUntil.Format(time.RFC3339))}
+}
+
+func (err WalFetchBreakerOpenError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// walFetchRetryPolicy describes retries of WAL download after transient storage errors.
+// Missing WAL files are never retried: Postgres calls restore_command again when it needs the file.
+type walFetchRetryPolicy struct {
+	retries int
+	minWait time.Duration
+	maxWait time.Duration
+	// breakerThreshold is the number of consecutive failed wal-fetch runs after which the breaker opens, 0 disables it
+	breakerThreshold int
+	breakerCooldown  time.Duration
+}
+
+// walFetchBreakerState is shared by wal-fetch runs through a file next to the restored WAL
+type walFetchBreakerState struct {
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	OpenUntil           time.Time `json:"open_until"`
+}
+
+func getWalFetchRetryPolicy() (walFetchRetryPolicy, error) {
+	policy := walFetchRetryPolicy{
+		retries:          viper.GetInt(WalFetchRetriesSetting),
+		breakerThreshold: viper.GetInt(WalFetchBreakerSetting),
+	}
+	var err error
+	if policy.minWait, err = GetDurationSetting(WalFetchRetryWaitSetting); err != nil {
+		return policy, err
+	}
+	if policy.maxWait, err = GetDurationSetting(WalFetchMaxRetryWaitSetting); err != nil {
+		return policy, err
+	}
+	if policy.breakerCooldown, err = GetDurationSetting(WalFetchCooldownSetting); err != nil {
+		return policy, err
+	}
+	return policy, nil
+}
+
+// downloadWALFileWithRetries downloads WAL file retrying transient errors with exponential backoff.
+// If the circuit breaker is open, storage is not accessed at all, so recovery doesn't hammer an unavailable storage.
+func downloadWALFileWithRetries(folder storage.Folder, walFileName, location string, policy walFetchRetryPolicy) error {
+	breakerPath := path.Join(path.Dir(location), ".wal-g", walFetchBreakerFileName)
+	breakerState := readWalFetchBreakerState(breakerPath, policy)
+	if time.Now().Before(breakerState.OpenUntil) {
+		return newWalFetchBreakerOpenError(breakerState.OpenUntil, breakerState.ConsecutiveFailures)
+	}
+
+	err := downloadWALFileRetrying(folder, walFileName, location, policy)
+	if err == nil || isWalFileNotFound(err) {
+		// storage answered, so it is available even if the file is not archived yet
+		breakerState = walFetchBreakerState{}
+	} else {
+		breakerState.ConsecutiveFailures++
+		if policy.breakerThreshold > 0 && breakerState.ConsecutiveFailures >= policy.breakerThreshold {
+			breakerState.OpenUntil = time.Now().Add(policy.breakerCooldown)
+			tracelog.ErrorLogger.Printf("Storage failed %d times in a row, WAL fetching is paused until %s\n",
+				breakerState.ConsecutiveFailures, breakerState.OpenUntil.Format(time.RFC3339))
+		}
+	}
+	writeWalFetchBreakerState(breakerPath, breakerState, policy)
+	return err
+}
+
+func downloadWALFileRetrying(folder storage.Folder, walFileName, location string, policy walFetchRetryPolicy) error {
+	retrier := newExponentialRetrier(policy.minWait, policy.maxWait)
+	for attempt := 1; ; attempt++ {
+		err := DownloadWALFileTo(folder, walFileName, location)
+		if err == nil || isWalFileNotFound(err) || os.IsExist(err) {
+			return err
+		}
+		// remove partially written file, so the next attempt can create it
+		_ = os.Remove(location)
+		if attempt > policy.retries {
+			return errors.Wrapf(err, "failed to fetch %s after %d attempts", walFileName, attempt)
+		}
+		tracelog.WarningLogger.Printf("Failed to fetch %s (attempt %d of %d), retrying: %v\n",
+			walFileName, attempt, policy.retries+1, err)
+		retrier.retry()
+	}
+}
+
+func isWalFileNotFound(err error) bool {
+	_, ok := errors.Cause(err).(ArchiveNonExistenceError)
+	return ok
+}
+
+func readWalFetchBreakerState(breakerPath string, policy walFetchRetryPolicy) walFetchBreakerState {
+	state := walFetchBreakerState{}
+	if policy.breakerThreshold <= 0 {
+		return state
+	}
+	data, err := ioutil.ReadFile(breakerPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			tracelog.WarningLogger.Printf("Failed to read WAL fetch breaker state: %v\n", err)
+		}
+		return state
+	}
+	if err = json.Unmarshal(data, &state); err != nil {
+		tracelog.WarningLogger.Printf("Failed to unmarshal WAL fetch breaker state: %v\n", err)
+		return walFetchBreakerState{}
+	}
+	return state
+}
+
+func writeWalFetchBreakerState(breakerPath string, state walFetchBreakerState, policy walFetchRetryPolicy) {
+	if policy.breakerThreshold <= 0 {
+		return
+	}
+	if state.ConsecutiveFailures == 0 {
+		err := os.Remove(breakerPath)
+		if err != nil && !os.IsNotExist(err) {
+			tracelog.WarningLogger.Printf("Failed to reset WAL fetch breaker state: %v\n", err)
+		}
+		return
+	}
+	data, err := json.Marshal(state)
+	if err == nil {
+		err = os.MkdirAll(path.Dir(breakerPath), 0700)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(breakerPath, data, 0600)
+	}
+	if err != nil {
+		tracelog.WarningLogger.Printf("Failed to save WAL fetch breaker state: %v\n", err)
+	}
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/storages/memory"
+	"github.com/wal-g/storages/storage"
+)
+
+// flakyFolder fails the given number of reads before it starts to work
+type flakyFolder struct {
+	storage.Folder
+	failures *int
+}
+
+func (folder *flakyFolder) GetSubFolder(subFolderRelativePath string) storage.Folder {
+	return &flakyFolder{folder.Folder.GetSubFolder(subFolderRelativePath), folder.failures}
+}
+
+func (folder *flakyFolder) ReadObject(objectRelativePath string) (io.ReadCloser, error) {
+	if *folder.failures > 0 {
+		*folder.failures--
+		return nil, errors.New("injected failure")
+	}
+	return folder.Folder.ReadObject(objectRelativePath)
+}
+
+func newWalFetchRetryTestFolder(t *testing.T, failures int) *flakyFolder {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	require.NoError(t, folder.PutObject("000000010000000000000001.lz4", bytes.NewBufferString("")))
+	return &flakyFolder{folder, &failures}
+}
+
+func TestDownloadWALFileWithRetries_RetriesTransientErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal_fetch_retry")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	folder := newWalFetchRetryTestFolder(t, 2)
+	policy := walFetchRetryPolicy{retries: 2, minWait: time.Millisecond, maxWait: time.Millisecond}
+
+	err = downloadWALFileWithRetries(folder, "000000010000000000000001", filepath.Join(dir, "wal"), policy)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, *folder.failures)
+}
+
+func TestDownloadWALFileWithRetries_DoesNotRetryMissingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal_fetch_retry")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	folder := newWalFetchRetryTestFolder(t, 0)
+	policy := walFetchRetryPolicy{retries: 2, minWait: time.Hour, maxWait: time.Hour}
+
+	err = downloadWALFileWithRetries(folder, "000000010000000000000002", filepath.Join(dir, "wal"), policy)
+	assert.True(t, isWalFileNotFound(err))
+}
+
+func TestDownloadWALFileWithRetries_BreakerOpens(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal_fetch_retry")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	folder := newWalFetchRetryTestFolder(t, 2)
+	policy := walFetchRetryPolicy{breakerThreshold: 2, breakerCooldown: time.Hour}
+	location := filepath.Join(dir, "wal")
+
+	err = downloadWALFileWithRetries(folder, "000000010000000000000001", location, policy)
+	assert.Error(t, err)
+	err = downloadWALFileWithRetries(folder, "000000010000000000000001", location, policy)
+	assert.Error(t, err)
+
+	// storage is healthy now, but the breaker is open
+	err = downloadWALFileWithRetries(folder, "000000010000000000000001", location, policy)
+	assert.IsType(t, WalFetchBreakerOpenError{}, err)
+	_, err = os.Stat(location)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// WalPrefetchRangeOptions describe which WAL wal-prefetch --range downloads and where
+type WalPrefetchRangeOptions struct {
+	// Range is start:end, where both bounds are segment names or LSNs, the end is inclusive
+	Range string
+	// Timeline is used for bounds given as LSNs
+	Timeline uint32
+	// Direct puts segments to the directory itself instead of the prefetch spool used by wal-fetch
+	Direct      bool
+	Concurrency int
+}
+
+// HandleWALPrefetchRange downloads a range of WAL segments with parallel workers before recovery starts.
+// By default segments are put to the prefetch spool of the directory, where wal-fetch finds them.
+func HandleWALPrefetchRange(folder storage.Folder, directory string, options WalPrefetchRangeOptions) {
+	directory = utility.ResolveSymlink(directory)
+	segments, err := getWalPrefetchRangeSegments(folder.GetSubFolder(utility.WalPath), options)
+	tracelog.ErrorLogger.FatalfOnError("Invalid WAL range: %v\n", err)
+	if limit := getPrefetchSpoolLimit(); !options.Direct && limit > 0 && len(segments) > limit {
+		tracelog.WarningLogger.Printf("%d segments are prefetched, but wal-fetch trims the spool to %s=%d\n",
+			len(segments), PrefetchSpoolLimitSetting, limit)
+	}
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency, err = getMaxDownloadConcurrency()
+		tracelog.ErrorLogger.FatalOnError(err)
+	}
+	policy, err := getWalFetchRetryPolicy()
+	tracelog.ErrorLogger.FatalOnError(err)
+	err = prefetchWalSegments(folder.GetSubFolder(utility.WalPath), directory, segments,
+		options.Direct, concurrency, policy)
+	tracelog.ErrorLogger.FatalfOnError("Failed to prefetch WAL: %v\n", err)
+}
+
+// getWalPrefetchRangeSegments returns names of segments of the range.
+// If the end is on a later timeline, segments of earlier timelines are selected according to its history.
+func getWalPrefetchRangeSegments(walFolder storage.Folder, options WalPrefetchRangeOptions) ([]string, error) {
+	bounds := strings.Split(options.Range, ":")
+	if len(bounds) != 2 {
+		return nil, errors.Errorf("range '%s' is not start:end", options.Range)
+	}
+	startTimeline, startLsn, err := parseWalRangeBound(bounds[0], options.Timeline)
+	if err != nil {
+		return nil, err
+	}
+	endTimeline, endLsn, err := parseWalRangeBound(bounds[1], options.Timeline)
+	if err != nil {
+		return nil, err
+	}
+	if endLsn < startLsn || endTimeline < startTimeline {
+		return nil, errors.Errorf("end of range '%s' is before its start", options.Range)
+	}
+	var history []TimelineHistoryRecord
+	if endTimeline != startTimeline {
+		history, err = downloadTimelineHistory(walFolder, endTimeline)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return getTimelineSegmentNames(history, endTimeline, startLsn, endLsn), nil
+}
+
+// parseWalRangeBound parses a segment name, or an LSN on the timeline
+func parseWalRangeBound(bound string, timeline uint32) (uint32, uint64, error) {
+	if isWalFilename(bound) {
+		segmentTimeline, segmentNo, _ := ParseWALFilename(bound)
+		return segmentTimeline, WalSegmentNo(segmentNo).firstLsn(), nil
+	}
+	lsn, err := pgx.ParseLSN(bound)
+	if err != nil {
+		return 0, 0, errors.Errorf("'%s' is neither a WAL segment name nor an LSN", bound)
+	}
+	return timeline, lsn, nil
+}
+
+// prefetchWalSegments downloads segments which are not in the directory yet.
+// Segments are downloaded to the running location of the spool first, so a partial segment is never seen.
+// Segments missing in storage are skipped with a warning, since the end of the range may be not archived yet.
+func prefetchWalSegments(walFolder storage.Folder, directory string, segments []string,
+	direct bool, concurrency int, policy walFetchRetryPolicy) error {
+	prefetchLocation, runningLocation, _, _ := getPrefetchLocations(directory, "")
+	if err := os.MkdirAll(runningLocation, 0755); err != nil {
+		return err
+	}
+	if direct {
+		prefetchLocation = directory
+	}
+	tracelog.InfoLogger.Printf("Prefetching %d segments to %s with %d workers\n",
+		len(segments), prefetchLocation, concurrency)
+
+	var fetched, missing int32
+	var firstErr error
+	var errMutex sync.Mutex
+	waitGroup := &sync.WaitGroup{}
+	downloadSemaphore := make(chan struct{}, concurrency)
+	for _, segment := range segments {
+		_, _, runningPath, prefetchedPath := getPrefetchLocations(directory, segment)
+		targetPath := prefetchedPath
+		if direct {
+			targetPath = path.Join(directory, segment)
+		}
+		if isWalPrefetched(directory, segment, targetPath) {
+			continue
+		}
+		waitGroup.Add(1)
+		downloadSemaphore <- struct{}{}
+		go func(segment, runningPath, targetPath string) {
+			defer func() {
+				<-downloadSemaphore
+				waitGroup.Done()
+			}()
+			_ = os.Remove(runningPath)
+			err := downloadWALFileRetrying(walFolder, segment, runningPath, policy)
+			if err == nil {
+				err = os.Rename(runningPath, targetPath)
+			}
+			if isWalFileNotFound(err) {
+				tracelog.WarningLogger.Printf("Segment %s is not archived\n", segment)
+				atomic.AddInt32(&missing, 1)
+				return
+			}
+			if err != nil {
+				_ = os.Remove(runningPath)
+				errMutex.Lock()
+				if firstErr == nil {
+					firstErr = errors.Wrapf(err, "failed to prefetch %s", segment)
+				}
+				errMutex.Unlock()
+				return
+			}
+			tracelog.DebugLogger.Printf("Prefetched %s\n", segment)
+			atomic.AddInt32(&fetched, 1)
+		}(segment, runningPath, targetPath)
+	}
+	waitGroup.Wait()
+	tracelog.InfoLogger.Printf("Prefetched %d segments, %d are not archived\n", fetched, missing)
+	return firstErr
+}
+
+// isWalPrefetched checks if the segment is already in the directory or in its prefetch spool
+func isWalPrefetched(directory, segment, targetPath string) bool {
+	for _, segmentPath := range []string{targetPath, filepath.Join(directory, segment)} {
+		if _, err := os.Stat(segmentPath); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/storages/memory"
+)
+
+func TestGetWalPrefetchRangeSegments(t *testing.T) {
+	walFolder := memory.NewFolder("in_memory/", memory.NewStorage())
+
+	segments, err := getWalPrefetchRangeSegments(walFolder,
+		WalPrefetchRangeOptions{Range: "000000010000000000000003:0/5000010", Timeline: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"000000010000000000000003",
+		"000000010000000000000004",
+		"000000010000000000000005",
+	}, segments)
+
+	_, err = getWalPrefetchRangeSegments(walFolder, WalPrefetchRangeOptions{Range: "0/5000000:0/3000000"})
+	assert.Error(t, err)
+	_, err = getWalPrefetchRangeSegments(walFolder, WalPrefetchRangeOptions{Range: "000000010000000000000003"})
+	assert.Error(t, err)
+}
+
+func TestPrefetchWalSegments(t *testing.T) {
+	walFolder := memory.NewFolder("in_memory/", memory.NewStorage())
+	for _, name := range []string{"000000010000000000000003.lz4", "000000010000000000000004.lz4"} {
+		assert.NoError(t, walFolder.PutObject(name, &bytes.Buffer{}))
+	}
+	directory, err := ioutil.TempDir("", "pg_wal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	segments := []string{"000000010000000000000003", "000000010000000000000004", "000000010000000000000005"}
+	err = prefetchWalSegments(walFolder, directory, segments, false, 2, walFetchRetryPolicy{})
+	assert.NoError(t, err)
+	prefetchLocation, _, _, _ := getPrefetchLocations(directory, "")
+	files, err := ioutil.ReadDir(prefetchLocation)
+	assert.NoError(t, err)
+	names := make([]string, 0)
+	for _, file := range files {
+		if !file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	assert.Equal(t, segments[:2], names)
+
+	err = prefetchWalSegments(walFolder, directory, segments, true, 2, walFetchRetryPolicy{})
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(directory, "000000010000000000000003"))
+	assert.NoError(t, err)
+}
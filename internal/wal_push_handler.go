@@ -39,6 +39,8 @@ func HandleWALPush(uploader *WalUploader, walFilePath string) {
 
 	uploader.UploadingFolder = uploader.UploadingFolder.GetSubFolder(utility.WalPath)
 
+	err := runPushHook(WalPushPreHookSetting, hookWalFilePathEnv+"="+walFilePath)
+	tracelog.ErrorLogger.FatalOnError(err)
 	concurrency, err := getMaxUploadConcurrency()
 	tracelog.ErrorLogger.FatalOnError(err)
 
@@ -50,11 +52,18 @@ func HandleWALPush(uploader *WalUploader, walFilePath string) {
 	bgUploader.Start()
 	err = uploadWALFile(uploader, walFilePath, bgUploader.preventWalOverwrite)
 	tracelog.ErrorLogger.FatalOnError(err)
+	logTimelineSwitch(walFilePath)
 
-	bgUploader.Stop()
+	if viper.GetBool(WalPushBatchSetting) {
+		bgUploader.StopWhenDrained()
+	} else {
+		bgUploader.Stop()
+	}
 	if uploader.getUseWalDelta() {
 		uploader.FlushFiles()
 	}
+	err = runPushHook(WalPushPostHookSetting, hookWalFilePathEnv+"="+walFilePath)
+	tracelog.ErrorLogger.FatalOnError(err)
 } //
 
 // TODO : unit tests
@@ -0,0 +1,517 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgproto3"
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	// walReceiveStatusInterval is how often standby status is sent to the server,
+	// it must be less than wal_sender_timeout
+	walReceiveStatusInterval = 10 * time.Second
+
+	PartialWalSuffix = ".partial"
+)
+
+type WalStreamGapError struct {
+	error
+}
+
+func newWalStreamGapError(expectedLsn, receivedLsn uint64) WalStreamGapError {
+	return WalStreamGapError{errors.Errorf("WAL stream has a gap: expected data from %s, received from %s",
+		pgx.FormatLSN(expectedLsn), pgx.FormatLSN(receivedLsn))}
+}
+
+func (err WalStreamGapError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// WalSegmentReceiver collects WAL streamed by the server into segments and uploads complete ones
+type WalSegmentReceiver struct {
+	timeline      uint32
+	segmentNo     WalSegmentNo
+	segment       []byte
+	received      uint64
+	uploadSegment func(name string, data []byte) error
+	deleteSegment func(name string) error
+	// partialUploaded is set if the current segment may have been uploaded with PartialWalSuffix,
+	// including by the previous run of wal-receive
+	partialUploaded bool
+}
+
+func NewWalSegmentReceiver(timeline uint32, startSegmentNo WalSegmentNo,
+	uploadSegment func(name string, data []byte) error, deleteSegment func(name string) error) *WalSegmentReceiver {
+	return &WalSegmentReceiver{
+		timeline:        timeline,
+		segmentNo:       startSegmentNo,
+		segment:         make([]byte, WalSegmentSize),
+		uploadSegment:   uploadSegment,
+		deleteSegment:   deleteSegment,
+		partialUploaded: true,
+	}
+}
+
+// Receive appends WAL data starting at walStart to the current segment.
+// Data received again after reconnection is skipped, a gap in the stream is an error.
+func (receiver *WalSegmentReceiver) Receive(walStart uint64, data []byte) error {
+	expectedLsn := receiver.ReceivedLsn()
+	if walStart > expectedLsn {
+		return newWalStreamGapError(expectedLsn, walStart)
+	}
+	if skipped := expectedLsn - walStart; skipped < uint64(len(data)) {
+		data = data[skipped:]
+	} else {
+		return nil
+	}
+	for len(data) > 0 {
+		copied := copy(receiver.segment[receiver.received:], data)
+		receiver.received += uint64(copied)
+		data = data[copied:]
+		if receiver.received < WalSegmentSize {
+			continue
+		}
+		name := receiver.segmentNo.getFilename(receiver.timeline)
+		if err := receiver.uploadSegment(name, receiver.segment); err != nil {
+			return errors.Wrapf(err, "failed to upload WAL segment %s", name)
+		}
+		tracelog.InfoLogger.Printf("Archived WAL segment %s\n", name)
+		if receiver.partialUploaded {
+			// the partial segment is superseded by the complete one
+			if err := receiver.deleteSegment(name + PartialWalSuffix); err != nil {
+				tracelog.WarningLogger.Printf("Failed to delete partial WAL segment %s: %v\n", name, err)
+			}
+			receiver.partialUploaded = false
+		}
+		receiver.segmentNo = receiver.segmentNo.next()
+		receiver.received = 0
+	}
+	return nil
+}
+
+// ReceivedLsn is the end of WAL received from the server
+func (receiver *WalSegmentReceiver) ReceivedLsn() uint64 {
+	return receiver.segmentNo.firstLsn() + receiver.received
+}
+
+// ArchivedLsn is the end of WAL uploaded as complete segments
+func (receiver *WalSegmentReceiver) ArchivedLsn() uint64 {
+	return receiver.segmentNo.firstLsn()
+}
+
+// UploadPartial uploads the incomplete current segment with PartialWalSuffix.
+// The segment is padded with zeros to WalSegmentSize, like partial segments archived by Postgres.
+func (receiver *WalSegmentReceiver) UploadPartial() error {
+	if receiver.received == 0 {
+		return nil
+	}
+	for i := receiver.received; i < WalSegmentSize; i++ {
+		receiver.segment[i] = 0
+	}
+	name := receiver.segmentNo.getFilename(receiver.timeline) + PartialWalSuffix
+	receiver.partialUploaded = true
+	return receiver.uploadSegment(name, receiver.segment)
+}
+
+// SwitchTimeline is called when the server has streamed the whole timeline. WAL of the old timeline
+// after the last complete segment is uploaded with PartialWalSuffix, like Postgres does on promotion.
+// The segment with the switch point is received again on the new timeline, since it contains WAL of both timelines.
+func (receiver *WalSegmentReceiver) SwitchTimeline(timeline uint32, switchLsn uint64) error {
+	if err := receiver.UploadPartial(); err != nil {
+		return errors.Wrap(err, "failed to upload partial WAL segment of the old timeline")
+	}
+	receiver.timeline = timeline
+	receiver.segmentNo = newWalSegmentNo(switchLsn)
+	receiver.received = 0
+	receiver.partialUploaded = false
+	return nil
+}
+
+// TimelineSwitch is the result of START_REPLICATION, when the server has streamed the whole requested timeline
+type TimelineSwitch struct {
+	Timeline uint32
+	StartLsn uint64
+}
+
+// TODO : unit tests
+// HandleWALReceive is invoked to perform wal-g wal-receive.
+// WAL is streamed over the replication protocol and uploaded segment by segment until the command is interrupted.
+func HandleWALReceive(uploader *WalUploader, slotName string, uploadPartial bool) {
+	uploader.UploadingFolder = uploader.UploadingFolder.GetSubFolder(utility.WalPath)
+
+	conn, netConn, err := connectReplicationWithNetConn()
+	tracelog.ErrorLogger.FatalOnError(err)
+	defer utility.LoggedClose(conn, "")
+	timeline, xLogPos, err := identifySystem(conn)
+	tracelog.ErrorLogger.FatalfOnError("Failed to identify system: %v\n", err)
+	startSegmentNo, err := chooseWalReceiveStart(uploader.UploadingFolder, timeline, xLogPos)
+	tracelog.ErrorLogger.FatalfOnError("Failed to list WAL archives: %v\n", err)
+
+	receiver := NewWalSegmentReceiver(timeline, startSegmentNo, func(name string, data []byte) error {
+		return uploader.UploadWalFile(newNamedReaderImpl(bytes.NewReader(data), name))
+	}, func(name string) error {
+		return uploader.UploadingFolder.DeleteObjects([]string{name + "." + uploader.Compressor.FileExtension()})
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		tracelog.InfoLogger.Printf("Received %v, stopping WAL receive\n", sig)
+		cancel()
+	}()
+
+	stream := newReplicationStream(netConn)
+	defer stream.Close()
+	err = streamWal(ctx, stream, receiver, slotName, uploadPartial)
+	if uploadPartial {
+		partialErr := receiver.UploadPartial()
+		tracelog.ErrorLogger.FatalfOnError("Failed to upload partial WAL segment: %v\n", partialErr)
+	}
+	tracelog.ErrorLogger.FatalOnError(err)
+}
+
+// streamWal streams WAL from the current position of the receiver until ctx is canceled.
+// When the server has streamed the whole timeline, its history file is uploaded and streaming goes on the next one.
+func streamWal(ctx context.Context, stream *replicationStream, receiver *WalSegmentReceiver,
+	slotName string, uploadPartial bool) error {
+	for {
+		query := "START_REPLICATION"
+		if slotName != "" {
+			query += " SLOT " + slotName
+		}
+		query += fmt.Sprintf(" PHYSICAL %s TIMELINE %d", pgx.FormatLSN(receiver.ReceivedLsn()), receiver.timeline)
+		tracelog.InfoLogger.Println("Calling " + query)
+		if err := stream.startReplication(query); err != nil {
+			return err
+		}
+		timelineSwitch, err := receiveWal(ctx, stream, receiver, uploadPartial)
+		if err != nil || timelineSwitch == nil {
+			return err
+		}
+
+		tracelog.InfoLogger.Printf("Timeline %d has ended, switching to timeline %d at %s\n",
+			receiver.timeline, timelineSwitch.Timeline, pgx.FormatLSN(timelineSwitch.StartLsn))
+		historyName, history, err := stream.timelineHistory(timelineSwitch.Timeline)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get history of timeline %d", timelineSwitch.Timeline)
+		}
+		if err = receiver.uploadSegment(historyName, history); err != nil {
+			return errors.Wrapf(err, "failed to upload timeline history file %s", historyName)
+		}
+		if err = receiver.SwitchTimeline(timelineSwitch.Timeline, timelineSwitch.StartLsn); err != nil {
+			return err
+		}
+	}
+}
+
+// receiveWal reads the replication stream until ctx is canceled or the server ends streaming of the timeline,
+// in the latter case the next timeline is returned.
+// The server is told that WAL is flushed only when it is archived, so the replication slot retains the rest.
+func receiveWal(ctx context.Context, stream *replicationStream, receiver *WalSegmentReceiver,
+	uploadPartial bool) (*TimelineSwitch, error) {
+	partialLsn := receiver.ArchivedLsn()
+	statusTicker := time.NewTicker(walReceiveStatusInterval)
+	defer statusTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-statusTicker.C:
+		case message := <-stream.messages:
+			if message.err != nil {
+				return nil, errors.Wrap(message.err, "failed to read replication stream")
+			}
+			switch message := message.message.(type) {
+			case *pgproto3.CopyData:
+				replyRequested, err := receiveCopyData(message.Data, receiver)
+				if err != nil {
+					return nil, err
+				}
+				if !replyRequested {
+					continue
+				}
+			case *pgproto3.CopyDone:
+				return stream.finishReplication()
+			case *pgproto3.ErrorResponse:
+				return nil, newReplicationError(message)
+			default:
+				continue
+			}
+		}
+
+		if uploadPartial && receiver.ReceivedLsn() != partialLsn {
+			if err := receiver.UploadPartial(); err != nil {
+				return nil, errors.Wrap(err, "failed to upload partial WAL segment")
+			}
+			partialLsn = receiver.ReceivedLsn()
+		}
+		if err := stream.sendStandbyStatus(receiver.ArchivedLsn(), receiver.ReceivedLsn()); err != nil {
+			return nil, errors.Wrap(err, "failed to send standby status")
+		}
+	}
+}
+
+// receiveCopyData passes XLogData message to the receiver,
+// it returns whether the message is a keepalive requesting the standby status
+func receiveCopyData(data []byte, receiver *WalSegmentReceiver) (bool, error) {
+	if len(data) == 0 {
+		return false, nil
+	}
+	switch data[0] {
+	case 'w':
+		// XLogData: WAL start, WAL end and send time precede the data
+		if len(data) < 25 {
+			return false, errors.New("replication stream: XLogData message is too short")
+		}
+		return false, receiver.Receive(binary.BigEndian.Uint64(data[1:]), data[25:])
+	case 'k':
+		// primary keepalive: WAL end and send time precede the reply request flag
+		return len(data) >= 18 && data[17] == 1, nil
+	}
+	return false, nil
+}
+
+func newReplicationError(message *pgproto3.ErrorResponse) error {
+	return errors.Errorf("replication command failed: %s (SQLSTATE %s)", message.Message, message.Code)
+}
+
+type replicationMessage struct {
+	message pgproto3.BackendMessage
+	err     error
+}
+
+// replicationStream runs replication commands over the network connection of the replication connection.
+// Messages are read in a separate goroutine, so the standby status is sent while waiting for WAL.
+type replicationStream struct {
+	conn     io.ReadWriter
+	messages chan replicationMessage
+	done     chan struct{}
+}
+
+func newReplicationStream(conn io.ReadWriter) *replicationStream {
+	stream := &replicationStream{
+		conn:     conn,
+		messages: make(chan replicationMessage),
+		done:     make(chan struct{}),
+	}
+	go stream.readMessages()
+	return stream
+}
+
+func (stream *replicationStream) readMessages() {
+	frontend, err := pgproto3.NewFrontend(stream.conn, stream.conn)
+	for {
+		var message pgproto3.BackendMessage
+		if err == nil {
+			message, err = frontend.Receive()
+		}
+		select {
+		case stream.messages <- replicationMessage{copyBackendMessage(message), err}:
+		case <-stream.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// copyBackendMessage copies data of the message, since the frontend reuses its buffers
+func copyBackendMessage(message pgproto3.BackendMessage) pgproto3.BackendMessage {
+	switch message := message.(type) {
+	case *pgproto3.CopyData:
+		return &pgproto3.CopyData{Data: append([]byte(nil), message.Data...)}
+	case *pgproto3.DataRow:
+		values := make([][]byte, len(message.Values))
+		for i, value := range message.Values {
+			if value != nil {
+				values[i] = append([]byte{}, value...)
+			}
+		}
+		return &pgproto3.DataRow{Values: values}
+	case *pgproto3.ErrorResponse:
+		errorResponse := *message
+		return &errorResponse
+	case *pgproto3.CopyDone:
+		return &pgproto3.CopyDone{}
+	case *pgproto3.CopyBothResponse:
+		return &pgproto3.CopyBothResponse{}
+	case *pgproto3.ReadyForQuery:
+		return &pgproto3.ReadyForQuery{TxStatus: message.TxStatus}
+	}
+	// other messages are not used, so only their type matters
+	return message
+}
+
+func (stream *replicationStream) Close() {
+	close(stream.done)
+}
+
+func (stream *replicationStream) receive() (pgproto3.BackendMessage, error) {
+	message := <-stream.messages
+	return message.message, message.err
+}
+
+// readResult reads rows of the command result until the server is ready for the next command
+func (stream *replicationStream) readResult() ([][][]byte, error) {
+	var rows [][][]byte
+	var resultErr error
+	for {
+		message, err := stream.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch message := message.(type) {
+		case *pgproto3.DataRow:
+			rows = append(rows, message.Values)
+		case *pgproto3.ErrorResponse:
+			resultErr = newReplicationError(message)
+		case *pgproto3.ReadyForQuery:
+			return rows, resultErr
+		}
+	}
+}
+
+// startReplication sends START_REPLICATION command and waits for the server to start streaming
+func (stream *replicationStream) startReplication(query string) error {
+	if _, err := stream.conn.Write((&pgproto3.Query{String: query}).Encode(nil)); err != nil {
+		return err
+	}
+	for {
+		message, err := stream.receive()
+		if err != nil {
+			return err
+		}
+		switch message := message.(type) {
+		case *pgproto3.CopyBothResponse:
+			return nil
+		case *pgproto3.ErrorResponse:
+			_, _ = stream.readResult()
+			return newReplicationError(message)
+		}
+	}
+}
+
+// finishReplication answers CopyDone of the server and reads the next timeline, if the server sends it
+func (stream *replicationStream) finishReplication() (*TimelineSwitch, error) {
+	if _, err := stream.conn.Write((&pgproto3.CopyDone{}).Encode(nil)); err != nil {
+		return nil, err
+	}
+	// CopyData sent by the server before it has received CopyDone are skipped by readResult
+	rows, err := stream.readResult()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || len(rows[0]) < 2 {
+		return nil, errors.New("the server has ended WAL streaming without switching to the next timeline")
+	}
+	timeline, err := strconv.ParseUint(string(rows[0][0]), 10, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the next timeline")
+	}
+	startLsn, err := pgx.ParseLSN(string(rows[0][1]))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse start of the next timeline")
+	}
+	return &TimelineSwitch{Timeline: uint32(timeline), StartLsn: startLsn}, nil
+}
+
+// timelineHistory returns name and content of the timeline history file
+func (stream *replicationStream) timelineHistory(timeline uint32) (string, []byte, error) {
+	query := fmt.Sprintf("TIMELINE_HISTORY %d", timeline)
+	if _, err := stream.conn.Write((&pgproto3.Query{String: query}).Encode(nil)); err != nil {
+		return "", nil, err
+	}
+	rows, err := stream.readResult()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(rows) == 0 || len(rows[0]) < 2 {
+		return "", nil, errors.New("TIMELINE_HISTORY returned no rows")
+	}
+	return string(rows[0][0]), rows[0][1], nil
+}
+
+// sendStandbyStatus reports written and flushed WAL positions, like pgx.ReplicationConn.SendStandbyStatus does
+func (stream *replicationStream) sendStandbyStatus(flushedLsn, writtenLsn uint64) error {
+	status, err := pgx.NewStandbyStatus(flushedLsn, flushedLsn, writtenLsn)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, 34)
+	data[0] = 'r'
+	binary.BigEndian.PutUint64(data[1:], status.WalWritePosition)
+	binary.BigEndian.PutUint64(data[9:], status.WalFlushPosition)
+	binary.BigEndian.PutUint64(data[17:], status.WalApplyPosition)
+	binary.BigEndian.PutUint64(data[25:], status.ClientTime)
+	data[33] = status.ReplyRequested
+	_, err = stream.conn.Write((&pgproto3.CopyData{Data: data}).Encode(nil))
+	return err
+}
+
+// identifySystem returns current timeline and WAL flush location of the server
+func identifySystem(conn *pgx.ReplicationConn) (timeline uint32, xLogPos uint64, err error) {
+	rows, err := conn.IdentifySystem()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return 0, 0, errors.New("IDENTIFY_SYSTEM returned no rows")
+	}
+	values, err := rows.Values()
+	if err != nil {
+		return 0, 0, err
+	}
+	timelineValue, ok := values[1].(int32)
+	if !ok {
+		return 0, 0, errors.Errorf("unexpected timeline %v", values[1])
+	}
+	xLogPosValue, ok := values[2].(string)
+	if !ok {
+		return 0, 0, errors.Errorf("unexpected xlogpos %v", values[2])
+	}
+	xLogPos, err = pgx.ParseLSN(xLogPosValue)
+	return uint32(timelineValue), xLogPos, err
+}
+
+// chooseWalReceiveStart continues after the newest archived segment of the timeline,
+// streaming starts from the current segment of the server if there is none.
+func chooseWalReceiveStart(walFolder storage.Folder, timeline uint32, xLogPos uint64) (WalSegmentNo, error) {
+	currentSegmentNo := newWalSegmentNo(xLogPos)
+	objects, _, err := walFolder.ListFolder()
+	if err != nil {
+		return 0, err
+	}
+	var lastSegmentNo WalSegmentNo
+	found := false
+	for _, object := range objects {
+		segmentTimeline, segmentNo, err := ParseWALFilename(utility.TrimFileExtension(object.GetName()))
+		if err != nil || segmentTimeline != timeline {
+			continue
+		}
+		if !found || WalSegmentNo(segmentNo) > lastSegmentNo {
+			lastSegmentNo = WalSegmentNo(segmentNo)
+			found = true
+		}
+	}
+	if !found || lastSegmentNo >= currentSegmentNo {
+		return currentSegmentNo, nil
+	}
+	return lastSegmentNo.next(), nil
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgx/pgproto3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readFrontendMessage reads a message sent by the client, pgproto3.Backend doesn't decode CopyData and CopyDone
+func readFrontendMessage(t *testing.T, conn io.Reader) (byte, []byte) {
+	header := make([]byte, 5)
+	_, err := io.ReadFull(conn, header)
+	require.NoError(t, err)
+	body := make([]byte, binary.BigEndian.Uint32(header[1:])-4)
+	_, err = io.ReadFull(conn, body)
+	require.NoError(t, err)
+	return header[0], body
+}
+
+func expectQuery(t *testing.T, conn io.Reader, query string) {
+	messageType, body := readFrontendMessage(t, conn)
+	assert.Equal(t, byte('Q'), messageType)
+	assert.Equal(t, query+"\x00", string(body))
+}
+
+// copyBothResponse is encoded like the server does, pgproto3.CopyBothResponse misses the overall format
+type copyBothResponse struct{}
+
+func (copyBothResponse) Encode(dst []byte) []byte {
+	return append(dst, 'W', 0, 0, 0, 7, 0, 0, 0)
+}
+
+func encodeXLogData(walStart uint64, data []byte) *pgproto3.CopyData {
+	message := make([]byte, 25, 25+len(data))
+	message[0] = 'w'
+	binary.BigEndian.PutUint64(message[1:], walStart)
+	return &pgproto3.CopyData{Data: append(message, data...)}
+}
+
+func writeBackendMessages(t *testing.T, conn io.Writer, messages ...interface{ Encode([]byte) []byte }) {
+	var data []byte
+	for _, message := range messages {
+		data = message.Encode(data)
+	}
+	_, err := conn.Write(data)
+	require.NoError(t, err)
+}
+
+func TestStreamWal_SwitchesTimeline(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	uploaded := make(map[string][]byte)
+	receiver := NewWalSegmentReceiver(1, 1, func(name string, data []byte) error {
+		uploaded[name] = append([]byte{}, data...)
+		if name == "000000020000000000000001" {
+			cancel()
+		}
+		return nil
+	}, func(name string) error {
+		return nil
+	})
+	history := "1\t0/1000064\tno recovery target specified\n"
+	segmentStart := WalSegmentSize
+	switchLsn := segmentStart + 100
+
+	go func() {
+		expectQuery(t, serverConn, "START_REPLICATION SLOT wal_g PHYSICAL 0/1000000 TIMELINE 1")
+		writeBackendMessages(t, serverConn, copyBothResponse{},
+			encodeXLogData(segmentStart, bytes.Repeat([]byte{1}, 100)), &pgproto3.CopyDone{})
+		messageType, _ := readFrontendMessage(t, serverConn)
+		assert.Equal(t, byte('c'), messageType)
+		writeBackendMessages(t, serverConn,
+			&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{{Name: "next_tli"}, {Name: "next_tli_startpos"}}},
+			&pgproto3.DataRow{Values: [][]byte{[]byte("2"), []byte("0/1000064")}},
+			&pgproto3.CommandComplete{CommandTag: "START_STREAMING"},
+			&pgproto3.ReadyForQuery{TxStatus: 'I'})
+
+		expectQuery(t, serverConn, "TIMELINE_HISTORY 2")
+		writeBackendMessages(t, serverConn,
+			&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{{Name: "filename"}, {Name: "content"}}},
+			&pgproto3.DataRow{Values: [][]byte{[]byte("00000002.history"), []byte(history)}},
+			&pgproto3.CommandComplete{CommandTag: "SELECT"},
+			&pgproto3.ReadyForQuery{TxStatus: 'I'})
+
+		expectQuery(t, serverConn, "START_REPLICATION SLOT wal_g PHYSICAL 0/1000000 TIMELINE 2")
+		writeBackendMessages(t, serverConn, copyBothResponse{},
+			encodeXLogData(segmentStart, bytes.Repeat([]byte{2}, int(WalSegmentSize))))
+	}()
+
+	stream := newReplicationStream(clientConn)
+	defer stream.Close()
+	err := streamWal(ctx, stream, receiver, "wal_g", false)
+
+	assert.NoError(t, err)
+	partial := append(bytes.Repeat([]byte{1}, 100), make([]byte, int(WalSegmentSize)-100)...)
+	assert.Equal(t, partial, uploaded["000000010000000000000001"+PartialWalSuffix])
+	assert.Equal(t, history, string(uploaded["00000002.history"]))
+	assert.Equal(t, int(WalSegmentSize), len(uploaded["000000020000000000000001"]))
+	assert.Equal(t, uint32(2), receiver.timeline)
+	assert.Equal(t, switchLsn-100+WalSegmentSize, receiver.ArchivedLsn())
+}
+
+func TestStreamWal_ReturnsServerError(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	receiver := NewWalSegmentReceiver(1, 1, func(name string, data []byte) error {
+		return nil
+	}, func(name string) error {
+		return nil
+	})
+
+	go func() {
+		expectQuery(t, serverConn, "START_REPLICATION PHYSICAL 0/1000000 TIMELINE 1")
+		writeBackendMessages(t, serverConn,
+			&pgproto3.ErrorResponse{Severity: "ERROR", Code: "58P01", Message: "requested WAL segment has already been removed"},
+			&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	}()
+
+	stream := newReplicationStream(clientConn)
+	defer stream.Close()
+	err := streamWal(context.Background(), stream, receiver, "", false)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "already been removed")
+}
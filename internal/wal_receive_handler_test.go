@@ -0,0 +1,102 @@
+package internal_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func TestWalSegmentReceiver_UploadsCompleteSegments(t *testing.T) {
+	uploaded := make(map[string][]byte)
+	receiver := internal.NewWalSegmentReceiver(2, 1, func(name string, data []byte) error {
+		uploaded[name] = append([]byte{}, data...)
+		return nil
+	}, func(name string) error {
+		delete(uploaded, name)
+		return nil
+	})
+	start := internal.WalSegmentSize
+	half := int(internal.WalSegmentSize / 2)
+
+	assert.NoError(t, receiver.Receive(start, bytes.Repeat([]byte{1}, half)))
+	// data received again is skipped
+	assert.NoError(t, receiver.Receive(start, bytes.Repeat([]byte{1}, half)))
+	assert.Empty(t, uploaded)
+	assert.Equal(t, start+uint64(half), receiver.ReceivedLsn())
+
+	assert.NoError(t, receiver.Receive(start+uint64(half), bytes.Repeat([]byte{2}, half+10)))
+	assert.Len(t, uploaded, 1)
+	segment := uploaded["000000020000000000000001"]
+	assert.Equal(t, int(internal.WalSegmentSize), len(segment))
+	assert.Equal(t, byte(1), segment[0])
+	assert.Equal(t, byte(2), segment[len(segment)-1])
+	assert.Equal(t, 2*internal.WalSegmentSize, receiver.ArchivedLsn())
+
+	assert.NoError(t, receiver.UploadPartial())
+	// data of the previous segment left in the buffer is not uploaded
+	assert.Equal(t, paddedSegment(bytes.Repeat([]byte{2}, 10)), uploaded["000000020000000000000002"+internal.PartialWalSuffix])
+}
+
+func TestWalSegmentReceiver_Gap(t *testing.T) {
+	receiver := internal.NewWalSegmentReceiver(1, 1, func(name string, data []byte) error {
+		return nil
+	}, func(name string) error {
+		return nil
+	})
+	err := receiver.Receive(internal.WalSegmentSize+10, []byte{1})
+	assert.IsType(t, internal.WalStreamGapError{}, err)
+}
+
+func TestWalSegmentReceiver_DeletesPartialOfArchivedSegment(t *testing.T) {
+	uploaded := make(map[string][]byte)
+	var deleted []string
+	receiver := internal.NewWalSegmentReceiver(1, 1, func(name string, data []byte) error {
+		uploaded[name] = append([]byte{}, data...)
+		return nil
+	}, func(name string) error {
+		deleted = append(deleted, name)
+		delete(uploaded, name)
+		return nil
+	})
+	start := internal.WalSegmentSize
+	half := int(internal.WalSegmentSize / 2)
+
+	assert.NoError(t, receiver.Receive(start, bytes.Repeat([]byte{1}, half)))
+	assert.NoError(t, receiver.UploadPartial())
+	assert.Contains(t, uploaded, "000000010000000000000001"+internal.PartialWalSuffix)
+
+	assert.NoError(t, receiver.Receive(start+uint64(half), bytes.Repeat([]byte{2}, 2*half)))
+	assert.Equal(t, []string{"000000010000000000000001" + internal.PartialWalSuffix}, deleted)
+	assert.Contains(t, uploaded, "000000010000000000000001")
+	assert.NotContains(t, uploaded, "000000010000000000000001"+internal.PartialWalSuffix)
+
+	// the next segment has no partial uploaded, so nothing is deleted
+	assert.NoError(t, receiver.Receive(start+uint64(3*half), bytes.Repeat([]byte{3}, half)))
+	assert.Len(t, deleted, 1)
+}
+
+func TestWalSegmentReceiver_SwitchTimeline(t *testing.T) {
+	uploaded := make(map[string][]byte)
+	receiver := internal.NewWalSegmentReceiver(1, 1, func(name string, data []byte) error {
+		uploaded[name] = append([]byte{}, data...)
+		return nil
+	}, func(name string) error {
+		return nil
+	})
+	start := internal.WalSegmentSize
+
+	assert.NoError(t, receiver.Receive(start, bytes.Repeat([]byte{1}, 100)))
+	assert.NoError(t, receiver.SwitchTimeline(2, start+100))
+
+	assert.Equal(t, paddedSegment(bytes.Repeat([]byte{1}, 100)), uploaded["000000010000000000000001"+internal.PartialWalSuffix])
+	// the segment with the switch point is streamed again on the new timeline from its beginning
+	assert.Equal(t, start, receiver.ReceivedLsn())
+	assert.NoError(t, receiver.Receive(start, bytes.Repeat([]byte{2}, int(internal.WalSegmentSize))))
+	assert.Contains(t, uploaded, "000000020000000000000001")
+}
+
+func paddedSegment(data []byte) []byte {
+	return append(data, make([]byte, int(internal.WalSegmentSize)-len(data))...)
+}
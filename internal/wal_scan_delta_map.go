@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/walparser"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// LoadWalScanDeltaMap builds delta map by parsing WAL written since the start of the previous backup.
+// Unlike DownloadDeltaMap, it doesn't need delta files, so WAL-G may archive WAL without WALG_USE_WAL_DELTA.
+func (bundle *Bundle) LoadWalScanDeltaMap(walFolder storage.Folder, backupStartLSN uint64) error {
+	walDirectory, err := findWalDirectory(bundle.ArchiveDirectory)
+	if err != nil {
+		return err
+	}
+	deltaMap, err := getDeltaMapFromWalScan(walFolder, walDirectory, bundle.Timeline, *bundle.IncrementFromLsn, backupStartLSN)
+	if err != nil {
+		return err
+	}
+	bundle.DeltaMap = deltaMap
+	return nil
+}
+
+// getDeltaMapFromWalScan collects blocks referenced by WAL records from firstUsedLSN to firstNotUsedLSN.
+// Segments still present in the local WAL directory are read from it, others are downloaded from storage.
+// The segment containing firstNotUsedLSN is usually not archived yet, so it is read only up to that LSN.
+func getDeltaMapFromWalScan(walFolder storage.Folder, walDirectory string, timeline uint32,
+	firstUsedLSN, firstNotUsedLSN uint64) (PagedFileDeltaMap, error) {
+	deltaMap := NewPagedFileDeltaMap()
+	if firstNotUsedLSN <= firstUsedLSN {
+		return deltaMap, nil
+	}
+	walParser := walparser.NewWalParser()
+	firstSegmentNo := newWalSegmentNo(firstUsedLSN)
+	lastSegmentNo := newWalSegmentNo(firstNotUsedLSN - 1)
+	tracelog.InfoLogger.Printf("Scanning WAL from %s to %s for changed blocks\n",
+		firstSegmentNo.getFilename(timeline), lastSegmentNo.getFilename(timeline))
+	for segmentNo := firstSegmentNo; segmentNo <= lastSegmentNo; segmentNo = segmentNo.next() {
+		filename := segmentNo.getFilename(timeline)
+		reader, err := openWalSegmentForScan(walFolder, walDirectory, filename)
+		if err != nil {
+			return deltaMap, err
+		}
+		var segmentReader io.Reader = reader
+		if segmentNo == lastSegmentNo {
+			// pages after firstNotUsedLSN may be not written yet or contain WAL of a recycled segment
+			pageSize := uint64(walparser.WalPageSize)
+			scannedSize := (firstNotUsedLSN - segmentNo.firstLsn() + pageSize - 1) / pageSize * pageSize
+			segmentReader = io.LimitReader(reader, int64(scannedSize))
+		}
+		locations, err := extractLocationsFromWalFile(walParser, ioutil.NopCloser(segmentReader))
+		utility.LoggedClose(reader, "")
+		if err != nil {
+			return deltaMap, errors.Wrapf(err, "failed to extract locations from WAL segment '%s'", filename)
+		}
+		deltaMap.AddLocationsToDelta(locations)
+	}
+	return deltaMap, nil
+}
+
+// openWalSegmentForScan opens the segment in the local WAL directory or downloads it from storage
+func openWalSegmentForScan(walFolder storage.Folder, walDirectory, filename string) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(walDirectory, filename))
+	if err == nil {
+		tracelog.DebugLogger.Printf("Scanning local WAL segment %s\n", filename)
+		return file, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	reader, err := DownloadAndDecompressWALFile(walFolder, filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to download WAL segment '%s'", filename)
+	}
+	tracelog.DebugLogger.Printf("Scanning archived WAL segment %s\n", filename)
+	return reader, nil
+}
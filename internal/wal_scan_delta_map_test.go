@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/storages/memory"
+)
+
+func TestGetDeltaMapFromWalScan(t *testing.T) {
+	walDirectory, err := createTempDir("wal_scan")
+	assert.NoError(t, err)
+	defer os.RemoveAll(walDirectory)
+	data, err := ioutil.ReadFile(filepath.Join("../test/testdata", "00000001000000000000007C"))
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(walDirectory, "00000001000000000000007C"), data, 0600)
+	assert.NoError(t, err)
+	walFolder := memory.NewFolder("in_memory/", memory.NewStorage())
+
+	segmentNo := newWalSegmentNoFromFilenameNoError("00000001000000000000007C")
+	deltaMap, err := getDeltaMapFromWalScan(walFolder, walDirectory, 1, segmentNo.firstLsn(), segmentNo.next().firstLsn())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, deltaMap)
+
+	_, err = getDeltaMapFromWalScan(walFolder, walDirectory, 1, segmentNo.firstLsn(), segmentNo.next().next().firstLsn())
+	assert.Error(t, err)
+}
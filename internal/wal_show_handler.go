@@ -0,0 +1,299 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jackc/pgx"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	WalShowOkStatus           = "OK"
+	WalShowLostSegmentsStatus = "LOST_SEGMENTS"
+	WalShowOrphanedStatus     = "ORPHANED"
+)
+
+// WalSegmentsRange is a range of segments of a timeline, both ends are included
+type WalSegmentsRange struct {
+	StartSegment string `json:"start_segment"`
+	EndSegment   string `json:"end_segment"`
+}
+
+// PitrWindow is a range of segments of a timeline which can be reached by point-in-time recovery
+// from the backup with continuous WAL
+type PitrWindow struct {
+	WalSegmentsRange
+	BackupName string `json:"backup_name"`
+}
+
+// TimelineShowResult describes archived WAL of a single timeline and backups it can be restored from
+type TimelineShowResult struct {
+	TimelineID     uint32             `json:"timeline_id"`
+	ParentID       uint32             `json:"parent_id,omitempty"`
+	SwitchPointLsn string             `json:"switch_point_lsn,omitempty"`
+	StartSegment   string             `json:"start_segment"`
+	EndSegment     string             `json:"end_segment"`
+	SegmentsCount  int                `json:"segments_count"`
+	Status         string             `json:"status"`
+	Gaps           []WalSegmentsRange `json:"gaps"`
+	Backups        []string           `json:"backups"`
+	PitrWindows    []PitrWindow       `json:"pitr_windows"`
+}
+
+// WalShowResult is the report of wal-show
+type WalShowResult struct {
+	Timelines []TimelineShowResult `json:"timelines"`
+}
+
+// TODO : unit tests
+// HandleWalShow is invoked to perform wal-g wal-show.
+// Timelines are reconstructed from archived WAL segments and history files.
+func HandleWalShow(folder storage.Folder, detailedJson bool, output io.Writer) {
+	walFolder := folder.GetSubFolder(utility.WalPath)
+	objects, _, err := walFolder.ListFolder()
+	tracelog.ErrorLogger.FatalfOnError("Failed to list WAL archives: %v\n", err)
+	segments := make([]string, 0, len(objects))
+	histories := make(map[uint32][]TimelineHistoryRecord)
+	for _, object := range objects {
+		name := utility.TrimFileExtension(object.GetName())
+		if !strings.HasSuffix(name, timelineHistorySuffix) {
+			segments = append(segments, name)
+			continue
+		}
+		timeline, ok := parseTimelineHistoryFilename(name)
+		if !ok {
+			tracelog.WarningLogger.Printf("Skipping unexpected history file %s\n", object.GetName())
+			continue
+		}
+		history, err := downloadTimelineHistory(walFolder, timeline)
+		tracelog.ErrorLogger.FatalfOnError("Failed to read timeline history: %v\n", err)
+		histories[timeline] = history
+	}
+	bundled, err := listBundledSegments(walFolder)
+	tracelog.ErrorLogger.FatalfOnError("Failed to list WAL bundles: %v\n", err)
+	segments = append(segments, bundled...)
+
+	backups, err := GetBackups(folder)
+	if _, ok := err.(NoBackupsFoundError); ok {
+		tracelog.WarningLogger.Println("No backups found")
+		err = nil
+	}
+	tracelog.ErrorLogger.FatalfOnError("Failed to list backups: %v\n", err)
+
+	result := ShowWalTimelines(segments, histories, backups)
+	if detailedJson {
+		err = WriteAsJson(result, output, true)
+		tracelog.ErrorLogger.FatalOnError(err)
+		return
+	}
+	writeWalShow(result, output)
+}
+
+// ShowWalTimelines builds the timeline tree from names of archived segments given without file extension
+// and histories of timelines. For each timeline it finds gaps in its segments and PITR windows:
+// ranges of its segments reachable from a backup on this timeline or its ancestors without gaps in WAL.
+// Timelines without history file can't be linked to their parents, they are reported as orphaned.
+func ShowWalTimelines(names []string, histories map[uint32][]TimelineHistoryRecord, backups []BackupTime) WalShowResult {
+	segments := make(map[uint32]map[WalSegmentNo]bool)
+	timelines := make(map[uint32]bool)
+	for _, name := range names {
+		timeline, logSegNo, err := ParseWALFilename(name)
+		if err != nil {
+			// partial and backup history files
+			continue
+		}
+		if segments[timeline] == nil {
+			segments[timeline] = make(map[WalSegmentNo]bool)
+		}
+		segments[timeline][WalSegmentNo(logSegNo)] = true
+		timelines[timeline] = true
+	}
+	for timeline, history := range histories {
+		timelines[timeline] = true
+		for _, record := range history {
+			timelines[record.Timeline] = true
+		}
+	}
+	backupStarts := make(map[uint32]map[WalSegmentNo]string)
+	backupsByTimeline := make(map[uint32][]string)
+	// backups are sorted from the newest, so the oldest backup starting at a segment is kept
+	for _, backup := range backups {
+		timeline, logSegNo, err := ParseWALFilename(backup.WalFileName)
+		if err != nil {
+			continue
+		}
+		if backupStarts[timeline] == nil {
+			backupStarts[timeline] = make(map[WalSegmentNo]string)
+		}
+		backupStarts[timeline][WalSegmentNo(logSegNo)] = backup.BackupName
+		backupsByTimeline[timeline] = append([]string{backup.BackupName}, backupsByTimeline[timeline]...)
+		timelines[timeline] = true
+	}
+
+	sortedTimelines := make([]uint32, 0, len(timelines))
+	for timeline := range timelines {
+		sortedTimelines = append(sortedTimelines, timeline)
+	}
+	sort.Slice(sortedTimelines, func(i, j int) bool { return sortedTimelines[i] < sortedTimelines[j] })
+
+	result := WalShowResult{Timelines: make([]TimelineShowResult, 0, len(sortedTimelines))}
+	for _, timeline := range sortedTimelines {
+		timelineResult := TimelineShowResult{
+			TimelineID:  timeline,
+			Status:      WalShowOkStatus,
+			Gaps:        []WalSegmentsRange{},
+			Backups:     backupsByTimeline[timeline],
+			PitrWindows: []PitrWindow{},
+		}
+		if timelineResult.Backups == nil {
+			timelineResult.Backups = []string{}
+		}
+		history, hasHistory := histories[timeline]
+		if timeline > 1 && !hasHistory {
+			timelineResult.Status = WalShowOrphanedStatus
+			history = nil
+		}
+		if len(history) > 0 {
+			parent := history[len(history)-1]
+			timelineResult.ParentID = parent.Timeline
+			timelineResult.SwitchPointLsn = pgx.FormatLSN(parent.SwitchLsn)
+		}
+
+		path := buildTimelinePath(timeline, segments, history)
+		own := path[len(path)-1]
+		if len(segments[timeline]) > 0 && own.begin <= own.end {
+			timelineResult.StartSegment = own.begin.getFilename(timeline)
+			timelineResult.EndSegment = own.end.getFilename(timeline)
+			timelineResult.SegmentsCount = len(segments[timeline])
+			for _, gap := range findGaps(own, segments[timeline]) {
+				timelineResult.Gaps = append(timelineResult.Gaps, gap.toSegmentsRange())
+			}
+			if len(timelineResult.Gaps) > 0 && timelineResult.Status == WalShowOkStatus {
+				timelineResult.Status = WalShowLostSegmentsStatus
+			}
+			timelineResult.PitrWindows = findPitrWindows(path, segments, backupStarts)
+		}
+		result.Timelines = append(result.Timelines, timelineResult)
+	}
+	return result
+}
+
+// buildTimelinePath splits segments between ancestors of the timeline by switch points,
+// the last range belongs to the timeline itself
+func buildTimelinePath(timeline uint32, segments map[uint32]map[WalSegmentNo]bool,
+	history []TimelineHistoryRecord) []timelineRange {
+	pathSegments := make(map[uint32]map[WalSegmentNo]bool)
+	pathSegments[timeline] = segments[timeline]
+	for _, record := range history {
+		pathSegments[record.Timeline] = segments[record.Timeline]
+	}
+	ranges := make([]timelineRange, 0, len(history)+1)
+	begin := minSegmentNo(pathSegments)
+	for _, record := range history {
+		switchSegmentNo := newWalSegmentNo(record.SwitchLsn)
+		// segment of the switch point is archived only on the new timeline
+		ranges = append(ranges, timelineRange{timeline: record.Timeline, begin: begin, end: switchSegmentNo.previous()})
+		begin = switchSegmentNo
+	}
+	return append(ranges, timelineRange{timeline: timeline, begin: begin, end: maxSegmentNo(segments[timeline])})
+}
+
+// findGaps returns ranges of segments missing in the timeline range
+func findGaps(r timelineRange, segments map[WalSegmentNo]bool) []timelineRange {
+	var gaps []timelineRange
+	for segmentNo := r.begin; segmentNo <= r.end; segmentNo = segmentNo.next() {
+		if segments[segmentNo] {
+			continue
+		}
+		if len(gaps) > 0 && gaps[len(gaps)-1].end == segmentNo.previous() {
+			gaps[len(gaps)-1].end = segmentNo
+			continue
+		}
+		gaps = append(gaps, timelineRange{timeline: r.timeline, begin: segmentNo, end: segmentNo})
+	}
+	return gaps
+}
+
+// findPitrWindows walks segments along the path of the timeline from the oldest one.
+// Segments of the timeline are reachable if WAL is continuous since the start of some backup.
+func findPitrWindows(path []timelineRange, segments map[uint32]map[WalSegmentNo]bool,
+	backupStarts map[uint32]map[WalSegmentNo]string) []PitrWindow {
+	timeline := path[len(path)-1].timeline
+	windows := make([]PitrWindow, 0)
+	var window *timelineRange
+	backupName := ""
+	for _, r := range path {
+		for segmentNo := r.begin; r.begin <= r.end && segmentNo <= r.end; segmentNo = segmentNo.next() {
+			if !segments[r.timeline][segmentNo] {
+				backupName = ""
+				window = nil
+				continue
+			}
+			if backupName == "" {
+				backupName = backupStarts[r.timeline][segmentNo]
+			}
+			if backupName == "" || r.timeline != timeline {
+				continue
+			}
+			if window == nil {
+				windows = append(windows, PitrWindow{BackupName: backupName})
+				window = &timelineRange{timeline: timeline, begin: segmentNo}
+			}
+			window.end = segmentNo
+			windows[len(windows)-1].WalSegmentsRange = window.toSegmentsRange()
+		}
+	}
+	return windows
+}
+
+func (r timelineRange) toSegmentsRange() WalSegmentsRange {
+	return WalSegmentsRange{StartSegment: r.begin.getFilename(r.timeline), EndSegment: r.end.getFilename(r.timeline)}
+}
+
+// writeWalShow prints timelines as a tree, children are indented under their parents
+func writeWalShow(result WalShowResult, output io.Writer) {
+	children := make(map[uint32][]TimelineShowResult)
+	known := make(map[uint32]bool)
+	for _, timeline := range result.Timelines {
+		known[timeline.TimelineID] = true
+	}
+	var roots []TimelineShowResult
+	for _, timeline := range result.Timelines {
+		if timeline.ParentID == 0 || !known[timeline.ParentID] {
+			roots = append(roots, timeline)
+			continue
+		}
+		children[timeline.ParentID] = append(children[timeline.ParentID], timeline)
+	}
+
+	writer := tabwriter.NewWriter(output, 0, 0, 1, ' ', 0)
+	defer writer.Flush()
+	fmt.Fprintln(writer, "timeline\tparent\tswitch_point\tstatus\tsegments\tstart_segment\tend_segment\tgaps\tbackups\tpitr_windows")
+	var writeTree func(timeline TimelineShowResult, depth int)
+	writeTree = func(timeline TimelineShowResult, depth int) {
+		gaps := make([]string, 0, len(timeline.Gaps))
+		for _, gap := range timeline.Gaps {
+			gaps = append(gaps, gap.StartSegment+".."+gap.EndSegment)
+		}
+		windows := make([]string, 0, len(timeline.PitrWindows))
+		for _, window := range timeline.PitrWindows {
+			windows = append(windows, fmt.Sprintf("%s..%s (%s)", window.StartSegment, window.EndSegment, window.BackupName))
+		}
+		fmt.Fprintf(writer, "%s%d\t%d\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			strings.Repeat("  ", depth), timeline.TimelineID, timeline.ParentID, timeline.SwitchPointLsn,
+			timeline.Status, timeline.SegmentsCount, timeline.StartSegment, timeline.EndSegment,
+			strings.Join(gaps, ","), strings.Join(timeline.Backups, ","), strings.Join(windows, ","))
+		for _, child := range children[timeline.TimelineID] {
+			writeTree(child, depth+1)
+		}
+	}
+	for _, root := range roots {
+		writeTree(root, 0)
+	}
+}
@@ -0,0 +1,54 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func TestShowWalTimelines(t *testing.T) {
+	names := []string{
+		"000000010000000000000001",
+		"000000010000000000000002",
+		"000000010000000000000003",
+		"000000010000000000000004.partial",
+		"000000020000000000000004",
+		"000000020000000000000005",
+		"000000020000000000000007",
+		"000000030000000000000008",
+	}
+	histories := map[uint32][]internal.TimelineHistoryRecord{
+		2: {{Timeline: 1, SwitchLsn: 0x4000000}},
+	}
+	backups := []internal.BackupTime{
+		{BackupName: "base_000000010000000000000002", WalFileName: "000000010000000000000002"},
+	}
+
+	result := internal.ShowWalTimelines(names, histories, backups)
+	assert.Equal(t, 3, len(result.Timelines))
+
+	first := result.Timelines[0]
+	assert.Equal(t, internal.WalShowOkStatus, first.Status)
+	assert.Equal(t, "000000010000000000000001", first.StartSegment)
+	assert.Equal(t, "000000010000000000000003", first.EndSegment)
+	assert.Equal(t, []string{"base_000000010000000000000002"}, first.Backups)
+	assert.Equal(t, []internal.PitrWindow{{
+		WalSegmentsRange: internal.WalSegmentsRange{StartSegment: "000000010000000000000002", EndSegment: "000000010000000000000003"},
+		BackupName:       "base_000000010000000000000002",
+	}}, first.PitrWindows)
+
+	second := result.Timelines[1]
+	assert.Equal(t, internal.WalShowLostSegmentsStatus, second.Status)
+	assert.Equal(t, uint32(1), second.ParentID)
+	assert.Equal(t, "0/4000000", second.SwitchPointLsn)
+	assert.Equal(t, []internal.WalSegmentsRange{{StartSegment: "000000020000000000000006", EndSegment: "000000020000000000000006"}}, second.Gaps)
+	assert.Equal(t, []internal.PitrWindow{{
+		WalSegmentsRange: internal.WalSegmentsRange{StartSegment: "000000020000000000000004", EndSegment: "000000020000000000000005"},
+		BackupName:       "base_000000010000000000000002",
+	}}, second.PitrWindows)
+
+	third := result.Timelines[2]
+	assert.Equal(t, internal.WalShowOrphanedStatus, third.Status)
+	assert.Empty(t, third.PitrWindows)
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// parseTimelineHistoryFilename returns the timeline of a history file name such as 00000002.history
+func parseTimelineHistoryFilename(name string) (timeline uint32, ok bool) {
+	if !strings.HasSuffix(name, timelineHistorySuffix) {
+		return 0, false
+	}
+	timeline64, err := strconv.ParseUint(strings.TrimSuffix(name, timelineHistorySuffix), 0x10, sizeofInt32bits)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(timeline64), true
+}
+
+func formatTimelineHistoryFilename(timeline uint32) string {
+	return fmt.Sprintf("%08X", timeline) + timelineHistorySuffix
+}
+
+// downloadWALFileOrPartialWithRetries downloads WAL file, and if the segment is not archived, its .partial copy.
+// The .partial copy is used only when the server has switched to a later timeline: otherwise the segment
+// of the current timeline is not archived yet and is reported as missing.
+func downloadWALFileOrPartialWithRetries(folder storage.Folder, walFileName, location string,
+	policy walFetchRetryPolicy) error {
+	err := downloadWALFileWithRetries(folder, walFileName, location, policy)
+	if !isWalFileNotFound(err) || !isWalFilename(walFileName) {
+		return err
+	}
+	timeline, _, parseErr := ParseWALFilename(walFileName)
+	if parseErr != nil {
+		return err
+	}
+	switched, historyErr := timelineHistoryExists(folder, timeline+1)
+	if historyErr != nil {
+		return historyErr
+	}
+	if !switched {
+		return err
+	}
+	partialErr := downloadPartialWALFileWithRetries(folder, walFileName, location, policy)
+	if isWalFileNotFound(partialErr) {
+		return err
+	}
+	return partialErr
+}
+
+// timelineHistoryExists checks if the history file of the timeline is archived.
+// A promoted server takes the timeline next to the newest archived one, so if the server has switched
+// from the timeline to any later one, the history of the next timeline exists.
+func timelineHistoryExists(folder storage.Folder, timeline uint32) (bool, error) {
+	historyName := formatTimelineHistoryFilename(timeline)
+	for _, decompressor := range compression.Decompressors {
+		exists, err := folder.Exists(historyName + "." + decompressor.FileExtension())
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to check timeline history %s", historyName)
+		}
+		if exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// downloadPartialWALFileWithRetries restores the segment from its .partial copy.
+// A server promoted at a timeline switch archives the last segment of the old timeline as .partial,
+// which is the only copy of it until the first segment of the new timeline is archived.
+// Postgres requests the segment of the old timeline, when it is recovered to that timeline
+// or when the segment of the new timeline is missing.
+func downloadPartialWALFileWithRetries(folder storage.Folder, walFileName, location string,
+	policy walFetchRetryPolicy) error {
+	err := downloadWALFileWithRetries(folder, walFileName+PartialWalSuffix, location, policy)
+	if err != nil {
+		return err
+	}
+	timeline, _, _ := ParseWALFilename(walFileName)
+	tracelog.WarningLogger.Printf("Segment %s is restored from %s%s archived at the switch from timeline %d\n",
+		walFileName, walFileName, PartialWalSuffix, timeline)
+	return nil
+}
+
+// logTimelineSwitch reports archiving of files written by the server on promotion
+func logTimelineSwitch(walFilePath string) {
+	walFileName := filepath.Base(walFilePath)
+	if strings.HasSuffix(walFileName, PartialWalSuffix) {
+		tracelog.InfoLogger.Printf("Archived partial segment %s of the timeline before promotion\n", walFileName)
+		return
+	}
+	timeline, ok := parseTimelineHistoryFilename(walFileName)
+	if !ok {
+		return
+	}
+	file, err := os.Open(walFilePath)
+	if err != nil {
+		return
+	}
+	defer utility.LoggedClose(file, "")
+	history, err := ParseTimelineHistory(file)
+	if err != nil {
+		tracelog.WarningLogger.Printf("Archived history of timeline %d, but failed to parse it: %v\n", timeline, err)
+		return
+	}
+	if len(history) == 0 {
+		return
+	}
+	parent := history[len(history)-1]
+	tracelog.InfoLogger.Printf("Archived history of timeline %d switched from timeline %d at LSN %x\n",
+		timeline, parent.Timeline, parent.SwitchLsn)
+}
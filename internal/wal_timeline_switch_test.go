@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/storages/memory"
+)
+
+func TestParseTimelineHistoryFilename(t *testing.T) {
+	timeline, ok := parseTimelineHistoryFilename("0000000A.history")
+	assert.True(t, ok)
+	assert.Equal(t, uint32(10), timeline)
+
+	_, ok = parseTimelineHistoryFilename("000000010000000000000005.partial")
+	assert.False(t, ok)
+	_, ok = parseTimelineHistoryFilename("backup.history")
+	assert.False(t, ok)
+}
+
+func TestDownloadPartialWALFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal_partial")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	require.NoError(t, folder.PutObject("000000010000000000000005.partial.lz4", bytes.NewBufferString("")))
+	policy := walFetchRetryPolicy{}
+
+	location := filepath.Join(dir, "RECOVERYXLOG")
+	err = downloadWALFileWithRetries(folder, "000000010000000000000005", location, policy)
+	assert.True(t, isWalFileNotFound(err))
+
+	err = downloadPartialWALFileWithRetries(folder, "000000010000000000000005", location, policy)
+	assert.NoError(t, err)
+	_, err = os.Stat(location)
+	assert.NoError(t, err)
+
+	err = downloadPartialWALFileWithRetries(folder, "000000010000000000000006", location, policy)
+	assert.True(t, isWalFileNotFound(err))
+}
+
+func TestDownloadWALFileOrPartial_CurrentTimeline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal_partial")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	// partial copy uploaded by wal-receive --partial while the segment is being written
+	require.NoError(t, folder.PutObject("000000010000000000000005.partial.lz4", bytes.NewBufferString("")))
+	policy := walFetchRetryPolicy{}
+
+	location := filepath.Join(dir, "RECOVERYXLOG")
+	err = downloadWALFileOrPartialWithRetries(folder, "000000010000000000000005", location, policy)
+	assert.True(t, isWalFileNotFound(err))
+	_, err = os.Stat(location)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadWALFileOrPartial_SwitchedTimeline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal_partial")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	require.NoError(t, folder.PutObject("000000010000000000000005.partial.lz4", bytes.NewBufferString("")))
+	require.NoError(t, folder.PutObject("00000002.history.lz4", bytes.NewBufferString("")))
+	policy := walFetchRetryPolicy{}
+
+	location := filepath.Join(dir, "RECOVERYXLOG")
+	err = downloadWALFileOrPartialWithRetries(folder, "000000010000000000000005", location, policy)
+	assert.NoError(t, err)
+	_, err = os.Stat(location)
+	assert.NoError(t, err)
+
+	err = downloadWALFileOrPartialWithRetries(folder, "000000010000000000000006", filepath.Join(dir, "NEXT"), policy)
+	assert.True(t, isWalFileNotFound(err))
+}
@@ -0,0 +1,307 @@
+package internal
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"github.com/wal-g/storages/storage"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	WalVerifyOkStatus            = "OK"
+	WalVerifyLostSegmentsStatus  = "LOST_SEGMENTS"
+	WalVerifyNotInTimelineStatus = "NOT_IN_TIMELINE"
+)
+
+// TimelineHistoryRecord is a line of timeline history file: ancestor timeline and the LSN it was switched at
+type TimelineHistoryRecord struct {
+	Timeline  uint32
+	SwitchLsn uint64
+}
+
+// TimelineVerifyResult describes continuity of WAL segments of a single timeline
+type TimelineVerifyResult struct {
+	TimelineID      uint32   `json:"timeline_id"`
+	StartSegment    string   `json:"start_segment"`
+	EndSegment      string   `json:"end_segment"`
+	SegmentsCount   int      `json:"segments_count"`
+	MissingSegments []string `json:"missing_segments"`
+	Status          string   `json:"status"`
+}
+
+// BackupVerifyResult describes if backup can be restored to the present with archived WAL segments
+type BackupVerifyResult struct {
+	BackupName string `json:"backup_name"`
+	Status     string `json:"status"`
+}
+
+// WalVerifyResult is the report of wal-verify
+type WalVerifyResult struct {
+	Status    string                 `json:"status"`
+	Timelines []TimelineVerifyResult `json:"timelines"`
+	Backups   []BackupVerifyResult   `json:"backups"`
+}
+
+// timelineRange is a range of segments which belongs to the timeline in the history of the newest timeline
+type timelineRange struct {
+	timeline uint32
+	begin    WalSegmentNo
+	end      WalSegmentNo
+}
+
+func (r timelineRange) contains(segmentNo WalSegmentNo) bool {
+	return r.begin <= segmentNo && segmentNo <= r.end
+}
+
+// TODO : unit tests
+// HandleWalVerify is invoked to perform wal-g wal-verify
+func HandleWalVerify(folder storage.Folder, output io.Writer) {
+	walFolder := folder.GetSubFolder(utility.WalPath)
+	objects, _, err := walFolder.ListFolder()
+	tracelog.ErrorLogger.FatalfOnError("Failed to list WAL archives: %v\n", err)
+	segments := make([]string, 0, len(objects))
+	for _, object := range objects {
+		segments = append(segments, utility.TrimFileExtension(object.GetName()))
+	}
+	bundled, err := listBundledSegments(walFolder)
+	tracelog.ErrorLogger.FatalfOnError("Failed to list WAL bundles: %v\n", err)
+	segments = append(segments, bundled...)
+
+	backups, err := GetBackups(folder)
+	if _, ok := err.(NoBackupsFoundError); ok {
+		tracelog.WarningLogger.Println("No backups found, verifying all archived WAL segments")
+		err = nil
+	}
+	tracelog.ErrorLogger.FatalfOnError("Failed to list backups: %v\n", err)
+
+	var history []TimelineHistoryRecord
+	if timeline := newestTimeline(segments); timeline > 1 {
+		history, err = downloadTimelineHistory(walFolder, timeline)
+		tracelog.ErrorLogger.FatalfOnError("Failed to read timeline history: %v\n", err)
+	}
+
+	result := VerifyWalSegments(segments, history, backups)
+	err = WriteAsJson(result, output, true)
+	tracelog.ErrorLogger.FatalOnError(err)
+}
+
+// VerifyWalSegments checks that there are no missing segments in the history of the newest timeline
+// from the oldest backup to the newest archived segment.
+// Names of segments are given without file extension, history describes ancestors of the newest timeline.
+func VerifyWalSegments(names []string, history []TimelineHistoryRecord, backups []BackupTime) WalVerifyResult {
+	segments := make(map[uint32]map[WalSegmentNo]bool)
+	for _, name := range names {
+		timeline, logSegNo, err := ParseWALFilename(name)
+		if err != nil {
+			// history, partial and backup history files
+			continue
+		}
+		if segments[timeline] == nil {
+			segments[timeline] = make(map[WalSegmentNo]bool)
+		}
+		segments[timeline][WalSegmentNo(logSegNo)] = true
+	}
+
+	result := WalVerifyResult{Status: WalVerifyOkStatus, Timelines: []TimelineVerifyResult{}, Backups: []BackupVerifyResult{}}
+	ranges := buildTimelineRanges(segments, history)
+	if len(ranges) == 0 {
+		return result
+	}
+
+	// segments older than the oldest backup are not needed
+	start := ranges[0].begin
+	if oldest, ok := oldestBackupSegmentNo(backups); ok && oldest > start {
+		start = oldest
+	}
+
+	var missing []WalSegmentNo
+	for _, r := range ranges {
+		if r.end < start {
+			continue
+		}
+		if r.begin < start {
+			r.begin = start
+		}
+		timelineResult := TimelineVerifyResult{
+			TimelineID:      r.timeline,
+			StartSegment:    r.begin.getFilename(r.timeline),
+			EndSegment:      r.end.getFilename(r.timeline),
+			MissingSegments: []string{},
+			Status:          WalVerifyOkStatus,
+		}
+		for segmentNo := r.begin; segmentNo <= r.end; segmentNo = segmentNo.next() {
+			if segments[r.timeline][segmentNo] {
+				timelineResult.SegmentsCount++
+				continue
+			}
+			missing = append(missing, segmentNo)
+			timelineResult.MissingSegments = append(timelineResult.MissingSegments, segmentNo.getFilename(r.timeline))
+			timelineResult.Status = WalVerifyLostSegmentsStatus
+			result.Status = WalVerifyLostSegmentsStatus
+		}
+		result.Timelines = append(result.Timelines, timelineResult)
+	}
+
+	for _, backup := range backups {
+		result.Backups = append(result.Backups, BackupVerifyResult{
+			BackupName: backup.BackupName,
+			Status:     verifyBackupSegments(backup, ranges, missing),
+		})
+	}
+	return result
+}
+
+// buildTimelineRanges splits segments between the newest timeline and its ancestors by switch points
+func buildTimelineRanges(segments map[uint32]map[WalSegmentNo]bool, history []TimelineHistoryRecord) []timelineRange {
+	newest := uint32(0)
+	for timeline := range segments {
+		if timeline > newest {
+			newest = timeline
+		}
+	}
+	if newest == 0 {
+		return nil
+	}
+
+	ranges := make([]timelineRange, 0, len(history)+1)
+	begin := minSegmentNo(segments)
+	for _, record := range history {
+		switchSegmentNo := newWalSegmentNo(record.SwitchLsn)
+		// segment of the switch point is archived only on the new timeline
+		ranges = append(ranges, timelineRange{timeline: record.Timeline, begin: begin, end: switchSegmentNo.previous()})
+		begin = switchSegmentNo
+	}
+	ranges = append(ranges, timelineRange{timeline: newest, begin: begin, end: maxSegmentNo(segments[newest])})
+	return ranges
+}
+
+// minSegmentNo returns the oldest archived segment number among all timelines
+func minSegmentNo(segments map[uint32]map[WalSegmentNo]bool) WalSegmentNo {
+	first := true
+	var result WalSegmentNo
+	for _, timelineSegments := range segments {
+		for segmentNo := range timelineSegments {
+			if first || segmentNo < result {
+				result = segmentNo
+				first = false
+			}
+		}
+	}
+	return result
+}
+
+func maxSegmentNo(segments map[WalSegmentNo]bool) WalSegmentNo {
+	var result WalSegmentNo
+	for segmentNo := range segments {
+		if segmentNo > result {
+			result = segmentNo
+		}
+	}
+	return result
+}
+
+func oldestBackupSegmentNo(backups []BackupTime) (WalSegmentNo, bool) {
+	found := false
+	var oldest WalSegmentNo
+	for _, backup := range backups {
+		_, logSegNo, err := ParseWALFilename(backup.WalFileName)
+		if err != nil {
+			continue
+		}
+		if !found || WalSegmentNo(logSegNo) < oldest {
+			oldest = WalSegmentNo(logSegNo)
+			found = true
+		}
+	}
+	return oldest, found
+}
+
+func verifyBackupSegments(backup BackupTime, ranges []timelineRange, missing []WalSegmentNo) string {
+	timeline, logSegNo, err := ParseWALFilename(backup.WalFileName)
+	if err != nil {
+		return WalVerifyNotInTimelineStatus
+	}
+	segmentNo := WalSegmentNo(logSegNo)
+	inTimeline := false
+	for i, r := range ranges {
+		last := i == len(ranges)-1
+		// backup may be newer than the last archived segment of the newest timeline
+		if r.timeline == timeline && r.begin <= segmentNo && (last || r.contains(segmentNo)) {
+			inTimeline = true
+		}
+	}
+	if !inTimeline {
+		return WalVerifyNotInTimelineStatus
+	}
+	for _, missingSegmentNo := range missing {
+		if missingSegmentNo >= segmentNo {
+			return WalVerifyLostSegmentsStatus
+		}
+	}
+	return WalVerifyOkStatus
+}
+
+func newestTimeline(names []string) uint32 {
+	newest := uint32(0)
+	for _, name := range names {
+		timeline, _, err := ParseWALFilename(name)
+		if err == nil && timeline > newest {
+			newest = timeline
+		}
+	}
+	return newest
+}
+
+// downloadTimelineHistory reads history file of the timeline
+func downloadTimelineHistory(walFolder storage.Folder, timeline uint32) ([]TimelineHistoryRecord, error) {
+	reader, err := DownloadAndDecompressWALFile(walFolder, formatTimelineHistoryFilename(timeline))
+	if _, ok := err.(ArchiveNonExistenceError); ok {
+		tracelog.WarningLogger.Printf("History of timeline %d is not found, verifying only this timeline\n", timeline)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer utility.LoggedClose(reader, "")
+	return ParseTimelineHistory(reader)
+}
+
+// ParseTimelineHistory parses Postgres timeline history file.
+// Each line contains ancestor timeline, switch point LSN and reason separated by tabs.
+func ParseTimelineHistory(reader io.Reader) ([]TimelineHistoryRecord, error) {
+	records := make([]TimelineHistoryRecord, 0)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, errors.Errorf("invalid timeline history line '%s'", line)
+		}
+		timeline, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid timeline in history line '%s'", line)
+		}
+		lsn, err := pgx.ParseLSN(fields[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid switch point in history line '%s'", line)
+		}
+		records = append(records, TimelineHistoryRecord{Timeline: uint32(timeline), SwitchLsn: lsn})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read timeline history")
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Timeline < records[j].Timeline
+	})
+	return records, nil
+}
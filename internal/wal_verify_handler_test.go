@@ -0,0 +1,92 @@
+package internal_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func TestParseTimelineHistory(t *testing.T) {
+	history, err := internal.ParseTimelineHistory(strings.NewReader(
+		"1\t0/5000158\tno recovery target specified\n\n2\t0/8000000\tbefore 2020-06-01 12:00:00+00\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []internal.TimelineHistoryRecord{
+		{Timeline: 1, SwitchLsn: 0x5000158},
+		{Timeline: 2, SwitchLsn: 0x8000000},
+	}, history)
+
+	_, err = internal.ParseTimelineHistory(strings.NewReader("1\tnot_lsn\treason\n"))
+	assert.Error(t, err)
+}
+
+func TestVerifyWalSegments_Continuous(t *testing.T) {
+	segments := []string{
+		"000000010000000000000002",
+		"000000010000000000000003",
+		"000000010000000000000004",
+		"000000010000000000000005.partial",
+		"00000002.history",
+		"000000020000000000000005",
+		"000000020000000000000006",
+		// abandoned segment of the old timeline
+		"000000010000000000000006",
+	}
+	history := []internal.TimelineHistoryRecord{{Timeline: 1, SwitchLsn: 0x5000158}}
+	backups := []internal.BackupTime{
+		{BackupName: "base_000000010000000000000003", WalFileName: "000000010000000000000003"},
+		{BackupName: "base_000000010000000000000006", WalFileName: "000000010000000000000006"},
+	}
+
+	result := internal.VerifyWalSegments(segments, history, backups)
+
+	assert.Equal(t, internal.WalVerifyOkStatus, result.Status)
+	assert.Equal(t, []internal.TimelineVerifyResult{
+		{
+			TimelineID:      1,
+			StartSegment:    "000000010000000000000003",
+			EndSegment:      "000000010000000000000004",
+			SegmentsCount:   2,
+			MissingSegments: []string{},
+			Status:          internal.WalVerifyOkStatus,
+		},
+		{
+			TimelineID:      2,
+			StartSegment:    "000000020000000000000005",
+			EndSegment:      "000000020000000000000006",
+			SegmentsCount:   2,
+			MissingSegments: []string{},
+			Status:          internal.WalVerifyOkStatus,
+		},
+	}, result.Timelines)
+	assert.Equal(t, []internal.BackupVerifyResult{
+		{BackupName: "base_000000010000000000000003", Status: internal.WalVerifyOkStatus},
+		{BackupName: "base_000000010000000000000006", Status: internal.WalVerifyNotInTimelineStatus},
+	}, result.Backups)
+}
+
+func TestVerifyWalSegments_LostSegments(t *testing.T) {
+	segments := []string{
+		"000000010000000000000001",
+		"000000010000000000000002",
+		"000000010000000000000004",
+		"000000010000000000000005",
+		"000000010000000000000006",
+	}
+	backups := []internal.BackupTime{
+		{BackupName: "base_000000010000000000000002", WalFileName: "000000010000000000000002"},
+		{BackupName: "base_000000010000000000000005", WalFileName: "000000010000000000000005"},
+	}
+
+	result := internal.VerifyWalSegments(segments, nil, backups)
+
+	assert.Equal(t, internal.WalVerifyLostSegmentsStatus, result.Status)
+	assert.Len(t, result.Timelines, 1)
+	assert.Equal(t, "000000010000000000000002", result.Timelines[0].StartSegment)
+	assert.Equal(t, []string{"000000010000000000000003"}, result.Timelines[0].MissingSegments)
+	assert.Equal(t, []internal.BackupVerifyResult{
+		{BackupName: "base_000000010000000000000002", Status: internal.WalVerifyLostSegmentsStatus},
+		{BackupName: "base_000000010000000000000005", Status: internal.WalVerifyOkStatus},
+	}, result.Backups)
+}
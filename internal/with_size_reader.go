@@ -10,6 +10,10 @@ type WithSizeReader struct {
 	tarSize    *int64
 }
 
+func NewWithSizeReader(underlying io.Reader, readSize *int64) *WithSizeReader {
+	return &WithSizeReader{underlying, readSize}
+}
+
 func (reader *WithSizeReader) Read(p []byte) (n int, err error) {
 	n, err = reader.underlying.Read(p)
 	atomic.AddInt64(reader.tarSize, int64(n))
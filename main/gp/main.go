@@ -0,0 +1,9 @@
+package main
+
+import (
+	"github.com/wal-g/wal-g/cmd/gp"
+)
+
+func main() {
+	gp.Execute()
+}
@@ -28,7 +28,7 @@ type FileTarBall struct {
 // writing bundled compressed bytes to.
 func (tarBall *FileTarBall) SetUp(crypter crypto.Crypter, names ...string) {
 	if tarBall.tarWriter == nil {
-		name := filepath.Join(tarBall.out, "part_"+fmt.Sprintf("%0.3d", tarBall.number)+".tar.lz4")
+		name := filepath.Join(tarBall.out, tarBall.Name())
 		file, err := os.Create(name)
 		if err != nil {
 			panic(err)
@@ -73,6 +73,7 @@ func (tarBall *FileTarBall) Size() int64            { return atomic.LoadInt64(ta
 func (tarBall *FileTarBall) AddSize(i int64)        { atomic.AddInt64(tarBall.allTarballsSize, i) }
 func (tarBall *FileTarBall) TarWriter() *tar.Writer { return tarBall.tarWriter }
 func (tarBall *FileTarBall) AwaitUploads()          {}
+func (tarBall *FileTarBall) Name() string           { return fmt.Sprintf("part_%0.3d.tar.lz4", tarBall.number) }
 
 // BufferTarBall represents a tarball that is
 // written to buffer.
@@ -104,3 +105,7 @@ func (tarBall *BufferTarBall) TarWriter() *tar.Writer {
 }
 
 func (tarBall *BufferTarBall) AwaitUploads() {}
+
+func (tarBall *BufferTarBall) Name() string {
+	return fmt.Sprintf("part_%0.3d.tar", tarBall.number)
+}
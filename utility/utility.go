@@ -34,7 +34,9 @@ const (
 	VersionStr       = "005"
 	BaseBackupPath   = "basebackups_" + VersionStr + "/"
 	CatchupPath      = "catchup_" + VersionStr + "/"
+	ConfigPath       = "config_" + VersionStr + "/"
 	WalPath          = "wal_" + VersionStr + "/"
+	TombstonePath    = "tombstones_" + VersionStr + "/"
 	BackupNamePrefix = "base_"
 	BackupTimeFormat = "20060102T150405Z"
 